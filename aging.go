@@ -0,0 +1,120 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// A document's age is how long it has sat untagged, from its ingress time.
+// The inbox page shows it, amber once the document is past aging.warn_days
+// and red past aging.overdue_days. The nav counts the overdue documents,
+// and while there are any the inbox suggests taking the oldest first,
+// which orders the user's queue by ingress time until they switch back.
+
+const (
+	defaultAgingWarnDays    = 7
+	defaultAgingOverdueDays = 30
+)
+
+// AgingConfig sets when an untagged document counts as old.
+type AgingConfig struct {
+	WarnDays    int `yaml:"warn_days,omitempty"`    // shown amber after this many days (default 7)
+	OverdueDays int `yaml:"overdue_days,omitempty"` // shown red and counted in the nav after this many (default 30)
+}
+
+func (c AgingConfig) warnDays() int {
+	if c.WarnDays > 0 {
+		return c.WarnDays
+	}
+	return defaultAgingWarnDays
+}
+
+func (c AgingConfig) overdueDays() int {
+	if c.OverdueDays > 0 {
+		return c.OverdueDays
+	}
+	return defaultAgingOverdueDays
+}
+
+func (c AgingConfig) validate() error {
+	if c.WarnDays < 0 || c.OverdueDays < 0 {
+		return fmt.Errorf("aging: warn_days and overdue_days must be positive")
+	}
+	if c.warnDays() > c.overdueDays() {
+		return fmt.Errorf("aging: warn_days %d is after overdue_days %d", c.warnDays(), c.overdueDays())
+	}
+	return nil
+}
+
+// class is "overdue", "aging" or "" for a document of age.
+func (c AgingConfig) class(age time.Duration) string {
+	switch days := int(age / (24 * time.Hour)); {
+	case days >= c.overdueDays():
+		return "overdue"
+	case days >= c.warnDays():
+		return "aging"
+	}
+	return ""
+}
+
+// ingressTime parses a document's ingress time.
+func ingressTime(doc GodocsDocument) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, doc.IngressTime)
+	return t, err == nil
+}
+
+// docAge is how long doc has waited at now, if its ingress time is known.
+func docAge(doc GodocsDocument, now time.Time) (time.Duration, bool) {
+	t, ok := ingressTime(doc)
+	if !ok {
+		return 0, false
+	}
+	return max(now.Sub(t), 0), true
+}
+
+// formatAge gives an age in the largest whole unit: "40m", "5h", "12d".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	case d < 24*time.Hour:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	}
+	return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+}
+
+// countOverdue counts the untagged documents past overdue_days, for the
+// nav. Callers must hold app.mu.
+func (app *App) countOverdue() {
+	now := time.Now()
+	n := 0
+	for _, doc := range app.untagged {
+		if age, ok := docAge(doc, now); ok && app.config().Aging.class(age) == "overdue" {
+			n++
+		}
+	}
+	app.overdue.Store(int32(n))
+}
+
+// oldestFirst orders docs by ingress time, oldest first; those without one
+// go last.
+func oldestFirst(docs []GodocsDocument) {
+	slices.SortStableFunc(docs, func(a, b GodocsDocument) int {
+		ta, okA := ingressTime(a)
+		tb, okB := ingressTime(b)
+		if !okA || !okB {
+			return cmp.Compare(btoi(!okA), btoi(!okB))
+		}
+		return ta.Compare(tb)
+	})
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
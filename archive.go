@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// archiveKey is the reserved key to archive the current document, as in
+// mail clients.
+const archiveKey = "e"
+
+// Some documents need keeping but fit no tag. Archiving moves one to
+// archive_folder in godocs without tagging it, and documents in that folder
+// are left out of the inbox, so it does not come back at the next sync.
+// Undo moves it back to the folder it came from.
+
+// isArchived reports whether doc is in the archive folder.
+func (app *App) isArchived(doc GodocsDocument) bool {
+	return app.config().ArchiveFolder != "" && doc.Folder == app.config().ArchiveFolder
+}
+
+// handleArchive moves the current document to the archive folder.
+func (app *App) handleArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, name, pos := r.FormValue("ulid"), r.FormValue("name"), r.FormValue("pos")
+	if app.config().ArchiveFolder == "" {
+		app.fail(w, r, sess, "/?pos="+pos, false, errs.New(errs.Validation, "archive "+name, "archive_folder is not set in the config"))
+		return
+	}
+	posInt, _ := strconv.Atoi(pos)
+	queue := app.userQueue(sess)
+	if posInt < 1 || posInt > len(queue) || queue[posInt-1].ULID != ulid {
+		app.syncUntagged()
+		http.Redirect(w, r, "/?pos=1&flash=Queue+changed,+re-synced", http.StatusSeeOther)
+		return
+	}
+	from := queue[posInt-1].Folder
+	if err := app.docs.MoveDocument(ulid, app.config().ArchiveFolder); err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "archive "+name, err))
+		return
+	}
+	sess.pushAction(&LastAction{DocULID: ulid, DocName: name, Archived: true, Folder: from})
+	app.journalArchive(sess, actionArchive, ulid, name)
+	sess.release(ulid)
+	sess.record("archive to "+app.config().ArchiveFolder, ulid, name)
+	app.syncUntagged()
+	http.Redirect(w, r, "/?pos="+pos+"&flash=Archived "+name+" to "+app.config().ArchiveFolder, http.StatusSeeOther)
+}
+
+// undoArchive moves an archived document back to the folder it came from.
+func (app *App) undoArchive(sess *UserSession, last *LastAction) error {
+	if err := app.docs.MoveDocument(last.DocULID, last.Folder); err != nil {
+		return err
+	}
+	app.journalArchive(sess, actionUnarchive, last.DocULID, last.DocName)
+	app.syncUntagged()
+	return nil
+}
+
+func (app *App) journalArchive(sess *UserSession, action, ulid, name string) {
+	if err := app.store.AddAction(store.Action{User: sess.Name, Action: action, ULID: ulid, DocName: name}); err != nil {
+		log.Printf("journal: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AutoTagConfig turns on unattended tagging: every interval the untagged
+// queue is swept, OCR and the LLM stages are started for documents that
+// need them, and documents are tagged from what is then known about them.
+// Tags come from every rule whose pattern matches the document's name or
+// text, from a predicted document type of at least min_confidence, and from
+// a suggested tag set whose confidence (the similarity of the nearest
+// tagged documents that share it, over suggestNeighbours) is at least
+// min_confidence. Documents with none, or whose tags fall short of
+// required_groups, are left for manual triage. A rule with dry_run only
+// reports the documents it would tag, on the processing page:
+//
+//	auto_tag:
+//	  interval_minutes: 30     # 0, the default, turns it off
+//	  min_confidence: 0.9      # the default
+//	  rules:
+//	    - match: '(?i)council tax'
+//	      tag_ids: [12, 31]
+//	    - match: '(?i)water'
+//	      tag_ids: [14]
+//	      dry_run: true
+type AutoTagConfig struct {
+	IntervalMinutes int           `yaml:"interval_minutes,omitempty"`
+	MinConfidence   float64       `yaml:"min_confidence,omitempty"`
+	Rules           []AutoTagRule `yaml:"rules,omitempty"`
+}
+
+// AutoTagRule tags documents whose name or text matches a regexp.
+type AutoTagRule struct {
+	Match  string `yaml:"match"`
+	TagIDs []int  `yaml:"tag_ids"`
+	DryRun bool   `yaml:"dry_run,omitempty"` // report matches without tagging
+	re     *regexp.Regexp
+}
+
+const (
+	defaultAutoTagConfidence = 0.9
+	autoTagUser              = "auto-tag" // user recorded in the journal and events
+)
+
+func (c AutoTagConfig) interval() time.Duration {
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+func (c AutoTagConfig) minConfidence() float64 {
+	if c.MinConfidence == 0 {
+		return defaultAutoTagConfidence
+	}
+	return c.MinConfidence
+}
+
+// validate checks the settings against the server's tags and compiles the
+// rules.
+func (c *AutoTagConfig) validate(client DocumentStore) error {
+	if c.IntervalMinutes < 0 {
+		return fmt.Errorf("auto_tag: interval_minutes must be positive")
+	}
+	if c.MinConfidence < 0 || c.MinConfidence > 1 {
+		return fmt.Errorf("auto_tag: min_confidence %g out of range (0-1)", c.MinConfidence)
+	}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Match == "" {
+			return fmt.Errorf("auto_tag: rule %d needs a match regexp", i+1)
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("auto_tag: rule %d: %w", i+1, err)
+		}
+		if len(r.TagIDs) == 0 {
+			return fmt.Errorf("auto_tag: rule %d needs at least one tag_id", i+1)
+		}
+		for _, id := range r.TagIDs {
+			if _, ok := client.Tag(id); !ok {
+				return fmt.Errorf("auto_tag: rule %d: tag_id %d not found on server", i+1, id)
+			}
+		}
+		r.re = re
+	}
+	return nil
+}
+
+// AutoTagRun is the outcome of one sweep, shown on the processing page.
+type AutoTagRun struct {
+	Time    time.Time
+	Checked int      // untagged documents looked at
+	Tagged  []string // "bank.pdf ← letters, money (rule ...)"
+	Would   []string // likewise, for dry_run rules
+	Waiting int      // without text yet; OCR was started
+	Failed  int
+}
+
+// runAutoTagger sweeps the queue at the configured interval until ctx is
+// done. It returns at once if auto-tagging is off.
+func (app *App) runAutoTagger(ctx context.Context) {
+	every := app.config().AutoTag.interval()
+	if every == 0 {
+		return
+	}
+	log.Printf("auto-tag: sweeping every %v", every)
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		app.autoTagSweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// autoTagSweep tags what it can of the untagged queue. app.mu is taken
+// for each document in turn, so the inbox stays usable during a sweep.
+func (app *App) autoTagSweep(ctx context.Context) AutoTagRun {
+	app.mu.Lock()
+	app.syncUntagged()
+	queue := app.queue()
+	app.mu.Unlock()
+
+	run := AutoTagRun{Time: time.Now()}
+	for _, doc := range queue {
+		if ctx.Err() != nil {
+			break
+		}
+		run.Checked++
+		app.mu.Lock()
+		app.autoTag(ctx, doc, &run)
+		app.mu.Unlock()
+	}
+
+	app.mu.Lock()
+	if len(run.Tagged) > 0 {
+		app.syncUntagged()
+	}
+	app.autoTagLast = &run
+	app.mu.Unlock()
+	log.Printf("auto-tag: tagged %d of %d documents (%d waiting for OCR, %d failed, %d for dry-run rules)", len(run.Tagged), run.Checked, run.Waiting, run.Failed, len(run.Would))
+	return run
+}
+
+// autoTag tags one document if it can be tagged with confidence. Callers
+// must hold app.mu.
+func (app *App) autoTag(ctx context.Context, doc GodocsDocument, run *AutoTagRun) {
+	status, err := app.docs.FetchDocStatus(ctx, doc.ULID)
+	if err != nil {
+		log.Printf("auto-tag: status of %s: %v", doc.ULID, err)
+		run.Failed++
+		return
+	}
+	text := ""
+	if status.HasText {
+		if text, err = app.docs.FetchDocText(ctx, doc.ULID); err != nil {
+			log.Printf("auto-tag: text of %s: %v", doc.ULID, err)
+			run.Failed++
+			return
+		}
+	}
+	app.startProcessing(doc.ULID, status, text)
+	if !status.HasText {
+		run.Waiting++
+		return
+	}
+
+	app.autoTagDryRun(doc, text, run)
+	ids, why := app.autoTagChoice(doc, text)
+	if len(ids) == 0 {
+		return
+	}
+	var tags []GodocsTag
+	for _, id := range ids {
+		t, _ := app.docs.Tag(id)
+		tags = append(tags, t)
+	}
+	if problems := app.groupProblems(tags); len(problems) > 0 {
+		log.Printf("auto-tag: leaving %s, %s would still need %s", doc.ULID, strings.Join(why, ", "), strings.Join(problems, ", "))
+		return
+	}
+
+	added, err := app.docs.AddTags(doc.ULID, ids)
+	if err != nil {
+		log.Printf("auto-tag: tagging %s: %v", doc.ULID, err)
+		run.Failed++
+	}
+	if len(added) == 0 {
+		return
+	}
+	sess := &UserSession{Name: autoTagUser}
+	var entries []TagSetEntry
+	var names []string
+	for _, id := range added {
+		t, _ := app.docs.Tag(id)
+		entries = append(entries, TagSetEntry{ID: t.ID, Name: t.Name, Color: t.Color})
+		names = append(names, t.Name)
+	}
+	app.captureTagSet(sess, doc.ULID)
+	app.emitTagged(doc.ULID, doc.Name, autoTagUser, names...)
+	app.journalTag(sess, actionTag, doc.ULID, doc.Name, entries...)
+	if _, _, err := app.runTagActions(ctx, sess, doc, added...); err != nil {
+		log.Printf("auto-tag: tag actions on %s: %v", doc.ULID, err)
+	}
+	line := doc.Name + " ← " + strings.Join(names, ", ") + " (" + strings.Join(why, ", ") + ")"
+	log.Printf("auto-tag: %s", line)
+	run.Tagged = append(run.Tagged, line)
+}
+
+// autoTagChoice returns the tags the rules, the predicted document type and
+// the suggested tag sets agree doc should have, and why. Callers must hold
+// app.mu.
+func (app *App) autoTagChoice(doc GodocsDocument, text string) (ids []int, why []string) {
+	cfg := app.config().AutoTag
+	add := func(reason string, tagIDs ...int) {
+		for _, id := range tagIDs {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		why = append(why, reason)
+	}
+
+	subject := doc.Name + "\n" + text
+	for _, r := range cfg.Rules {
+		if !r.DryRun && r.re != nil && r.re.MatchString(subject) {
+			add("rule "+r.Match, r.TagIDs...)
+		}
+	}
+	if pred := app.docTypes[doc.ULID]; pred != nil && pred.Confidence >= cfg.minConfidence() {
+		if tag, err := app.ensureDocTypeTag(pred.Type); err != nil {
+			log.Printf("auto-tag: %s tag: %v", pred.Type, err)
+		} else {
+			add(fmt.Sprintf("%s %.0f%%", pred.Type, pred.Confidence*100), tag.ID)
+		}
+	}
+	if s := app.suggestTagSets(doc.ULID); len(s) > 0 {
+		if conf := s[0].Score / suggestNeighbours; conf >= cfg.minConfidence() {
+			var tagIDs []int
+			for _, t := range s[0].Tags {
+				tagIDs = append(tagIDs, t.ID)
+			}
+			add(fmt.Sprintf("like %d tagged documents %.0f%%", s[0].Neighbours, conf*100), tagIDs...)
+		}
+	}
+	return ids, why
+}
+
+// autoTagDryRun notes the documents dry_run rules would tag.
+func (app *App) autoTagDryRun(doc GodocsDocument, text string, run *AutoTagRun) {
+	subject := doc.Name + "\n" + text
+	for _, r := range app.config().AutoTag.Rules {
+		if !r.DryRun || r.re == nil || !r.re.MatchString(subject) {
+			continue
+		}
+		var names []string
+		for _, id := range r.TagIDs {
+			t, _ := app.docs.Tag(id)
+			names = append(names, t.Name)
+		}
+		line := doc.Name + " ← " + strings.Join(names, ", ") + " (rule " + r.Match + ")"
+		log.Printf("auto-tag: dry run: would tag %s", line)
+		run.Would = append(run.Would, line)
+	}
+}
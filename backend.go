@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"time"
+)
+
+// The documents and tags being triaged live in a DocumentStore, and the
+// handlers, pipeline and commands reach them only through app.docs, so each
+// has one code path whatever the backend. *GodocsClient is the store for a
+// godocs server; LocalStore (localstore.go) keeps them in memory for demo
+// mode. The few godocs-only features, the response and text caches, the
+// version check, the hook and recording, use app.client, which is nil for
+// any other store. A new backend implements DocumentStore and nothing else.
+
+// DocumentStore is a backend holding documents and their tags. Methods
+// without a context run under the store's own timeout.
+type DocumentStore interface {
+	// Tags
+	FetchTags() ([]GodocsTag, error)
+	Tag(id int) (GodocsTag, bool) // as of the last FetchTags or CreateTag
+	KnownTags() []GodocsTag       // likewise
+	FetchTagGroups(ctx context.Context) ([]string, error)
+	CreateTag(name, color, group string) (*GodocsTag, error)
+	DeleteTag(tagID int) error
+
+	// Listing
+	FetchUntagged(page, pageSize int) (*GodocsSearchResponse, error)
+	FetchTagged(ctx context.Context, tagID, page, pageSize int) (*GodocsSearchResponse, error)
+	TagCount(ctx context.Context, tagID int) (int, error) // documents carrying the tag
+	IterateDocuments(ctx context.Context, tagID int) iter.Seq2[GodocsDocument, error]
+	IterateUntagged(ctx context.Context) iter.Seq2[GodocsDocument, error]
+	SearchDocuments(ctx context.Context, q SearchQuery, limit int) ([]GodocsDocument, error)
+
+	// One document
+	FetchDocStatus(ctx context.Context, ulid string) (*GodocsDocStatus, error)
+	FetchDocText(ctx context.Context, ulid string) (string, error)
+	FetchDocTags(ctx context.Context, ulid string) ([]GodocsTag, error)
+	AddTag(ulid string, tagID int) error
+	AddTags(ulid string, tagIDs []int) ([]int, error)
+	RemoveTag(ulid string, tagID int) error
+	UploadDocumentText(ulid, text string) error
+	UpdateDocumentDate(ulid, date string) error
+	MoveDocument(ulid, folder string) error
+	DeleteDocument(ulid string) error
+	DownloadDocument(ulid, pattern string, maxBytes int64) (string, error)
+	Thumbnail(ctx context.Context, ulid string) (data []byte, contentType string, err error)
+	ViewURL(ulid string) string // "" when the document cannot be opened in a browser
+
+	// New documents
+	UploadDocument(name string, r io.Reader) (*GodocsDocument, error)
+	CreateDocument(ctx context.Context, path string, opts CreateOptions) (*GodocsDocument, error)
+
+	// Ping checks the backend is reachable and reports the round trip.
+	Ping() (time.Duration, error)
+}
+
+var _ DocumentStore = (*GodocsClient)(nil)
+
+// Tag returns a tag by ID from those last fetched.
+func (c *GodocsClient) Tag(id int) (GodocsTag, bool) {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+	t, ok := c.tags[id]
+	return t, ok
+}
+
+// KnownTags returns the tags last fetched, in no particular order.
+func (c *GodocsClient) KnownTags() []GodocsTag {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+	tags := make([]GodocsTag, 0, len(c.tags))
+	for _, t := range c.tags {
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+// Thumbnail fetches a document's thumbnail image.
+func (c *GodocsClient) Thumbnail(ctx context.Context, ulid string) ([]byte, string, error) {
+	resp, err := c.getWithContext(ctx, c.baseURL+"/api/document/"+ulid+"/thumbnail")
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode >= 400 {
+		err = fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// ViewURL is where godocs shows a document.
+func (c *GodocsClient) ViewURL(ulid string) string {
+	return c.baseURL + "/document/view/" + ulid
+}
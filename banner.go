@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// ErrorBanner is a failed action shown at the top of the inbox and review
+// pages until the user dismisses or retries it. Unlike a flash it survives
+// reloads, so a failed tag is not mistaken for one that went through.
+type ErrorBanner struct {
+	ID       int
+	Kind     string // errs.Kind: upstream, validation, pipeline
+	Message  string
+	Guidance string
+	Back     string     // page the action was made from
+	Action   string     // handler to submit Fields to on retry; "" if retrying cannot help
+	Fields   url.Values // the failed form, without its CSRF token
+}
+
+// fail records err in the session's banner and redirects to back. If retry
+// is set and err is of a kind that may pass on a second attempt, the banner
+// offers to submit the same form again. Without a session (a multi-user
+// inbox before a user is chosen) the error is flashed instead. Callers must
+// hold app.mu.
+func (app *App) fail(w http.ResponseWriter, r *http.Request, sess *UserSession, back string, retry bool, err error) {
+	log.Printf("%s: %v", r.URL.Path, err)
+	if sess == nil {
+		sep := "?"
+		if strings.Contains(back, "?") {
+			sep = "&"
+		}
+		http.Redirect(w, r, back+sep+"flash="+url.QueryEscape("Error: "+errs.Message(err)), http.StatusSeeOther)
+		return
+	}
+	app.bannerSeq++
+	b := &ErrorBanner{
+		ID:       app.bannerSeq,
+		Kind:     errs.KindOf(err).String(),
+		Message:  errs.Message(err),
+		Guidance: errs.Guidance(err),
+		Back:     back,
+	}
+	if retry && errs.Retryable(err) {
+		b.Action = r.URL.Path
+		b.Fields = url.Values{}
+		for k, v := range r.PostForm {
+			if k != csrfField {
+				b.Fields[k] = v
+			}
+		}
+	}
+	sess.Banner = b
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// writeError answers a JSON endpoint with err, its kind and what to do
+// about it.
+func writeError(w http.ResponseWriter, err error) {
+	log.Printf("%v", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(errs.Status(err))
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    errs.Message(err),
+		"kind":     errs.KindOf(err).String(),
+		"guidance": errs.Guidance(err),
+	})
+}
+
+// handleErrorBanner dismisses the session's banner, or with do=retry
+// submits its failed form again. The retried handler answers the request,
+// and shows a new banner if it fails again.
+func (app *App) handleErrorBanner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		app.mu.Unlock()
+		return
+	}
+	b := sess.Banner
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	if b == nil || b.ID != id {
+		app.mu.Unlock()
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	sess.Banner = nil
+	app.mu.Unlock()
+
+	if r.FormValue("do") != "retry" || b.Action == "" {
+		http.Redirect(w, r, b.Back, http.StatusSeeOther)
+		return
+	}
+	req, err := http.NewRequestWithContext(r.Context(), "POST", b.Action, strings.NewReader(b.Fields.Encode()))
+	if err != nil {
+		http.Redirect(w, r, b.Back, http.StatusSeeOther)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range r.Cookies() {
+		req.AddCookie(c)
+	}
+	app.mux.ServeHTTP(w, req)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// normalizeBasePath canonicalises the base_path option: "inbox", "/inbox/"
+// and "/inbox" all become "/inbox", and "" or "/" mean the site root.
+func normalizeBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// withBasePath serves h under base, so a reverse proxy can forward
+// /inbox/... unchanged. Handlers keep seeing root-relative paths, and the
+// root-relative redirects they issue are rewritten to include base.
+func withBasePath(base string, h http.Handler) http.Handler {
+	if base == "" {
+		return h
+	}
+	mux := http.NewServeMux()
+	mux.Handle(base+"/", http.StripPrefix(base, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&basePathWriter{ResponseWriter: w, base: base}, r)
+	})))
+	mux.Handle(base, http.RedirectHandler(base+"/", http.StatusMovedPermanently))
+	return mux
+}
+
+// basePathWriter prefixes root-relative Location headers with base.
+type basePathWriter struct {
+	http.ResponseWriter
+	base string
+}
+
+func (w *basePathWriter) WriteHeader(code int) {
+	if loc := w.Header().Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+		w.Header().Set("Location", w.base+loc)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *basePathWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// publicURL is the externally visible URL of the inbox root, as seen by the
+// client. X-Forwarded-Proto and X-Forwarded-Host from a reverse proxy take
+// precedence over the connection's own scheme and host.
+func (app *App) publicURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme, _, _ = strings.Cut(p, ",")
+	}
+	host := r.Host
+	if h := r.Header.Get("X-Forwarded-Host"); h != "" {
+		host, _, _ = strings.Cut(h, ",")
+	}
+	return strings.TrimSpace(scheme) + "://" + strings.TrimSpace(host) + app.config().BasePath
+}
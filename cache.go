@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheTTL is how long a cached godocs response is reused without
+// revalidation when cache_ttl_seconds is unset.
+const defaultCacheTTL = 60 * time.Second
+
+type cacheEntry struct {
+	body         []byte
+	etag         string
+	lastModified string
+	fetched      time.Time
+}
+
+// responseCache holds GET responses for rarely-changing godocs resources
+// (tags, tag groups, document status). Entries younger than ttl are served
+// directly; older ones are revalidated with If-None-Match/If-Modified-Since.
+type responseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, entries: make(map[string]*cacheEntry)}
+}
+
+// invalidate drops every entry whose URL starts with one of the prefixes.
+func (rc *responseCache) invalidate(prefixes ...string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for url := range rc.entries {
+		for _, p := range prefixes {
+			if strings.HasPrefix(url, p) {
+				delete(rc.entries, url)
+				break
+			}
+		}
+	}
+}
+
+func (rc *responseCache) clear() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries = make(map[string]*cacheEntry)
+}
+
+func (rc *responseCache) size() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.entries)
+}
+
+// getCached fetches url through the response cache and returns the body.
+func (c *GodocsClient) getCached(ctx context.Context, url string) ([]byte, error) {
+	rc := c.cache
+	rc.mu.Lock()
+	entry := rc.entries[url]
+	if entry != nil && time.Since(entry.fetched) < rc.ttl {
+		body := entry.body
+		rc.mu.Unlock()
+		return body, nil
+	}
+	rc.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if entry.etag != "" {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+		if entry.lastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.lastModified)
+		}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		rc.mu.Lock()
+		entry.fetched = time.Now()
+		rc.mu.Unlock()
+		return entry.body, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	rc.mu.Lock()
+	rc.entries[url] = &cacheEntry{
+		body:         body,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		fetched:      time.Now(),
+	}
+	rc.mu.Unlock()
+	return body, nil
+}
+
+// invalidateDoc drops cached responses for one document after a write.
+func (c *GodocsClient) invalidateDoc(ulid string) {
+	c.cache.invalidate(fmt.Sprintf("%s/api/document/%s/", c.baseURL, ulid))
+}
+
+// invalidateTagCount drops the cached document count of a tag after a
+// document gains or loses it, or of every tag for tagID 0.
+func (c *GodocsClient) invalidateTagCount(tagID int) {
+	prefix := c.baseURL + "/api/documents/tag/"
+	if tagID != 0 {
+		prefix += strconv.Itoa(tagID) + "?"
+	}
+	c.cache.invalidate(prefix)
+}
+
+// invalidateTags drops cached tag and tag group listings after a tag is created.
+func (c *GodocsClient) invalidateTags() {
+	c.cache.invalidate(c.baseURL + "/api/tags")
+}
+
+// textCache keeps document full text on disk, one file per ULID, so renders
+// of the same document do not refetch it from godocs. Text written by the
+// pipeline replaces the cached copy; empty text is never cached, since OCR
+// may still add some. A nil *textCache caches nothing.
+type textCache struct {
+	dir string
+}
+
+func newTextCache(dir string) *textCache {
+	os.MkdirAll(dir, 0755)
+	return &textCache{dir: dir}
+}
+
+func (tc *textCache) path(ulid string) string {
+	return filepath.Join(tc.dir, filepath.Base(ulid)+".txt")
+}
+
+func (tc *textCache) get(ulid string) (string, bool) {
+	if tc == nil {
+		return "", false
+	}
+	b, err := os.ReadFile(tc.path(ulid))
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// put stores text, written via a temp file so readers never see a partial copy.
+func (tc *textCache) put(ulid, text string) {
+	if tc == nil {
+		return
+	}
+	if text == "" {
+		tc.remove(ulid)
+		return
+	}
+	f, err := os.CreateTemp(tc.dir, ".text-*")
+	if err != nil {
+		return
+	}
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), tc.path(ulid))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func (tc *textCache) remove(ulid string) {
+	if tc != nil {
+		os.Remove(tc.path(ulid))
+	}
+}
+
+func (tc *textCache) clear() {
+	if tc == nil {
+		return
+	}
+	matches, _ := filepath.Glob(filepath.Join(tc.dir, "*.txt"))
+	for _, m := range matches {
+		os.Remove(m)
+	}
+}
+
+// size returns the number of cached texts.
+func (tc *textCache) size() int {
+	if tc == nil {
+		return 0
+	}
+	matches, _ := filepath.Glob(filepath.Join(tc.dir, "*.txt"))
+	return len(matches)
+}
+
+// handleRefreshCache empties the godocs response and text caches.
+func (app *App) handleRefreshCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "not allowed", 405)
+		return
+	}
+	if app.client != nil {
+		app.client.cache.clear()
+		app.client.texts.clear()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"cleared":true}`))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/llm"
+)
+
+const (
+	chatKey         = "c"  // reserved key to open the chat panel
+	maxChatContext  = 8000 // characters of document text given to the model
+	maxChatMessages = 20   // earlier turns are dropped
+)
+
+type chatRequest struct {
+	ULID     string        `json:"ulid"`
+	Messages []llm.Message `json:"messages"`
+}
+
+// handleChat answers a question about a document from its text. The reply
+// streams back as server-sent events: "token" events carrying text, then
+// "done" with the model that answered, or "error". The conversation so far
+// is sent with each question; nothing is kept on the server.
+func (app *App) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ULID == "" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var turns []llm.Message
+	for _, m := range req.Messages {
+		if (m.Role == "user" || m.Role == "assistant") && strings.TrimSpace(m.Content) != "" {
+			turns = append(turns, m)
+		}
+	}
+	if len(turns) == 0 || turns[len(turns)-1].Role != "user" {
+		http.Error(w, "no question", http.StatusBadRequest)
+		return
+	}
+	if len(turns) > maxChatMessages {
+		turns = turns[len(turns)-maxChatMessages:]
+	}
+
+	text, err := app.docs.FetchDocText(r.Context(), req.ULID)
+	if err != nil {
+		writeError(w, errs.E(errs.Upstream, "chat: fetch text", err))
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		http.Error(w, "document has no text yet", http.StatusConflict)
+		return
+	}
+	if len(text) > maxChatContext {
+		text = text[:maxChatContext]
+	}
+	system, err := app.config().prompts.Render(llm.PromptChat, app.promptVars(text))
+	if err != nil {
+		writeError(w, errs.E(errs.Validation, "chat", err))
+		return
+	}
+	messages := append([]llm.Message{{Role: "system", Content: system}}, turns...)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // stop nginx buffering the stream
+	rc := http.NewResponseController(w)
+	send := func(event string, data any) error {
+		b, _ := json.Marshal(data)
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	// Fall back to the next model only if nothing has been streamed yet
+	models, err := app.availableModels(taskChat)
+	for _, m := range models {
+		m.OnUsage = func(u llm.Usage) { app.recordLLMUsage(taskChat, req.ULID, m.String(), u) }
+		sent := false
+		err = llm.Chat(r.Context(), m, messages, func(token string) error {
+			sent = true
+			return send("token", map[string]string{"text": token})
+		})
+		if err == nil {
+			log.Printf("llm: chat for %s by %s", req.ULID, m)
+			send("done", map[string]string{"model": m.String()})
+			return
+		}
+		log.Printf("llm: chat for %s with %s failed: %v", req.ULID, m, err)
+		if sent || r.Context().Err() != nil {
+			break
+		}
+	}
+	err = errs.E(errs.Pipeline, "chat", err)
+	send("error", map[string]string{"error": errs.Message(err), "guidance": errs.Guidance(err)})
+}
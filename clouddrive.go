@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/clouddrive"
+)
+
+// CloudDriveConfig polls a Dropbox or Google Drive folder, such as the one
+// a phone scanning app saves to, uploads new files to godocs and moves them
+// to a processed folder (see ingest.go). The OAuth credentials are those of
+// an app registered with the provider, with a refresh token from its
+// consent flow:
+//
+//	cloud_drives:
+//	  - provider: dropbox          # or google_drive
+//	    folder: /Scans             # Google Drive: the folder ID
+//	    processed_folder: /Scans/processed
+//	    client_id: abc
+//	    client_secret: def
+//	    refresh_token: ghi
+//	    tag_id: 41                 # e.g. source:dropbox, added once triaged
+//	    interval_seconds: 300      # the default
+type CloudDriveConfig struct {
+	Provider        string `yaml:"provider"`
+	Folder          string `yaml:"folder"`
+	ProcessedFolder string `yaml:"processed_folder,omitempty"` // "" leaves files where they are
+	ClientID        string `yaml:"client_id"`
+	ClientSecret    string `yaml:"client_secret"`
+	RefreshToken    string `yaml:"refresh_token"`
+	TagID           int    `yaml:"tag_id,omitempty"`
+	IntervalSeconds int    `yaml:"interval_seconds,omitempty"`
+}
+
+const (
+	providerDropbox     = "dropbox"
+	providerGoogleDrive = "google_drive"
+
+	defaultCloudDriveInterval = 5 * time.Minute
+)
+
+func (c CloudDriveConfig) interval() time.Duration {
+	if c.IntervalSeconds == 0 {
+		return defaultCloudDriveInterval
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+// label names the folder on the processing page.
+func (c CloudDriveConfig) label() string {
+	if c.Provider == providerDropbox {
+		return "Dropbox " + c.Folder
+	}
+	return "Google Drive " + c.Folder
+}
+
+// drive returns the client for the folder.
+func (c CloudDriveConfig) drive() clouddrive.Drive {
+	opts := clouddrive.Options{Folder: c.Folder, Processed: c.ProcessedFolder,
+		ClientID: c.ClientID, ClientSecret: c.ClientSecret, RefreshToken: c.RefreshToken}
+	if c.Provider == providerDropbox {
+		return clouddrive.NewDropbox(opts)
+	}
+	return clouddrive.NewGoogleDrive(opts)
+}
+
+// validateCloudDrives checks the settings against the server's tags.
+func validateCloudDrives(client DocumentStore, drives []CloudDriveConfig) error {
+	for i, c := range drives {
+		if c.Provider != providerDropbox && c.Provider != providerGoogleDrive {
+			return fmt.Errorf("cloud_drives: drive %d: provider must be %s or %s", i+1, providerDropbox, providerGoogleDrive)
+		}
+		if c.Folder == "" {
+			return fmt.Errorf("cloud_drives: drive %d needs a folder", i+1)
+		}
+		if c.ClientID == "" || c.ClientSecret == "" || c.RefreshToken == "" {
+			return fmt.Errorf("cloud_drives: drive %d needs client_id, client_secret and refresh_token", i+1)
+		}
+		if c.IntervalSeconds < 0 {
+			return fmt.Errorf("cloud_drives: drive %d: interval_seconds must be positive", i+1)
+		}
+		if c.TagID != 0 {
+			if _, ok := client.Tag(c.TagID); !ok {
+				return fmt.Errorf("cloud_drives: drive %d: tag_id %d not found on server", i+1, c.TagID)
+			}
+		}
+	}
+	return nil
+}
+
+// runCloudDrives polls each configured folder at its interval until ctx is
+// done.
+func (app *App) runCloudDrives(ctx context.Context) {
+	for _, c := range app.config().CloudDrives {
+		d := c.drive()
+		log.Printf("cloud drive: polling %s every %v", c.label(), c.interval())
+		go app.pollSource(ctx, c.interval(), func(ctx context.Context) IngestRun {
+			return app.cloudDriveSweep(ctx, c, d)
+		})
+	}
+}
+
+// cloudDriveSweep uploads the files in a folder that are new or have
+// changed since they were last uploaded, and moves them to the processed
+// folder. The caller syncs the queue.
+func (app *App) cloudDriveSweep(ctx context.Context, c CloudDriveConfig, d clouddrive.Drive) IngestRun {
+	run := IngestRun{Source: c.label(), Time: time.Now()}
+	files, err := d.List(ctx)
+	if err != nil {
+		log.Printf("cloud drive: %s: %v", c.label(), err)
+		run.Error = err.Error()
+		return run
+	}
+	seen, err := app.store.IngestedVersions(c.Provider)
+	if err != nil {
+		log.Printf("state: %v", err)
+		run.Error = err.Error()
+		return run
+	}
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		if seen[f.ID] == f.Version {
+			// Uploaded before, but the move failed
+			app.markProcessed(ctx, c, d, f)
+			continue
+		}
+		if f.Size == 0 {
+			continue
+		}
+		if f.Size > app.maxDownloadBytes() {
+			run.Skipped++
+			continue
+		}
+		if err := app.ingestCloudFile(ctx, c, d, f); err != nil {
+			log.Printf("cloud drive: %s: %v", f.Name, err)
+			run.Failed++
+			continue
+		}
+		run.Uploaded = append(run.Uploaded, f.Name)
+		app.markProcessed(ctx, c, d, f)
+	}
+	return run
+}
+
+func (app *App) ingestCloudFile(ctx context.Context, c CloudDriveConfig, d clouddrive.Drive, f clouddrive.File) error {
+	body, err := d.Open(ctx, f)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = app.ingestFile(c.Provider, f.ID, f.Version, f.Name, body, c.TagID)
+	return err
+}
+
+func (app *App) markProcessed(ctx context.Context, c CloudDriveConfig, d clouddrive.Drive, f clouddrive.File) {
+	if err := d.MarkProcessed(ctx, f); err != nil {
+		log.Printf("cloud drive: moving %s to %s: %v", f.Name, c.ProcessedFolder, err)
+	}
+}
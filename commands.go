@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runCommand executes a CLI subcommand (e.g. "tags audit") against the
+// configured godocs server, or the named profile's, and returns the process
+// exit code.
+func runCommand(args []string, profile string) int {
+	cmd := strings.Join(args[:min(2, len(args))], " ")
+
+	cfg, err := loadConfig(configFileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	cfgs, err := cfg.profileConfigs(profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(cfgs) > 1 {
+		fmt.Fprintf(os.Stderr, "Error: %d profiles are configured; choose one with -profile\n", len(cfgs))
+		return 1
+	}
+	cfg = cfgs[0]
+	if cfg.GodocsServer == "" {
+		fmt.Fprintf(os.Stderr, "Error: godocs_server must be set in %s\n", configFileName)
+		return 1
+	}
+	if err := setToolPaths(cfg.ToolPaths); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := cfg.loadPrompts(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch cmd {
+	case "tags audit":
+		err = runTagsAudit(cfg, os.Stdout)
+	case "tags merge":
+		if len(args) != 4 {
+			fmt.Fprintf(os.Stderr, "Usage: godocs-inbox %s <keep-id> <duplicate-id>\n", cmd)
+			return 2
+		}
+		err = runTagsMerge(cfg, args[2], args[3], os.Stdout)
+	case "dupes scan":
+		err = runDupesScan(cfg, os.Stdout)
+	case "embeddings scan":
+		err = runEmbeddingsScan(cfg, os.Stdout)
+	case "paperless import", "paperless export":
+		if len(args) != 3 {
+			fmt.Fprintf(os.Stderr, "Usage: godocs-inbox %s <dir>\n", cmd)
+			return 2
+		}
+		if cmd == "paperless import" {
+			err = runPaperlessImport(cfg, args[2], os.Stdout)
+		} else {
+			err = runPaperlessExport(cfg, args[2], os.Stdout)
+		}
+	case "doctor":
+		err = runDoctor(cfg, os.Stdout)
+	case "export actions":
+		err = runExportActions(cfg, args[2:], os.Stdout)
+	case "export documents":
+		err = runExportDocuments(cfg, args[2:], os.Stdout)
+	case "import actions":
+		if len(args) != 3 {
+			fmt.Fprintf(os.Stderr, "Usage: godocs-inbox %s <file>\n", cmd)
+			return 2
+		}
+		err = runImportActions(cfg, args[2], os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", strings.Join(args, " "))
+		printUsage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// Before filing something that matters on the strength of its OCR, the
+// compare page shows the page image beside the text. Tesseract's TSV output
+// gives where each line of text is on the page OCR'd, kept in the state
+// database, so the two panes scroll together and the line under the mouse
+// is boxed on the image. The image is that same page: the first page of a
+// PDF rendered as for OCR, or the image itself, cached beside the hi-res
+// thumbnails. Without line positions (text read from a PDF's text layer, or
+// corrected by hand) the text is shown unsynchronised.
+
+// pageImageTypes are shown as they are; PDFs are rendered with pdftoppm.
+var pageImageTypes = []string{".png", ".jpg", ".jpeg", ".bmp"}
+
+type ComparePageData struct {
+	Page     string
+	User     string
+	ULID     string
+	Name     string
+	Pos      string
+	ImageURL string          // "" when there is no page image
+	Lines    []store.OCRLine // with positions, when known
+	Text     string          // otherwise
+	Banner   *ErrorBanner
+}
+
+// recordOCRLines stores where the lines of ulid's fresh OCR text are on its
+// page, or forgets them when lines is empty.
+func (app *App) recordOCRLines(ulid string, lines []ocr.Line) {
+	var err error
+	if len(lines) == 0 {
+		err = app.store.DeleteOCRLines(ulid)
+	} else {
+		out := make([]store.OCRLine, len(lines))
+		for i, l := range lines {
+			out[i] = store.OCRLine{Text: l.Text, Left: l.Left, Top: l.Top, Width: l.Width, Height: l.Height}
+		}
+		err = app.store.PutOCRLines(ulid, out)
+	}
+	if err != nil {
+		log.Printf("state: %v", err)
+	}
+}
+
+// canRenderPage reports whether a page image can be made for docType.
+func (app *App) canRenderPage(docType string) bool {
+	docType = normalizeDocType(docType)
+	return slices.Contains(pageImageTypes, docType) || docType == ".pdf" && app.hasTool("pdftoppm")
+}
+
+func (app *App) pagePath(ulid, docType string) string {
+	ext := normalizeDocType(docType)
+	if ext == ".pdf" {
+		ext = ".png"
+	}
+	return filepath.Join(app.thumbDir, "pages", ulid+ext)
+}
+
+// handleCompare shows a document's page image beside its text.
+func (app *App) handleCompare(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, pos := r.FormValue("ulid"), r.FormValue("pos")
+	status, err := app.docs.FetchDocStatus(r.Context(), ulid)
+	if err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "compare "+ulid, err))
+		return
+	}
+	data := ComparePageData{Page: "compare", User: sess.Name, ULID: ulid, Name: status.Name, Pos: pos, Banner: sess.Banner}
+	switch {
+	case app.canRenderPage(status.DocumentType):
+		data.ImageURL = "/compare/page/" + ulid
+	case app.hiresThumbExists(ulid):
+		data.ImageURL = "/hires/thumbnail/" + ulid
+	case status.HasThumbnail:
+		data.ImageURL = "/proxy/thumbnail/" + ulid
+	}
+	if data.Lines, err = app.store.OCRLines(ulid); err != nil {
+		log.Printf("state: %v", err)
+	}
+	if len(data.Lines) == 0 {
+		if data.Text, err = app.docs.FetchDocText(r.Context(), ulid); err != nil {
+			app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "text of "+status.Name, err))
+			return
+		}
+	}
+	app.templates().ExecuteTemplate(w, "compare.html", data)
+}
+
+// handleComparePage serves the page image OCR read, rendering and caching
+// it on first use.
+func (app *App) handleComparePage(w http.ResponseWriter, r *http.Request) {
+	ulid := strings.TrimPrefix(r.URL.Path, "/compare/page/")
+	status, err := app.docs.FetchDocStatus(r.Context(), ulid)
+	if err != nil || !app.canRenderPage(status.DocumentType) {
+		http.NotFound(w, r)
+		return
+	}
+	path := app.pagePath(ulid, status.DocumentType)
+	if _, err := os.Stat(path); err != nil {
+		if err := app.renderPage(r, ulid, status.DocumentType, path); err != nil {
+			log.Printf("compare: page image for %s: %v", ulid, err)
+			http.Error(w, "page image failed", http.StatusBadGateway)
+			return
+		}
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFile(w, r, path)
+}
+
+// renderPage writes the page image to path, by way of a temp file so a
+// half-written image is never served.
+func (app *App) renderPage(r *http.Request, ulid, docType, path string) error {
+	docPath, err := app.docs.DownloadDocument(ulid, "godocs-page-*"+docType, app.maxDownloadBytes())
+	if err != nil {
+		return err
+	}
+	defer scratch.release(docPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := strings.TrimSuffix(path, filepath.Ext(path)) + ".tmp" + filepath.Ext(path)
+	if err := ocr.RenderPage(r.Context(), docPath, docType, tmp, app.pdfPasswords(ulid)...); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/drummonds/godocs-inbox/internal/brotli"
+)
+
+// For remote use over slow links, text responses (pages, JSON, CSS,
+// scripts) are compressed with brotli or gzip for clients that accept it,
+// and static assets, thumbnails and JSON API responses carry an ETag so a
+// repeat request is answered 304 Not Modified. The brotli encoder is
+// internal/brotli, as the standard library has none.
+
+// compressible reports whether a Content-Type is worth compressing; images
+// and PDFs are compressed already, and event streams are sent a token at a
+// time.
+func compressible(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if mt == "text/event-stream" {
+		return false
+	}
+	return strings.HasPrefix(mt, "text/") || mt == "application/json" || mt == "application/javascript" ||
+		mt == "application/manifest+json" || mt == "image/svg+xml"
+}
+
+// encoder is a gzip or brotli writer.
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(io.Writer)
+}
+
+// encoders pools the writers for each Content-Encoding offered.
+var encoders = map[string]*sync.Pool{
+	"br":   {New: func() any { return brotli.NewWriter(io.Discard) }},
+	"gzip": {New: func() any { return gzip.NewWriter(io.Discard) }},
+}
+
+// compressResponseWriter compresses the body once the handler's
+// Content-Type shows it is worth it.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string  // br or gzip
+	enc      encoder // nil until decided, and when not compressing
+	decided  bool
+}
+
+func (w *compressResponseWriter) decide(status int, first []byte) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(first) > 0 {
+		h.Set("Content-Type", http.DetectContentType(first))
+	}
+	h.Add("Vary", "Accept-Encoding")
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		return
+	}
+	h.Set("Content-Encoding", w.encoding)
+	h.Del("Content-Length")
+	w.enc = encoders[w.encoding].Get().(encoder)
+	w.enc.Reset(w.ResponseWriter)
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	w.decide(code, nil)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.decide(http.StatusOK, b)
+	}
+	if w.enc == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.enc.Write(b)
+}
+
+// Flush sends what has been compressed so far, for streamed responses.
+func (w *compressResponseWriter) Flush() {
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressResponseWriter) close() {
+	if w.enc != nil {
+		w.enc.Close()
+		encoders[w.encoding].Put(w.enc)
+		w.enc = nil
+	}
+}
+
+// compressResponses compresses compressible responses for clients that
+// accept brotli or gzip.
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if r.Method == "HEAD" || r.Header.Get("Range") != "" || encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding reads an Accept-Encoding header: br if it is listed,
+// else gzip if it or * is, honouring q=0. It returns "" for neither.
+func acceptedEncoding(header string) string {
+	accepts := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		accepts[strings.ToLower(enc)] = strings.ReplaceAll(params, " ", "") != "q=0"
+	}
+	if accepts["br"] {
+		return "br"
+	}
+	if ok, listed := accepts["gzip"]; ok || !listed && accepts["*"] {
+		return "gzip"
+	}
+	return ""
+}
+
+// etagFor is a strong ETag of a response body.
+func etagFor(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// notModified sets etag on the response and reports whether the request's
+// If-None-Match already has it, in which case 304 has been sent.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if t = strings.TrimSpace(t); t == etag || t == "W/"+etag || t == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponse holds a response so its ETag can be computed.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) WriteHeader(code int)        { b.status = code }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+// revalidateAPI gives successful JSON responses to GETs under /api/ an ETag
+// and answers 304 when the client has it. They are per-user and change
+// often, so clients must revalidate every time.
+func revalidateAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buf := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+		for k, v := range buf.header {
+			w.Header()[k] = v
+		}
+		if buf.status == http.StatusOK && strings.HasPrefix(buf.header.Get("Content-Type"), "application/json") {
+			if w.Header().Get("Cache-Control") == "" {
+				w.Header().Set("Cache-Control", "private, no-cache")
+			}
+			if notModified(w, r, etagFor(buf.body.Bytes())) {
+				return
+			}
+		}
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+	})
+}
+
+// assetETags caches the ETags of the static assets, which do not change
+// while the inbox runs (except with -dev).
+var assetETags sync.Map // fs path → ETag
+
+// assetETag returns the ETag of a static asset, or "" if it cannot be read.
+func assetETag(fsys fs.FS, name string) string {
+	if etag, ok := assetETags.Load(name); ok {
+		return etag.(string)
+	}
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return ""
+	}
+	etag := etagFor(b)
+	assetETags.Store(name, etag)
+	return etag
+}
+
+// fileETag is a weak ETag from a file's size and modification time, for
+// files served with http.ServeFile.
+func fileETag(fi fs.FileInfo) string {
+	return fmt.Sprintf(`W/"%x-%x"`, fi.Size(), fi.ModTime().UnixNano())
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// A document can be tagged in the godocs UI, or by another user, while it
+// is open in the inbox. A tag button toggles from the state the page was
+// rendered with, so acting on that state could add a tag that is already
+// there or remove one just added. The tag editors send the tag IDs they
+// show with each toggle; checkDocTags refetches the document's tags from
+// godocs and, when they differ, the toggle is refused with a Conflict
+// error and the page shows "This document changed — reload" instead. Queued
+// offline actions get a similar check on replay (see offline.go).
+// In a dry run godocs never gets the toggles, so there is nothing to check.
+
+// checkDocTags returns a Conflict error if ulid's tags in godocs are not
+// seen, the tag IDs the page showed. A nil seen skips the check.
+func (app *App) checkDocTags(ctx context.Context, ulid string, seen []int) error {
+	if seen == nil || app.dryRun() != nil {
+		return nil
+	}
+	tags, err := app.docs.FetchDocTags(ctx, ulid)
+	if err != nil {
+		return errs.E(errs.Upstream, "tags of "+ulid, err)
+	}
+	current := make([]int, len(tags))
+	for i, t := range tags {
+		current[i] = t.ID
+	}
+	seen = slices.Clone(seen)
+	slices.Sort(current)
+	slices.Sort(seen)
+	if !slices.Equal(slices.Compact(current), slices.Compact(seen)) {
+		return errs.New(errs.Conflict, "toggle tag", "this document changed in godocs since the page was loaded")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// godocs ingests an upload from the file alone, so CreateDocument sets the
+// folder, date, text and tags afterwards through the same endpoints the
+// inbox uses to edit a document. The file is streamed from disk rather than
+// read into memory, as large scans would otherwise be held whole.
+
+// CreateOptions are what CreateDocument sets on a new document. Zero values
+// leave godocs' own.
+type CreateOptions struct {
+	Name   string // defaults to the file's base name
+	Folder string
+	Date   string // YYYY-MM-DD
+	Text   string // replaces the extracted text, as for an OCR result
+	TagIDs []int
+}
+
+// CreateDocument uploads the file at path to godocs and applies opts. If
+// the upload succeeds but an option cannot be applied, the document is
+// returned along with the error, since it exists in godocs regardless.
+func (c *GodocsClient) CreateDocument(ctx context.Context, path string, opts CreateOptions) (*GodocsDocument, error) {
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := c.upload(ctx, name, f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return doc, applyCreateOptions(c, doc, opts)
+}
+
+// applyCreateOptions sets opts other than the name on a new document in s.
+func applyCreateOptions(s DocumentStore, doc *GodocsDocument, opts CreateOptions) error {
+	var failed []error
+	if opts.Text != "" {
+		if err := s.UploadDocumentText(doc.ULID, opts.Text); err != nil {
+			failed = append(failed, fmt.Errorf("setting text: %w", err))
+		}
+	}
+	if opts.Folder != "" {
+		if err := s.MoveDocument(doc.ULID, opts.Folder); err != nil {
+			failed = append(failed, fmt.Errorf("moving to %s: %w", opts.Folder, err))
+		} else {
+			doc.Folder = opts.Folder
+		}
+	}
+	if opts.Date != "" {
+		if err := s.UpdateDocumentDate(doc.ULID, opts.Date); err != nil {
+			failed = append(failed, fmt.Errorf("setting date: %w", err))
+		}
+	}
+	if len(opts.TagIDs) > 0 {
+		if _, err := s.AddTags(doc.ULID, opts.TagIDs); err != nil {
+			failed = append(failed, fmt.Errorf("tagging: %w", err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("created %s but %w", doc.ULID, errors.Join(failed...))
+	}
+	return nil
+}
+
+// upload streams r to godocs as a multipart form, stored under name.
+func (c *GodocsClient) upload(ctx context.Context, name string, r io.Reader) (*GodocsDocument, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/document/upload", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := c.transfers.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("uploading document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("upload failed (%d): %s", resp.StatusCode, string(b))
+	}
+	var doc GodocsDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding uploaded document: %w", err)
+	}
+	if doc.ULID == "" {
+		return nil, fmt.Errorf("upload of %s returned no ULID", name)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// CSRF protection uses a double-submit token: a random token is kept in the
+// csrf_token cookie, which nav.html copies into every POST form and fetch()
+// calls send as X-CSRF-Token. A cross-site page can make the browser send
+// the cookie (SameSite permitting) but cannot read it to fill in the field.
+const (
+	csrfCookieName = "csrf_token"
+	csrfField      = "csrf_token"
+	csrfHeader     = "X-CSRF-Token"
+)
+
+// csrfExempt lists paths that authenticate callers another way.
+var csrfExempt = []string{"/hooks/"}
+
+// isSecure reports whether the client reached us over HTTPS, directly or
+// through a TLS-terminating proxy, so cookies can be marked Secure.
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// csrfProtect issues the CSRF cookie and rejects state-changing requests
+// whose token is missing or does not match it.
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if c, err := r.Cookie(csrfCookieName); err == nil && len(c.Value) == 32 {
+			token = c.Value
+		} else {
+			b := make([]byte, 16)
+			rand.Read(b)
+			token = hex.EncodeToString(b)
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    token,
+				Path:     "/",
+				Secure:   isSecure(r),
+				SameSite: http.SameSiteStrictMode,
+				// Not HttpOnly: the page reads it to fill in forms
+			})
+		}
+
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS":
+		default:
+			if hasAnyPrefix(r.URL.Path, csrfExempt) {
+				break
+			}
+			got := r.Header.Get(csrfHeader)
+			if got == "" {
+				got = r.PostFormValue(csrfField)
+			}
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "invalid or missing CSRF token; reload the page and try again", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
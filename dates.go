@@ -0,0 +1,142 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/drummonds/godocs-inbox/internal/datefind"
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// defaultDateMinConfidence is the confidence the best date candidate must
+// exceed to be applied without asking, when date_min_confidence is unset.
+const defaultDateMinConfidence = 0.7
+
+func (app *App) dateMinConfidence() float64 {
+	if app.config().DateMinConfidence == 0 {
+		return defaultDateMinConfidence
+	}
+	return app.config().DateMinConfidence
+}
+
+// date_heuristics modes.
+const (
+	dateHeuristicsFallback   = "fallback"
+	dateHeuristicsCrossCheck = "cross_check"
+	dateHeuristicsOnly       = "only"
+	dateHeuristicsOff        = "off"
+)
+
+// heuristicDates finds the date candidates in text without the LLM.
+func (app *App) heuristicDates(text string) []llm.DateCandidate {
+	found := datefind.Find(text, datefind.Options{MonthFirst: app.monthFirst()})
+	cands := make([]llm.DateCandidate, len(found))
+	for i, c := range found {
+		cands[i] = llm.DateCandidate{Date: c.Date, Label: c.Label, Confidence: c.Confidence, Reason: "text heuristics: " + c.Reason}
+	}
+	return cands
+}
+
+// crossCheckDates adds the heuristic candidates to the LLM's. When both put
+// the same date first it is trusted more; when a confident heuristic date
+// disagrees, the LLM's best is held at threshold so a person picks.
+func crossCheckDates(cands, found []llm.DateCandidate, threshold float64) []llm.DateCandidate {
+	if len(cands) == 0 || len(found) == 0 {
+		return cands
+	}
+	best, other := &cands[0], found[0]
+	switch {
+	case best.Date == other.Date:
+		best.Confidence = min(max(best.Confidence, other.Confidence)+0.1, 1)
+		best.Reason += ", also found by text heuristics"
+	case other.Confidence > threshold:
+		best.Confidence = min(best.Confidence, threshold)
+		best.Reason += ", but text heuristics found " + other.Date
+	}
+	for _, f := range found {
+		if !slices.ContainsFunc(cands, func(c llm.DateCandidate) bool { return c.Date == f.Date }) {
+			cands = append(cands, f)
+		}
+	}
+	return cands
+}
+
+// DatePick is a date candidate offered in the inbox's quick-pick list.
+type DatePick struct {
+	Date       string
+	Label      string
+	Reason     string
+	Confidence int  // percent
+	Current    bool // the document's date in godocs
+}
+
+// recordDateCandidates stores the ranked dates inferred for a document. A
+// new inference replaces the old candidates.
+func (app *App) recordDateCandidates(ulid string, candidates []llm.DateCandidate) {
+	cands := make([]store.DateCandidate, len(candidates))
+	for i, c := range candidates {
+		cands[i] = store.DateCandidate{Date: c.Date, Label: c.Label, Confidence: c.Confidence, Reason: c.Reason}
+	}
+	app.processingMu.Lock()
+	app.dateCandidates[ulid] = cands
+	app.processingMu.Unlock()
+	if err := app.store.PutDateCandidates(ulid, cands); err != nil {
+		log.Printf("state: %v", err)
+	}
+}
+
+// datePicks returns the quick-pick list for a document, best first, or nil
+// if it has no candidates.
+func (app *App) datePicks(ulid, current string) []DatePick {
+	app.processingMu.Lock()
+	cands := app.dateCandidates[ulid]
+	app.processingMu.Unlock()
+	var picks []DatePick
+	for _, c := range cands {
+		picks = append(picks, DatePick{
+			Date:       c.Date,
+			Label:      c.Label,
+			Reason:     c.Reason,
+			Confidence: int(c.Confidence*100 + 0.5),
+			Current:    c.Date == current,
+		})
+	}
+	return picks
+}
+
+// handlePickDate sets a document's date from the quick-pick list, or as
+// typed in any form parseDate reads. A picked date has been chosen by a
+// person, so the document leaves the LLM date review.
+func (app *App) handlePickDate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, name, pos := r.FormValue("ulid"), r.FormValue("name"), r.FormValue("pos")
+	date, ok := app.parseDate(r.FormValue("date"))
+	if !ok || ulid == "" {
+		app.fail(w, r, sess, "/?pos="+pos, false, errs.New(errs.Validation, "pick date", "cannot read the date "+r.FormValue("date")))
+		return
+	}
+	if err := app.docs.UpdateDocumentDate(ulid, date); err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "date "+date+" on "+name, err))
+		return
+	}
+	delete(app.llmDates, ulid)
+	if err := app.store.DeleteLLMDate(ulid); err != nil {
+		log.Printf("state: %v", err)
+	}
+	sess.record("date "+date, ulid, name)
+	http.Redirect(w, r, "/?pos="+pos+"&flash="+url.QueryEscape("Date "+app.formatDate(date)+" on "+name), http.StatusSeeOther)
+}
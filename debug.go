@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// -debug (or debug: true) mounts net/http/pprof at /debug/pprof/ and a JSON
+// dump of the in-memory state at /debug/state, for tracking down memory
+// growth and stuck jobs on a long-running instance. Neither is
+// authenticated, so only enable them where the inbox is not exposed.
+
+// DebugState is the /debug/state dump.
+type DebugState struct {
+	Time       time.Time              `json:"time"`
+	Goroutines int                    `json:"goroutines"`
+	Memory     DebugMemory            `json:"memory"`
+	Jobs       map[string]DebugJob    `json:"jobs"` // ULID → running OCR/LLM job
+	Failures   map[string]*JobFailure `json:"failures"`
+	Queue      []DebugQueueItem       `json:"queue"`
+	QueueTime  time.Time              `json:"queue_time"` // when the queue was last synced
+	Caches     DebugCaches            `json:"caches"`
+	Thumbs     DebugThumbs            `json:"thumbnails"`
+}
+
+type DebugMemory struct {
+	Alloc       uint64 `json:"alloc_bytes"`
+	HeapInuse   uint64 `json:"heap_inuse_bytes"`
+	HeapObjects uint64 `json:"heap_objects"`
+	Sys         uint64 `json:"sys_bytes"`
+	NumGC       uint32 `json:"gc_runs"`
+}
+
+type DebugJob struct {
+	Stage   string    `json:"stage"`
+	DocType string    `json:"doc_type"`
+	Started time.Time `json:"started"`
+	Running string    `json:"running"`
+}
+
+type DebugQueueItem struct {
+	ULID string `json:"ulid"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// DebugCaches counts the entries of each in-memory map and on-disk cache.
+type DebugCaches struct {
+	Responses      int `json:"responses"`
+	Texts          int `json:"texts"`
+	Hashes         int `json:"hashes"`
+	Hashing        int `json:"hashing"`
+	Embeddings     int `json:"embeddings"`
+	Embedding      int `json:"embedding"`
+	OCRQuality     int `json:"ocr_quality"`
+	DateCandidates int `json:"date_candidates"`
+	DocTypes       int `json:"doc_types"`
+	Summaries      int `json:"summaries"`
+	Languages      int `json:"languages"`
+	LLMDates       int `json:"llm_dates"`
+	Snoozes        int `json:"snoozes"`
+	Sessions       int `json:"sessions"`
+}
+
+type DebugThumbs struct {
+	Pending int `json:"pending"`
+	Busy    int `json:"busy"`
+	Tried   int `json:"tried"`
+	Workers int `json:"workers"`
+}
+
+// handleDebug mounts the debug endpoints on mux.
+func (app *App) handleDebug(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/state", app.handleDebugState)
+}
+
+func (app *App) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	st := DebugState{
+		Time:       now,
+		Goroutines: runtime.NumGoroutine(),
+		Jobs:       make(map[string]DebugJob),
+		Failures:   make(map[string]*JobFailure),
+		Queue:      []DebugQueueItem{},
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	st.Memory = DebugMemory{Alloc: ms.Alloc, HeapInuse: ms.HeapInuse, HeapObjects: ms.HeapObjects, Sys: ms.Sys, NumGC: ms.NumGC}
+
+	app.processingMu.Lock()
+	for ulid, job := range app.docStage {
+		st.Jobs[ulid] = DebugJob{Stage: job.Stage, DocType: job.DocType, Started: job.Started, Running: now.Sub(job.Started).Round(time.Second).String()}
+	}
+	for ulid, f := range app.failures {
+		copied := *f
+		st.Failures[ulid] = &copied
+	}
+	st.Caches.Hashes, st.Caches.Hashing = len(app.hashes), len(app.hashing)
+	st.Caches.Embeddings, st.Caches.Embedding = len(app.embeddings), len(app.embedding)
+	st.Caches.OCRQuality, st.Caches.DateCandidates = len(app.ocrQuality), len(app.dateCandidates)
+	app.processingMu.Unlock()
+
+	app.mu.Lock()
+	for _, doc := range app.untagged {
+		st.Queue = append(st.Queue, DebugQueueItem{ULID: doc.ULID, Name: doc.Name, Type: doc.DocumentType})
+	}
+	st.QueueTime = app.untaggedTime
+	st.Caches.DocTypes, st.Caches.Summaries = len(app.docTypes), len(app.summaries)
+	st.Caches.Languages, st.Caches.LLMDates = len(app.languages), len(app.llmDates)
+	st.Caches.Sessions = len(app.users)
+	app.mu.Unlock()
+
+	app.snoozeMu.Lock()
+	st.Caches.Snoozes = len(app.snoozes)
+	app.snoozeMu.Unlock()
+
+	app.thumbs.mu.Lock()
+	st.Thumbs = DebugThumbs{Pending: len(app.thumbs.pending), Busy: len(app.thumbs.busy), Tried: len(app.thumbs.tried), Workers: app.thumbs.workers}
+	app.thumbs.mu.Unlock()
+
+	if app.client != nil {
+		st.Caches.Responses = app.client.cache.size()
+		st.Caches.Texts = app.client.texts.size()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(st)
+}
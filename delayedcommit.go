@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// With commit_delay_seconds set, a tag shortcut takes its document out of
+// the queue at once but holds the AddTag call back for that long. Undo
+// within the delay drops the queued tag without calling godocs; after it,
+// undo removes the tag as usual. Queued tags are committed early when the
+// inbox is stopped with SIGINT or SIGTERM.
+
+// pendingTag is a shortcut's tag waiting out the commit delay.
+type pendingTag struct {
+	sess     *UserSession
+	doc      GodocsDocument
+	shortcut ShortcutConfig
+	action   *LastAction // on sess's undo stack
+	timer    *time.Timer
+}
+
+func (c Config) commitDelay() time.Duration {
+	return time.Duration(c.CommitDelaySeconds) * time.Second
+}
+
+// deferTag queues shortcut's tag on doc for the commit delay and puts it
+// on sess's undo stack. A tag already queued for doc is committed first.
+// Callers must hold app.mu.
+func (app *App) deferTag(sess *UserSession, doc GodocsDocument, shortcut ShortcutConfig) {
+	if app.pending[doc.ULID] != nil {
+		app.commitTag(doc.ULID)
+	}
+	if app.pending == nil {
+		app.pending = make(map[string]*pendingTag)
+	}
+	p := &pendingTag{
+		sess:     sess,
+		doc:      doc,
+		shortcut: shortcut,
+		action:   &LastAction{DocULID: doc.ULID, DocName: doc.Name, TagID: shortcut.TagID, TagName: shortcut.Name, Pending: true},
+	}
+	p.timer = time.AfterFunc(app.config().commitDelay(), func() {
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		if app.pending[doc.ULID] == p {
+			app.commitTag(doc.ULID)
+		}
+	})
+	app.pending[doc.ULID] = p
+	sess.pushAction(p.action)
+}
+
+// cancelTag drops the queued tag for a pending undo action, reporting
+// whether it was still queued. Callers must hold app.mu.
+func (app *App) cancelTag(a *LastAction) bool {
+	p := app.pending[a.DocULID]
+	if p == nil || p.action != a {
+		return false
+	}
+	p.timer.Stop()
+	delete(app.pending, a.DocULID)
+	return true
+}
+
+// commitTag adds the queued tag for ulid and does what the /tag handler
+// does after tagging. If godocs refuses, the document comes back to the
+// queue and the user is shown why. Callers must hold app.mu.
+func (app *App) commitTag(ulid string) {
+	p := app.pending[ulid]
+	if p == nil {
+		return
+	}
+	p.timer.Stop()
+	delete(app.pending, ulid)
+	p.action.Pending = false
+	sess, doc, sc := p.sess, p.doc, p.shortcut
+
+	if err := app.docs.AddTag(doc.ULID, sc.TagID); err != nil {
+		err = errs.E(errs.Upstream, "tag "+doc.Name+" with "+sc.Name, err)
+		log.Printf("commit: %v", err)
+		sess.UndoStack = slices.DeleteFunc(sess.UndoStack, func(a *LastAction) bool { return a == p.action })
+		app.bannerSeq++
+		sess.Banner = &ErrorBanner{ID: app.bannerSeq, Kind: errs.KindOf(err).String(), Message: errs.Message(err), Guidance: errs.Guidance(err), Back: "/"}
+		return
+	}
+	app.captureTagSet(sess, doc.ULID)
+	sess.Stats.Tagged++
+	sess.record("tag "+sc.Name, doc.ULID, doc.Name)
+	app.emitTagged(doc.ULID, doc.Name, sess.Name, sc.Name)
+	app.journalTag(sess, actionTag, doc.ULID, doc.Name, TagSetEntry{ID: sc.TagID, Name: sc.Name})
+	app.syncUntagged()
+	ctx := context.Background()
+	_, deleted, err := app.runTagActions(ctx, sess, doc, sc.TagID)
+	if err != nil {
+		log.Printf("commit: tag actions on %s: %v", doc.Name, err)
+	}
+	if !deleted {
+		// a document short of required_groups comes back to the front
+		app.holdIncomplete(ctx, sess, doc)
+	}
+}
+
+// flushPending commits every queued tag at once.
+func (app *App) flushPending() {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if len(app.pending) > 0 {
+		log.Printf("commit: %d queued tags before exit", len(app.pending))
+	}
+	for ulid := range app.pending {
+		app.commitTag(ulid)
+	}
+}
+
+// flushOnSignal commits the apps' queued tags when the inbox is stopped,
+// then exits.
+func flushOnSignal(apps []*App) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		for _, app := range apps {
+			app.flushPending()
+		}
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Demo mode (-demo) serves the same UI as server mode, from a LocalStore
+// (localstore.go) seeded with sample documents. They arrive without text,
+// so the OCR stage runs on each as it is shown, its download held back by
+// demoOCRDelay so the processing indicator can be seen; the
+// date stage then finds their dates with the text heuristics alone, as
+// there need be no Ollama. Tags live in memory, so the tag editor, recent
+// tag sets and undo all work, and everything is forgotten on exit. Local
+// state is kept in the cache's demo directory, cleared at each start.
+
+// demoOCRDelay holds back each download for OCR.
+var demoOCRDelay = 3 * time.Second
+
+var demoTags = []GodocsTag{
+	{ID: 1, Name: "reference", Color: "#3498db", TagGroup: "Status"},
+	{ID: 2, Name: "action", Color: "#e74c3c", TagGroup: "Status"},
+	{ID: 3, Name: "trash", Color: "#7f8c8d", TagGroup: "Status"},
+	{ID: 4, Name: "project", Color: "#9b59b6", TagGroup: "Status"},
+	{ID: 5, Name: "someday", Color: "#f1c40f", TagGroup: "Status"},
+	{ID: 6, Name: "waiting", Color: "#e67e22", TagGroup: "Status"},
+	{ID: 7, Name: "work", Color: "#16a085", TagGroup: "Area"},
+	{ID: 8, Name: "home", Color: "#2ecc71", TagGroup: "Area"},
+	{ID: 9, Name: "money", Color: "#27ae60", TagGroup: "Area"},
+}
+
+var defaultDemoTags = []ShortcutConfig{
+	{Key: "f", TagID: 1},
+	{Key: "a", TagID: 2},
+	{Key: "b", TagID: 3},
+	{Key: "p", TagID: 4},
+	{Key: "l", TagID: 5},
+	{Key: "w", TagID: 6},
+}
+
+// demoDocs are the sample documents. Most have a clearly labelled date,
+// which is set at once; the backup note's is left to pick.
+var demoDocs = []struct {
+	ULID, Name string
+	Content    []byte
+}{
+	{ULID: "01DEMOMEETING", Name: "meeting-notes-2024-q4.txt", Content: []byte("Q4 Planning Meeting Notes\nDate: 14 October 2024\n\nAttendees: Alice, Bob, Charlie\n\nAction items:\n- Review budget proposal by Friday\n- Schedule follow-up with vendor\n")},
+	{ULID: "01DEMOAPI", Name: "api-design-v2.txt", Content: []byte("API v2 Design Notes\nDocument date: 2 September 2024\n\nBreaking changes:\n- Auth moves to Bearer tokens\n- Cursor-based pagination\n")},
+	{ULID: "01DEMOSERVER", Name: "old-server-config.txt", Content: []byte("Server: web-prod-03\nStatus: DECOMMISSIONED\nDated 15/01/2024\nCan be deleted after 15/01/2025.\n")},
+	{ULID: "01DEMOINVOICE", Name: "hosting-invoice.txt", Content: []byte("Acme Hosting Ltd\nInvoice date: 1 November 2024\nInvoice no. 4471\n\nWeb hosting, November       £24.00\nVAT                          £4.80\nTotal                       £28.80\n\nPayment due 15 November 2024\n")},
+	{ULID: "01DEMOBACKUP", Name: "todo-fix-backup-script.txt", Content: []byte("Fix backup script\n\nThe nightly run has failed since the disk swap:\n\"permission denied: /mnt/backup-v2/daily\"\nLast good backup 3 March 2024, run by hand.\n")},
+}
+
+// newDemoApp returns an App serving the sample documents.
+func newDemoApp() (*App, error) {
+	local := NewLocalStore(demoOCRDelay)
+	for _, t := range demoTags {
+		local.addTag(t)
+	}
+	ingress := time.Now().Add(-time.Hour)
+	for i, d := range demoDocs {
+		local.addDocument(GodocsDocument{
+			ULID:        d.ULID,
+			Name:        d.Name,
+			IngressTime: ingress.Add(time.Duration(i) * time.Minute).UTC().Format(time.RFC3339),
+		}, d.Content, "")
+	}
+
+	// The documents are new each run, so their state must be too
+	dir := filepath.Join(appCacheDir(), "demo")
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("clearing demo state: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating demo state directory: %w", err)
+	}
+	cfg := defaultConfig()
+	cfg.Shortcuts = append([]ShortcutConfig(nil), defaultDemoTags...)
+	cfg.DateHeuristics = dateHeuristicsOnly
+	cfg.Pipeline.Stages = make(map[string]bool)
+	for _, s := range pipelineStages {
+		cfg.Pipeline.Stages[s] = s == pipelineOCR || s == pipelineDate
+	}
+	cfg.localDir = dir
+	if err := resolveShortcuts(local, cfg.Shortcuts); err != nil {
+		return nil, err
+	}
+
+	app := newApp(cfg, local)
+	app.configFile = "demo"
+	st, err := openState(cfg.statePath(), filepath.Join(dir, "actions.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("opening state database: %w", err)
+	}
+	app.store = st
+	app.syncUntagged()
+	return app, nil
+}
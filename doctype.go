@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/llm"
+)
+
+const (
+	docTypeGroup = "doctype" // tag group holding document type tags
+	docTypeColor = "#95a5a6" // color for auto-created type tags
+	docTypeKey   = "y"       // reserved key to confirm the predicted type
+)
+
+var defaultDocTypes = []string{"invoice", "receipt", "letter", "statement", "id"}
+
+func (app *App) docTypeTaxonomy() []string {
+	if len(app.config().DocTypes) > 0 {
+		return app.config().DocTypes
+	}
+	return defaultDocTypes
+}
+
+// classifyDocument predicts the document type from its text and makes sure a
+// matching tag exists in the doctype group. The tag is only applied once the
+// user confirms the prediction.
+func classifyDocument(app *App, ulid, text string) {
+	types := app.docTypeTaxonomy()
+	c, err := withModels(app, taskClassify, ulid, func(m llm.Model) (*llm.Classification, error) {
+		vars := app.promptVars(text)
+		vars.Types = types
+		return llm.ClassifyType(m, app.config().prompts, vars)
+	})
+	if errors.Is(err, errLLMOffline) {
+		// Tried again when next shown
+		app.mu.Lock()
+		delete(app.docTypes, ulid)
+		app.mu.Unlock()
+		return
+	}
+	if err != nil {
+		app.pipelineErrorf("classify", ulid, "classification failed for %s: %v", ulid, err)
+		app.recordFailure(ulid, pipelineClassify, "", err)
+		return
+	}
+	app.clearFailure(ulid, pipelineClassify)
+	if c == nil {
+		log.Printf("classify: no type matched for %s", ulid)
+		return
+	}
+	log.Printf("classify: %s is %s (%.0f%%)", ulid, c.Type, c.Confidence*100)
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.docTypes[ulid] = c
+	if _, err := app.ensureDocTypeTag(c.Type); err != nil {
+		app.pipelineErrorf("classify", ulid, "creating %s tag failed: %v", c.Type, err)
+	}
+}
+
+// ensureDocTypeTag returns the doctype-group tag for typ, creating it on the
+// server if needed. Callers must hold app.mu.
+func (app *App) ensureDocTypeTag(typ string) (*GodocsTag, error) {
+	for _, t := range app.docs.KnownTags() {
+		if t.TagGroup == docTypeGroup && strings.EqualFold(t.Name, typ) {
+			return &t, nil
+		}
+	}
+	return app.docs.CreateTag(typ, docTypeColor, docTypeGroup)
+}
+
+// handleConfirmDocType applies the predicted document type tag.
+func (app *App) handleConfirmDocType(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid := r.FormValue("ulid")
+	docName := r.FormValue("name")
+	pos := r.FormValue("pos")
+	pred := app.docTypes[ulid]
+	if pred == nil {
+		http.Redirect(w, r, "/?pos="+pos, http.StatusSeeOther)
+		return
+	}
+
+	doc := app.queuedDoc(sess, ulid, docName)
+	tag, err := app.ensureDocTypeTag(pred.Type)
+	if err == nil {
+		err = app.docs.AddTag(ulid, tag.ID)
+	}
+	if err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "tag "+docName+" as "+pred.Type, err))
+		return
+	}
+	app.captureTagSet(sess, ulid)
+	sess.pushAction(&LastAction{DocULID: ulid, DocName: docName, TagID: tag.ID, TagName: tag.Name})
+	sess.Stats.Tagged++
+	sess.record("tag "+tag.Name, ulid, docName)
+	app.emitTagged(ulid, docName, sess.Name, tag.Name)
+	app.journalTag(sess, actionTag, ulid, docName, TagSetEntry{ID: tag.ID, Name: tag.Name})
+	app.syncUntagged()
+	done, deleted, err := app.runTagActions(r.Context(), sess, doc, tag.ID)
+	var problems []string
+	if !deleted {
+		problems = app.holdIncomplete(r.Context(), sess, doc)
+	}
+	if len(problems) > 0 {
+		pos = "1"
+	}
+	flash := docTypeKey + ":" + tag.Name + " ← " + docName + done + stillNeeds(problems)
+	if err != nil {
+		app.fail(w, r, sess, "/?pos="+pos+"&flash="+flash, false, errs.E(errs.Upstream, "tag actions on "+docName, err))
+		return
+	}
+	http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+}
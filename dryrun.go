@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In a dry run (-dry-run, or dry_run: true in the config) nothing is changed
+// in godocs: app.docs is wrapped in a dryRunStore, which reads through to
+// the real store but only logs the tag adds and removes, date updates, text
+// uploads, moves and deletes it is asked for, and keeps them to show on the
+// processing page as "would" lines, the newest also in the nav. Callers
+// carry on as if the change had been made, though godocs still has the
+// document as it was, so new auto_tag rules, tag actions and pipeline
+// stages can be tried against a real archive. Creating tags or documents
+// fails instead, as there is nothing to return. A single auto_tag rule can
+// be tried the same way with dry_run on the rule (see autotag.go).
+
+const dryRunKeep = 200 // would-do lines kept for the processing page
+
+// dryRunStore is a DocumentStore that changes nothing.
+type dryRunStore struct {
+	DocumentStore
+	mu    sync.Mutex
+	would []DryRunEntry // newest last
+}
+
+// DryRunEntry is something a dry run would have done.
+type DryRunEntry struct {
+	Time time.Time
+	What string
+}
+
+func newDryRunStore(docs DocumentStore) *dryRunStore {
+	return &dryRunStore{DocumentStore: docs}
+}
+
+// dryRun returns app's dry-run store, or nil when changes are real.
+func (app *App) dryRun() *dryRunStore {
+	s, _ := app.docs.(*dryRunStore)
+	return s
+}
+
+func (s *dryRunStore) wouldf(format string, args ...any) {
+	what := "would " + fmt.Sprintf(format, args...)
+	log.Printf("dry run: %s", what)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.would = append(s.would, DryRunEntry{Time: time.Now(), What: what})
+	if len(s.would) > dryRunKeep {
+		s.would = slices.Delete(s.would, 0, len(s.would)-dryRunKeep)
+	}
+}
+
+// Would returns what the dry run would have done, newest first.
+func (s *dryRunStore) Would() []DryRunEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := slices.Clone(s.would)
+	slices.Reverse(out)
+	return out
+}
+
+// Count is how many would-do lines are kept.
+func (s *dryRunStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.would)
+}
+
+// Latest is the newest would-do line, or "".
+func (s *dryRunStore) Latest() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.would) == 0 {
+		return ""
+	}
+	return s.would[len(s.would)-1].What
+}
+
+// tagName names a tag for a would-do line.
+func (s *dryRunStore) tagName(id int) string {
+	if t, ok := s.Tag(id); ok {
+		return t.Name
+	}
+	return "#" + strconv.Itoa(id)
+}
+
+func (s *dryRunStore) AddTag(ulid string, tagID int) error {
+	s.wouldf("tag %s with %s", ulid, s.tagName(tagID))
+	return nil
+}
+
+func (s *dryRunStore) AddTags(ulid string, tagIDs []int) ([]int, error) {
+	names := make([]string, len(tagIDs))
+	for i, id := range tagIDs {
+		names[i] = s.tagName(id)
+	}
+	s.wouldf("tag %s with %s", ulid, strings.Join(names, ", "))
+	return tagIDs, nil
+}
+
+func (s *dryRunStore) RemoveTag(ulid string, tagID int) error {
+	s.wouldf("remove %s from %s", s.tagName(tagID), ulid)
+	return nil
+}
+
+func (s *dryRunStore) UploadDocumentText(ulid, text string) error {
+	s.wouldf("upload %d bytes of text to %s", len(text), ulid)
+	return nil
+}
+
+func (s *dryRunStore) UpdateDocumentDate(ulid, date string) error {
+	s.wouldf("date %s %s", ulid, date)
+	return nil
+}
+
+func (s *dryRunStore) MoveDocument(ulid, folder string) error {
+	s.wouldf("move %s to %s", ulid, folder)
+	return nil
+}
+
+func (s *dryRunStore) DeleteDocument(ulid string) error {
+	s.wouldf("delete %s", ulid)
+	return nil
+}
+
+func (s *dryRunStore) DeleteTag(tagID int) error {
+	s.wouldf("delete tag %s", s.tagName(tagID))
+	return nil
+}
+
+func (s *dryRunStore) CreateTag(name, color, group string) (*GodocsTag, error) {
+	s.wouldf("create tag %s", name)
+	return nil, fmt.Errorf("dry run: tag %s not created", name)
+}
+
+func (s *dryRunStore) UploadDocument(name string, r io.Reader) (*GodocsDocument, error) {
+	s.wouldf("upload %s", name)
+	return nil, fmt.Errorf("dry run: %s not uploaded", name)
+}
+
+func (s *dryRunStore) CreateDocument(ctx context.Context, path string, opts CreateOptions) (*GodocsDocument, error) {
+	s.wouldf("create a document from %s", path)
+	return nil, fmt.Errorf("dry run: %s not created", path)
+}
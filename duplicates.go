@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/drummonds/go-thumbnails"
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/phash"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+const (
+	duplicateKey = "x" // reserved key to delete the current document as a duplicate
+
+	// duplicateDistance is the largest perceptual hash distance (of 64 bits)
+	// at which two first pages are treated as the same scan.
+	duplicateDistance = 6
+)
+
+// Duplicate is an earlier document the current one appears to duplicate.
+type Duplicate struct {
+	ULID     string
+	Name     string
+	Exact    bool // identical file contents; otherwise the first pages look alike
+	Distance int  // perceptual hash distance
+}
+
+// hashDocument downloads a document and returns its content hash and the
+// perceptual hash of its first page. Documents that cannot be rendered
+// (e.g. plain text) get a content hash only.
+func hashDocument(client DocumentStore, ulid, name, docType string, maxBytes int64) (store.DocHash, error) {
+	h := store.DocHash{ULID: ulid, Name: name}
+	tmpPath, err := client.DownloadDocument(ulid, "godocs-hash-*"+docType, maxBytes)
+	if err != nil {
+		return h, err
+	}
+	defer scratch.release(tmpPath)
+
+	if h.SHA256, err = fileSHA256(tmpPath); err != nil {
+		return h, err
+	}
+	if img, err := thumbnails.Generate(tmpPath, 64); err == nil {
+		h.PHash, h.HasPHash = phash.DHash(img), true
+	}
+	return h, nil
+}
+
+// fileSHA256 returns the hex SHA256 of a file's contents.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", fmt.Errorf("hashing: %w", err)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// startHashing hashes an inbox document in the background unless it has
+// been hashed already.
+func (app *App) startHashing(ulid, name, docType string) {
+	app.processingMu.Lock()
+	_, done := app.hashes[ulid]
+	busy := app.hashing[ulid]
+	if !done && !busy {
+		app.hashing[ulid] = true
+	}
+	app.processingMu.Unlock()
+	if done || busy {
+		return
+	}
+
+	go func() {
+		defer func() {
+			app.processingMu.Lock()
+			delete(app.hashing, ulid)
+			app.processingMu.Unlock()
+		}()
+		h, err := hashDocument(app.docs, ulid, name, docType, app.maxDownloadBytes())
+		if err != nil {
+			app.pipelineErrorf("duplicates", ulid, "hashing %s: %v", ulid, err)
+			return
+		}
+		app.putHash(h)
+		log.Printf("duplicates: hashed %s", ulid)
+	}()
+}
+
+func (app *App) putHash(h store.DocHash) {
+	if err := app.store.PutHash(h); err != nil {
+		log.Printf("state: %v", err)
+	}
+	app.processingMu.Lock()
+	app.hashes[h.ULID] = h
+	app.processingMu.Unlock()
+}
+
+func (app *App) deleteHash(ulid string) {
+	if err := app.store.DeleteHash(ulid); err != nil {
+		log.Printf("state: %v", err)
+	}
+	app.processingMu.Lock()
+	delete(app.hashes, ulid)
+	app.processingMu.Unlock()
+}
+
+// findDuplicate returns the hashed document that ulid most likely
+// duplicates, preferring an exact content match, or nil.
+func (app *App) findDuplicate(ulid string) *Duplicate {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	h, ok := app.hashes[ulid]
+	if !ok {
+		return nil
+	}
+	var best *Duplicate
+	for _, o := range app.hashes {
+		if o.ULID == ulid {
+			continue
+		}
+		if o.SHA256 == h.SHA256 {
+			return &Duplicate{ULID: o.ULID, Name: o.Name, Exact: true}
+		}
+		if !h.HasPHash || !o.HasPHash {
+			continue
+		}
+		if d := phash.Distance(h.PHash, o.PHash); d <= duplicateDistance && (best == nil || d < best.Distance) {
+			best = &Duplicate{ULID: o.ULID, Name: o.Name, Distance: d}
+		}
+	}
+	return best
+}
+
+// handleDeleteDuplicate deletes the current document as a duplicate of an
+// earlier one. Any tags already on it are first merged into the original.
+// Deletion cannot be undone.
+func (app *App) handleDeleteDuplicate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, name, pos := r.FormValue("ulid"), r.FormValue("name"), r.FormValue("pos")
+	dup := app.findDuplicate(ulid)
+	if dup == nil || dup.ULID != r.FormValue("original") {
+		http.Redirect(w, r, "/?pos="+pos+"&flash=No duplicate to delete", http.StatusSeeOther)
+		return
+	}
+
+	tags, err := app.docs.FetchDocTags(r.Context(), ulid)
+	if err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "delete duplicate "+name, err))
+		return
+	}
+	have := make(map[int]bool)
+	if orig, err := app.docs.FetchDocTags(r.Context(), dup.ULID); err == nil {
+		for _, t := range orig {
+			have[t.ID] = true
+		}
+	}
+	var ids []int
+	var merged []TagSetEntry
+	for _, t := range tags {
+		if have[t.ID] {
+			continue
+		}
+		ids = append(ids, t.ID)
+		merged = append(merged, TagSetEntry{ID: t.ID, Name: t.Name, Color: t.Color})
+	}
+	added, err := app.docs.AddTags(dup.ULID, ids)
+	merged = slices.DeleteFunc(merged, func(t TagSetEntry) bool { return !slices.Contains(added, t.ID) })
+	app.journalTag(sess, actionTag, dup.ULID, dup.Name, merged...)
+	if err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "merge tags of "+name+" into "+dup.Name, err))
+		return
+	}
+
+	if err := app.docs.DeleteDocument(ulid); err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "delete duplicate "+name, err))
+		return
+	}
+	app.deleteHash(ulid)
+	if err := app.store.AddAction(store.Action{User: sess.Name, Action: actionDelete, ULID: ulid, DocName: name}); err != nil {
+		log.Printf("journal: %v", err)
+	}
+	sess.release(ulid)
+	sess.record("delete duplicate", ulid, name)
+	app.syncUntagged()
+
+	flash := "Deleted " + name + " (duplicate of " + dup.Name + ")"
+	if len(merged) > 0 {
+		names := make([]string, len(merged))
+		for i, t := range merged {
+			names[i] = t.Name
+		}
+		flash += ", moved tags " + strings.Join(names, ", ")
+	}
+	http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+}
+
+// runDupesScan hashes every tagged document not yet hashed, so new inbox
+// documents can be matched against the existing archive.
+func runDupesScan(cfg Config, out io.Writer) error {
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	st, err := store.Open(cfg.statePath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	known := make(map[string]bool)
+	hashes, err := st.Hashes()
+	if err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		known[h.ULID] = true
+	}
+
+	tags, err := client.FetchTags()
+	if err != nil {
+		return err
+	}
+	maxBytes := appFor(cfg).maxDownloadBytes()
+	ctx := context.Background()
+	hashed, failed := 0, 0
+	for _, t := range tags {
+		for doc, err := range client.IterateDocuments(ctx, t.ID) {
+			if err != nil {
+				return fmt.Errorf("listing tag %s: %w", t.Name, err)
+			}
+			if known[doc.ULID] {
+				continue
+			}
+			known[doc.ULID] = true
+			h, err := hashDocument(client, doc.ULID, doc.Name, doc.DocumentType, maxBytes)
+			if err == nil {
+				err = st.PutHash(h)
+			}
+			if err != nil {
+				fmt.Fprintf(out, "  %s %s: %v\n", doc.ULID, doc.Name, err)
+				failed++
+				continue
+			}
+			hashed++
+		}
+	}
+	fmt.Fprintf(out, "Hashed %d documents (%d failed, %d already hashed)\n", hashed, failed, len(hashes))
+	return nil
+}
@@ -0,0 +1,2322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/clouddrive"
+	"github.com/drummonds/godocs-inbox/internal/godoctest"
+	"github.com/drummonds/godocs-inbox/internal/keymap"
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/logfile"
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+	"github.com/drummonds/godocs-inbox/internal/qr"
+	"github.com/drummonds/godocs-inbox/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+// testInbox is the inbox served from an httptest server against a fake
+// godocs, with a browser-like client that keeps cookies and sends the CSRF
+// token.
+type testInbox struct {
+	t      *testing.T
+	godocs *godoctest.Server
+	app    *App
+	srv    *httptest.Server
+	client *http.Client
+}
+
+// newTestInbox starts an inbox with two untagged documents, bank.pdf and
+// letter.pdf, shortcuts l (letters) and m (money), and a "bill" preset of
+// letters and money. Background processing is off so no OCR or LLM runs.
+func newTestInbox(t *testing.T) *testInbox {
+	t.Helper()
+	gd := godoctest.NewServer(t)
+	gd.AddTag(godoctest.Tag{ID: 1, Name: "letters", Color: "#e74c3c", TagGroup: "Type"})
+	gd.AddTag(godoctest.Tag{ID: 2, Name: "money", Color: "#2ecc71", TagGroup: "Type"})
+	gd.AddTag(godoctest.Tag{ID: 3, Name: "home", Color: "#3498db", TagGroup: "Area"})
+	gd.AddDoc(godoctest.Doc{ULID: "01BANK", Name: "bank.pdf", IngressTime: "2026-01-01T10:00:00Z", Text: "Statement total 12.50"})
+	gd.AddDoc(godoctest.Doc{ULID: "01LETTER", Name: "letter.pdf", IngressTime: "2026-01-02T10:00:00Z"})
+
+	cfg := defaultConfig()
+	cfg.GodocsServer = gd.URL
+	cfg.Shortcuts = []ShortcutConfig{{Key: "l", TagID: 1}, {Key: "m", TagID: 2}}
+	cfg.Presets = []PresetConfig{{Name: "bill", Key: "B", TagIDs: []int{1, 2}}}
+	cfg.Pipeline.Stages = make(map[string]bool)
+	for _, s := range pipelineStages {
+		cfg.Pipeline.Stages[s] = false
+	}
+
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.FetchTags(); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveShortcuts(client, cfg.Shortcuts); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolvePresets(client, cfg.Presets); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	client.texts = newTextCache(filepath.Join(dir, "text"))
+
+	app := newApp(cfg, client)
+	app.configFile, app.thumbDir = "test", filepath.Join(dir, "thumbs")
+	st, err := openState(filepath.Join(dir, "state.db"), filepath.Join(dir, "actions.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	app.store = st
+	app.syncUntagged()
+	return serveTestInbox(t, gd, app)
+}
+
+// serveTestInbox serves app, whose store is open, to a fresh client.
+func serveTestInbox(t *testing.T, gd *godoctest.Server, app *App) *testInbox {
+	t.Helper()
+	if err := app.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	app.initUsers()
+	handler, err := app.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	jar, _ := cookiejar.New(nil)
+	in := &testInbox{t: t, godocs: gd, app: app, srv: srv, client: &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+	in.get("/") // sets the CSRF cookie
+	return in
+}
+
+// get fetches a page and returns its body.
+func (in *testInbox) get(path string) string {
+	in.t.Helper()
+	resp, err := in.client.Get(in.srv.URL + path)
+	if err != nil {
+		in.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		in.t.Fatalf("GET %s: status %d: %s", path, resp.StatusCode, b)
+	}
+	return string(b)
+}
+
+// post submits a form as the page would and returns the flash message of
+// the redirect it answers with.
+func (in *testInbox) post(path string, form url.Values) string {
+	in.t.Helper()
+	u, _ := url.Parse(in.srv.URL)
+	for _, c := range in.client.Jar.Cookies(u) {
+		if c.Name == csrfCookieName {
+			form.Set(csrfField, c.Value)
+		}
+	}
+	resp, err := in.client.PostForm(in.srv.URL+path, form)
+	if err != nil {
+		in.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		b, _ := io.ReadAll(resp.Body)
+		in.t.Fatalf("POST %s: status %d: %s", path, resp.StatusCode, b)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		in.t.Fatal(err)
+	}
+	return loc.Query().Get("flash")
+}
+
+// postJSON sends a JSON API request as the page's scripts would and returns
+// the status and body of the response.
+func (in *testInbox) postJSON(path, body string) (int, string) {
+	in.t.Helper()
+	u, _ := url.Parse(in.srv.URL)
+	req, _ := http.NewRequest("POST", in.srv.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range in.client.Jar.Cookies(u) {
+		if c.Name == csrfCookieName {
+			req.Header.Set("X-CSRF-Token", c.Value)
+		}
+	}
+	resp, err := in.client.Do(req)
+	if err != nil {
+		in.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+// showing returns the ULID of the document on the inbox page, or "".
+func (in *testInbox) showing() string {
+	in.t.Helper()
+	page := in.get("/")
+	_, rest, ok := strings.Cut(page, `name="ulid" value="`)
+	if !ok {
+		return ""
+	}
+	ulid, _, _ := strings.Cut(rest, `"`)
+	return ulid
+}
+
+// wantTags checks the tags on a document in godocs, in any order.
+func (in *testInbox) wantTags(ulid string, want ...int) {
+	in.t.Helper()
+	got := in.godocs.DocTags(ulid)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		in.t.Errorf("tags on %s = %v, want %v", ulid, got, want)
+	}
+}
+
+func TestTagAndUndo(t *testing.T) {
+	in := newTestInbox(t)
+	if got := in.showing(); got != "01BANK" {
+		t.Fatalf("inbox shows %q, want 01BANK", got)
+	}
+
+	flash := in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if want := "l:letters ← bank.pdf"; flash != want {
+		t.Errorf("tag flash = %q, want %q", flash, want)
+	}
+	in.wantTags("01BANK", 1)
+	if got := in.showing(); got != "01LETTER" {
+		t.Errorf("after tagging inbox shows %q, want 01LETTER", got)
+	}
+
+	flash = in.post("/undo", url.Values{"pos": {"1"}})
+	if want := "undo ← bank.pdf"; flash != want {
+		t.Errorf("undo flash = %q, want %q", flash, want)
+	}
+	in.wantTags("01BANK")
+	if got := in.showing(); got != "01BANK" {
+		t.Errorf("after undo inbox shows %q, want 01BANK", got)
+	}
+
+	// Nothing left to undo
+	if flash := in.post("/undo", url.Values{"pos": {"1"}}); flash != "" {
+		t.Errorf("second undo flash = %q, want none", flash)
+	}
+}
+
+func TestShortcutLayers(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().Layers = []ShortcutLayer{{Name: "household", Key: "h", Shortcuts: []ShortcutConfig{{Key: "l", TagID: 3}}}}
+	if err := validateLayers(in.app.client, in.app.config().Layers); err != nil {
+		t.Fatal(err)
+	}
+	in.app.initUsers()
+	if page := in.get("/"); !strings.Contains(page, `data-layer="household" hidden`) || !strings.Contains(page, "<kbd>Alt+h</kbd> household") {
+		t.Error("inbox page lacks the household layer's legend")
+	}
+
+	// the same key tags differently in the layer
+	flash := in.post("/tag", url.Values{"tag": {"l"}, "layer": {"household"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if want := "l:home ← bank.pdf"; flash != want {
+		t.Errorf("tag flash = %q, want %q", flash, want)
+	}
+	in.wantTags("01BANK", 3)
+	in.post("/tag", url.Values{"tag": {"l"}, "layer": {""}, "ulid": {"01LETTER"}, "name": {"letter.pdf"}, "pos": {"1"}})
+	in.wantTags("01LETTER", 1)
+
+	in.app.config().Layers[0].Key = "hh"
+	if err := validateLayers(in.app.client, in.app.config().Layers); err == nil {
+		t.Error("a two-character layer key was accepted")
+	}
+}
+
+func TestKeymapAPI(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().Layers = []ShortcutLayer{{Name: "household", Key: "h", Shortcuts: []ShortcutConfig{{Key: "l", TagID: 3}}}}
+	if err := validateLayers(in.app.client, in.app.config().Layers); err != nil {
+		t.Fatal(err)
+	}
+	in.app.initUsers()
+
+	var km KeymapResponse
+	if err := json.Unmarshal([]byte(in.get("/api/keymap")), &km); err != nil {
+		t.Fatal(err)
+	}
+	find := func(bs []KeyBinding, keys string) KeyBinding {
+		for _, b := range bs {
+			if b.Keys == keys {
+				return b
+			}
+		}
+		t.Errorf("no binding for %q", keys)
+		return KeyBinding{}
+	}
+	if b := find(km.Bindings, "m"); b.Kind != keymap.Shortcut || b.Label != "money" || b.TagID != 2 {
+		t.Errorf("m = %+v, want the money shortcut", b)
+	}
+	if b := find(km.Bindings, "B"); b.Kind != keymap.Preset || len(b.TagIDs) != 2 {
+		t.Errorf("B = %+v, want the bill preset", b)
+	}
+	if b := find(km.Bindings, "z t"); b.Kind != keymap.Reserved {
+		t.Errorf("z t = %+v, want the snooze chord", b)
+	}
+	find(km.Bindings, "?")
+	if b := find(km.Bindings, "t"); b.Kind != keymap.Reserved || b.Label != "search tags" {
+		t.Errorf("t = %+v, want the tag search", b)
+	}
+	if len(km.Layers) != 1 || km.Layers[0].Switch != "Alt+h" || find(km.Layers[0].Bindings, "l").TagID != 3 {
+		t.Errorf("layers = %+v, want household with l tagging 3", km.Layers)
+	}
+}
+
+func TestCompressionAndETags(t *testing.T) {
+	in := newTestInbox(t)
+	in.get("/")
+	fetch := func(path string, header ...string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", in.srv.URL+path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := in.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	for _, path := range []string{"/", "/static/theme.css", "/api/keymap"} {
+		if resp := fetch(path, "Accept-Encoding", "gzip"); resp.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("GET %s: Content-Encoding = %q, want gzip", path, resp.Header.Get("Content-Encoding"))
+		}
+		if resp := fetch(path, "Accept-Encoding", "identity"); resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("GET %s without gzip: Content-Encoding = %q", path, resp.Header.Get("Content-Encoding"))
+		}
+	}
+	for accept, want := range map[string]string{
+		"gzip, deflate, br, zstd": "br",
+		"br;q=0, gzip":            "gzip",
+		"*":                       "gzip",
+		"gzip;q=0, *":             "",
+	} {
+		if resp := fetch("/", "Accept-Encoding", accept); resp.Header.Get("Content-Encoding") != want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", accept, resp.Header.Get("Content-Encoding"), want)
+		}
+	}
+	if resp := fetch("/proxy/thumbnail/01BANK", "Accept-Encoding", "gzip"); resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("thumbnail: Content-Encoding = %q, want images left alone", resp.Header.Get("Content-Encoding"))
+	}
+
+	for _, path := range []string{"/static/theme.css", "/api/keymap", "/proxy/thumbnail/01BANK"} {
+		etag := fetch(path).Header.Get("ETag")
+		if etag == "" {
+			t.Errorf("GET %s: no ETag", path)
+			continue
+		}
+		if resp := fetch(path, "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("GET %s with its ETag: status %d, want 304", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	in := newTestInbox(t)
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	wide := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	wide.Set(0, 0, red)
+	wide.Set(1, 0, blue)
+	var scan bytes.Buffer
+	png.Encode(&scan, wide)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01SCAN", Name: "scan.png", Folder: "scans", IngressTime: "2026-01-03T10:00:00Z", Date: "2026-03-01", Content: scan.Bytes()})
+	in.app.syncUntagged()
+	if err := os.MkdirAll(in.app.thumbDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeThumbnail(wide, in.app.hiresThumbPath("01SCAN"), in.app.config().Thumbnails); err != nil {
+		t.Fatal(err)
+	}
+	in.post("/api/note", url.Values{"ulid": {"01SCAN"}, "name": {"scan.png"}, "pos": {"3"}, "note": {"upside down"}})
+
+	in.post("/api/rotate", url.Values{"ulid": {"01SCAN"}, "name": {"scan.png"}, "pos": {"3"}, "degrees": {"45"}})
+	if b := in.app.users[""].Banner; b == nil || !strings.Contains(b.Message, "90, 180 or 270") {
+		t.Errorf("rotating by 45: banner = %+v", b)
+	}
+	if flash := in.post("/api/rotate", url.Values{"ulid": {"01SCAN"}, "name": {"scan.png"}, "pos": {"3"}, "degrees": {"90"}}); flash != "Rotated scan.png" {
+		t.Errorf("flash = %q, want Rotated scan.png", flash)
+	}
+
+	if _, ok := in.godocs.DocContent("01SCAN"); ok {
+		t.Error("original still in godocs")
+	}
+	tall := func(what string, b []byte) {
+		t.Helper()
+		img, _, err := image.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if img.Bounds().Dx() != 1 || img.Bounds().Dy() != 2 || color.NRGBAModel.Convert(img.At(0, 0)) != red {
+			t.Errorf("%s is %v with %v at the top, want it turned clockwise", what, img.Bounds(), img.At(0, 0))
+		}
+	}
+	content, _ := in.godocs.DocContent("01UPLOAD1")
+	tall("document", content)
+	thumb, err := os.ReadFile(in.app.hiresThumbPath("01UPLOAD1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tall("thumbnail", thumb)
+	if date, _ := in.godocs.DocDate("01UPLOAD1"); date != "2026-03-01" {
+		t.Errorf("date = %q, want the original's", date)
+	}
+	if folder, _ := in.godocs.DocFolder("01UPLOAD1"); folder != "scans" {
+		t.Errorf("folder = %q, want the original's", folder)
+	}
+	if note := in.app.note("01UPLOAD1"); note != "upside down" {
+		t.Errorf("note = %q, want it moved to the copy", note)
+	}
+	if got := in.showing(); got != "01UPLOAD1" {
+		t.Errorf("showing %s, want the rotated copy", got)
+	}
+}
+
+func TestWebPThumbnails(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().Thumbnails.Format = "webp"
+	if err := in.app.config().Thumbnails.validate(); err != nil {
+		t.Fatal(err)
+	}
+	wide := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for i := range wide.Pix {
+		wide.Pix[i] = uint8(i * 7)
+	}
+	os.MkdirAll(in.app.thumbDir, 0o755)
+	path := in.app.hiresThumbPath("01BANK")
+	if filepath.Ext(path) != ".webp" {
+		t.Errorf("thumbnail path %s", path)
+	}
+	if err := writeThumbnail(wide, path, in.app.config().Thumbnails); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.app.rotateThumb("01BANK", 90); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := in.client.Get(in.srv.URL + "/hires/thumbnail/01BANK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "image/webp" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	img, format, err := image.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "webp" || img.Bounds().Dx() != 30 || img.Bounds().Dy() != 40 {
+		t.Errorf("served a %s of %v, want the 30x40 turned thumbnail", format, img.Bounds())
+	}
+	if got, want := color.NRGBAModel.Convert(img.At(29, 0)), wide.At(0, 0); got != want {
+		t.Errorf("top right is %v, want the old top left %v", got, want)
+	}
+}
+
+func TestSplitBatch(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().Separators = SeparatorConfig{Enabled: true, ApplyTags: true}
+	sep, err := qr.Encode("GODOCS-SEP:money", qr.M, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := filepath.Join(t.TempDir(), "batch.pdf")
+	if err := os.WriteFile(batch, testPDF(nil, sep, nil, nil), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(batch)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01BATCH", Name: "batch.pdf", IngressTime: "2026-01-03T10:00:00Z", Content: content})
+
+	if !splitBatch(context.Background(), in.app, "01BATCH", batch, ".pdf") {
+		t.Fatal("batch not split")
+	}
+	if _, ok := in.godocs.DocContent("01BATCH"); ok {
+		t.Error("batch still in godocs")
+	}
+	for i, want := range []struct {
+		ulid  string
+		pages int
+		tags  []int
+	}{
+		{"01UPLOAD1", 1, nil},
+		{"01UPLOAD2", 2, []int{2}},
+	} {
+		part, ok := in.godocs.DocContent(want.ulid)
+		if !ok {
+			t.Fatalf("part %d not uploaded", i+1)
+		}
+		path := filepath.Join(t.TempDir(), "part.pdf")
+		os.WriteFile(path, part, 0o644)
+		codes, pages, err := ocr.PageCodes(context.Background(), path, separatorDPI)
+		if err != nil {
+			t.Fatalf("part %d: %v", i+1, err)
+		}
+		if pages != want.pages || len(codes) > 0 {
+			t.Errorf("part %d has %d pages and codes %v, want %d pages and no separator", i+1, pages, codes, want.pages)
+		}
+		in.wantTags(want.ulid, want.tags...)
+	}
+
+	// a PDF without separators is left alone
+	plain := filepath.Join(t.TempDir(), "plain.pdf")
+	os.WriteFile(plain, testPDF(nil, nil), 0o644)
+	if splitBatch(context.Background(), in.app, "01LETTER", plain, ".pdf") {
+		t.Error("split a PDF with no separator sheets")
+	}
+}
+
+// testPDF builds a PDF with a letter-sized page for each image, drawn 3
+// inches square near the top; a nil image makes a blank page.
+func testPDF(pages ...*image.Gray) []byte {
+	var b bytes.Buffer
+	var offsets []int
+	object := func(body string, stream []byte) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s", len(offsets), body)
+		if stream != nil {
+			fmt.Fprintf(&b, "\nstream\n%s\nendstream", stream)
+		}
+		b.WriteString("\nendobj\n")
+	}
+	b.WriteString("%PDF-1.4\n")
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 3+3*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)), nil)
+	for i, img := range pages {
+		page := 3 + 3*i
+		if img == nil {
+			object("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>", nil)
+			// unused, to keep three objects to a page
+			object("<< >>", nil)
+			object("<< >>", nil)
+			continue
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>", page+1, page+2), nil)
+		w, h := img.Bounds().Dx(), img.Bounds().Dy()
+		object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Length %d >>", w, h, len(img.Pix)), img.Pix)
+		draw := []byte("q 216 0 0 216 198 504 cm /Im0 Do Q")
+		object(fmt.Sprintf("<< /Length %d >>", len(draw)), draw)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return b.Bytes()
+}
+
+func TestS3Ingest(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddTag(godoctest.Tag{ID: 4, Name: "source:s3"})
+	in.app.client.cache.clear()
+	if _, err := in.app.client.FetchTags(); err != nil {
+		t.Fatal(err)
+	}
+	objects := map[string]string{"phone/receipt.pdf": "%PDF-1.4 receipt", "phone/": ""}
+	var gets, deletes []string
+	bucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=inbox/") {
+			http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/scans/")
+		switch {
+		case r.Method == "DELETE":
+			deletes = append(deletes, key)
+		case r.URL.Path == "/scans" && r.URL.Query().Get("prefix") == "phone/":
+			fmt.Fprint(w, `<ListBucketResult>`)
+			for k, v := range objects {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>"%x"</ETag><Size>%d</Size></Contents>`, k, len(v), len(v))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+		default:
+			gets = append(gets, key)
+			fmt.Fprint(w, objects[key])
+		}
+	}))
+	defer bucket.Close()
+	in.app.config().S3 = S3Config{Endpoint: bucket.URL, Bucket: "scans", Prefix: "phone/", PathStyle: true,
+		AccessKeyID: "inbox", SecretAccessKey: "secret", TagID: 4, Delete: true}
+	if err := in.app.config().S3.validate(in.app.client); err != nil {
+		t.Fatal(err)
+	}
+	in.app.initS3()
+
+	run := in.app.s3Sweep(t.Context())
+	if run.Error != "" || !slices.Equal(run.Uploaded, []string{"receipt.pdf"}) {
+		t.Fatalf("first sweep = %+v, want receipt.pdf uploaded", run)
+	}
+	in.app.syncUntagged()
+	if content, _ := in.godocs.DocContent("01UPLOAD1"); string(content) != objects["phone/receipt.pdf"] {
+		t.Errorf("uploaded %q", content)
+	}
+	if !slices.Equal(deletes, []string{"phone/receipt.pdf"}) {
+		t.Errorf("deleted %v, want the uploaded object", deletes)
+	}
+	in.wantTags("01UPLOAD1") // still in the inbox
+	if run := in.app.s3Sweep(t.Context()); len(run.Uploaded) != 0 || len(gets) != 1 {
+		t.Errorf("second sweep uploaded %v, want nothing new", run.Uploaded)
+	}
+
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01UPLOAD1"}, "name": {"receipt.pdf"}, "pos": {"3"}})
+	in.wantTags("01UPLOAD1", 1, 4)
+	in.post("/undo", url.Values{"pos": {"3"}})
+	in.wantTags("01UPLOAD1")
+	if in.app.sourceTags["01UPLOAD1"] != 4 {
+		t.Error("source tag not pending again after undo")
+	}
+}
+
+func TestCloudDriveIngest(t *testing.T) {
+	in := newTestInbox(t)
+	var refreshes int
+	var moved []string
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			refreshes++
+			if r.FormValue("refresh_token") != "refresh" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"access","expires_in":14400}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var arg map[string]any
+		json.NewDecoder(r.Body).Decode(&arg)
+		switch r.URL.Path {
+		case "/2/files/list_folder": // Dropbox
+			if arg["path"] != "/Scans" {
+				t.Errorf("listed %v", arg["path"])
+			}
+			fmt.Fprint(w, `{"entries":[{".tag":"folder","name":"processed","id":"id:dir"},
+				{".tag":"file","name":"gas.pdf","id":"id:gas","rev":"a1","size":9}],"has_more":false}`)
+		case "/2/files/download":
+			fmt.Fprint(w, "%PDF gas")
+		case "/2/files/move_v2":
+			moved = append(moved, fmt.Sprint(arg["from_path"], " → ", arg["to_path"]))
+		case "/drive/v3/files": // Google Drive
+			if q := r.URL.Query().Get("q"); !strings.HasPrefix(q, "'folder1' in parents") {
+				t.Errorf("q = %s", q)
+			}
+			fmt.Fprint(w, `{"files":[{"id":"g1","name":"water.pdf","size":"10","md5Checksum":"c0ffee"}]}`)
+		case "/drive/v3/files/g1":
+			if r.Method == "PATCH" {
+				moved = append(moved, "g1 → "+r.URL.Query().Get("addParents"))
+			} else {
+				fmt.Fprint(w, "%PDF water")
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer cloud.Close()
+	opts := clouddrive.Options{ClientID: "id", ClientSecret: "secret", RefreshToken: "refresh",
+		TokenURL: cloud.URL + "/token", APIURL: cloud.URL, ContentURL: cloud.URL}
+
+	dropbox := CloudDriveConfig{Provider: providerDropbox, Folder: "/Scans", ProcessedFolder: "/Scans/processed"}
+	opts.Folder, opts.Processed = dropbox.Folder, dropbox.ProcessedFolder
+	d := clouddrive.NewDropbox(opts)
+	if run := in.app.cloudDriveSweep(t.Context(), dropbox, d); run.Error != "" || !slices.Equal(run.Uploaded, []string{"gas.pdf"}) {
+		t.Fatalf("Dropbox sweep = %+v, want gas.pdf uploaded", run)
+	}
+	if content, _ := in.godocs.DocContent("01UPLOAD1"); string(content) != "%PDF gas" {
+		t.Errorf("uploaded %q", content)
+	}
+	// The fake folder still lists the file, as if the move had failed
+	if run := in.app.cloudDriveSweep(t.Context(), dropbox, d); len(run.Uploaded) != 0 {
+		t.Errorf("second sweep uploaded %v again", run.Uploaded)
+	}
+
+	drive := CloudDriveConfig{Provider: providerGoogleDrive, Folder: "folder1", ProcessedFolder: "folder2"}
+	opts.Folder, opts.Processed = drive.Folder, drive.ProcessedFolder
+	if run := in.app.cloudDriveSweep(t.Context(), drive, clouddrive.NewGoogleDrive(opts)); !slices.Equal(run.Uploaded, []string{"water.pdf"}) {
+		t.Errorf("Google Drive sweep = %+v, want water.pdf uploaded", run)
+	}
+	if content, _ := in.godocs.DocContent("01UPLOAD2"); string(content) != "%PDF water" {
+		t.Errorf("uploaded %q", content)
+	}
+
+	want := []string{"id:gas → /Scans/processed/gas.pdf", "id:gas → /Scans/processed/gas.pdf", "g1 → folder2"}
+	if !slices.Equal(moved, want) {
+		t.Errorf("moved %q, want %q", moved, want)
+	}
+	if refreshes != 2 {
+		t.Errorf("%d token refreshes, want one per drive", refreshes)
+	}
+}
+
+func TestKiosk(t *testing.T) {
+	in := newTestInbox(t)
+	in.post("/api/apply-tagset", url.Values{"preset": {"0"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+
+	// A fresh client: the kiosk needs no user or cookies
+	resp, err := http.Get(in.srv.URL + "/kiosk?refresh=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	page := string(b)
+	for _, want := range []string{
+		"<title>1 untagged", `content="5"`, // refresh clamped
+		`<div class="big">1</div>`, "documents tagged, 2 tags", "godocs reachable",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("kiosk lacks %q:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "<form") || strings.Contains(page, "<a ") {
+		t.Error("kiosk has forms or links")
+	}
+}
+
+func TestDailyGoal(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().DailyGoal = 2
+	yesterday := time.Now().AddDate(0, 0, -1).Format(time.DateOnly)
+	in.app.store.PutGoalDay(store.GoalDay{Day: yesterday, Tagged: 5, Goal: 2, Time: time.Now()})
+
+	in.post("/api/apply-tagset", url.Values{"preset": {"0"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if page := in.get("/"); !strings.Contains(page, "1 of 2 today, 1 to go &middot; goal met 1 day running") {
+		t.Errorf("no progress towards the goal:\n%s", page)
+	}
+	in.post("/api/apply-tagset", url.Values{"preset": {"0"}, "ulid": {"01LETTER"}, "name": {"letter.pdf"}, "pos": {"1"}})
+	page := in.get("/")
+	for _, want := range []string{"Inbox zero!", "2 of 2 today &#10003; &middot; goal met 2 days running"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %q:\n%s", want, page)
+		}
+	}
+	if days, _ := in.app.store.GoalDays(); len(days) != 2 || days[0].Tagged != 2 {
+		t.Errorf("goal days = %+v, want today recorded", days)
+	}
+}
+
+func TestScratchSweep(t *testing.T) {
+	saved := scratch
+	scratch = &scratchSpace{inUse: make(map[string]bool)}
+	t.Cleanup(func() { scratch, ocr.TempDir = saved, "" })
+	cache := t.TempDir()
+	dir := filepath.Join(cache, "scratch")
+	os.MkdirAll(dir, 0o755)
+	crashed := filepath.Join(dir, "godocs-ocr-1")
+	os.WriteFile(crashed, []byte("left by a crash"), 0o644)
+
+	if err := scratch.init(cache, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(crashed); !os.IsNotExist(err) {
+		t.Error("startup left a previous run's file")
+	}
+	if ocr.TempDir != dir {
+		t.Errorf("ocr.TempDir = %q, want %q", ocr.TempDir, dir)
+	}
+
+	// 600 KB each, over the 1 MB limit: the stale file and the next oldest go, the busy and new ones stay
+	big := bytes.Repeat([]byte("x"), 600<<10)
+	write := func(name string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, big, 0o644)
+		when := time.Now().Add(-age)
+		os.Chtimes(path, when, when)
+		return path
+	}
+	f, err := scratch.create("godocs-ocr-*.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(big)
+	f.Close()
+	busy := f.Name()
+	when := time.Now().Add(-24 * time.Hour)
+	os.Chtimes(busy, when, when)
+	stale := write("stale", 7*time.Hour)
+	aged := write("aged", time.Hour)
+	fresh := write("fresh", time.Minute)
+
+	if n, _ := scratch.sweep(time.Now(), false); n != 2 {
+		t.Errorf("swept %d files, want 2", n)
+	}
+	for path, want := range map[string]bool{busy: true, stale: false, aged: false, fresh: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+	scratch.release(busy)
+	if _, err := os.Stat(busy); !os.IsNotExist(err) {
+		t.Error("release left the file")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	in := newTestInbox(t)
+	v := in.app.client.FetchVersion()
+	in.app.godocsVersion = &v
+	var resp VersionResponse
+	if err := json.Unmarshal([]byte(in.get("/api/version")), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Build.GoVersion != runtime.Version() || resp.Build.Version == "" {
+		t.Errorf("build = %+v", resp.Build)
+	}
+	if g := resp.Godocs; g == nil || g.Version != "test" || g.APIVersion != godocsAPIVersion || g.Warning != "" {
+		t.Errorf("godocs = %+v, want test with the expected API version", g)
+	}
+
+	in.godocs.SetVersion("v9", godocsAPIVersion+1)
+	if v := in.app.client.FetchVersion(); !strings.Contains(v.Warning, "newer") {
+		t.Errorf("newer godocs: warning = %q", v.Warning)
+	}
+	in.godocs.SetVersion("", 0)
+	v = in.app.client.FetchVersion()
+	if !strings.Contains(v.Warning, "does not report") || v.Error != "" {
+		t.Errorf("godocs without /api/version: %+v", v)
+	}
+	in.app.godocsVersion = &v
+	if page := in.get("/about"); !strings.Contains(page, "does not report its API version") {
+		t.Error("About page does not warn about the godocs version")
+	}
+}
+
+func TestTagStaleQueue(t *testing.T) {
+	in := newTestInbox(t)
+	flash := in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01LETTER"}, "name": {"letter.pdf"}, "pos": {"1"}})
+	if !strings.HasPrefix(flash, "Queue changed") {
+		t.Errorf("flash = %q, want a queue changed message", flash)
+	}
+	in.wantTags("01LETTER")
+}
+
+func TestReplayQueued(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01NEW", Name: "new.pdf", IngressTime: "2026-01-03T10:00:00Z"})
+	in.app.syncUntagged()
+
+	// queued offline one after another, each at the position it had then
+	code, body := in.postJSON("/api/replay", `{"actions": [
+		{"action": "/tag", "fields": {"tag": "l", "ulid": "01BANK", "name": "bank.pdf", "pos": "1"}, "seen_tags": []},
+		{"action": "/tag", "fields": {"tag": "m", "ulid": "01LETTER", "name": "letter.pdf", "pos": "2"}, "seen_tags": []},
+		{"action": "/api/apply-tagset", "fields": {"preset": "0", "ulid": "01LETTER", "name": "letter.pdf", "pos": "3"}, "seen_tags": [1]},
+		{"action": "/tag", "fields": {"tag": "z", "ulid": "01NEW", "name": "new.pdf", "pos": "3"}, "seen_tags": []}
+	]}`)
+	if code != http.StatusOK {
+		t.Fatalf("replay: status %d: %s", code, body)
+	}
+	var resp struct{ Results []ReplayResult }
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, r := range resp.Results {
+		statuses = append(statuses, r.Status)
+	}
+	if want := []string{replayOK, replayOK, replayConflict, replayError}; !slices.Equal(statuses, want) {
+		t.Errorf("replay results %+v, want %v", resp.Results, want)
+	}
+	in.wantTags("01BANK", 1)
+	in.wantTags("01LETTER", 2) // tags seen as [1], but it had [2]
+	in.wantTags("01NEW")
+}
+
+func TestApplyTagSet(t *testing.T) {
+	in := newTestInbox(t)
+
+	flash := in.post("/api/apply-tagset", url.Values{"preset": {"0"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if want := "bill ← bank.pdf"; flash != want {
+		t.Errorf("preset flash = %q, want %q", flash, want)
+	}
+	in.wantTags("01BANK", 1, 2)
+
+	// The applied set is offered as a recent set for the next document
+	sess := in.app.users[""]
+	if len(sess.RecentSets) != 1 {
+		t.Fatalf("recent sets = %v, want the bill set", sess.RecentSets)
+	}
+	in.post("/api/apply-tagset", url.Values{"index": {"0"}, "ulid": {"01LETTER"}, "name": {"letter.pdf"}, "pos": {"1"}})
+	in.wantTags("01LETTER", 1, 2)
+	if got := in.showing(); got != "" {
+		t.Errorf("inbox shows %q after tagging both documents", got)
+	}
+}
+
+func TestApplyTagSetPartialFailure(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.FailTag(2)
+
+	if flash := in.post("/api/apply-tagset", url.Values{"preset": {"0"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}}); flash != "" {
+		t.Errorf("flash = %q, want none", flash)
+	}
+	in.wantTags("01BANK", 1)
+	if page := in.get("/"); !strings.Contains(page, "bill ← bank.pdf (1 of 2 tags failed)") {
+		t.Errorf("inbox page has no error banner for the failed tag")
+	}
+}
+
+func TestTagFailureBanner(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.FailTag(1)
+
+	form := url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}}
+	if flash := in.post("/tag", form); flash != "" {
+		t.Errorf("flash = %q, want none", flash)
+	}
+	in.wantTags("01BANK")
+	page := in.get("/")
+	if !strings.Contains(page, "godocs error") || !strings.Contains(page, "Retry") {
+		t.Fatalf("inbox page has no retryable error banner")
+	}
+	// The banner outlives a reload
+	if !strings.Contains(in.get("/"), "godocs error") {
+		t.Errorf("error banner gone after a reload")
+	}
+
+	in.godocs.FixTag(1)
+	id := strconv.Itoa(in.app.users[""].Banner.ID)
+	flash := in.post("/api/error-banner", url.Values{"id": {id}, "do": {"retry"}})
+	if want := "l:letters ← bank.pdf"; flash != want {
+		t.Errorf("retry flash = %q, want %q", flash, want)
+	}
+	in.wantTags("01BANK", 1)
+	if strings.Contains(in.get("/"), "godocs error") {
+		t.Errorf("error banner still shown after a successful retry")
+	}
+}
+
+func TestRequiredGroups(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().RequiredGroups = []string{"Area"}
+
+	flash := in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if want := "l:letters ← bank.pdf — still needs a tag from Area"; flash != want {
+		t.Errorf("tag flash = %q, want %q", flash, want)
+	}
+	if got := in.showing(); got != "01BANK" {
+		t.Fatalf("after tagging short of Area inbox shows %q, want 01BANK", got)
+	}
+	in.post("/done", url.Values{"ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if page := in.get("/"); !strings.Contains(page, "bank.pdf: needs a tag from Area") {
+		t.Errorf("done on an incomplete document shows no error")
+	}
+	if got := in.showing(); got != "01BANK" {
+		t.Fatalf("after done short of Area inbox shows %q, want 01BANK", got)
+	}
+
+	in.godocs.AddDocTag("01BANK", 3)
+	in.post("/done", url.Values{"ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if got := in.showing(); got != "01LETTER" {
+		t.Errorf("after done with an Area tag inbox shows %q, want 01LETTER", got)
+	}
+}
+
+func TestTagActions(t *testing.T) {
+	in := newTestInbox(t)
+	var hooked atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hooked.Add(1) }))
+	defer hook.Close()
+	in.app.config().TagActions = []TagActionConfig{
+		{TagID: 1, Delete: true},
+		{TagID: 2, Folder: "/archive"},
+		{TagID: 2, Webhook: hook.URL},
+	}
+
+	flash := in.post("/tag", url.Values{"tag": {"m"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if want := "m:money ← bank.pdf — moved to /archive, sent to " + hook.URL; flash != want {
+		t.Errorf("flash = %q, want %q", flash, want)
+	}
+	if folder, _ := in.godocs.DocFolder("01BANK"); folder != "/archive" {
+		t.Errorf("bank.pdf is in %q, want /archive", folder)
+	}
+	if hooked.Load() != 1 {
+		t.Errorf("webhook called %d times, want 1", hooked.Load())
+	}
+
+	// Deletion runs after the other actions
+	flash = in.post("/api/apply-tagset", url.Values{"preset": {"0"}, "ulid": {"01LETTER"}, "name": {"letter.pdf"}, "pos": {"1"}})
+	if !strings.HasSuffix(flash, ", deleted") {
+		t.Errorf("flash = %q, want the deletion last", flash)
+	}
+	if _, ok := in.godocs.DocFolder("01LETTER"); ok {
+		t.Errorf("letter.pdf not deleted")
+	}
+}
+
+func TestAutoTagSweep(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01NOTE", Name: "letter-note.pdf", IngressTime: "2026-01-03T10:00:00Z", Text: "Dear Sir"})
+	in.app.config().RequiredGroups = []string{"Type"}
+	in.app.config().AutoTag = AutoTagConfig{Rules: []AutoTagRule{
+		{Match: "(?i)statement", TagIDs: []int{2, 3}},
+		{Match: "letter", TagIDs: []int{3}},
+	}}
+	if err := in.app.config().AutoTag.validate(in.app.client); err != nil {
+		t.Fatal(err)
+	}
+
+	// letter.pdf has no text yet, so it waits for OCR. home alone falls
+	// short of the required Type group, so letter-note.pdf is left.
+	run := in.app.autoTagSweep(t.Context())
+	if len(run.Tagged) != 1 || run.Checked != 3 || run.Waiting != 1 {
+		t.Errorf("sweep tagged %q of %d with %d waiting, want bank.pdf of 3 with 1 waiting", run.Tagged, run.Checked, run.Waiting)
+	}
+	in.wantTags("01BANK", 2, 3)
+	in.wantTags("01LETTER")
+	in.wantTags("01NOTE")
+	if got := in.showing(); got != "01LETTER" {
+		t.Errorf("inbox shows %q, want 01LETTER", got)
+	}
+}
+
+func TestShortcutCounts(t *testing.T) {
+	in := newTestInbox(t)
+	count := func(name string) string {
+		t.Helper()
+		_, rest, ok := strings.Cut(in.get("/"), `title="documents tagged `+name+`">`)
+		if !ok {
+			t.Fatalf("no count for %s", name)
+		}
+		n, _, _ := strings.Cut(rest, "<")
+		return n
+	}
+	if l, m := count("letters"), count("money"); l != "0" || m != "0" {
+		t.Errorf("counts letters %s, money %s; want 0, 0", l, m)
+	}
+
+	// tagging from the inbox shows at once; filing elsewhere waits for the cache
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01FILED", Name: "filed.pdf", IngressTime: "2025-12-01T10:00:00Z", Tags: []int{2}})
+	if l, m := count("letters"), count("money"); l != "1" || m != "0" {
+		t.Errorf("counts letters %s, money %s after tagging; want 1, 0", l, m)
+	}
+}
+
+func TestLocaleDates(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().Locale, in.app.config().Timezone = "en-US", "America/New_York"
+	if err := in.app.config().loadLocale(); err != nil {
+		t.Fatal(err)
+	}
+	pick := func(date string) string {
+		return in.post("/api/pick-date", url.Values{"ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}, "date": {date}})
+	}
+
+	// en-US reads numeric dates month first
+	if flash := pick("03/04/2026"); flash != "Date Mar 4, 2026 on bank.pdf" {
+		t.Errorf("flash = %q", flash)
+	}
+	if date, _ := in.godocs.DocDate("01BANK"); date != "2026-03-04" {
+		t.Errorf("date = %q, want 2026-03-04", date)
+	}
+	pick("3rd April 2026")
+	if date, _ := in.godocs.DocDate("01BANK"); date != "2026-04-03" {
+		t.Errorf("date = %q, want 2026-04-03", date)
+	}
+	page := in.get("/?pos=1")
+	for _, want := range []string{`title="2026-04-03">Apr 3, 2026</span>`, `<span title="added">Jan 1, 2026 05:00</span>`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %s", want)
+		}
+	}
+
+	pick("sometime soon")
+	if !strings.Contains(in.get("/"), "cannot read the date sometime soon") {
+		t.Error("unreadable date not reported")
+	}
+
+	// date_order wins over the locale
+	in.app.config().Locale, in.app.config().DateOrder = "de", "mdy"
+	if err := in.app.config().loadLocale(); err != nil {
+		t.Fatal(err)
+	}
+	if flash := pick("03/04/2026"); flash != "Date 4. März 2026 on bank.pdf" {
+		t.Errorf("flash = %q", flash)
+	}
+	in.app.config().Locale = "en"
+	if err := in.app.config().loadLocale(); err == nil || !strings.Contains(err.Error(), "en-GB, en-US") {
+		t.Errorf("ambiguous locale: %v", err)
+	}
+}
+
+func TestTextHighlights(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01COUNCIL", Name: "council.pdf", IngressTime: "2025-12-01T10:00:00Z",
+		Text: "Council Tax bill\nDate: 3rd March 2026\nPay by 2026-04-01\nIssued 03/03/2026"})
+	in.app.syncUntagged()
+	in.app.config().AutoTag = AutoTagConfig{Rules: []AutoTagRule{{Match: "(?i)council tax", TagIDs: []int{2}}}}
+	if err := in.app.config().AutoTag.validate(in.app.client); err != nil {
+		t.Fatal(err)
+	}
+	in.app.recordDateCandidates("01COUNCIL", []llm.DateCandidate{{Date: "2026-03-03", Label: "date", Confidence: 0.6}})
+
+	page := in.get("/?pos=3")
+	for _, want := range []string{
+		`<mark class="hl-rule" title="auto_tag rule (?i)council tax → money">Council Tax</mark>`,
+		`<mark class="hl-date" title="inferred date 2026-03-03">3rd March 2026</mark>`,
+		`<mark class="hl-date" title="inferred date 2026-03-03">03/03/2026</mark>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("preview lacks %s", want)
+		}
+	}
+	if strings.Contains(page, `">2026-04-01</mark>`) {
+		t.Errorf("the due date is marked")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().AutoTag = AutoTagConfig{Rules: []AutoTagRule{{Match: "(?i)statement", TagIDs: []int{2}, DryRun: true}}}
+	if err := in.app.config().AutoTag.validate(in.app.client); err != nil {
+		t.Fatal(err)
+	}
+	run := in.app.autoTagSweep(t.Context())
+	if len(run.Tagged) != 0 || len(run.Would) != 1 || !strings.HasPrefix(run.Would[0], "bank.pdf ← money") {
+		t.Errorf("sweep tagged %q, would tag %q; want only bank.pdf ← money for the dry-run rule", run.Tagged, run.Would)
+	}
+	in.wantTags("01BANK")
+
+	in.app.docs = newDryRunStore(in.app.docs)
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	in.wantTags("01BANK")
+	page := in.get("/processing")
+	if !strings.Contains(page, "would tag 01BANK with letters") || !strings.Contains(page, `<span class="tag is-warning">dry run</span>`) {
+		t.Errorf("processing page does not show the dry run:\n%s", page)
+	}
+}
+
+func TestFolderFilter(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01SCAN", Name: "scan.pdf", Folder: "/scanner", IngressTime: "2026-01-03T10:00:00Z"})
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01MAIL", Name: "mail.pdf", Folder: "/email", IngressTime: "2026-01-04T10:00:00Z"})
+	in.app.syncUntagged()
+
+	page := in.get("/?folder=/scanner")
+	if !strings.Contains(page, "1 of 1") || !strings.Contains(page, `/email&nbsp;<span class="tag is-rounded is-light">1</span>`) {
+		t.Errorf("page does not show the /scanner queue with folder counts")
+	}
+	// The filter is kept until cleared
+	if got := in.showing(); got != "01SCAN" {
+		t.Errorf("inbox shows %q, want 01SCAN", got)
+	}
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01SCAN"}, "name": {"scan.pdf"}, "pos": {"1"}})
+	if page := in.get("/"); !strings.Contains(page, "Nothing left in /scanner") {
+		t.Errorf("empty folder not reported")
+	}
+	in.get("/?folder=")
+	if got := in.showing(); got != "01BANK" {
+		t.Errorf("inbox shows %q, want 01BANK", got)
+	}
+}
+
+func TestOpenDocument(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01OLD", Name: "old.pdf", IngressTime: "2025-06-01T10:00:00Z", Text: "Gas bill", Tags: []int{1}})
+
+	if got := in.get("/api/quick-open?q=gas"); !strings.Contains(got, `"ulid":"01OLD"`) || !strings.Contains(got, `"untagged":false`) {
+		t.Errorf("quick-open for gas = %s, want old.pdf", got)
+	}
+	if got := in.get("/api/quick-open?q=LETTER"); !strings.Contains(got, `"ulid":"01LETTER"`) {
+		t.Errorf("quick-open for LETTER = %s, want letter.pdf", got)
+	}
+
+	open := func(ulid string) string {
+		resp, err := in.client.Get(in.srv.URL + "/doc/" + ulid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Location")
+	}
+	// A queued document is shown where it is; any other is opened first
+	// until done
+	if got := open("01LETTER"); got != "/?pos=2" {
+		t.Errorf("opening letter.pdf redirects to %q, want /?pos=2", got)
+	}
+	open("01OLD")
+	if got := in.showing(); got != "01OLD" {
+		t.Fatalf("inbox shows %q, want 01OLD", got)
+	}
+	in.post("/done", url.Values{"ulid": {"01OLD"}, "name": {"old.pdf"}, "pos": {"1"}})
+	if got := in.showing(); got != "01BANK" {
+		t.Errorf("inbox shows %q after done, want 01BANK", got)
+	}
+}
+
+func TestSearchPage(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01OLD", Name: "old-gas.pdf", IngressTime: "2025-06-01T10:00:00Z", Text: "Gas bill", Tags: []int{2}})
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01NEW", Name: "new-gas.pdf", IngressTime: "2026-02-01T10:00:00Z", Text: "Gas bill", Tags: []int{2, 3}})
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01WATER", Name: "water.pdf", IngressTime: "2026-02-01T10:00:00Z", Text: "Water bill", Tags: []int{2}})
+
+	page := in.get("/search?q=gas&tag=2&from=2026-01-01")
+	if !strings.Contains(page, "new-gas.pdf") || strings.Contains(page, "old-gas.pdf") || strings.Contains(page, "water.pdf") {
+		t.Errorf("search for gas tagged money since 2026 does not list just new-gas.pdf")
+	}
+	if !strings.Contains(page, "1 found") || !strings.Contains(page, "Edit tags") {
+		t.Errorf("search results lack the count or tag editor")
+	}
+	if page := in.get("/search?tag=3"); !strings.Contains(page, "new-gas.pdf") || strings.Contains(page, "water.pdf") {
+		t.Errorf("search by tag home does not list just new-gas.pdf")
+	}
+}
+
+func TestTagSearch(t *testing.T) {
+	in := newTestInbox(t)
+	// every tag on the server is listed in the editor the search filters,
+	// not only the shortcuts
+	page := in.get("/")
+	if !strings.Contains(page, `id="tagSearchInput"`) || !strings.Contains(page, `data-action="tags"`) {
+		t.Fatalf("inbox page lacks the tag search")
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if !strings.Contains(page, `data-tag-id="`+id+`"`) {
+			t.Errorf("tag %s is not in the tag editor", id)
+		}
+	}
+
+	// with no match, Enter creates the tag and applies it
+	u, _ := url.Parse(in.srv.URL)
+	req, _ := http.NewRequest("POST", in.srv.URL+"/api/create-tag", strings.NewReader(`{"name": "insurance", "color": "#3498db", "ulid": "01BANK"}`))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range in.client.Jar.Cookies(u) {
+		if c.Name == csrfCookieName {
+			req.Header.Set("X-CSRF-Token", c.Value)
+		}
+	}
+	resp, err := in.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(b), `"applied":true`) {
+		t.Fatalf("create-tag: status %d: %s", resp.StatusCode, b)
+	}
+	in.wantTags("01BANK", 4)
+	if page := in.get("/"); !strings.Contains(page, `data-tag-id="4"`) {
+		t.Errorf("the new tag is not in the tag editor")
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().localDir = t.TempDir()
+	in.app.configFile = filepath.Join(t.TempDir(), configFileName)
+	write := func(cfg Config) {
+		t.Helper()
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(in.app.configFile, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+
+	// h files under home now; the server cannot change without a restart
+	cfg := *in.app.config()
+	cfg.Shortcuts = []ShortcutConfig{{Key: "h", TagID: 3}, {Key: "m", TagID: 2}}
+	cfg.GodocsServer = "http://elsewhere:8000"
+	write(cfg)
+	if err := in.app.reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if in.app.config().GodocsServer != in.godocs.URL {
+		t.Errorf("godocs_server reloaded to %s", in.app.config().GodocsServer)
+	}
+	if flash := in.post("/tag", url.Values{"tag": {"h"}, "ulid": {"01LETTER"}, "name": {"letter.pdf"}, "pos": {"1"}}); flash != "h:home ← letter.pdf" {
+		t.Errorf("tag flash after reload = %q", flash)
+	}
+	in.wantTags("01LETTER", 3)
+	if n := len(in.app.users[""].UndoStack); n != 2 {
+		t.Errorf("undo stack has %d actions after the reload, want 2", n)
+	}
+
+	// a shortcut for a missing tag is refused and h still works
+	cfg.Shortcuts = []ShortcutConfig{{Key: "h", TagID: 99}}
+	write(cfg)
+	if err := in.app.reloadConfig(); err == nil || !strings.Contains(err.Error(), "99") {
+		t.Errorf("reload of a config with a missing tag: %v", err)
+	}
+	if s := in.app.users[""].shortcut("", "h"); s == nil || s.TagID != 3 {
+		t.Errorf("h is %+v after a failed reload, want home", s)
+	}
+
+	// log files are opened at startup, so a new logs.dir waits for a restart
+	cfg = *in.app.config()
+	cfg.Logs.Dir = t.TempDir()
+	if restart := keepServerSettings(*in.app.config(), &cfg); !slices.Equal(restart, []string{"logs"}) || cfg.Logs.Dir != "" {
+		t.Errorf("restart for %v, logs.dir %q; want logs kept as it was", restart, cfg.Logs.Dir)
+	}
+	cfg = *in.app.config()
+	cfg.AutoTag.IntervalMinutes = 5
+	if restart := keepServerSettings(*in.app.config(), &cfg); !slices.Equal(restart, []string{"auto_tag.interval_minutes"}) || cfg.AutoTag.IntervalMinutes != 0 {
+		t.Errorf("restart for %v, interval %d; want the auto-tag interval kept as it was", restart, cfg.AutoTag.IntervalMinutes)
+	}
+}
+
+func TestLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := openLogs(LogsConfig{Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(closeLogs)
+	in := newTestInbox(t)
+	in.get("/")
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	in.app.pipelineErrorf("ocr", "01BANK", "no text")
+
+	read := func(name string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if access := read("access.log"); !strings.Contains(access, "http: GET / 200") || strings.Contains(access, "action:") {
+		t.Errorf("access.log:\n%s", access)
+	}
+	if actions := read("actions.log"); !strings.Contains(actions, "action: tag") || strings.Contains(actions, "http:") {
+		t.Errorf("actions.log:\n%s", actions)
+	}
+	if pipeline := read("pipeline.log"); !strings.Contains(pipeline, "no text") {
+		t.Errorf("pipeline.log:\n%s", pipeline)
+	}
+
+	// each line is too big to share a file; the oldest beyond two copies goes
+	path := filepath.Join(dir, "small.log")
+	f, err := logfile.Open(path, logfile.Options{MaxSize: 6, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	for name, want := range map[string]string{"small.log": "four\n", "small.log.1": "three\n", "small.log.2": "two\n"} {
+		if got := read(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("small.log.3 kept: %v", err)
+	}
+}
+
+func TestToggleTagConflict(t *testing.T) {
+	in := newTestInbox(t)
+	if status, body := in.postJSON("/api/toggle-tag", `{"ulid": "01BANK", "tag_id": 2, "active": false, "tags": []}`); status != http.StatusOK {
+		t.Fatalf("toggle-tag: status %d: %s", status, body)
+	}
+	in.wantTags("01BANK", 2)
+
+	// tagged in godocs meanwhile: a toggle from the page as it was is refused
+	in.godocs.AddDocTag("01BANK", 3)
+	status, body := in.postJSON("/api/toggle-tag", `{"ulid": "01BANK", "tag_id": 3, "active": false, "tags": [2]}`)
+	if status != http.StatusConflict || !strings.Contains(body, `"kind":"conflict"`) {
+		t.Fatalf("stale toggle-tag: status %d: %s", status, body)
+	}
+	in.wantTags("01BANK", 2, 3)
+
+	// after a reload the page shows both tags
+	if status, body := in.postJSON("/api/toggle-tag", `{"ulid": "01BANK", "tag_id": 3, "active": true, "tags": [3, 2]}`); status != http.StatusOK {
+		t.Fatalf("toggle-tag after reload: status %d: %s", status, body)
+	}
+	in.wantTags("01BANK", 2)
+}
+
+func TestInitFromServer(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddTag(godoctest.Tag{ID: 4, Name: "insurance", TagGroup: "Type"})
+	in.godocs.AddDocTag("01BANK", 2)
+	in.godocs.AddDocTag("01LETTER", 2)
+	in.godocs.AddDocTag("01LETTER", 1)
+
+	// home takes its suggestion, money is given k, and of letters and
+	// insurance, tied on none, letters is left out with "-"
+	path := filepath.Join(t.TempDir(), configFileName)
+	var out strings.Builder
+	opts := initOptions{server: in.godocs.URL, perGroup: 2, in: strings.NewReader("\nd\nk\n-\n"), out: &out}
+	if err := writeServerConfig(context.Background(), path, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "d is taken by done/next") {
+		t.Errorf("a reserved key was not refused:\n%s", out.String())
+	}
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{"tag_id: 2 # money (2 documents)", "# Type", "letters, tag_id 1 (1 document)"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config lacks %q:\n%s", want, data)
+		}
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ShortcutConfig{{Key: "h", TagID: 3}, {Key: "k", TagID: 2}}
+	if cfg.GodocsServer != in.godocs.URL || !slices.Equal(cfg.Shortcuts, want) {
+		t.Errorf("config = %s %+v, want shortcuts %+v", cfg.GodocsServer, cfg.Shortcuts, want)
+	}
+}
+
+func TestQuickSort(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().QuickSort = []QuickSortBucket{{Key: "k", TagID: 3, Name: "home"}}
+	if page := in.get("/sort"); !strings.Contains(page, "bank.pdf") || !strings.Contains(page, "<kbd>k</kbd> home") {
+		t.Fatalf("sort page lacks the queue or the bucket")
+	}
+
+	u, _ := url.Parse(in.srv.URL)
+	req, _ := http.NewRequest("POST", in.srv.URL+"/api/sort", strings.NewReader(`{"ulid": "01BANK", "key": "k"}`))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range in.client.Jar.Cookies(u) {
+		if c.Name == csrfCookieName {
+			req.Header.Set("X-CSRF-Token", c.Value)
+		}
+	}
+	resp, err := in.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(b), `"count":1`) {
+		t.Fatalf("sort: status %d: %s", resp.StatusCode, b)
+	}
+	in.wantTags("01BANK", 3)
+	if got := in.showing(); got != "01LETTER" {
+		t.Errorf("inbox shows %q after sorting bank.pdf, want 01LETTER", got)
+	}
+
+	// the detail pass
+	if page := in.get("/?bucket=3"); !strings.Contains(page, "Detail pass through <strong>home</strong>") {
+		t.Errorf("detail pass page lacks its notice")
+	}
+	if got := in.showing(); got != "01BANK" {
+		t.Fatalf("detail pass shows %q, want 01BANK", got)
+	}
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	in.post("/done", url.Values{"ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	in.wantTags("01BANK", 1)
+	if page := in.get("/"); !strings.Contains(page, "home is empty") {
+		t.Errorf("empty bucket page lacks its message")
+	}
+	in.get("/?bucket=")
+	if got := in.showing(); got != "01LETTER" {
+		t.Errorf("inbox shows %q after the detail pass, want 01LETTER", got)
+	}
+}
+
+func TestDelayedCommit(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().CommitDelaySeconds = 60
+	tag := url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}}
+
+	if flash := in.post("/tag", tag); !strings.Contains(flash, "undo within 1m0s") {
+		t.Errorf("flash = %q, want the undo window", flash)
+	}
+	in.wantTags("01BANK")
+	if got := in.showing(); got != "01LETTER" {
+		t.Errorf("inbox shows %q while the tag is queued, want 01LETTER", got)
+	}
+	if flash := in.post("/undo", url.Values{"pos": {"1"}}); flash != "undo \u2190 bank.pdf" {
+		t.Errorf("undo flash = %q", flash)
+	}
+	if got := in.showing(); got != "01BANK" {
+		t.Errorf("inbox shows %q after undo, want 01BANK", got)
+	}
+
+	in.post("/tag", tag)
+	in.app.flushPending()
+	in.wantTags("01BANK", 1)
+	in.post("/undo", url.Values{"pos": {"1"}})
+	in.wantTags("01BANK")
+}
+
+func TestActionJournalExport(t *testing.T) {
+	in := newTestInbox(t)
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+
+	csv := in.get("/export/actions.csv")
+	if !strings.Contains(csv, ",tag,01BANK,bank.pdf,1,letters") {
+		t.Errorf("CSV export lacks the tag action:\n%s", csv)
+	}
+	if csv := in.get("/export/actions.csv?from=2999-01-01"); strings.Count(csv, "\n") != 1 {
+		t.Errorf("CSV export from 2999 = %q, want the header only", csv)
+	}
+
+	// importing an export of the same journal adds nothing
+	for _, export := range []string{csv, in.get("/export/actions.json")} {
+		actions, err := readActions(strings.NewReader(export))
+		if err != nil || len(actions) != 1 {
+			t.Fatalf("readActions = %v, %v", actions, err)
+		}
+		if added, err := in.app.store.ImportActions(actions); err != nil || added != 0 {
+			t.Errorf("ImportActions = %d, %v, want 0 added", added, err)
+		}
+	}
+}
+
+func TestToolProbe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tesseract is a shell script")
+	}
+	in := newTestInbox(t)
+	dir := t.TempDir()
+	tesseract := filepath.Join(dir, "tesseract-5")
+	script := "#!/bin/sh\ncase \"$1\" in\n--list-langs) printf 'List of available languages in \"/tessdata/\" (2):\\ndeu\\neng\\n' ;;\n*) echo 'tesseract 9.9.9' ;;\nesac\n"
+	if err := os.WriteFile(tesseract, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := setToolPaths(map[string]string{"tessaract": tesseract}); err == nil {
+		t.Error("an unknown tool was accepted")
+	}
+	t.Cleanup(func() { setToolPaths(nil) })
+	missing := filepath.Join(dir, "missing")
+	if err := setToolPaths(map[string]string{"tesseract": tesseract, "pdftoppm": missing, "pdftotext": missing}); err != nil {
+		t.Fatal(err)
+	}
+
+	in.app.config().Pipeline.Stages[pipelineOCR] = true
+	in.app.tools = probeTools()
+	if !in.app.tools.found("tesseract") || !slices.Equal(in.app.tools.Languages, []string{"deu", "eng"}) {
+		t.Errorf("probe = %+v, want the fake tesseract with deu and eng", in.app.tools)
+	}
+	// PDFs need pdftotext, or pdftoppm to OCR them; images only tesseract
+	if in.app.stageEnabled(pipelineOCR, ".pdf") || !in.app.stageEnabled(pipelineOCR, ".png") || !in.app.stageEnabled(pipelineOCR, ".txt") {
+		t.Errorf("OCR stage for pdf, png, txt = %v, %v, %v; want false, true, true",
+			in.app.stageEnabled(pipelineOCR, ".pdf"), in.app.stageEnabled(pipelineOCR, ".png"), in.app.stageEnabled(pipelineOCR, ".txt"))
+	}
+	page := in.get("/about")
+	for _, want := range []string{"tesseract 9.9.9", "deu, eng", "OCR of scanned PDFs: needs pdftoppm", "pdftotext not found at " + missing} {
+		if !strings.Contains(page, want) {
+			t.Errorf("About page lacks %q", want)
+		}
+	}
+}
+
+func TestDocumentReport(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01GAS", Name: "gas.pdf", Folder: "bills", IngressTime: "2026-02-01T10:00:00Z", Date: "2025-12-20", Tags: []int{2, 3}})
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01RATES", Name: "rates.pdf", IngressTime: "2026-03-01T10:00:00Z", Tags: []int{2, 3}})
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01PAY", Name: "payslip.pdf", IngressTime: "2026-03-05T10:00:00Z", Tags: []int{2}})
+	if err := in.app.store.PutFields("01GAS", store.DocFields{Amount: "42.10", Currency: "GBP", Vendor: "Gas Co"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// both tags, so not the payslip; dated by the document date, then the
+	// day it was added
+	csv := in.get("/export/documents.csv?tag=2&tag=3")
+	want := "date,name,ulid,folder,tags,amount,currency\n" +
+		"2025-12-20,gas.pdf,01GAS,bills,money; home,42.10,GBP\n" +
+		"2026-03-01,rates.pdf,01RATES,,money; home,,\n"
+	if csv != want {
+		t.Errorf("CSV report =\n%s\nwant\n%s", csv, want)
+	}
+
+	var docs []ReportDocument
+	if err := json.Unmarshal([]byte(in.get("/export/documents.json?tag=2&from=2026-01-01&to=2026-03-31")), &docs); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].ULID != "01RATES" || docs[1].ULID != "01PAY" || !slices.Equal(docs[1].Tags, []string{"money"}) {
+		t.Errorf("JSON report for money in 2026 Q1 = %+v", docs)
+	}
+
+	var out bytes.Buffer
+	if err := runExportDocuments(*in.app.config(), []string{"-tag", "3", "-from", "2026-01-01", "-format", "json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); !strings.Contains(s, `"ulid": "01RATES"`) || strings.Contains(s, "01GAS") {
+		t.Errorf("export documents -tag 3 -from 2026-01-01 =\n%s", s)
+	}
+	if err := runExportDocuments(*in.app.config(), []string{"-to", "March"}, &out); err == nil {
+		t.Error("a bad date was accepted")
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	in := newTestInbox(t)
+	sent := make(chan string, 10)
+	ntfy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		sent <- r.Header.Get("Title") + "|" + r.Header.Get("Priority") + "|" + string(b)
+	}))
+	defer ntfy.Close()
+	in.app.config().Notifications = NotificationsConfig{BacklogThreshold: 2, FailureAttempts: 2, Ntfy: NtfyConfig{URL: ntfy.URL}}
+	next := func() string {
+		select {
+		case s := <-sent:
+			return s
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification sent")
+			return ""
+		}
+	}
+
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01SCAN", Name: "scan.pdf", IngressTime: "2026-01-03T10:00:00Z"})
+	in.app.syncUntagged()
+	if got, want := next(), "Inbox backlog||3 documents waiting to be tagged (over 2)."; got != want {
+		t.Errorf("notification = %q, want %q", got, want)
+	}
+
+	in.app.recordFailure("01SCAN", pipelineOCR, ".pdf", errors.New("tesseract crashed"))
+	in.app.recordFailure("01SCAN", pipelineOCR, ".pdf", errors.New("tesseract crashed"))
+	in.app.recordFailure("01SCAN", pipelineOCR, ".pdf", errors.New("tesseract crashed"))
+	if got := next(); !strings.HasPrefix(got, pipelineOCR+" failing|high|") || !strings.Contains(got, "failed 2 times") {
+		t.Errorf("notification = %q, want one high-priority failure", got)
+	}
+	select {
+	case s := <-sent:
+		t.Errorf("unexpected notification %q", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMQTT(t *testing.T) {
+	in := newTestInbox(t)
+	// a broker that accepts one client and passes on what it publishes
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	published := make(chan string, 20)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			first, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			n, _ := r.ReadByte()
+			size, shift := int(n&0x7F), 7
+			for n&0x80 != 0 {
+				n, _ = r.ReadByte()
+				size |= int(n&0x7F) << shift
+				shift += 7
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			switch first & 0xF0 {
+			case 0x10:
+				conn.Write([]byte{0x20, 2, 0, 0})
+			case 0x30:
+				topic := int(body[0])<<8 | int(body[1])
+				published <- string(body[2:2+topic]) + " " + string(body[2+topic:])
+			}
+		}
+	}()
+	in.app.config().MQTT = MQTTConfig{Broker: "tcp://" + ln.Addr().String()}
+	in.app.initMQTT()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go in.app.runMQTT(ctx)
+
+	seen := map[string]string{}
+	wait := func(topic string) string {
+		for {
+			if msg, ok := seen[topic]; ok {
+				delete(seen, topic)
+				return msg
+			}
+			select {
+			case p := <-published:
+				topic, msg, _ := strings.Cut(p, " ")
+				seen[topic] = msg
+			case <-time.After(5 * time.Second):
+				t.Fatalf("nothing published to %s", topic)
+			}
+		}
+	}
+	if got := wait("godocs-inbox/status"); got != "online" {
+		t.Errorf("status = %q, want online", got)
+	}
+	if got := wait("homeassistant/sensor/godocs-inbox/untagged/config"); !strings.Contains(got, `"state_topic":"godocs-inbox/state"`) {
+		t.Errorf("discovery = %s, want the state topic", got)
+	}
+	if got, want := wait("godocs-inbox/state"), `{"untagged":2,"processing":0,"failed":0,"snoozed":0}`; got != want {
+		t.Errorf("state = %s, want %s", got, want)
+	}
+
+	in.post("/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if got := wait("godocs-inbox/event"); !strings.Contains(got, `"event":"document.tagged"`) || !strings.Contains(got, "01BANK") {
+		t.Errorf("event = %s, want document.tagged for 01BANK", got)
+	}
+}
+
+func TestDateHeuristics(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().DateHeuristics = dateHeuristicsOnly
+	text := "ACME Bank\nStatement date: 14 March 2026\nPayment due: 01/04/2026\nClosing balance 12.50"
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01STMT", Name: "stmt.pdf", IngressTime: "2026-01-03T10:00:00Z", Text: text})
+
+	inferDocumentDate(in.app, "01STMT", text)
+	if date, _ := in.godocs.DocDate("01STMT"); date != "2026-03-14" {
+		t.Errorf("date = %q, want the statement date 2026-03-14", date)
+	}
+	if picks := in.app.datePicks("01STMT", ""); len(picks) != 2 || picks[1].Date != "2026-04-01" {
+		t.Errorf("picks = %+v, want the due date second", picks)
+	}
+
+	// a confident heuristic date that disagrees leaves the LLM's to pick
+	llmDates := []llm.DateCandidate{{Date: "2026-04-01", Label: "due date", Confidence: 0.9}}
+	got := crossCheckDates(llmDates, in.app.heuristicDates(text), 0.7)
+	if got[0].Confidence > 0.7 || len(got) != 2 || got[1].Date != "2026-03-14" {
+		t.Errorf("crossCheckDates = %+v", got)
+	}
+}
+
+func TestEditText(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().DateHeuristics = dateHeuristicsOnly
+	if body := in.get("/text?ulid=01BANK&pos=1"); !strings.Contains(body, "<textarea") {
+		t.Fatalf("edit page has no textarea:\n%s", body)
+	}
+
+	text := "ACME Bank\nStatement date: 14 March 2026\nClosing balance 1,250.00"
+	flash := in.post("/text", url.Values{"ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}, "text": {text}, "redate": {"on"}})
+	if !strings.Contains(flash, "Text saved on bank.pdf") {
+		t.Errorf("flash = %q", flash)
+	}
+	if got, _ := in.godocs.DocText("01BANK"); got != text {
+		t.Errorf("godocs text = %q, want the correction", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if date, _ := in.godocs.DocDate("01BANK"); date == "2026-03-14" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("date was not re-inferred from the corrected text")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	in := newTestInbox(t)
+	scan := []byte("\x89PNG\r\n\x1a\nscan")
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01SCAN", Name: "scan.png", Type: ".png", IngressTime: "2026-01-03T10:00:00Z", Text: "Invoice 1,250.00", Content: scan})
+	in.app.recordOCRLines("01SCAN", []ocr.Line{{Text: "Invoice 1,250.00", Left: 0.1, Top: 0.25, Width: 0.5, Height: 0.02}})
+
+	page := in.get("/compare?ulid=01SCAN&pos=3")
+	if !strings.Contains(page, `data-top="0.25"`) || !strings.Contains(page, `src="/compare/page/01SCAN"`) {
+		t.Errorf("compare page lacks the positioned line or the page image:\n%s", page)
+	}
+	if got := in.get("/compare/page/01SCAN"); got != string(scan) {
+		t.Errorf("page image = %q, want the scan", got)
+	}
+
+	// Corrected text no longer matches the page, so is shown unsynchronised
+	in.post("/text", url.Values{"ulid": {"01SCAN"}, "name": {"scan.png"}, "pos": {"3"}, "text": {"Invoice 1,260.00"}})
+	if page := in.get("/compare?ulid=01SCAN&pos=3"); strings.Contains(page, `class="ocr-line"`) || !strings.Contains(page, "<pre>Invoice 1,260.00</pre>") {
+		t.Errorf("compare page after a correction:\n%s", page)
+	}
+}
+
+func TestPipelineRoutes(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().Pipeline.Stages[pipelineOCR] = true
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01NOTE", Name: "note.txt", Type: ".txt", IngressTime: "2026-01-03T10:00:00Z", Content: []byte("Meter reading\n\n  12345 kWh\n")})
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01SHEET", Name: "sheet.xlsx", Type: ".xlsx", IngressTime: "2026-01-04T10:00:00Z", Content: []byte("PK")})
+	in.post("/sync", url.Values{})
+
+	// .txt is read directly
+	in.get("/?pos=3")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if text, _ := in.godocs.DocText("01NOTE"); text != "" {
+			if text != "Meter reading\n\n  12345 kWh" {
+				t.Errorf("text = %q", text)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(".txt document was not read")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// .xlsx has no route to its text, so it is tagged for manual handling
+	if page := in.get("/?pos=4"); !strings.Contains(page, "tagged <strong>needs manual handling</strong>") {
+		t.Errorf("no manual handling notice:\n%s", page)
+	}
+	for len(in.godocs.DocTags("01SHEET")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("xlsx document was not tagged")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	tag, err := in.app.ensureManualTag()
+	if err != nil || !slices.Equal(in.godocs.DocTags("01SHEET"), []int{tag.ID}) {
+		t.Errorf("tags = %v, want the manual handling tag %+v (%v)", in.godocs.DocTags("01SHEET"), tag, err)
+	}
+	if in.app.failure("01SHEET") != nil {
+		t.Error("manual handling recorded as a failure")
+	}
+
+	p := PipelineConfig{Routes: map[string]string{"PDF": routeOCR, ".xyz": "magic"}}
+	if err := p.validate(); err == nil || !strings.Contains(err.Error(), `unknown route "magic"`) {
+		t.Errorf("validate = %v, want the unknown route refused", err)
+	}
+	p.Routes = map[string]string{"PDF": routeOCR}
+	if err := p.validate(); err != nil || p.route(".pdf") != routeOCR || p.route(".eml") != routeMail || p.route(".xlsx") != routeManual {
+		t.Errorf("routes = %v (%v)", p.Routes, err)
+	}
+}
+
+func TestPromptTemplates(t *testing.T) {
+	var prompt atomic.Value
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models": []}`)
+		case "/api/generate":
+			var req struct{ Prompt string }
+			json.NewDecoder(r.Body).Decode(&req)
+			prompt.Store(req.Prompt)
+			json.NewEncoder(w).Encode(map[string]string{"response": `{"summary": "Kontoauszug"}`})
+		}
+	}))
+	t.Cleanup(ollama.Close)
+	in := newTestInbox(t)
+	in.app.config().OllamaURL = ollama.URL
+	in.app.checkLLM(context.Background())
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "summary.tmpl"), []byte("Fasse zusammen: {{.Text}}"), 0o644)
+	in.app.config().PromptDir = dir
+	in.app.config().Prompts = map[string]string{"summary": `Fasse zusammen ({{join .TagNames ", "}}): {{.Text}}`}
+	if err := in.app.config().loadPrompts(); err != nil {
+		t.Fatal(err)
+	}
+	summarizeDocument(in.app, "01BANK", "Statement total 12.50")
+	if got, want := prompt.Load(), "Fasse zusammen (home, letters, money): Statement total 12.50"; got != want {
+		t.Errorf("prompt = %q, want the inline template over the file's, %q", got, want)
+	}
+
+	for _, bad := range []map[string]string{{"sumary": "{{.Text}}"}, {"date": "{{.Txt}}"}, {"date": "{{.Text"}} {
+		c := Config{Prompts: bad}
+		if err := c.loadPrompts(); err == nil {
+			t.Errorf("prompts %v loaded", bad)
+		}
+	}
+}
+
+func TestTagProposals(t *testing.T) {
+	var answer atomic.Value
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models": []}`)
+		case "/api/generate":
+			json.NewEncoder(w).Encode(map[string]any{"response": answer.Load()})
+		}
+	}))
+	t.Cleanup(ollama.Close)
+	in := newTestInbox(t)
+	in.app.config().OllamaURL = ollama.URL
+	in.app.checkLLM(context.Background())
+
+	// money exists, so only the correspondent is proposed, once for both
+	answer.Store(`{"tags": [{"name": "Acme  Energy", "group": "area", "reason": "the sender"}, {"name": "Money", "group": "Type", "reason": "an amount"}]}`)
+	proposeTags(in.app, "01BANK", "Acme Energy statement")
+	proposeTags(in.app, "01LETTER", "Acme Energy letter")
+	page := in.get("/tags/proposals")
+	for _, want := range []string{`value="Acme Energy"`, `<option selected>Area</option>`, `value="#3498db"`, "bank.pdf", "letter.pdf", `is-info is-light">1</span>`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("proposals page lacks %s", want)
+		}
+	}
+	if _, ok := in.app.findTag("Acme Energy", ""); ok {
+		t.Errorf("the tag was created before approval")
+	}
+
+	flash := in.post("/tags/proposals", url.Values{"proposal": {"Acme Energy"}, "do": {"approve"}, "name": {"Acme Energy"}, "group": {"Area"}, "color": {"#e67e22"}})
+	if flash != "Created Acme Energy and tagged 2 documents" {
+		t.Errorf("approve flash = %q", flash)
+	}
+	in.wantTags("01BANK", 4)
+	in.wantTags("01LETTER", 4)
+
+	// a rejected tag is not proposed again
+	answer.Store(`{"tags": [{"name": "Widgets Ltd", "group": "", "reason": "the sender"}]}`)
+	proposeTags(in.app, "01BANK", "Widgets Ltd invoice")
+	if flash := in.post("/tags/proposals", url.Values{"proposal": {"widgets ltd"}, "do": {"reject"}}); flash != "Rejected Widgets Ltd" {
+		t.Errorf("reject flash = %q", flash)
+	}
+	proposeTags(in.app, "01LETTER", "Widgets Ltd letter")
+	if page := in.get("/tags/proposals"); strings.Contains(page, "Widgets") || !strings.Contains(page, "No tags proposed") {
+		t.Errorf("a rejected tag is proposed again")
+	}
+
+	// documents the tag could not be applied to stay proposed for a retry
+	answer.Store(`{"tags": [{"name": "Globex", "group": "", "reason": "the sender"}]}`)
+	proposeTags(in.app, "01BANK", "Globex invoice")
+	in.godocs.FailTag(5) // the tag Globex will be created as
+	approve := url.Values{"proposal": {"Globex"}, "do": {"approve"}, "name": {"Globex"}}
+	if flash := in.post("/tags/proposals", approve); flash != "Created Globex and tagged 0 documents (1 failed, kept for another try)" {
+		t.Errorf("approve flash = %q", flash)
+	}
+	in.godocs.FixTag(5)
+	if flash := in.post("/tags/proposals", approve); flash != "Tagged 1 documents with Globex" {
+		t.Errorf("approve again flash = %q", flash)
+	}
+	in.wantTags("01BANK", 4, 5)
+}
+
+func TestLLMUsage(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models": []}`)
+		case "/api/generate":
+			json.NewEncoder(w).Encode(map[string]any{"response": `{"summary": "A bank statement."}`, "prompt_eval_count": 120, "eval_count": 30})
+		}
+	}))
+	t.Cleanup(ollama.Close)
+	in := newTestInbox(t)
+	in.app.config().OllamaURL = ollama.URL
+	in.app.config().LLMBudget = LLMBudgetConfig{TokensPerDocument: 200}
+	in.app.checkLLM(context.Background())
+
+	summarizeDocument(in.app, "01BANK", "Statement total 12.50")
+	if n := len(in.app.errors.list()); n != 0 {
+		t.Errorf("%d errors within the budget", n)
+	}
+	summarizeDocument(in.app, "01BANK", "Statement total 12.50")
+	summarizeDocument(in.app, "01BANK", "Statement total 12.50")
+	usage, err := in.app.store.LLMUsageSince(time.Now().Format(time.DateOnly))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[0].Calls != 3 || usage[0].PromptTokens != 360 || usage[0].OutputTokens != 90 {
+		t.Errorf("usage = %+v, want 3 calls, 360+90 tokens", usage)
+	}
+	errors := in.app.errors.list()
+	if len(errors) != 1 || !strings.Contains(errors[0].Message, "over llm_budget") {
+		t.Errorf("errors = %+v, want one budget warning", errors)
+	}
+	if page := in.get("/about"); !strings.Contains(page, "LLM Usage") || !strings.Contains(page, "<td>360</td>") {
+		t.Error("about page has no LLM usage")
+	}
+}
+
+func TestLLMOffline(t *testing.T) {
+	var up atomic.Bool
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models": []}`)
+		case "/api/generate":
+			answer := `{"candidates": [{"date": "2026-02-28", "label": "statement date", "confidence": 0.95}]}`
+			json.NewEncoder(w).Encode(map[string]string{"response": answer})
+		}
+	}))
+	t.Cleanup(ollama.Close)
+	in := newTestInbox(t)
+	in.app.config().OllamaURL = ollama.URL
+	in.app.config().DateHeuristics = dateHeuristicsOff
+
+	in.app.checkLLM(context.Background())
+	if !strings.Contains(in.get("/about"), "LLM offline") {
+		t.Error("nav has no LLM offline indicator")
+	}
+	inferDocumentDate(in.app, "01BANK", "Statement 28 Feb 2026")
+	if st := in.app.ollama.status(); st.Deferred != 1 {
+		t.Errorf("deferred = %d, want 1", st.Deferred)
+	}
+	if f := in.app.failure("01BANK"); f != nil {
+		t.Errorf("offline recorded as a failure: %+v", f)
+	}
+
+	// back online: the skipped inference is run again
+	up.Store(true)
+	in.app.checkLLM(context.Background())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if date, _ := in.godocs.DocDate("01BANK"); date == "2026-02-28" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("date was not inferred when Ollama came back")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if strings.Contains(in.get("/about"), "LLM offline") {
+		t.Error("LLM offline indicator still shown")
+	}
+}
+
+func TestIterateDocuments(t *testing.T) {
+	in := newTestInbox(t)
+	for i := range 250 {
+		in.godocs.AddDoc(godoctest.Doc{ULID: fmt.Sprintf("01PAGE%03d", i), Name: "page.pdf", IngressTime: "2026-02-01T10:00:00Z", Tags: []int{3}})
+	}
+	client := in.app.client
+	client.pageInterval = 20 * time.Millisecond
+
+	start := time.Now()
+	var ulids []string
+	for doc, err := range client.IterateDocuments(context.Background(), 3) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ulids = append(ulids, doc.ULID)
+	}
+	if len(ulids) != 250 || ulids[0] != "01PAGE000" || ulids[249] != "01PAGE249" {
+		t.Errorf("got %d documents, %v ... %v", len(ulids), ulids[:1], ulids[len(ulids)-1:])
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 pages in %v, want them spaced by the page interval", elapsed)
+	}
+
+	n := 0
+	for doc, err := range client.IterateUntagged(context.Background()) {
+		if err != nil || (doc.ULID != "01BANK" && doc.ULID != "01LETTER") {
+			t.Errorf("untagged %q, %v", doc.ULID, err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("untagged = %d documents, want 2", n)
+	}
+
+	// cancelling stops the walk between pages
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n = 0
+	var last error
+	for _, err := range client.IterateDocuments(ctx, 3) {
+		if last = err; err != nil {
+			break
+		}
+		if n++; n == 100 {
+			cancel()
+		}
+	}
+	if n != 100 || !errors.Is(last, context.Canceled) {
+		t.Errorf("after cancel: %d documents, err %v", n, last)
+	}
+}
+
+func TestCreateDocument(t *testing.T) {
+	in := newTestInbox(t)
+	path := filepath.Join(t.TempDir(), "scan.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4 scan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client := in.app.client
+
+	doc, err := client.CreateDocument(context.Background(), path, CreateOptions{
+		Folder: "bills", Date: "2026-03-04", Text: "electricity bill", TagIDs: []int{2, 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.ULID != "01UPLOAD1" || doc.Name != "scan.pdf" {
+		t.Errorf("created %s as %q", doc.ULID, doc.Name)
+	}
+	if content, _ := in.godocs.DocContent(doc.ULID); string(content) != "%PDF-1.4 scan" {
+		t.Errorf("content = %q", content)
+	}
+	if folder, _ := in.godocs.DocFolder(doc.ULID); folder != "bills" {
+		t.Errorf("folder = %q", folder)
+	}
+	if date, _ := in.godocs.DocDate(doc.ULID); date != "2026-03-04" {
+		t.Errorf("date = %q", date)
+	}
+	if text, _ := in.godocs.DocText(doc.ULID); text != "electricity bill" {
+		t.Errorf("text = %q", text)
+	}
+	if tags := in.godocs.DocTags(doc.ULID); !slices.Equal(tags, []int{2, 3}) {
+		t.Errorf("tags = %v", tags)
+	}
+
+	// an option that fails still returns the created document
+	doc, err = client.CreateDocument(context.Background(), path, CreateOptions{Name: "renamed.pdf", TagIDs: []int{99}})
+	if doc == nil || doc.ULID != "01UPLOAD2" || doc.Name != "renamed.pdf" || err == nil {
+		t.Errorf("with an unknown tag: %+v, %v", doc, err)
+	}
+
+	if _, err := client.CreateDocument(context.Background(), filepath.Join(t.TempDir(), "missing.pdf"), CreateOptions{}); err == nil {
+		t.Error("created a document from a missing file")
+	}
+}
+
+func TestTagMerge(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddTag(godoctest.Tag{ID: 4, Name: "Money", TagGroup: "Type"})
+	in.godocs.AddDocTag("01BANK", 4)
+	in.godocs.AddDocTag("01LETTER", 4)
+	in.godocs.AddDocTag("01LETTER", 2)
+
+	// shortcut m uses tag 2, so it cannot be the duplicate
+	in.post("/tags/merge", url.Values{"keep": {"4"}, "dup": {"2"}})
+	if page := in.get("/tags/stats"); !strings.Contains(page, "money is used in tags (key m)") {
+		t.Errorf("merging a shortcut's tag was not refused:\n%s", page)
+	}
+
+	in.post("/tags/merge", url.Values{"keep": {"2"}, "dup": {"4"}})
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(in.get("/tags/stats"), "Merged Money into money: 2 documents moved") {
+		if time.Now().After(deadline) {
+			t.Fatal("merge did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	in.wantTags("01BANK", 2)
+	in.wantTags("01LETTER", 2)
+	if _, ok := in.app.client.Tag(4); ok {
+		t.Error("duplicate tag 4 was not deleted")
+	}
+}
+
+func TestTagRefs(t *testing.T) {
+	cfg := Config{
+		Layers: []ShortcutLayer{{Name: "finance", Key: "f", Shortcuts: []ShortcutConfig{{Key: "b", TagID: 4}}}},
+		Users: []UserConfig{{
+			Name:      "alice",
+			Shortcuts: []ShortcutConfig{{Key: "a", TagID: 5}},
+			Presets:   []PresetConfig{{Name: "rent", TagIDs: []int{6, 7}}},
+		}},
+		S3:          S3Config{Bucket: "scans", TagID: 9},
+		CloudDrives: []CloudDriveConfig{{Provider: "dropbox", Folder: "/Scans"}, {Provider: "google_drive", Folder: "scans", TagID: 10}},
+	}
+	for id, want := range map[int]string{
+		4:  "layers (finance, key b)",
+		5:  "users (alice, key a)",
+		7:  "users (alice, preset rent)",
+		9:  "s3",
+		10: "cloud_drives (drive 2)",
+	} {
+		if refs := tagRefs(cfg, id); !slices.Equal(refs, []string{want}) {
+			t.Errorf("tag %d: refs = %q, want %q", id, refs, want)
+		}
+	}
+	if refs := tagRefs(cfg, 8); len(refs) > 0 {
+		t.Errorf("unused tag 8: refs = %q", refs)
+	}
+}
+
+func TestPostWithoutCSRFToken(t *testing.T) {
+	in := newTestInbox(t)
+	resp, err := in.client.PostForm(in.srv.URL+"/tag", url.Values{"tag": {"l"}, "ulid": {"01BANK"}, "pos": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	in.wantTags("01BANK")
+}
+
+func TestDemo(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	delay := demoOCRDelay
+	demoOCRDelay = 0
+	t.Cleanup(func() { demoOCRDelay = delay })
+
+	app, err := newDemoApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.store.Close() })
+	if app.client != nil {
+		t.Fatal("demo app has a godocs client")
+	}
+	in := serveTestInbox(t, nil, app)
+
+	// Showing the first document starts its OCR, then the date stage
+	page := in.get("/")
+	if !strings.Contains(page, "meeting-notes-2024-q4.txt") || !strings.Contains(page, `id="tagEditorBox"`) {
+		t.Fatalf("demo inbox page lacks the first document or the tag editor:\n%s", page)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for app.jobStage("01DEMOMEETING") != "" || !strings.Contains(page, "2024-10-14 (LLM)") {
+		if time.Now().After(deadline) {
+			t.Fatalf("demo document not processed; page:\n%s", page)
+		}
+		time.Sleep(20 * time.Millisecond)
+		page = in.get("/")
+	}
+	text, err := app.docs.FetchDocText(context.Background(), "01DEMOMEETING")
+	if err != nil || !strings.Contains(text, "Q4 Planning") {
+		t.Errorf("demo OCR text = %q, %v", text, err)
+	}
+
+	// Tagging goes through the same handlers as with godocs, and the tagged
+	// page lists what each shortcut's tag holds
+	flash := in.post("/tag", url.Values{"tag": {"f"}, "ulid": {"01DEMOMEETING"}, "name": {"meeting-notes-2024-q4.txt"}, "pos": {"1"}})
+	if want := "f:reference ← meeting-notes-2024-q4.txt"; flash != want {
+		t.Errorf("tag flash = %q, want %q", flash, want)
+	}
+	if in.showing() == "01DEMOMEETING" {
+		t.Error("tagged demo document still in the inbox")
+	}
+	tagged := in.get("/tagged")
+	if !strings.Contains(tagged, "reference") || !strings.Contains(tagged, "meeting-notes-2024-q4.txt") {
+		t.Errorf("tagged page lacks the tagged document:\n%s", tagged)
+	}
+	if strings.Contains(in.get("/about"), "Godocs server") {
+		t.Error("about page names a godocs server in demo mode")
+	}
+}
+
+func TestStartupProblems(t *testing.T) {
+	gd := godoctest.NewServer(t)
+	gd.AddTag(godoctest.Tag{ID: 1, Name: "letters", TagGroup: "Type"})
+
+	cfg := defaultConfig()
+	cfg.GodocsServer = gd.URL
+	cfg.Shortcuts = []ShortcutConfig{{Key: "l", TagID: 1}, {Key: "m", TagID: 2}, {Key: "h", TagID: 3}}
+	cfg.Presets = []PresetConfig{{Name: "bill", Key: "B", TagIDs: []int{1, 4}}}
+	cfg.DateOrder = "ymd"
+	cfg.localDir = t.TempDir()
+	_, err := newServerApp(cfg, "", "")
+	if err == nil {
+		t.Fatal("newServerApp with missing tags succeeded")
+	}
+	report := startupError(leafErrors(err)).Error()
+	for _, want := range []string{
+		"\n  - tag_id 2 (key 'm') not found on server",
+		"\n  - tag_id 3 (key 'h') not found on server",
+		"\n  - tag_id 4 in preset 'bill' not found on server",
+		"\n  - available tags:\n      id=1  name=letters  group=Type",
+		"\n  - date_order \"ymd\" must be dmy or mdy",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("startup report lacks %q:\n%s", want, report)
+		}
+	}
+
+	// With godocs down the checks that need no server still run
+	gd.Close()
+	_, err = newServerApp(cfg, "", "")
+	if report := startupError(leafErrors(err)).Error(); !strings.Contains(report, "connecting to godocs") || !strings.Contains(report, "date_order") {
+		t.Errorf("startup report with godocs down:\n%s", report)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	in := newTestInbox(t)
+	in.app.config().ArchiveFolder = "Archive"
+	if !strings.Contains(in.get("/"), `id="archiveForm"`) {
+		t.Fatal("inbox page lacks the archive form")
+	}
+
+	flash := in.post("/api/archive", url.Values{"ulid": {"01BANK"}, "name": {"bank.pdf"}, "pos": {"1"}})
+	if want := "Archived bank.pdf to Archive"; flash != want {
+		t.Errorf("archive flash = %q, want %q", flash, want)
+	}
+	if folder, _ := in.godocs.DocFolder("01BANK"); folder != "Archive" {
+		t.Errorf("archived document in folder %q, want Archive", folder)
+	}
+	in.wantTags("01BANK")
+	if got := in.showing(); got != "01LETTER" {
+		t.Errorf("after archiving inbox shows %q, want 01LETTER", got)
+	}
+
+	in.post("/undo", url.Values{"pos": {"1"}})
+	if folder, _ := in.godocs.DocFolder("01BANK"); folder != "" {
+		t.Errorf("after undo document in folder %q, want none", folder)
+	}
+	if got := in.showing(); got != "01BANK" {
+		t.Errorf("after undo inbox shows %q, want 01BANK", got)
+	}
+}
+
+func TestAging(t *testing.T) {
+	in := newTestInbox(t)
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01OLD", Name: "old.pdf", IngressTime: "2025-01-01T10:00:00Z"})
+	in.godocs.AddDoc(godoctest.Doc{ULID: "01NEW", Name: "new.pdf", IngressTime: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)})
+	in.post("/sync", url.Values{})
+
+	page := in.get("/")
+	if !strings.Contains(page, "3 overdue</span>") {
+		t.Errorf("nav lacks the overdue count")
+	}
+	if !strings.Contains(page, "3 documents have waited over 30 days") || !strings.Contains(page, `class="tag is-danger" title="untagged for `) {
+		t.Errorf("inbox page lacks the oldest-first nudge or the overdue age")
+	}
+
+	in.get("/?oldest=1&pos=1")
+	if got := in.showing(); got != "01OLD" {
+		t.Errorf("oldest first shows %q, want 01OLD", got)
+	}
+	in.get("/?oldest=0&pos=1")
+	if got := in.showing(); got != "01BANK" {
+		t.Errorf("usual order shows %q, want 01BANK", got)
+	}
+
+	in.app.config().Aging = AgingConfig{WarnDays: 7, OverdueDays: 365}
+	in.post("/sync", url.Values{})
+	if page := in.get("/?pos=4"); !strings.Contains(page, "1 overdue</span>") || !strings.Contains(page, `class="tag is-light" title="untagged for 1h"`) {
+		t.Errorf("with overdue_days 365 the page shows the wrong count or age:\n%s", page)
+	}
+}
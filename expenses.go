@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+const (
+	defaultExpenseCurrency = "GBP"
+	defaultExpenseAccount  = "Expenses:Unknown"
+	defaultPaymentAccount  = "Assets:Unknown"
+)
+
+// ExpenseConfig selects the documents included in the expense export and
+// the accounts used for ledger/beancount output.
+type ExpenseConfig struct {
+	TagIDs         []int  `yaml:"tag_ids"`
+	Currency       string `yaml:"currency,omitempty"`        // when the document doesn't state one
+	Account        string `yaml:"account,omitempty"`         // expense account
+	PaymentAccount string `yaml:"payment_account,omitempty"` // balancing account
+}
+
+func (e ExpenseConfig) currency() string {
+	if e.Currency != "" {
+		return e.Currency
+	}
+	return defaultExpenseCurrency
+}
+
+func (e ExpenseConfig) account() string {
+	if e.Account != "" {
+		return e.Account
+	}
+	return defaultExpenseAccount
+}
+
+func (e ExpenseConfig) paymentAccount() string {
+	if e.PaymentAccount != "" {
+		return e.PaymentAccount
+	}
+	return defaultPaymentAccount
+}
+
+// Expense is one exported document.
+type Expense struct {
+	Date     string
+	Vendor   string
+	Amount   string
+	Currency string
+	DocName  string
+	ULID     string
+}
+
+// documentFields returns the bookkeeping fields for a document, extracting
+// them with the LLM and caching them in the store on first use.
+func (app *App) documentFields(ctx context.Context, ulid string) (*store.DocFields, error) {
+	if f, err := app.store.Fields(ulid); err != nil || f != nil {
+		return f, err
+	}
+	text, err := app.docs.FetchDocText(ctx, ulid)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" {
+		return nil, fmt.Errorf("document has no text")
+	}
+	ef, err := withModels(app, taskFields, ulid, func(m llm.Model) (*llm.Fields, error) {
+		return llm.ExtractFields(m, app.config().prompts, app.promptVars(text))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ef == nil {
+		return nil, fmt.Errorf("no amount found")
+	}
+	f := store.DocFields{Amount: ef.Amount, Currency: ef.Currency, Vendor: ef.Vendor, Date: ef.Date}
+	if err := app.store.PutFields(ulid, f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// collectExpenses gathers documents carrying an expense tag whose date falls
+// within [from, to], extracting fields where needed.
+func (app *App) collectExpenses(ctx context.Context, from, to string) ([]Expense, error) {
+	cfg := app.config().Expenses
+	seen := make(map[string]bool)
+	var out []Expense
+	for _, tagID := range cfg.TagIDs {
+		for doc, err := range app.docs.IterateDocuments(ctx, tagID) {
+			if err != nil {
+				return nil, err
+			}
+			if seen[doc.ULID] {
+				continue
+			}
+			seen[doc.ULID] = true
+			f, err := app.documentFields(ctx, doc.ULID)
+			if err != nil {
+				app.pipelineErrorf("fields", doc.ULID, "extracting fields for %s: %v", doc.Name, err)
+				continue
+			}
+			e := Expense{Date: f.Date, Vendor: f.Vendor, Amount: f.Amount, Currency: f.Currency, DocName: doc.Name, ULID: doc.ULID}
+			if e.Date == "" && len(doc.IngressTime) >= 10 {
+				e.Date = doc.IngressTime[:10]
+			}
+			if e.Currency == "" {
+				e.Currency = cfg.currency()
+			}
+			if e.Date < from || e.Date > to {
+				continue
+			}
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out, nil
+}
+
+// handleExportExpenses serves /export/expenses?from=YYYY-MM-DD&to=YYYY-MM-DD&format=csv|ledger|beancount.
+func (app *App) handleExportExpenses(w http.ResponseWriter, r *http.Request) {
+	if len(app.config().Expenses.TagIDs) == 0 {
+		http.Error(w, "expense export needs expenses.tag_ids in the config", 404)
+		return
+	}
+	q := r.URL.Query()
+	now := time.Now()
+	from, to := q.Get("from"), q.Get("to")
+	if from == "" {
+		from = fmt.Sprintf("%d-01-01", now.Year())
+	}
+	if to == "" {
+		to = now.Format("2006-01-02")
+	}
+	for _, d := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			http.Error(w, "dates must be YYYY-MM-DD", 400)
+			return
+		}
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	write, ext, ctype := expenseWriter(format)
+	if write == nil {
+		http.Error(w, "format must be csv, ledger or beancount", 400)
+		return
+	}
+
+	expenses, err := app.collectExpenses(r.Context(), from, to)
+	if err != nil {
+		err = errs.E(errs.Upstream, "expenses", err)
+		http.Error(w, errs.Message(err)+"\n"+errs.Guidance(err), errs.Status(err))
+		return
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="expenses-%s-%s.%s"`, from, to, ext))
+	write(w, expenses, app.config().Expenses)
+}
+
+func expenseWriter(format string) (write func(io.Writer, []Expense, ExpenseConfig), ext, contentType string) {
+	switch format {
+	case "csv":
+		return writeExpensesCSV, "csv", "text/csv; charset=utf-8"
+	case "ledger":
+		return writeExpensesLedger, "ledger", "text/plain; charset=utf-8"
+	case "beancount":
+		return writeExpensesBeancount, "beancount", "text/plain; charset=utf-8"
+	}
+	return nil, "", ""
+}
+
+func writeExpensesCSV(w io.Writer, expenses []Expense, _ ExpenseConfig) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "vendor", "amount", "currency", "document", "ulid"})
+	for _, e := range expenses {
+		cw.Write([]string{e.Date, e.Vendor, e.Amount, e.Currency, e.DocName, e.ULID})
+	}
+	cw.Flush()
+}
+
+func writeExpensesLedger(w io.Writer, expenses []Expense, cfg ExpenseConfig) {
+	for _, e := range expenses {
+		fmt.Fprintf(w, "%s %s\n", e.Date, payee(e))
+		fmt.Fprintf(w, "    ; document: %s (%s)\n", e.DocName, e.ULID)
+		fmt.Fprintf(w, "    %-36s %s %s\n", cfg.account(), e.Amount, e.Currency)
+		fmt.Fprintf(w, "    %s\n\n", cfg.paymentAccount())
+	}
+}
+
+func writeExpensesBeancount(w io.Writer, expenses []Expense, cfg ExpenseConfig) {
+	for _, e := range expenses {
+		fmt.Fprintf(w, "%s * %q \"\"\n", e.Date, payee(e))
+		fmt.Fprintf(w, "  document: %q\n", e.DocName)
+		fmt.Fprintf(w, "  ulid: %q\n", e.ULID)
+		fmt.Fprintf(w, "  %-36s %s %s\n", cfg.account(), e.Amount, e.Currency)
+		fmt.Fprintf(w, "  %s\n\n", cfg.paymentAccount())
+	}
+}
+
+func payee(e Expense) string {
+	if v := strings.TrimSpace(e.Vendor); v != "" {
+		return v
+	}
+	return e.DocName
+}
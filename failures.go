@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+const retryKey = "r" // reserved key to retry a failed background job
+
+// JobFailure records a failed background job for one document. Stage is the
+// pipeline stage that failed (pipelineOCR, pipelineDate, pipelineClassify,
+// pipelineSummary, pipelineLanguage or pipelineTagProposals).
+type JobFailure struct {
+	Stage    string
+	DocType  string // needed to re-run OCR
+	Error    string
+	Attempts int
+	Time     time.Time
+}
+
+// recordFailure notes a failed job, counting repeated attempts.
+func (app *App) recordFailure(ulid, stage, docType string, err error) {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	f := app.failures[ulid]
+	if f == nil {
+		f = &JobFailure{}
+		app.failures[ulid] = f
+	}
+	f.Stage = stage
+	if docType != "" {
+		f.DocType = docType
+	}
+	f.Error = err.Error()
+	f.Attempts++
+	f.Time = time.Now()
+	rec := store.Failure{ULID: ulid, Stage: f.Stage, DocType: f.DocType, Error: f.Error, Attempts: f.Attempts, Time: f.Time}
+	if err := app.store.PutFailure(rec); err != nil {
+		log.Printf("state: %v", err)
+	}
+	app.notifyFailure(ulid, stage, f.Attempts, err)
+}
+
+// clearFailure drops the failure record once stage has succeeded.
+func (app *App) clearFailure(ulid, stage string) {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	if f := app.failures[ulid]; f != nil && f.Stage == stage {
+		delete(app.failures, ulid)
+		if err := app.store.DeleteFailure(ulid); err != nil {
+			log.Printf("state: %v", err)
+		}
+	}
+}
+
+// failure returns a copy of the failure record for ulid, or nil.
+func (app *App) failure(ulid string) *JobFailure {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	if f := app.failures[ulid]; f != nil {
+		c := *f
+		return &c
+	}
+	return nil
+}
+
+// retryJob re-enqueues the failed job for ulid. It returns the stage being
+// retried, or "" if there is nothing to retry or the document is busy.
+func (app *App) retryJob(ulid string) string {
+	app.processingMu.Lock()
+	f := app.failures[ulid]
+	if f == nil || app.docStage[ulid] != nil {
+		app.processingMu.Unlock()
+		return ""
+	}
+	job := *f
+	stage := stageLLM
+	if job.Stage == pipelineOCR {
+		stage = stageOCR
+	}
+	ctx := app.beginJob(ulid, stage, job.DocType)
+	app.processingMu.Unlock()
+
+	log.Printf("retry: %s for %s (attempt %d)", job.Stage, ulid, job.Attempts+1)
+	if job.Stage == pipelineOCR {
+		go processDocument(ctx, app, ulid, job.DocType)
+		return job.Stage
+	}
+	go func() {
+		defer app.endJob(ulid)
+		text, err := app.docs.FetchDocText(ctx, ulid)
+		if ctx.Err() != nil {
+			err = errCancelled
+		}
+		if err != nil {
+			app.pipelineErrorf("retry", ulid, "fetching text for %s: %v", ulid, err)
+			app.recordFailure(ulid, job.Stage, "", err)
+			return
+		}
+		switch job.Stage {
+		case pipelineDate:
+			inferDocumentDate(app, ulid, text)
+		case pipelineClassify:
+			classifyDocument(app, ulid, text)
+		case pipelineSummary:
+			summarizeDocument(app, ulid, text)
+		case pipelineLanguage:
+			detectLanguage(app, ulid, text)
+		case pipelineTagProposals:
+			proposeTags(app, ulid, text)
+		}
+	}()
+	return job.Stage
+}
+
+// handleRetry re-runs a failed OCR/LLM job for the current document.
+func (app *App) handleRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	pos := r.FormValue("pos")
+	flash := "Nothing to retry"
+	if stage := app.retryJob(r.FormValue("ulid")); stage != "" {
+		flash = "Retrying " + stage + " for " + r.FormValue("name")
+	}
+	http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// Triage can be narrowed to one godocs folder, such as the scanner's or the
+// email importer's, with /?folder=/scanner. The choice is saved with the
+// user's session until cleared with /?folder=. godocs has no folder filter
+// on its untagged search, but the whole queue is fetched anyway, so it is
+// filtered here.
+
+// FolderCount is a folder with untagged documents, for the nav's filter.
+type FolderCount struct {
+	Name    string
+	Count   int
+	Current bool
+}
+
+// inFolder reports whether doc is in sess's chosen folder, if any.
+func inFolder(sess *UserSession, doc GodocsDocument) bool {
+	return sess == nil || sess.Folder == "" || doc.Folder == sess.Folder
+}
+
+// folderCounts counts the queue by folder, by name. It is nil when there is
+// only one folder to choose and none is chosen. Callers must hold app.mu.
+func (app *App) folderCounts(sess *UserSession) []FolderCount {
+	var counts []FolderCount
+	for _, doc := range app.queue() {
+		if doc.Folder == "" {
+			continue
+		}
+		i := slices.IndexFunc(counts, func(c FolderCount) bool { return c.Name == doc.Folder })
+		if i < 0 {
+			counts = append(counts, FolderCount{Name: doc.Folder, Current: doc.Folder == sess.Folder})
+			i = len(counts) - 1
+		}
+		counts[i].Count++
+	}
+	if sess.Folder != "" && !slices.ContainsFunc(counts, func(c FolderCount) bool { return c.Current }) {
+		counts = append(counts, FolderCount{Name: sess.Folder, Current: true})
+	}
+	if len(counts) < 2 && sess.Folder == "" {
+		return nil
+	}
+	slices.SortFunc(counts, func(a, b FolderCount) int { return strings.Compare(a.Name, b.Name) })
+	return counts
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// With daily_goal set, the inbox page has a progress bar of the documents
+// tagged today against the goal, and a streak of the days in a row it was
+// met. Tagging is counted from the action journal, as on the kiosk. Each
+// day the goal is met is recorded in the state database the first time it
+// is seen met, so the streak survives restarts and later changes of goal.
+
+// GoalProgress is today's progress towards the daily goal.
+type GoalProgress struct {
+	Goal   int
+	Tagged int  // documents tagged today
+	Streak int  // days in a row the goal was met, to today or yesterday
+	Met    bool // today
+}
+
+// Percent is the progress bar's fill, at most 100.
+func (g *GoalProgress) Percent() int {
+	return min(g.Tagged*100/g.Goal, 100)
+}
+
+// Left is how many more documents meet the goal.
+func (g *GoalProgress) Left() int {
+	return max(g.Goal-g.Tagged, 0)
+}
+
+// goalProgress reports today's progress, or nil without a daily goal, and
+// records today as met once it is. Callers must hold app.mu.
+func (app *App) goalProgress(now time.Time) *GoalProgress {
+	goal := app.config().DailyGoal
+	if goal <= 0 {
+		return nil
+	}
+	y, m, d := now.Date()
+	tagged, err := app.taggedSince(time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+	if err != nil {
+		log.Printf("state: %v", err)
+		return nil
+	}
+	g := &GoalProgress{Goal: goal, Tagged: tagged, Met: tagged >= goal}
+	today := now.Format(time.DateOnly)
+	if g.Met && app.goalMetDay != today {
+		if err := app.store.PutGoalDay(store.GoalDay{Day: today, Tagged: tagged, Goal: goal, Time: now}); err != nil {
+			log.Printf("state: %v", err)
+		} else {
+			app.goalMetDay = today
+			log.Printf("goal: %d documents tagged today, daily goal of %d met", tagged, goal)
+		}
+	}
+	g.Streak = app.goalStreak(now)
+	return g
+}
+
+// taggedSince counts the documents tagged since t.
+func (app *App) taggedSince(t time.Time) (int, error) {
+	actions, err := app.store.Actions(t)
+	if err != nil {
+		return 0, err
+	}
+	docs := make(map[string]bool)
+	for _, a := range actions {
+		if a.Action == actionTag {
+			docs[a.ULID+a.DocName] = true // the file-based demo journalled no ULIDs
+		}
+	}
+	return len(docs), nil
+}
+
+// goalStreak counts the days in a row the goal was met, ending today, or
+// yesterday while today's is still to meet.
+func (app *App) goalStreak(now time.Time) int {
+	days, err := app.store.GoalDays()
+	if err != nil {
+		log.Printf("state: %v", err)
+		return 0
+	}
+	day := now
+	if len(days) > 0 && days[0].Day != now.Format(time.DateOnly) {
+		day = now.AddDate(0, 0, -1)
+	}
+	streak := 0
+	for _, g := range days {
+		if g.Day != day.Format(time.DateOnly) {
+			break
+		}
+		streak++
+		day = day.AddDate(0, 0, -1)
+	}
+	return streak
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Godocs client defaults, used when the config leaves a field at zero.
+const (
+	defaultGodocsTimeout    = 10 * time.Second
+	defaultTransferTimeout  = 5 * time.Minute
+	defaultIdleConnsPerHost = 4
+	defaultIdleConnTimeout  = 90 * time.Second
+)
+
+// GodocsHTTPConfig tunes the connections to godocs. Metadata calls (tags,
+// status, text, tagging) and document transfers (downloads for OCR and
+// thumbnails, uploads) have their own timeouts and their own transports, so
+// a large download neither hits the metadata timeout nor holds a connection
+// that the inbox page is waiting for:
+//
+//	godocs_http:
+//	  timeout_seconds: 10           # each metadata call
+//	  transfer_timeout_seconds: 300 # each whole download or upload; -1 for none
+//	  max_idle_conns_per_host: 4    # kept-alive connections, per transport
+//	  max_conns_per_host: 0         # per transport; 0 for no limit
+//	  idle_conn_timeout_seconds: 90
+//	  disable_keep_alives: false
+//	  page_interval_ms: 100         # between pages of a full listing
+type GodocsHTTPConfig struct {
+	TimeoutSeconds         int  `yaml:"timeout_seconds,omitempty"`
+	TransferTimeoutSeconds int  `yaml:"transfer_timeout_seconds,omitempty"`
+	MaxIdleConnsPerHost    int  `yaml:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost        int  `yaml:"max_conns_per_host,omitempty"`
+	IdleConnTimeoutSeconds int  `yaml:"idle_conn_timeout_seconds,omitempty"`
+	DisableKeepAlives      bool `yaml:"disable_keep_alives,omitempty"`
+	PageIntervalMS         int  `yaml:"page_interval_ms,omitempty"`
+}
+
+func (c GodocsHTTPConfig) validate() error {
+	if c.TimeoutSeconds < 0 || c.TransferTimeoutSeconds < -1 || c.MaxIdleConnsPerHost < 0 ||
+		c.MaxConnsPerHost < 0 || c.IdleConnTimeoutSeconds < 0 || c.PageIntervalMS < 0 {
+		return fmt.Errorf("godocs_http: values must be positive (transfer_timeout_seconds may be -1 for none)")
+	}
+	return nil
+}
+
+func (c GodocsHTTPConfig) timeout() time.Duration {
+	if c.TimeoutSeconds == 0 {
+		return defaultGodocsTimeout
+	}
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+// pageInterval is the least time between the page requests of a full
+// listing.
+func (c GodocsHTTPConfig) pageInterval() time.Duration {
+	if c.PageIntervalMS == 0 {
+		return defaultPageInterval
+	}
+	return time.Duration(c.PageIntervalMS) * time.Millisecond
+}
+
+// transferTimeout is the limit on a whole download or upload; 0 means none.
+func (c GodocsHTTPConfig) transferTimeout() time.Duration {
+	switch {
+	case c.TransferTimeoutSeconds < 0:
+		return 0
+	case c.TransferTimeoutSeconds == 0:
+		return defaultTransferTimeout
+	}
+	return time.Duration(c.TransferTimeoutSeconds) * time.Second
+}
+
+// transport returns a new transport with the configured pool and TLS
+// settings. A transfer transport gives up on a server that has not started
+// its response within the metadata timeout, as its overall timeout is long.
+func (c GodocsHTTPConfig) transport(tc *tls.Config, transfers bool) *http.Transport {
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSClientConfig:       tc,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(c.IdleConnTimeoutSeconds) * time.Second,
+		DisableKeepAlives:     c.DisableKeepAlives,
+	}
+	if t.MaxIdleConnsPerHost == 0 {
+		t.MaxIdleConnsPerHost = defaultIdleConnsPerHost
+	}
+	if t.IdleConnTimeout == 0 {
+		t.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if transfers {
+		t.ResponseHeaderTimeout = c.timeout()
+	}
+	return t
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/datefind"
+)
+
+// The inbox's text preview marks why the pipeline suggested what it did:
+// the inferred date, wherever it is written in the text, and the text each
+// auto_tag rule matched, so they can be checked at a glance. The preview
+// scrolls to the first mark. Marks are found in the preview as shown, so a
+// date or term past its end is not marked.
+
+// TextSpan is a run of the text preview, marked when Mark is set.
+type TextSpan struct {
+	Text  string
+	Mark  string // "date", "rule" or ""
+	Title string // why it is marked
+}
+
+// highlight is a marked range of the preview.
+type highlight struct {
+	start, end  int
+	mark, title string
+}
+
+// highlightText splits text into spans, marking the occurrences of the
+// inferred dates and of the auto_tag rules' matches. It returns nil when
+// there is nothing to mark.
+func (app *App) highlightText(text string, dates []string) []TextSpan {
+	var marks []highlight
+	opts := datefind.Options{MonthFirst: app.monthFirst()}
+	for _, date := range dates {
+		for _, s := range datefind.Spans(text, date, opts) {
+			marks = append(marks, highlight{s[0], s[1], "date", "inferred date " + date})
+		}
+	}
+	for _, r := range app.config().AutoTag.Rules {
+		if r.re == nil {
+			continue
+		}
+		title := fmt.Sprintf("auto_tag rule %s → %s", r.Match, app.tagNames(r.TagIDs))
+		if r.DryRun {
+			title += " (dry run)"
+		}
+		for _, loc := range r.re.FindAllStringIndex(text, -1) {
+			if loc[1] > loc[0] {
+				marks = append(marks, highlight{loc[0], loc[1], "rule", title})
+			}
+		}
+	}
+	if len(marks) == 0 {
+		return nil
+	}
+
+	// earliest first; of overlapping marks the first is kept
+	slices.SortStableFunc(marks, func(a, b highlight) int { return a.start - b.start })
+	var spans []TextSpan
+	at := 0
+	for _, m := range marks {
+		if m.start < at {
+			continue
+		}
+		if m.start > at {
+			spans = append(spans, TextSpan{Text: text[at:m.start]})
+		}
+		spans = append(spans, TextSpan{Text: text[m.start:m.end], Mark: m.mark, Title: m.title})
+		at = m.end
+	}
+	if at < len(text) {
+		spans = append(spans, TextSpan{Text: text[at:]})
+	}
+	return spans
+}
+
+// tagNames lists the names of tag IDs, for titles.
+func (app *App) tagNames(ids []int) string {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = fmt.Sprint(id)
+		if t, ok := app.docs.Tag(id); ok {
+			names[i] = t.Name
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// inferredDates are the dates to mark in a document's preview: the best
+// candidate, and the document's date if the pipeline set it.
+func inferredDates(item *InboxItem) []string {
+	var dates []string
+	if len(item.DatePicks) > 0 {
+		dates = append(dates, item.DatePicks[0].Date)
+	}
+	if item.DateIsLLM && item.DocumentDate != "" && !slices.Contains(dates, item.DocumentDate) {
+		dates = append(dates, item.DocumentDate)
+	}
+	return dates
+}
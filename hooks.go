@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// handleGodocsHook lets godocs announce newly ingested documents. The
+// document is added to the queue and OCR, classification and thumbnail
+// generation start immediately, so it is ready before it is first viewed.
+// Requests must carry "Authorization: Bearer <godocs_hook_token>"; the
+// endpoint is disabled when no token is configured.
+func (app *App) handleGodocsHook(w http.ResponseWriter, r *http.Request) {
+	if app.client == nil || app.config().GodocsHookToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "not allowed", 405)
+		return
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(app.config().GodocsHookToken)) != 1 {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	var req struct {
+		Event string `json:"event"`
+		ULID  string `json:"ulid"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ULID == "" {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "expected JSON with ulid"})
+		return
+	}
+
+	app.client.invalidateDoc(req.ULID)
+	status, err := app.docs.FetchDocStatus(r.Context(), req.ULID)
+	if err != nil {
+		writeError(w, errs.E(errs.Upstream, "hook: status for "+req.ULID, err))
+		return
+	}
+	var text string
+	if status.HasText {
+		text, _ = app.docs.FetchDocText(r.Context(), req.ULID)
+	}
+
+	app.mu.Lock()
+	app.syncUntagged()
+	ocr := app.startProcessing(req.ULID, status, text)
+	app.mu.Unlock()
+
+	log.Printf("hook: %s %s (ocr=%v)", req.Event, req.ULID, ocr)
+	w.WriteHeader(202)
+	json.NewEncoder(w).Encode(map[string]any{"accepted": true, "ocr": ocr})
+}
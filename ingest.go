@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// Ingestion sources (see s3.go) poll storage elsewhere and upload new files
+// to godocs. Each upload is recorded in the state database, so a file is
+// uploaded again only if it changes. A source may name a tag to mark where
+// its documents came from; it is added once the document has been triaged,
+// since godocs' untagged list is the inbox and a document tagged on arrival
+// would never be seen there.
+
+// IngestRun is the outcome of one poll of a source, shown on the
+// processing page.
+type IngestRun struct {
+	Source   string // e.g. "S3 scans/phone/"
+	Time     time.Time
+	Uploaded []string // file names
+	Skipped  int      // too large, or no content to download
+	Failed   int
+	Error    string // the poll itself failed
+}
+
+// ingestFile uploads a file from a source and records it. tagID, if set,
+// is added once the document leaves the inbox.
+func (app *App) ingestFile(source, key, version, name string, r io.Reader, tagID int) (string, error) {
+	doc, err := app.docs.UploadDocument(name, r)
+	if err != nil {
+		return "", err
+	}
+	rec := store.Ingested{Source: source, Key: key, Version: version, ULID: doc.ULID, TagID: tagID, Time: time.Now()}
+	if err := app.store.PutIngested(rec); err != nil {
+		log.Printf("state: %v", err)
+	}
+	if tagID != 0 {
+		app.mu.Lock()
+		app.sourceTags[doc.ULID] = tagID
+		app.mu.Unlock()
+	}
+	return doc.ULID, nil
+}
+
+// pollSource runs sweep at every interval until ctx is done, keeping the
+// outcome for the processing page.
+func (app *App) pollSource(ctx context.Context, every time.Duration, sweep func(context.Context) IngestRun) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		run := sweep(ctx)
+		app.mu.Lock()
+		if len(run.Uploaded) > 0 {
+			app.syncUntagged()
+		}
+		app.ingestLast[run.Source] = &run
+		app.mu.Unlock()
+		log.Printf("ingest: %s: uploaded %d files (%d skipped, %d failed)", run.Source, len(run.Uploaded), run.Skipped, run.Failed)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ingestRuns lists the last poll of each source. Callers must hold app.mu.
+func (app *App) ingestRuns() []*IngestRun {
+	var runs []*IngestRun
+	for _, run := range app.ingestLast {
+		runs = append(runs, run)
+	}
+	slices.SortFunc(runs, func(a, b *IngestRun) int { return a.Time.Compare(b.Time) })
+	return runs
+}
+
+// tagTriagedSources adds the source tag to ingested documents that have
+// left the untagged queue. A document that cannot be tagged, say because
+// it was deleted, is tried again after a restart. Callers must hold app.mu.
+func (app *App) tagTriagedSources() {
+	if len(app.sourceTags) == 0 {
+		return
+	}
+	inbox := make(map[string]bool, len(app.untagged))
+	for _, d := range app.untagged {
+		inbox[d.ULID] = true
+	}
+	for ulid, tagID := range app.sourceTags {
+		if inbox[ulid] {
+			continue
+		}
+		delete(app.sourceTags, ulid)
+		if err := app.docs.AddTag(ulid, tagID); err != nil {
+			log.Printf("ingest: source tag on %s: %v", ulid, err)
+			continue
+		}
+		if err := app.store.SetIngestTagged(ulid, true); err != nil {
+			log.Printf("state: %v", err)
+		}
+	}
+}
+
+// untagSource takes the source tag off an ingested document whose other
+// tags have all been undone, so that it comes back to the inbox. Callers
+// must hold app.mu.
+func (app *App) untagSource(ulid string) {
+	rec, err := app.store.IngestedDoc(ulid)
+	if err != nil || rec == nil || rec.TagID == 0 || !rec.Tagged {
+		return
+	}
+	tags, err := app.docs.FetchDocTags(context.Background(), ulid)
+	if err != nil || slices.ContainsFunc(tags, func(t GodocsTag) bool { return t.ID != rec.TagID }) {
+		return
+	}
+	if err := app.docs.RemoveTag(ulid, rec.TagID); err != nil {
+		log.Printf("ingest: source tag off %s: %v", ulid, err)
+		return
+	}
+	if err := app.store.SetIngestTagged(ulid, false); err != nil {
+		log.Printf("state: %v", err)
+	}
+	app.sourceTags[ulid] = rec.TagID
+}
+
+// moveSourceTag carries a pending source tag over to the copy that
+// replaces a document. Callers must hold app.mu.
+func (app *App) moveSourceTag(from, to string) {
+	if err := app.store.MoveIngested(from, to); err != nil {
+		log.Printf("state: %v", err)
+	}
+	if tagID, ok := app.sourceTags[from]; ok {
+		delete(app.sourceTags, from)
+		app.sourceTags[to] = tagID
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/drummonds/godocs-inbox/internal/keymap"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+// -init -from-server URL writes a config for an existing godocs server
+// rather than the example one, so tag IDs need not be copied from
+// GET /api/tags by hand. The most-used tags of each tag group, by document
+// count, are given shortcut keys: the first letter of the name that is free
+// of the reserved keys and the keys already given. At a terminal each key
+// is asked for, Enter taking the suggestion and "-" leaving the tag out;
+// otherwise the suggestions are written as they are. -keys-per-group sets
+// how many tags of each group get a key. The file has each shortcut's tag
+// name, group and count as comments, and lists the tags left without a key.
+
+const defaultKeysPerGroup = 3
+
+// initTag is a server tag considered for a shortcut.
+type initTag struct {
+	GodocsTag
+	count int // documents carrying it; -1 if the count failed
+	key   string
+}
+
+// initOptions are the -init -from-server settings.
+type initOptions struct {
+	server   string
+	perGroup int
+	in       io.Reader // answers to the key prompts; nil takes the suggestions
+	out      io.Writer // prompts and progress
+}
+
+// stdinIsTerminal reports whether the key prompts can be answered.
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// writeServerConfig writes a config for opts.server to path with shortcuts
+// for its most-used tags.
+func writeServerConfig(ctx context.Context, path string, opts initOptions) error {
+	client := NewGodocsClient(opts.server)
+	tags, err := client.FetchTags()
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("%s has no tags to make shortcuts for", opts.server)
+	}
+	fmt.Fprintf(opts.out, "Counting the documents of %d tags on %s...\n", len(tags), opts.server)
+	itags := countInitTags(ctx, client, tags)
+
+	groups := make(map[string][]*initTag)
+	for i := range itags {
+		g := itags[i].TagGroup
+		groups[g] = append(groups[g], &itags[i])
+	}
+	names := slices.Sorted(maps.Keys(groups))
+
+	km, _ := buildKeymap(nil, nil) // the reserved keys and chords
+	var answers *bufio.Scanner
+	if opts.in != nil {
+		answers = bufio.NewScanner(opts.in)
+	}
+	var chosen []*initTag
+	for _, g := range names {
+		group := groups[g]
+		slices.SortStableFunc(group, func(a, b *initTag) int {
+			return cmp.Or(cmp.Compare(b.count, a.count), cmp.Compare(a.SortOrder, b.SortOrder), strings.Compare(a.Name, b.Name))
+		})
+		for _, t := range group[:min(opts.perGroup, len(group))] {
+			key := freeKeyFor(km, t.Name)
+			if answers != nil {
+				key = askKey(answers, opts.out, km, t, key)
+			}
+			if key == "" {
+				continue
+			}
+			km.Add(key, t.Name, keymap.Shortcut, len(chosen))
+			t.key = key
+			chosen = append(chosen, t)
+		}
+	}
+
+	data, err := serverConfigYAML(opts.server, names, groups)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.out, "%d shortcuts for %d tags\n", len(chosen), len(tags))
+	return nil
+}
+
+// countInitTags counts each tag's documents, as on the tag stats page.
+func countInitTags(ctx context.Context, client DocumentStore, tags []GodocsTag) []initTag {
+	out := make([]initTag, len(tags))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(tagCountParallel)
+	for i, t := range tags {
+		out[i] = initTag{GodocsTag: t, count: -1}
+		g.Go(func() error {
+			if sr, err := client.FetchTagged(ctx, t.ID, 1, 1); err == nil {
+				out[i].count = sr.TotalCount
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	return out
+}
+
+// freeKeyFor returns the first letter or digit of name, then of the
+// alphabet, that km leaves free, or "".
+func freeKeyFor(km *keymap.Keymap, name string) string {
+	for _, r := range strings.ToLower(name) + "abcdefghijklmnopqrstuvwxyz" {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		if keyFree(km, string(r)) {
+			return string(r)
+		}
+	}
+	return ""
+}
+
+// keyFree reports whether key can be bound in km.
+func keyFree(km *keymap.Keymap, key string) bool {
+	if _, ok := km.Lookup(key); ok {
+		return false
+	}
+	return len(km.Chords()[keymap.Normalize(key)]) == 0
+}
+
+// askKey asks for t's key, offering suggestion. It returns "" for no key.
+func askKey(answers *bufio.Scanner, out io.Writer, km *keymap.Keymap, t *initTag, suggestion string) string {
+	for {
+		fmt.Fprintf(out, "%s: %s (%s) key [%s], - for none: ", groupLabel(t.TagGroup), t.Name, countLabel(t.count), cmp.Or(suggestion, "-"))
+		if !answers.Scan() {
+			fmt.Fprintln(out)
+			return suggestion
+		}
+		switch key := keymap.Normalize(answers.Text()); {
+		case key == "":
+			return suggestion
+		case key == "-":
+			return ""
+		case len(strings.Fields(key)) > 1:
+			fmt.Fprintln(out, "  one key, please")
+		case !keyFree(km, key):
+			b, _ := km.Lookup(key)
+			fmt.Fprintf(out, "  %s is taken by %s\n", key, cmp.Or(b.Label, "a chord"))
+		default:
+			return key
+		}
+	}
+}
+
+func groupLabel(group string) string {
+	return cmp.Or(group, "no group")
+}
+
+func countLabel(count int) string {
+	switch count {
+	case -1:
+		return "count failed"
+	case 1:
+		return "1 document"
+	}
+	return strconv.Itoa(count) + " documents"
+}
+
+// serverConfigYAML renders the config with the tags as comments.
+func serverConfigYAML(server string, names []string, groups map[string][]*initTag) ([]byte, error) {
+	scalar := func(v string) *yaml.Node { return &yaml.Node{Kind: yaml.ScalarNode, Value: v} }
+	shortcuts := &yaml.Node{Kind: yaml.SequenceNode}
+	var others []string
+	for _, g := range names {
+		first := true
+		for _, t := range groups[g] {
+			if t.key == "" {
+				others = append(others, fmt.Sprintf("%s: %s, tag_id %d (%s)", groupLabel(g), t.Name, t.ID, countLabel(t.count)))
+				continue
+			}
+			id := scalar(strconv.Itoa(t.ID))
+			id.Tag = "!!int"
+			id.LineComment = fmt.Sprintf("%s (%s)", t.Name, countLabel(t.count))
+			key := scalar(t.key)
+			key.Tag = "!!str" // quoted when it would read as a number
+			item := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalar("key"), key, scalar("tag_id"), id}}
+			if first {
+				item.HeadComment = groupLabel(g)
+				first = false
+			}
+			shortcuts.Content = append(shortcuts.Content, item)
+		}
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		scalar("godocs_server"), scalar(server),
+		scalar("addr"), scalar(":8080"),
+	}}
+	if len(shortcuts.Content) > 0 {
+		key := scalar("tags")
+		key.HeadComment = "Keys for the most-used tags of each tag group"
+		root.Content = append(root.Content, key, shortcuts)
+	}
+	if len(others) > 0 {
+		root.FootComment = "Tags without a key:\n  " + strings.Join(others, "\n  ")
+	}
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root},
+		HeadComment: fmt.Sprintf("godocs-inbox configuration, written by -init -from-server\n%s tags as of %s", server, time.Now().Format(time.DateOnly))}
+
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,327 @@
+// Package brotli compresses streams in the Brotli format (RFC 7932) without
+// a dependency, for HTTP responses. Writer works like gzip.Writer:
+//
+//	bw := brotli.NewWriter(w)
+//	bw.Write(page)
+//	bw.Close()
+//
+// Input is coded a meta-block at a time with LZ77 back references over the
+// last 64 KiB and one set of Huffman codes per meta-block. Context
+// modelling, block switching and the static dictionary are not used, so it
+// compresses about as well as gzip. Flush ends the current meta-block and
+// pads to a byte, so a decoder can output everything written so far.
+package brotli
+
+import (
+	"io"
+	"math/bits"
+)
+
+const (
+	windowBits = 18      // the window a decoder must keep, 256 KiB
+	history    = 1 << 16 // how far back matches are looked for
+	blockSize  = 1 << 16 // input coded per meta-block
+)
+
+// Writer compresses what is written to it to an underlying writer.
+type Writer struct {
+	w       io.Writer
+	bw      bitWriter
+	buf     []byte // up to history bytes already coded, then pending input
+	coded   int    // len of buf that is history
+	started bool   // the stream header has been written
+	last    int    // the last distance, for distance code 0
+	err     error
+
+	head, prev []int32 // hash chains, kept between meta-blocks to save allocating
+}
+
+// NewWriter returns a Writer compressing to w.
+func NewWriter(w io.Writer) *Writer {
+	z := &Writer{}
+	z.Reset(w)
+	return z
+}
+
+// Reset discards the Writer's state and starts a new stream to w.
+func (z *Writer) Reset(w io.Writer) {
+	*z = Writer{w: w, bw: bitWriter{buf: z.bw.buf[:0]}, buf: z.buf[:0], last: 4, head: z.head, prev: z.prev}
+}
+
+// Write buffers p, coding whole meta-blocks as they fill.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		take := min(len(p), blockSize-(len(z.buf)-z.coded))
+		z.buf = append(z.buf, p[:take]...)
+		p = p[take:]
+		if len(z.buf)-z.coded == blockSize {
+			z.metaBlock()
+			if err := z.emit(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush codes the pending input and writes it out, with an empty metadata
+// block to reach a byte boundary.
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	z.metaBlock()
+	if z.bw.n > 0 {
+		// ISLAST 0, MNIBBLES 0 (metadata), reserved 0, MSKIPBYTES 0
+		z.bw.write(0b0110, 6)
+		z.bw.align()
+	}
+	return z.emit()
+}
+
+// Close codes the pending input and ends the stream. It does not close the
+// underlying writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	z.metaBlock()
+	z.header()
+	z.bw.write(0b11, 2) // ISLAST, ISLASTEMPTY
+	z.bw.align()
+	if err := z.emit(); err != nil {
+		return err
+	}
+	z.err = errClosed
+	return nil
+}
+
+var errClosed = io.ErrClosedPipe
+
+// emit writes the whole bytes coded so far.
+func (z *Writer) emit() error {
+	if len(z.bw.buf) == 0 {
+		return nil
+	}
+	_, z.err = z.w.Write(z.bw.buf)
+	z.bw.buf = z.bw.buf[:0]
+	return z.err
+}
+
+// header writes the stream header, WBITS, before the first meta-block.
+func (z *Writer) header() {
+	if !z.started {
+		z.started = true
+		z.bw.write(1|(windowBits-17)<<1, 4)
+	}
+}
+
+// metaBlock codes the pending input as a meta-block, compressed unless that
+// would be larger, and keeps the end of it as history.
+func (z *Writer) metaBlock() {
+	data := z.buf[z.coded:]
+	if len(data) == 0 {
+		return
+	}
+	z.header()
+	z.bw.write(0, 1) // ISLAST
+	z.bw.write(0, 2) // MNIBBLES 4
+	z.bw.write(uint32(len(data)-1), 16)
+
+	var body bitWriter
+	last := z.compress(&body)
+	if len(body.buf) < len(data) {
+		z.bw.write(0, 1) // ISUNCOMPRESSED
+		z.bw.writeBits(&body)
+		z.last = last
+	} else {
+		z.bw.write(1, 1)
+		z.bw.align()
+		z.bw.buf = append(z.bw.buf, data...)
+	}
+
+	if len(z.buf) > history {
+		z.buf = append(z.buf[:0], z.buf[len(z.buf)-history:]...)
+	}
+	z.coded = len(z.buf)
+}
+
+// command inserts literals, then copies length bytes from distance back.
+// The last command of a meta-block may copy nothing.
+type command struct {
+	insert, insertLen int // literals are buf[insert:insert+insertLen]
+	length, distance  int
+}
+
+const (
+	minMatch   = 4
+	maxMatch   = 1 << 16
+	chainDepth = 16
+	hashBits   = 15
+)
+
+// compress codes the pending input as a compressed meta-block's header and
+// commands into bw, and returns the last distance after it.
+func (z *Writer) compress(bw *bitWriter) int {
+	buf := z.buf
+	if z.head == nil {
+		z.head, z.prev = make([]int32, 1<<hashBits), make([]int32, history+blockSize)
+	}
+	head, prev := z.head, z.prev
+	for i := range head {
+		head[i] = -1
+	}
+	hash := func(i int) uint32 {
+		v := uint32(buf[i]) | uint32(buf[i+1])<<8 | uint32(buf[i+2])<<16 | uint32(buf[i+3])<<24
+		return v * 0x1e35a7bd >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+minMatch <= len(buf) {
+			h := hash(i)
+			prev[i], head[h] = head[h], int32(i)
+		}
+	}
+	for i := 0; i < z.coded; i++ {
+		insert(i)
+	}
+
+	var cmds []command
+	start := z.coded
+	for i := z.coded; i < len(buf); {
+		bestLen, bestDist := 0, 0
+		if i+minMatch <= len(buf) {
+			for j, depth := head[hash(i)], 0; j >= 0 && depth < chainDepth; j, depth = prev[j], depth+1 {
+				n, limit := 0, min(maxMatch, len(buf)-i)
+				for n < limit && buf[i+n] == buf[int(j)+n] {
+					n++
+				}
+				if n > bestLen {
+					bestLen, bestDist = n, i-int(j)
+				}
+			}
+		}
+		if bestLen < minMatch {
+			insert(i)
+			i++
+			continue
+		}
+		cmds = append(cmds, command{insert: start, insertLen: i - start, length: bestLen, distance: bestDist})
+		for end := i + bestLen; i < end; i++ {
+			insert(i)
+		}
+		start = i
+	}
+	if start < len(buf) {
+		cmds = append(cmds, command{insert: start, insertLen: len(buf) - start})
+	}
+
+	// Choose the symbols, then count them for the Huffman codes.
+	type coded struct {
+		symbol, distSymbol int // distSymbol -1 when implicit or absent
+		distExtraBits      int
+		distExtra          int
+	}
+	syms := make([]coded, len(cmds))
+	literals := make([]int, 256)
+	commands := make([]int, 704)
+	distances := make([]int, 64)
+	last := z.last
+	for k, c := range cmds {
+		for _, b := range buf[c.insert : c.insert+c.insertLen] {
+			literals[b]++
+		}
+		ins := lengthCode(insertBase[:], c.insertLen)
+		if c.length == 0 {
+			syms[k] = coded{symbol: commandSymbol(ins, 0, ins < 8), distSymbol: -1}
+			commands[syms[k].symbol]++
+			continue
+		}
+		cp := lengthCode(copyBase[:], c.length)
+		s := coded{distSymbol: -1}
+		switch {
+		case c.distance == last && ins < 8 && cp < 16:
+			s.symbol = commandSymbol(ins, cp, true)
+		case c.distance == last:
+			s.symbol, s.distSymbol = commandSymbol(ins, cp, false), 0
+		default:
+			s.symbol = commandSymbol(ins, cp, false)
+			s.distSymbol, s.distExtraBits, s.distExtra = distanceCode(c.distance)
+			last = c.distance
+		}
+		syms[k] = s
+		commands[s.symbol]++
+		if s.distSymbol >= 0 {
+			distances[s.distSymbol]++
+		}
+	}
+
+	// NBLTYPESL, NBLTYPESI, NBLTYPESD 1; NPOSTFIX 0, NDIRECT 0; literal
+	// context mode LSB6; NTREESL, NTREESD 1
+	bw.write(0, 3)
+	bw.write(0, 6)
+	bw.write(0, 2)
+	bw.write(0, 2)
+	literalCode := writeCode(bw, literals)
+	commandCode := writeCode(bw, commands)
+	distCode := writeCode(bw, distances)
+
+	for k, c := range cmds {
+		s := syms[k]
+		ins := lengthCode(insertBase[:], c.insertLen)
+		commandCode.write(bw, s.symbol)
+		bw.write(uint32(c.insertLen-insertBase[ins]), insertExtra[ins])
+		if c.length > 0 {
+			cp := lengthCode(copyBase[:], c.length)
+			bw.write(uint32(c.length-copyBase[cp]), copyExtra[cp])
+		}
+		for _, b := range buf[c.insert : c.insert+c.insertLen] {
+			literalCode.write(bw, int(b))
+		}
+		if s.distSymbol >= 0 {
+			distCode.write(bw, s.distSymbol)
+			bw.write(uint32(s.distExtra), uint(s.distExtraBits))
+		}
+	}
+	return last
+}
+
+// Insert and copy lengths are coded as one of 24 ranges each, with extra
+// bits for the place in the range.
+var (
+	insertBase  = [24]int{0, 1, 2, 3, 4, 5, 6, 8, 10, 14, 18, 26, 34, 50, 66, 98, 130, 194, 322, 578, 1090, 2114, 6210, 22594}
+	insertExtra = [24]uint{0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 12, 14, 24}
+	copyBase    = [24]int{2, 3, 4, 5, 6, 7, 8, 9, 10, 12, 14, 18, 22, 30, 38, 54, 70, 102, 134, 198, 326, 582, 1094, 2118}
+	copyExtra   = [24]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 24}
+)
+
+// lengthCode is the range of base that n falls in.
+func lengthCode(base []int, n int) int {
+	code := 0
+	for code+1 < len(base) && base[code+1] <= n {
+		code++
+	}
+	return code
+}
+
+// commandSymbol combines an insert and a copy length code into an
+// insert-and-copy symbol. The first 128 symbols reuse the last distance
+// without coding it.
+func commandSymbol(ins, cp int, lastDistance bool) int {
+	cell := [3][3]int{{128, 192, 384}, {256, 320, 512}, {448, 576, 640}}[ins>>3][cp>>3]
+	if lastDistance {
+		cell = cp >> 3 * 64
+	}
+	return cell + (ins&7)<<3 | cp&7
+}
+
+// distanceCode codes a distance directly, with no postfix bits or direct
+// codes: symbol 16 and up, and the extra bits after it.
+func distanceCode(d int) (symbol, extraBits, extra int) {
+	v := d + 3
+	n := bits.Len(uint(v)) - 2
+	return 16 + 2*(n-1) + v>>n&1, n, v & (1<<n - 1)
+}
@@ -0,0 +1,410 @@
+package brotli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Streams from Google's brotli library at qualities 0 and 1: it stores
+// short input uncompressed at 0 and compresses it at 1.
+var reference = []struct{ text, compressed string }{
+	{
+		"GODOCS-SEP GODOCS-SEP: inbox inbox inbox, the quick brown fox jumps over the lazy dog; the quick brown fox.",
+		"033580474f444f43532d53455020474f444f43532d5345503a20696e626f7820696e626f7820696e626f782c2074686520717569636b2062726f776e20666f78206a756d7073206f76657220746865206c617a7920646f673b2074686520717569636b2062726f776e20666f782e03",
+	},
+	{
+		"GODOCS-SEP GODOCS-SEP: inbox inbox inbox, the quick brown fox jumps over the lazy dog; the quick brown fox.",
+		"0335000080aaaaaaeaff7465b89b1adccd8e0bd8510d400f2753355533353553315533355533a7dc922bdf318c30cc313ce06163ccb14d6a23ef7927981826ccf106d64b2ab6de159e4d2324ab1c64a4ec61a8604fe775835e1d2fc863fe3f2cb4b60567485639c848d9c350a907",
+	},
+	{"", "06"},
+}
+
+func TestReferenceStreams(t *testing.T) {
+	for _, r := range reference {
+		b, _ := hex.DecodeString(r.compressed)
+		got, err := decode(b)
+		if err != nil || string(got) != r.text {
+			t.Errorf("decoding %s…: %q, %v", r.compressed[:8], got, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	noise := make([]byte, 70000)
+	rng.Read(noise)
+	var page strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&page, `<tr><td><a href="/doc/01X%05d">statement %d.pdf</a></td><td class="tag">%s</td></tr>`+"\n",
+			i, i, []string{"letters", "money", "home"}[rng.Intn(3)])
+	}
+
+	for name, chunks := range map[string][]string{
+		"empty":   nil,
+		"byte":    {"x"},
+		"page":    {page.String()},
+		"noise":   {string(noise)},
+		"zeros":   {string(make([]byte, 200000))},
+		"repeats": {strings.Repeat("ab", 5000), strings.Repeat("abc", 9000)},
+		"mixed":   {page.String()[:30000], string(noise[:5000]), page.String()},
+	} {
+		for _, flush := range []bool{false, true} {
+			var out bytes.Buffer
+			z := NewWriter(&out)
+			for _, c := range chunks {
+				if _, err := z.Write([]byte(c)); err != nil {
+					t.Fatal(err)
+				}
+				if flush {
+					if err := z.Flush(); err != nil {
+						t.Fatal(err)
+					}
+					// everything so far decodes, as a browser would show it
+					if got, err := decodeFlushed(out.Bytes()); err != nil || !strings.HasSuffix(string(got), c) {
+						t.Errorf("%s: after a flush decoded %d bytes, %v", name, len(got), err)
+					}
+				}
+			}
+			if err := z.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := decode(out.Bytes())
+			if err != nil {
+				t.Fatalf("%s (flush %v): %v", name, flush, err)
+			}
+			if want := strings.Join(chunks, ""); string(got) != want {
+				t.Fatalf("%s (flush %v): decoded %d bytes, want %d", name, flush, len(got), len(want))
+			}
+			if name == "page" && out.Len() > len(page.String())/8 {
+				t.Errorf("page compressed to %d of %d bytes", out.Len(), page.Len())
+			}
+			if name == "noise" && out.Len() > len(noise)+len(noise)/1000 {
+				t.Errorf("noise grew to %d bytes", out.Len())
+			}
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	var a, b bytes.Buffer
+	z := NewWriter(&a)
+	z.Write([]byte(strings.Repeat("first ", 100)))
+	z.Close()
+	if _, err := z.Write([]byte("late")); err == nil {
+		t.Error("wrote after Close")
+	}
+	z.Reset(&b)
+	z.Write([]byte("second"))
+	z.Close()
+	if got, err := decode(b.Bytes()); err != nil || string(got) != "second" {
+		t.Errorf("after Reset decoded %q, %v", got, err)
+	}
+}
+
+// decode is a decoder for streams with one block type each and one literal
+// and distance code, as Writer makes, that do not use the dictionary.
+func decode(b []byte) ([]byte, error) {
+	out, last, err := decodeStream(b)
+	if err == nil && !last {
+		err = errors.New("no last meta-block")
+	}
+	return out, err
+}
+
+// decodeFlushed decodes a stream that has been flushed but not closed.
+func decodeFlushed(b []byte) ([]byte, error) {
+	out, _, err := decodeStream(b)
+	return out, err
+}
+
+func decodeStream(b []byte) ([]byte, bool, error) {
+	r := &bitReader{b: b}
+	if r.read(1) == 1 {
+		if n := r.read(3); n == 0 {
+			r.read(3)
+		}
+	}
+	var out []byte
+	dist := []int{16, 15, 11, 4}
+	for r.pos < 8*len(b) {
+		last := r.read(1) == 1
+		if last && r.read(1) == 1 {
+			return out, true, r.err
+		}
+		nibbles := r.read(2)
+		if nibbles == 3 {
+			if r.read(1) != 0 {
+				return nil, false, errors.New("reserved bit set")
+			}
+			skip, n := r.read(2), 0
+			if skip > 0 {
+				n = int(r.read(8*uint(skip))) + 1
+			}
+			r.align()
+			r.pos += 8 * n
+			continue
+		}
+		mlen := int(r.read(4*(uint(nibbles)+4))) + 1
+		if !last && r.read(1) == 1 {
+			r.align()
+			out = append(out, b[r.pos/8:r.pos/8+mlen]...)
+			r.pos += 8 * mlen
+			continue
+		}
+		for _, n := range []string{"literal", "command", "distance"} {
+			if r.read(1) != 0 {
+				return nil, false, fmt.Errorf("%s block types", n)
+			}
+		}
+		postfix := r.read(2)
+		direct := int(r.read(4)) << postfix
+		r.read(2) // context mode
+		if r.read(1) != 0 || r.read(1) != 0 {
+			return nil, false, errors.New("context maps")
+		}
+		literals := r.code(256)
+		commands := r.code(704)
+		distances := r.code(16 + direct + 48<<postfix)
+		if r.err != nil {
+			return nil, false, r.err
+		}
+
+		end := len(out) + mlen
+		for len(out) < end {
+			sym := commands.next(r)
+			cell := sym >> 6
+			insRow := [11]int{0, 0, 0, 0, 1, 1, 0, 2, 1, 2, 2}[cell]
+			cpCol := [11]int{0, 1, 0, 1, 0, 1, 2, 0, 2, 1, 2}[cell]
+			ins := insRow<<3 | sym>>3&7
+			cp := cpCol<<3 | sym&7
+			insLen := insertBase[ins] + int(r.read(insertExtra[ins]))
+			cpLen := copyBase[cp] + int(r.read(copyExtra[cp]))
+			for range insLen {
+				out = append(out, byte(literals.next(r)))
+			}
+			if r.err != nil {
+				return nil, false, r.err
+			}
+			if len(out) >= end {
+				break
+			}
+			d := dist[3]
+			if sym >= 128 {
+				dc := distances.next(r)
+				switch {
+				case dc < 16:
+					d = ringDistance(dist, dc)
+				case dc < 16+direct:
+					d = dc - 15
+				default:
+					dc -= 16 + direct
+					n := 1 + dc>>(postfix+1)
+					offset := (2+dc>>postfix&1)<<n - 4
+					d = (offset+int(r.read(uint(n))))<<postfix + dc&(1<<postfix-1) + direct + 1
+				}
+				if dc != 0 {
+					dist = append(dist[1:], d)
+				}
+			}
+			if d < 1 || d > len(out) {
+				return nil, false, fmt.Errorf("distance %d at %d", d, len(out))
+			}
+			for range cpLen {
+				out = append(out, out[len(out)-d])
+			}
+		}
+		if len(out) != end || r.err != nil {
+			return nil, false, fmt.Errorf("meta-block ran to %d, want %d (%v)", len(out), end, r.err)
+		}
+		if last {
+			return out, true, nil
+		}
+	}
+	return out, false, r.err
+}
+
+// ringDistance resolves the distance codes below 16, relative to the last
+// four distances.
+func ringDistance(dist []int, dc int) int {
+	last := [16]int{3, 2, 1, 0, 3, 3, 3, 3, 3, 3, 2, 2, 2, 2, 2, 2}[dc]
+	delta := [16]int{0, 0, 0, 0, -1, 1, -2, 2, -3, 3, -1, 1, -2, 2, -3, 3}[dc]
+	return dist[last] + delta
+}
+
+type bitReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *bitReader) read(n uint) uint32 {
+	var v uint32
+	for i := uint(0); i < n; i++ {
+		if r.pos >= 8*len(r.b) {
+			r.err = errors.New("unexpected end of stream")
+			return 0
+		}
+		v |= uint32(r.b[r.pos/8]>>(r.pos%8)&1) << i
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+// huffman maps {length, code} to symbols.
+type huffman map[[2]int]int
+
+func (h huffman) next(r *bitReader) int {
+	if s, ok := h[[2]int{0, 0}]; ok {
+		return s
+	}
+	code := 0
+	for n := 1; n <= 15; n++ {
+		code = code<<1 | int(r.read(1))
+		if s, ok := h[[2]int{n, code}]; ok {
+			return s
+		}
+	}
+	r.err = errors.New("bad prefix code")
+	return 0
+}
+
+// canonical assigns codes to lengths; a lone symbol takes no bits.
+func canonical(lengths []int) huffman {
+	h := huffman{}
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	code := 0
+	for n := 1; n <= 15; n++ {
+		for s, l := range lengths {
+			if l == n {
+				if used == 1 {
+					h[[2]int{0, 0}] = s
+				}
+				h[[2]int{n, code}] = s
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return h
+}
+
+func (r *bitReader) code(alphabet int) huffman {
+	bits := 0
+	for 1<<bits < alphabet {
+		bits++
+	}
+	hskip := r.read(2)
+	if hskip == 1 {
+		n := r.read(2) + 1
+		syms := make([]int, n)
+		for i := range syms {
+			syms[i] = int(r.read(uint(bits)))
+		}
+		lengths := map[uint32][]int{1: {0}, 2: {1, 1}, 3: {1, 2, 2}, 4: {2, 2, 2, 2}}[n]
+		if n == 4 && r.read(1) == 1 {
+			lengths = []int{1, 2, 3, 3}
+		}
+		all := make([]int, alphabet)
+		for i, s := range syms {
+			all[s] = lengths[i]
+		}
+		if n == 1 {
+			return huffman{{0, 0}: syms[0]}
+		}
+		return canonical(all)
+	}
+
+	clLengths := make([]int, 18)
+	space, used := 32, 0
+	for _, s := range codeLengthOrder[hskip:] {
+		var l int
+		switch r.read(2) {
+		case 0b00:
+			l = 0
+		case 0b10:
+			l = 3
+		case 0b01:
+			l = 4
+		default:
+			if r.read(1) == 0 {
+				l = 2
+			} else if r.read(1) == 0 {
+				l = 1
+			} else {
+				l = 5
+			}
+		}
+		clLengths[s] = l
+		if l > 0 {
+			space -= 32 >> l
+			used++
+			if space <= 0 {
+				break
+			}
+		}
+	}
+	if space != 0 && used != 1 {
+		r.err = errors.New("incomplete code length code")
+		return nil
+	}
+	cl := canonical(clLengths)
+
+	lengths := make([]int, alphabet)
+	prevLen, repeat, repeatLen := 8, 0, 0
+	space = 1 << 15
+	for s := 0; s < alphabet && space > 0 && r.err == nil; {
+		l := cl.next(r)
+		if l < 16 {
+			lengths[s] = l
+			s++
+			repeat = 0
+			if l != 0 {
+				prevLen = l
+				space -= 1 << 15 >> l
+			}
+			continue
+		}
+		extraBits, newLen := uint(2), prevLen
+		if l == 17 {
+			extraBits, newLen = 3, 0
+		}
+		if repeatLen != newLen {
+			repeat, repeatLen = 0, newLen
+		}
+		old := repeat
+		if repeat > 0 {
+			repeat = (repeat - 2) << extraBits
+		}
+		repeat += int(r.read(extraBits)) + 3
+		for range repeat - old {
+			if s >= alphabet {
+				r.err = errors.New("repeat past the alphabet")
+				return nil
+			}
+			lengths[s] = newLen
+			s++
+			if newLen != 0 {
+				space -= 1 << 15 >> newLen
+			}
+		}
+	}
+	if space != 0 {
+		r.err = errors.New("incomplete prefix code")
+		return nil
+	}
+	return canonical(lengths)
+}
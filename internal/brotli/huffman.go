@@ -0,0 +1,267 @@
+package brotli
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+)
+
+// codeLengthOrder is the order the code length code's lengths are written.
+var codeLengthOrder = [18]int{1, 2, 3, 4, 0, 5, 17, 6, 16, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// codeLengthLengths is the fixed code for the code length code's lengths,
+// 0 to 5, as {bits, width}.
+var codeLengthLengths = [6][2]uint32{{0, 2}, {7, 4}, {3, 3}, {2, 2}, {1, 2}, {15, 4}}
+
+// prefixCode is a Huffman code, bit-reversed as it is written least
+// significant bit first.
+type prefixCode struct {
+	codes []uint32
+	sizes []uint8 // bits written for each symbol
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.sizes[symbol]))
+}
+
+// writeCode writes the Huffman code for the symbols counted in counts and
+// returns it. A code for one symbol, or none, takes no bits.
+func writeCode(bw *bitWriter, counts []int) prefixCode {
+	var used []int
+	for s, n := range counts {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+	if len(used) <= 1 {
+		symbol := 0
+		if len(used) == 1 {
+			symbol = used[0]
+		}
+		bw.write(1, 2) // HSKIP 1: simple code
+		bw.write(0, 2) // of one symbol
+		bw.write(uint32(symbol), uint(bits.Len(uint(len(counts)-1))))
+		return prefixCode{codes: make([]uint32, len(counts)), sizes: make([]uint8, len(counts))}
+	}
+
+	lengths := huffmanLengths(counts, 15)
+	end := len(lengths)
+	for lengths[end-1] == 0 {
+		end--
+	}
+
+	// The lengths up to the last used symbol are themselves coded, with
+	// runs of zeros (17) and repeats of the last length (16). A run of
+	// repeat codes multiplies: each adds its extra bits to four (or eight)
+	// times the count so far.
+	type rle struct {
+		symbol    int
+		extra     uint32
+		extraBits uint
+	}
+	var runs []rle
+	repeat := func(symbol int, n int, extraBits uint) {
+		from := len(runs)
+		n -= 3
+		for {
+			runs = append(runs, rle{symbol, uint32(n) & (1<<extraBits - 1), extraBits})
+			n >>= extraBits
+			if n == 0 {
+				break
+			}
+			n--
+		}
+		slices.Reverse(runs[from:])
+	}
+	previous := 8
+	for i := 0; i < end; {
+		l := int(lengths[i])
+		n := 1
+		for i+n < end && int(lengths[i+n]) == l {
+			n++
+		}
+		i += n
+		if l == 0 {
+			if n == 11 {
+				runs = append(runs, rle{symbol: 0})
+				n--
+			}
+			if n < 3 {
+				for ; n > 0; n-- {
+					runs = append(runs, rle{symbol: 0})
+				}
+			} else {
+				repeat(17, n, 3)
+			}
+			continue
+		}
+		if l != previous {
+			runs = append(runs, rle{symbol: l})
+			n--
+		}
+		previous = l
+		if n == 7 {
+			runs = append(runs, rle{symbol: l})
+			n--
+		}
+		if n < 3 {
+			for ; n > 0; n-- {
+				runs = append(runs, rle{symbol: l})
+			}
+		} else {
+			repeat(16, n, 2)
+		}
+	}
+
+	lengthCounts := make([]int, len(codeLengthOrder))
+	for _, r := range runs {
+		lengthCounts[r.symbol]++
+	}
+	lengthLengths := huffmanLengths(lengthCounts, 5)
+	lengthCode := newPrefixCode(lengthLengths)
+	bw.write(0, 2) // HSKIP 0: complex code
+	// A decoder stops reading lengths once they fill the code, unless only
+	// one is non-zero.
+	space, nonZero := 32, 0
+	for _, l := range lengthLengths {
+		if l > 0 {
+			nonZero++
+		}
+	}
+	for _, s := range codeLengthOrder {
+		l := lengthLengths[s]
+		bw.write(codeLengthLengths[l][0], uint(codeLengthLengths[l][1]))
+		if l > 0 {
+			space -= 32 >> l
+			if space <= 0 && nonZero > 1 {
+				break
+			}
+		}
+	}
+	for _, r := range runs {
+		lengthCode.write(bw, r.symbol)
+		bw.write(r.extra, r.extraBits)
+	}
+	return newPrefixCode(lengths)
+}
+
+// newPrefixCode assigns the canonical codes for lengths. A lone symbol is
+// read without any bits, whatever its length.
+func newPrefixCode(lengths []uint8) prefixCode {
+	c := prefixCode{codes: make([]uint32, len(lengths)), sizes: lengths}
+	var count [16]uint32
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used++
+		}
+	}
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c.codes[s] = bits.Reverse32(next[l]) >> (32 - l)
+		next[l]++
+	}
+	if used == 1 {
+		c.sizes = make([]uint8, len(lengths))
+	}
+	return c
+}
+
+// huffmanLengths returns code lengths for counts no longer than limit,
+// flattening the counts until the tree is shallow enough.
+func huffmanLengths(counts []int, limit int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	var leaves []int
+	for s, n := range counts {
+		if n > 0 {
+			leaves = append(leaves, s)
+		}
+	}
+	if len(leaves) < 2 {
+		for _, s := range leaves {
+			lengths[s] = 1
+		}
+		return lengths
+	}
+	weights := slices.Clone(counts)
+	for {
+		slices.SortStableFunc(leaves, func(a, b int) int { return cmp.Compare(weights[a], weights[b]) })
+		// Nodes are the leaves in order, then the internal nodes as they
+		// are made, which come out in order too.
+		weight := make([]int, len(leaves), 2*len(leaves)-1)
+		for i, s := range leaves {
+			weight[i] = weights[s]
+		}
+		parent := make([]int, 2*len(leaves)-1)
+		leaf, internal := 0, len(leaves)
+		lightest := func() int {
+			if leaf < len(leaves) && (internal == len(weight) || weight[leaf] <= weight[internal]) {
+				leaf++
+				return leaf - 1
+			}
+			internal++
+			return internal - 1
+		}
+		for len(weight) < cap(weight) {
+			a, b := lightest(), lightest()
+			parent[a], parent[b] = len(weight), len(weight)
+			weight = append(weight, weight[a]+weight[b])
+		}
+		depth := make([]int, len(weight))
+		deepest := 0
+		for i := len(weight) - 2; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+			deepest = max(deepest, depth[i])
+		}
+		if deepest <= limit {
+			for i, s := range leaves {
+				lengths[s] = uint8(depth[i])
+			}
+			return lengths
+		}
+		for _, s := range leaves {
+			weights[s] = weights[s]/2 + 1
+		}
+	}
+}
+
+// bitWriter packs values least significant bit first.
+type bitWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.bits |= uint64(v) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.n -= 8
+	}
+}
+
+// align pads with zeros to a byte boundary.
+func (w *bitWriter) align() {
+	if w.n > 0 {
+		w.write(0, 8-w.n)
+	}
+}
+
+// writeBits appends everything written to o.
+func (w *bitWriter) writeBits(o *bitWriter) {
+	for _, b := range o.buf {
+		w.write(uint32(b), 8)
+	}
+	w.write(uint32(o.bits), o.n)
+}
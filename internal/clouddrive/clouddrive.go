@@ -0,0 +1,175 @@
+// Package clouddrive reads files from a folder in Dropbox or Google Drive
+// and moves them aside once they have been dealt with. It authenticates
+// with an OAuth refresh token, exchanged for short-lived access tokens as
+// needed, and has no dependencies:
+//
+//	d := clouddrive.NewDropbox(clouddrive.Options{Folder: "/Scans",
+//		Processed: "/Scans/processed", ClientID: id, ClientSecret: secret,
+//		RefreshToken: token})
+//	files, err := d.List(ctx)
+package clouddrive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures a Drive.
+type Options struct {
+	Folder       string // Dropbox path, or Google Drive folder ID
+	Processed    string // where files are moved once read; "" leaves them
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	Client       *http.Client // nil for http.DefaultClient
+
+	// Overrides of the provider's endpoints, for tests
+	TokenURL   string
+	APIURL     string
+	ContentURL string // Dropbox downloads
+}
+
+func (o *Options) defaults(tokenURL, apiURL, contentURL string) {
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+	if o.TokenURL == "" {
+		o.TokenURL = tokenURL
+	}
+	if o.APIURL == "" {
+		o.APIURL = apiURL
+	}
+	if o.ContentURL == "" {
+		o.ContentURL = contentURL
+	}
+}
+
+// File is a file in the watched folder.
+type File struct {
+	ID      string // stable across moves
+	Name    string
+	Version string // changes when the file is rewritten
+	Size    int64
+}
+
+// Drive is a watched folder.
+type Drive interface {
+	// List returns the files directly in the folder.
+	List(ctx context.Context) ([]File, error)
+	// Open returns a file's content. The caller must close it.
+	Open(ctx context.Context, f File) (io.ReadCloser, error)
+	// MarkProcessed moves a file to the processed folder, if there is one.
+	MarkProcessed(ctx context.Context, f File) error
+}
+
+// tokenSource exchanges the refresh token for access tokens.
+type tokenSource struct {
+	opts    *Options
+	mu      sync.Mutex
+	access  string
+	expires time.Time
+}
+
+// token returns an access token, refreshing it shortly before it expires.
+func (ts *tokenSource) token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.access != "" && time.Now().Before(ts.expires) {
+		return ts.access, nil
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {ts.opts.RefreshToken},
+		"client_id":     {ts.opts.ClientID},
+		"client_secret": {ts.opts.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", ts.opts.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := ts.opts.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("refreshing token: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("refreshing token (%d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return "", fmt.Errorf("refreshing token (%d): %s %s", resp.StatusCode, tok.Error, tok.Description)
+	}
+	ts.access = tok.AccessToken
+	ts.expires = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return ts.access, nil
+}
+
+// do sends req with an access token and fails on an error status.
+func (ts *tokenSource) do(req *http.Request) (*http.Response, error) {
+	tok, err := ts.token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	resp, err := ts.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			// The token may have been revoked early; get a new one next time
+			ts.mu.Lock()
+			ts.access = ""
+			ts.mu.Unlock()
+		}
+		return nil, fmt.Errorf("%s %s failed (%d): %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+// doJSON sends a JSON request and decodes the JSON response into out, if
+// it is not nil.
+func (ts *tokenSource) doJSON(ctx context.Context, method, u string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = strings.NewReader(string(b))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := ts.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package clouddrive
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+)
+
+// Dropbox is a folder in Dropbox, read with the v2 HTTP API.
+type Dropbox struct {
+	opts Options
+	ts   *tokenSource
+}
+
+// NewDropbox returns a Dropbox folder for opts. The app needs the
+// files.content.read and files.content.write scopes.
+func NewDropbox(opts Options) *Dropbox {
+	opts.defaults("https://api.dropboxapi.com/oauth2/token", "https://api.dropboxapi.com", "https://content.dropboxapi.com")
+	d := &Dropbox{opts: opts}
+	d.ts = &tokenSource{opts: &d.opts}
+	return d
+}
+
+type dropboxEntry struct {
+	Tag  string `json:".tag"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Rev  string `json:"rev"`
+	Size int64  `json:"size"`
+}
+
+func (d *Dropbox) List(ctx context.Context) ([]File, error) {
+	var page struct {
+		Entries []dropboxEntry `json:"entries"`
+		Cursor  string         `json:"cursor"`
+		HasMore bool           `json:"has_more"`
+	}
+	err := d.ts.doJSON(ctx, "POST", d.opts.APIURL+"/2/files/list_folder", map[string]any{"path": d.opts.Folder}, &page)
+	var files []File
+	for err == nil {
+		for _, e := range page.Entries {
+			if e.Tag == "file" {
+				files = append(files, File{ID: e.ID, Name: e.Name, Version: e.Rev, Size: e.Size})
+			}
+		}
+		if !page.HasMore {
+			return files, nil
+		}
+		cursor := page.Cursor
+		page.Entries = nil
+		err = d.ts.doJSON(ctx, "POST", d.opts.APIURL+"/2/files/list_folder/continue", map[string]string{"cursor": cursor}, &page)
+	}
+	return nil, err
+}
+
+func (d *Dropbox) Open(ctx context.Context, f File) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", d.opts.ContentURL+"/2/files/download", nil)
+	if err != nil {
+		return nil, err
+	}
+	arg, _ := json.Marshal(map[string]string{"path": f.ID})
+	req.Header.Set("Dropbox-API-Arg", string(arg))
+	resp, err := d.ts.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// MarkProcessed moves the file into the processed folder, renaming it if
+// the name is taken.
+func (d *Dropbox) MarkProcessed(ctx context.Context, f File) error {
+	if d.opts.Processed == "" {
+		return nil
+	}
+	return d.ts.doJSON(ctx, "POST", d.opts.APIURL+"/2/files/move_v2", map[string]any{
+		"from_path": f.ID, "to_path": path.Join(d.opts.Processed, f.Name), "autorename": true,
+	}, nil)
+}
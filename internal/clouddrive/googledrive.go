@@ -0,0 +1,86 @@
+package clouddrive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GoogleDrive is a folder in Google Drive, read with the v3 API. Google
+// Docs, Sheets and other native files have no content to download and are
+// left out of listings.
+type GoogleDrive struct {
+	opts Options
+	ts   *tokenSource
+}
+
+// NewGoogleDrive returns a Google Drive folder for opts. Folder and
+// Processed are folder IDs, as in the folder's URL. The app needs the
+// drive scope, or drive.file for folders it created.
+func NewGoogleDrive(opts Options) *GoogleDrive {
+	opts.defaults("https://oauth2.googleapis.com/token", "https://www.googleapis.com", "")
+	g := &GoogleDrive{opts: opts}
+	g.ts = &tokenSource{opts: &g.opts}
+	return g
+}
+
+func (g *GoogleDrive) List(ctx context.Context) ([]File, error) {
+	q := url.Values{
+		"q":        {"'" + strings.ReplaceAll(g.opts.Folder, "'", `\'`) + "' in parents and trashed = false and not mimeType contains 'application/vnd.google-apps.'"},
+		"fields":   {"nextPageToken,files(id,name,size,md5Checksum,modifiedTime)"},
+		"pageSize": {"1000"},
+	}
+	var files []File
+	for {
+		var page struct {
+			Files []struct {
+				ID           string `json:"id"`
+				Name         string `json:"name"`
+				Size         string `json:"size"` // int64 as a string
+				MD5          string `json:"md5Checksum"`
+				ModifiedTime string `json:"modifiedTime"`
+			} `json:"files"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := g.ts.doJSON(ctx, "GET", g.opts.APIURL+"/drive/v3/files?"+q.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, f := range page.Files {
+			size, _ := strconv.ParseInt(f.Size, 10, 64)
+			version := f.MD5
+			if version == "" {
+				version = f.ModifiedTime
+			}
+			files = append(files, File{ID: f.ID, Name: f.Name, Version: version, Size: size})
+		}
+		if page.NextPageToken == "" {
+			return files, nil
+		}
+		q.Set("pageToken", page.NextPageToken)
+	}
+}
+
+func (g *GoogleDrive) Open(ctx context.Context, f File) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", g.opts.APIURL+"/drive/v3/files/"+url.PathEscape(f.ID)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.ts.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// MarkProcessed moves the file from the watched folder to the processed
+// one.
+func (g *GoogleDrive) MarkProcessed(ctx context.Context, f File) error {
+	if g.opts.Processed == "" {
+		return nil
+	}
+	q := url.Values{"addParents": {g.opts.Processed}, "removeParents": {g.opts.Folder}}
+	return g.ts.doJSON(ctx, "PATCH", g.opts.APIURL+"/drive/v3/files/"+url.PathEscape(f.ID)+"?"+q.Encode(), struct{}{}, nil)
+}
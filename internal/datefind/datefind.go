@@ -0,0 +1,294 @@
+// Package datefind finds the likely document date in OCR text without an
+// LLM. Dates are matched in ISO, numeric (day or month first) and written
+// forms, with month names in several languages, then scored: a date after
+// a keyword such as "Statement date:" or "Datum" scores high, one after
+// "due" or "valid until" low, and the first dates in the text and those
+// repeated score a little higher. Dates in the future or decades past
+// score lower.
+//
+//	cands := datefind.Find(text, datefind.Options{Now: time.Now()})
+//	cands[0] // {Date: "2026-03-14", Label: "statement date", Confidence: 0.9, ...}
+//
+// Parse reads a single date the same way, for dates typed or answered by
+// an LLM.
+package datefind
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCandidates bounds Find's result.
+const maxCandidates = 5
+
+// Options adjusts Find.
+type Options struct {
+	MonthFirst bool      // read ambiguous numeric dates such as 03/04/2026 as US month/day
+	Now        time.Time // for judging future and old dates; zero means time.Now()
+}
+
+// Candidate is a date found in the text, with the confidence (0–1) that it
+// is the document date.
+type Candidate struct {
+	Date       string // YYYY-MM-DD
+	Label      string // the keyword before it, e.g. "invoice date", or "date"
+	Confidence float64
+	Reason     string
+}
+
+// months maps month names and abbreviations, in English, German, French,
+// Spanish, Italian and Dutch, to their numbers.
+var months = func() map[string]int {
+	m := map[string]int{}
+	for i, names := range [][]string{
+		{"january", "jan", "januar", "janvier", "enero", "gennaio", "januari", "jänner"},
+		{"february", "feb", "februar", "février", "fevrier", "févr", "febrero", "febbraio", "februari"},
+		{"march", "mar", "märz", "maerz", "mars", "marzo", "maart", "mrt"},
+		{"april", "apr", "avril", "avr", "abril", "aprile"},
+		{"may", "mai", "mayo", "maggio", "mei"},
+		{"june", "jun", "juni", "juin", "junio", "giugno"},
+		{"july", "jul", "juli", "juillet", "juil", "julio", "luglio"},
+		{"august", "aug", "août", "aout", "agosto", "augustus"},
+		{"september", "sep", "sept", "septembre", "septiembre", "settembre"},
+		{"october", "oct", "oktober", "okt", "octobre", "octubre", "ottobre"},
+		{"november", "nov", "novembre", "noviembre"},
+		{"december", "dec", "dezember", "dez", "décembre", "decembre", "déc", "diciembre", "dicembre"},
+	} {
+		for _, n := range names {
+			m[n] = i + 1
+		}
+	}
+	return m
+}()
+
+const monthName = `([[:alpha:]äéûëè]{3,10})\.?`
+
+var (
+	isoDate     = regexp.MustCompile(`\b(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})\b`)
+	numericDate = regexp.MustCompile(`\b(\d{1,2})[/.\-](\d{1,2})[/.\-](\d{4}|\d{2})\b`)
+	dayMonth    = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th|er|\.)?[\s\-]+(?:de\s+)?` + monthName + `[\s\-,]+(?:de\s+)?(\d{4})\b`)
+	monthDay    = regexp.MustCompile(`(?i)\b` + monthName + `\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+)
+
+// keywords before a date, with how much they raise (or lower) its score.
+// Longer keywords are tried first, so "due date" is not taken for "date".
+var keywords = func() []keyword {
+	k := []keyword{
+		{"statement date", 0.45}, {"invoice date", 0.45}, {"date of issue", 0.45}, {"issue date", 0.45},
+		{"letter date", 0.45}, {"tax point", 0.4}, {"document date", 0.45}, {"date issued", 0.45},
+		{"rechnungsdatum", 0.45}, {"ausstellungsdatum", 0.45}, {"belegdatum", 0.45}, {"datum", 0.35},
+		{"date de facture", 0.45}, {"date d'émission", 0.45}, {"fecha de emisión", 0.45}, {"fecha", 0.35},
+		{"factuurdatum", 0.45}, {"data fattura", 0.45}, {"dated", 0.4}, {"date", 0.35},
+		{"due date", -0.25}, {"payment due", -0.25}, {"due", -0.25}, {"pay by", -0.25}, {"fällig", -0.25},
+		{"expiry", -0.3}, {"expires", -0.3}, {"valid until", -0.3}, {"gültig bis", -0.3},
+		{"date of birth", -0.4}, {"born", -0.4}, {"geburtsdatum", -0.4}, {"printed", -0.2},
+		{"period", -0.1}, {"from", -0.1}, {"to", -0.05}, {"until", -0.15}, {"bis", -0.1},
+	}
+	sort.SliceStable(k, func(i, j int) bool { return len(k[i].word) > len(k[j].word) })
+	return k
+}()
+
+type keyword struct {
+	word  string
+	score float64
+}
+
+// keywordWindow is how far before a date, on its line, a keyword is looked for.
+const keywordWindow = 40
+
+type match struct {
+	date      time.Time
+	pos, end  int
+	ambiguous bool
+}
+
+// Find returns the dates in text, most likely document date first.
+func Find(text string, opts Options) []Candidate {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	found := matches(text, opts, now)
+
+	// each date's best-scoring occurrence, in order of first appearance
+	seen := map[string]int{}
+	count := map[string]int{}
+	var out []Candidate
+	for _, f := range found {
+		c := score(text, f, now)
+		count[c.Date]++
+		if i, ok := seen[c.Date]; !ok {
+			seen[c.Date] = len(out)
+			out = append(out, c)
+		} else if c.Confidence > out[i].Confidence {
+			out[i] = c
+		}
+	}
+	for i := range out {
+		if n := count[out[i].Date]; n > 1 {
+			// repeated dates count for a little more
+			out[i].Confidence = min(out[i].Confidence+0.05*float64(min(n-1, 3)), 0.95)
+			out[i].Reason += fmt.Sprintf(", appears %d times", n)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Confidence > out[j].Confidence })
+	return out[:min(len(out), maxCandidates)]
+}
+
+// Spans returns the byte offsets [start, end) of each place date, as
+// YYYY-MM-DD, is written in text in any of the forms Find reads.
+func Spans(text, date string, opts Options) [][2]int {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var out [][2]int
+	for _, f := range matches(text, opts, now) {
+		if f.date.Format("2006-01-02") == date {
+			out = append(out, [2]int{f.pos, f.end})
+		}
+	}
+	return out
+}
+
+// Parse reads s, a date on its own in any of the forms Find reads, such as
+// "3rd March 2024", "March 3, 2024" or "03/04/2024" (day first unless
+// opts.MonthFirst), and returns it as YYYY-MM-DD.
+func Parse(s string, opts Options) (string, bool) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	s = strings.TrimSpace(s)
+	for _, f := range matches(s, opts, now) {
+		if f.pos == 0 && f.end == len(s) {
+			return f.date.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
+
+// matches returns every date in text, in order.
+func matches(text string, opts Options, now time.Time) []match {
+	var found []match
+	add := func(pos, end, y, m, d int, ambiguous bool) {
+		if y < 100 {
+			y += 2000
+			if y > now.Year()+1 {
+				y -= 100
+			}
+		}
+		t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+		if m < 1 || m > 12 || d < 1 || t.Day() != d {
+			return
+		}
+		for _, f := range found {
+			if f.pos == pos {
+				return // already matched by an earlier form
+			}
+		}
+		found = append(found, match{date: t, pos: pos, end: end, ambiguous: ambiguous})
+	}
+
+	for _, loc := range isoDate.FindAllStringSubmatchIndex(text, -1) {
+		add(loc[0], loc[1], atoi(text, loc, 1), atoi(text, loc, 2), atoi(text, loc, 3), false)
+	}
+	for _, loc := range numericDate.FindAllStringSubmatchIndex(text, -1) {
+		a, b, y := atoi(text, loc, 1), atoi(text, loc, 2), atoi(text, loc, 3)
+		d, m, ambiguous := a, b, a <= 12 && b <= 12 && a != b
+		if b > 12 || a <= 12 && b <= 12 && opts.MonthFirst {
+			d, m = b, a
+		}
+		add(loc[0], loc[1], y, m, d, ambiguous)
+	}
+	for _, loc := range dayMonth.FindAllStringSubmatchIndex(text, -1) {
+		if m, ok := months[strings.ToLower(text[loc[4]:loc[5]])]; ok {
+			add(loc[0], loc[1], atoi(text, loc, 3), m, atoi(text, loc, 1), false)
+		}
+	}
+	for _, loc := range monthDay.FindAllStringSubmatchIndex(text, -1) {
+		if m, ok := months[strings.ToLower(text[loc[2]:loc[3]])]; ok {
+			add(loc[0], loc[1], atoi(text, loc, 3), m, atoi(text, loc, 2), false)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].pos < found[j].pos })
+	return found
+}
+
+func score(text string, f match, now time.Time) Candidate {
+	c := Candidate{Date: f.date.Format("2006-01-02"), Label: "date", Confidence: 0.4}
+	var why []string
+
+	line := text[max(0, f.pos-keywordWindow):f.pos]
+	if i := strings.LastIndexByte(line, '\n'); i >= 0 {
+		line = line[i+1:]
+	}
+	line = strings.ToLower(line)
+	best, bestEnd := keyword{}, -1
+	for _, k := range keywords {
+		// the keyword nearest the date wins, and of those ending at the
+		// same place the longest ("due date" over "date")
+		if i := lastWord(line, k.word); i >= 0 && i+len(k.word) > bestEnd {
+			best, bestEnd = k, i+len(k.word)
+		}
+	}
+	if bestEnd >= 0 {
+		c.Confidence += best.score
+		why = append(why, fmt.Sprintf("after %q", best.word))
+		if best.score > 0 {
+			c.Label = best.word
+		} else {
+			c.Label = best.word + " date"
+		}
+	}
+	if f.pos < len(text)/5 {
+		c.Confidence += 0.1
+		why = append(why, "near the top")
+	}
+	if f.ambiguous {
+		c.Confidence -= 0.1
+		why = append(why, "day and month ambiguous")
+	}
+	if f.date.After(now.AddDate(0, 0, 1)) {
+		c.Confidence -= 0.3
+		why = append(why, "in the future")
+	} else if f.date.Before(now.AddDate(-20, 0, 0)) {
+		c.Confidence -= 0.3
+		why = append(why, "over 20 years ago")
+	}
+	c.Confidence = min(max(c.Confidence, 0.05), 0.95)
+	if len(why) == 0 {
+		why = append(why, "found in the text")
+	}
+	c.Reason = strings.Join(why, ", ")
+	return c
+}
+
+// lastWord returns the index of the last whole-word occurrence of w in s,
+// or -1.
+func lastWord(s, w string) int {
+	for end := len(s); ; {
+		i := strings.LastIndex(s[:end], w)
+		if i < 0 {
+			return -1
+		}
+		j := i + len(w)
+		if (i == 0 || !isLetter(s[i-1])) && (j == len(s) || !isLetter(s[j])) {
+			return i
+		}
+		end = i
+	}
+}
+
+func isLetter(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+func atoi(s string, loc []int, group int) int {
+	n, _ := strconv.Atoi(s[loc[2*group]:loc[2*group+1]])
+	return n
+}
@@ -0,0 +1,132 @@
+// Package errs sorts the errors a request can end in into a few kinds, so a
+// handler can tell the user what went wrong and whether trying again may
+// help, rather than logging the error and redirecting as if nothing
+// happened.
+//
+//	if err := client.AddTag(ulid, id); err != nil {
+//		return errs.E(errs.Upstream, "tag bank.pdf", err)
+//	}
+//	...
+//	errs.Message(err)  // "tag bank.pdf: godocs returned 500: ..."
+//	errs.Guidance(err) // "godocs did not answer. Check it is running, then retry."
+package errs
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Kind is the category of an error.
+type Kind int
+
+const (
+	Other      Kind = iota
+	Upstream        // godocs or another server failed or could not be reached
+	Validation      // the request itself was wrong; retrying it will not help
+	Pipeline        // OCR, the LLM or another local processing step failed
+	Conflict        // the document changed elsewhere since the page was shown
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Upstream:
+		return "upstream"
+	case Validation:
+		return "validation"
+	case Pipeline:
+		return "pipeline"
+	case Conflict:
+		return "conflict"
+	}
+	return "error"
+}
+
+// maxMessage bounds Message, as upstream errors can carry a whole response
+// body.
+const maxMessage = 300
+
+// Error is an error of a known kind from operation Op.
+type Error struct {
+	Kind Kind
+	Op   string // what was being done, e.g. "tag bank.pdf"
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// E wraps err as kind, or returns nil if err is nil.
+func E(kind Kind, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Op: op, Err: err}
+}
+
+// New returns an error of kind with message msg.
+func New(kind Kind, op, msg string) error {
+	return &Error{Kind: kind, Op: op, Err: errors.New(msg)}
+}
+
+// KindOf returns the kind of the outermost Error in err's chain, or Other.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Other
+}
+
+// Retryable reports whether the same request may succeed if tried again.
+func Retryable(err error) bool {
+	k := KindOf(err)
+	return k == Upstream || k == Pipeline
+}
+
+// Status is the HTTP status to answer a failed request with.
+func Status(err error) int {
+	switch KindOf(err) {
+	case Upstream:
+		return http.StatusBadGateway
+	case Validation:
+		return http.StatusBadRequest
+	case Conflict:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// Guidance tells the user what to do about err.
+func Guidance(err error) string {
+	switch KindOf(err) {
+	case Upstream:
+		return "godocs did not answer. Check it is running, then retry."
+	case Validation:
+		return "Correct the input and submit it again."
+	case Pipeline:
+		return "Processing failed. Check OCR and the LLM on the About page, then retry."
+	case Conflict:
+		return "Reload the page to see the document as it is now."
+	}
+	return "Retry, or check the server log."
+}
+
+// Message is err's text on one line, cut to a length fit for a page.
+func Message(err error) string {
+	msg := strings.Join(strings.Fields(err.Error()), " ")
+	if len(msg) > maxMessage {
+		cut := maxMessage
+		for cut > 0 && msg[cut]&0xC0 == 0x80 { // don't split a UTF-8 sequence
+			cut--
+		}
+		msg = msg[:cut] + "…"
+	}
+	return msg
+}
@@ -0,0 +1,596 @@
+// Package godoctest is an in-memory fake of the godocs API for tests. It
+// implements the part of the API godocs-inbox uses: tags and tag groups,
+// the untagged and per-tag document lists, document status, text and
+// thumbnails, adding and removing tags, moving, deleting, downloading and
+// uploading documents, and the server version. Uploads are given the ULIDs
+// 01UPLOAD1, 01UPLOAD2...
+//
+//	gd := godoctest.NewServer(t)
+//	gd.AddTag(godoctest.Tag{ID: 1, Name: "letters", TagGroup: "Type"})
+//	gd.AddDoc(godoctest.Doc{ULID: "01A", Name: "bank.pdf", Text: "..."})
+//	// point the client at gd.URL, then check gd.DocTags("01A")
+package godoctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tag is a godocs tag.
+type Tag struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Color     string `json:"color"`
+	TagGroup  string `json:"tag_group"`
+	SortOrder int    `json:"sort_order"`
+}
+
+// Doc is a document held by the fake. Type defaults to the extension of
+// Name and Content to a placeholder; a document with no Text reports
+// hasText false and 404s on its text, as godocs does before OCR.
+type Doc struct {
+	ULID        string
+	Name        string
+	Type        string // e.g. ".pdf"
+	Folder      string
+	IngressTime string
+	Date        string
+	Text        string
+	Content     []byte
+	Tags        []int
+}
+
+// Server is a running fake godocs. URL is its base address.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	tags     []Tag
+	docs     []*Doc // in ingress order
+	failTags map[int]bool
+	uploads  int
+	version  string
+	api      int // API version; 0 for a godocs too old to report it
+}
+
+// NewServer starts a fake godocs with no tags or documents. It is closed
+// when the test ends.
+func NewServer(tb testing.TB) *Server {
+	s := &Server{failTags: make(map[int]bool), version: "test", api: 1}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/version", s.handleVersion)
+	mux.HandleFunc("GET /api/tags", s.handleTags)
+	mux.HandleFunc("GET /api/tags/groups", s.handleTagGroups)
+	mux.HandleFunc("POST /api/tags", s.handleCreateTag)
+	mux.HandleFunc("DELETE /api/tags/{id}", s.handleDeleteTag)
+	mux.HandleFunc("GET /api/documents/untagged", s.handleUntagged)
+	mux.HandleFunc("GET /api/search", s.handleSearch)
+	mux.HandleFunc("GET /api/document/{ulid}/status", s.handleStatus)
+	mux.HandleFunc("GET /api/document/{ulid}/text", s.handleText)
+	mux.HandleFunc("PUT /api/document/{ulid}/text", s.handleSetText)
+	mux.HandleFunc("GET /api/document/{ulid}/thumbnail", s.handleThumbnail)
+	mux.HandleFunc("GET /api/documents/{ulid}/{list}", s.handleDocuments)
+	mux.HandleFunc("POST /api/documents/{ulid}/tags", s.handleAddTag)
+	mux.HandleFunc("DELETE /api/documents/{ulid}/tags/{id}", s.handleRemoveTag)
+	mux.HandleFunc("PUT /api/document/{ulid}/folder", s.handleMove)
+	mux.HandleFunc("PUT /api/document/{ulid}/date", s.handleDate)
+	mux.HandleFunc("DELETE /api/document/{ulid}", s.handleDelete)
+	mux.HandleFunc("GET /document/view/{ulid}", s.handleDownload)
+	mux.HandleFunc("POST /api/document/upload", s.handleUpload)
+	s.Server = httptest.NewServer(mux)
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// AddTag adds a tag to the server.
+func (s *Server) AddTag(t Tag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tags = append(s.tags, t)
+}
+
+// AddDoc adds a document to the server.
+func (s *Server) AddDoc(d Doc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d.Type == "" {
+		d.Type = path.Ext(d.Name)
+	}
+	if d.Content == nil {
+		d.Content = []byte("%PDF-1.4 godoctest " + d.ULID)
+	}
+	d.Tags = slices.Clone(d.Tags)
+	s.docs = append(s.docs, &d)
+}
+
+// DocTags returns the IDs of the tags on a document, in the order they
+// were added, or nil if it has none or does not exist.
+func (s *Server) DocTags(ulid string) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.doc(ulid); d != nil {
+		return slices.Clone(d.Tags)
+	}
+	return nil
+}
+
+// DocFolder returns the folder a document is in, and whether it exists.
+func (s *Server) DocFolder(ulid string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.doc(ulid); d != nil {
+		return d.Folder, true
+	}
+	return "", false
+}
+
+// DocDate returns a document's date, and whether it exists.
+func (s *Server) DocDate(ulid string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.doc(ulid); d != nil {
+		return d.Date, true
+	}
+	return "", false
+}
+
+// DocText returns a document's text, and whether it exists.
+func (s *Server) DocText(ulid string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.doc(ulid); d != nil {
+		return d.Text, true
+	}
+	return "", false
+}
+
+// SetVersion changes the version the server reports (by default "test",
+// API version 1). An API version of 0 makes /api/version 404, as on a
+// godocs that predates it.
+func (s *Server) SetVersion(version string, api int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version, s.api = version, api
+}
+
+// DocContent returns a document's file, and whether it exists.
+func (s *Server) DocContent(ulid string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.doc(ulid); d != nil {
+		return slices.Clone(d.Content), true
+	}
+	return nil, false
+}
+
+// AddDocTag tags a document directly, as another godocs client would.
+func (s *Server) AddDocTag(ulid string, id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.doc(ulid); d != nil && !slices.Contains(d.Tags, id) {
+		d.Tags = append(d.Tags, id)
+	}
+}
+
+// FailTag makes adding tag id to any document fail with a 500, to test
+// partial failures.
+func (s *Server) FailTag(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failTags[id] = true
+}
+
+// FixTag undoes FailTag.
+func (s *Server) FixTag(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failTags, id)
+}
+
+// doc finds a document by ULID. Callers must hold s.mu.
+func (s *Server) doc(ulid string) *Doc {
+	for _, d := range s.docs {
+		if d.ULID == ulid {
+			return d
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+}
+
+// document is the search-result form of a Doc.
+type document struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	Folder       string `json:"folder"`
+	ULID         string `json:"ulid"`
+	DocumentType string `json:"document_type"`
+	IngressTime  string `json:"ingress_time"`
+}
+
+type searchResponse struct {
+	Documents  []document `json:"documents"`
+	Page       int        `json:"page"`
+	PageSize   int        `json:"pageSize"`
+	TotalCount int        `json:"totalCount"`
+	TotalPages int        `json:"totalPages"`
+	HasNext    bool       `json:"hasNext"`
+}
+
+// search returns the page the request asks for of the documents matching
+// keep; without a pageSize, all of them as one page. Callers must hold s.mu.
+func (s *Server) search(r *http.Request, keep func(*Doc) bool) searchResponse {
+	var docs []document
+	for i, d := range s.docs {
+		if keep(d) {
+			docs = append(docs, document{
+				ID: i + 1, Name: d.Name, Path: "/documents/" + d.Name, Folder: d.Folder,
+				ULID: d.ULID, DocumentType: d.Type, IngressTime: d.IngressTime,
+			})
+		}
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	size, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	page = max(page, 1)
+	if size <= 0 {
+		size = max(len(docs), 1)
+	}
+	resp := searchResponse{Documents: []document{}, Page: page, PageSize: size, TotalCount: len(docs)}
+	resp.TotalPages = max((len(docs)+size-1)/size, 1)
+	if start := (page - 1) * size; start < len(docs) {
+		resp.Documents = append(resp.Documents, docs[start:min(start+size, len(docs))]...)
+	}
+	resp.HasNext = page < resp.TotalPages
+	return resp
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.api == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"version": s.version, "api_version": s.api})
+}
+
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, append([]Tag{}, s.tags...))
+}
+
+func (s *Server) handleTagGroups(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := []string{}
+	for _, t := range s.tags {
+		if t.TagGroup != "" && !slices.Contains(groups, t.TagGroup) {
+			groups = append(groups, t.TagGroup)
+		}
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// handleCreateTag adds a tag with the next free ID.
+func (s *Server) handleCreateTag(w http.ResponseWriter, r *http.Request) {
+	var t Tag
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil || t.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name required"})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.tags {
+		t.ID = max(t.ID, existing.ID)
+	}
+	t.ID++
+	s.tags = append(s.tags, t)
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// handleDeleteTag deletes a tag and takes it off every document.
+func (s *Server) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		notFound(w)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.tags)
+	s.tags = slices.DeleteFunc(s.tags, func(t Tag) bool { return t.ID == id })
+	if len(s.tags) == n {
+		notFound(w)
+		return
+	}
+	for _, d := range s.docs {
+		d.Tags = slices.DeleteFunc(d.Tags, func(t int) bool { return t == id })
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleUntagged(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.search(r, func(d *Doc) bool { return len(d.Tags) == 0 }))
+}
+
+// handleSearch matches the term against names and text, ignoring case.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	term := strings.ToLower(r.URL.Query().Get("term"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.search(r, func(d *Doc) bool {
+		return strings.Contains(strings.ToLower(d.Name), term) || strings.Contains(strings.ToLower(d.Text), term)
+	}))
+}
+
+// handleDocuments serves /api/documents/tag/{id} and
+// /api/documents/{ulid}/tags, whose patterns overlap.
+func (s *Server) handleDocuments(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.PathValue("ulid") == "tag":
+		s.handleTagged(w, r, r.PathValue("list"))
+	case r.PathValue("list") == "tags":
+		s.handleDocTags(w, r)
+	default:
+		notFound(w)
+	}
+}
+
+func (s *Server) handleTagged(w http.ResponseWriter, r *http.Request, tagID string) {
+	id, err := strconv.Atoi(tagID)
+	if err != nil {
+		notFound(w)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.search(r, func(d *Doc) bool { return slices.Contains(d.Tags, id) }))
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ulid":          d.ULID,
+		"name":          d.Name,
+		"path":          "/documents/" + d.Name,
+		"documentType":  d.Type,
+		"hasThumbnail":  false,
+		"hasText":       d.Text != "",
+		"textLength":    len(d.Text),
+		"textURL":       "/api/document/" + d.ULID + "/text",
+		"viewURL":       "/document/view/" + d.ULID,
+		"ingressTime":   d.IngressTime,
+		"fileExists":    true,
+		"fileSizeBytes": len(d.Content),
+		"tagCount":      len(d.Tags),
+		"documentDate":  d.Date,
+	})
+}
+
+func (s *Server) handleText(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil || d.Text == "" {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"text": d.Text})
+}
+
+// thumbnailPNG is a 1x1 PNG served as every document's thumbnail.
+var thumbnailPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\x00\x01\x00\x00\x05\x00\x01\r\n-\xb4\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func (s *Server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.doc(r.PathValue("ulid")) == nil {
+		notFound(w)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(thumbnailPNG)
+}
+
+func (s *Server) handleDocTags(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil {
+		notFound(w)
+		return
+	}
+	// godocs sends null rather than [] for a document with no tags
+	var tags []Tag
+	for _, id := range d.Tags {
+		for _, t := range s.tags {
+			if t.ID == id {
+				tags = append(tags, t)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+func (s *Server) handleAddTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TagID int `json:"tag_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil {
+		notFound(w)
+		return
+	}
+	if s.failTags[req.TagID] {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("tag %d failed", req.TagID)})
+		return
+	}
+	if !slices.ContainsFunc(s.tags, func(t Tag) bool { return t.ID == req.TagID }) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("no tag %d", req.TagID)})
+		return
+	}
+	if !slices.Contains(d.Tags, req.TagID) {
+		d.Tags = append(d.Tags, req.TagID)
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleRemoveTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		notFound(w)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil {
+		notFound(w)
+		return
+	}
+	d.Tags = slices.DeleteFunc(d.Tags, func(t int) bool { return t == id })
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleMove(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Folder string `json:"folder"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil {
+		notFound(w)
+		return
+	}
+	d.Folder = req.Folder
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleDate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Date string `json:"date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil {
+		notFound(w)
+		return
+	}
+	d.Date = req.Date
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleSetText(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil {
+		notFound(w)
+		return
+	}
+	d.Text = req.Text
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// handleUpload adds the uploaded file as a new document with no text.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	f, hdr, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads++
+	d := &Doc{
+		ULID: fmt.Sprintf("01UPLOAD%d", s.uploads), Name: hdr.Filename, Type: path.Ext(hdr.Filename),
+		IngressTime: time.Now().UTC().Format(time.RFC3339), Content: content,
+	}
+	s.docs = append(s.docs, d)
+	writeJSON(w, http.StatusOK, document{
+		ID: len(s.docs), Name: d.Name, Path: "/documents/" + d.Name, ULID: d.ULID,
+		DocumentType: d.Type, IngressTime: d.IngressTime,
+	})
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.docs)
+	s.docs = slices.DeleteFunc(s.docs, func(d *Doc) bool { return d.ULID == r.PathValue("ulid") })
+	if len(s.docs) == n {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(r.PathValue("ulid"))
+	if d == nil {
+		notFound(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(d.Content)
+}
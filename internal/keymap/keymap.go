@@ -0,0 +1,102 @@
+// Package keymap resolves single keys and two-key chords (e.g. "f b") to
+// actions. The same keymap drives the inbox page's key handling and the
+// server-side lookup of submitted keys.
+package keymap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is what a binding triggers.
+type Kind string
+
+const (
+	Reserved Kind = "reserved" // built-in action such as done or undo
+	Shortcut Kind = "shortcut" // apply one tag
+	Preset   Kind = "preset"   // apply a named tag set
+)
+
+// Binding maps a key sequence to an action. Index is the position of the
+// shortcut or preset in its config list.
+type Binding struct {
+	Keys  string `json:"keys"`
+	Label string `json:"label"`
+	Kind  Kind   `json:"kind"`
+	Index int    `json:"index"`
+}
+
+// Second returns the second key of a chord, or "" for a single key.
+func (b Binding) Second() string {
+	_, second, _ := strings.Cut(b.Keys, " ")
+	return second
+}
+
+// Keymap holds bindings in the order they were added.
+type Keymap struct {
+	bindings map[string]Binding
+	prefixes map[string][]Binding // first key → chords starting with it
+	order    []string
+}
+
+func New() *Keymap {
+	return &Keymap{bindings: make(map[string]Binding), prefixes: make(map[string][]Binding)}
+}
+
+// Normalize canonicalises a key sequence: "f  b" and " f b" become "f b".
+func Normalize(keys string) string {
+	return strings.Join(strings.Fields(keys), " ")
+}
+
+// Add registers a binding. It fails if the sequence is empty or longer than
+// two keys, is already bound, or would make a key both an action and a chord
+// prefix. Failed bindings are not added.
+func (km *Keymap) Add(keys, label string, kind Kind, index int) error {
+	keys = Normalize(keys)
+	parts := strings.Fields(keys)
+	switch {
+	case len(parts) == 0:
+		return fmt.Errorf("%s %q has no key", kind, label)
+	case len(parts) > 2:
+		return fmt.Errorf("%s %q: key %q has more than two keys", kind, label, keys)
+	}
+	if prev, ok := km.bindings[keys]; ok {
+		return fmt.Errorf("%s %q: key %q is already bound to %s %q", kind, label, keys, prev.Kind, prev.Label)
+	}
+	if len(parts) == 1 {
+		if chords := km.prefixes[keys]; len(chords) > 0 {
+			return fmt.Errorf("%s %q: key %q is the prefix of chord %q", kind, label, keys, chords[0].Keys)
+		}
+	} else if prev, ok := km.bindings[parts[0]]; ok {
+		return fmt.Errorf("%s %q: chord %q starts with %q, which is bound to %s %q", kind, label, keys, parts[0], prev.Kind, prev.Label)
+	}
+
+	b := Binding{Keys: keys, Label: label, Kind: kind, Index: index}
+	km.bindings[keys] = b
+	km.order = append(km.order, keys)
+	if len(parts) == 2 {
+		km.prefixes[parts[0]] = append(km.prefixes[parts[0]], b)
+	}
+	return nil
+}
+
+// Lookup finds the binding for a key sequence.
+func (km *Keymap) Lookup(keys string) (Binding, bool) {
+	b, ok := km.bindings[Normalize(keys)]
+	return b, ok
+}
+
+// Chords returns the chord bindings grouped by their first key, for the
+// on-screen hint shown after a prefix is pressed.
+func (km *Keymap) Chords() map[string][]Binding {
+	return km.prefixes
+}
+
+// Bindings returns every binding in the order added.
+func (km *Keymap) Bindings() []Binding {
+	out := make([]Binding, 0, len(km.order))
+	for _, k := range km.order {
+		out = append(out, km.bindings[k])
+	}
+	return out
+}
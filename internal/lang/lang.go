@@ -0,0 +1,77 @@
+// Package lang guesses the language of OCR text from the share of its words
+// that are common function words ("the", "und", "les", ...) of each
+// language. It needs no model and is reliable from a few dozen words.
+package lang
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minWords is the fewest words Detect will judge.
+const minWords = 20
+
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "for", "that", "with", "this", "on", "you", "your", "are", "be", "from", "by", "have", "will", "at", "not", "we", "our"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "den", "von", "mit", "sie", "ich", "für", "auf", "dem", "des", "ein", "eine", "zu", "bei", "wir", "ihre", "im", "oder"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "pour", "dans", "que", "qui", "vous", "pas", "sur", "au", "du", "avec", "votre", "nous", "ce", "sont", "par", "aux"},
+	"es": {"el", "la", "los", "las", "y", "que", "del", "en", "es", "por", "para", "con", "una", "su", "al", "como", "más", "sus", "usted", "se", "este", "le", "está"},
+	"it": {"il", "di", "che", "la", "e", "per", "non", "una", "sono", "della", "del", "le", "con", "gli", "alla", "nel", "questo", "suo", "dei", "ha", "al", "si", "più"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "voor", "met", "zijn", "u", "uw", "wij", "ook", "aan", "bij", "naar", "heeft", "er", "dit"},
+	"pt": {"o", "os", "as", "e", "do", "da", "dos", "das", "não", "em", "um", "uma", "para", "com", "que", "por", "seu", "sua", "no", "na", "mais", "são", "ao"},
+	"sv": {"och", "att", "det", "som", "är", "en", "på", "för", "av", "med", "till", "inte", "har", "den", "ett", "om", "vi", "du", "era", "ni", "från", "kan", "eller"},
+	"da": {"og", "at", "det", "som", "er", "en", "på", "for", "af", "med", "til", "ikke", "har", "den", "et", "om", "vi", "du", "jeres", "fra", "kan", "eller", "de"},
+	"pl": {"i", "w", "nie", "na", "się", "z", "do", "jest", "że", "to", "o", "od", "za", "po", "przez", "dla", "oraz", "jak", "ze", "lub", "pan", "są", "przy"},
+}
+
+var names = map[string]string{
+	"en": "English", "de": "German", "fr": "French", "es": "Spanish", "it": "Italian",
+	"nl": "Dutch", "pt": "Portuguese", "sv": "Swedish", "da": "Danish", "pl": "Polish",
+}
+
+var index = func() map[string][]string {
+	idx := make(map[string][]string)
+	for code, words := range stopwords {
+		for _, w := range words {
+			idx[w] = append(idx[w], code)
+		}
+	}
+	return idx
+}()
+
+// Detect returns the ISO 639-1 code of the language text is most likely
+// written in and the share of the text's words that are that language's
+// stopwords, or "" if the text is too short or matches no language.
+func Detect(text string) (string, float64) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) < minWords {
+		return "", 0
+	}
+	hits := make(map[string]int)
+	for _, w := range words {
+		for _, code := range index[w] {
+			hits[code]++
+		}
+	}
+	best, bestHits := "", 0
+	for code, n := range hits {
+		if n > bestHits || n == bestHits && code < best {
+			best, bestHits = code, n
+		}
+	}
+	share := float64(bestHits) / float64(len(words))
+	if share < 0.05 {
+		return "", share
+	}
+	return best, share
+}
+
+// Name returns the English name of a language code, or the code itself.
+func Name(code string) string {
+	if n, ok := names[code]; ok {
+		return n
+	}
+	return code
+}
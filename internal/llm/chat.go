@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Message is one turn of a chat: role is "system", "user" or "assistant".
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Chat streams a model's reply to a conversation, calling onToken with
+// each piece of text as it arrives. It stops when ctx is cancelled or
+// onToken returns an error.
+func Chat(ctx context.Context, m Model, messages []Message, onToken func(string) error) error {
+	if m.Remote {
+		return chatRemote(ctx, m, messages, onToken)
+	}
+	body, err := json.Marshal(map[string]any{"model": m.Name, "messages": messages, "stream": true})
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	resp, err := postStream(ctx, m.URL+"/api/chat", "", body)
+	if err != nil {
+		return fmt.Errorf("ollama request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrModelNotFound, m.Name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	}
+
+	// Ollama streams one JSON object per line
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk struct {
+			Message         Message `json:"message"`
+			Done            bool    `json:"done"`
+			Error           string  `json:"error"`
+			PromptEvalCount int     `json:"prompt_eval_count"` // on the last chunk
+			EvalCount       int     `json:"eval_count"`
+		}
+		if err := dec.Decode(&chunk); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("decoding ollama stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			if err := onToken(chunk.Message.Content); err != nil {
+				return err
+			}
+		}
+		if chunk.Done {
+			m.report(start, chunk.PromptEvalCount, chunk.EvalCount)
+			return nil
+		}
+	}
+}
+
+// chatRemote streams a reply from an OpenAI-compatible provider, which
+// sends server-sent events of completion deltas ending with "[DONE]". The
+// token usage comes in a last event without choices.
+func chatRemote(ctx context.Context, m Model, messages []Message, onToken func(string) error) error {
+	body, err := json.Marshal(map[string]any{"model": m.Name, "messages": messages, "stream": true, "stream_options": map[string]bool{"include_usage": true}})
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	var usage chatUsage
+	resp, err := postStream(ctx, m.URL+"/chat/completions", m.APIKey, body)
+	if err != nil {
+		return fmt.Errorf("remote LLM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote LLM returned status %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			m.report(start, usage.PromptTokens, usage.CompletionTokens)
+			return nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta Message `json:"delta"`
+			} `json:"choices"`
+			Usage *chatUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decoding remote LLM stream: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content != "" {
+				if err := onToken(c.Delta.Content); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return sc.Err()
+}
+
+// postStream posts JSON for a streamed response. Streams have no overall
+// timeout; ctx ends them.
+func postStream(ctx context.Context, url, apiKey string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return http.DefaultClient.Do(req)
+}
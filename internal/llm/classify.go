@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Classification is the predicted document type and the model's confidence (0–1).
+type Classification struct {
+	Type       string  `json:"type"`
+	Confidence float64 `json:"confidence"`
+}
+
+// ClassifyType asks an LLM to label vars.Text with one of vars.Types.
+// Returns nil if the model picks nothing from the taxonomy.
+func ClassifyType(m Model, p Prompts, vars PromptVars) (*Classification, error) {
+	types := vars.Types
+	if len(vars.Text) > 2000 {
+		vars.Text = vars.Text[:2000]
+	}
+	prompt, err := p.Render(PromptClassify, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	format := object([]string{"type", "confidence"}, map[string]any{
+		"type":       map[string]any{"type": "string", "enum": append(slices.Clone(types), "none")},
+		"confidence": confidenceProperty,
+	})
+	var c Classification
+	if err := generateJSON(m, prompt, format, &c); err != nil {
+		return nil, fmt.Errorf("classification: %w", err)
+	}
+	for _, t := range types {
+		if strings.EqualFold(strings.TrimSpace(c.Type), t) {
+			c.Type = t
+			c.Confidence = min(max(c.Confidence, 0), 1)
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
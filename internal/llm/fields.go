@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fields are bookkeeping details extracted from a receipt or invoice.
+type Fields struct {
+	Amount   string `json:"amount"`   // total as a decimal with two places, e.g. "12.50"
+	Currency string `json:"currency"` // ISO 4217 code, empty if not stated
+	Vendor   string `json:"vendor"`
+	Date     string `json:"date"` // YYYY-MM-DD, empty if not found
+}
+
+var fieldsSchema = object([]string{"amount", "currency", "vendor", "date"}, map[string]any{
+	"amount":   map[string]any{"type": "string", "description": "total amount paid as a plain number, or empty"},
+	"currency": map[string]any{"type": "string"},
+	"vendor":   map[string]any{"type": "string"},
+	"date":     map[string]any{"type": "string", "description": "YYYY-MM-DD or empty"},
+})
+
+// ExtractFields asks an LLM for the total amount, currency, vendor and date of
+// a receipt or invoice. Returns nil if no amount can be found.
+func ExtractFields(m Model, p Prompts, vars PromptVars) (*Fields, error) {
+	if len(vars.Text) > 3000 {
+		vars.Text = vars.Text[:3000]
+	}
+	prompt, err := p.Render(PromptFields, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		Amount   any    `json:"amount"`
+		Currency string `json:"currency"`
+		Vendor   string `json:"vendor"`
+		Date     string `json:"date"`
+	}
+	if err := generateJSON(m, prompt, fieldsSchema, &raw); err != nil {
+		return nil, fmt.Errorf("fields: %w", err)
+	}
+	amount, ok := parseAmount(fmt.Sprint(raw.Amount))
+	if !ok {
+		return nil, nil
+	}
+	f := &Fields{
+		Amount:   amount,
+		Currency: strings.ToUpper(strings.TrimSpace(raw.Currency)),
+		Vendor:   strings.TrimSpace(raw.Vendor),
+	}
+	if len(f.Currency) != 3 {
+		f.Currency = ""
+	}
+	f.Date, _ = vars.parseDate(raw.Date)
+	return f, nil
+}
+
+// parseAmount normalises "£1,234.5" or 1234.5 to "1234.50".
+func parseAmount(s string) (string, bool) {
+	s = strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, s)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v == 0 {
+		return "", false
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64), true
+}
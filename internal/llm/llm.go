@@ -3,52 +3,187 @@ package llm
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/datefind"
 )
 
 type ollamaRequest struct {
 	Model  string `json:"model"`
 	Prompt string `json:"prompt"`
 	Stream bool   `json:"stream"`
+	Format any    `json:"format,omitempty"` // "json" or a JSON schema object
 }
 
 type ollamaResponse struct {
-	Response string `json:"response"`
+	Response        string `json:"response"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+// ErrBadResponse is returned, wrapped, when a model's answer does not match
+// the schema it was given. The request can be retried.
+var ErrBadResponse = errors.New("malformed model response")
+
+// ErrModelNotFound is returned, wrapped, when Ollama has not pulled a model.
+var ErrModelNotFound = errors.New("model not found")
+
+// Model is an LLM a task runs on: an Ollama model, or with Remote set a
+// model of an OpenAI-compatible provider (see remote.go).
+type Model struct {
+	Name    string
+	URL     string // Ollama base URL, or the provider's API base
+	APIKey  string // remote only
+	Remote  bool
+	OnUsage func(Usage) // if set, called after each request the model answers
+}
+
+// Usage is what one request cost: the tokens the model read and wrote, as
+// it reports them, and the wall-clock time.
+type Usage struct {
+	PromptTokens int
+	OutputTokens int
+	Duration     time.Duration
+}
+
+func (m Model) report(start time.Time, promptTokens, outputTokens int) {
+	if m.OnUsage != nil {
+		m.OnUsage(Usage{PromptTokens: promptTokens, OutputTokens: outputTokens, Duration: time.Since(start)})
+	}
 }
 
-// InferDate asks an LLM to extract a document date from the given text.
-// Returns a date string in YYYY-MM-DD format, or empty string if no date found.
-func InferDate(ollamaURL, model, text string) (string, error) {
-	if len(text) > 2000 {
-		text = text[:2000]
+func (m Model) String() string {
+	if m.Remote {
+		return "remote:" + m.Name
 	}
+	return m.Name
+}
 
-	prompt := fmt.Sprintf(`Extract the document date from the following text. The document date is the date the document was created, issued, or refers to (e.g. invoice date, letter date, statement date). Return ONLY the date in YYYY-MM-DD format. If no date can be determined, return "NONE".
+// schema is a JSON schema passed as Ollama's format parameter so the model
+// can only answer with a matching object.
+type schema map[string]any
 
-Text:
-%s
+func object(required []string, properties map[string]any) schema {
+	return schema{"type": "object", "properties": properties, "required": required}
+}
+
+// confidenceProperty is the 0–1 confidence every typed result carries.
+var confidenceProperty = map[string]any{"type": "number", "minimum": 0, "maximum": 1}
+
+// DateCandidate is a date found in a document: what the model takes it to
+// be (e.g. "statement date"), its confidence (0–1) that this is the
+// document date, and its reason.
+type DateCandidate struct {
+	Date       string  `json:"date"` // YYYY-MM-DD
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason"`
+}
+
+var dateSchema = object([]string{"candidates"}, map[string]any{
+	"candidates": map[string]any{
+		"type": "array",
+		"items": object([]string{"date", "label", "confidence", "reason"}, map[string]any{
+			"date":       map[string]any{"type": "string", "description": "YYYY-MM-DD"},
+			"label":      map[string]any{"type": "string", "description": "what the date is, e.g. statement date"},
+			"confidence": confidenceProperty,
+			"reason":     map[string]any{"type": "string"},
+		}),
+	},
+})
+
+// InferDates asks an LLM for the dates in vars.Text, ranked by how
+// likely each is to be the document date, most likely first. Returns none
+// if the model finds no date. Dates the model writes in another form, such
+// as "3 March 2026", are read as vars.DateOrder says and made YYYY-MM-DD.
+// An answer that is not valid JSON, or whose dates are all malformed, is an
+// ErrBadResponse.
+func InferDates(m Model, p Prompts, vars PromptVars) ([]DateCandidate, error) {
+	if len(vars.Text) > 2000 {
+		vars.Text = vars.Text[:2000]
+	}
+	prompt, err := p.Render(PromptDate, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var answer struct {
+		Candidates []DateCandidate `json:"candidates"`
+	}
+	if err := generateJSON(m, prompt, dateSchema, &answer); err != nil {
+		return nil, err
+	}
+	var out []DateCandidate
+	seen := make(map[string]int)
+	for _, c := range answer.Candidates {
+		date, ok := vars.parseDate(c.Date)
+		if !ok {
+			continue
+		}
+		c.Date = date
+		c.Label, c.Reason = strings.TrimSpace(c.Label), strings.TrimSpace(c.Reason)
+		c.Confidence = min(max(c.Confidence, 0), 1)
+		if i, ok := seen[c.Date]; ok {
+			if c.Confidence > out[i].Confidence {
+				out[i] = c
+			}
+			continue
+		}
+		seen[c.Date] = len(out)
+		out = append(out, c)
+	}
+	if len(out) == 0 && len(answer.Candidates) > 0 {
+		return nil, fmt.Errorf("%w: no candidate date could be read", ErrBadResponse)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Confidence > out[j].Confidence })
+	return out, nil
+}
 
-Date:`, text)
+// generateJSON runs a completion constrained to format and decodes the
+// answer into v.
+func generateJSON(m Model, prompt string, format schema, v any) error {
+	response, err := generate(m, prompt, format)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(response), v); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadResponse, err)
+	}
+	return nil
+}
 
+// generate runs a single non-streaming completion. format may be "json" or
+// a schema to constrain the model's output.
+func generate(m Model, prompt string, format any) (string, error) {
+	if m.Remote {
+		return generateRemote(m, prompt, format)
+	}
 	body, err := json.Marshal(ollamaRequest{
-		Model:  model,
+		Model:  m.Name,
 		Prompt: prompt,
 		Stream: false,
+		Format: format,
 	})
 	if err != nil {
 		return "", err
 	}
 
+	start := time.Now()
 	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Post(ollamaURL+"/api/generate", "application/json", bytes.NewReader(body))
+	resp, err := client.Post(m.URL+"/api/generate", "application/json", bytes.NewReader(body))
 	if err != nil {
 		return "", fmt.Errorf("ollama request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s", ErrModelNotFound, m.Name)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("ollama returned status %d", resp.StatusCode)
 	}
@@ -57,16 +192,53 @@ Date:`, text)
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", fmt.Errorf("decoding ollama response: %w", err)
 	}
+	m.report(start, result.PromptEvalCount, result.EvalCount)
+	return result.Response, nil
+}
+
+type ollamaModelList struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
 
-	dateStr := strings.TrimSpace(result.Response)
-	if dateStr == "" || strings.EqualFold(dateStr, "NONE") {
-		return "", nil
+// ListModels returns the models pulled into Ollama (/api/tags).
+func ListModels(ollamaURL string) ([]string, error) {
+	return fetchModelNames(ollamaURL + "/api/tags")
+}
+
+// LoadedModels returns the models currently loaded in memory (/api/ps).
+func LoadedModels(ollamaURL string) ([]string, error) {
+	return fetchModelNames(ollamaURL + "/api/ps")
+}
+
+func fetchModelNames(url string) ([]string, error) {
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("ollama request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// Validate it parses as a date
-	if _, err := time.Parse("2006-01-02", dateStr); err != nil {
-		return "", nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	}
+
+	var list ollamaModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("decoding ollama models: %w", err)
 	}
+	var names []string
+	for _, m := range list.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
 
-	return dateStr, nil
+// parseDate reads a date an LLM answered with as YYYY-MM-DD. Numeric dates
+// are read as DateOrder says.
+func (v PromptVars) parseDate(s string) (string, bool) {
+	opts := datefind.Options{MonthFirst: v.DateOrder == "mdy"}
+	opts.Now, _ = time.Parse("2006-01-02", v.Today)
+	return datefind.Parse(s, opts)
 }
@@ -0,0 +1,130 @@
+package llm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Each task's prompt is a text/template, so a deployment can reword or
+// translate it without a rebuild. Templates are executed with PromptVars;
+// the document text is truncated to the task's limit first.
+
+// PromptVars are the variables a prompt template can use.
+type PromptVars struct {
+	Text      string   // the document text
+	TagNames  []string // the names of the server's tags
+	Groups    []string // the server's tag groups
+	Today     string   // YYYY-MM-DD
+	DateOrder string   // dmy or mdy: how numeric dates such as 03/04/2026 read
+	Types     []string // classify: the document types to choose from
+	Language  string   // translate: the language to translate into
+}
+
+// Prompt task names; they match the tasks of the models config.
+const (
+	PromptDate      = "date"
+	PromptClassify  = "classify"
+	PromptFields    = "fields"
+	PromptSummary   = "summary"
+	PromptTranslate = "translate"
+	PromptChat      = "chat" // the system message of a document chat
+	PromptTags      = "tags"
+)
+
+var defaultPrompts = map[string]string{
+	PromptDate: `List the dates in the following text that could be the document date. The document date is the date the document was created, issued, or refers to (e.g. invoice date, letter date, statement date); other dates such as payment, due or print dates are candidates with lower confidence. Respond with JSON of the form {"candidates": [{"date": "<YYYY-MM-DD>", "label": "<what the date is, e.g. statement date>", "confidence": <number between 0 and 1 that this is the document date>, "reason": "<where the date comes from, in a few words>"}]}. If no date can be determined, return an empty list.
+
+Text:
+{{.Text}}`,
+	PromptClassify: `Classify the following document as exactly one of these types: {{join .Types ", "}}. Respond with JSON of the form {"type": "<one of the types>", "confidence": <number between 0 and 1>}. If none of the types fit, use "none".
+
+Text:
+{{.Text}}`,
+	PromptFields: `Extract bookkeeping fields from the following receipt or invoice. Respond with JSON of the form {"amount": "<total amount paid as a plain number>", "currency": "<ISO 4217 code or empty>", "vendor": "<who was paid>", "date": "<YYYY-MM-DD or empty>"}. Use an empty amount if there is no total.
+
+Text:
+{{.Text}}`,
+	PromptSummary: `Summarise the following document in 2-3 short sentences: what kind of document it is, who it is from, and what it is about (amounts, periods or actions needed). Respond with JSON of the form {"summary": "<summary>"}.
+
+Text:
+{{.Text}}`,
+	PromptTranslate: `Translate the following OCR text of a document into {{.Language}}. Keep the line breaks, numbers, dates and names as they are, and do not add comments. Respond with JSON of the form {"translation": "<translated text>"}.
+
+Text:
+{{.Text}}`,
+	PromptTags: `The following document is filed by tagging it. These tags exist: {{join .TagNames ", "}}. If who the document is from (its correspondent), or something else it should be filed under, has no tag among them, propose new tags for it, each in one of these tag groups where one fits: {{join .Groups ", "}}. Respond with JSON of the form {"tags": [{"name": "<short tag name>", "group": "<tag group, or empty>", "reason": "<why, in a few words>"}]}. Propose at most 3; if the existing tags are enough, return an empty list.
+
+Text:
+{{.Text}}`,
+	PromptChat: `You answer questions about a scanned document using only its text, given below. Answer briefly. If the text does not say, reply that the document does not say.
+
+Document text:
+{{.Text}}`,
+}
+
+var promptFuncs = template.FuncMap{"join": strings.Join}
+
+var builtinPrompts = func() map[string]*template.Template {
+	out := make(map[string]*template.Template, len(defaultPrompts))
+	for task, text := range defaultPrompts {
+		out[task] = template.Must(template.New(task).Funcs(promptFuncs).Parse(text))
+	}
+	return out
+}()
+
+// PromptTasks returns the tasks whose prompt can be replaced, sorted.
+func PromptTasks() []string {
+	return slices.Sorted(maps.Keys(defaultPrompts))
+}
+
+// DefaultPrompt returns the built-in template for task, or "".
+func DefaultPrompt(task string) string {
+	return defaultPrompts[task]
+}
+
+// Prompts are the prompt templates of the LLM tasks. The zero value uses
+// the built-in ones.
+type Prompts struct {
+	tmpl map[string]*template.Template
+}
+
+// ParsePrompts parses templates replacing the built-in prompts of the
+// tasks they are keyed by. Each is tried on sample variables, so a
+// misspelt variable is an error here rather than at the first document.
+func ParsePrompts(templates map[string]string) (Prompts, error) {
+	p := Prompts{tmpl: make(map[string]*template.Template)}
+	sample := PromptVars{Text: "text", TagNames: []string{"tag"}, Groups: []string{"group"}, Today: "2006-01-02", DateOrder: "dmy", Types: []string{"invoice"}, Language: "English"}
+	for task, text := range templates {
+		if _, ok := defaultPrompts[task]; !ok {
+			return Prompts{}, fmt.Errorf("prompt for unknown task %q (one of %s)", task, strings.Join(PromptTasks(), ", "))
+		}
+		t, err := template.New(task).Funcs(promptFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return Prompts{}, fmt.Errorf("%s prompt: %w", task, err)
+		}
+		if err := t.Execute(new(strings.Builder), sample); err != nil {
+			return Prompts{}, fmt.Errorf("%s prompt: %w", task, err)
+		}
+		p.tmpl[task] = t
+	}
+	return p, nil
+}
+
+// Render executes task's prompt template with vars.
+func (p Prompts) Render(task string, vars PromptVars) (string, error) {
+	t := p.tmpl[task]
+	if t == nil {
+		t = builtinPrompts[task]
+	}
+	if t == nil {
+		return "", fmt.Errorf("no prompt for task %q", task)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("%s prompt: %w", task, err)
+	}
+	return b.String(), nil
+}
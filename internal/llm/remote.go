@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Remote providers are reached through the OpenAI chat completions API,
+// which OpenAI, OpenRouter, Groq, LM Studio and vLLM all serve.
+
+type chatRequest struct {
+	Model          string    `json:"model"`
+	Messages       []Message `json:"messages"`
+	ResponseFormat any       `json:"response_format,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+	Usage chatUsage `json:"usage"`
+}
+
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// responseFormat translates an Ollama format ("json" or a schema) to the
+// chat completions response_format.
+func responseFormat(format any) any {
+	switch f := format.(type) {
+	case schema:
+		return map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": "answer", "schema": f},
+		}
+	case string:
+		if f == "json" {
+			return map[string]string{"type": "json_object"}
+		}
+	}
+	return nil
+}
+
+// generateRemote runs a single completion on a remote provider.
+func generateRemote(m Model, prompt string, format any) (string, error) {
+	body, err := json.Marshal(chatRequest{
+		Model:          m.Name,
+		Messages:       []Message{{Role: "user", Content: prompt}},
+		ResponseFormat: responseFormat(format),
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", m.URL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.APIKey)
+	}
+
+	start := time.Now()
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("remote LLM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("remote LLM returned status %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	}
+
+	var result chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decoding remote LLM response: %w", err)
+	}
+	m.report(start, result.Usage.PromptTokens, result.Usage.CompletionTokens)
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("%w: no choices", ErrBadResponse)
+	}
+	return result.Choices[0].Message.Content, nil
+}
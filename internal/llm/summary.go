@@ -0,0 +1,34 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+var summarySchema = object([]string{"summary"}, map[string]any{
+	"summary": map[string]any{"type": "string"},
+})
+
+// Summarize asks an LLM for a two or three sentence summary of a document:
+// what it is, who it is from, and what it is about.
+func Summarize(m Model, p Prompts, vars PromptVars) (string, error) {
+	if len(vars.Text) > 4000 {
+		vars.Text = vars.Text[:4000]
+	}
+	prompt, err := p.Render(PromptSummary, vars)
+	if err != nil {
+		return "", err
+	}
+
+	var answer struct {
+		Summary string `json:"summary"`
+	}
+	if err := generateJSON(m, prompt, summarySchema, &answer); err != nil {
+		return "", fmt.Errorf("summary: %w", err)
+	}
+	summary := strings.Join(strings.Fields(answer.Summary), " ")
+	if summary == "" {
+		return "", fmt.Errorf("summary: %w: empty summary", ErrBadResponse)
+	}
+	return summary, nil
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TagProposal is a tag the server lacks that an LLM would give a document,
+// such as one for a correspondent not seen before.
+type TagProposal struct {
+	Name   string `json:"name"`
+	Group  string `json:"group"` // one of PromptVars.Groups, or ""
+	Reason string `json:"reason"`
+}
+
+// maxTagProposals bounds ProposeTags' result.
+const maxTagProposals = 3
+
+var tagsSchema = object([]string{"tags"}, map[string]any{
+	"tags": map[string]any{
+		"type": "array",
+		"items": object([]string{"name", "group", "reason"}, map[string]any{
+			"name":   map[string]any{"type": "string", "description": "short tag name"},
+			"group":  map[string]any{"type": "string", "description": "tag group, or empty"},
+			"reason": map[string]any{"type": "string"},
+		}),
+	},
+})
+
+// ProposeTags asks an LLM for new tags the document should be filed under
+// that are not among vars.TagNames. Names the server has, in any case, and
+// groups not in vars.Groups are dropped.
+func ProposeTags(m Model, p Prompts, vars PromptVars) ([]TagProposal, error) {
+	if len(vars.Text) > 3000 {
+		vars.Text = vars.Text[:3000]
+	}
+	prompt, err := p.Render(PromptTags, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var answer struct {
+		Tags []TagProposal `json:"tags"`
+	}
+	if err := generateJSON(m, prompt, tagsSchema, &answer); err != nil {
+		return nil, fmt.Errorf("tags: %w", err)
+	}
+	known := func(names []string, name string) bool {
+		return slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) })
+	}
+	var out []TagProposal
+	var seen []string
+	for _, t := range answer.Tags {
+		t.Name = strings.Join(strings.Fields(t.Name), " ")
+		if t.Name == "" || known(vars.TagNames, t.Name) || known(seen, t.Name) {
+			continue
+		}
+		t.Group = strings.TrimSpace(t.Group)
+		if i := slices.IndexFunc(vars.Groups, func(g string) bool { return strings.EqualFold(g, t.Group) }); i >= 0 {
+			t.Group = vars.Groups[i]
+		} else {
+			t.Group = ""
+		}
+		t.Reason = strings.TrimSpace(t.Reason)
+		seen = append(seen, t.Name)
+		out = append(out, t)
+		if len(out) == maxTagProposals {
+			break
+		}
+	}
+	return out, nil
+}
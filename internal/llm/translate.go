@@ -0,0 +1,34 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+var translationSchema = object([]string{"translation"}, map[string]any{
+	"translation": map[string]any{"type": "string"},
+})
+
+// Translate asks an LLM to translate vars.Text into vars.Language (an
+// English language name such as "German"), keeping its line breaks.
+func Translate(m Model, p Prompts, vars PromptVars) (string, error) {
+	if len(vars.Text) > 2000 {
+		vars.Text = vars.Text[:2000]
+	}
+	prompt, err := p.Render(PromptTranslate, vars)
+	if err != nil {
+		return "", err
+	}
+
+	var answer struct {
+		Translation string `json:"translation"`
+	}
+	if err := generateJSON(m, prompt, translationSchema, &answer); err != nil {
+		return "", fmt.Errorf("translation: %w", err)
+	}
+	translation := strings.TrimSpace(answer.Translation)
+	if translation == "" {
+		return "", fmt.Errorf("translation: %w: empty translation", ErrBadResponse)
+	}
+	return translation, nil
+}
@@ -0,0 +1,122 @@
+// Package logfile is an append-only log file that rotates itself, so a
+// long-running inbox neither loses its history nor fills the disk:
+//
+//	f, err := logfile.Open("/var/log/godocs-inbox/access.log", logfile.Options{MaxSize: 10 << 20, Keep: 5})
+//	logger := log.New(f, "", log.LstdFlags)
+//
+// When a write would take the file past MaxSize, or the file is older than
+// MaxAge, it is renamed to access.log.1, older copies move up one
+// (access.log.2 and so on) and the oldest beyond Keep is deleted. Age
+// counts from when the file was started, or for a file left from an
+// earlier run, from when it was last written.
+package logfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Options bound a File. Zero MaxSize or MaxAge is no limit; zero Keep
+// keeps no rotated copies.
+type Options struct {
+	MaxSize int64
+	MaxAge  time.Duration
+	Keep    int
+}
+
+// File is a log file, safe for concurrent writes.
+type File struct {
+	path string
+	opts Options
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	started time.Time
+}
+
+// Open opens path for appending, creating it and its directory if need be.
+func Open(path string, opts Options) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	lf := &File{path: path, opts: opts}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.f, lf.size, lf.started = f, fi.Size(), time.Now()
+	if fi.Size() > 0 {
+		lf.started = fi.ModTime()
+	}
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file over its size
+// or the file is too old. A single write is never split across files.
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if lf.size > 0 && (lf.opts.MaxSize > 0 && lf.size+int64(len(p)) > lf.opts.MaxSize ||
+		lf.opts.MaxAge > 0 && time.Since(lf.started) > lf.opts.MaxAge) {
+		// a file that could not be moved is written on, and tried again
+		if err := lf.rotate(); err != nil && lf.f == nil {
+			return 0, fmt.Errorf("rotating %s: %w", lf.path, err)
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file to path.1, shifting older copies up and dropping
+// any beyond Keep, and starts a new file. If the file cannot be moved it
+// is reopened and written on.
+func (lf *File) rotate() error {
+	if err := lf.f.Close(); err != nil {
+		return err
+	}
+	lf.f = nil
+	os.Remove(fmt.Sprintf("%s.%d", lf.path, lf.opts.Keep))
+	for i := lf.opts.Keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", lf.path, i), fmt.Sprintf("%s.%d", lf.path, i+1))
+	}
+	var err error
+	if lf.opts.Keep > 0 {
+		err = os.Rename(lf.path, lf.path+".1")
+	} else {
+		err = os.Remove(lf.path)
+	}
+	return errors.Join(err, lf.open())
+}
+
+// Close closes the file; later writes fail.
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
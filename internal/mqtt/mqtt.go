@@ -0,0 +1,295 @@
+// Package mqtt is a minimal MQTT 3.1.1 client that publishes at QoS 0,
+// which is all the inbox needs to feed Home Assistant and other home
+// automation, without a dependency:
+//
+//	c := mqtt.New(mqtt.Options{Broker: "tcp://ha.local:1883", ClientID: "godocs-inbox"})
+//	err := c.Publish(mqtt.Message{Topic: "godocs-inbox/state", Payload: b, Retain: true})
+//
+// The client connects on the first Publish, pings to keep the connection
+// alive, and after a failure reconnects on the next Publish.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Options configures a Client.
+type Options struct {
+	Broker    string // tcp://host:1883, or ssl:// or mqtts:// for TLS (default port 8883)
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration // default one minute
+	TLS       *tls.Config   // for ssl:// brokers; nil for the defaults
+	Will      *Message      // published by the broker if the client goes away
+	Timeout   time.Duration // dial and write timeout; default 10 seconds
+}
+
+// Message is a PUBLISH at QoS 0.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Client publishes to one broker. It is safe for concurrent use.
+type Client struct {
+	opts Options
+	mu   sync.Mutex
+	conn net.Conn // nil when not connected
+	last time.Time
+	done chan struct{} // closed when conn is dropped
+}
+
+// New returns a client for opts; it does not connect until used.
+func New(opts Options) *Client {
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = time.Minute
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Client{opts: opts}
+}
+
+// Publish sends m, connecting first if need be.
+func (c *Client) Publish(m Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return err
+		}
+	}
+	flags := byte(0x30)
+	if m.Retain {
+		flags |= 0x01
+	}
+	if err := c.write(packet(flags, str(m.Topic), m.Payload)); err != nil {
+		return fmt.Errorf("mqtt publish %s: %w", m.Topic, err)
+	}
+	return nil
+}
+
+// Close disconnects cleanly, so the broker does not publish the will.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	if err := c.write([]byte{0xE0, 0}); err != nil {
+		return err // write has dropped the connection
+	}
+	c.drop()
+	return nil
+}
+
+// connect dials the broker and completes the CONNECT handshake. Callers
+// must hold c.mu.
+func (c *Client) connect() error {
+	u, err := url.Parse(c.opts.Broker)
+	if err != nil {
+		return fmt.Errorf("mqtt broker %q: %w", c.opts.Broker, err)
+	}
+	host := u.Host
+	useTLS := u.Scheme == "ssl" || u.Scheme == "mqtts" || u.Scheme == "tls"
+	if u.Port() == "" {
+		port := "1883"
+		if useTLS {
+			port = "8883"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: c.opts.Timeout}
+	var conn net.Conn
+	if useTLS {
+		tc := c.opts.TLS
+		if tc == nil {
+			tc = &tls.Config{}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, tc)
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+
+	flags := byte(0x02) // clean session
+	payload := [][]byte{str(c.opts.ClientID)}
+	if w := c.opts.Will; w != nil {
+		flags |= 0x04
+		if w.Retain {
+			flags |= 0x20
+		}
+		payload = append(payload, str(w.Topic), str(string(w.Payload)))
+	}
+	if c.opts.Username != "" {
+		flags |= 0x80
+		payload = append(payload, str(c.opts.Username))
+		if c.opts.Password != "" {
+			flags |= 0x40
+			payload = append(payload, str(c.opts.Password))
+		}
+	}
+	keepAlive := int(c.opts.KeepAlive / time.Second)
+	header := append(str("MQTT"), 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	conn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	if _, err := conn.Write(packet(0x10, append([][]byte{header}, payload...)...)); err != nil {
+		conn.Close()
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	typ, body, err := readPacket(r)
+	if err == nil && (typ != 0x20 || len(body) != 2) {
+		err = errors.New("expected CONNACK")
+	} else if err == nil && body[1] != 0 {
+		err = fmt.Errorf("refused (%s)", connackReason(body[1]))
+	}
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.conn, c.last, c.done = conn, time.Now(), make(chan struct{})
+	go c.read(conn, r)
+	go c.ping(conn, c.done)
+	return nil
+}
+
+// read discards what the broker sends (PINGRESP) until the connection
+// fails, then drops it.
+func (c *Client) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		if _, _, err := readPacket(r); err != nil {
+			break
+		}
+	}
+	c.mu.Lock()
+	if c.conn == conn {
+		c.drop()
+	}
+	c.mu.Unlock()
+}
+
+// ping sends PINGREQ when nothing else has been sent for half the
+// keep-alive period.
+func (c *Client) ping(conn net.Conn, done chan struct{}) {
+	t := time.NewTicker(c.opts.KeepAlive / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		c.mu.Lock()
+		if c.conn == conn && time.Since(c.last) >= c.opts.KeepAlive/2 {
+			c.write([]byte{0xC0, 0})
+		}
+		c.mu.Unlock()
+	}
+}
+
+// write sends a packet, dropping the connection if it fails. Callers must
+// hold c.mu.
+func (c *Client) write(p []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	if _, err := c.conn.Write(p); err != nil {
+		c.drop()
+		return err
+	}
+	c.last = time.Now()
+	return nil
+}
+
+// drop closes the connection. Callers must hold c.mu.
+func (c *Client) drop() {
+	c.conn.Close()
+	c.conn = nil
+	close(c.done)
+}
+
+// packet encodes a control packet from its first byte and body parts.
+func packet(first byte, parts ...[]byte) []byte {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	b := []byte{first}
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			break
+		}
+	}
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// str encodes a length-prefixed UTF-8 string.
+func str(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// readPacket reads one control packet, returning its type (the first byte
+// with the flags cleared) and body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		n += int(d&0x7F) * mult
+		mult *= 128
+		if d&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return first & 0xF0, body, nil
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
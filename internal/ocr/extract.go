@@ -0,0 +1,328 @@
+package ocr
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// nativeExtractor returns the reader for document types whose text is read
+// directly rather than OCR'd, or nil. passwords are for PDFs attached to emails.
+func nativeExtractor(docType string, passwords []string) func(ctx context.Context, data []byte) (Result, error) {
+	switch docType {
+	case ".txt":
+		return func(_ context.Context, data []byte) (Result, error) { return Result{Text: plainText(data)}, nil }
+	case ".html", ".htm":
+		return func(_ context.Context, data []byte) (Result, error) { return Result{Text: htmlText(data)}, nil }
+	case ".docx":
+		return func(_ context.Context, data []byte) (Result, error) { return textResult(docxText(data)) }
+	case ".odt":
+		return func(_ context.Context, data []byte) (Result, error) { return textResult(odtText(data)) }
+	case ".eml":
+		return func(ctx context.Context, data []byte) (Result, error) { return emlText(ctx, data, passwords) }
+	}
+	return nil
+}
+
+func textResult(text string, err error) (Result, error) {
+	return Result{Text: strings.TrimSpace(text)}, err
+}
+
+// plainText returns data as UTF-8, treating anything else as Latin-1.
+func plainText(data []byte) string {
+	if utf8.Valid(data) {
+		return strings.TrimSpace(strings.TrimPrefix(string(data), "\uFEFF"))
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// xmlText concatenates the character data of an XML document. When textIn is
+// set, only text inside those elements counts; breaks maps element names to
+// the separator written when they start ("<name") or end ("</name").
+func xmlText(r io.Reader, textIn string, breaks map[string]string) (string, error) {
+	var sb strings.Builder
+	dec := xml.NewDecoder(r)
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sb.String(), err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == textIn {
+				depth++
+			}
+			sb.WriteString(breaks["<"+t.Name.Local])
+		case xml.EndElement:
+			if t.Name.Local == textIn {
+				depth--
+			}
+			sb.WriteString(breaks["</"+t.Name.Local])
+		case xml.CharData:
+			if textIn == "" || depth > 0 {
+				sb.Write(t)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// zipEntry opens the named file of a zip archive held in data.
+func zipEntry(data []byte, name string) (io.ReadCloser, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return f, nil
+}
+
+// docxText reads the body text of a Word document: runs of w:t, with w:p
+// ending paragraphs.
+func docxText(data []byte) (string, error) {
+	f, err := zipEntry(data, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return xmlText(f, "t", map[string]string{"<tab": "\t", "<br": "\n", "<cr": "\n", "</p": "\n"})
+}
+
+// odtText reads the body text of an OpenDocument text file.
+func odtText(data []byte) (string, error) {
+	f, err := zipEntry(data, "content.xml")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return xmlText(f, "body", map[string]string{"<tab": "\t", "<line-break": "\n", "<s": " ", "</p": "\n", "</h": "\n"})
+}
+
+// htmlBlocks are elements that start a new line in extracted HTML text.
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "hr": true, "section": true, "article": true,
+}
+
+// htmlText returns the visible text of an HTML document, one line per block.
+func htmlText(data []byte) string {
+	var sb strings.Builder
+	z := html.NewTokenizer(bytes.NewReader(data))
+	skip := 0         // inside script/style/head
+	separated := true // last write ended in whitespace
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return tidyLines(sb.String())
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			switch tag {
+			case "script", "style", "head", "noscript", "template":
+				if z.Token().Type == html.EndTagToken {
+					skip = max(skip-1, 0)
+				} else {
+					skip++
+				}
+			case "td", "th":
+				if z.Token().Type != html.EndTagToken {
+					sb.WriteString("\t")
+					separated = true
+				}
+			default:
+				if htmlBlocks[tag] {
+					sb.WriteString("\n")
+					separated = true
+				}
+			}
+		case html.TextToken:
+			words := strings.Fields(string(z.Text()))
+			if skip > 0 || len(words) == 0 {
+				continue
+			}
+			if !separated {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(strings.Join(words, " "))
+			separated = false
+		}
+	}
+}
+
+// tidyLines trims each line and drops blank ones.
+func tidyLines(s string) string {
+	var lines []string
+	for line := range strings.SplitSeq(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// emlText reads an email: its headers, the text of its body (plain text
+// preferred to HTML) and the text of any attachments in a supported format,
+// OCR'ing PDF and image attachments.
+func emlText(ctx context.Context, data []byte, passwords []string) (Result, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, fmt.Errorf("reading email: %w", err)
+	}
+	var dec mime.WordDecoder
+	var sb strings.Builder
+	for _, h := range []string{"From", "To", "Date", "Subject"} {
+		if v := msg.Header.Get(h); v != "" {
+			if d, err := dec.DecodeHeader(v); err == nil {
+				v = d
+			}
+			fmt.Fprintf(&sb, "%s: %s\n", h, v)
+		}
+	}
+	sb.WriteString("\n")
+
+	e := emlWalker{ctx: ctx, passwords: passwords, out: &sb}
+	e.part(textproto.MIMEHeader(msg.Header), msg.Body)
+	res := Result{Text: strings.TrimSpace(sb.String())}
+	if e.words > 0 {
+		res.Confidence, res.Words = e.confSum/float64(e.words), e.words
+	}
+	return res, nil
+}
+
+// emlWalker writes the text of a MIME tree, keeping the word-weighted OCR
+// confidence of any attachments it had to OCR.
+type emlWalker struct {
+	ctx       context.Context
+	passwords []string
+	out       *strings.Builder
+	confSum   float64
+	words     int
+}
+
+func (e *emlWalker) part(header textproto.MIMEHeader, body io.Reader) {
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+	body = transferDecoder(header.Get("Content-Transfer-Encoding"), body)
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		// Of alternatives, only the plain text (or else the first) is read
+		mr := multipart.NewReader(body, params["boundary"])
+		var best *multipart.Part
+		var bestBody []byte
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			if mediaType != "multipart/alternative" {
+				e.part(p.Header, p)
+				continue
+			}
+			if t, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type")); best == nil || t == "text/plain" {
+				best = p
+				bestBody, _ = io.ReadAll(p)
+			}
+		}
+		if best != nil {
+			e.part(best.Header, bytes.NewReader(bestBody))
+		}
+		return
+	}
+
+	_, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename != "" {
+		e.attachment(filename, body)
+		return
+	}
+	if cs := params["charset"]; cs != "" {
+		if r, err := charset.NewReaderLabel(cs, body); err == nil {
+			body = r
+		}
+	}
+	b, _ := io.ReadAll(body)
+	switch mediaType {
+	case "text/plain":
+		e.out.WriteString(plainText(b) + "\n")
+	case "text/html":
+		e.out.WriteString(htmlText(b) + "\n")
+	case "message/rfc822":
+		if res, err := emlText(e.ctx, b, e.passwords); err == nil {
+			e.add(res)
+		}
+	}
+}
+
+// attachment extracts an attached file of any supported type through a
+// temp file, so PDFs and images go through the same OCR as documents.
+func (e *emlWalker) attachment(name string, body io.Reader) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if !Supported(ext) {
+		return
+	}
+	f, err := os.CreateTemp(TempDir, "godocs-attachment-*"+ext)
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, body)
+	f.Close()
+	if err != nil {
+		return
+	}
+	res, err := ExtractText(e.ctx, f.Name(), ext, e.passwords...)
+	if err != nil || res.Text == "" {
+		return
+	}
+	fmt.Fprintf(e.out, "\n--- %s ---\n", name)
+	e.add(res)
+}
+
+func (e *emlWalker) add(res Result) {
+	e.out.WriteString(res.Text + "\n")
+	e.confSum += res.Confidence * float64(res.Words)
+	e.words += res.Words
+}
+
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
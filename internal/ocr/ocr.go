@@ -1,52 +1,248 @@
 package ocr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 )
 
-// ExtractText runs OCR on the given file and returns extracted text.
-// For PDFs, converts the first page to PNG via pdftoppm first.
-// For images, runs tesseract directly.
-func ExtractText(filePath, docType string) (string, error) {
+// Result is the text OCR extracted and how sure tesseract was of it.
+type Result struct {
+	Text       string
+	Confidence float64 // mean word confidence, 0-100
+	Words      int     // words the confidence is averaged over
+	Lines      []Line  // where each line is on the page; none without OCR
+}
+
+// Line is a line of OCR text and its box on the page OCR'd, as fractions
+// of the page's width and height, so it can be laid over the page at any
+// size.
+type Line struct {
+	Text                     string
+	Left, Top, Width, Height float64
+}
+
+// ErrPasswordRequired is returned for an encrypted PDF that none of the
+// given passwords opens.
+var ErrPasswordRequired = errors.New("PDF is password protected")
+
+// TempDir is where page images and other temporary files are written; ""
+// for the system temp dir.
+var TempDir string
+
+// ocrTypes are OCR'd with tesseract; others are read by nativeExtractor.
+var ocrTypes = []string{".pdf", ".png", ".jpg", ".jpeg", ".tiff", ".bmp"}
+
+// Supported reports whether ExtractText can read documents of docType.
+func Supported(docType string) bool {
 	docType = strings.ToLower(docType)
+	return slices.Contains(ocrTypes, docType) || nativeExtractor(docType, nil) != nil
+}
+
+// ExtractText returns the text of the given file, with ReadText for the
+// types it reads and OCR for the rest.
+func ExtractText(ctx context.Context, filePath, docType string, passwords ...string) (Result, error) {
+	if nativeExtractor(strings.ToLower(docType), nil) != nil {
+		return ReadText(ctx, filePath, docType, passwords...)
+	}
+	return OCR(ctx, filePath, docType, passwords...)
+}
+
+// ReadText reads the text of office documents, emails, HTML and plain text
+// without OCR, so its Result has no confidence. Encrypted PDFs attached to
+// emails are opened with the first of passwords that works.
+func ReadText(ctx context.Context, filePath, docType string, passwords ...string) (Result, error) {
+	extract := nativeExtractor(strings.ToLower(docType), passwords)
+	if extract == nil {
+		return Result{}, fmt.Errorf("no text reader for document type %s", docType)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return Result{}, err
+	}
+	return extract(ctx, data)
+}
 
-	switch docType {
-	case ".pdf":
-		return extractFromPDF(filePath)
-	case ".png", ".jpg", ".jpeg", ".tiff", ".bmp":
-		return extractFromImage(filePath)
-	default:
-		return "", fmt.Errorf("unsupported document type for OCR: %s", docType)
+// PDFText returns the text layer of a PDF, read with pdftotext rather than
+// OCR, so its Result has no confidence. A scanned PDF without one gives "".
+// Encrypted PDFs are opened with the first of passwords that works.
+func PDFText(ctx context.Context, pdfPath string, passwords ...string) (Result, error) {
+	for _, pw := range append([]string{""}, passwords...) {
+		args := []string{"-enc", "UTF-8"}
+		if pw != "" {
+			args = append(args, "-upw", pw)
+		}
+		var stderr strings.Builder
+		cmd := command(ctx, "pdftotext", append(args, pdfPath, "-")...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err == nil {
+			return Result{Text: tidyLines(string(out))}, nil
+		}
+		if !strings.Contains(stderr.String(), "Incorrect password") {
+			return Result{}, fmt.Errorf("pdftotext failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
 	}
+	return Result{}, ErrPasswordRequired
 }
 
-func extractFromPDF(pdfPath string) (string, error) {
-	tmpDir, err := os.MkdirTemp("", "godocs-ocr-*")
+// OCR runs tesseract on an image, or on the first page of a PDF converted
+// to PNG with pdftoppm. Encrypted PDFs are opened with the first of
+// passwords that works. Cancelling ctx kills the OCR tools.
+func OCR(ctx context.Context, filePath, docType string, passwords ...string) (Result, error) {
+	docType = strings.ToLower(docType)
+	if !slices.Contains(ocrTypes, docType) {
+		return Result{}, fmt.Errorf("unsupported document type for OCR: %s", docType)
+	}
+
+	tmpDir, err := os.MkdirTemp(TempDir, "godocs-ocr-*")
 	if err != nil {
-		return "", fmt.Errorf("creating temp dir: %w", err)
+		return Result{}, fmt.Errorf("creating temp dir: %w", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
-	// Convert first page to PNG
-	outPrefix := filepath.Join(tmpDir, "page")
-	cmd := exec.Command("pdftoppm", "-png", "-f", "1", "-l", "1", "-singlefile", pdfPath, outPrefix)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("pdftoppm failed: %w: %s", err, string(out))
+	imagePath := filePath
+	if docType == ".pdf" {
+		outPrefix := filepath.Join(tmpDir, "page")
+		if err := renderFirstPage(ctx, filePath, outPrefix, passwords); err != nil {
+			return Result{}, err
+		}
+		imagePath = outPrefix + ".png"
 	}
+	return extractFromImage(ctx, imagePath, tmpDir)
+}
 
-	pngPath := outPrefix + ".png"
-	return extractFromImage(pngPath)
+// RenderPage writes the page OCR reads from a document to outPath: the
+// first page of a PDF as a PNG rendered as for OCR, or a copy of an image.
+func RenderPage(ctx context.Context, filePath, docType, outPath string, passwords ...string) error {
+	switch docType = strings.ToLower(docType); {
+	case docType == ".pdf":
+		outPrefix := strings.TrimSuffix(outPath, ".png")
+		if err := renderFirstPage(ctx, filePath, outPrefix, passwords); err != nil {
+			return err
+		}
+		if outPrefix+".png" != outPath {
+			return os.Rename(outPrefix+".png", outPath)
+		}
+		return nil
+	case slices.Contains(ocrTypes, docType):
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(outPath, data, 0644)
+	}
+	return fmt.Errorf("no page image for document type %s", docType)
+}
+
+// renderFirstPage converts the first page of a PDF to outPrefix.png, trying
+// no password and then each of passwords until one opens it.
+func renderFirstPage(ctx context.Context, pdfPath, outPrefix string, passwords []string) error {
+	for _, pw := range append([]string{""}, passwords...) {
+		args := []string{"-png", "-f", "1", "-l", "1", "-singlefile"}
+		if pw != "" {
+			args = append(args, "-upw", pw)
+		}
+		cmd := command(ctx, "pdftoppm", append(args, pdfPath, outPrefix)...)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if !strings.Contains(string(out), "Incorrect password") {
+			return fmt.Errorf("pdftoppm failed: %w: %s", err, string(out))
+		}
+	}
+	return ErrPasswordRequired
 }
 
-func extractFromImage(imagePath string) (string, error) {
-	cmd := exec.Command("tesseract", imagePath, "stdout")
-	out, err := cmd.Output()
+// extractFromImage runs tesseract once for both the plain text and the TSV
+// word table the confidence is read from, writing them into dir.
+func extractFromImage(ctx context.Context, imagePath, dir string) (Result, error) {
+	outBase := filepath.Join(dir, "ocr")
+	cmd := command(ctx, "tesseract", imagePath, outBase, "txt", "tsv")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return Result{}, fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	text, err := os.ReadFile(outBase + ".txt")
 	if err != nil {
-		return "", fmt.Errorf("tesseract failed: %w", err)
+		return Result{}, fmt.Errorf("reading tesseract output: %w", err)
+	}
+	res := Result{Text: strings.TrimSpace(string(text))}
+	if tsv, err := os.ReadFile(outBase + ".tsv"); err == nil {
+		res.Confidence, res.Words = tsvConfidence(string(tsv))
+		res.Lines = tsvLines(string(tsv))
+	}
+	return res, nil
+}
+
+// tsvLines reads the line boxes from tesseract's TSV output, with each
+// line's words joined. Lines are level 4 and come before their words; the
+// page, level 1, gives the size the boxes are scaled by.
+func tsvLines(tsv string) []Line {
+	var lines []Line
+	var pageW, pageH float64
+	for i, row := range strings.Split(tsv, "\n") {
+		f := strings.Split(row, "\t")
+		if i == 0 || len(f) < 12 {
+			continue
+		}
+		var box [4]float64
+		for j := range box {
+			box[j], _ = strconv.ParseFloat(f[6+j], 64)
+		}
+		switch f[0] {
+		case "1":
+			pageW, pageH = box[2], box[3]
+		case "4":
+			if pageW > 0 && pageH > 0 {
+				lines = append(lines, Line{Left: box[0] / pageW, Top: box[1] / pageH, Width: box[2] / pageW, Height: box[3] / pageH})
+			}
+		case "5":
+			if word := strings.TrimSpace(f[11]); word != "" && len(lines) > 0 {
+				l := &lines[len(lines)-1]
+				l.Text = strings.TrimSpace(l.Text + " " + word)
+			}
+		}
+	}
+	return slices.DeleteFunc(lines, func(l Line) bool { return l.Text == "" })
+}
+
+// tsvConfidence averages the confidence of the recognised words in
+// tesseract's TSV output. Rows are level, page, block, paragraph, line and
+// word numbers, then left, top, width, height, conf and text; words are
+// level 5, and blocks without text report a confidence of -1.
+func tsvConfidence(tsv string) (float64, int) {
+	var sum float64
+	n := 0
+	for i, line := range strings.Split(tsv, "\n") {
+		f := strings.Split(line, "\t")
+		if i == 0 || len(f) < 12 || f[0] != "5" || strings.TrimSpace(f[11]) == "" {
+			continue
+		}
+		conf, err := strconv.ParseFloat(f[10], 64)
+		if err != nil || conf < 0 {
+			continue
+		}
+		sum += conf
+		n++
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return sum / float64(n), n
+}
+
+// MakeSearchablePDF runs ocrmypdf to write a PDF/A copy of pdfPath with a
+// text layer to outPath. Pages that already have text are left as they are.
+func MakeSearchablePDF(ctx context.Context, pdfPath, outPath string) error {
+	cmd := command(ctx, "ocrmypdf", "--output-type", "pdfa", "--skip-text", "--quiet", pdfPath, outPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ocrmypdf failed: %w: %s", err, strings.TrimSpace(string(out)))
 	}
-	return strings.TrimSpace(string(out)), nil
+	return nil
 }
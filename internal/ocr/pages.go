@@ -0,0 +1,170 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/drummonds/godocs-inbox/internal/qr"
+	"github.com/klippa-app/go-pdfium"
+	"github.com/klippa-app/go-pdfium/references"
+	"github.com/klippa-app/go-pdfium/requests"
+	"github.com/klippa-app/go-pdfium/webassembly"
+)
+
+// Pages are rendered and split with PDFium compiled to WebAssembly, as
+// go-thumbnails renders thumbnails, so separator sheets need no external
+// tools.
+var pdfiumPool struct {
+	once sync.Once
+	pool pdfium.Pool
+	err  error
+}
+
+// pdfiumInstance returns a PDFium instance from a pool started on first
+// use. Close gives it back.
+func pdfiumInstance(ctx context.Context) (pdfium.Pdfium, error) {
+	pdfiumPool.once.Do(func() {
+		pdfiumPool.pool, pdfiumPool.err = webassembly.Init(webassembly.Config{MinIdle: 1, MaxIdle: 1, MaxTotal: 1})
+	})
+	if pdfiumPool.err != nil {
+		return nil, fmt.Errorf("starting PDFium: %w", pdfiumPool.err)
+	}
+	return pdfiumPool.pool.GetInstanceWithContext(ctx)
+}
+
+// openPDF opens the PDF at path in inst and returns it with its page
+// count. The file must stay open until the document is closed.
+func openPDF(inst pdfium.Pdfium, path string) (*os.File, references.FPDF_DOCUMENT, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, "", 0, err
+	}
+	doc, err := inst.OpenDocument(&requests.OpenDocument{FileReader: f, FileReaderSize: fi.Size()})
+	if err != nil {
+		f.Close()
+		return nil, "", 0, fmt.Errorf("opening %s: %w", filepath.Base(path), err)
+	}
+	count, err := inst.FPDF_GetPageCount(&requests.FPDF_GetPageCount{Document: doc.Document})
+	if err != nil {
+		inst.FPDF_CloseDocument(&requests.FPDF_CloseDocument{Document: doc.Document})
+		f.Close()
+		return nil, "", 0, fmt.Errorf("counting pages: %w", err)
+	}
+	return f, doc.Document, count.PageCount, nil
+}
+
+// PageCodes renders every page of a PDF at dpi and returns the QR codes
+// found on each, keyed by 1-based page number, and the page count.
+func PageCodes(ctx context.Context, pdfPath string, dpi int) (map[int][]string, int, error) {
+	inst, err := pdfiumInstance(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer inst.Close()
+	f, doc, pages, err := openPDF(inst, pdfPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	defer inst.FPDF_CloseDocument(&requests.FPDF_CloseDocument{Document: doc})
+
+	codes := make(map[int][]string)
+	for i := 0; i < pages; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		page, err := inst.RenderPageInDPI(&requests.RenderPageInDPI{
+			DPI:  dpi,
+			Page: requests.Page{ByIndex: &requests.PageByIndex{Document: doc, Index: i}},
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("rendering page %d: %w", i+1, err)
+		}
+		// the image is PDFium's memory until Cleanup
+		found := qr.Decode(page.Result.Image)
+		page.Cleanup()
+		if len(found) > 0 {
+			codes[i+1] = found
+		}
+	}
+	return codes, pages, nil
+}
+
+// SplitPDF writes each page range of a PDF (1-based, inclusive) to its own
+// file in dir and returns their paths in order.
+func SplitPDF(ctx context.Context, pdfPath string, ranges [][2]int, dir string) ([]string, error) {
+	inst, err := pdfiumInstance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer inst.Close()
+	f, doc, pages, err := openPDF(inst, pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	defer inst.FPDF_CloseDocument(&requests.FPDF_CloseDocument{Document: doc})
+
+	var parts []string
+	for i, r := range ranges {
+		if r[0] < 1 || r[0] > r[1] || r[1] > pages {
+			return nil, fmt.Errorf("pages %d-%d are not in %s, which has %d", r[0], r[1], filepath.Base(pdfPath), pages)
+		}
+		out := filepath.Join(dir, fmt.Sprintf("part-%d.pdf", i+1))
+		if err := writePages(inst, doc, fmt.Sprintf("%d-%d", r[0], r[1]), out); err != nil {
+			return nil, err
+		}
+		parts = append(parts, out)
+	}
+	return parts, nil
+}
+
+// writePages copies the pages of src in pageRange ("3-5") to a new PDF at
+// out.
+func writePages(inst pdfium.Pdfium, src references.FPDF_DOCUMENT, pageRange, out string) error {
+	created, err := inst.FPDF_CreateNewDocument(&requests.FPDF_CreateNewDocument{})
+	if err != nil {
+		return fmt.Errorf("creating a PDF: %w", err)
+	}
+	defer inst.FPDF_CloseDocument(&requests.FPDF_CloseDocument{Document: created.Document})
+	if _, err := inst.FPDF_ImportPages(&requests.FPDF_ImportPages{Source: src, Destination: created.Document, PageRange: &pageRange}); err != nil {
+		return fmt.Errorf("copying pages %s: %w", pageRange, err)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if _, err := inst.FPDF_SaveAsCopy(&requests.FPDF_SaveAsCopy{Document: created.Document, FileWriter: f}); err != nil {
+		f.Close()
+		return fmt.Errorf("writing pages %s: %w", pageRange, err)
+	}
+	return f.Close()
+}
+
+// RotatePDF writes a copy of pdfPath with every page turned clockwise by
+// degrees (90, 180 or 270) to outPath, using qpdf.
+func RotatePDF(ctx context.Context, pdfPath, outPath string, degrees int) error {
+	cmd := command(ctx, "qpdf", "--rotate=+"+strconv.Itoa(degrees), pdfPath, outPath)
+	out, err := cmd.CombinedOutput()
+	// qpdf exits 3 when it succeeded with warnings
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 3 {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Tools are the external programs the package runs.
+var Tools = []string{"tesseract", "pdftoppm", "pdftotext", "ocrmypdf", "qpdf"}
+
+// Paths maps a tool's name to the binary run for it, for systems such as
+// NixOS or Windows where it is not in PATH under that name. Tools not
+// listed are run by name.
+var Paths = map[string]string{}
+
+// Path is the binary run for the named tool.
+func Path(name string) string {
+	if p := Paths[name]; p != "" {
+		return p
+	}
+	return name
+}
+
+func command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, Path(name), args...)
+}
+
+// ToolVersion reports the version line of an external tool (one of Tools).
+// Returns an error if the tool is not installed.
+func ToolVersion(name string) (string, error) {
+	var args []string
+	switch name {
+	case "tesseract", "ocrmypdf", "qpdf":
+		args = []string{"--version"}
+	case "pdftoppm", "pdftotext":
+		args = []string{"-v"}
+	default:
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+	path, err := exec.LookPath(Path(name))
+	if err != nil {
+		if Path(name) != name {
+			return "", fmt.Errorf("%s not found at %s", name, Path(name))
+		}
+		return "", fmt.Errorf("%s not found in PATH", name)
+	}
+	// pdftoppm prints its version to stderr and may exit non-zero
+	out, _ := exec.Command(path, args...).CombinedOutput()
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if line == "" {
+		return "", fmt.Errorf("%s returned no version", name)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// Languages lists the language packs tesseract has installed, such as
+// "eng" and "osd".
+func Languages() ([]string, error) {
+	out, err := exec.Command(Path("tesseract"), "--list-langs").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("listing tesseract languages: %w", err)
+	}
+	var langs []string
+	for line := range strings.SplitSeq(strings.TrimSpace(string(out)), "\n") {
+		// the first line is a heading: List of available languages in "..." (2):
+		if line = strings.TrimSpace(line); line != "" && !strings.Contains(line, " ") {
+			langs = append(langs, line)
+		}
+	}
+	return langs, nil
+}
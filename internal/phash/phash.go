@@ -0,0 +1,62 @@
+// Package phash computes perceptual hashes of page images, so re-scans of
+// the same page compare as near-equal even when their bytes differ.
+package phash
+
+import (
+	"image"
+	"math/bits"
+)
+
+// DHash returns the 64-bit difference hash of img: the image is reduced to
+// 9x8 grey levels and each bit records whether a pixel is brighter than its
+// right-hand neighbour.
+func DHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	b := img.Bounds()
+	if b.Empty() {
+		return 0
+	}
+	var grey [h][w]uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			grey[y][x] = cellLuma(img, image.Rect(
+				b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h,
+				b.Min.X+(x+1)*b.Dx()/w, b.Min.Y+(y+1)*b.Dy()/h))
+		}
+	}
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if grey[y][x] > grey[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// cellLuma is the mean luma of the pixels in r (at least one pixel).
+func cellLuma(img image.Image, r image.Rectangle) uint64 {
+	if r.Dx() == 0 {
+		r.Max.X = r.Min.X + 1
+	}
+	if r.Dy() == 0 {
+		r.Max.Y = r.Min.Y + 1
+	}
+	var sum, n uint64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			sum += (299*uint64(cr) + 587*uint64(cg) + 114*uint64(cb)) / 1000
+			n++
+		}
+	}
+	return sum / n
+}
+
+// Distance is the number of differing bits between two hashes; 0 means the
+// images look the same.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
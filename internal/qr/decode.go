@@ -0,0 +1,660 @@
+package qr
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+	"unicode/utf8"
+)
+
+// Decode returns the text of each QR code it can read in img, a scan or
+// rendering of a page with the codes printed dark on light at any angle.
+// Images of a few pixels to a module and more are read; codes photographed
+// at a steep angle may not be.
+func Decode(img image.Image) []string {
+	b := binarize(img)
+	finders := b.finders()
+	slices.SortStableFunc(finders, func(x, y finder) int { return y.hits - x.hits })
+	if len(finders) > maxFinders {
+		finders = finders[:maxFinders]
+	}
+
+	var texts []string
+	used := make([]bool, len(finders))
+	for _, t := range triples(finders) {
+		if used[t.i[0]] || used[t.i[1]] || used[t.i[2]] {
+			continue
+		}
+		if text, ok := b.decodeAt(t); ok {
+			texts = append(texts, text)
+			used[t.i[0]], used[t.i[1]], used[t.i[2]] = true, true, true
+		}
+	}
+	return texts
+}
+
+// maxFinders bounds the finder patterns tried in threes: a page of text
+// has a few look-alikes.
+const maxFinders = 15
+
+type point struct{ x, y float64 }
+
+func (p point) sub(q point) point            { return point{p.x - q.x, p.y - q.y} }
+func (p point) add(q point) point            { return point{p.x + q.x, p.y + q.y} }
+func (p point) scale(f float64) point        { return point{p.x * f, p.y * f} }
+func (p point) dist(q point) float64         { return math.Hypot(p.x-q.x, p.y-q.y) }
+func (p point) cross(q point) float64        { return p.x*q.y - p.y*q.x }
+func (p point) pixel() (int, int)            { return int(math.Floor(p.x)), int(math.Floor(p.y)) }
+func (p point) near(q point, d float64) bool { return math.Abs(p.x-q.x) <= d && math.Abs(p.y-q.y) <= d }
+
+// bitmap is an image thresholded to dark and light.
+type bitmap struct {
+	w, h int
+	dark []bool
+}
+
+func (b *bitmap) in(x, y int) bool { return x >= 0 && y >= 0 && x < b.w && y < b.h }
+
+// at reports whether the pixel at x, y is dark; outside the image is light.
+func (b *bitmap) at(x, y int) bool { return b.in(x, y) && b.dark[y*b.w+x] }
+
+// binarize thresholds img against the mean of the pixels around each one,
+// so shadows and uneven scans keep their codes. Where the neighbourhood is
+// all one shade, it falls back to a threshold for the whole image.
+func binarize(img image.Image) *bitmap {
+	luma, w, h := grey(img)
+	b := &bitmap{w: w, h: h, dark: make([]bool, w*h)}
+	if w == 0 || h == 0 {
+		return b
+	}
+	global := otsu(luma)
+
+	// integral images of the values and their squares
+	sum := make([]int64, (w+1)*(h+1))
+	sq := make([]int64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var rs, rq int64
+		for x := 0; x < w; x++ {
+			v := int64(luma[y*w+x])
+			rs += v
+			rq += v * v
+			sum[(y+1)*(w+1)+x+1] = sum[y*(w+1)+x+1] + rs
+			sq[(y+1)*(w+1)+x+1] = sq[y*(w+1)+x+1] + rq
+		}
+	}
+	area := func(t []int64, x0, y0, x1, y1 int) int64 {
+		return t[y1*(w+1)+x1] - t[y0*(w+1)+x1] - t[y1*(w+1)+x0] + t[y0*(w+1)+x0]
+	}
+	r := max(max(w, h)/16, 8)
+	for y := 0; y < h; y++ {
+		y0, y1 := max(y-r, 0), min(y+r+1, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(x-r, 0), min(x+r+1, w)
+			n := int64((x1 - x0) * (y1 - y0))
+			s, q := area(sum, x0, y0, x1, y1), area(sq, x0, y0, x1, y1)
+			v := int64(luma[y*w+x])
+			// variance·n² < 16²·n² is a flat neighbourhood
+			if q*n-s*s < 256*n*n {
+				b.dark[y*w+x] = v < int64(global)
+			} else {
+				b.dark[y*w+x] = v*n < s
+			}
+		}
+	}
+	return b
+}
+
+// grey returns the luma of img's pixels, row by row.
+func grey(img image.Image) ([]uint8, int, int) {
+	r := img.Bounds()
+	w, h := r.Dx(), r.Dy()
+	luma := make([]uint8, w*h)
+	switch m := img.(type) {
+	case *image.Gray:
+		for y := 0; y < h; y++ {
+			copy(luma[y*w:(y+1)*w], m.Pix[y*m.Stride:])
+		}
+	case *image.RGBA:
+		// alpha is ignored: page renderers leave it unset
+		for y := 0; y < h; y++ {
+			row := m.Pix[y*m.Stride:]
+			for x := 0; x < w; x++ {
+				luma[y*w+x] = uint8((299*int(row[4*x]) + 587*int(row[4*x+1]) + 114*int(row[4*x+2])) / 1000)
+			}
+		}
+	default:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				cr, cg, cb, _ := img.At(r.Min.X+x, r.Min.Y+y).RGBA()
+				luma[y*w+x] = uint8((299*cr + 587*cg + 114*cb) / 1000 >> 8)
+			}
+		}
+	}
+	return luma, w, h
+}
+
+// otsu is the threshold that best separates luma into dark and light.
+func otsu(luma []uint8) int {
+	var hist [256]int
+	for _, v := range luma {
+		hist[v]++
+	}
+	total := len(luma)
+	var all float64
+	for i, n := range hist {
+		all += float64(i * n)
+	}
+	var below, belowSum, best float64
+	threshold := 128
+	for t, n := range hist {
+		below += float64(n)
+		belowSum += float64(t * n)
+		above := float64(total) - below
+		if below == 0 || above == 0 {
+			continue
+		}
+		mb, ma := belowSum/below, (all-belowSum)/above
+		if v := below * above * (mb - ma) * (mb - ma); v > best {
+			best, threshold = v, t+1
+		}
+	}
+	return threshold
+}
+
+// finder is a finder pattern: the 7×7 squares in three corners of a code.
+type finder struct {
+	point
+	module float64 // module size in pixels
+	hits   int     // rows it was seen on
+}
+
+// finders scans each row for runs of dark, light, dark, light and dark in
+// the ratio 1:1:3:1:1 and confirms them down the column and diagonally
+// through the middle.
+func (b *bitmap) finders() []finder {
+	var found []finder
+	type run struct {
+		start, n int
+		dark     bool
+	}
+	var runs []run
+	for y := 0; y < b.h; y++ {
+		runs = runs[:0]
+		for x := 0; x < b.w; {
+			start, d := x, b.dark[y*b.w+x]
+			for x < b.w && b.dark[y*b.w+x] == d {
+				x++
+			}
+			runs = append(runs, run{start, x - start, d})
+		}
+		for i := 0; i+4 < len(runs); i++ {
+			if !runs[i].dark {
+				continue
+			}
+			var c [5]int
+			for k := range c {
+				c[k] = runs[i+k].n
+			}
+			if !finderRatio(c) {
+				continue
+			}
+			total := c[0] + c[1] + c[2] + c[3] + c[4]
+			if f, ok := b.confirm(runs[i+2].start+runs[i+2].n/2, y, total); ok {
+				found = merge(found, f)
+			}
+		}
+	}
+	return found
+}
+
+// finderRatio reports whether run lengths c are near 1:1:3:1:1.
+func finderRatio(c [5]int) bool {
+	total := c[0] + c[1] + c[2] + c[3] + c[4]
+	if total < 7 {
+		return false
+	}
+	m := float64(total) / 7
+	v := m/2 + 0.5 // a pixel of slack at run ends for small codes
+	return math.Abs(float64(c[0])-m) < v && math.Abs(float64(c[1])-m) < v &&
+		math.Abs(float64(c[2])-3*m) < 3*v &&
+		math.Abs(float64(c[3])-m) < v && math.Abs(float64(c[4])-m) < v
+}
+
+// confirm checks a finder seen across a row at x, y and returns its centre.
+func (b *bitmap) confirm(x, y, across int) (finder, bool) {
+	vc, down, ok := b.crossCheck(x, y, 0, 1, across)
+	if !ok || 5*abs(down-across) >= 2*across {
+		return finder{}, false
+	}
+	x, y = vc.pixel()
+	hc, across, ok := b.crossCheck(x, y, 1, 0, down)
+	if !ok {
+		return finder{}, false
+	}
+	x, _ = hc.pixel()
+	if _, _, ok := b.crossCheck(x, y, 1, 1, across+down); !ok {
+		return finder{}, false
+	}
+	return finder{point: point{hc.x, vc.y}, module: float64(across+down) / 14, hits: 1}, true
+}
+
+// crossCheck measures the 1:1:3:1:1 runs through the dark pixel x, y along
+// dx, dy, each run at most limit long, and returns the middle of the
+// centre run and the runs' total length.
+func (b *bitmap) crossCheck(x, y, dx, dy, limit int) (point, int, bool) {
+	if !b.at(x, y) {
+		return point{}, 0, false
+	}
+	var c [5]int
+	step := func(i int) (int, int) { return x + i*dx, y + i*dy }
+	i := 0
+	for b.at(step(-i)) {
+		c[2]++
+		i++
+	}
+	back := i
+	for b.in(step(-i)) && !b.at(step(-i)) && c[1] <= limit {
+		c[1]++
+		i++
+	}
+	for b.at(step(-i)) && c[0] <= limit {
+		c[0]++
+		i++
+	}
+	j := 1
+	for b.at(step(j)) {
+		c[2]++
+		j++
+	}
+	fwd := j - 1
+	for b.in(step(j)) && !b.at(step(j)) && c[3] <= limit {
+		c[3]++
+		j++
+	}
+	for b.at(step(j)) && c[4] <= limit {
+		c[4]++
+		j++
+	}
+	if c[0] > limit || c[1] > limit || c[3] > limit || c[4] > limit || !finderRatio(c) {
+		return point{}, 0, false
+	}
+	off := float64(fwd-back+1) / 2
+	centre := point{float64(x) + 0.5 + off*float64(dx), float64(y) + 0.5 + off*float64(dy)}
+	return centre, c[0] + c[1] + c[2] + c[3] + c[4], true
+}
+
+// merge adds f to found, averaging it into a finder already seen at the
+// same place.
+func merge(found []finder, f finder) []finder {
+	for i, g := range found {
+		if g.near(f.point, 2*max(g.module, f.module)) && max(g.module, f.module) < 1.5*min(g.module, f.module) {
+			n := float64(g.hits)
+			found[i] = finder{
+				point:  point{(g.x*n + f.x) / (n + 1), (g.y*n + f.y) / (n + 1)},
+				module: (g.module*n + f.module) / (n + 1),
+				hits:   g.hits + 1,
+			}
+			return found
+		}
+	}
+	return append(found, f)
+}
+
+// triple is three finders that could be one code's, as its top-left,
+// top-right and bottom-left corners; i indexes them in the finder list.
+type triple struct {
+	tl, tr, bl finder
+	i          [3]int
+	score      float64 // lower is more code-like
+}
+
+// triples returns the sets of three finders arranged as a code's would be:
+// similar in size, at the corners of a right isosceles triangle; the most
+// regular first.
+func triples(fs []finder) []triple {
+	var ts []triple
+	for i := range fs {
+		for j := i + 1; j < len(fs); j++ {
+			for k := j + 1; k < len(fs); k++ {
+				if t, ok := arrange(fs, [3]int{i, j, k}); ok {
+					ts = append(ts, t)
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(ts, func(a, b triple) int {
+		switch {
+		case a.score < b.score:
+			return -1
+		case a.score > b.score:
+			return 1
+		}
+		return 0
+	})
+	return ts
+}
+
+func arrange(fs []finder, idx [3]int) (triple, bool) {
+	f := [3]finder{fs[idx[0]], fs[idx[1]], fs[idx[2]]}
+	lo := min(f[0].module, f[1].module, f[2].module)
+	hi := max(f[0].module, f[1].module, f[2].module)
+	if hi > 1.5*lo {
+		return triple{}, false
+	}
+	// the corner is opposite the longest side
+	corner := 0
+	longest := 0.0
+	for c := 0; c < 3; c++ {
+		if d := f[(c+1)%3].dist(f[(c+2)%3].point); d > longest {
+			corner, longest = c, d
+		}
+	}
+	tl, a, bb := f[corner], f[(corner+1)%3], f[(corner+2)%3]
+	ia, ib := idx[(corner+1)%3], idx[(corner+2)%3]
+	la, lb := tl.dist(a.point), tl.dist(bb.point)
+	if la == 0 || lb == 0 || max(la, lb) > 1.25*min(la, lb) {
+		return triple{}, false
+	}
+	hyp := la*la + lb*lb
+	skew := math.Abs(longest*longest-hyp) / hyp
+	if skew > 0.2 {
+		return triple{}, false
+	}
+	modules := (la + lb) / 2 / ((lo + hi) / 2)
+	if modules < float64(size(1)-7)-3 || modules > float64(size(maxVersion)-7)+4 {
+		return triple{}, false
+	}
+	// clockwise from top-left, in image coordinates, is top-right first
+	if a.point.sub(tl.point).cross(bb.point.sub(tl.point)) < 0 {
+		a, bb = bb, a
+		ia, ib = ib, ia
+	}
+	score := math.Abs(la-lb)/max(la, lb) + skew + (hi-lo)/hi
+	return triple{tl: tl, tr: a, bl: bb, i: [3]int{idx[corner], ia, ib}, score: score}, true
+}
+
+// decodeAt reads the code whose finders are t, trying the versions its
+// size allows.
+func (b *bitmap) decodeAt(t triple) (string, bool) {
+	// finders are measured across rows and columns, which cut a code turned
+	// by θ 1/cos θ wider
+	module := (2*t.tl.module + t.tr.module + t.bl.module) / 4
+	axis := t.tr.sub(t.tl.point)
+	turn := math.Mod(math.Abs(math.Atan2(axis.y, axis.x)), math.Pi/2)
+	module *= math.Cos(min(turn, math.Pi/2-turn))
+	across := (t.tl.dist(t.tr.point)+t.tl.dist(t.bl.point))/2/module + 7
+	guess := int(math.Round((across - 17) / 4))
+	for _, v := range []int{guess, guess - 1, guess + 1} {
+		if v < 1 || v > maxVersion {
+			continue
+		}
+		if text, ok := b.decodeVersion(t, v); ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// decodeVersion samples t as a code of version v, correcting for
+// perspective with the bottom-right alignment pattern when it is found.
+func (b *bitmap) decodeVersion(t triple, v int) (string, bool) {
+	n := float64(size(v))
+	ex := t.tr.sub(t.tl.point).scale(1 / (n - 7))
+	ey := t.bl.sub(t.tl.point).scale(1 / (n - 7))
+	affine := func(u, w float64) point {
+		return t.tl.point.add(ex.scale(u - 3.5)).add(ey.scale(w - 3.5))
+	}
+	grids := []func(u, w float64) point{affine}
+	if v >= 2 {
+		if align, ok := b.alignment(affine, n, math.Hypot(ex.x, ex.y)); ok {
+			src := [4]point{{3.5, 3.5}, {n - 3.5, 3.5}, {3.5, n - 3.5}, {n - 6.5, n - 6.5}}
+			dst := [4]point{t.tl.point, t.tr.point, t.bl.point, align}
+			if h, ok := homography(src, dst); ok {
+				grids = []func(u, w float64) point{h, affine}
+			}
+		}
+	}
+	for _, grid := range grids {
+		modules := make([][]bool, int(n))
+		for r := range modules {
+			modules[r] = make([]bool, int(n))
+			for c := range modules[r] {
+				modules[r][c] = b.at(grid(float64(c)+0.5, float64(r)+0.5).pixel())
+			}
+		}
+		if text, ok := readModules(modules, v); ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// alignment finds the centre of the bottom-right alignment pattern near
+// where grid puts it, searching a few modules around.
+func (b *bitmap) alignment(grid func(u, w float64) point, n, module float64) (point, bool) {
+	centre := n - 7
+	radius := int(4*module) + 1
+	// the middle of the offsets that match best, as at a few pixels to a
+	// module several do
+	best, sum, ties := 0, point{}, 0.0
+	for oy := -radius; oy <= radius; oy++ {
+		for ox := -radius; ox <= radius; ox++ {
+			off := point{float64(ox), float64(oy)}
+			score := 0
+			for dr := -2; dr <= 2; dr++ {
+				for dc := -2; dc <= 2; dc++ {
+					p := grid(centre+float64(dc)+0.5, centre+float64(dr)+0.5).add(off)
+					if b.at(p.pixel()) == (max(abs(dr), abs(dc)) != 1) {
+						score++
+					}
+				}
+			}
+			switch {
+			case score > best:
+				best, sum, ties = score, off, 1
+			case score == best:
+				sum, ties = sum.add(off), ties+1
+			}
+		}
+	}
+	if best < 23 {
+		return point{}, false
+	}
+	return grid(centre+0.5, centre+0.5).add(sum.scale(1 / ties)), true
+}
+
+// homography returns the projective map taking each src point to dst.
+func homography(src, dst [4]point) (func(u, w float64) point, bool) {
+	// x = (a·u + b·w + c) / (g·u + h·w + 1), likewise y with d, e, f
+	var m [8][9]float64
+	for i := 0; i < 4; i++ {
+		u, w, x, y := src[i].x, src[i].y, dst[i].x, dst[i].y
+		m[2*i] = [9]float64{u, w, 1, 0, 0, 0, -u * x, -w * x, x}
+		m[2*i+1] = [9]float64{0, 0, 0, u, w, 1, -u * y, -w * y, y}
+	}
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for r := col + 1; r < 8; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for r := 0; r < 8; r++ {
+			if r == col {
+				continue
+			}
+			f := m[r][col] / m[col][col]
+			for k := col; k < 9; k++ {
+				m[r][k] -= f * m[col][k]
+			}
+		}
+	}
+	var p [8]float64
+	for i := range p {
+		p[i] = m[i][8] / m[i][i]
+	}
+	return func(u, w float64) point {
+		d := p[6]*u + p[7]*w + 1
+		return point{(p[0]*u + p[1]*w + p[2]) / d, (p[3]*u + p[4]*w + p[5]) / d}
+	}, true
+}
+
+// readModules decodes the modules of a version v code, dark true.
+func readModules(modules [][]bool, v int) (string, bool) {
+	first, second := formatPositions(v)
+	var level Level
+	mask, best := 0, 16
+	for _, positions := range [][15][2]int{first, second} {
+		got := 0
+		for i, pos := range positions {
+			if modules[pos[0]][pos[1]] {
+				got |= 1 << i
+			}
+		}
+		for l := L; l <= H; l++ {
+			for m := 0; m < 8; m++ {
+				if d := bits.OnesCount(uint(got ^ formatBits(l, m))); d < best {
+					level, mask, best = l, m, d
+				}
+			}
+		}
+	}
+	if best > 3 {
+		return "", false
+	}
+
+	cw := make([]byte, codewords(v))
+	for i, pos := range dataOrder(v) {
+		if i >= 8*len(cw) {
+			break
+		}
+		if modules[pos[0]][pos[1]] != masked(mask, pos[0], pos[1]) {
+			cw[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	lens := blockLens(v, level)
+	ec := ecCodewords[level][v]
+	blocks := make([][]byte, len(lens))
+	for i, n := range lens {
+		blocks[i] = make([]byte, n+ec)
+	}
+	for i, at := range interleave(v, level) {
+		blocks[at[0]][at[1]] = cw[i]
+	}
+	var data []byte
+	for i, block := range blocks {
+		if !rsCorrect(block, ec) {
+			return "", false
+		}
+		data = append(data, block[:lens[i]]...)
+	}
+	return parseSegments(data, v)
+}
+
+// parseSegments reads the segments of a code's data codewords up to the
+// terminator. Byte segments are taken as UTF-8, or else ISO 8859-1.
+func parseSegments(data []byte, v int) (string, bool) {
+	r := bitReader{b: data}
+	var out []byte
+	for r.left() >= 4 {
+		mode := r.read(4)
+		switch mode {
+		case 0:
+			return text(out), !r.over
+		case modeNumeric:
+			n := r.read(countBits(mode, v))
+			for ; n > 0 && !r.over; n -= 3 {
+				digits, width := min(n, 3), []int{0, 4, 7, 10}[min(n, 3)]
+				d := r.read(width)
+				if d >= []int{1, 10, 100, 1000}[digits] {
+					return "", false
+				}
+				for k := digits - 1; k >= 0; k-- {
+					out = append(out, byte('0'+d/[]int{1, 10, 100}[k]%10))
+				}
+			}
+		case modeAlphanumeric:
+			n := r.read(countBits(mode, v))
+			for ; n >= 2 && !r.over; n -= 2 {
+				pair := r.read(11)
+				if pair >= 45*45 {
+					return "", false
+				}
+				out = append(out, alphanumeric[pair/45], alphanumeric[pair%45])
+			}
+			if n == 1 {
+				c := r.read(6)
+				if c >= 45 {
+					return "", false
+				}
+				out = append(out, alphanumeric[c])
+			}
+		case modeByte:
+			n := r.read(countBits(mode, v))
+			for ; n > 0 && !r.over; n-- {
+				out = append(out, byte(r.read(8)))
+			}
+		case modeECI:
+			// the designator is 1, 2 or 3 bytes long; UTF-8 is detected
+			// rather than trusted to it
+			switch first := r.read(8); {
+			case first&0x80 == 0:
+			case first&0xc0 == 0x80:
+				r.read(8)
+			default:
+				r.read(16)
+			}
+		case modeStructured:
+			r.read(16)
+		case modeFNC1First:
+		case modeFNC1Second:
+			r.read(8)
+		default:
+			// kanji and unassigned modes
+			return "", false
+		}
+		if r.over {
+			return "", false
+		}
+	}
+	return text(out), true
+}
+
+func text(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+type bitReader struct {
+	b    []byte
+	n    int // bits read
+	over bool
+}
+
+func (r *bitReader) left() int { return 8*len(r.b) - r.n }
+
+func (r *bitReader) read(width int) int {
+	if width > r.left() {
+		r.over = true
+		r.n = 8 * len(r.b)
+		return 0
+	}
+	v := 0
+	for i := 0; i < width; i++ {
+		v = v<<1 | int(r.b[r.n/8]>>(7-r.n%8)&1)
+		r.n++
+	}
+	return v
+}
@@ -0,0 +1,231 @@
+package qr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// Encode draws text as a QR code in byte mode, in the smallest version that
+// holds it at level, with scale pixels to a module and the four-module quiet
+// zone around it.
+func Encode(text string, level Level, scale int) (*image.Gray, error) {
+	if level < L || level > H {
+		return nil, fmt.Errorf("qr: unknown level %d", level)
+	}
+	if scale < 1 {
+		return nil, fmt.Errorf("qr: scale must be at least 1")
+	}
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if 4+countBits(modeByte, v)+8*len(text) <= 8*dataCodewords(v, level) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("qr: %d bytes is too long for a version %d code", len(text), maxVersion)
+	}
+	modules := encodeModules(version, level, bestMask(version, level, text), text)
+
+	n := size(version)
+	img := image.NewGray(image.Rect(0, 0, (n+8)*scale, (n+8)*scale))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for r, row := range modules {
+		for c, dark := range row {
+			if !dark {
+				continue
+			}
+			for y := (r + 4) * scale; y < (r+5)*scale; y++ {
+				for x := (c + 4) * scale; x < (c+5)*scale; x++ {
+					img.SetGray(x, y, color.Gray{})
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// encodeModules lays out the code for text with mask m.
+func encodeModules(version int, level Level, m int, text string) [][]bool {
+	n := size(version)
+	modules := make([][]bool, n)
+	for i := range modules {
+		modules[i] = make([]bool, n)
+	}
+
+	finder := func(row, col int) {
+		for r := 0; r < 7; r++ {
+			for c := 0; c < 7; c++ {
+				ring := max(abs(r-3), abs(c-3))
+				modules[row+r][col+c] = ring != 2
+			}
+		}
+	}
+	finder(0, 0)
+	finder(0, n-7)
+	finder(n-7, 0)
+	for i := 8; i < n-8; i++ {
+		modules[6][i] = i%2 == 0
+		modules[i][6] = i%2 == 0
+	}
+	centres := alignmentCentres(version)
+	for i, r := range centres {
+		for j, c := range centres {
+			if (i == 0 && j == 0) || (i == 0 && j == len(centres)-1) || (i == len(centres)-1 && j == 0) {
+				continue
+			}
+			for dr := -2; dr <= 2; dr++ {
+				for dc := -2; dc <= 2; dc++ {
+					modules[r+dr][c+dc] = max(abs(dr), abs(dc)) != 1
+				}
+			}
+		}
+	}
+	format := formatBits(level, m)
+	first, second := formatPositions(version)
+	for i := 0; i < 15; i++ {
+		bit := format>>i&1 == 1
+		modules[first[i][0]][first[i][1]] = bit
+		modules[second[i][0]][second[i][1]] = bit
+	}
+	modules[n-8][8] = true
+	if version >= 7 {
+		bits := versionBits(version)
+		for i := 0; i < 18; i++ {
+			bit := bits>>i&1 == 1
+			modules[i/3][n-11+i%3] = bit
+			modules[n-11+i%3][i/3] = bit
+		}
+	}
+
+	cw := codewordsFor(version, level, text)
+	for i, pos := range dataOrder(version) {
+		dark := i < 8*len(cw) && cw[i/8]>>(7-i%8)&1 == 1
+		modules[pos[0]][pos[1]] = dark != masked(m, pos[0], pos[1])
+	}
+	return modules
+}
+
+// codewordsFor encodes text as one byte mode segment, pads it to the
+// version's capacity and interleaves it with its error correction.
+func codewordsFor(version int, level Level, text string) []byte {
+	var bits bitWriter
+	bits.write(modeByte, 4)
+	bits.write(len(text), countBits(modeByte, version))
+	for i := 0; i < len(text); i++ {
+		bits.write(int(text[i]), 8)
+	}
+	capacity := dataCodewords(version, level)
+	bits.write(0, min(4, 8*capacity-bits.n))
+	bits.write(0, (8-bits.n%8)%8)
+	for pad := 0xec; len(bits.b) < capacity; pad ^= 0xec ^ 0x11 {
+		bits.write(pad, 8)
+	}
+
+	lens := blockLens(version, level)
+	ec := ecCodewords[level][version]
+	blocks := make([][]byte, len(lens))
+	data := bits.b
+	for i, n := range lens {
+		blocks[i] = append(data[:n:n], rsEncode(data[:n], ec)...)
+		data = data[n:]
+	}
+	var out []byte
+	for _, at := range interleave(version, level) {
+		out = append(out, blocks[at[0]][at[1]])
+	}
+	return out
+}
+
+type bitWriter struct {
+	b []byte
+	n int // bits written
+}
+
+func (w *bitWriter) write(v, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v>>i&1 == 1 {
+			w.b[w.n/8] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+// bestMask picks the mask whose layout scores the lowest penalty: long runs
+// and blocks of one colour, finder-like patterns and an uneven balance of
+// dark and light.
+func bestMask(version int, level Level, text string) int {
+	best, bestScore := 0, -1
+	for m := 0; m < 8; m++ {
+		if s := penalty(encodeModules(version, level, m, text)); bestScore < 0 || s < bestScore {
+			best, bestScore = m, s
+		}
+	}
+	return best
+}
+
+func penalty(modules [][]bool) int {
+	n := len(modules)
+	at := func(r, c int, transpose bool) bool {
+		if transpose {
+			return modules[c][r]
+		}
+		return modules[r][c]
+	}
+	score, dark := 0, 0
+	for _, transpose := range []bool{false, true} {
+		for r := 0; r < n; r++ {
+			run := 0
+			for c := 0; c < n; c++ {
+				if c > 0 && at(r, c, transpose) == at(r, c-1, transpose) {
+					run++
+				} else {
+					run = 1
+				}
+				if run == 5 {
+					score += 3
+				} else if run > 5 {
+					score++
+				}
+				// 1:1:3:1:1 with four light modules on one side
+				if c >= 10 {
+					var line [11]bool
+					for k := range line {
+						line[k] = at(r, c-10+k, transpose)
+					}
+					if line == [11]bool{true, false, true, true, true, false, true, false, false, false, false} ||
+						line == [11]bool{false, false, false, false, true, false, true, true, true, false, true} {
+						score += 40
+					}
+				}
+			}
+		}
+	}
+	for r := 0; r < n; r++ {
+		for c := 0; c < n; c++ {
+			if modules[r][c] {
+				dark++
+			}
+			if r > 0 && c > 0 {
+				v := modules[r][c]
+				if modules[r-1][c] == v && modules[r][c-1] == v && modules[r-1][c-1] == v {
+					score += 3
+				}
+			}
+		}
+	}
+	return score + abs(dark*20-n*n*10)/(n*n)*10
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
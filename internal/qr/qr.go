@@ -0,0 +1,288 @@
+// Package qr reads and writes QR codes (model 2, versions 1 to 10, enough
+// for payloads of a couple of hundred bytes) without a dependency. Decode
+// finds the codes in a scanned page image:
+//
+//	for _, text := range qr.Decode(page) {
+//		fmt.Println(text)
+//	}
+//
+// and Encode draws one, such as a separator sheet to print:
+//
+//	img, err := qr.Encode("GODOCS-SEP:Bank", qr.M, 8)
+package qr
+
+// Level is an error correction level: L recovers about 7% of the
+// codewords, M 15%, Q 25% and H 30%.
+type Level int
+
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+// maxVersion is the largest version read or written.
+const maxVersion = 10
+
+// ecCodewords and ecBlocks are the error correction codewords per block and
+// the number of blocks for each level and version (ISO/IEC 18004 table 9).
+var ecCodewords = [4][maxVersion + 1]int{
+	L: {0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18},
+	M: {0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26},
+	Q: {0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24},
+	H: {0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28},
+}
+
+var ecBlocks = [4][maxVersion + 1]int{
+	L: {0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4},
+	M: {0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5},
+	Q: {0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8},
+	H: {0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8},
+}
+
+// formatLevel is the two bits that stand for each level in the format
+// information.
+var formatLevel = [4]int{L: 1, M: 0, Q: 3, H: 2}
+
+func size(version int) int { return 17 + 4*version }
+
+// codewords is the number of 8-bit codewords a version holds, data and
+// error correction together.
+func codewords(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n / 8
+}
+
+// dataCodewords is the number of data codewords at level.
+func dataCodewords(version int, level Level) int {
+	return codewords(version) - ecCodewords[level][version]*ecBlocks[level][version]
+}
+
+// alignmentCentres lists the rows (and columns) of the alignment patterns'
+// centres.
+func alignmentCentres(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*4 + n*2 + 1) / (n*2 - 2) * 2
+	centres := make([]int, n)
+	centres[0] = 6
+	for i, pos := n-1, size(version)-7; i > 0; i, pos = i-1, pos-step {
+		centres[i] = pos
+	}
+	return centres
+}
+
+// functionModules marks the modules of a version that are not data:
+// finders and their separators, timing, alignment, format and version
+// information.
+func functionModules(version int) [][]bool {
+	n := size(version)
+	fn := make([][]bool, n)
+	for i := range fn {
+		fn[i] = make([]bool, n)
+	}
+	fill := func(row, col, h, w int) {
+		for r := max(row, 0); r < min(row+h, n); r++ {
+			for c := max(col, 0); c < min(col+w, n); c++ {
+				fn[r][c] = true
+			}
+		}
+	}
+	// finders with their separators, and the format information beside them
+	fill(0, 0, 9, 9)
+	fill(0, n-8, 9, 8)
+	fill(n-8, 0, 8, 9)
+	// timing
+	fill(6, 0, 1, n)
+	fill(0, 6, n, 1)
+	centres := alignmentCentres(version)
+	for i, r := range centres {
+		for j, c := range centres {
+			if (i == 0 && j == 0) || (i == 0 && j == len(centres)-1) || (i == len(centres)-1 && j == 0) {
+				continue
+			}
+			fill(r-2, c-2, 5, 5)
+		}
+	}
+	if version >= 7 {
+		fill(0, n-11, 6, 3)
+		fill(n-11, 0, 3, 6)
+	}
+	return fn
+}
+
+// dataOrder lists the data modules as {row, col} in the order codeword
+// bits are placed: up and down two-column strips from the right, skipping
+// the vertical timing pattern.
+func dataOrder(version int) [][2]int {
+	n := size(version)
+	fn := functionModules(version)
+	var order [][2]int
+	for right := n - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < n; vert++ {
+			for j := 0; j < 2; j++ {
+				col := right - j
+				row := vert
+				if (right+1)&2 == 0 {
+					row = n - 1 - vert
+				}
+				if !fn[row][col] {
+					order = append(order, [2]int{row, col})
+				}
+			}
+		}
+	}
+	return order
+}
+
+// masked reports whether mask pattern m inverts the module at row, col.
+func masked(m, row, col int) bool {
+	switch m {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return row*col%2+row*col%3 == 0
+	case 6:
+		return (row*col%2+row*col%3)%2 == 0
+	default:
+		return ((row+col)%2+row*col%3)%2 == 0
+	}
+}
+
+// formatBits is the 15-bit format information for level and mask: five
+// data bits, a BCH(15,5) remainder, and the fixed XOR pattern.
+func formatBits(level Level, mask int) int {
+	data := formatLevel[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// formatPositions are the {row, col} of format bit i (0 the least
+// significant) in each of its two copies.
+func formatPositions(version int) (first, second [15][2]int) {
+	n := size(version)
+	for i := 0; i < 6; i++ {
+		first[i] = [2]int{i, 8}
+	}
+	first[6] = [2]int{7, 8}
+	first[7] = [2]int{8, 8}
+	first[8] = [2]int{8, 7}
+	for i := 9; i < 15; i++ {
+		first[i] = [2]int{8, 14 - i}
+	}
+	for i := 0; i < 8; i++ {
+		second[i] = [2]int{8, n - 1 - i}
+	}
+	for i := 8; i < 15; i++ {
+		second[i] = [2]int{n - 15 + i, 8}
+	}
+	return first, second
+}
+
+// versionBits is the 18-bit version information of versions 7 and up: six
+// data bits and a BCH(18,6) remainder.
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	return version<<12 | rem
+}
+
+// interleave returns the order in which the codewords of blocks, each data
+// then error correction, are placed: a column at a time, the short blocks
+// skipped where the long ones have their extra data codeword.
+func interleave(version int, level Level) [][2]int {
+	total, blocks, ec := codewords(version), ecBlocks[level][version], ecCodewords[level][version]
+	short := total / blocks
+	numShort := blocks - total%blocks
+	var order [][2]int // {block, index in block}
+	for i := 0; i <= short; i++ {
+		for b := 0; b < blocks; b++ {
+			if i == short-ec && b < numShort {
+				continue
+			}
+			j := i
+			if b < numShort && i > short-ec {
+				j--
+			}
+			order = append(order, [2]int{b, j})
+		}
+	}
+	return order
+}
+
+// blockLens returns the data codewords in each block.
+func blockLens(version int, level Level) []int {
+	total, blocks, ec := codewords(version), ecBlocks[level][version], ecCodewords[level][version]
+	short := total / blocks
+	numShort := blocks - total%blocks
+	lens := make([]int, blocks)
+	for b := range lens {
+		lens[b] = short - ec
+		if b >= numShort {
+			lens[b]++
+		}
+	}
+	return lens
+}
+
+// countBits is the width of a segment's character count field.
+func countBits(mode, version int) int {
+	long := version >= 10
+	switch mode {
+	case modeNumeric:
+		if long {
+			return 12
+		}
+		return 10
+	case modeAlphanumeric:
+		if long {
+			return 11
+		}
+		return 9
+	default:
+		if long {
+			return 16
+		}
+		return 8
+	}
+}
+
+// Segment modes.
+const (
+	modeNumeric      = 1
+	modeAlphanumeric = 2
+	modeStructured   = 3
+	modeByte         = 4
+	modeFNC1First    = 5
+	modeECI          = 7
+	modeKanji        = 8
+	modeFNC1Second   = 9
+)
+
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
@@ -0,0 +1,174 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// The error correction and format information of the "HELLO WORLD"
+// example in ISO/IEC 18004 annex I and the thonky.com QR tutorial.
+func TestPublishedVectors(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	if got, want := rsEncode(data, 10), []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}; !bytes.Equal(got, want) {
+		t.Errorf("1-M error correction = %v, want %v", got, want)
+	}
+	for _, tc := range []struct {
+		level Level
+		mask  int
+		want  int
+	}{
+		{L, 4, 0b110011000101111},
+		{M, 0, 0b101010000010010},
+		{H, 7, 0b000100000111011},
+	} {
+		if got := formatBits(tc.level, tc.mask); got != tc.want {
+			t.Errorf("format %d/%d = %015b, want %015b", tc.level, tc.mask, got, tc.want)
+		}
+	}
+	if got := versionBits(7); got != 0b000111110010010100 {
+		t.Errorf("version 7 information = %018b", got)
+	}
+	for v, want := range map[int]int{1: 26, 2: 44, 7: 196, 10: 346} {
+		if got := codewords(v); got != want {
+			t.Errorf("version %d holds %d codewords, want %d", v, got, want)
+		}
+	}
+	if got := alignmentCentres(10); !slices.Equal(got, []int{6, 28, 50}) {
+		t.Errorf("version 10 alignment = %v", got)
+	}
+}
+
+func TestCorrect(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, ec := range []int{7, 10, 18, 30} {
+		data := make([]byte, 40)
+		rng.Read(data)
+		block := append(slices.Clone(data), rsEncode(data, ec)...)
+		for errs := 0; errs <= ec/2; errs++ {
+			damaged := slices.Clone(block)
+			for _, i := range rng.Perm(len(block))[:errs] {
+				damaged[i] ^= byte(1 + rng.Intn(255))
+			}
+			if !rsCorrect(damaged, ec) || !bytes.Equal(damaged, block) {
+				t.Errorf("ec %d: %d errors not corrected", ec, errs)
+			}
+		}
+		damaged := slices.Clone(block)
+		for _, i := range rng.Perm(len(block))[:ec] {
+			damaged[i] ^= 0x5a
+		}
+		if rsCorrect(damaged, ec) && !bytes.Equal(damaged, block) {
+			t.Errorf("ec %d: %d errors miscorrected without complaint", ec, ec)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, level := range []Level{L, M, Q, H} {
+		for _, n := range []int{1, 10, 30, 60, 100, 150} {
+			text := fmt.Sprintf("GODOCS-SEP:%0*d", n, n)
+			img, err := Encode(text, level, 4)
+			if err != nil {
+				if n < 100 || level == L {
+					t.Errorf("level %d, %d bytes: %v", level, len(text), err)
+				}
+				continue
+			}
+			if got := Decode(img); !slices.Equal(got, []string{text}) {
+				t.Errorf("level %d, %d bytes: decoded %q", level, len(text), got)
+			}
+		}
+	}
+	if _, err := Encode(string(make([]byte, 300)), L, 1); err == nil {
+		t.Error("encoded 300 bytes")
+	}
+}
+
+func TestDecodePage(t *testing.T) {
+	code, err := Encode("GODOCS-SEP:Bank statements", M, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Encode("https://example.com/ünïcode", Q, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := image.NewGray(image.Rect(0, 0, 800, 1000))
+	for i := range page.Pix {
+		page.Pix[i] = 235 // off-white paper
+	}
+	// a shadow down the right-hand side
+	for y := 0; y < 1000; y++ {
+		for x := 500; x < 800; x++ {
+			page.Pix[y*800+x] = uint8(235 - (x-500)/3)
+		}
+	}
+	// lines of "text"
+	for y := 600; y < 900; y += 14 {
+		for x := 60; x < 740; x++ {
+			if x%9 < 6 {
+				page.Pix[y*800+x], page.Pix[(y+1)*800+x], page.Pix[(y+2)*800+x] = 40, 40, 40
+			}
+		}
+	}
+	draw.Draw(page, code.Bounds().Add(image.Pt(80, 80)), code, image.Point{}, draw.Over)
+	rotated := rotate(other, 0.3)
+	draw.Draw(page, rotated.Bounds().Add(image.Pt(420, 120)), rotated, image.Point{}, draw.Over)
+
+	got := Decode(page)
+	slices.Sort(got)
+	if want := []string{"GODOCS-SEP:Bank statements", "https://example.com/ünïcode"}; !slices.Equal(got, want) {
+		t.Errorf("decoded %q, want %q", got, want)
+	}
+	if got := Decode(image.NewGray(image.Rect(0, 0, 200, 200))); len(got) > 0 {
+		t.Errorf("decoded %q from a blank page", got)
+	}
+}
+
+func TestDecodeDamaged(t *testing.T) {
+	img, err := Encode("GODOCS-SEP:42", H, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a coffee ring through the data, well within level H's 30%
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if d := math.Hypot(float64(x-b.Dx()*3/5), float64(y-b.Dy()*3/5)); d > 18 && d < 26 {
+				img.SetGray(x, y, color.Gray{Y: 120})
+			}
+		}
+	}
+	if got := Decode(img); !slices.Equal(got, []string{"GODOCS-SEP:42"}) {
+		t.Errorf("decoded %q", got)
+	}
+}
+
+// rotate turns img by angle radians about its centre onto a white
+// background, with the nearest pixel.
+func rotate(img *image.Gray, angle float64) *image.Gray {
+	b := img.Bounds()
+	side := int(float64(max(b.Dx(), b.Dy())) * 1.5)
+	out := image.NewGray(image.Rect(0, 0, side, side))
+	sin, cos := math.Sincos(angle)
+	cx, cy := float64(b.Dx())/2, float64(b.Dy())/2
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			dx, dy := float64(x)-float64(side)/2, float64(y)-float64(side)/2
+			sx, sy := int(cos*dx+sin*dy+cx), int(-sin*dx+cos*dy+cy)
+			if image.Pt(sx, sy).In(b) {
+				out.Pix[y*side+x] = img.GrayAt(sx, sy).Y
+			} else {
+				out.Pix[y*side+x] = 255
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,183 @@
+package qr
+
+// Reed-Solomon coding over GF(256) with the QR code's field polynomial
+// x^8+x^4+x^3+x^2+1 and generator roots α^0 … α^(n-1).
+
+var gfExp [512]byte
+var gfLog [256]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// gfPow is α^e for any e, negative too.
+func gfPow(e int) byte {
+	e %= 255
+	if e < 0 {
+		e += 255
+	}
+	return gfExp[e]
+}
+
+// rsGenerator is the generator polynomial of degree n, highest power
+// first, without its leading 1.
+func rsGenerator(n int) []byte {
+	g := []byte{1}
+	for i := 0; i < n; i++ {
+		// multiply by (x + α^i)
+		next := make([]byte, len(g)+1)
+		copy(next, g)
+		for j := 1; j < len(next); j++ {
+			next[j] ^= gfMul(g[j-1], gfExp[i])
+		}
+		g = next
+	}
+	return g[1:]
+}
+
+// rsEncode returns the n error correction codewords for data.
+func rsEncode(data []byte, n int) []byte {
+	gen := rsGenerator(n)
+	ec := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ ec[0]
+		copy(ec, ec[1:])
+		ec[n-1] = 0
+		for i, g := range gen {
+			ec[i] ^= gfMul(g, factor)
+		}
+	}
+	return ec
+}
+
+// rsCorrect corrects up to n/2 errors in block, whose last n codewords are
+// error correction, in place. It reports false if the block has more errors
+// than that.
+func rsCorrect(block []byte, n int) bool {
+	// Syndromes S_i = r(α^i); block[j] is the coefficient of x^(len-1-j)
+	synd := make([]byte, n)
+	clean := true
+	for i := range synd {
+		var s byte
+		for _, b := range block {
+			s = gfMul(s, gfExp[i]) ^ b
+		}
+		synd[i] = s
+		clean = clean && s == 0
+	}
+	if clean {
+		return true
+	}
+
+	// Berlekamp-Massey for the error locator Λ, lowest power first
+	lambda, prev := []byte{1}, []byte{1}
+	errs, shift, last := 0, 1, byte(1)
+	for k := 0; k < n; k++ {
+		d := synd[k]
+		for i := 1; i <= errs && i < len(lambda); i++ {
+			d ^= gfMul(lambda[i], synd[k-i])
+		}
+		if d == 0 {
+			shift++
+			continue
+		}
+		scale := gfDiv(d, last)
+		next := make([]byte, max(len(lambda), len(prev)+shift))
+		copy(next, lambda)
+		for i, c := range prev {
+			next[i+shift] ^= gfMul(scale, c)
+		}
+		if 2*errs <= k {
+			prev, last = lambda, d
+			errs = k + 1 - errs
+			shift = 1
+		} else {
+			shift++
+		}
+		lambda = next
+	}
+	for len(lambda) > 1 && lambda[len(lambda)-1] == 0 {
+		lambda = lambda[:len(lambda)-1]
+	}
+	if errs != len(lambda)-1 || 2*errs > n {
+		return false
+	}
+
+	// Chien search: an error in the coefficient of x^p makes α^-p a root
+	var powers []int
+	for p := 0; p < len(block); p++ {
+		if evalLow(lambda, gfPow(-p)) == 0 {
+			powers = append(powers, p)
+		}
+	}
+	if len(powers) != errs {
+		return false
+	}
+
+	// Forney: Ω = SΛ mod x^n, e = X·Ω(X⁻¹)/Λ'(X⁻¹)
+	omega := make([]byte, n)
+	for i, s := range synd {
+		for j, l := range lambda {
+			if i+j < n {
+				omega[i+j] ^= gfMul(s, l)
+			}
+		}
+	}
+	deriv := make([]byte, len(lambda))
+	for i := 1; i < len(lambda); i += 2 {
+		deriv[i-1] = lambda[i]
+	}
+	for _, p := range powers {
+		xInv := gfPow(-p)
+		den := evalLow(deriv, xInv)
+		if den == 0 {
+			return false
+		}
+		block[len(block)-1-p] ^= gfMul(gfPow(p), gfDiv(evalLow(omega, xInv), den))
+	}
+
+	for i := 0; i < n; i++ {
+		var s byte
+		for _, b := range block {
+			s = gfMul(s, gfExp[i]) ^ b
+		}
+		if s != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// evalLow evaluates a polynomial given lowest power first at x.
+func evalLow(poly []byte, x byte) byte {
+	var y byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ poly[i]
+	}
+	return y
+}
@@ -0,0 +1,244 @@
+// Package s3 is a minimal client for Amazon S3 and compatible object stores
+// such as MinIO: it lists, fetches and deletes the objects of one bucket,
+// signing requests with AWS Signature Version 4, without a dependency:
+//
+//	c, err := s3.New(s3.Options{Endpoint: "http://minio.local:9000", Bucket: "scans",
+//		AccessKey: "inbox", SecretKey: "secret", PathStyle: true})
+//	if err != nil {
+//		return err
+//	}
+//	objects, err := c.List(ctx, "phone/")
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options configures a Client.
+type Options struct {
+	Endpoint  string // e.g. https://s3.eu-west-2.amazonaws.com or http://minio.local:9000
+	Region    string // default us-east-1
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool         // bucket in the path (MinIO) rather than the host name
+	Client    *http.Client // nil for http.DefaultClient
+}
+
+// Object is an entry in a bucket listing.
+type Object struct {
+	Key          string
+	ETag         string // changes when the object is rewritten
+	Size         int64
+	LastModified time.Time
+}
+
+// Client talks to one bucket. It is safe for concurrent use.
+type Client struct {
+	opts Options
+	base *url.URL // the bucket's root
+	now  func() time.Time
+}
+
+// emptyHash is the SHA-256 of an empty payload; no request has a body.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// New returns a client for opts.
+func New(opts Options) (*Client, error) {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	u, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("s3: endpoint %q must be an http:// or https:// URL", opts.Endpoint)
+	}
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("s3: no bucket")
+	}
+	if opts.PathStyle {
+		u.Path += "/" + opts.Bucket
+	} else {
+		u.Host = opts.Bucket + "." + u.Host
+	}
+	return &Client{opts: opts, base: u, now: time.Now}, nil
+}
+
+// listResult is a ListObjectsV2 response page.
+type listResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		ETag         string `xml:"ETag"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns every object whose key starts with prefix, in key order.
+func (c *Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	var out []Object
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, "GET", "", q)
+		if err != nil {
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: decoding listing: %w", err)
+		}
+		for _, o := range page.Contents {
+			t, _ := time.Parse(time.RFC3339, o.LastModified)
+			out = append(out, Object{Key: o.Key, ETag: strings.Trim(o.ETag, `"`), Size: o.Size, LastModified: t})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Get opens an object's content. The caller must close it.
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, "GET", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes an object.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, "DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for key (or the bucket, for "") and fails on
+// an error status.
+func (c *Client) do(ctx context.Context, method, key string, query url.Values) (*http.Response, error) {
+	u := *c.base
+	if key != "" {
+		u.Path += "/" + key
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.sign(req, c.now())
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %s %s: %w", method, key, err)
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3: %s %s failed (%d): %s", method, key, resp.StatusCode, errorCode(b))
+	}
+	return resp, nil
+}
+
+// errorCode picks the code and message out of an S3 error document.
+func errorCode(b []byte) string {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(b, &e) != nil || e.Code == "" {
+		return strings.TrimSpace(string(b))
+	}
+	return e.Code + ": " + e.Message
+}
+
+// sign adds the Signature Version 4 headers to req.
+func (c *Client) sign(req *http.Request, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	day := stamp[:8]
+	req.Header.Set("x-amz-date", stamp)
+	req.Header.Set("x-amz-content-sha256", emptyHash)
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + emptyHash + "\nx-amz-date:" + stamp + "\n",
+		"host;x-amz-content-sha256;x-amz-date",
+		emptyHash,
+	}, "\n")
+	scope := day + "/" + c.opts.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.opts.SecretKey), day)
+	key = hmacSHA256(key, c.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.opts.AccessKey+"/"+scope+
+		", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes a query string as Signature Version 4 wants it:
+// sorted by name, with every reserved character escaped.
+func canonicalQuery(q url.Values) string {
+	var parts []string
+	for k, vs := range q {
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but unreserved characters, and "/" too
+// unless it separates path segments.
+func uriEncode(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~', ch == '/' && !slash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,1033 @@
+// Package store persists inbox state that would otherwise be lost on restart
+// (LLM-set dates, job failures, per-user session state, extracted document
+// fields, duplicate-detection hashes, text embeddings, document notes,
+// snoozed documents, where OCR text lies on the page, LLM usage, files
+// uploaded by ingestion sources, days the triage goal was met and the tagging
+// action journal) in a single SQLite database.
+package store
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// migrations are applied in order; the schema version is PRAGMA user_version.
+// Never edit an entry once released, append a new one instead.
+var migrations = []string{
+	`CREATE TABLE llm_dates (
+		ulid   TEXT PRIMARY KEY,
+		set_at TEXT NOT NULL
+	);
+	CREATE TABLE failures (
+		ulid     TEXT PRIMARY KEY,
+		stage    TEXT NOT NULL,
+		doc_type TEXT NOT NULL DEFAULT '',
+		error    TEXT NOT NULL,
+		attempts INTEGER NOT NULL,
+		time     TEXT NOT NULL
+	);
+	CREATE TABLE actions (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		time     TEXT NOT NULL,
+		user     TEXT NOT NULL DEFAULT '',
+		action   TEXT NOT NULL,
+		ulid     TEXT NOT NULL DEFAULT '',
+		doc_name TEXT NOT NULL DEFAULT '',
+		tag_id   INTEGER NOT NULL DEFAULT 0,
+		tag_name TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX actions_time ON actions(time);
+	CREATE TABLE user_state (
+		user  TEXT NOT NULL,
+		key   TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (user, key)
+	);`,
+	`CREATE TABLE fields (
+		ulid         TEXT PRIMARY KEY,
+		amount       TEXT NOT NULL,
+		currency     TEXT NOT NULL DEFAULT '',
+		vendor       TEXT NOT NULL DEFAULT '',
+		date         TEXT NOT NULL DEFAULT '',
+		extracted_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE hashes (
+		ulid      TEXT PRIMARY KEY,
+		name      TEXT NOT NULL DEFAULT '',
+		sha256    TEXT NOT NULL,
+		phash     INTEGER,
+		hashed_at TEXT NOT NULL
+	);
+	CREATE INDEX hashes_sha256 ON hashes(sha256);`,
+	`CREATE TABLE embeddings (
+		ulid       TEXT PRIMARY KEY,
+		model      TEXT NOT NULL,
+		vector     BLOB NOT NULL,
+		tag_ids    TEXT NOT NULL DEFAULT '[]',
+		updated_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE notes (
+		ulid       TEXT PRIMARY KEY,
+		note       TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE snoozes (
+		ulid       TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		until      TEXT NOT NULL,
+		user       TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE ocr_quality (
+		ulid       TEXT PRIMARY KEY,
+		confidence REAL NOT NULL,
+		words      INTEGER NOT NULL,
+		reviewed   INTEGER NOT NULL DEFAULT 0,
+		scored_at  TEXT NOT NULL
+	);`,
+	`CREATE TABLE date_candidates (
+		ulid        TEXT PRIMARY KEY,
+		candidates  TEXT NOT NULL,
+		inferred_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE summaries (
+		ulid       TEXT PRIMARY KEY,
+		summary    TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE languages (
+		ulid          TEXT PRIMARY KEY,
+		lang          TEXT NOT NULL,
+		translated_to TEXT NOT NULL DEFAULT '',
+		translation   TEXT NOT NULL DEFAULT '',
+		detected_at   TEXT NOT NULL
+	);`,
+	`CREATE TABLE ingested (
+		source      TEXT NOT NULL,
+		key         TEXT NOT NULL,
+		version     TEXT NOT NULL DEFAULT '',
+		ulid        TEXT NOT NULL,
+		tag_id      INTEGER NOT NULL DEFAULT 0,
+		tagged      INTEGER NOT NULL DEFAULT 0,
+		ingested_at TEXT NOT NULL,
+		PRIMARY KEY (source, key)
+	);`,
+	`CREATE TABLE goal_days (
+		day    TEXT PRIMARY KEY,
+		tagged INTEGER NOT NULL,
+		goal   INTEGER NOT NULL,
+		met_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE ocr_lines (
+		ulid       TEXT PRIMARY KEY,
+		lines      TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE llm_usage (
+		day           TEXT NOT NULL,
+		model         TEXT NOT NULL,
+		calls         INTEGER NOT NULL,
+		prompt_tokens INTEGER NOT NULL,
+		output_tokens INTEGER NOT NULL,
+		millis        INTEGER NOT NULL,
+		PRIMARY KEY (day, model)
+	);`,
+	`CREATE TABLE tag_proposals (
+		name       TEXT PRIMARY KEY COLLATE NOCASE,
+		tag_group  TEXT NOT NULL,
+		color      TEXT NOT NULL,
+		reason     TEXT NOT NULL,
+		docs       TEXT NOT NULL,
+		rejected   INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE tags_proposed (
+		ulid     TEXT PRIMARY KEY,
+		asked_at TEXT NOT NULL
+	);`,
+}
+
+// Store is a handle on the state database. It is safe for concurrent use.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens (creating if needed) the database at path and migrates it to
+// the latest schema.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for v := version; v < len(migrations); v++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+// --- LLM dates ---
+
+// SetLLMDate records that the document's date was set by the LLM.
+func (s *Store) SetLLMDate(ulid string) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO llm_dates (ulid, set_at) VALUES (?, ?)`, ulid, formatTime(time.Now()))
+	return err
+}
+
+func (s *Store) DeleteLLMDate(ulid string) error {
+	_, err := s.db.Exec(`DELETE FROM llm_dates WHERE ulid = ?`, ulid)
+	return err
+}
+
+// LLMDates returns the ULIDs whose date was set by the LLM.
+func (s *Store) LLMDates() ([]string, error) {
+	rows, err := s.db.Query(`SELECT ulid FROM llm_dates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var ulid string
+		if err := rows.Scan(&ulid); err != nil {
+			return nil, err
+		}
+		out = append(out, ulid)
+	}
+	return out, rows.Err()
+}
+
+// --- Job failures ---
+
+// Failure is a failed background job for one document.
+type Failure struct {
+	ULID     string
+	Stage    string
+	DocType  string
+	Error    string
+	Attempts int
+	Time     time.Time
+}
+
+func (s *Store) PutFailure(f Failure) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO failures (ulid, stage, doc_type, error, attempts, time) VALUES (?, ?, ?, ?, ?, ?)`,
+		f.ULID, f.Stage, f.DocType, f.Error, f.Attempts, formatTime(f.Time))
+	return err
+}
+
+func (s *Store) DeleteFailure(ulid string) error {
+	_, err := s.db.Exec(`DELETE FROM failures WHERE ulid = ?`, ulid)
+	return err
+}
+
+func (s *Store) Failures() ([]Failure, error) {
+	rows, err := s.db.Query(`SELECT ulid, stage, doc_type, error, attempts, time FROM failures`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Failure
+	for rows.Next() {
+		var f Failure
+		var t string
+		if err := rows.Scan(&f.ULID, &f.Stage, &f.DocType, &f.Error, &f.Attempts, &t); err != nil {
+			return nil, err
+		}
+		f.Time = parseTime(t)
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// --- Action journal ---
+
+// Action is one tagging action in the journal.
+type Action struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user,omitempty"`
+	Action  string    `json:"action"`
+	ULID    string    `json:"ulid,omitempty"`
+	DocName string    `json:"doc_name,omitempty"`
+	TagID   int       `json:"tag_id,omitempty"`
+	TagName string    `json:"tag_name"`
+}
+
+func (s *Store) AddAction(a Action) error {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	_, err := s.db.Exec(`INSERT INTO actions (time, user, action, ulid, doc_name, tag_id, tag_name) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		formatTime(a.Time), a.User, a.Action, a.ULID, a.DocName, a.TagID, a.TagName)
+	return err
+}
+
+// Actions returns journal entries at or after since, oldest first. A zero
+// since returns the whole journal.
+func (s *Store) Actions(since time.Time) ([]Action, error) {
+	rows, err := s.db.Query(`SELECT time, user, action, ulid, doc_name, tag_id, tag_name FROM actions WHERE time >= ? ORDER BY id`, formatTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Action
+	for rows.Next() {
+		var a Action
+		var t string
+		if err := rows.Scan(&t, &a.User, &a.Action, &a.ULID, &a.DocName, &a.TagID, &a.TagName); err != nil {
+			return nil, err
+		}
+		a.Time = parseTime(t)
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// ImportActions adds journal entries from another journal, such as an
+// export from a previous machine, skipping any already recorded. It returns
+// the number added.
+func (s *Store) ImportActions(actions []Action) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	added := 0
+	for _, a := range actions {
+		var n int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM actions WHERE time = ? AND user = ? AND action = ? AND ulid = ? AND tag_id = ? AND tag_name = ?`,
+			formatTime(a.Time), a.User, a.Action, a.ULID, a.TagID, a.TagName).Scan(&n)
+		if err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO actions (time, user, action, ulid, doc_name, tag_id, tag_name) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			formatTime(a.Time), a.User, a.Action, a.ULID, a.DocName, a.TagID, a.TagName); err != nil {
+			return 0, err
+		}
+		added++
+	}
+	return added, tx.Commit()
+}
+
+// --- Extracted fields ---
+
+// DocFields are bookkeeping fields extracted from a document.
+type DocFields struct {
+	Amount   string
+	Currency string
+	Vendor   string
+	Date     string
+}
+
+func (s *Store) PutFields(ulid string, f DocFields) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO fields (ulid, amount, currency, vendor, date, extracted_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		ulid, f.Amount, f.Currency, f.Vendor, f.Date, formatTime(time.Now()))
+	return err
+}
+
+// Fields returns the extracted fields for ulid, or nil if none are stored.
+func (s *Store) Fields(ulid string) (*DocFields, error) {
+	var f DocFields
+	err := s.db.QueryRow(`SELECT amount, currency, vendor, date FROM fields WHERE ulid = ?`, ulid).Scan(&f.Amount, &f.Currency, &f.Vendor, &f.Date)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// --- Duplicate detection ---
+
+// DocHash identifies a document's content: SHA256 of the file and, when a
+// first-page image could be rendered, its perceptual hash.
+type DocHash struct {
+	ULID     string
+	Name     string
+	SHA256   string
+	PHash    uint64
+	HasPHash bool
+}
+
+func (s *Store) PutHash(h DocHash) error {
+	var phash any
+	if h.HasPHash {
+		phash = int64(h.PHash)
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO hashes (ulid, name, sha256, phash, hashed_at) VALUES (?, ?, ?, ?, ?)`,
+		h.ULID, h.Name, h.SHA256, phash, formatTime(time.Now()))
+	return err
+}
+
+func (s *Store) DeleteHash(ulid string) error {
+	_, err := s.db.Exec(`DELETE FROM hashes WHERE ulid = ?`, ulid)
+	return err
+}
+
+// Hashes returns every stored document hash.
+func (s *Store) Hashes() ([]DocHash, error) {
+	rows, err := s.db.Query(`SELECT ulid, name, sha256, phash FROM hashes`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DocHash
+	for rows.Next() {
+		var h DocHash
+		var phash sql.NullInt64
+		if err := rows.Scan(&h.ULID, &h.Name, &h.SHA256, &phash); err != nil {
+			return nil, err
+		}
+		h.PHash, h.HasPHash = uint64(phash.Int64), phash.Valid
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// --- Embeddings ---
+
+// Embedding is a document's text embedding and, once it has been tagged,
+// its tag IDs.
+type Embedding struct {
+	ULID   string
+	Model  string
+	Vector []float32
+	TagIDs []int
+}
+
+func (s *Store) PutEmbedding(e Embedding) error {
+	tags, err := json.Marshal(e.TagIDs)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4*len(e.Vector))
+	for i, v := range e.Vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO embeddings (ulid, model, vector, tag_ids, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		e.ULID, e.Model, buf, string(tags), formatTime(time.Now()))
+	return err
+}
+
+// Embeddings returns every stored embedding made with model.
+func (s *Store) Embeddings(model string) ([]Embedding, error) {
+	rows, err := s.db.Query(`SELECT ulid, vector, tag_ids FROM embeddings WHERE model = ?`, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Embedding
+	for rows.Next() {
+		e := Embedding{Model: model}
+		var buf []byte
+		var tags string
+		if err := rows.Scan(&e.ULID, &buf, &tags); err != nil {
+			return nil, err
+		}
+		e.Vector = make([]float32, len(buf)/4)
+		for i := range e.Vector {
+			e.Vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+		}
+		if err := json.Unmarshal([]byte(tags), &e.TagIDs); err != nil {
+			return nil, fmt.Errorf("embedding %s: %w", e.ULID, err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// --- Notes ---
+
+// SetNote stores a free-text note on a document; an empty note deletes it.
+func (s *Store) SetNote(ulid, note string) error {
+	if note == "" {
+		_, err := s.db.Exec(`DELETE FROM notes WHERE ulid = ?`, ulid)
+		return err
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO notes (ulid, note, updated_at) VALUES (?, ?, ?)`, ulid, note, formatTime(time.Now()))
+	return err
+}
+
+// Note returns the note on ulid, or "" if there is none.
+func (s *Store) Note(ulid string) (string, error) {
+	var note string
+	err := s.db.QueryRow(`SELECT note FROM notes WHERE ulid = ?`, ulid).Scan(&note)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return note, err
+}
+
+// --- Snoozes ---
+
+// Snooze holds a document out of the inbox queue until a wake time.
+type Snooze struct {
+	ULID    string
+	Name    string
+	Until   time.Time
+	User    string
+	Created time.Time
+}
+
+func (s *Store) PutSnooze(z Snooze) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO snoozes (ulid, name, until, user, created_at) VALUES (?, ?, ?, ?, ?)`,
+		z.ULID, z.Name, formatTime(z.Until), z.User, formatTime(z.Created))
+	return err
+}
+
+func (s *Store) DeleteSnooze(ulid string) error {
+	_, err := s.db.Exec(`DELETE FROM snoozes WHERE ulid = ?`, ulid)
+	return err
+}
+
+// Snoozes returns every snoozed document, soonest wake time first.
+func (s *Store) Snoozes() ([]Snooze, error) {
+	rows, err := s.db.Query(`SELECT ulid, name, until, user, created_at FROM snoozes ORDER BY until`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Snooze
+	for rows.Next() {
+		var z Snooze
+		var until, created string
+		if err := rows.Scan(&z.ULID, &z.Name, &until, &z.User, &created); err != nil {
+			return nil, err
+		}
+		z.Until, z.Created = parseTime(until), parseTime(created)
+		out = append(out, z)
+	}
+	return out, rows.Err()
+}
+
+// --- OCR quality ---
+
+// OCRQuality is tesseract's mean word confidence for a document's OCR text.
+// Reviewed is set once a low score has been looked at in the review queue.
+type OCRQuality struct {
+	ULID       string
+	Confidence float64
+	Words      int
+	Reviewed   bool
+	Time       time.Time
+}
+
+func (s *Store) PutOCRQuality(q OCRQuality) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO ocr_quality (ulid, confidence, words, reviewed, scored_at) VALUES (?, ?, ?, ?, ?)`,
+		q.ULID, q.Confidence, q.Words, q.Reviewed, formatTime(q.Time))
+	return err
+}
+
+// OCRQualities returns every stored OCR quality score.
+func (s *Store) OCRQualities() ([]OCRQuality, error) {
+	rows, err := s.db.Query(`SELECT ulid, confidence, words, reviewed, scored_at FROM ocr_quality`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []OCRQuality
+	for rows.Next() {
+		var q OCRQuality
+		var t string
+		if err := rows.Scan(&q.ULID, &q.Confidence, &q.Words, &q.Reviewed, &t); err != nil {
+			return nil, err
+		}
+		q.Time = parseTime(t)
+		out = append(out, q)
+	}
+	return out, rows.Err()
+}
+
+// OCRLine is a line of OCR text and its box on the page, as fractions of
+// the page's width and height.
+type OCRLine struct {
+	Text   string  `json:"text"`
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// PutOCRLines stores where the lines of ulid's OCR text are on its page,
+// replacing any from an earlier OCR.
+func (s *Store) PutOCRLines(ulid string, lines []OCRLine) error {
+	b, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO ocr_lines (ulid, lines, created_at) VALUES (?, ?, ?)`,
+		ulid, string(b), formatTime(time.Now()))
+	return err
+}
+
+func (s *Store) DeleteOCRLines(ulid string) error {
+	_, err := s.db.Exec(`DELETE FROM ocr_lines WHERE ulid = ?`, ulid)
+	return err
+}
+
+// OCRLines returns the stored line positions of ulid's OCR text, or nil.
+func (s *Store) OCRLines(ulid string) ([]OCRLine, error) {
+	var b string
+	err := s.db.QueryRow(`SELECT lines FROM ocr_lines WHERE ulid = ?`, ulid).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lines []OCRLine
+	if err := json.Unmarshal([]byte(b), &lines); err != nil {
+		return nil, fmt.Errorf("OCR lines %s: %w", ulid, err)
+	}
+	return lines, nil
+}
+
+// --- Date candidates ---
+
+// DateCandidate is one of the dates the LLM found in a document, ranked by
+// its confidence that it is the document date.
+type DateCandidate struct {
+	Date       string  `json:"date"`
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+// PutDateCandidates stores the ranked date candidates for ulid, replacing
+// any from an earlier inference.
+func (s *Store) PutDateCandidates(ulid string, candidates []DateCandidate) error {
+	b, err := json.Marshal(candidates)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO date_candidates (ulid, candidates, inferred_at) VALUES (?, ?, ?)`,
+		ulid, string(b), formatTime(time.Now()))
+	return err
+}
+
+func (s *Store) DeleteDateCandidates(ulid string) error {
+	_, err := s.db.Exec(`DELETE FROM date_candidates WHERE ulid = ?`, ulid)
+	return err
+}
+
+// DateCandidates returns the stored date candidates by ULID.
+func (s *Store) DateCandidates() (map[string][]DateCandidate, error) {
+	rows, err := s.db.Query(`SELECT ulid, candidates FROM date_candidates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string][]DateCandidate)
+	for rows.Next() {
+		var ulid, b string
+		if err := rows.Scan(&ulid, &b); err != nil {
+			return nil, err
+		}
+		var cands []DateCandidate
+		if err := json.Unmarshal([]byte(b), &cands); err != nil {
+			return nil, fmt.Errorf("date candidates %s: %w", ulid, err)
+		}
+		out[ulid] = cands
+	}
+	return out, rows.Err()
+}
+
+// --- Summaries ---
+
+func (s *Store) PutSummary(ulid, summary string) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO summaries (ulid, summary, created_at) VALUES (?, ?, ?)`,
+		ulid, summary, formatTime(time.Now()))
+	return err
+}
+
+// Summaries returns every stored document summary by ULID.
+func (s *Store) Summaries() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT ulid, summary FROM summaries`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var ulid, summary string
+		if err := rows.Scan(&ulid, &summary); err != nil {
+			return nil, err
+		}
+		out[ulid] = summary
+	}
+	return out, rows.Err()
+}
+
+// --- Languages ---
+
+// DocLanguage is the detected language of a document's text and, when it
+// was translated for the preview, the target language and translation.
+type DocLanguage struct {
+	ULID         string
+	Lang         string // ISO 639-1 code, "" if undetermined
+	TranslatedTo string
+	Translation  string
+}
+
+func (s *Store) PutLanguage(l DocLanguage) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO languages (ulid, lang, translated_to, translation, detected_at) VALUES (?, ?, ?, ?, ?)`,
+		l.ULID, l.Lang, l.TranslatedTo, l.Translation, formatTime(time.Now()))
+	return err
+}
+
+// Languages returns every stored document language.
+func (s *Store) Languages() ([]DocLanguage, error) {
+	rows, err := s.db.Query(`SELECT ulid, lang, translated_to, translation FROM languages`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DocLanguage
+	for rows.Next() {
+		var l DocLanguage
+		if err := rows.Scan(&l.ULID, &l.Lang, &l.TranslatedTo, &l.Translation); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// --- Ingested files ---
+
+// Ingested is a file an ingestion source uploaded to godocs. Version (an
+// ETag or revision) tells a rewritten file from the one already uploaded.
+// TagID is the source's tag, added once the document has been triaged.
+type Ingested struct {
+	Source  string
+	Key     string
+	Version string
+	ULID    string
+	TagID   int
+	Tagged  bool
+	Time    time.Time
+}
+
+func (s *Store) PutIngested(i Ingested) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO ingested (source, key, version, ulid, tag_id, tagged, ingested_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		i.Source, i.Key, i.Version, i.ULID, i.TagID, i.Tagged, formatTime(i.Time))
+	return err
+}
+
+// IngestedVersions returns the version of each file a source has uploaded,
+// by key.
+func (s *Store) IngestedVersions(source string) (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, version FROM ingested WHERE source = ?`, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var key, version string
+		if err := rows.Scan(&key, &version); err != nil {
+			return nil, err
+		}
+		out[key] = version
+	}
+	return out, rows.Err()
+}
+
+// UntaggedIngests returns the ingested files whose source tag has not been
+// added yet.
+func (s *Store) UntaggedIngests() ([]Ingested, error) {
+	rows, err := s.db.Query(`SELECT source, key, version, ulid, tag_id, ingested_at FROM ingested WHERE tag_id != 0 AND tagged = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Ingested
+	for rows.Next() {
+		var i Ingested
+		var at string
+		if err := rows.Scan(&i.Source, &i.Key, &i.Version, &i.ULID, &i.TagID, &at); err != nil {
+			return nil, err
+		}
+		i.Time = parseTime(at)
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+// IngestedDoc returns the ingested file that became document ulid, or nil.
+func (s *Store) IngestedDoc(ulid string) (*Ingested, error) {
+	var i Ingested
+	var at string
+	err := s.db.QueryRow(`SELECT source, key, version, ulid, tag_id, tagged, ingested_at FROM ingested WHERE ulid = ?`, ulid).
+		Scan(&i.Source, &i.Key, &i.Version, &i.ULID, &i.TagID, &i.Tagged, &at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	i.Time = parseTime(at)
+	return &i, nil
+}
+
+// MoveIngested points an ingested file at the document that replaced the
+// one it was uploaded as.
+func (s *Store) MoveIngested(from, to string) error {
+	_, err := s.db.Exec(`UPDATE ingested SET ulid = ? WHERE ulid = ?`, to, from)
+	return err
+}
+
+// SetIngestTagged records whether the source tag is on the document.
+func (s *Store) SetIngestTagged(ulid string, tagged bool) error {
+	_, err := s.db.Exec(`UPDATE ingested SET tagged = ? WHERE ulid = ?`, tagged, ulid)
+	return err
+}
+
+// --- Daily goals ---
+
+// GoalDay is a day on which the daily triage goal was met. Day is the local
+// date, YYYY-MM-DD; Tagged and Goal are as they stood when it was met.
+type GoalDay struct {
+	Day    string
+	Tagged int
+	Goal   int
+	Time   time.Time
+}
+
+// PutGoalDay records a day the goal was met. A day already recorded keeps
+// the time it was first met.
+func (s *Store) PutGoalDay(g GoalDay) error {
+	_, err := s.db.Exec(`INSERT INTO goal_days (day, tagged, goal, met_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (day) DO UPDATE SET tagged = excluded.tagged`,
+		g.Day, g.Tagged, g.Goal, formatTime(g.Time))
+	return err
+}
+
+// GoalDays returns the days the goal was met, newest first.
+func (s *Store) GoalDays() ([]GoalDay, error) {
+	rows, err := s.db.Query(`SELECT day, tagged, goal, met_at FROM goal_days ORDER BY day DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []GoalDay
+	for rows.Next() {
+		var g GoalDay
+		var at string
+		if err := rows.Scan(&g.Day, &g.Tagged, &g.Goal, &at); err != nil {
+			return nil, err
+		}
+		g.Time = parseTime(at)
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// --- LLM usage ---
+
+// LLMUsage is a day's LLM requests to one model: how many, the tokens read
+// and written, and the time they took. Day is the local date, YYYY-MM-DD.
+type LLMUsage struct {
+	Day          string
+	Model        string
+	Calls        int
+	PromptTokens int
+	OutputTokens int
+	Duration     time.Duration
+}
+
+// AddLLMUsage adds u to the day's totals for its model.
+func (s *Store) AddLLMUsage(u LLMUsage) error {
+	_, err := s.db.Exec(`INSERT INTO llm_usage (day, model, calls, prompt_tokens, output_tokens, millis) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (day, model) DO UPDATE SET calls = calls + excluded.calls, prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			output_tokens = output_tokens + excluded.output_tokens, millis = millis + excluded.millis`,
+		u.Day, u.Model, u.Calls, u.PromptTokens, u.OutputTokens, u.Duration.Milliseconds())
+	return err
+}
+
+// LLMUsageSince returns the usage from day (YYYY-MM-DD) on, newest day
+// first, then by model.
+func (s *Store) LLMUsageSince(day string) ([]LLMUsage, error) {
+	rows, err := s.db.Query(`SELECT day, model, calls, prompt_tokens, output_tokens, millis FROM llm_usage WHERE day >= ? ORDER BY day DESC, model`, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []LLMUsage
+	for rows.Next() {
+		var u LLMUsage
+		var millis int64
+		if err := rows.Scan(&u.Day, &u.Model, &u.Calls, &u.PromptTokens, &u.OutputTokens, &millis); err != nil {
+			return nil, err
+		}
+		u.Duration = time.Duration(millis) * time.Millisecond
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// --- Tag proposals ---
+
+// TagProposal is a tag the LLM suggested that the server lacks, waiting to
+// be approved, with the documents it was suggested for. A rejected
+// proposal is kept so the tag is not proposed again. Names are unique
+// regardless of case.
+type TagProposal struct {
+	Name     string
+	Group    string
+	Color    string
+	Reason   string
+	Docs     []ProposalDoc
+	Rejected bool
+	Created  time.Time
+}
+
+// ProposalDoc is a document a tag was proposed for.
+type ProposalDoc struct {
+	ULID string `json:"ulid"`
+	Name string `json:"name"`
+}
+
+func (s *Store) PutTagProposal(p TagProposal) error {
+	b, err := json.Marshal(p.Docs)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO tag_proposals (name, tag_group, color, reason, docs, rejected, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.Name, p.Group, p.Color, p.Reason, string(b), p.Rejected, formatTime(p.Created))
+	return err
+}
+
+func (s *Store) DeleteTagProposal(name string) error {
+	_, err := s.db.Exec(`DELETE FROM tag_proposals WHERE name = ?`, name)
+	return err
+}
+
+// SetTagsProposed records that the LLM was asked for new tags for ulid.
+func (s *Store) SetTagsProposed(ulid string) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO tags_proposed (ulid, asked_at) VALUES (?, ?)`, ulid, formatTime(time.Now()))
+	return err
+}
+
+// TagsProposed returns the ULIDs the LLM was asked for new tags for.
+func (s *Store) TagsProposed() ([]string, error) {
+	rows, err := s.db.Query(`SELECT ulid FROM tags_proposed`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var ulid string
+		if err := rows.Scan(&ulid); err != nil {
+			return nil, err
+		}
+		out = append(out, ulid)
+	}
+	return out, rows.Err()
+}
+
+// TagProposals returns every tag proposal, rejected ones included, oldest
+// first.
+func (s *Store) TagProposals() ([]TagProposal, error) {
+	rows, err := s.db.Query(`SELECT name, tag_group, color, reason, docs, rejected, created_at FROM tag_proposals ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []TagProposal
+	for rows.Next() {
+		var p TagProposal
+		var docs, created string
+		if err := rows.Scan(&p.Name, &p.Group, &p.Color, &p.Reason, &docs, &p.Rejected, &created); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(docs), &p.Docs); err != nil {
+			return nil, fmt.Errorf("tag proposal %s: %w", p.Name, err)
+		}
+		p.Created = parseTime(created)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// --- Per-user state ---
+
+// PutUserState stores v as JSON under (user, key).
+func (s *Store) PutUserState(user, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO user_state (user, key, value) VALUES (?, ?, ?)`, user, key, string(b))
+	return err
+}
+
+// UserState decodes the JSON stored under (user, key) into v. It reports
+// false if nothing is stored.
+func (s *Store) UserState(user, key string, v any) (bool, error) {
+	var b string
+	err := s.db.QueryRow(`SELECT value FROM user_state WHERE user = ? AND key = ?`, user, key).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(b), v)
+}
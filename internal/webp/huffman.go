@@ -0,0 +1,363 @@
+package webp
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+)
+
+// Entropy coding: each image is a run of tokens, a literal pixel or a copy
+// of earlier pixels, written with five Huffman codes (green and copy
+// lengths, red, blue, alpha, and copy distances).
+
+const (
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+	minMatch         = 3
+	maxMatch         = 4096
+	maxDistance      = 1<<20 - 120 // the largest the distance codes reach
+	chainDepth       = 16
+	hashBits         = 16
+)
+
+// codeLengthOrder is the order the code length code's lengths are written.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// token is a literal pixel when length is 0, else a copy of length pixels
+// from distance back.
+type token struct {
+	pixel    uint32
+	length   int
+	distance int
+}
+
+// writeImage codes pix, width pixels across. The main image also says it
+// uses one set of Huffman codes for every tile.
+func writeImage(bw *bitWriter, pix []uint32, width int, main bool) {
+	bw.write(0, 1) // no colour cache
+	if main {
+		bw.write(0, 1) // no meta prefix codes
+	}
+	tokens := lz77(pix, width)
+
+	green := make([]int, 256+numLengthCodes)
+	red, blue, alpha := make([]int, 256), make([]int, 256), make([]int, 256)
+	distance := make([]int, numDistanceCodes)
+	for _, t := range tokens {
+		if t.length == 0 {
+			green[t.pixel>>8&0xff]++
+			red[t.pixel>>16&0xff]++
+			blue[t.pixel&0xff]++
+			alpha[t.pixel>>24]++
+			continue
+		}
+		l, _, _ := prefixEncode(t.length)
+		d, _, _ := prefixEncode(distanceCode(t.distance, width))
+		green[256+l]++
+		distance[d]++
+	}
+	codes := [5]prefixCode{}
+	for i, counts := range [][]int{green, red, blue, alpha, distance} {
+		codes[i] = writeCode(bw, counts)
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].write(bw, int(t.pixel>>8&0xff))
+			codes[1].write(bw, int(t.pixel>>16&0xff))
+			codes[2].write(bw, int(t.pixel&0xff))
+			codes[3].write(bw, int(t.pixel>>24))
+			continue
+		}
+		l, n, extra := prefixEncode(t.length)
+		codes[0].write(bw, 256+l)
+		bw.write(uint32(extra), uint(n))
+		d, n, extra := prefixEncode(distanceCode(t.distance, width))
+		codes[4].write(bw, d)
+		bw.write(uint32(extra), uint(n))
+	}
+}
+
+// distanceCode is the code for a copy distance: the two nearest pixels,
+// left and above, have short codes of their own, and the rest follow the
+// 120 codes for the neighbourhood.
+func distanceCode(distance, width int) int {
+	switch distance {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return distance + 120
+}
+
+// prefixEncode splits a copy length or distance code, from 1, into its
+// prefix symbol and the extra bits after it.
+func prefixEncode(v int) (symbol, extraBits, extra int) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := bits.Len(uint(d)) - 1
+	return 2*h + d>>(h-1)&1, h - 1, d & (1<<(h-1) - 1)
+}
+
+// lz77 splits pix into literals and copies, trying the pixel to the left,
+// the one above and recent places the next two pixels were seen.
+func lz77(pix []uint32, width int) []token {
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, len(pix))
+	hash := func(i int) uint32 {
+		return (pix[i]*0x1e35a7bd ^ pix[i+1]*0x9e3779b1) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < len(pix) {
+			h := hash(i)
+			prev[i], head[h] = head[h], int32(i)
+		}
+	}
+
+	var tokens []token
+	for i := 0; i < len(pix); {
+		bestLen, bestDist := 0, 0
+		try := func(dist int) {
+			if dist < 1 || dist > i || dist > maxDistance {
+				return
+			}
+			n, limit := 0, min(maxMatch, len(pix)-i)
+			for n < limit && pix[i+n] == pix[i-dist+n] {
+				n++
+			}
+			if n > bestLen {
+				bestLen, bestDist = n, dist
+			}
+		}
+		try(1)
+		try(width)
+		if i+1 < len(pix) {
+			for j, depth := head[hash(i)], 0; j >= 0 && depth < chainDepth && bestLen < maxMatch; j, depth = prev[j], depth+1 {
+				try(i - int(j))
+			}
+		}
+		if bestLen < minMatch {
+			tokens = append(tokens, token{pixel: pix[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, token{length: bestLen, distance: bestDist})
+		for end := i + bestLen; i < end; i++ {
+			insert(i)
+		}
+	}
+	return tokens
+}
+
+// prefixCode is a Huffman code, bit-reversed as it is written least
+// significant bit first.
+type prefixCode struct {
+	codes []uint32
+	sizes []uint8 // bits written for each symbol
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.sizes[symbol]))
+}
+
+// writeCode writes the Huffman code for symbols counted in counts and
+// returns it. A code for one symbol takes no bits.
+func writeCode(bw *bitWriter, counts []int) prefixCode {
+	var used []int
+	for s, n := range counts {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+	if len(used) <= 1 && (len(used) == 0 || used[0] < 256) {
+		symbol := 0
+		if len(used) == 1 {
+			symbol = used[0]
+		}
+		bw.write(1, 1) // simple code
+		bw.write(0, 1) // of one symbol
+		if symbol < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(symbol), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbol), 8)
+		}
+		return prefixCode{codes: make([]uint32, len(counts)), sizes: make([]uint8, len(counts))}
+	}
+
+	lengths := huffmanLengths(counts, 15)
+	bw.write(0, 1) // normal code
+
+	// The lengths themselves are coded, with runs of zeros (17 and 18) and
+	// repeats of the last length (16).
+	type rle struct{ symbol, extraBits, extra int }
+	var runs []rle
+	for i := 0; i < len(lengths); {
+		l := int(lengths[i])
+		run := 1
+		for i+run < len(lengths) && int(lengths[i+run]) == l {
+			run++
+		}
+		i += run
+		if l == 0 {
+			for ; run >= 11; run -= min(run, 138) {
+				runs = append(runs, rle{18, 7, min(run, 138) - 11})
+			}
+			if run >= 3 {
+				runs = append(runs, rle{17, 3, run - 3})
+				run = 0
+			}
+		} else {
+			runs = append(runs, rle{l, 0, 0})
+			for run--; run >= 3; run -= min(run, 6) {
+				runs = append(runs, rle{16, 2, min(run, 6) - 3})
+			}
+		}
+		for ; run > 0; run-- {
+			runs = append(runs, rle{l, 0, 0})
+		}
+	}
+	lengthCounts := make([]int, len(codeLengthOrder))
+	for _, r := range runs {
+		lengthCounts[r.symbol]++
+	}
+	lengthLengths := huffmanLengths(lengthCounts, 7)
+	lengthCode := newPrefixCode(lengthLengths)
+	n := len(codeLengthOrder)
+	for n > 4 && lengthLengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(uint32(n-4), 4)
+	for _, s := range codeLengthOrder[:n] {
+		bw.write(uint32(lengthLengths[s]), 3)
+	}
+	bw.write(0, 1) // every symbol has a length
+	for _, r := range runs {
+		lengthCode.write(bw, r.symbol)
+		bw.write(uint32(r.extra), uint(r.extraBits))
+	}
+	return newPrefixCode(lengths)
+}
+
+// newPrefixCode assigns the canonical codes for lengths. A lone symbol is
+// read without any bits, whatever its length.
+func newPrefixCode(lengths []uint8) prefixCode {
+	c := prefixCode{codes: make([]uint32, len(lengths)), sizes: lengths}
+	var count [16]uint32
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used++
+		}
+	}
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c.codes[s] = bits.Reverse32(next[l]) >> (32 - l)
+		next[l]++
+	}
+	if used == 1 {
+		c.sizes = make([]uint8, len(lengths))
+	}
+	return c
+}
+
+// huffmanLengths returns code lengths for counts no longer than limit,
+// flattening the counts until the tree is shallow enough.
+func huffmanLengths(counts []int, limit int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	var leaves []int
+	for s, n := range counts {
+		if n > 0 {
+			leaves = append(leaves, s)
+		}
+	}
+	if len(leaves) < 2 {
+		for _, s := range leaves {
+			lengths[s] = 1
+		}
+		return lengths
+	}
+	weights := slices.Clone(counts)
+	for {
+		slices.SortStableFunc(leaves, func(a, b int) int { return cmp.Compare(weights[a], weights[b]) })
+		// Nodes are the leaves in order, then the internal nodes as they
+		// are made, which come out in order too.
+		weight := make([]int, len(leaves), 2*len(leaves)-1)
+		for i, s := range leaves {
+			weight[i] = weights[s]
+		}
+		parent := make([]int, 2*len(leaves)-1)
+		leaf, internal := 0, len(leaves)
+		lightest := func() int {
+			if leaf < len(leaves) && (internal == len(weight) || weight[leaf] <= weight[internal]) {
+				leaf++
+				return leaf - 1
+			}
+			internal++
+			return internal - 1
+		}
+		for len(weight) < cap(weight) {
+			a, b := lightest(), lightest()
+			parent[a], parent[b] = len(weight), len(weight)
+			weight = append(weight, weight[a]+weight[b])
+		}
+		depth := make([]int, len(weight))
+		deepest := 0
+		for i := len(weight) - 2; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+			deepest = max(deepest, depth[i])
+		}
+		if deepest <= limit {
+			for i, s := range leaves {
+				lengths[s] = uint8(depth[i])
+			}
+			return lengths
+		}
+		for _, s := range leaves {
+			weights[s] = weights[s]/2 + 1
+		}
+	}
+}
+
+// bitWriter packs values least significant bit first.
+type bitWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.bits |= uint64(v) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.n -= 8
+	}
+}
+
+// bytes flushes the last partial byte and returns everything written.
+func (w *bitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.n = 0, 0
+	}
+	return w.buf
+}
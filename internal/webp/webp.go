@@ -0,0 +1,278 @@
+// Package webp writes images as lossless WebP (the VP8L bitstream) without
+// a dependency:
+//
+//	if err := webp.Encode(f, img); err != nil {
+//		return err
+//	}
+//
+// Pixels are kept exactly. They go through the subtract-green transform and
+// a predictor chosen per 32×32 tile, then are coded with LZ77 back
+// references and Huffman codes. Any WebP decoder reads the result, such as
+// a browser or golang.org/x/image/webp. Colour caches, the cross-colour and
+// colour-indexing transforms and per-tile Huffman codes are not used.
+package webp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// maxSize is the largest width or height VP8L can describe.
+const maxSize = 1 << 14
+
+// tileBits is the log-2 size of the predictor tiles.
+const tileBits = 5
+
+// Encode writes m to w as a lossless WebP file.
+func Encode(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxSize || height > maxSize {
+		return fmt.Errorf("webp: cannot encode a %dx%d image (1 to %d pixels a side)", width, height, maxSize)
+	}
+	pix, opaque := argbPixels(m)
+
+	var bw bitWriter
+	bw.write(0x2f, 8) // VP8L signature
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3) // version
+
+	// Transforms are listed in the order they are applied; decoders undo
+	// them last first.
+	subtractGreen(pix)
+	bw.write(1, 1)
+	bw.write(2, 2) // subtract green
+
+	modes, tilesWide := predict(pix, width, height)
+	bw.write(1, 1)
+	bw.write(0, 2) // predictor
+	bw.write(tileBits-2, 3)
+	writeImage(&bw, modes, tilesWide, false)
+
+	bw.write(0, 1) // no more transforms
+	writeImage(&bw, pix, width, true)
+
+	data := bw.bytes()
+	pad := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if pad == 1 {
+		data = append(data, 0)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// argbPixels returns m's pixels as non-premultiplied 0xAARRGGBB, and whether
+// they are all opaque.
+func argbPixels(m image.Image) ([]uint32, bool) {
+	b := m.Bounds()
+	pix := make([]uint32, 0, b.Dx()*b.Dy())
+	opaque := true
+	add := func(r, g, b, a uint8) {
+		pix = append(pix, uint32(a)<<24|uint32(r)<<16|uint32(g)<<8|uint32(b))
+		opaque = opaque && a == 0xff
+	}
+	switch m := m.(type) {
+	case *image.NRGBA:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := m.Pix[m.PixOffset(b.Min.X, y):m.PixOffset(b.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				add(row[i], row[i+1], row[i+2], row[i+3])
+			}
+		}
+	case *image.RGBA:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := m.Pix[m.PixOffset(b.Min.X, y):m.PixOffset(b.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				if a := row[i+3]; a != 0xff {
+					c := color.NRGBAModel.Convert(color.RGBA{row[i], row[i+1], row[i+2], a}).(color.NRGBA)
+					add(c.R, c.G, c.B, c.A)
+					continue
+				}
+				add(row[i], row[i+1], row[i+2], 0xff)
+			}
+		}
+	case *image.Gray:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for _, v := range m.Pix[m.PixOffset(b.Min.X, y):m.PixOffset(b.Max.X, y)] {
+				add(v, v, v, 0xff)
+			}
+		}
+	default:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+				add(c.R, c.G, c.B, c.A)
+			}
+		}
+	}
+	return pix, opaque
+}
+
+// subtractGreen takes each pixel's green from its red and blue, which
+// leaves little in them for grey and near-grey pixels.
+func subtractGreen(pix []uint32) {
+	for i, p := range pix {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		pix[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// predict replaces pix with its residuals from the predictor that suits
+// each tile best and returns the tiles' modes as an image, tilesWide
+// across, with each mode in the green channel.
+func predict(pix []uint32, width, height int) ([]uint32, int) {
+	tilesWide := (width + 1<<tileBits - 1) >> tileBits
+	tilesHigh := (height + 1<<tileBits - 1) >> tileBits
+	modes := make([]uint32, tilesWide*tilesHigh)
+	for ty := 0; ty < tilesHigh; ty++ {
+		for tx := 0; tx < tilesWide; tx++ {
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := max(ty<<tileBits, 1); y < min((ty+1)<<tileBits, height); y++ {
+					for x := max(tx<<tileBits, 1); x < min((tx+1)<<tileBits, width); x++ {
+						cost += residualCost(sub(pix[y*width+x], predictAt(pix, width, y*width+x, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesWide+tx] = uint32(best) << 8
+		}
+	}
+
+	// Residuals are taken from the original pixels, so work from the end
+	// back, where nothing still needed has been overwritten.
+	for i := len(pix) - 1; i >= 0; i-- {
+		x, y := i%width, i/width
+		var pred uint32
+		switch {
+		case i == 0:
+			pred = 0xff000000
+		case y == 0:
+			pred = pix[i-1]
+		case x == 0:
+			pred = pix[i-width]
+		default:
+			pred = predictAt(pix, width, i, int(modes[(y>>tileBits)*tilesWide+x>>tileBits]>>8))
+		}
+		pix[i] = sub(pix[i], pred)
+	}
+	return modes, tilesWide
+}
+
+// predictAt is the prediction by mode of pixel i, which is neither in the
+// first row nor the first column. Its top right neighbour in the last
+// column is the first pixel of its own row, as the pixels run on.
+func predictAt(pix []uint32, width, i, mode int) uint32 {
+	l, t, tl, tr := pix[i-1], pix[i-width], pix[i-width-1], pix[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPredictor(l, t, tl)
+	case 12:
+		return clampAddSubtract(l, t, tl)
+	default:
+		a := average2(l, t)
+		return perChannel(func(c int) int { return channel(a, c) + (channel(a, c)-channel(tl, c))/2 })
+	}
+}
+
+// average2 is the mean of each channel of a and b, rounded down.
+func average2(a, b uint32) uint32 {
+	return (a^b)&0xfefefefe>>1 + a&b
+}
+
+// selectPredictor is whichever of l and t is nearer l+t-tl.
+func selectPredictor(l, t, tl uint32) uint32 {
+	toL, toT := 0, 0
+	for c := 0; c < 4; c++ {
+		toL += abs(channel(tl, c) - channel(t, c))
+		toT += abs(channel(tl, c) - channel(l, c))
+	}
+	if toL < toT {
+		return l
+	}
+	return t
+}
+
+func clampAddSubtract(a, b, c uint32) uint32 {
+	return perChannel(func(i int) int { return channel(a, i) + channel(b, i) - channel(c, i) })
+}
+
+// perChannel builds a pixel from f of each channel, clamped to 0-255.
+func perChannel(f func(c int) int) uint32 {
+	var p uint32
+	for c := 0; c < 4; c++ {
+		p |= uint32(min(max(f(c), 0), 255)) << (8 * c)
+	}
+	return p
+}
+
+func channel(p uint32, c int) int { return int(p >> (8 * c) & 0xff) }
+
+// sub takes b from a, each channel modulo 256.
+func sub(a, b uint32) uint32 {
+	hi := (a | 0x00ff00ff - b&0xff00ff00) & 0xff00ff00
+	lo := (a | 0xff00ff00 - b&0x00ff00ff) & 0x00ff00ff
+	return hi | lo
+}
+
+// residualCost estimates the bits a residual costs by its channels'
+// distance from zero.
+func residualCost(r uint32) int {
+	cost := 0
+	for c := 0; c < 4; c++ {
+		v := channel(r, c)
+		cost += min(v, 256-v)
+	}
+	return cost
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,99 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// a page: white, with lines of grey "text" and a coloured logo
+	page := image.NewRGBA(image.Rect(0, 0, 300, 420))
+	for i := range page.Pix {
+		page.Pix[i] = 0xff
+	}
+	for y := 40; y < 380; y += 12 {
+		for x := 30; x < 270; x++ {
+			if x%7 < 5 {
+				page.Set(x, y, color.RGBA{40, 40, 48, 0xff})
+				page.Set(x, y+1, color.RGBA{90, 90, 96, 0xff})
+			}
+		}
+	}
+	for y := 5; y < 30; y++ {
+		for x := 240; x < 290; x++ {
+			page.Set(x, y, color.RGBA{uint8(x * 3), 30, uint8(y * 8), 0xff})
+		}
+	}
+
+	noise := image.NewNRGBA(image.Rect(0, 0, 97, 61))
+	rng.Read(noise.Pix)
+
+	gray := image.NewGray(image.Rect(10, 20, 74, 52))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i / 7)
+	}
+
+	wide := image.NewNRGBA(image.Rect(0, 0, 5000, 3))
+	for i := range wide.Pix {
+		wide.Pix[i] = uint8(i % 251)
+	}
+
+	for name, img := range map[string]image.Image{
+		"page":  page,
+		"noise": noise,
+		"gray":  gray,
+		"wide":  wide,
+		"pixel": image.NewNRGBA(image.Rect(0, 0, 1, 1)),
+		"white": image.NewUniform(color.White),
+	} {
+		if u, ok := img.(*image.Uniform); ok {
+			img = &cropped{u, image.Rect(0, 0, 64, 64)}
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, img); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := webp.Decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: decoding: %v", name, err)
+		}
+		b := img.Bounds()
+		if got.Bounds().Dx() != b.Dx() || got.Bounds().Dy() != b.Dy() {
+			t.Fatalf("%s: decoded %v, want %v", name, got.Bounds(), b)
+		}
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				want := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y))
+				if c := color.NRGBAModel.Convert(got.At(x, y)); c != want {
+					t.Fatalf("%s: pixel %d,%d = %v, want %v", name, x, y, c, want)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, page); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 6000 {
+		t.Errorf("the page took %d bytes", buf.Len())
+	}
+	if err := Encode(&buf, image.NewGray(image.Rect(0, 0, 20000, 1))); err == nil {
+		t.Error("encoded a 20000 pixel wide image")
+	}
+}
+
+// cropped bounds an infinite image.
+type cropped struct {
+	image.Image
+	bounds image.Rectangle
+}
+
+func (c *cropped) Bounds() image.Rectangle { return c.bounds }
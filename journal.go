@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// The action journal (tags applied and removed, duplicates deleted) is
+// exported as CSV or JSON from /export/actions.csv?from=&to= and
+// /export/actions.json, or with `export actions`, and read back with
+// `import actions` on a new machine. Entries already in the journal are
+// skipped on import, so importing twice is harmless.
+
+var actionsCSVHeader = []string{"time", "user", "action", "ulid", "document", "tag_id", "tag_name"}
+
+// journalActions returns the journal entries made on days from to to
+// (YYYY-MM-DD, local time, inclusive); either may be "" for no bound.
+func journalActions(st *store.Store, from, to string) ([]store.Action, error) {
+	var since time.Time
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return nil, fmt.Errorf("dates must be YYYY-MM-DD, not %q", d)
+		}
+	}
+	if from != "" {
+		since, _ = time.ParseInLocation("2006-01-02", from, time.Local)
+	}
+	actions, err := st.Actions(since)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	if to == "" {
+		return actions, nil
+	}
+	var out []store.Action
+	for _, a := range actions {
+		if a.Time.In(time.Local).Format("2006-01-02") <= to {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func writeActions(w io.Writer, format string, actions []store.Action) error {
+	if format == "json" {
+		if actions == nil {
+			actions = []store.Action{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(actions)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(actionsCSVHeader)
+	for _, a := range actions {
+		cw.Write([]string{a.Time.Format(time.RFC3339Nano), a.User, a.Action, a.ULID, a.DocName, strconv.Itoa(a.TagID), a.TagName})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readActions parses an export in either format, telling them apart by the
+// first character.
+func readActions(r io.Reader) ([]store.Action, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var actions []store.Action
+	if s := strings.TrimSpace(string(b)); strings.HasPrefix(s, "[") {
+		if err := json.Unmarshal(b, &actions); err != nil {
+			return nil, fmt.Errorf("reading JSON journal: %w", err)
+		}
+		return actions, nil
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(b))).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV journal: %w", err)
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(actionsCSVHeader, ",") {
+		return nil, fmt.Errorf("reading CSV journal: expected the header %s", strings.Join(actionsCSVHeader, ","))
+	}
+	for i, row := range rows[1:] {
+		t, err := time.Parse(time.RFC3339, row[0])
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV journal: line %d: %w", i+2, err)
+		}
+		tagID, err := strconv.Atoi(row[5])
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV journal: line %d: tag_id: %w", i+2, err)
+		}
+		actions = append(actions, store.Action{Time: t, User: row[1], Action: row[2], ULID: row[3], DocName: row[4], TagID: tagID, TagName: row[6]})
+	}
+	return actions, nil
+}
+
+// handleExportActions serves /export/actions.csv and /export/actions.json,
+// optionally with ?from=YYYY-MM-DD&to=YYYY-MM-DD.
+func (app *App) handleExportActions(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	actions, err := journalActions(app.store, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	name := "actions"
+	if from != "" || to != "" {
+		name += "-" + from + "-" + to
+	}
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	writeActions(w, format, actions)
+}
+
+// runExportActions implements `export actions [-from DATE] [-to DATE]
+// [-format csv|json]`, writing to out.
+func runExportActions(cfg Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export actions", flag.ContinueOnError)
+	from := fs.String("from", "", "first day, YYYY-MM-DD")
+	to := fs.String("to", "", "last day, YYYY-MM-DD")
+	format := fs.String("format", "csv", "csv or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("format must be csv or json")
+	}
+	st, err := store.Open(cfg.statePath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	actions, err := journalActions(st, *from, *to)
+	if err != nil {
+		return err
+	}
+	return writeActions(out, *format, actions)
+}
+
+// runImportActions implements `import actions <file>`.
+func runImportActions(cfg Config, file string, out io.Writer) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	actions, err := readActions(f)
+	if err != nil {
+		return err
+	}
+	st, err := store.Open(cfg.statePath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	added, err := st.ImportActions(actions)
+	if err != nil {
+		return fmt.Errorf("importing journal: %w", err)
+	}
+	fmt.Fprintf(out, "Imported %d actions (%d already in the journal)\n", added, len(actions)-added)
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/keymap"
+)
+
+const helpKey = "?" // reserved key to show the key bindings
+
+// KeyBinding is a binding as /api/keymap reports it, with the tags it
+// applies.
+type KeyBinding struct {
+	keymap.Binding
+	TagID  int   `json:"tag_id,omitempty"`  // shortcuts
+	TagIDs []int `json:"tag_ids,omitempty"` // presets
+}
+
+// KeymapLayer is a shortcut layer and its own shortcuts.
+type KeymapLayer struct {
+	Name     string       `json:"name"`
+	Switch   string       `json:"switch"` // e.g. "Alt+f"
+	Bindings []KeyBinding `json:"bindings"`
+}
+
+// KeymapResponse is the user's fully resolved key bindings: shortcuts,
+// presets, reserved keys and chords in the order the inbox page checks
+// them, then each layer's shortcuts, which take the place of the main ones
+// while the layer is selected.
+type KeymapResponse struct {
+	User     string        `json:"user,omitempty"`
+	Bindings []KeyBinding  `json:"bindings"`
+	Layers   []KeymapLayer `json:"layers"`
+}
+
+// keyBindings resolves the bindings in km against their shortcuts and
+// presets, keeping only those of kind only unless it is "".
+func keyBindings(km *keymap.Keymap, shortcuts []ShortcutConfig, presets []PresetConfig, only keymap.Kind) []KeyBinding {
+	out := []KeyBinding{}
+	for _, b := range km.Bindings() {
+		kb := KeyBinding{Binding: b}
+		switch b.Kind {
+		case keymap.Shortcut:
+			kb.TagID = shortcuts[b.Index].TagID
+		case keymap.Preset:
+			kb.TagIDs = presets[b.Index].TagIDs
+		}
+		if only == "" || kb.Kind == only {
+			out = append(out, kb)
+		}
+	}
+	return out
+}
+
+// handleKeymap serves /api/keymap for the "?" overlay on the inbox page and
+// other clients.
+func (app *App) handleKeymap(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.currentUser(r)
+	if sess == nil {
+		writeError(w, errs.New(errs.Validation, "keymap", "choose a user first"))
+		return
+	}
+	resp := KeymapResponse{User: sess.Name, Bindings: keyBindings(sess.Keymap, sess.Shortcuts, sess.Presets, ""), Layers: []KeymapLayer{}}
+	for _, l := range sess.Layers {
+		resp.Layers = append(resp.Layers, KeymapLayer{
+			Name:     l.Name,
+			Switch:   "Alt+" + l.Key,
+			Bindings: keyBindings(l.keymap, l.Shortcuts, sess.Presets, keymap.Shortcut),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The kiosk (/kiosk) is a read-only display for a wall tablet: the queue,
+// today's triage and whether the pipeline is healthy, in large type,
+// refreshing itself. It has no forms or links that change anything, and
+// needs no user to be picked, so it can be left unattended.
+
+const (
+	defaultKioskRefresh = 30 * time.Second
+	minKioskRefresh     = 5 * time.Second
+	kioskErrorWindow    = time.Hour // pipeline errors this recent make the display amber
+)
+
+// KioskUser is one user's triage today.
+type KioskUser struct {
+	Name   string
+	Tagged int // documents
+}
+
+type KioskPageData struct {
+	Refresh     int // seconds
+	Time        time.Time
+	State       InboxState
+	Tagged      int // documents tagged today
+	TagsApplied int
+	Undone      int
+	Goal        *GoalProgress // nil without daily_goal
+	Users       []KioskUser   // only with more than one user
+	GodocsOK    bool
+	GodocsError string
+	Errors      int // pipeline errors in the last kioskErrorWindow
+	Ingest      []*IngestRun
+}
+
+// Healthy reports whether godocs is reachable and nothing has failed lately.
+func (d KioskPageData) Healthy() bool {
+	return d.GodocsOK && d.Errors == 0 && d.State.Failed == 0
+}
+
+// handleKiosk (/kiosk) renders the display. ?refresh=N sets the refresh
+// interval in seconds.
+func (app *App) handleKiosk(w http.ResponseWriter, r *http.Request) {
+	refresh := defaultKioskRefresh
+	if n, err := strconv.Atoi(r.URL.Query().Get("refresh")); err == nil {
+		refresh = max(time.Duration(n)*time.Second, minKioskRefresh)
+	}
+	data := KioskPageData{Refresh: int(refresh.Seconds()), Time: time.Now()}
+
+	// Ping before taking app.mu, as collectStatus does
+	if _, err := app.docs.Ping(); err != nil {
+		data.GodocsError = err.Error()
+	} else {
+		data.GodocsOK = true
+	}
+	for _, e := range app.errors.list() {
+		if time.Since(e.Time) < kioskErrorWindow {
+			data.Errors++
+		}
+	}
+	app.kioskToday(&data)
+
+	app.mu.Lock()
+	data.State = app.inboxState()
+	data.Ingest = app.ingestRuns()
+	data.Goal = app.goalProgress(data.Time)
+	app.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.templates().ExecuteTemplate(w, "kiosk.html", data)
+}
+
+// kioskToday counts today's tagging from the action journal.
+func (app *App) kioskToday(data *KioskPageData) {
+	y, m, d := data.Time.Date()
+	actions, err := app.store.Actions(time.Date(y, m, d, 0, 0, 0, 0, data.Time.Location()))
+	if err != nil {
+		return
+	}
+	docs := make(map[string]bool)
+	byUser := make(map[string]map[string]bool)
+	for _, a := range actions {
+		switch a.Action {
+		case actionTag:
+			data.TagsApplied++
+			key := a.ULID + a.DocName // the file-based demo journalled no ULIDs
+			docs[key] = true
+			if byUser[a.User] == nil {
+				byUser[a.User] = make(map[string]bool)
+			}
+			byUser[a.User][key] = true
+		case actionUntag:
+			data.Undone++
+		}
+	}
+	data.Tagged = len(docs)
+	if len(byUser) < 2 {
+		return
+	}
+	for name, docs := range byUser {
+		data.Users = append(data.Users, KioskUser{Name: name, Tagged: len(docs)})
+	}
+	sort.Slice(data.Users, func(i, j int) bool { return data.Users[i].Tagged > data.Users[j].Tagged })
+}
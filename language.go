@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/drummonds/godocs-inbox/internal/lang"
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// LanguageConfig lists the languages the household reads, as ISO 639-1
+// codes. Previews of documents detected in any other language are
+// translated by the LLM into the first.
+type LanguageConfig struct {
+	TranslateTo []string `yaml:"translate_to,omitempty"`
+}
+
+func (c LanguageConfig) validate() error {
+	for _, code := range c.TranslateTo {
+		if len(code) != 2 || lang.Name(code) == code {
+			return fmt.Errorf("languages: unknown language code %q in translate_to", code)
+		}
+	}
+	return nil
+}
+
+// translationTarget returns the language to translate a document in code
+// into, or "" if it needs no translation.
+func (c LanguageConfig) translationTarget(code string) string {
+	if code == "" || len(c.TranslateTo) == 0 || slices.Contains(c.TranslateTo, code) {
+		return ""
+	}
+	return c.TranslateTo[0]
+}
+
+// detectLanguage records the language of a document's text and, when it is
+// not one the household reads, an LLM translation of the preview.
+func detectLanguage(app *App, ulid, text string) {
+	code, share := lang.Detect(text)
+	l := store.DocLanguage{ULID: ulid, Lang: code}
+	if code != "" {
+		log.Printf("language: %s is %s (%.0f%% stopwords)", ulid, lang.Name(code), share*100)
+	}
+	if target := app.config().Languages.translationTarget(code); target != "" {
+		translation, err := withModels(app, taskTranslate, ulid, func(m llm.Model) (string, error) {
+			vars := app.promptVars(text)
+			vars.Language = lang.Name(target)
+			return llm.Translate(m, app.config().prompts, vars)
+		})
+		if errors.Is(err, errLLMOffline) {
+			// Detected and translated again when next shown
+			app.mu.Lock()
+			delete(app.languages, ulid)
+			app.mu.Unlock()
+			return
+		}
+		if err != nil {
+			app.pipelineErrorf("language", ulid, "translation failed for %s: %v", ulid, err)
+			app.recordFailure(ulid, pipelineLanguage, "", err)
+		} else {
+			app.clearFailure(ulid, pipelineLanguage)
+			l.TranslatedTo, l.Translation = target, translation
+		}
+	}
+
+	app.mu.Lock()
+	app.languages[ulid] = l
+	app.mu.Unlock()
+	if err := app.store.PutLanguage(l); err != nil {
+		log.Printf("state: %v", err)
+	}
+}
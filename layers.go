@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/drummonds/godocs-inbox/internal/keymap"
+)
+
+// ShortcutLayer is a further set of tag shortcuts, switched to on the inbox
+// page with Alt and the layer's key (and back with Alt and the same key),
+// so the same letters can tag differently in each context. Presets and the
+// built-in keys are the same in every layer.
+//
+//	layers:
+//	  - name: finance
+//	    key: f
+//	    tags:
+//	      - {key: b, tag_id: 21}   # bank
+//	      - {key: i, tag_id: 22}   # invoice
+//	  - name: household
+//	    key: h
+//	    tags:
+//	      - {key: b, tag_id: 31}   # boiler
+type ShortcutLayer struct {
+	Name      string           `yaml:"name"`
+	Key       string           `yaml:"key"`
+	Shortcuts []ShortcutConfig `yaml:"tags"`
+	keymap    *keymap.Keymap   // the layer's shortcuts with the session's presets
+}
+
+// validateLayers checks the layer names and keys and fills in the layers'
+// shortcuts from the server's tags. Layer shortcuts are single keys.
+func validateLayers(client DocumentStore, layers []ShortcutLayer) error {
+	names, keys := map[string]bool{}, map[string]bool{}
+	for i := range layers {
+		l := &layers[i]
+		if l.Name == "" || names[l.Name] {
+			return fmt.Errorf("layers: every layer needs a unique name")
+		}
+		names[l.Name] = true
+		l.Key = strings.ToLower(l.Key)
+		if utf8.RuneCountInString(l.Key) != 1 || keys[l.Key] {
+			return fmt.Errorf("layers: layer %s needs a key of its own, a single character", l.Name)
+		}
+		keys[l.Key] = true
+		if err := resolveShortcuts(client, l.Shortcuts); err != nil {
+			return fmt.Errorf("layer %s: %w", l.Name, err)
+		}
+		for _, s := range l.Shortcuts {
+			if strings.Contains(s.Key, " ") {
+				return fmt.Errorf("layer %s: key %q must be a single key, not a chord", l.Name, s.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// sessionLayers gives each layer a keymap of its shortcuts and presets.
+// Keys that collide are left out, as for the base shortcuts.
+func sessionLayers(layers []ShortcutLayer, presets []PresetConfig) []ShortcutLayer {
+	out := make([]ShortcutLayer, len(layers))
+	for i, l := range layers {
+		l.keymap, _ = buildKeymap(l.Shortcuts, presets)
+		out[i] = l
+	}
+	return out
+}
+
+// shortcut returns the tag shortcut bound to key in the named layer, or
+// in the base shortcuts for "" or a layer that no longer exists.
+func (s *UserSession) shortcut(layer, key string) *ShortcutConfig {
+	shortcuts, km := s.Shortcuts, s.Keymap
+	for _, l := range s.Layers {
+		if l.Name == layer {
+			shortcuts, km = l.Shortcuts, l.keymap
+		}
+	}
+	if b, ok := km.Lookup(key); ok && b.Kind == keymap.Shortcut {
+		return &shortcuts[b.Index]
+	}
+	return nil
+}
+
+// warnLayerCollisions logs layer keys that shadow presets or the built-in
+// keys.
+func warnLayerCollisions(layers []ShortcutLayer, presets []PresetConfig) {
+	for _, l := range layers {
+		_, errs := buildKeymap(l.Shortcuts, presets)
+		for _, err := range errs {
+			log.Printf("WARNING: layer %s: %v", l.Name, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Request limit defaults, used when the config leaves a field at zero.
+const (
+	defaultRequestsPerMinute = 300
+	defaultBurst             = 60
+	defaultMaxBodyKB         = 1024
+)
+
+// limitedPrefixes are the paths subject to per-IP rate limiting: the JSON
+// API and the thumbnail proxy, which pass traffic through to godocs.
+var limitedPrefixes = []string{"/api/", "/proxy/", "/hooks/"}
+
+// LimitConfig guards the server against misbehaving clients:
+//
+//	limits:
+//	  requests_per_minute: 300  # per client IP on /api/, /proxy/, /hooks/; -1 disables
+//	  burst: 60
+//	  max_body_kb: 1024         # largest request body; -1 disables
+type LimitConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute,omitempty"`
+	Burst             int `yaml:"burst,omitempty"`
+	MaxBodyKB         int `yaml:"max_body_kb,omitempty"`
+}
+
+func (c LimitConfig) rate() (perMinute, burst int) {
+	perMinute, burst = c.RequestsPerMinute, c.Burst
+	if perMinute == 0 {
+		perMinute = defaultRequestsPerMinute
+	}
+	if burst <= 0 {
+		burst = defaultBurst
+	}
+	return perMinute, burst
+}
+
+func (c LimitConfig) maxBody() int64 {
+	switch {
+	case c.MaxBodyKB < 0:
+		return 0
+	case c.MaxBodyKB == 0:
+		return defaultMaxBodyKB << 10
+	}
+	return int64(c.MaxBodyKB) << 10
+}
+
+func (c LimitConfig) validate() error {
+	if c.RequestsPerMinute < -1 || c.MaxBodyKB < -1 || c.Burst < 0 {
+		return fmt.Errorf("limits: values must be positive, or -1 to disable")
+	}
+	return nil
+}
+
+// bucket is a token bucket for one client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter hands out tokens per client IP, refilled at a steady rate up
+// to a burst size.
+type rateLimiter struct {
+	mu       sync.Mutex
+	perSec   float64
+	burst    float64
+	clients  map[string]*bucket
+	lastGC   time.Time
+	rejected atomic.Int64
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{perSec: float64(perMinute) / 60, burst: float64(burst), clients: make(map[string]*bucket)}
+}
+
+// allow takes a token for ip. When none is left it returns false and how
+// long until one is available.
+func (l *rateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastGC) > 10*time.Minute {
+		// Idle clients have refilled to a full bucket; forget them
+		for k, b := range l.clients {
+			if now.Sub(b.last) > 10*time.Minute {
+				delete(l.clients, k)
+			}
+		}
+		l.lastGC = now
+	}
+	b := l.clients[ip]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.perSec)
+	b.last = now
+	if b.tokens < 1 {
+		l.rejected.Add(1)
+		return false, time.Duration((1 - b.tokens) / l.perSec * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// clientIP is the address of the connecting client. Forwarded headers are
+// not trusted, so behind a reverse proxy all clients share one bucket.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitRequests rejects oversized request bodies with 413 and rate-limits
+// the API and proxy endpoints per client IP with 429.
+func (app *App) limitRequests(next http.Handler) http.Handler {
+	perMinute, burst := app.config().Limits.rate()
+	if perMinute > 0 {
+		app.limiter = newRateLimiter(perMinute, burst)
+	}
+	maxBody := app.config().Limits.maxBody()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := maxBody
+		if r.URL.Path == "/upload" {
+			limit = app.maxDownloadBytes() // documents are capped by max_download_mb
+		}
+		if limit > 0 && r.Body != nil {
+			if r.ContentLength > limit {
+				app.oversized.Add(1)
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		if app.limiter != nil && hasAnyPrefix(r.URL.Path, limitedPrefixes) {
+			if ok, wait := app.limiter.allow(clientIP(r), time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+)
+
+// Ollama is checked at startup and every llmCheckInterval. While it is
+// down, local models are left out of every LLM task, so documents skip the
+// LLM stages at once rather than each waiting out the request timeout, and
+// the nav bar shows "LLM offline". Remote models are still tried. Documents
+// whose date inference was skipped are remembered, and inferred again when
+// Ollama comes back; the other LLM stages are not marked as tried, so they
+// run when a document is next shown.
+
+const llmCheckInterval = 30 * time.Second
+
+var errLLMOffline = errors.New("LLM offline: Ollama is not reachable")
+
+// llmHealth tracks whether Ollama is reachable. It is safe for concurrent
+// use.
+type llmHealth struct {
+	mu       sync.Mutex
+	offline  bool
+	since    time.Time // of the current state; zero before the first check
+	err      string
+	deferred map[string]bool // ULIDs whose date inference waits for Ollama
+}
+
+// LLMStatus is the Ollama state shown in the nav bar and on the About page.
+type LLMStatus struct {
+	Offline  bool
+	Since    time.Time
+	Error    string
+	Deferred int // documents waiting for date inference
+}
+
+func (h *llmHealth) status() LLMStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return LLMStatus{Offline: h.offline, Since: h.since, Error: h.err, Deferred: len(h.deferred)}
+}
+
+func (h *llmHealth) isOffline() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.offline
+}
+
+// set records the outcome of a check and, when Ollama has come back,
+// returns the documents waiting for it.
+func (h *llmHealth) set(err error) (changed bool, back []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	offline := err != nil
+	changed = offline != h.offline || h.since.IsZero()
+	if changed {
+		h.since = time.Now()
+	}
+	h.offline = offline
+	h.err = ""
+	if offline {
+		h.err = err.Error()
+		return changed, nil
+	}
+	back = slices.Sorted(maps.Keys(h.deferred))
+	h.deferred = nil
+	return changed, back
+}
+
+// deferDate remembers a document for date inference once Ollama is back.
+func (h *llmHealth) deferDate(ulid string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.deferred == nil {
+		h.deferred = make(map[string]bool)
+	}
+	h.deferred[ulid] = true
+}
+
+// availableModels is app.models without the local models while Ollama is
+// offline. It fails with errLLMOffline if that leaves none.
+func (app *App) availableModels(task string) ([]llm.Model, error) {
+	models := app.models(task)
+	if !app.ollama.isOffline() {
+		return models, nil
+	}
+	models = slices.DeleteFunc(models, func(m llm.Model) bool { return !m.Remote })
+	if len(models) == 0 {
+		return nil, errLLMOffline
+	}
+	return models, nil
+}
+
+// checkLLM probes Ollama and records the result, inferring dates again for
+// documents that were waiting if it has come back.
+func (app *App) checkLLM(ctx context.Context) {
+	_, err := llm.ListModels(app.ollamaURL())
+	changed, back := app.ollama.set(err)
+	switch {
+	case changed && err != nil:
+		log.Printf("llm: Ollama at %s is offline, skipping local models: %v", app.ollamaURL(), err)
+	case changed:
+		log.Printf("llm: Ollama at %s is online", app.ollamaURL())
+	}
+	if len(back) > 0 {
+		log.Printf("llm: inferring dates for %d documents skipped while Ollama was offline", len(back))
+		go app.inferDeferredDates(ctx, back)
+	}
+}
+
+// inferDeferredDates runs date inference for documents skipped while
+// Ollama was offline, one at a time.
+func (app *App) inferDeferredDates(ctx context.Context, ulids []string) {
+	for _, ulid := range ulids {
+		if ctx.Err() != nil || app.ollama.isOffline() {
+			// Went down again; they wait for the next recovery
+			app.ollama.deferDate(ulid)
+			continue
+		}
+		text, err := app.docs.FetchDocText(ctx, ulid)
+		if err != nil || text == "" {
+			// Deleted or replaced meanwhile
+			continue
+		}
+		inferDocumentDate(app, ulid, text)
+	}
+}
+
+// runLLMMonitor checks Ollama at startup and every llmCheckInterval until
+// ctx is done.
+func (app *App) runLLMMonitor(ctx context.Context) {
+	t := time.NewTicker(llmCheckInterval)
+	defer t.Stop()
+	for {
+		app.checkLLM(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
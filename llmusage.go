@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// Every LLM request reports the tokens it read and wrote (Ollama's eval
+// counts, or an OpenAI-compatible server's usage) and how long it took.
+// The counts are added up per day and model in the state database and
+// shown on the About page. Each document's running total is kept in memory,
+// and crossing llm_budget logs a warning and records a pipeline error once
+// for the document, so a runaway prompt or a huge scan shows up:
+//
+//	llm_budget:
+//	  tokens_per_document: 20000
+//	  seconds_per_document: 120
+
+const usageDays = 14 // days of LLM usage shown on the About page
+
+// LLMBudgetConfig is the most LLM work one document should take; 0 is no
+// limit.
+type LLMBudgetConfig struct {
+	TokensPerDocument  int `yaml:"tokens_per_document,omitempty"`
+	SecondsPerDocument int `yaml:"seconds_per_document,omitempty"`
+}
+
+func (c LLMBudgetConfig) validate() error {
+	if c.TokensPerDocument < 0 || c.SecondsPerDocument < 0 {
+		return fmt.Errorf("llm_budget: values must be positive, or 0 for no limit")
+	}
+	return nil
+}
+
+// docUsage is the LLM work done on a document since startup.
+type docUsage struct {
+	tokens int
+	time   time.Duration
+	warned bool
+}
+
+// usageLog keeps each document's LLM usage, for the budget.
+type usageLog struct {
+	mu   sync.Mutex
+	docs map[string]*docUsage
+}
+
+// add adds u to ulid's total and reports whether that has just gone over
+// budget.
+func (l *usageLog) add(ulid string, u llm.Usage, budget LLMBudgetConfig) (total docUsage, over bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.docs == nil {
+		l.docs = make(map[string]*docUsage)
+	}
+	d := l.docs[ulid]
+	if d == nil {
+		d = new(docUsage)
+		l.docs[ulid] = d
+	}
+	d.tokens += u.PromptTokens + u.OutputTokens
+	d.time += u.Duration
+	if !d.warned && (budget.TokensPerDocument > 0 && d.tokens > budget.TokensPerDocument ||
+		budget.SecondsPerDocument > 0 && d.time > time.Duration(budget.SecondsPerDocument)*time.Second) {
+		d.warned = true
+		over = true
+	}
+	return *d, over
+}
+
+// recordLLMUsage counts an LLM request for task on ulid towards the day's
+// usage of model and the document's budget.
+func (app *App) recordLLMUsage(task, ulid, model string, u llm.Usage) {
+	pipelineLog.Printf("llm: %s for %s with %s: %d+%d tokens in %s", task, ulid, model, u.PromptTokens, u.OutputTokens, u.Duration.Round(time.Millisecond))
+	err := app.store.AddLLMUsage(store.LLMUsage{
+		Day:          time.Now().Format(time.DateOnly),
+		Model:        model,
+		Calls:        1,
+		PromptTokens: u.PromptTokens,
+		OutputTokens: u.OutputTokens,
+		Duration:     u.Duration,
+	})
+	if err != nil {
+		log.Printf("state: %v", err)
+	}
+	if ulid == "" {
+		return
+	}
+	budget := app.config().LLMBudget
+	if total, over := app.usage.add(ulid, u, budget); over {
+		app.pipelineErrorf("llm", ulid, "%s is over llm_budget: %d tokens in %s after %s",
+			ulid, total.tokens, total.time.Round(time.Second), task)
+	}
+}
+
+// recentLLMUsage returns the LLM usage of the last usageDays days.
+func (app *App) recentLLMUsage() []store.LLMUsage {
+	since := time.Now().AddDate(0, 0, -usageDays+1).Format(time.DateOnly)
+	usage, err := app.store.LLMUsageSince(since)
+	if err != nil {
+		log.Printf("state: %v", err)
+	}
+	return usage
+}
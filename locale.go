@@ -0,0 +1,161 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/datefind"
+)
+
+// Dates are kept as YYYY-MM-DD, as godocs stores them, and shown in the
+// configured locale: locale: en-GB shows 2026-03-04 as "4 Mar 2026",
+// en-US as "Mar 4, 2026". Times are shown in timezone, or the server's
+// zone when it is unset. A date typed in, or answered by an LLM, may be
+// written in any form datefind reads ("3rd March 2024", "03/04/2024");
+// numeric dates are read day first unless date_order, or failing that the
+// locale, says month first.
+//
+//	locale: en-US
+//	timezone: America/New_York
+
+// dateLocale is how a locale writes dates.
+type dateLocale struct {
+	layout     string   // time layout of a date, with Jan for the month
+	months     []string // month names in place of Jan-Dec; nil for English
+	monthFirst bool     // numeric dates are month first, as 03/04 for 4 March
+}
+
+var dateLocales = map[string]dateLocale{
+	"iso":   {layout: "2006-01-02"},
+	"en-GB": {layout: "2 Jan 2006"},
+	"en-US": {layout: "Jan 2, 2006", monthFirst: true},
+	"de-DE": {layout: "2. Jan 2006", months: []string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."}},
+	"fr-FR": {layout: "2 Jan 2006", months: []string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."}},
+	"es-ES": {layout: "2 Jan 2006", months: []string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"}},
+	"it-IT": {layout: "2 Jan 2006", months: []string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"}},
+	"nl-NL": {layout: "2 Jan 2006", months: []string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"}},
+}
+
+// lookupLocale finds a locale by name, in any case, or by its language
+// alone when only one locale has it ("de" for de-DE).
+func lookupLocale(name string) (dateLocale, bool) {
+	name = strings.ReplaceAll(name, "_", "-")
+	var byLanguage []string
+	for n := range dateLocales {
+		if strings.EqualFold(n, name) {
+			return dateLocales[n], true
+		}
+		if lang, _, _ := strings.Cut(n, "-"); strings.EqualFold(lang, name) {
+			byLanguage = append(byLanguage, n)
+		}
+	}
+	if len(byLanguage) == 1 {
+		return dateLocales[byLanguage[0]], true
+	}
+	return dateLocale{}, false
+}
+
+// loadLocale checks locale and timezone, loading the timezone.
+func (c *Config) loadLocale() error {
+	if _, ok := lookupLocale(cmp.Or(c.Locale, "iso")); !ok {
+		names := slices.Sorted(maps.Keys(dateLocales))
+		return fmt.Errorf("locale %q must be one of %s", c.Locale, strings.Join(names, ", "))
+	}
+	c.location = nil
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+		c.location = loc
+	}
+	return nil
+}
+
+// dateLocale is the configured locale; iso when it is unset.
+func (app *App) dateLocale() dateLocale {
+	if l, ok := lookupLocale(cmp.Or(app.config().Locale, "iso")); ok {
+		return l
+	}
+	return dateLocales["iso"]
+}
+
+// location is the timezone times are shown in.
+func (app *App) location() *time.Location {
+	if app.config().location == nil {
+		return time.Local
+	}
+	return app.config().location
+}
+
+// monthFirst reports whether numeric dates such as 03/04/2026 are read
+// month first: date_order says, or else the locale.
+func (app *App) monthFirst() bool {
+	if app.config().DateOrder != "" {
+		return app.config().DateOrder == "mdy"
+	}
+	return app.dateLocale().monthFirst
+}
+
+// dateOrder is monthFirst as a date_order value.
+func (app *App) dateOrder() string {
+	if app.monthFirst() {
+		return "mdy"
+	}
+	return "dmy"
+}
+
+// parseDate reads a date written in any form datefind reads as
+// YYYY-MM-DD.
+func (app *App) parseDate(s string) (string, bool) {
+	return datefind.Parse(s, datefind.Options{MonthFirst: app.monthFirst(), Now: app.now()})
+}
+
+// now is the current time in the configured timezone.
+func (app *App) now() time.Time {
+	return time.Now().In(app.location())
+}
+
+// formatDate shows a date in the configured locale. It takes a YYYY-MM-DD
+// string, an RFC 3339 timestamp (shown with its time, in the configured
+// timezone) or a time.Time; anything else is shown as it is.
+func (app *App) formatDate(v any) string {
+	var t time.Time
+	withTime := false
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		t = v.In(app.location())
+	case string:
+		if d, err := time.Parse("2006-01-02", v); err == nil {
+			t = d
+		} else if ts, err := time.Parse(time.RFC3339, v); err == nil {
+			t, withTime = ts.In(app.location()), true
+		} else {
+			return v
+		}
+	default:
+		return fmt.Sprint(v)
+	}
+
+	l := app.dateLocale()
+	s := t.Format(l.layout)
+	if l.months != nil && strings.Contains(l.layout, "Jan") {
+		s = strings.Replace(s, t.Format("Jan"), l.months[t.Month()-1], 1)
+	}
+	if withTime {
+		s += t.Format(" 15:04")
+	}
+	return s
+}
+
+// localTime is t in the configured timezone, for templates to format.
+func (app *App) localTime(t time.Time) time.Time {
+	return t.In(app.location())
+}
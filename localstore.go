@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LocalStore is a DocumentStore held in memory, behaving as godocs does for
+// everything the inbox uses: documents without text report no text until
+// some is uploaded, tags are kept in the order added, and search matches
+// names and text. Demo mode runs on one; its contents are gone on exit.
+// Documents cannot be viewed in a browser and have no thumbnails.
+type LocalStore struct {
+	mu      sync.Mutex
+	tags    []GodocsTag
+	docs    []*localDoc // in ingress order
+	uploads int
+
+	delay time.Duration // before each download
+}
+
+type localDoc struct {
+	GodocsDocument
+	date    string
+	text    string
+	content []byte
+	tags    []int
+}
+
+var _ DocumentStore = (*LocalStore)(nil)
+
+var errLocalNotFound = errors.New("not found")
+
+// NewLocalStore returns an empty store whose downloads each take delay,
+// as a large file from a slow server would.
+func NewLocalStore(delay time.Duration) *LocalStore {
+	return &LocalStore{delay: delay}
+}
+
+// addTag adds a tag to the store as it is, ID and all.
+func (s *LocalStore) addTag(t GodocsTag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tags = append(s.tags, t)
+}
+
+// addDocument adds a document with the given file content and, if text is
+// not "", its text.
+func (s *LocalStore) addDocument(doc GodocsDocument, content []byte, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc.DocumentType == "" {
+		doc.DocumentType = path.Ext(doc.Name)
+	}
+	s.docs = append(s.docs, &localDoc{GodocsDocument: doc, content: content, text: text})
+}
+
+// doc finds a document by ULID. Callers must hold s.mu.
+func (s *LocalStore) doc(ulid string) (*localDoc, error) {
+	for _, d := range s.docs {
+		if d.ULID == ulid {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("document %s: %w", ulid, errLocalNotFound)
+}
+
+// tag finds a tag by ID. Callers must hold s.mu.
+func (s *LocalStore) tag(id int) (GodocsTag, bool) {
+	i := slices.IndexFunc(s.tags, func(t GodocsTag) bool { return t.ID == id })
+	if i < 0 {
+		return GodocsTag{}, false
+	}
+	return s.tags[i], true
+}
+
+// list returns one page of the documents keep accepts. Callers must hold
+// s.mu.
+func (s *LocalStore) list(page, pageSize int, keep func(*localDoc) bool) *GodocsSearchResponse {
+	var docs []GodocsDocument
+	for _, d := range s.docs {
+		if keep(d) {
+			docs = append(docs, d.GodocsDocument)
+		}
+	}
+	page, pageSize = max(page, 1), max(pageSize, 1)
+	sr := &GodocsSearchResponse{Page: page, PageSize: pageSize, TotalCount: len(docs), TotalPages: (len(docs) + pageSize - 1) / pageSize}
+	start := min((page-1)*pageSize, len(docs))
+	end := min(start+pageSize, len(docs))
+	sr.Documents = docs[start:end]
+	sr.HasNext, sr.HasPrevious = end < len(docs), page > 1
+	return sr
+}
+
+func (s *LocalStore) FetchTags() ([]GodocsTag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.tags), nil
+}
+
+func (s *LocalStore) Tag(id int) (GodocsTag, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tag(id)
+}
+
+func (s *LocalStore) KnownTags() []GodocsTag {
+	tags, _ := s.FetchTags()
+	return tags
+}
+
+func (s *LocalStore) FetchTagGroups(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var groups []string
+	for _, t := range s.tags {
+		if t.TagGroup != "" && !slices.Contains(groups, t.TagGroup) {
+			groups = append(groups, t.TagGroup)
+		}
+	}
+	return groups, nil
+}
+
+func (s *LocalStore) CreateTag(name, color, group string) (*GodocsTag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := 1
+	for _, t := range s.tags {
+		if strings.EqualFold(t.Name, name) {
+			return nil, fmt.Errorf("create tag failed: tag %q exists", name)
+		}
+		id = max(id, t.ID+1)
+	}
+	t := GodocsTag{ID: id, Name: name, Color: color, TagGroup: group}
+	s.tags = append(s.tags, t)
+	return &t, nil
+}
+
+func (s *LocalStore) DeleteTag(tagID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tag(tagID); !ok {
+		return fmt.Errorf("tag %d: %w", tagID, errLocalNotFound)
+	}
+	s.tags = slices.DeleteFunc(s.tags, func(t GodocsTag) bool { return t.ID == tagID })
+	for _, d := range s.docs {
+		d.tags = slices.DeleteFunc(d.tags, func(id int) bool { return id == tagID })
+	}
+	return nil
+}
+
+func (s *LocalStore) FetchUntagged(page, pageSize int) (*GodocsSearchResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(page, pageSize, func(d *localDoc) bool { return len(d.tags) == 0 }), nil
+}
+
+func (s *LocalStore) TagCount(ctx context.Context, tagID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, d := range s.docs {
+		if slices.Contains(d.tags, tagID) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *LocalStore) FetchTagged(ctx context.Context, tagID, page, pageSize int) (*GodocsSearchResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(page, pageSize, func(d *localDoc) bool { return slices.Contains(d.tags, tagID) }), nil
+}
+
+func (s *LocalStore) IterateDocuments(ctx context.Context, tagID int) iter.Seq2[GodocsDocument, error] {
+	return s.iterate(ctx, func(d *localDoc) bool { return slices.Contains(d.tags, tagID) })
+}
+
+func (s *LocalStore) IterateUntagged(ctx context.Context) iter.Seq2[GodocsDocument, error] {
+	return s.iterate(ctx, func(d *localDoc) bool { return len(d.tags) == 0 })
+}
+
+// iterate yields the documents keep accepts as they were when it began.
+func (s *LocalStore) iterate(ctx context.Context, keep func(*localDoc) bool) iter.Seq2[GodocsDocument, error] {
+	return func(yield func(GodocsDocument, error) bool) {
+		s.mu.Lock()
+		docs := s.list(1, len(s.docs), keep).Documents
+		s.mu.Unlock()
+		for _, doc := range docs {
+			if err := ctx.Err(); err != nil {
+				yield(GodocsDocument{}, err)
+				return
+			}
+			if !yield(doc, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *LocalStore) SearchDocuments(ctx context.Context, q SearchQuery, limit int) ([]GodocsDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	term := strings.ToLower(q.Term)
+	sr := s.list(1, len(s.docs), func(d *localDoc) bool {
+		day := d.IngressTime[:min(len(d.IngressTime), 10)]
+		return (q.TagID == 0 || slices.Contains(d.tags, q.TagID)) &&
+			(term == "" || strings.Contains(strings.ToLower(d.Name), term) || strings.Contains(strings.ToLower(d.text), term)) &&
+			(q.From == "" || day >= q.From) && (q.To == "" || day <= q.To)
+	})
+	return sr.Documents[:min(len(sr.Documents), limit)], nil
+}
+
+func (s *LocalStore) FetchDocStatus(ctx context.Context, ulid string) (*GodocsDocStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.doc(ulid)
+	if err != nil {
+		return nil, fmt.Errorf("fetching doc status: %w", err)
+	}
+	return &GodocsDocStatus{
+		ULID:          d.ULID,
+		Name:          d.Name,
+		Path:          d.Path,
+		DocumentType:  d.DocumentType,
+		HasText:       d.text != "",
+		TextLength:    len(d.text),
+		IngressTime:   d.IngressTime,
+		FileExists:    true,
+		FileSizeBytes: len(d.content),
+		TagCount:      len(d.tags),
+		DocumentDate:  d.date,
+	}, nil
+}
+
+// FetchDocText returns a document's text, or "" if it has none yet.
+func (s *LocalStore) FetchDocText(ctx context.Context, ulid string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.doc(ulid)
+	if err != nil {
+		return "", nil
+	}
+	return d.text, nil
+}
+
+func (s *LocalStore) FetchDocTags(ctx context.Context, ulid string) ([]GodocsTag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.doc(ulid)
+	if err != nil {
+		return nil, nil
+	}
+	var tags []GodocsTag
+	for _, id := range d.tags {
+		if t, ok := s.tag(id); ok {
+			tags = append(tags, t)
+		}
+	}
+	return tags, nil
+}
+
+func (s *LocalStore) AddTag(ulid string, tagID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.doc(ulid)
+	if err != nil {
+		return fmt.Errorf("adding tag: %w", err)
+	}
+	if _, ok := s.tag(tagID); !ok {
+		return fmt.Errorf("adding tag: tag %d: %w", tagID, errLocalNotFound)
+	}
+	if !slices.Contains(d.tags, tagID) {
+		d.tags = append(d.tags, tagID)
+	}
+	return nil
+}
+
+// AddTags adds each tag in turn, as GodocsClient.AddTags does.
+func (s *LocalStore) AddTags(ulid string, tagIDs []int) ([]int, error) {
+	var added []int
+	var failed []error
+	for _, id := range tagIDs {
+		if err := s.AddTag(ulid, id); err != nil {
+			failed = append(failed, fmt.Errorf("tag %d: %w", id, err))
+		} else {
+			added = append(added, id)
+		}
+	}
+	return added, errors.Join(failed...)
+}
+
+func (s *LocalStore) RemoveTag(ulid string, tagID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.doc(ulid)
+	if err != nil {
+		return fmt.Errorf("removing tag: %w", err)
+	}
+	d.tags = slices.DeleteFunc(d.tags, func(id int) bool { return id == tagID })
+	return nil
+}
+
+func (s *LocalStore) UploadDocumentText(ulid, text string) error {
+	return s.update(ulid, "uploading text", func(d *localDoc) { d.text = text })
+}
+
+func (s *LocalStore) UpdateDocumentDate(ulid, date string) error {
+	return s.update(ulid, "updating date", func(d *localDoc) { d.date = date })
+}
+
+func (s *LocalStore) MoveDocument(ulid, folder string) error {
+	return s.update(ulid, "moving document", func(d *localDoc) { d.Folder = folder })
+}
+
+func (s *LocalStore) update(ulid, what string, f func(*localDoc)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.doc(ulid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	f(d)
+	return nil
+}
+
+func (s *LocalStore) DeleteDocument(ulid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.doc(ulid); err != nil {
+		return fmt.Errorf("deleting document: %w", err)
+	}
+	s.docs = slices.DeleteFunc(s.docs, func(d *localDoc) bool { return d.ULID == ulid })
+	return nil
+}
+
+// DownloadDocument writes a document to a scratch file, as
+// GodocsClient.DownloadDocument does, after the store's delay.
+func (s *LocalStore) DownloadDocument(ulid, pattern string, maxBytes int64) (string, error) {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	d, err := s.doc(ulid)
+	var content []byte
+	if err == nil {
+		content = d.content
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("downloading document: %w", err)
+	}
+	if maxBytes > 0 && int64(len(content)) > maxBytes {
+		return "", fmt.Errorf("document is %d bytes, over the %d byte download limit", len(content), maxBytes)
+	}
+	f, err := scratch.create(pattern)
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		scratch.release(f.Name())
+		return "", fmt.Errorf("writing document: %w", err)
+	}
+	return f.Name(), nil
+}
+
+func (s *LocalStore) Thumbnail(ctx context.Context, ulid string) ([]byte, string, error) {
+	return nil, "", fmt.Errorf("thumbnail of %s: %w", ulid, errLocalNotFound)
+}
+
+func (s *LocalStore) ViewURL(ulid string) string { return "" }
+
+// UploadDocument adds a document read from r, with a ULID of the form
+// 01LOCAL1, 01LOCAL2...
+func (s *LocalStore) UploadDocument(name string, r io.Reader) (*GodocsDocument, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("uploading %s: %w", name, err)
+	}
+	s.mu.Lock()
+	s.uploads++
+	doc := GodocsDocument{ULID: fmt.Sprintf("01LOCAL%d", s.uploads), Name: name, Path: name, IngressTime: time.Now().UTC().Format(time.RFC3339)}
+	s.mu.Unlock()
+	s.addDocument(doc, content, "")
+	doc.DocumentType = path.Ext(name)
+	return &doc, nil
+}
+
+func (s *LocalStore) CreateDocument(ctx context.Context, file string, opts CreateOptions) (*GodocsDocument, error) {
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.UploadDocument(name, f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return doc, applyCreateOptions(s, doc, opts)
+}
+
+// Ping always succeeds at once.
+func (s *LocalStore) Ping() (time.Duration, error) { return 0, nil }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/logfile"
+)
+
+// Besides the general log on stderr the inbox keeps three log streams:
+// access (one line per HTTP request), pipeline (background jobs starting,
+// changing stage and ending, their failures and LLM requests) and actions
+// (what each user did). By default they go to the general log like
+// everything else. With logs.dir set each is written to its own file
+// there, access.log, pipeline.log and actions.log, rotated by size and
+// age, so a long-running inbox keeps its history through journald
+// truncation without filling the disk:
+//
+//	logs:
+//	  dir: /var/log/godocs-inbox
+//	  max_size_mb: 10   # rotate above this (default 10)
+//	  max_age_days: 7   # and after this long (default: no limit)
+//	  keep: 5           # rotated files kept per stream (default 5)
+
+const (
+	defaultLogMaxSizeMB = 10
+	defaultLogKeep      = 5
+)
+
+// LogsConfig places the access, pipeline and action logs in files.
+type LogsConfig struct {
+	Dir        string `yaml:"dir,omitempty"`
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"`
+	MaxAgeDays int    `yaml:"max_age_days,omitempty"`
+	Keep       int    `yaml:"keep,omitempty"` // -1 keeps none
+}
+
+func (c LogsConfig) validate() error {
+	if c.MaxSizeMB < 0 || c.MaxAgeDays < 0 || c.Keep < -1 {
+		return fmt.Errorf("logs: values must be positive, or keep -1 for no rotated files")
+	}
+	return nil
+}
+
+func (c LogsConfig) options() logfile.Options {
+	return logfile.Options{
+		MaxSize: int64(cmp.Or(c.MaxSizeMB, defaultLogMaxSizeMB)) << 20,
+		MaxAge:  time.Duration(c.MaxAgeDays) * 24 * time.Hour,
+		Keep:    max(cmp.Or(c.Keep, defaultLogKeep), 0),
+	}
+}
+
+// logStream is one of the log streams. It writes to the general log until
+// a file is set.
+type logStream struct {
+	name string
+	mu   sync.Mutex
+	file *logfile.File
+	out  *log.Logger // on file; nil for the general log
+}
+
+var (
+	accessLog   = &logStream{name: "access"}
+	pipelineLog = &logStream{name: "pipeline"}
+	actionLog   = &logStream{name: "actions"}
+	logStreams  = []*logStream{accessLog, pipelineLog, actionLog}
+)
+
+func (s *logStream) Printf(format string, args ...any) {
+	s.mu.Lock()
+	out := s.out
+	s.mu.Unlock()
+	if out == nil {
+		log.Printf(format, args...)
+		return
+	}
+	out.Printf(format, args...)
+}
+
+// setFile sends the stream to f, or back to the general log when f is nil,
+// closing any file it had.
+func (s *logStream) setFile(f *logfile.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, s.out = f, nil
+	if f != nil {
+		s.out = log.New(f, "", log.LstdFlags)
+	}
+}
+
+// openLogs sends each stream to its file in c.Dir, if set.
+func openLogs(c LogsConfig) error {
+	if c.Dir == "" {
+		return nil
+	}
+	var errs []error
+	for _, s := range logStreams {
+		f, err := logfile.Open(filepath.Join(c.Dir, s.name+".log"), c.options())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("logs: %w", err))
+			continue
+		}
+		s.setFile(f)
+	}
+	if len(errs) == 0 {
+		log.Printf("Logging access, pipeline and actions to %s", c.Dir)
+	}
+	return errors.Join(errs...)
+}
+
+// closeLogs sends every stream back to the general log.
+func closeLogs() {
+	for _, s := range logStreams {
+		s.setFile(nil)
+	}
+}
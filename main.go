@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
@@ -11,15 +13,22 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	thumbnails "github.com/drummonds/go-thumbnails"
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/keymap"
+	"github.com/drummonds/godocs-inbox/internal/lang"
 	"github.com/drummonds/godocs-inbox/internal/llm"
-	"github.com/drummonds/godocs-inbox/internal/ocr"
+	"github.com/drummonds/godocs-inbox/internal/mqtt"
+	"github.com/drummonds/godocs-inbox/internal/s3"
+	"github.com/drummonds/godocs-inbox/internal/store"
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
 )
 
@@ -37,15 +46,77 @@ type ShortcutConfig struct {
 	Color string `yaml:"-"     json:"color"` // populated from server
 }
 
+// PresetConfig is a named tag set applied with a single key.
+type PresetConfig struct {
+	Name   string        `yaml:"name"`
+	Key    string        `yaml:"key"`
+	TagIDs []int         `yaml:"tag_ids"`
+	Tags   []TagSetEntry `yaml:"-"` // populated from server
+}
+
 type Config struct {
-	GodocsServer string           `yaml:"godocs_server"`
-	Addr         string           `yaml:"addr"`
-	Shortcuts    []ShortcutConfig `yaml:"tags"` // yaml key kept as "tags" for simplicity
-	OllamaURL    string           `yaml:"ollama_url,omitempty"`
-	OllamaModel  string           `yaml:"ollama_model,omitempty"`
-	// Demo-only fields (not in yaml)
-	InboxDir  string `yaml:"inbox_dir,omitempty"`
-	TaggedDir string `yaml:"tagged_dir,omitempty"`
+	GodocsServer       string              `yaml:"godocs_server"`
+	Addr               string              `yaml:"addr"`
+	BasePath           string              `yaml:"base_path,omitempty"` // URL prefix when served behind a reverse proxy
+	TLSCert            string              `yaml:"tls_cert,omitempty"`  // serve HTTPS with this certificate
+	TLSKey             string              `yaml:"tls_key,omitempty"`
+	GodocsTLS          GodocsTLSConfig     `yaml:"godocs_tls,omitempty"`
+	GodocsHTTP         GodocsHTTPConfig    `yaml:"godocs_http,omitempty"` // timeouts and connection pools
+	Shortcuts          []ShortcutConfig    `yaml:"tags"`                  // yaml key kept as "tags" for simplicity
+	Presets            []PresetConfig      `yaml:"presets,omitempty"`
+	Layers             []ShortcutLayer     `yaml:"layers,omitempty"`               // further shortcut sets switched with Alt (see layers.go)
+	RequiredGroups     []string            `yaml:"required_groups,omitempty"`      // tag groups needing exactly one tag (see requiredgroups.go)
+	TagActions         []TagActionConfig   `yaml:"tag_actions,omitempty"`          // delete, webhook or move on tagging (see tagactions.go)
+	AutoTag            AutoTagConfig       `yaml:"auto_tag,omitempty"`             // unattended tagging sweeps (see autotag.go)
+	QuickSort          []QuickSortBucket   `yaml:"quick_sort,omitempty"`           // bucket tags for two-pass triage (see quicksort.go)
+	Aging              AgingConfig         `yaml:"aging,omitempty"`                // when untagged documents show as old (see aging.go)
+	ArchiveFolder      string              `yaml:"archive_folder,omitempty"`       // godocs folder "e" moves a document to untagged (see archive.go)
+	CommitDelaySeconds int                 `yaml:"commit_delay_seconds,omitempty"` // hold tag shortcuts back this long, for free undo (see delayedcommit.go)
+	DailyGoal          int                 `yaml:"daily_goal,omitempty"`           // documents to tag each day, with a progress bar and streak (see goals.go)
+	Users              []UserConfig        `yaml:"users,omitempty"`
+	Webhooks           []WebhookConfig     `yaml:"webhooks,omitempty"`
+	Notifications      NotificationsConfig `yaml:"notifications,omitempty"` // ntfy/Pushover/Slack alerts (see notify.go)
+	MQTT               MQTTConfig          `yaml:"mqtt,omitempty"`          // inbox state for home automation (see mqtt.go)
+	S3                 S3Config            `yaml:"s3,omitempty"`            // upload new files from a bucket (see s3.go)
+	CloudDrives        []CloudDriveConfig  `yaml:"cloud_drives,omitempty"`  // upload new files from Dropbox/Google Drive (see clouddrive.go)
+	OllamaURL          string              `yaml:"ollama_url,omitempty"`
+	OllamaModel        string              `yaml:"ollama_model,omitempty"`
+	Models             ModelsConfig        `yaml:"models,omitempty"`          // per-task model fallback lists
+	Prompts            map[string]string   `yaml:"prompts,omitempty"`         // LLM prompt templates by task (see prompts.go)
+	PromptDir          string              `yaml:"prompt_dir,omitempty"`      // directory of <task>.tmpl prompt templates
+	Languages          LanguageConfig      `yaml:"languages,omitempty"`       // preview translation targets
+	EmbeddingModel     string              `yaml:"embedding_model,omitempty"` // Ollama model for tag suggestions
+	DocTypes           []string            `yaml:"doc_types,omitempty"`       // taxonomy for LLM type classification
+	MaxDownloadMB      int                 `yaml:"max_download_mb,omitempty"`
+	ScratchMaxMB       int                 `yaml:"scratch_max_mb,omitempty"`    // sweep temp files early above this (see scratch.go)
+	CacheTTLSeconds    int                 `yaml:"cache_ttl_seconds,omitempty"` // godocs response cache lifetime
+	Pipeline           PipelineConfig      `yaml:"pipeline,omitempty"`
+	OCRMinConfidence   int                 `yaml:"ocr_min_confidence,omitempty"`  // flag OCR below this mean word confidence (default 60; -1 disables)
+	DateMinConfidence  float64             `yaml:"date_min_confidence,omitempty"` // auto-apply an inferred date above this confidence (default 0.7)
+	DateHeuristics     string              `yaml:"date_heuristics,omitempty"`     // fallback (default), cross_check, only or off
+	DateOrder          string              `yaml:"date_order,omitempty"`          // dmy or mdy, for dates like 03/04/2026 (default: the locale's)
+	Locale             string              `yaml:"locale,omitempty"`              // how dates are shown, e.g. en-GB (see locale.go)
+	Timezone           string              `yaml:"timezone,omitempty"`            // IANA zone times are shown in (default: the server's)
+	SearchablePDF      SearchablePDFConfig `yaml:"searchable_pdf,omitempty"`
+	Separators         SeparatorConfig     `yaml:"separators,omitempty"`
+	PDFPasswords       []string            `yaml:"pdf_passwords,omitempty"`     // tried on encrypted PDFs
+	ToolPaths          map[string]string   `yaml:"tools,omitempty"`             // binaries for external tools not in PATH (see tools.go)
+	GodocsHookToken    string              `yaml:"godocs_hook_token,omitempty"` // enables POST /hooks/godocs
+	Expenses           ExpenseConfig       `yaml:"expenses,omitempty"`
+	Limits             LimitConfig         `yaml:"limits,omitempty"`
+	Thumbnails         ThumbnailConfig     `yaml:"thumbnails,omitempty"`
+	Paperless          PaperlessConfig     `yaml:"paperless,omitempty"`
+	Profiles           []ProfileConfig     `yaml:"profiles,omitempty"`   // several godocs servers (see profiles.go)
+	Debug              bool                `yaml:"debug,omitempty"`      // mount pprof and /debug/state (see debug.go)
+	DryRun             bool                `yaml:"dry_run,omitempty"`    // log changes to godocs instead of making them (see dryrun.go)
+	LLMBudget          LLMBudgetConfig     `yaml:"llm_budget,omitempty"` // warn when a document takes more LLM work (see llmusage.go)
+	Logs               LogsConfig          `yaml:"logs,omitempty"`       // access, pipeline and action log files (see logs.go)
+	// Profile is the name of the profile this config was built for
+	Profile string `yaml:"-"`
+	// localDir replaces cacheDir; demo mode keeps its state apart
+	localDir string
+	prompts  llm.Prompts    // parsed from Prompts and PromptDir
+	location *time.Location // loaded from Timezone; nil for the server's
 }
 
 type TagSetEntry struct {
@@ -113,66 +184,129 @@ type GodocsDocStatus struct {
 
 type GodocsClient struct {
 	baseURL    string
-	httpClient *http.Client
-	tags       map[int]GodocsTag // tag ID → tag
+	httpClient *http.Client // metadata calls
+	transfers  *http.Client // document downloads and uploads (see godocshttp.go)
+	tagsMu     sync.Mutex
+	tags       map[int]GodocsTag // tag ID → tag, guarded by tagsMu
+	cache      *responseCache
+	texts      *textCache // document text on disk; nil outside server mode
+
+	pageInterval time.Duration // least time between page requests (see paging.go)
 }
 
 func NewGodocsClient(baseURL string) *GodocsClient {
 	return &GodocsClient{
 		baseURL:    strings.TrimRight(baseURL, "/"),
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		httpClient: &http.Client{Timeout: defaultGodocsTimeout, Transport: requestIDTransport{http.DefaultTransport}},
+		transfers:  &http.Client{Timeout: defaultTransferTimeout, Transport: requestIDTransport{http.DefaultTransport}},
 		tags:       make(map[int]GodocsTag),
+		cache:      newResponseCache(defaultCacheTTL),
+
+		pageInterval: defaultPageInterval,
 	}
 }
 
 func (c *GodocsClient) FetchTags() ([]GodocsTag, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/api/tags")
+	body, err := c.getCached(context.Background(), c.baseURL+"/api/tags")
 	if err != nil {
 		return nil, fmt.Errorf("fetching tags: %w", err)
 	}
-	defer resp.Body.Close()
 	var tags []GodocsTag
-	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+	if err := json.Unmarshal(body, &tags); err != nil {
 		return nil, fmt.Errorf("decoding tags: %w", err)
 	}
-	c.tags = make(map[int]GodocsTag)
+	byID := make(map[int]GodocsTag, len(tags))
 	for _, t := range tags {
-		c.tags[t.ID] = t
+		byID[t.ID] = t
 	}
+	c.tagsMu.Lock()
+	c.tags = byID
+	c.tagsMu.Unlock()
 	return tags, nil
 }
 
+// Ping checks that the godocs API is reachable and reports the round-trip latency.
+func (c *GodocsClient) Ping() (time.Duration, error) {
+	start := time.Now()
+	resp, err := c.httpClient.Get(c.baseURL + "/api/tags")
+	if err != nil {
+		return 0, fmt.Errorf("pinging godocs: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	latency := time.Since(start)
+	if resp.StatusCode >= 400 {
+		return latency, fmt.Errorf("godocs returned status %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
 func (c *GodocsClient) FetchUntagged(page, pageSize int) (*GodocsSearchResponse, error) {
-	url := fmt.Sprintf("%s/api/documents/untagged?page=%d&pageSize=%d", c.baseURL, page, pageSize)
-	resp, err := c.httpClient.Get(url)
+	return c.fetchUntagged(context.Background(), page, pageSize)
+}
+
+// getWithContext issues a GET bound to ctx so callers can share a deadline.
+func (c *GodocsClient) getWithContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(req)
+}
+
+// FetchTagged returns one page of documents carrying the given tag.
+func (c *GodocsClient) FetchTagged(ctx context.Context, tagID, page, pageSize int) (*GodocsSearchResponse, error) {
+	url := fmt.Sprintf("%s/api/documents/tag/%d?page=%d&pageSize=%d", c.baseURL, tagID, page, pageSize)
+	resp, err := c.getWithContext(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("fetching untagged: %w", err)
+		return nil, fmt.Errorf("fetching tagged documents: %w", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetching tagged documents: status %d", resp.StatusCode)
+	}
 	var sr GodocsSearchResponse
 	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
-		return nil, fmt.Errorf("decoding untagged: %w", err)
+		return nil, fmt.Errorf("decoding tagged documents: %w", err)
 	}
 	return &sr, nil
 }
 
-func (c *GodocsClient) FetchDocStatus(ulid string) (*GodocsDocStatus, error) {
+// TagCount returns how many documents carry a tag, through the response
+// cache; tagging through the client drops the cached count.
+func (c *GodocsClient) TagCount(ctx context.Context, tagID int) (int, error) {
+	body, err := c.getCached(ctx, fmt.Sprintf("%s/api/documents/tag/%d?page=1&pageSize=1", c.baseURL, tagID))
+	if err != nil {
+		return 0, fmt.Errorf("counting tagged documents: %w", err)
+	}
+	var sr GodocsSearchResponse
+	if err := json.Unmarshal(body, &sr); err != nil {
+		return 0, fmt.Errorf("decoding tagged documents: %w", err)
+	}
+	return sr.TotalCount, nil
+}
+
+func (c *GodocsClient) FetchDocStatus(ctx context.Context, ulid string) (*GodocsDocStatus, error) {
 	url := fmt.Sprintf("%s/api/document/%s/status", c.baseURL, ulid)
-	resp, err := c.httpClient.Get(url)
+	body, err := c.getCached(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("fetching doc status: %w", err)
 	}
-	defer resp.Body.Close()
 	var ds GodocsDocStatus
-	if err := json.NewDecoder(resp.Body).Decode(&ds); err != nil {
+	if err := json.Unmarshal(body, &ds); err != nil {
 		return nil, fmt.Errorf("decoding doc status: %w", err)
 	}
 	return &ds, nil
 }
 
-func (c *GodocsClient) FetchDocText(ulid string) (string, error) {
+// FetchDocText returns a document's full text, from the text cache when it
+// has been fetched before.
+func (c *GodocsClient) FetchDocText(ctx context.Context, ulid string) (string, error) {
+	if text, ok := c.texts.get(ulid); ok {
+		return text, nil
+	}
 	url := fmt.Sprintf("%s/api/document/%s/text", c.baseURL, ulid)
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.getWithContext(ctx, url)
 	if err != nil {
 		return "", fmt.Errorf("fetching doc text: %w", err)
 	}
@@ -184,10 +318,9 @@ func (c *GodocsClient) FetchDocText(ulid string) (string, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", fmt.Errorf("decoding doc text: %w", err)
 	}
-	if text, ok := result["text"]; ok {
-		return text, nil
-	}
-	return "", nil
+	text := result["text"]
+	c.texts.put(ulid, text)
+	return text, nil
 }
 
 func (c *GodocsClient) AddTag(ulid string, tagID int) error {
@@ -202,6 +335,8 @@ func (c *GodocsClient) AddTag(ulid string, tagID int) error {
 		return fmt.Errorf("adding tag: %w", err)
 	}
 	defer resp.Body.Close()
+	c.invalidateDoc(ulid)
+	c.invalidateTagCount(tagID)
 	if resp.StatusCode >= 400 {
 		b, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("add tag failed (%d): %s", resp.StatusCode, string(b))
@@ -209,9 +344,38 @@ func (c *GodocsClient) AddTag(ulid string, tagID int) error {
 	return nil
 }
 
-func (c *GodocsClient) FetchDocTags(ulid string) ([]GodocsTag, error) {
+// addTagsParallel bounds the concurrent requests made by AddTags.
+const addTagsParallel = 4
+
+// AddTags adds several tags to a document. godocs has no bulk tagging
+// endpoint, so each tag is a separate request, at most addTagsParallel at a
+// time. It returns the IDs that were added, in the order given, and every
+// failure joined into one error.
+func (c *GodocsClient) AddTags(ulid string, tagIDs []int) ([]int, error) {
+	errs := make([]error, len(tagIDs))
+	var g errgroup.Group
+	g.SetLimit(addTagsParallel)
+	for i, id := range tagIDs {
+		g.Go(func() error {
+			if err := c.AddTag(ulid, id); err != nil {
+				errs[i] = fmt.Errorf("tag %d: %w", id, err)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	var added []int
+	for i, id := range tagIDs {
+		if errs[i] == nil {
+			added = append(added, id)
+		}
+	}
+	return added, errors.Join(errs...)
+}
+
+func (c *GodocsClient) FetchDocTags(ctx context.Context, ulid string) ([]GodocsTag, error) {
 	url := fmt.Sprintf("%s/api/documents/%s/tags", c.baseURL, ulid)
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.getWithContext(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("fetching doc tags: %w", err)
 	}
@@ -234,6 +398,8 @@ func (c *GodocsClient) RemoveTag(ulid string, tagID int) error {
 		return fmt.Errorf("removing tag: %w", err)
 	}
 	defer resp.Body.Close()
+	c.invalidateDoc(ulid)
+	c.invalidateTagCount(tagID)
 	if resp.StatusCode >= 400 {
 		b, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("remove tag failed (%d): %s", resp.StatusCode, string(b))
@@ -241,35 +407,82 @@ func (c *GodocsClient) RemoveTag(ulid string, tagID int) error {
 	return nil
 }
 
-func (c *GodocsClient) FetchTagGroups() ([]string, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/api/tags/groups")
+// DeleteDocument removes a document (and its file) from godocs.
+func (c *GodocsClient) DeleteDocument(ulid string) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/document/%s", c.baseURL, ulid), nil)
 	if err != nil {
-		return nil, fmt.Errorf("fetching tag groups: %w", err)
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deleting document: %w", err)
 	}
 	defer resp.Body.Close()
+	c.invalidateDoc(ulid)
+	c.invalidateTagCount(0) // its tags are not known here
+	c.texts.remove(ulid)
+	if resp.StatusCode >= 400 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete failed (%d): %s", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+func (c *GodocsClient) FetchTagGroups(ctx context.Context) ([]string, error) {
+	body, err := c.getCached(ctx, c.baseURL+"/api/tags/groups")
+	if err != nil {
+		return nil, fmt.Errorf("fetching tag groups: %w", err)
+	}
 	var groups []string
-	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+	if err := json.Unmarshal(body, &groups); err != nil {
 		return nil, nil
 	}
 	return groups, nil
 }
 
-func (c *GodocsClient) DownloadDocument(ulid string) ([]byte, string, error) {
+// DownloadDocument streams a document to a new temp file whose name matches
+// pattern (as for os.CreateTemp) in the scratch directory and returns its
+// path. The caller removes it with scratch.release. Downloads larger than maxBytes are aborted; maxBytes <= 0 means no limit.
+func (c *GodocsClient) DownloadDocument(ulid, pattern string, maxBytes int64) (string, error) {
 	url := fmt.Sprintf("%s/document/view/%s", c.baseURL, ulid)
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.transfers.Get(url)
 	if err != nil {
-		return nil, "", fmt.Errorf("downloading document: %w", err)
+		return "", fmt.Errorf("downloading document: %w", err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return nil, "", fmt.Errorf("download failed with status %d", resp.StatusCode)
+		return "", fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return "", fmt.Errorf("document is %d bytes, over the %d byte download limit", resp.ContentLength, maxBytes)
+	}
+
+	f, err := scratch.create(pattern)
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	var body io.Reader = resp.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	n, err := io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && maxBytes > 0 && n > maxBytes {
+		err = fmt.Errorf("document exceeds the %d byte download limit", maxBytes)
 	}
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, "", fmt.Errorf("reading document body: %w", err)
+		scratch.release(f.Name())
+		return "", fmt.Errorf("writing document: %w", err)
 	}
-	contentType := resp.Header.Get("Content-Type")
-	return body, contentType, nil
+	return f.Name(), nil
+}
+
+// UploadDocument adds a new document to godocs from r, stored under name,
+// and returns it as godocs ingested it.
+func (c *GodocsClient) UploadDocument(name string, r io.Reader) (*GodocsDocument, error) {
+	return c.upload(context.Background(), name, r)
 }
 
 func (c *GodocsClient) UploadDocumentText(ulid, text string) error {
@@ -284,10 +497,13 @@ func (c *GodocsClient) UploadDocumentText(ulid, text string) error {
 		return fmt.Errorf("uploading text: %w", err)
 	}
 	defer resp.Body.Close()
+	c.invalidateDoc(ulid)
 	if resp.StatusCode >= 400 {
+		c.texts.remove(ulid)
 		b, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("upload text failed (%d): %s", resp.StatusCode, string(b))
 	}
+	c.texts.put(ulid, text)
 	return nil
 }
 
@@ -303,6 +519,7 @@ func (c *GodocsClient) UpdateDocumentDate(ulid, date string) error {
 		return fmt.Errorf("updating date: %w", err)
 	}
 	defer resp.Body.Close()
+	c.invalidateDoc(ulid)
 	if resp.StatusCode >= 400 {
 		b, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("update date failed (%d): %s", resp.StatusCode, string(b))
@@ -310,6 +527,27 @@ func (c *GodocsClient) UpdateDocumentDate(ulid, date string) error {
 	return nil
 }
 
+// MoveDocument moves a document to another godocs folder.
+func (c *GodocsClient) MoveDocument(ulid, folder string) error {
+	body := strings.NewReader(fmt.Sprintf(`{"folder":%s}`, jsonString(folder)))
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/document/%s/folder", c.baseURL, ulid), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("moving document: %w", err)
+	}
+	defer resp.Body.Close()
+	c.invalidateDoc(ulid)
+	if resp.StatusCode >= 400 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("move failed (%d): %s", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
 func jsonString(s string) string {
 	b, _ := json.Marshal(s)
 	return string(b)
@@ -334,6 +572,7 @@ func (c *GodocsClient) CreateTag(name, color, group string) (*GodocsTag, error)
 		return nil, fmt.Errorf("creating tag: %w", err)
 	}
 	defer resp.Body.Close()
+	c.invalidateTags()
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("create tag failed (%d): %s", resp.StatusCode, string(body))
@@ -343,15 +582,40 @@ func (c *GodocsClient) CreateTag(name, color, group string) (*GodocsTag, error)
 		return nil, fmt.Errorf("decoding created tag: %w", err)
 	}
 	// Update local cache
+	c.tagsMu.Lock()
 	c.tags[tag.ID] = tag
+	c.tagsMu.Unlock()
 	return &tag, nil
 }
 
+// DeleteTag deletes a tag from godocs.
+func (c *GodocsClient) DeleteTag(tagID int) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/tags/%d", c.baseURL, tagID), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deleting tag: %w", err)
+	}
+	defer resp.Body.Close()
+	c.invalidateTags()
+	if resp.StatusCode >= 400 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete tag failed (%d): %s", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+// pageFetchTimeout bounds the godocs calls made while rendering one inbox page.
+const pageFetchTimeout = 5 * time.Second
+
 // --- Processing stages ---
 
 const (
-	stageOCR = "ocr"
-	stageLLM = "llm"
+	stageOCR    = "ocr"
+	stageLLM    = "llm"
+	stageRotate = "rotate" // see rotate.go
 )
 
 // --- App ---
@@ -361,190 +625,364 @@ type LastAction struct {
 	DocName string
 	TagID   int
 	TagName string
-	// Demo mode only
-	File    string
-	FromDir string
-	ToDir   string
+	Pending bool // still queued for commit_delay_seconds (see delayedcommit.go)
+	// Archived moves the document back to Folder on undo rather than
+	// removing a tag (see archive.go)
+	Archived bool
+	Folder   string
 }
 
 type App struct {
-	mu           sync.Mutex
-	config       Config
-	configFile   string
-	client       *GodocsClient // nil in demo mode
-	lastAction   *LastAction
-	llmDates     map[string]bool   // ULID → date was set by LLM
-	recentSets   []RecentTagSet    // last N applied tag sets
-	docStage     map[string]string // ULID → current processing stage (stageOCR/stageLLM)
-	ocrFailed    map[string]bool   // ULID → OCR was attempted and failed
-	processingMu sync.Mutex
-	thumbDir     string           // cache dir for hi-res thumbnails
-	untagged     []GodocsDocument // cached untagged queue (server mode)
-	untaggedTime time.Time        // when last synced
+	mu             sync.Mutex
+	conf           atomic.Pointer[Config] // swapped whole on reload (see reload.go); read with config()
+	configFile     string
+	docs           DocumentStore                    // documents and tags (see backend.go)
+	client         *GodocsClient                    // docs when it is a godocs server, else nil
+	llmDates       map[string]bool                  // ULID → date was set by LLM
+	docTypes       map[string]*llm.Classification   // ULID → predicted document type (nil if none/pending)
+	summaries      map[string]string                // ULID → LLM summary ("" if pending/failed)
+	tagsProposed   map[string]bool                  // ULIDs the LLM was asked for new tags (see tagproposals.go)
+	languages      map[string]store.DocLanguage     // ULID → detected language and preview translation
+	docStage       map[string]*docJob               // ULID → running OCR/LLM job (see processing.go)
+	failures       map[string]*JobFailure           // ULID → last failed background job
+	hashes         map[string]store.DocHash         // ULID → content hashes for duplicate detection
+	hashing        map[string]bool                  // ULIDs being hashed
+	embeddings     map[string]store.Embedding       // ULID → text embedding and tag set, for suggestions
+	embedding      map[string]bool                  // ULIDs being embedded
+	ocrQuality     map[string]store.OCRQuality      // ULID → OCR confidence (see ocrquality.go)
+	dateCandidates map[string][]store.DateCandidate // ULID → ranked inferred dates (see dates.go)
+	docPasswords   map[string]string                // ULID → PDF password entered on the inbox page
+	processingMu   sync.Mutex
+	snoozes        map[string]store.Snooze // ULID → wake time; guarded by snoozeMu
+	snoozeMu       sync.Mutex
+	thumbDir       string                   // cache dir for hi-res thumbnails
+	thumbs         thumbQueue               // hi-res thumbnail pregeneration (see thumbnails.go)
+	untagged       []GodocsDocument         // cached untagged queue (server mode)
+	untaggedTime   time.Time                // when last synced
+	buckets        map[int][]GodocsDocument // quick sort bucket tag ID → documents awaiting the detail pass
+	pending        map[string]*pendingTag   // ULID → tag waiting out commit_delay_seconds
+	goalMetDay     string                   // last day recorded as meeting daily_goal (see goals.go)
+	manualHandling map[string]bool          // ULIDs tagged, or being tagged, for manual handling (see pipeline.go)
+	overdue        atomic.Int32             // untagged documents past aging.overdue_days at the last sync (see aging.go)
+	errors         errorLog                 // recent pipeline failures for the status page
+	usage          usageLog                 // LLM work per document, for llm_budget (see llmusage.go)
+	users          map[string]*UserSession
+	bannerSeq      int                   // last ErrorBanner ID
+	autoTagLast    *AutoTagRun           // last auto_tag sweep; nil before the first
+	tagMerge       *TagMerge             // running or last tag merge (see tagmerge.go)
+	broker         *mqtt.Client          // MQTT publisher; nil when not configured
+	godocsVersion  *GodocsVersion        // found at startup; nil when not a godocs server
+	ollama         llmHealth             // whether Ollama is reachable (see llmhealth.go)
+	tools          *ToolProbe            // external tools found at startup; nil in demo mode and tests (see tools.go)
+	s3Bucket       *s3.Client            // ingestion bucket; nil when not configured
+	ingestLast     map[string]*IngestRun // ingestion source → last poll
+	sourceTags     map[string]int        // ingested ULID → source tag to add once triaged (see ingest.go)
+	userOrder      []string              // configured profile names; empty in single-user mode
+	tmpl           *template.Template
+	mux            *http.ServeMux // routes (see routes); queued offline actions are replayed through it
+	profiles       []ProfileLink  // profile switcher; empty with a single profile
+	templatesDir   string         // -templates override directory
+	staticDir      string         // -static override directory
+	dev            bool           // re-parse templates per request
+	store          *store.Store   // persisted state (see state.go)
+	limiter        *rateLimiter   // per-IP API rate limit; nil when disabled
+	oversized      atomic.Int64   // requests rejected for body size
+}
+
+// newApp returns an App for cfg on docs with its state maps made.
+func newApp(cfg Config, docs DocumentStore) *App {
+	client, _ := docs.(*GodocsClient)
+	if cfg.DryRun {
+		docs = newDryRunStore(docs)
+	}
+	app := &App{docs: docs, client: client, llmDates: make(map[string]bool), docTypes: make(map[string]*llm.Classification), summaries: make(map[string]string), tagsProposed: make(map[string]bool), languages: make(map[string]store.DocLanguage), docStage: make(map[string]*docJob), failures: make(map[string]*JobFailure), hashes: make(map[string]store.DocHash), hashing: make(map[string]bool), embeddings: make(map[string]store.Embedding), embedding: make(map[string]bool), ocrQuality: make(map[string]store.OCRQuality), dateCandidates: make(map[string][]store.DateCandidate), docPasswords: make(map[string]string), snoozes: make(map[string]store.Snooze), ingestLast: make(map[string]*IngestRun), sourceTags: make(map[string]int), manualHandling: make(map[string]bool)}
+	app.conf.Store(&cfg)
+	return app
+}
+
+// appFor returns an App with just cfg, for commands that use its
+// config-derived helpers.
+func appFor(cfg Config) *App {
+	app := &App{}
+	app.conf.Store(&cfg)
+	return app
 }
 
-func (app *App) isDemo() bool {
-	return app.client == nil
+// config returns the running config. A reload swaps in a new one rather than
+// changing it, so it can be read without app.mu.
+func (app *App) config() *Config {
+	return app.conf.Load()
 }
 
 func (app *App) syncUntagged() {
-	if app.isDemo() {
-		return
-	}
-	sr, err := app.client.FetchUntagged(1, 10000)
+	sr, err := app.docs.FetchUntagged(1, 10000)
 	if err != nil {
 		log.Printf("syncUntagged: %v", err)
 		return
 	}
-	app.untagged = sr.Documents
+	docs := make([]GodocsDocument, 0, len(sr.Documents))
+	for _, doc := range sr.Documents {
+		if !app.isArchived(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	if len(app.untagged) > 0 && len(docs) == 0 {
+		app.emit(Event{Type: eventInboxZero})
+	}
+	app.notifyCount(len(app.untagged), len(docs))
+	app.untagged = docs
 	app.untaggedTime = time.Now()
+	app.countOverdue()
+	app.tagTriagedSources()
+	app.pruneSnoozes()
+	app.syncBuckets()
+	if app.broker != nil {
+		go app.publishState(app.inboxState())
+	}
+	app.pregenerateThumbs()
 	log.Printf("syncUntagged: %d documents cached", len(app.untagged))
 }
 
-func (app *App) hiresThumbPath(ulid string) string {
-	return filepath.Join(app.thumbDir, ulid+".png")
-}
+// startProcessing kicks off the background work a document still needs: OCR
+// when it has no text, type classification when it has text but no
+// prediction yet, a hi-res thumbnail, duplicate-detection hashes and the
+// text embedding used for tag suggestions. It reports whether OCR was started.
+// Callers must hold app.mu.
+func (app *App) startProcessing(ulid string, status *GodocsDocStatus, text string) bool {
+	manual := !status.HasText && app.config().Pipeline.route(status.DocumentType) == routeManual && app.stageEnabled(pipelineOCR, status.DocumentType)
+	if manual && !app.manualHandling[ulid] {
+		app.manualHandling[ulid] = true
+		go app.tagForManualHandling(ulid, status.DocumentType)
+	}
 
-func (app *App) hiresThumbExists(ulid string) bool {
-	_, err := os.Stat(app.hiresThumbPath(ulid))
-	return err == nil
-}
+	app.processingMu.Lock()
+	busy := app.docStage[ulid] != nil
+	startOCR := !status.HasText && !busy && !manual && app.failures[ulid] == nil && app.stageEnabled(pipelineOCR, status.DocumentType)
+	if startOCR {
+		ctx := app.beginJob(ulid, stageOCR, status.DocumentType)
+		go processDocument(ctx, app, ulid, status.DocumentType)
+	}
+	app.processingMu.Unlock()
 
-func generateHiresThumb(app *App, ulid, docType string) {
-	if app.hiresThumbExists(ulid) {
-		return
+	// OCR'd documents are classified in the pipeline
+	if _, tried := app.docTypes[ulid]; !tried && status.HasText && !busy && text != "" && app.stageEnabled(pipelineClassify, status.DocumentType) {
+		app.docTypes[ulid] = nil
+		go classifyDocument(app, ulid, text)
+	}
+	if _, tried := app.summaries[ulid]; !tried && status.HasText && !busy && text != "" && app.stageEnabled(pipelineSummary, status.DocumentType) {
+		app.summaries[ulid] = ""
+		go summarizeDocument(app, ulid, text)
+	}
+	if _, tried := app.languages[ulid]; !tried && status.HasText && !busy && text != "" && app.stageEnabled(pipelineLanguage, status.DocumentType) {
+		app.languages[ulid] = store.DocLanguage{ULID: ulid}
+		go detectLanguage(app, ulid, text)
+	}
+	if !app.tagsProposed[ulid] && status.HasText && !busy && text != "" && app.stageEnabled(pipelineTagProposals, status.DocumentType) {
+		app.tagsProposed[ulid] = true
+		go proposeTags(app, ulid, text)
 	}
 
-	data, _, err := app.client.DownloadDocument(ulid)
-	if err != nil {
-		log.Printf("hires-thumb: download failed for %s: %v", ulid, err)
-		return
+	if status.HasThumbnail && app.stageEnabled(pipelineHiresThumbs, status.DocumentType) {
+		app.startHiresThumb(ulid, status.DocumentType)
 	}
+	if app.stageEnabled(pipelineDuplicates, status.DocumentType) {
+		app.startHashing(ulid, status.Name, status.DocumentType)
+	}
+	if text != "" && app.stageEnabled(pipelineSuggestions, status.DocumentType) {
+		app.startEmbedding(ulid, text)
+	}
+	return startOCR
+}
 
-	tmpFile, err := os.CreateTemp("", "godocs-thumb-*"+docType)
-	if err != nil {
-		log.Printf("hires-thumb: temp file failed for %s: %v", ulid, err)
-		return
+// defaultMaxDownloadMB caps document downloads when max_download_mb is unset.
+const defaultMaxDownloadMB = 500
+
+func (app *App) maxDownloadBytes() int64 {
+	mb := app.config().MaxDownloadMB
+	if mb == 0 {
+		mb = defaultMaxDownloadMB
 	}
-	tmpPath := tmpFile.Name()
-	defer os.Remove(tmpPath)
+	return int64(mb) << 20
+}
 
-	if _, err := tmpFile.Write(data); err != nil {
-		tmpFile.Close()
-		log.Printf("hires-thumb: write failed for %s: %v", ulid, err)
-		return
+func (app *App) ollamaURL() string {
+	if app.config().OllamaURL != "" {
+		return app.config().OllamaURL
 	}
-	tmpFile.Close()
+	return "http://localhost:11434"
+}
 
-	outPath := app.hiresThumbPath(ulid)
-	if err := thumbnails.GenerateStyledAndSave(tmpPath, outPath, 600, thumbnails.StyleUniform); err != nil {
-		log.Printf("hires-thumb: generation failed for %s: %v", ulid, err)
-		return
+func (app *App) ollamaModel() string {
+	if app.config().OllamaModel != "" {
+		return app.config().OllamaModel
 	}
-	log.Printf("hires-thumb: generated %s", ulid)
+	return "gemma3:4b"
 }
 
-func processDocument(app *App, ulid, docType string) {
-	defer func() {
-		app.processingMu.Lock()
-		delete(app.docStage, ulid)
-		app.processingMu.Unlock()
-	}()
+// processDocument runs OCR and then the LLM stages for a document. ctx is
+// cancelled from the processing page; the job stops at its next step and
+// is recorded as a failure so it can be retried.
+func processDocument(ctx context.Context, app *App, ulid, docType string) {
+	defer app.endJob(ulid)
 
 	log.Printf("OCR: starting for %s (type=%s)", ulid, docType)
 
-	markFailed := func() {
-		app.processingMu.Lock()
-		app.ocrFailed[ulid] = true
-		app.processingMu.Unlock()
-	}
-
-	// Download document
-	data, _, err := app.client.DownloadDocument(ulid)
-	if err != nil {
-		log.Printf("OCR: download failed for %s: %v", ulid, err)
-		markFailed()
-		return
+	markFailed := func(err error) {
+		if ctx.Err() != nil {
+			err = errCancelled
+		}
+		app.recordFailure(ulid, pipelineOCR, docType, err)
 	}
 
-	// Write to temp file
-	tmpFile, err := os.CreateTemp("", "godocs-ocr-*"+docType)
+	// Download document to a temp file
+	tmpPath, err := app.docs.DownloadDocument(ulid, "godocs-ocr-*"+docType, app.maxDownloadBytes())
 	if err != nil {
-		log.Printf("OCR: temp file failed for %s: %v", ulid, err)
-		markFailed()
+		app.pipelineErrorf("OCR", ulid, "download failed for %s: %v", ulid, err)
+		markFailed(fmt.Errorf("download: %w", err))
 		return
 	}
-	tmpPath := tmpFile.Name()
-	defer os.Remove(tmpPath)
+	defer scratch.release(tmpPath)
 
-	if _, err := tmpFile.Write(data); err != nil {
-		tmpFile.Close()
-		log.Printf("OCR: write failed for %s: %v", ulid, err)
-		markFailed()
+	// Batch scans are split at separator sheets and their parts processed
+	// as new documents
+	if splitBatch(ctx, app, ulid, tmpPath, docType) {
+		app.clearFailure(ulid, pipelineOCR)
 		return
 	}
-	tmpFile.Close()
 
 	// Run OCR
-	text, err := ocr.ExtractText(tmpPath, docType)
+	res, err := app.extractText(ctx, ulid, tmpPath, docType)
+	text := res.Text
 	if err != nil {
-		log.Printf("OCR: extraction failed for %s: %v", ulid, err)
-		markFailed()
+		app.pipelineErrorf("OCR", ulid, "extraction failed for %s: %v", ulid, err)
+		markFailed(err)
 		return
 	}
 	if text == "" {
 		log.Printf("OCR: no text extracted for %s", ulid)
-		markFailed()
+		markFailed(errors.New("no text extracted"))
+		return
+	}
+	log.Printf("OCR: extracted %d chars for %s (confidence %.0f%%)", len(text), ulid, res.Confidence)
+	if ctx.Err() != nil {
+		markFailed(ctx.Err())
 		return
 	}
-	log.Printf("OCR: extracted %d chars for %s", len(text), ulid)
 
 	// Upload text back to godocs
-	if err := app.client.UploadDocumentText(ulid, text); err != nil {
-		log.Printf("OCR: upload text failed for %s: %v", ulid, err)
+	if err := app.docs.UploadDocumentText(ulid, text); err != nil {
+		app.pipelineErrorf("OCR", ulid, "upload text failed for %s: %v", ulid, err)
+		markFailed(fmt.Errorf("upload text: %w", err))
+		return
+	}
+	app.clearFailure(ulid, pipelineOCR)
+	app.forgetPDFPassword(ulid)
+
+	// The job stays registered under ulid; the document may have a new
+	// ULID once replaced by its searchable copy
+	docULID := replaceWithSearchablePDF(ctx, app, ulid, tmpPath, docType, text)
+	app.recordOCRQuality(docULID, res)
+	app.recordOCRLines(docULID, res.Lines)
+	app.emit(Event{Type: eventOCRCompleted, ULID: docULID, Data: map[string]any{"chars": len(text), "confidence": res.Confidence}})
+
+	inferDate := app.stageEnabled(pipelineDate, docType)
+	classify := app.stageEnabled(pipelineClassify, docType)
+	summarize := app.stageEnabled(pipelineSummary, docType)
+	detect := app.stageEnabled(pipelineLanguage, docType)
+	propose := app.stageEnabled(pipelineTagProposals, docType)
+	if !inferDate && !classify && !summarize && !detect && !propose {
 		return
 	}
 
-	// Transition to LLM stage
-	app.processingMu.Lock()
-	app.docStage[ulid] = stageLLM
-	app.processingMu.Unlock()
-
-	// Infer date via LLM
-	ollamaURL := app.config.OllamaURL
-	if ollamaURL == "" {
-		ollamaURL = "http://localhost:11434"
+	app.setJobStage(ulid, stageLLM)
+	if inferDate && ctx.Err() == nil {
+		inferDocumentDate(app, docULID, text)
+	}
+	if classify && ctx.Err() == nil {
+		classifyDocument(app, docULID, text)
+	}
+	if summarize && ctx.Err() == nil {
+		summarizeDocument(app, docULID, text)
 	}
-	model := app.config.OllamaModel
-	if model == "" {
-		model = "gemma3:4b"
+	if detect && ctx.Err() == nil {
+		detectLanguage(app, docULID, text)
 	}
+	if propose && ctx.Err() == nil {
+		proposeTags(app, docULID, text)
+	}
+}
 
-	dateStr, err := llm.InferDate(ollamaURL, model, text)
+// inferDocumentDate asks the LLM for the dates in a document, keeps them for
+// the inbox's quick-pick list, and stores the best in godocs if the model is
+// confident enough. Text heuristics stand in when the LLM fails or finds
+// nothing, or check its answer, as date_heuristics says.
+func inferDocumentDate(app *App, ulid, text string) {
+	mode := app.config().DateHeuristics
+	var candidates []llm.DateCandidate
+	var err error
+	if mode != dateHeuristicsOnly {
+		candidates, err = withModels(app, taskDate, ulid, func(m llm.Model) ([]llm.DateCandidate, error) {
+			return llm.InferDates(m, app.config().prompts, app.promptVars(text))
+		})
+	}
+	offline := errors.Is(err, errLLMOffline)
+	if offline {
+		// Heuristics may stand in meanwhile, but the LLM has the last word
+		log.Printf("OCR: date inference for %s waits for Ollama", ulid)
+		app.ollama.deferDate(ulid)
+	}
+	switch {
+	case mode == dateHeuristicsOff:
+	case err != nil || len(candidates) == 0:
+		if found := app.heuristicDates(text); len(found) > 0 {
+			if err != nil {
+				log.Printf("OCR: date inference failed for %s (%v); using text heuristics", ulid, err)
+			}
+			candidates, err = found, nil
+		}
+	case mode == dateHeuristicsCrossCheck:
+		candidates = crossCheckDates(candidates, app.heuristicDates(text), app.dateMinConfidence())
+	}
+	if offline {
+		return
+	}
 	if err != nil {
-		log.Printf("OCR: date inference failed for %s: %v", ulid, err)
+		app.pipelineErrorf("OCR", ulid, "date inference failed for %s: %v", ulid, err)
+		app.recordFailure(ulid, pipelineDate, "", err)
 		return
 	}
-	if dateStr == "" {
+	if len(candidates) == 0 {
 		log.Printf("OCR: no date inferred for %s", ulid)
+		app.clearFailure(ulid, pipelineDate)
 		return
 	}
+	app.recordDateCandidates(ulid, candidates)
 
-	log.Printf("OCR: inferred date %s for %s", dateStr, ulid)
-	if err := app.client.UpdateDocumentDate(ulid, dateStr); err != nil {
-		log.Printf("OCR: update date failed for %s: %v", ulid, err)
+	best := candidates[0]
+	dateStr := best.Date
+	if best.Confidence <= app.dateMinConfidence() {
+		log.Printf("OCR: best date %s for %s has confidence %.2f, not above %.2f; left to pick (%d candidates)", dateStr, ulid, best.Confidence, app.dateMinConfidence(), len(candidates))
+		app.clearFailure(ulid, pipelineDate)
+		return
+	}
+	log.Printf("OCR: inferred date %s (%s) for %s (confidence %.2f: %s)", dateStr, best.Label, ulid, best.Confidence, best.Reason)
+	if err := app.docs.UpdateDocumentDate(ulid, dateStr); err != nil {
+		app.pipelineErrorf("OCR", ulid, "update date failed for %s: %v", ulid, err)
+		app.recordFailure(ulid, pipelineDate, "", fmt.Errorf("update date: %w", err))
 	} else {
+		app.clearFailure(ulid, pipelineDate)
 		app.mu.Lock()
 		app.llmDates[ulid] = true
 		app.mu.Unlock()
+		if err := app.store.SetLLMDate(ulid); err != nil {
+			log.Printf("state: %v", err)
+		}
+		app.emit(Event{Type: eventDateInferred, ULID: ulid, Data: map[string]any{"date": dateStr, "label": best.Label, "confidence": best.Confidence, "reason": best.Reason}})
 	}
 }
 
-func (app *App) captureTagSet(ulid string) {
-	if app.client == nil {
-		return
-	}
-	tags, err := app.client.FetchDocTags(ulid)
+func (app *App) captureTagSet(sess *UserSession, ulid string) {
+	tags, err := app.docs.FetchDocTags(context.Background(), ulid)
 	if err != nil || len(tags) == 0 {
 		return
 	}
@@ -557,32 +995,33 @@ func (app *App) captureTagSet(ulid string) {
 	sort.Strings(names)
 	label := strings.Join(names, ", ")
 	newSet := RecentTagSet{Tags: entries, Label: label}
+	app.learnTagSet(ulid, tags)
 
 	// Dedup against existing sets
 	var filtered []RecentTagSet
-	for _, s := range app.recentSets {
+	for _, s := range sess.RecentSets {
 		if s.Label != newSet.Label {
 			filtered = append(filtered, s)
 		}
 	}
-	app.recentSets = append([]RecentTagSet{newSet}, filtered...)
-	if len(app.recentSets) > 3 {
-		app.recentSets = app.recentSets[:3]
+	sess.RecentSets = append([]RecentTagSet{newSet}, filtered...)
+	if len(sess.RecentSets) > 3 {
+		sess.RecentSets = sess.RecentSets[:3]
 	}
+	sess.save()
 }
 
-func (app *App) buildTagGroups(ulid string) ([]EditTagGroup, []string) {
+// buildTagGroups arranges all server tags into groups, marking those in docTags as active.
+func (app *App) buildTagGroups(docTags []GodocsTag) []EditTagGroup {
 	activeTags := make(map[int]bool)
-	if docTags, err := app.client.FetchDocTags(ulid); err == nil {
-		for _, t := range docTags {
-			activeTags[t.ID] = true
-		}
+	for _, t := range docTags {
+		activeTags[t.ID] = true
 	}
 
 	groupMap := make(map[string][]EditTagItem)
 	var groupOrder []string
 	var allTags []GodocsTag
-	for _, t := range app.client.tags {
+	for _, t := range app.docs.KnownTags() {
 		allTags = append(allTags, t)
 	}
 	sort.Slice(allTags, func(i, j int) bool {
@@ -615,64 +1054,152 @@ func (app *App) buildTagGroups(ulid string) ([]EditTagGroup, []string) {
 	for _, g := range groupOrder {
 		groups = append(groups, EditTagGroup{Name: g, Tags: groupMap[g]})
 	}
+	return groups
+}
 
-	tagGroups, _ := app.client.FetchTagGroups()
-	return groups, tagGroups
+// docDetails is everything the inbox page fetches from godocs for one document.
+type docDetails struct {
+	status    *GodocsDocStatus
+	text      string
+	tags      []GodocsTag
+	tagGroups []string
+}
+
+// fetchDocDetails issues the per-document godocs calls concurrently under a
+// shared deadline. Failed or slow calls leave their field empty so the page
+// can still render with partial data.
+func (app *App) fetchDocDetails(ctx context.Context, ulid string) docDetails {
+	ctx, cancel := context.WithTimeout(ctx, pageFetchTimeout)
+	defer cancel()
+
+	var d docDetails
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		status, err := app.docs.FetchDocStatus(ctx, ulid)
+		if err != nil {
+			log.Printf("page: status for %s: %v id=%s", ulid, err, requestID(ctx))
+			return nil
+		}
+		d.status = status
+		return nil
+	})
+	g.Go(func() error {
+		text, err := app.docs.FetchDocText(ctx, ulid)
+		if err != nil {
+			log.Printf("page: text for %s: %v id=%s", ulid, err, requestID(ctx))
+			return nil
+		}
+		d.text = text
+		return nil
+	})
+	g.Go(func() error {
+		tags, err := app.docs.FetchDocTags(ctx, ulid)
+		if err != nil {
+			log.Printf("page: tags for %s: %v id=%s", ulid, err, requestID(ctx))
+			return nil
+		}
+		d.tags = tags
+		return nil
+	})
+	g.Go(func() error {
+		d.tagGroups, _ = app.docs.FetchTagGroups(ctx)
+		return nil
+	})
+	g.Wait()
+	return d
 }
 
 // --- Page data ---
 
 type InboxItem struct {
 	// Server mode
-	ULID          string
-	Name          string
-	DocType       string
-	Folder        string
-	IngressTime   string
-	ThumbnailURL  string // full URL
-	ViewURL       string // full URL
-	TextPreview   string
-	HasThumbnail  bool
-	HasHiresThumb bool
-	Processing    bool
-	LLMWorking    bool
-	DocumentDate  string
-	DateIsLLM     bool
-	// Demo mode
-	Content template.HTML
+	ULID           string
+	Name           string
+	DocType        string
+	Folder         string
+	IngressTime    string
+	Age            string // untagged for, e.g. "12d" (see aging.go)
+	AgeClass       string // "aging", "overdue" or ""
+	ThumbnailURL   string // full URL
+	ViewURL        string // full URL
+	TextPreview    string
+	TextSpans      []TextSpan // TextPreview with the inferred date and rule matches marked, or nil
+	HasThumbnail   bool
+	HasHiresThumb  bool
+	Processing     bool
+	LLMWorking     bool
+	ManualHandling string // tag added when the type has no route to its text
+	DocumentDate   string
+	DateIsLLM      bool
+	TypeGuess      string      // LLM-predicted document type, confirmed with docTypeKey
+	TypeConfidence int         // percent
+	Failure        *JobFailure // last failed background job, retried with retryKey
+	Duplicate      *Duplicate  // likely earlier copy, deleted with duplicateKey
+	Note           string      // free-text note, edited with noteKey
+	PoorOCR        int         // OCR confidence percent when below ocr_min_confidence
+	DatePicks      []DatePick  // inferred date candidates, best first
+	Summary        string      // LLM summary, shown above the text preview
+	Language       string      // detected language code
+	Translation    string      // LLM translation of the preview
+	TranslatedTo   string      // language name of Translation
 }
 
 type PageData struct {
-	Page       string
-	Item       *InboxItem
-	Shortcuts  []ShortcutConfig
-	Remaining  int
-	Position   int
-	PrevPos    int
-	NextPos    int
-	Done       bool
-	Undoable   bool
-	UndoInfo   string
-	Flash      string
-	IsDemo     bool
-	GodocsURL  string
-	Groups     []EditTagGroup
-	TagGroups  []string
-	RecentSets []RecentTagSet
+	Page        string
+	User        string
+	Item        *InboxItem
+	Shortcuts   []ShortcutConfig
+	Remaining   int
+	Overdue     int  // untagged documents past aging.overdue_days
+	OverdueDays int  // aging.overdue_days
+	Oldest      bool // queue ordered oldest first
+	Position    int
+	PrevPos     int
+	NextPos     int
+	Done        bool
+	Undoable    bool
+	UndoInfo    string
+	Flash       string
+	Banner      *ErrorBanner
+	Missing     []string      // required groups the document falls short of
+	Folder      string        // folder the queue is filtered to
+	Folders     []FolderCount // untagged documents per folder, for the filter
+	Bucket      string        // quick sort bucket in its detail pass; "" for the inbox
+	GodocsURL   string
+	Groups      []EditTagGroup
+	TagGroups   []string
+	RecentSets  []RecentTagSet
+	Presets     []PresetConfig
+	Suggestions []TagSuggestion             // tag sets of similar tagged documents, best first
+	Snooze      []SnoozeOption              // snooze chords (server mode)
+	Rotate      []RotateOption              // rotation chords (server mode)
+	Archive     string                      // archive_folder, for the archive key
+	Mobile      bool                        // touch layout with swipe gestures
+	Chords      map[string][]keymap.Binding // chord prefix → second keys, for the hint
+	Layers      []ShortcutLayer             // further shortcut sets, switched with Alt
+	TagCounts   map[int]string              // documents carrying each shortcut's tag, by tag ID (see shortcutcounts.go)
+	Goal        *GoalProgress               // nil without daily_goal
 }
 
+// TaggedGroup is a shortcut's tag on the tagged page, with the names of
+// its first taggedPageLimit documents.
 type TaggedGroup struct {
 	Name  string
 	Items []string
+	Count int
 }
 
 type TaggedPageData struct {
 	Page   string
+	User   string
 	Groups []TaggedGroup
 	Total  int
-	IsDemo bool
+	Error  string
 }
 
+// taggedPageLimit caps the documents listed per tag on the tagged page.
+const taggedPageLimit = 50
+
 type EditTagItem struct {
 	ID     int
 	Name   string
@@ -688,30 +1215,17 @@ type EditTagGroup struct {
 
 type AboutPageData struct {
 	Page         string
+	User         string
 	Config       Config
+	Shortcuts    []ShortcutConfig
+	Presets      []PresetConfig
 	ConfigSource string
 	ServerTags   []GodocsTag
-	IsDemo       bool
 	GodocsURL    string
-}
-
-// --- Demo defaults ---
-
-var defaultDemoTags = []ShortcutConfig{
-	{Key: "r", Name: "reference"},
-	{Key: "a", Name: "action"},
-	{Key: "t", Name: "trash"},
-	{Key: "p", Name: "project"},
-	{Key: "s", Name: "someday"},
-	{Key: "w", Name: "waiting"},
-}
-
-var demoFiles = map[string]string{
-	"meeting-notes-2024-q4.md":       "# Q4 Planning Meeting Notes\n\nAttendees: Alice, Bob, Charlie\n\n## Action Items\n- Review budget proposal by Friday\n- Schedule follow-up with vendor\n",
-	"api-design-v2.md":               "# API v2 Design Notes\n\n## Breaking Changes\n- Auth moves to Bearer tokens\n- Cursor-based pagination\n",
-	"old-server-config.txt":          "Server: web-prod-03\nStatus: DECOMMISSIONED 2024-01-15\nCan be deleted after 2025-01-15.\n",
-	"research-llm-classification.md": "# LLM-based Document Classification\n\nUse a local LLM to auto-suggest tags for inbox items.\n",
-	"todo-fix-backup-script.md":      "# Fix Backup Script\n\nError: \"permission denied: /mnt/backup-v2/daily\"\n",
+	PublicURL    string // inbox root as seen by the browser
+	Status       *StatusReport
+	Build        BuildInfo
+	Godocs       *GodocsVersion // nil when not a godocs server
 }
 
 // --- Config ---
@@ -753,31 +1267,41 @@ func writeExampleConfig(path string) error {
 	return os.WriteFile(path, []byte(header+string(data)), 0644)
 }
 
-func seedDemo(dir string) error {
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-	for name, content := range demoFiles {
-		p := filepath.Join(dir, name)
-		if _, err := os.Stat(p); err == nil {
-			continue
-		}
-		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // --- Main ---
 
 func main() {
 	demo := flag.Bool("demo", false, "Run with sample demo data (no godocs server needed)")
 	initCfg := flag.Bool("init", false, "Write an example "+configFileName+" and exit")
+	fromServer := flag.String("from-server", "", "With -init, write shortcuts for the most-used tags of this godocs server")
+	keysPerGroup := flag.Int("keys-per-group", defaultKeysPerGroup, "With -init -from-server, the tags of each tag group given a key")
 	addr := flag.String("addr", "", "Override listen address (e.g. :9090)")
+	templatesDir := flag.String("templates", "", "Directory of *.html templates overriding the built-in ones")
+	staticDir := flag.String("static", "", "Directory of static assets overriding the built-in ones (served at /static/)")
+	dev := flag.Bool("dev", false, "Re-read templates on every request")
+	record := flag.String("record", "", "Save every godocs API response to this fixture directory")
+	replay := flag.String("replay", "", "Serve godocs API responses from this fixture directory instead of a live server")
+	profile := flag.String("profile", "", "Serve only this profile from the config's profiles")
+	debug := flag.Bool("debug", false, "Serve pprof at /debug/pprof/ and a state dump at /debug/state")
+	dryRun := flag.Bool("dry-run", false, "Log tag, date, text, move and delete changes instead of making them in godocs")
 	flag.Usage = printUsage
 	flag.Parse()
 
+	if args := flag.Args(); len(args) > 0 {
+		os.Exit(runCommand(args, *profile))
+	}
+
+	if *initCfg && *fromServer != "" {
+		opts := initOptions{server: *fromServer, perGroup: *keysPerGroup, out: os.Stdout}
+		if stdinIsTerminal() {
+			opts.in = os.Stdin
+		}
+		if err := writeServerConfig(context.Background(), configFileName, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", configFileName)
+		return
+	}
 	if *initCfg {
 		if err := writeExampleConfig(configFileName); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -787,21 +1311,17 @@ func main() {
 		return
 	}
 
-	var app *App
+	var apps []*App
 
 	switch {
 	case *demo:
-		cfg := defaultConfig()
-		cfg.InboxDir = "./demo-inbox"
-		cfg.TaggedDir = "./demo-tagged"
-		cfg.Shortcuts = defaultDemoTags
-		if err := seedDemo(cfg.InboxDir); err != nil {
-			fmt.Fprintf(os.Stderr, "Error seeding demo: %v\n", err)
+		app, err := newDemoApp()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting demo: %v\n", err)
 			os.Exit(1)
 		}
-		os.MkdirAll(cfg.TaggedDir, 0755)
-		app = &App{config: cfg, configFile: "demo", llmDates: make(map[string]bool), docStage: make(map[string]string), ocrFailed: make(map[string]bool)}
-		log.Println("Running in demo mode (local files, no godocs server)")
+		apps = []*App{app}
+		log.Println("Running in demo mode (in-memory store with sample documents)")
 
 	default:
 		cfg, err := loadConfig(configFileName)
@@ -813,64 +1333,346 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		if cfg.GodocsServer == "" {
-			fmt.Fprintf(os.Stderr, "Error: godocs_server must be set in %s\n", configFileName)
+		if *dryRun {
+			cfg.DryRun = true
+		}
+		if err := openLogs(cfg.Logs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		if len(cfg.Shortcuts) == 0 {
-			fmt.Fprintf(os.Stderr, "Error: at least one tag shortcut must be configured in %s\n", configFileName)
+		apps, err = startServerApps(cfg, *profile, *record, *replay)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		go scratch.runSweeper(context.Background())
+		absPath, _ := filepath.Abs(configFileName)
+		for _, app := range apps {
+			app.configFile = absPath
+		}
+	}
 
-		// Connect to godocs and validate tags
-		client := NewGodocsClient(cfg.GodocsServer)
-		serverTags, err := client.FetchTags()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error connecting to godocs at %s: %v\n", cfg.GodocsServer, err)
+	// With several profiles each is served under /p/<name>. The flags are
+	// set on a copy of the config, as the running one is not changed in place
+	var base string
+	for _, app := range apps {
+		cfg := *app.config()
+		if *addr != "" {
+			cfg.Addr = *addr
+		}
+		base = normalizeBasePath(cfg.BasePath)
+		cfg.BasePath = base
+		if len(apps) > 1 {
+			cfg.BasePath = profileBasePath(base, cfg.Profile)
+		}
+		if *debug {
+			cfg.Debug = true
+		}
+		app.conf.Store(&cfg)
+		app.templatesDir, app.staticDir, app.dev = *templatesDir, *staticDir, *dev
+		if err := app.loadState(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		app.initUsers()
+		go app.runAutoTagger(context.Background())
+		go app.runLLMMonitor(context.Background())
+		app.initMQTT()
+		go app.runMQTT(context.Background())
+		app.initS3()
+		go app.runS3Ingest(context.Background())
+		app.runCloudDrives(context.Background())
+		if !*demo {
+			go app.watchConfig(context.Background())
+		}
+	}
+	if len(apps) > 1 {
+		linkProfiles(apps)
+	}
+
+	serve(base, apps)
+}
+
+// newServerApp connects to the godocs server in cfg, checks the config
+// against it and opens the local state, ready to serve. It checks all it
+// can before failing, and the error, joined with errors.Join, lists every
+// problem found (see startup.go).
+func newServerApp(cfg Config, record, replay string) (*App, error) {
+	var problems []error
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if cfg.GodocsServer == "" && replay == "" {
+		return nil, fmt.Errorf("godocs_server must be set in %s", configFileName)
+	}
+
+	// Connect to godocs and validate tags
+	if err := cfg.validateServerTLS(); err != nil {
+		return nil, err
+	}
+	if replay != "" {
+		dir := filepath.Join(replay, cfg.Profile)
+		url, err := startReplay(dir)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Replaying godocs from %s", dir)
+		cfg.GodocsServer = url
+		cfg.GodocsTLS = GodocsTLSConfig{}
+	}
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if record != "" {
+		dir := filepath.Join(record, cfg.Profile)
+		if err := client.recordTo(dir); err != nil {
+			return nil, err
+		}
+		log.Printf("Recording godocs responses to %s", dir)
+	}
+	var godocsVersion GodocsVersion
+	serverTags, err := client.FetchTags()
+	connected := err == nil
+	if !connected {
+		check(fmt.Errorf("connecting to godocs at %s: %w", cfg.GodocsServer, err))
+	} else {
 		log.Printf("Connected to godocs at %s (%d tags available)", cfg.GodocsServer, len(serverTags))
+		godocsVersion = client.FetchVersion()
+		if godocsVersion.Warning != "" {
+			log.Printf("Warning: %s", godocsVersion.Warning)
+		} else if godocsVersion.Error != "" {
+			log.Printf("Warning: godocs version unknown: %s", godocsVersion.Error)
+		}
+	}
+	problems = append(problems, checkConfig(&cfg, client, serverTags, connected)...)
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	warnConfigKeys(cfg)
 
-		// Populate shortcut names from server
-		for i := range cfg.Shortcuts {
-			t, ok := client.tags[cfg.Shortcuts[i].TagID]
-			if !ok {
-				fmt.Fprintf(os.Stderr, "Error: tag_id %d (key '%s') not found on server\n",
-					cfg.Shortcuts[i].TagID, cfg.Shortcuts[i].Key)
-				fmt.Fprintf(os.Stderr, "Available tags:\n")
-				for _, st := range serverTags {
-					fmt.Fprintf(os.Stderr, "  id=%d  name=%s  group=%s\n", st.ID, st.Name, st.TagGroup)
-				}
-				os.Exit(1)
+	thumbDir := filepath.Join(cfg.cacheDir(), "thumbs")
+	os.MkdirAll(thumbDir, 0755)
+	client.texts = newTextCache(filepath.Join(cfg.cacheDir(), "text"))
+	app := newApp(cfg, client)
+	app.thumbDir = thumbDir
+	app.godocsVersion = &godocsVersion
+	st, err := openState(cfg.statePath(), filepath.Join(cfg.cacheDir(), "actions.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("opening state database: %w", err)
+	}
+	app.store = st
+	app.syncUntagged()
+	return app, nil
+}
+
+// checkConfig checks cfg, and when connected its tags against those on
+// client, filling in the names of its shortcut and preset tags and compiling
+// its auto_tag rules and prompts. It returns every problem found, for
+// startup and for a reload (see reload.go).
+func checkConfig(cfg *Config, client DocumentStore, serverTags []GodocsTag, connected bool) []error {
+	var problems []error
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if len(cfg.Shortcuts) == 0 {
+		check(fmt.Errorf("at least one tag shortcut must be configured in %s", configFileName))
+	}
+	if connected {
+		// Populate shortcut and preset names from server; a missing tag
+		// is followed by the server's tags to choose from
+		var tagProblems []error
+		checkTags := func(err error) {
+			if err != nil {
+				tagProblems = append(tagProblems, err)
+			}
+		}
+		checkTags(resolveShortcuts(client, cfg.Shortcuts))
+		checkTags(resolvePresets(client, cfg.Presets))
+		checkTags(validateLayers(client, cfg.Layers))
+		seenUsers := make(map[string]bool)
+		for _, u := range cfg.Users {
+			if u.Name == "" || seenUsers[u.Name] {
+				check(fmt.Errorf("every user needs a unique name in %s", configFileName))
+				continue
+			}
+			seenUsers[u.Name] = true
+			for _, err := range leafErrors(errors.Join(resolveShortcuts(client, u.Shortcuts), resolvePresets(client, u.Presets))) {
+				checkTags(fmt.Errorf("user %s: %w", u.Name, err))
 			}
-			cfg.Shortcuts[i].Name = t.Name
-			cfg.Shortcuts[i].Color = t.Color
 		}
+		checkTags(validateRequiredGroups(client, cfg.RequiredGroups))
+		checkTags(cfg.AutoTag.validate(client))
+		checkTags(validateTagActions(client, cfg.TagActions))
+		checkTags(validateQuickSort(client, cfg.QuickSort))
+		checkTags(cfg.S3.validate(client))
+		checkTags(validateCloudDrives(client, cfg.CloudDrives))
+		for _, id := range cfg.Expenses.TagIDs {
+			if _, ok := client.Tag(id); !ok {
+				checkTags(fmt.Errorf("expenses: tag_id %d not found on server", id))
+			}
+		}
+		if len(tagProblems) > 0 {
+			var b strings.Builder
+			b.WriteString("available tags:")
+			for _, st := range serverTags {
+				fmt.Fprintf(&b, "\n  id=%d  name=%s  group=%s", st.ID, st.Name, st.TagGroup)
+			}
+			problems = append(problems, tagProblems...)
+			problems = append(problems, errors.New(b.String()))
+		}
+	}
+
+	check(cfg.Notifications.validate())
+	check(cfg.MQTT.validate())
+	check(validateWebhooks(cfg.Webhooks))
+	check(cfg.Pipeline.validate())
+	check(cfg.Limits.validate())
+	check(cfg.Thumbnails.validate())
+	check(cfg.Models.validate())
+	check(cfg.loadPrompts())
+	check(cfg.loadLocale())
+	check(cfg.LLMBudget.validate())
+	check(cfg.Logs.validate())
+	check(cfg.Languages.validate())
+	check(cfg.Aging.validate())
+	if cfg.OCRMinConfidence < -1 || cfg.OCRMinConfidence > 100 {
+		check(fmt.Errorf("ocr_min_confidence %d out of range (1-100, or -1 to disable)", cfg.OCRMinConfidence))
+	}
+	if cfg.DateMinConfidence < 0 || cfg.DateMinConfidence > 1 {
+		check(fmt.Errorf("date_min_confidence %g out of range (0-1)", cfg.DateMinConfidence))
+	}
+	switch cfg.DateHeuristics {
+	case "", dateHeuristicsFallback, dateHeuristicsCrossCheck, dateHeuristicsOnly, dateHeuristicsOff:
+	default:
+		check(fmt.Errorf("date_heuristics %q must be fallback, cross_check, only or off", cfg.DateHeuristics))
+	}
+	if cfg.DateOrder != "" && cfg.DateOrder != "dmy" && cfg.DateOrder != "mdy" {
+		check(fmt.Errorf("date_order %q must be dmy or mdy", cfg.DateOrder))
+	}
+	if cfg.CommitDelaySeconds < 0 {
+		check(fmt.Errorf("commit_delay_seconds must not be negative"))
+	}
+	if cfg.DailyGoal < 0 {
+		check(fmt.Errorf("daily_goal must be positive"))
+	}
+	check(checkWritable(cfg.cacheDir()))
+	return problems
+}
 
-		// Check for reserved key collisions
-		reservedKeys := map[string]string{
-			"1": "recent tag set 1", "2": "recent tag set 2", "3": "recent tag set 3",
-			"d": "done/next", "u": "undo",
+// resolveShortcuts fills in shortcut names and colors from the server's
+// tags. The error lists every shortcut whose tag is missing.
+func resolveShortcuts(client DocumentStore, shortcuts []ShortcutConfig) error {
+	var errs []error
+	for i := range shortcuts {
+		t, ok := client.Tag(shortcuts[i].TagID)
+		if !ok {
+			errs = append(errs, fmt.Errorf("tag_id %d (key '%s') not found on server", shortcuts[i].TagID, shortcuts[i].Key))
+			continue
 		}
-		for _, s := range cfg.Shortcuts {
-			if desc, ok := reservedKeys[s.Key]; ok {
-				log.Printf("WARNING: shortcut key '%s' (%s) collides with reserved key for %s", s.Key, s.Name, desc)
+		shortcuts[i].Name = t.Name
+		shortcuts[i].Color = t.Color
+		shortcuts[i].Key = keymap.Normalize(shortcuts[i].Key)
+	}
+	return errors.Join(errs...)
+}
+
+// resolvePresets validates presets and fills in their tags from the server.
+// The error lists every problem.
+func resolvePresets(client DocumentStore, presets []PresetConfig) error {
+	var errs []error
+	for i := range presets {
+		p := &presets[i]
+		if p.Name == "" || p.Key == "" || len(p.TagIDs) == 0 {
+			errs = append(errs, fmt.Errorf("preset %d needs a name, key and at least one tag_id", i+1))
+			continue
+		}
+		p.Key = keymap.Normalize(p.Key)
+		p.Tags = nil
+		for _, id := range p.TagIDs {
+			t, ok := client.Tag(id)
+			if !ok {
+				errs = append(errs, fmt.Errorf("tag_id %d in preset '%s' not found on server", id, p.Name))
+				continue
 			}
+			p.Tags = append(p.Tags, TagSetEntry{ID: t.ID, Name: t.Name, Color: t.Color})
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		absPath, _ := filepath.Abs(configFileName)
-		cacheDir, _ := os.UserCacheDir()
-		thumbDir := filepath.Join(cacheDir, "godocs-inbox", "thumbs")
-		os.MkdirAll(thumbDir, 0755)
-		app = &App{config: cfg, configFile: absPath, client: client, llmDates: make(map[string]bool), docStage: make(map[string]string), ocrFailed: make(map[string]bool), thumbDir: thumbDir}
-		app.syncUntagged()
+// tagSearchKey is the reserved key for the inbox page's tag search, which
+// filters every tag on the server rather than only the shortcuts.
+const tagSearchKey = "t"
+
+// reservedKeys are the built-in single-key actions on the inbox page.
+var reservedKeys = []struct{ key, desc string }{
+	{"1", "recent tag set 1"}, {"2", "recent tag set 2"}, {"3", "recent tag set 3"},
+	{"d", "done/next"}, {"u", "undo"}, {docTypeKey, "confirm document type"},
+	{retryKey, "retry failed processing"}, {duplicateKey, "delete duplicate"},
+	{suggestKey, "apply suggested tag set"}, {noteKey, "edit note"},
+	{chatKey, "ask about the document"}, {quickOpenKey, "open a document"},
+	{tagSearchKey, "search tags"}, {helpKey, "show the key bindings"},
+	{archiveKey, "archive without tagging"},
+}
+
+// buildKeymap binds shortcuts, presets and then the reserved keys, snooze
+// and rotation chords, in the order the inbox page checks them. Bindings that collide are returned as
+// errors and left out.
+func buildKeymap(shortcuts []ShortcutConfig, presets []PresetConfig) (*keymap.Keymap, []error) {
+	km := keymap.New()
+	var errs []error
+	for i, s := range shortcuts {
+		if err := km.Add(s.Key, s.Name, keymap.Shortcut, i); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, p := range presets {
+		if err := km.Add(p.Key, p.Name, keymap.Preset, i); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, r := range reservedKeys {
+		if err := km.Add(r.key, r.desc, keymap.Reserved, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, o := range snoozeOptions {
+		if err := km.Add(o.Keys, o.Label, keymap.Reserved, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, o := range rotateOptions {
+		if err := km.Add(o.Keys, o.Label, keymap.Reserved, 0); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return km, errs
+}
 
-	if *addr != "" {
-		app.config.Addr = *addr
+// warnConfigKeys logs the shortcut and preset keys of cfg that collide.
+func warnConfigKeys(cfg Config) {
+	warnKeyCollisions("", cfg.Shortcuts, cfg.Presets)
+	warnLayerCollisions(cfg.Layers, cfg.Presets)
+	for _, u := range cfg.Users {
+		warnKeyCollisions(u.Name, u.Shortcuts, u.Presets)
 	}
+}
 
-	serve(app)
+// warnKeyCollisions logs shortcut and preset keys that shadow reserved keys or each other.
+func warnKeyCollisions(user string, shortcuts []ShortcutConfig, presets []PresetConfig) {
+	prefix := ""
+	if user != "" {
+		prefix = "user " + user + ": "
+	}
+	_, errs := buildKeymap(shortcuts, presets)
+	for _, err := range errs {
+		log.Printf("WARNING: %s%v", prefix, err)
+	}
 }
 
 func printUsage() {
@@ -880,15 +1682,161 @@ Usage:
   godocs-inbox              Run using %s (connects to godocs server)
   godocs-inbox -demo        Run with built-in sample data (no server needed)
   godocs-inbox -init        Create an example %s
+  godocs-inbox -init -from-server http://host:8000 [-keys-per-group 3]
+                            Create it with keys for the server's most-used tags
   godocs-inbox -addr :9090  Override listen address
+  godocs-inbox -templates ./theme/templates -static ./theme/static [-dev]
+                            Override built-in templates and assets
+  godocs-inbox -record ./fixtures
+                            Save every godocs API response to ./fixtures
+  godocs-inbox -replay ./fixtures
+                            Run offline against responses saved with -record
+  godocs-inbox -profile work
+                            Serve (or run a command for) only this profile
+  godocs-inbox -debug       Serve pprof at /debug/pprof/ and /debug/state
+  godocs-inbox -dry-run     Log changes to godocs instead of making them
+  godocs-inbox tags audit   Print tag usage, unused and overlapping tags
+  godocs-inbox tags merge <keep-id> <duplicate-id>
+                            Move the duplicate tag's documents to the kept
+                            tag, then delete the duplicate
+  godocs-inbox dupes scan   Hash tagged documents for duplicate detection
+  godocs-inbox embeddings scan
+                            Embed tagged documents for tag suggestions
+  godocs-inbox paperless import|export <dir>
+                            Migrate from or to a Paperless-ngx export
+  godocs-inbox export actions [-from DATE] [-to DATE] [-format csv|json]
+                            Print the action journal
+  godocs-inbox doctor       Check godocs, Ollama and the external tools
+  godocs-inbox export documents [-tag ID]... [-from DATE] [-to DATE] [-format csv|json] [-extract]
+                            Print a report of documents with the tags, dated in the range
+  godocs-inbox import actions <file>
+                            Add an exported journal, skipping known entries
 
 If no flags are given and no %s is found, this help is shown.
 
 Config file fields:
   godocs_server   URL of the godocs server (e.g. http://test:8000)
   addr            Listen address (default: :8080)
+  base_path       URL prefix when served behind a reverse proxy (e.g. /inbox)
+  tls_cert, tls_key
+                  Certificate and key to serve HTTPS
+  godocs_tls      {ca_file, cert_file, key_file, insecure_skip_verify} for
+                  godocs servers with private CAs or client certificates
+  godocs_http     {timeout_seconds, transfer_timeout_seconds,
+                  max_idle_conns_per_host, max_conns_per_host,
+                  idle_conn_timeout_seconds, disable_keep_alives,
+                  page_interval_ms} for godocs calls (defaults: 10s metadata,
+                  300s downloads/uploads, 100ms between listing pages)
   tags            List of {key, tag_id} shortcut definitions
                   Tag IDs come from your godocs server: GET /api/tags
+  presets         List of {name, key, tag_ids} tag sets applied with one key
+  layers          List of {name, key, tags}: further shortcut sets, switched
+                  to with Alt+key on the inbox page
+  required_groups Tag groups each document needs exactly one tag from before
+                  it can be done
+  tag_actions     List of {tag_id, delete | webhook (+secret) | folder} run
+                  when the tag is applied from the inbox
+  commit_delay_seconds
+                  Hold tag shortcuts back this long before tagging in godocs;
+                  undo within it costs no API call (default: 0, at once)
+  daily_goal      Documents to tag each day: a progress bar on the inbox page
+                  and a streak of days the goal was met (default: 0, off)
+  quick_sort      List of {key, tag_id} bucket tags for the /sort quick pass;
+                  /?bucket=<tag_id> is the detail pass through one
+  aging           {warn_days, overdue_days}: when untagged documents show amber
+                  and red, and count as overdue in the nav (default: 7, 30)
+  archive_folder  godocs folder the e key moves a document to untagged; it
+                  then stays out of the inbox
+  auto_tag        Unattended tagging: {interval_minutes, min_confidence,
+                  rules: [{match, tag_ids, dry_run}]}; off unless interval_minutes set
+  max_download_mb Largest document downloaded for OCR/thumbnails (default: 500)
+  scratch_max_mb  Temp files over this are swept early (default: 2048); they
+                  live in <cache dir>/scratch, emptied at startup
+  cache_ttl_seconds
+                  Lifetime of cached godocs tag/status responses (default: 60)
+  models          Per-task LLM fallback lists {default, date, classify,
+                  fields, summary, translate, chat, tags}, tried in order; "remote:<model>" entries use the
+                  OpenAI-compatible provider in remote {url, api_key}
+                  (default: [ollama_model])
+  prompts         LLM prompt templates by task {date, classify, fields, summary,
+                  translate, chat, tags}, using {{.Text}}, {{.TagNames}},
+                  {{.Groups}}, {{.Today}}
+  prompt_dir      Directory of <task>.tmpl prompt templates (prompts win)
+  llm_budget      {tokens_per_document, seconds_per_document}: warn when one
+                  document's LLM requests take more (default: no limit)
+  logs            {dir, max_size_mb, max_age_days, keep}: write the access,
+                  pipeline and action logs to rotated files in dir
+  languages       {translate_to}: language codes read here; previews in other
+                  languages are translated by the LLM into the first
+  doc_types       Document type taxonomy for LLM classification
+                  (default: invoice, receipt, letter, statement, id)
+  notifications   {backlog_threshold, failure_attempts, inbox_zero} sent to
+                  ntfy {url, token}, pushover {token, user} and/or
+                  slack {webhook_url}
+  mqtt            {broker, username, password, topic_prefix, discovery_prefix,
+                  interval_seconds}: publish inbox state and events, with
+                  Home Assistant discovery
+  s3              {endpoint, bucket, prefix, path_style, access_key_id,
+                  secret_access_key, tag_id, interval_seconds, delete}: upload
+                  new files from an S3/MinIO bucket
+  cloud_drives    List of {provider (dropbox, google_drive), folder,
+                  processed_folder, client_id, client_secret, refresh_token,
+                  tag_id, interval_seconds}: upload new files from the folder
+                  and move them to processed_folder
+  webhooks        List of {url, events, secret} outgoing webhooks for
+                  ocr.completed, date.inferred, document.tagged, inbox.zero
+  pipeline        Stage toggles {ocr, date_inference, classify,
+                  hires_thumbnails, duplicates, suggestions, summary,
+                  language, tag_proposals}:
+                  true/false,
+                  plus per-type overrides
+                  under types (e.g. types: {.txt: {ocr: false}}), the
+                  text route per type under routes {ocr, pdf_text, text,
+                  mail, manual}, and manual_tag for types with no route
+  pdf_passwords   Passwords tried when OCR'ing encrypted PDFs
+  tools           Binary paths for external tools not in PATH {tesseract,
+                  pdftoppm, pdftotext, ocrmypdf, qpdf}
+  separators      {enabled, prefix, apply_tags}: split batch scans at QR
+                  separator sheets
+  searchable_pdf  {enabled, types, max_mb}: replace OCR'd documents with an
+                  ocrmypdf PDF/A copy (default types [.pdf], max_mb 50)
+  ocr_min_confidence
+                  Flag OCR text below this mean tesseract word confidence
+                  for review (default: 60, -1 disables)
+  date_min_confidence
+                  Apply an inferred date only when the model's confidence
+                  exceeds this (0-1, default: 0.7); otherwise the
+                  candidates are offered as a quick-pick list
+  date_heuristics Date finding from the text without the LLM: fallback
+                  (default: when the LLM fails or finds nothing),
+                  cross_check (also check the LLM's answer), only, or off
+  date_order      dmy or mdy, for numeric dates like 03/04/2026
+                  (default: as the locale writes them)
+  locale          How dates are shown: iso (default: 2026-03-04), en-GB,
+                  en-US, de-DE, fr-FR, es-ES, it-IT or nl-NL
+  timezone        IANA timezone times are shown in, e.g. Europe/London
+                  (default: the server's)
+  thumbnails      {width, format, quality, style, workers} for hi-res thumbnails
+                  (default: 600px png, uniform style, 2 pregeneration workers)
+  embedding_model Ollama embedding model for tag suggestions
+                  (default: nomic-embed-text)
+  godocs_hook_token
+                  Bearer token godocs sends to POST /hooks/godocs when a
+                  document is ingested; processing then starts immediately
+  expenses        {tag_ids, currency, account, payment_account} for the
+                  expense export at /export/expenses (csv, ledger, beancount)
+  paperless       {correspondent_group, document_type_group, tag_group} tag
+                  groups used by paperless import/export
+  limits          {requests_per_minute, burst, max_body_kb} per-IP rate limit
+                  on /api/, /proxy/, /hooks/ and request body size limit
+  debug           Serve pprof and /debug/state, as with -debug (unauthenticated)
+  dry_run         Log tag, date, text, move and delete changes instead of
+                  making them in godocs, as with -dry-run
+  users           Optional named profiles {name, tags, presets}, each with
+                  their own shortcuts, recent sets, undo history and stats
+  profiles        Optional godocs servers {name, godocs_server, tags, presets,
+                  users, ollama_url, ollama_model, models, ...}, each served
+                  under /p/<name>/ with its own state and caches
 
 `, configFileName, configFileName, configFileName)
 	flag.PrintDefaults()
@@ -896,20 +1844,88 @@ Config file fields:
 
 // --- Server ---
 
-func serve(app *App) {
-	funcMap := template.FuncMap{
-		"add": func(a, b int) int { return a + b },
+// routes registers the pages and API on a new mux and returns it wrapped
+// in the request logging, base path, rate limit and CSRF middleware. It is
+// separate from serve so tests can mount the inbox on an httptest server.
+func (app *App) routes() (http.Handler, error) {
+	tmpl, err := app.parseTemplates()
+	if err != nil {
+		return nil, err
 	}
-	tmpl := template.Must(template.New("").Funcs(funcMap).ParseFS(templateFS, "templates/*.html"))
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	app.tmpl = tmpl
+	mux := http.NewServeMux()
+	app.mux = mux
+
+	mux.HandleFunc("/users", app.handleUsers)
+	mux.HandleFunc("/review", app.handleReview)
+	mux.HandleFunc("/api/confirm-doctype", app.handleConfirmDocType)
+	mux.HandleFunc("/api/retry", app.handleRetry)
+	mux.HandleFunc("/api/pdf-password", app.handlePDFPassword)
+	mux.HandleFunc("/api/pick-date", app.handlePickDate)
+	mux.HandleFunc("/api/delete-duplicate", app.handleDeleteDuplicate)
+	mux.HandleFunc("/api/note", app.handleNote)
+	mux.HandleFunc("/text", app.handleText)
+	mux.HandleFunc("/compare", app.handleCompare)
+	mux.HandleFunc("/compare/page/", app.handleComparePage)
+	mux.HandleFunc("/api/chat", app.handleChat)
+	mux.HandleFunc("/api/snooze", app.handleSnooze)
+	mux.HandleFunc("/api/rotate", app.handleRotate)
+	mux.HandleFunc("/api/archive", app.handleArchive)
+	mux.HandleFunc("/snoozed", app.handleSnoozed)
+	mux.HandleFunc("/doc/{ulid}", app.handleOpenDoc)
+	mux.HandleFunc("/search", app.handleSearch)
+	mux.HandleFunc("/sort", app.handleSort)
+	mux.HandleFunc("/api/sort", app.handleSortDoc)
+	mux.HandleFunc("/api/quick-open", app.handleQuickOpen)
+	mux.HandleFunc("/api/keymap", app.handleKeymap)
+	mux.HandleFunc("/api/version", app.handleVersion)
+	mux.HandleFunc("/upload", app.handleUpload)
+	mux.HandleFunc("/processing", app.handleProcessing)
+	mux.HandleFunc("/kiosk", app.handleKiosk)
+	mux.HandleFunc("/m", handleMobile)
+	mux.HandleFunc("/api/replay", app.handleReplay)
+	mux.HandleFunc("/api/error-banner", app.handleErrorBanner)
+	mux.HandleFunc("/hooks/godocs", app.handleGodocsHook)
+	mux.HandleFunc("/export/expenses", app.handleExportExpenses)
+	mux.HandleFunc("/export/actions.csv", app.handleExportActions)
+	mux.HandleFunc("/export/actions.json", app.handleExportActions)
+	mux.HandleFunc("/export/documents.csv", app.handleExportDocuments)
+	mux.HandleFunc("/export/documents.json", app.handleExportDocuments)
+	app.handleStatic(mux)
+	if app.config().Debug {
+		app.handleDebug(mux)
+	}
+	mux.HandleFunc("/api/refresh-cache", app.handleRefreshCache)
+	mux.HandleFunc("/tags/stats", app.handleTagStats)
+	mux.HandleFunc("/tags/proposals", app.handleTagProposals)
+	mux.HandleFunc("/tags/merge", app.handleTagMerge)
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
 		}
 		app.mu.Lock()
 		defer app.mu.Unlock()
+		sess := app.requireUser(w, r)
+		if sess == nil {
+			return
+		}
 
+		if r.URL.Query().Has("folder") && sess.Folder != r.URL.Query().Get("folder") {
+			sess.Folder = r.URL.Query().Get("folder")
+			sess.save()
+		}
+		if r.URL.Query().Has("oldest") && sess.Oldest != (r.URL.Query().Get("oldest") == "1") {
+			sess.Oldest = r.URL.Query().Get("oldest") == "1"
+			sess.save()
+		}
+		if r.URL.Query().Has("bucket") {
+			if id := app.bucketParam(r.URL.Query().Get("bucket")); id != sess.Bucket {
+				sess.Bucket = id
+				sess.save()
+			}
+		}
 		flash := r.URL.Query().Get("flash")
 		posStr := r.URL.Query().Get("pos")
 		pos, _ := strconv.Atoi(posStr)
@@ -918,205 +1934,194 @@ func serve(app *App) {
 		}
 
 		data := PageData{
-			Page:      "inbox",
-			Shortcuts: app.config.Shortcuts,
-			Flash:     flash,
-			Undoable:  app.lastAction != nil,
-			IsDemo:    app.isDemo(),
-			GodocsURL: app.config.GodocsServer,
-		}
-		if app.lastAction != nil {
-			data.UndoInfo = app.lastAction.DocName
-			if data.UndoInfo == "" {
-				data.UndoInfo = app.lastAction.File
-			}
+			Page:        "inbox",
+			User:        sess.Name,
+			Shortcuts:   sess.Shortcuts,
+			Flash:       flash,
+			Banner:      sess.Banner,
+			GodocsURL:   app.config().GodocsServer,
+			Mobile:      isMobile(r),
+			Chords:      sess.Keymap.Chords(),
+			Layers:      sess.Layers,
+			Goal:        app.goalProgress(time.Now()),
+			Snooze:      snoozeOptions,
+			Rotate:      rotateOptions,
+			Archive:     app.config().ArchiveFolder,
+			Overdue:     int(app.overdue.Load()),
+			OverdueDays: app.config().Aging.overdueDays(),
+			Oldest:      sess.Oldest,
+			Folder:      sess.Folder,
+			Folders:     app.folderCounts(sess),
+		}
+		if b := app.bucket(sess.Bucket); b != nil {
+			data.Bucket = b.Name
+		}
+		if last := sess.lastAction(); last != nil {
+			data.Undoable = true
+			data.UndoInfo = last.DocName
 		}
 
-		if app.isDemo() {
-			items := listFiles(app.config.InboxDir)
-			data.Remaining = len(items)
-			if len(items) == 0 {
-				data.Done = true
-			} else {
-				if pos > len(items) {
-					http.Redirect(w, r, "/?pos=1", http.StatusSeeOther)
-					return
-				}
-				idx := pos - 1
-				content, _ := os.ReadFile(filepath.Join(app.config.InboxDir, items[idx]))
-				data.Item = &InboxItem{
-					Name:    items[idx],
-					Content: template.HTML("<pre>" + template.HTMLEscapeString(string(content)) + "</pre>"),
+		queue := app.userQueue(sess)
+		data.Remaining = len(queue)
+		if len(queue) == 0 {
+			data.Done = true
+		} else if pos > len(queue) {
+			http.Redirect(w, r, "/?pos=1", http.StatusSeeOther)
+			return
+		} else {
+			data.Position = pos
+			data.PrevPos = pos - 1
+			if data.PrevPos < 1 {
+				data.PrevPos = 1
+			}
+			data.NextPos = pos + 1
+			if data.NextPos > len(queue) {
+				data.NextPos = len(queue)
+			}
+			doc := queue[pos-1]
+			item := &InboxItem{
+				ULID:    doc.ULID,
+				Name:    doc.Name,
+				DocType: doc.DocumentType,
+				Folder:  doc.Folder,
+			}
+			if age, ok := docAge(doc, time.Now()); ok {
+				item.Age, item.AgeClass = formatAge(age), app.config().Aging.class(age)
+			}
+			details := app.fetchDocDetails(r.Context(), doc.ULID)
+			data.TagCounts = app.shortcutCounts(r.Context(), sess)
+			if status := details.status; status != nil {
+				item.HasThumbnail = status.HasThumbnail
+				if status.HasThumbnail {
+					item.ThumbnailURL = app.config().GodocsServer + status.ThumbnailURL
 				}
-				data.Position = pos
-				data.PrevPos = pos - 1
-				if data.PrevPos < 1 {
-					data.PrevPos = 1
+				item.ViewURL = app.docs.ViewURL(doc.ULID)
+				item.IngressTime = status.IngressTime
+				item.DocumentDate = status.DocumentDate
+				item.DateIsLLM = app.llmDates[doc.ULID]
+
+				// Check background processing stage
+				stage := app.jobStage(doc.ULID)
+				if stage == "" {
+					item.Failure = app.failure(doc.ULID)
 				}
-				data.NextPos = pos + 1
-				if data.NextPos > len(items) {
-					data.NextPos = len(items)
+
+				switch stage {
+				case stageOCR:
+					item.Processing = true
+				case stageLLM:
+					item.LLMWorking = true
 				}
-			}
-		} else {
-			data.Remaining = len(app.untagged)
-			if len(app.untagged) == 0 {
-				data.Done = true
-			} else if pos > len(app.untagged) {
-				http.Redirect(w, r, "/?pos=1", http.StatusSeeOther)
-				return
-			} else {
-				data.Position = pos
-				data.PrevPos = pos - 1
-				if data.PrevPos < 1 {
-					data.PrevPos = 1
+
+				if app.startProcessing(doc.ULID, status, details.text) {
+					item.Processing = true
 				}
-				data.NextPos = pos + 1
-				if data.NextPos > len(app.untagged) {
-					data.NextPos = len(app.untagged)
+				if app.manualHandling[doc.ULID] {
+					item.ManualHandling = app.config().Pipeline.manualTag()
 				}
-				doc := app.untagged[pos-1]
-				item := &InboxItem{
-					ULID:    doc.ULID,
-					Name:    doc.Name,
-					DocType: doc.DocumentType,
-					Folder:  doc.Folder,
+				item.Summary = app.summaries[doc.ULID]
+				if l, ok := app.languages[doc.ULID]; ok {
+					item.Language = l.Lang
+					item.Translation, item.TranslatedTo = l.Translation, lang.Name(l.TranslatedTo)
 				}
-				// Fetch status for thumbnail/text info
-				if status, err := app.client.FetchDocStatus(doc.ULID); err == nil {
-					item.HasThumbnail = status.HasThumbnail
-					if status.HasThumbnail {
-						item.ThumbnailURL = app.config.GodocsServer + status.ThumbnailURL
-					}
-					item.ViewURL = app.config.GodocsServer + status.ViewURL
-					item.IngressTime = status.IngressTime
-					item.DocumentDate = status.DocumentDate
-					item.DateIsLLM = app.llmDates[doc.ULID]
-
-					// Check background processing stage
-					app.processingMu.Lock()
-					stage := app.docStage[doc.ULID]
-					app.processingMu.Unlock()
-
-					switch stage {
-					case stageOCR:
-						item.Processing = true
-					case stageLLM:
-						item.LLMWorking = true
-					}
-
-					// Trigger OCR if no text and not already in pipeline or previously failed
-					if !status.HasText && stage == "" && !app.ocrFailed[doc.ULID] {
-						app.processingMu.Lock()
-						if app.docStage[doc.ULID] == "" && !app.ocrFailed[doc.ULID] {
-							app.docStage[doc.ULID] = stageOCR
-							go processDocument(app, doc.ULID, status.DocumentType)
-						}
-						app.processingMu.Unlock()
-						item.Processing = true
-					}
-
-					// Hi-res thumbnail: check cache, trigger generation
-					if status.HasThumbnail {
-						if app.hiresThumbExists(doc.ULID) {
-							item.HasHiresThumb = true
-						} else {
-							go generateHiresThumb(app, doc.ULID, status.DocumentType)
-						}
-					}
+				if pred := app.docTypes[doc.ULID]; pred != nil {
+					item.TypeGuess = pred.Type
+					item.TypeConfidence = int(pred.Confidence*100 + 0.5)
 				}
-				// Fetch text preview
-				if text, err := app.client.FetchDocText(doc.ULID); err == nil && text != "" {
-					if len(text) > 2000 {
-						text = text[:2000] + "..."
-					}
-					item.TextPreview = text
+				item.HasHiresThumb = status.HasThumbnail && app.hiresThumbExists(doc.ULID)
+				item.Duplicate = app.findDuplicate(doc.ULID)
+				item.Note = app.note(doc.ULID)
+				item.PoorOCR = app.poorOCR(doc.ULID)
+				item.DatePicks = app.datePicks(doc.ULID, item.DocumentDate)
+			}
+			if text := details.text; text != "" {
+				if len(text) > 2000 {
+					text = text[:2000] + "..."
 				}
-				data.Item = item
-				data.Groups, data.TagGroups = app.buildTagGroups(doc.ULID)
-				data.RecentSets = app.recentSets
+				item.TextPreview = text
+				item.TextSpans = app.highlightText(text, inferredDates(item))
 			}
+			data.Item = item
+			data.Groups = app.buildTagGroups(details.tags)
+			data.Missing = app.groupProblems(details.tags)
+			data.TagGroups = details.tagGroups
+			data.RecentSets = sess.RecentSets
+			data.Presets = sess.Presets
+			data.Suggestions = app.suggestTagSets(doc.ULID)
 		}
 
-		tmpl.ExecuteTemplate(w, "index.html", data)
+		app.templates().ExecuteTemplate(w, "index.html", data)
 	})
 
-	http.HandleFunc("/tag", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/tag", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 		app.mu.Lock()
 		defer app.mu.Unlock()
+		sess := app.requireUser(w, r)
+		if sess == nil {
+			return
+		}
 
 		tagKey := r.FormValue("tag")
 		pos := r.FormValue("pos")
+		shortcut := sess.shortcut(r.FormValue("layer"), tagKey)
 
-		if app.isDemo() {
-			item := r.FormValue("item")
-			tagName := ""
-			for _, s := range app.config.Shortcuts {
-				if s.Key == tagKey {
-					tagName = s.Name
-					break
-				}
-			}
-			if tagName == "" || item == "" {
-				http.Redirect(w, r, "/", http.StatusSeeOther)
-				return
-			}
-			destDir := filepath.Join(app.config.TaggedDir, tagName)
-			os.MkdirAll(destDir, 0755)
-			src := filepath.Join(app.config.InboxDir, item)
-			dst := filepath.Join(destDir, item)
-			if err := os.Rename(src, dst); err != nil {
-				log.Printf("error moving %s: %v", item, err)
-				http.Redirect(w, r, "/", http.StatusSeeOther)
-				return
-			}
-			app.lastAction = &LastAction{File: item, FromDir: app.config.InboxDir, ToDir: destDir}
-			flash := tagKey + ":" + tagName + " \u2190 " + item
-			http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
-		} else {
-			docULID := r.FormValue("ulid")
-			docName := r.FormValue("name")
-			var shortcut *ShortcutConfig
-			for i := range app.config.Shortcuts {
-				if app.config.Shortcuts[i].Key == tagKey {
-					shortcut = &app.config.Shortcuts[i]
-					break
-				}
-			}
-			if shortcut == nil || docULID == "" {
-				http.Redirect(w, r, "/", http.StatusSeeOther)
-				return
-			}
-			// Verify ULID matches cached queue position
-			posInt, _ := strconv.Atoi(pos)
-			if posInt < 1 || posInt > len(app.untagged) || app.untagged[posInt-1].ULID != docULID {
-				app.syncUntagged()
-				http.Redirect(w, r, "/?pos=1&flash=Queue+changed,+re-synced", http.StatusSeeOther)
-				return
-			}
-			if err := app.client.AddTag(docULID, shortcut.TagID); err != nil {
-				log.Printf("error tagging %s with %s: %v", docULID, shortcut.Name, err)
-				http.Redirect(w, r, "/?pos="+pos+"&flash=Error: "+err.Error(), http.StatusSeeOther)
-				return
-			}
-			app.captureTagSet(docULID)
-			app.lastAction = &LastAction{
-				DocULID: docULID,
-				DocName: docName,
-				TagID:   shortcut.TagID,
-				TagName: shortcut.Name,
-			}
+		docULID := r.FormValue("ulid")
+		docName := r.FormValue("name")
+		if shortcut == nil || docULID == "" {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		// Verify ULID matches cached queue position
+		posInt, _ := strconv.Atoi(pos)
+		queue := app.userQueue(sess)
+		if posInt < 1 || posInt > len(queue) || queue[posInt-1].ULID != docULID {
 			app.syncUntagged()
-			flash := shortcut.Key + ":" + shortcut.Name + " \u2190 " + docName
+			http.Redirect(w, r, "/?pos=1&flash=Queue+changed,+re-synced", http.StatusSeeOther)
+			return
+		}
+		if d := app.config().commitDelay(); d > 0 {
+			app.deferTag(sess, queue[posInt-1], *shortcut)
+			flash := shortcut.Key + ":" + shortcut.Name + " \u2190 " + docName + " (undo within " + d.String() + ")"
 			http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+			return
+		}
+		if err := app.docs.AddTag(docULID, shortcut.TagID); err != nil {
+			app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "tag "+docName+" with "+shortcut.Name, err))
+			return
+		}
+		app.captureTagSet(sess, docULID)
+		sess.pushAction(&LastAction{
+			DocULID: docULID,
+			DocName: docName,
+			TagID:   shortcut.TagID,
+			TagName: shortcut.Name,
+		})
+		sess.Stats.Tagged++
+		sess.record("tag "+shortcut.Name, docULID, docName)
+		app.emitTagged(docULID, docName, sess.Name, shortcut.Name)
+		app.journalTag(sess, actionTag, docULID, docName, TagSetEntry{ID: shortcut.TagID, Name: shortcut.Name})
+		app.syncUntagged()
+		done, deleted, err := app.runTagActions(r.Context(), sess, queue[posInt-1], shortcut.TagID)
+		var problems []string
+		if !deleted {
+			problems = app.holdIncomplete(r.Context(), sess, queue[posInt-1])
+		}
+		if len(problems) > 0 {
+			pos = "1"
+		}
+		flash := shortcut.Key + ":" + shortcut.Name + " \u2190 " + docName + done + stillNeeds(problems)
+		if err != nil {
+			app.fail(w, r, sess, "/?pos="+pos+"&flash="+flash, false, errs.E(errs.Upstream, "tag actions on "+docName, err))
+			return
 		}
+		http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
 	})
 
-	http.HandleFunc("/done", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/done", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
@@ -1124,58 +2129,150 @@ func serve(app *App) {
 		app.mu.Lock()
 		defer app.mu.Unlock()
 
+		sess := app.requireUser(w, r)
+		if sess == nil {
+			return
+		}
+
 		pos := r.FormValue("pos")
-		if !app.isDemo() {
-			ulid := r.FormValue("ulid")
-			if ulid != "" {
-				app.captureTagSet(ulid)
+		ulid := r.FormValue("ulid")
+		if ulid != "" && len(app.config().RequiredGroups) > 0 {
+			name := r.FormValue("name")
+			tags, err := app.docs.FetchDocTags(r.Context(), ulid)
+			if err != nil {
+				app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "done "+name, err))
+				return
+			}
+			if problems := app.groupProblems(tags); len(problems) > 0 {
+				app.fail(w, r, sess, "/?pos="+pos, false, errs.New(errs.Validation, name, "needs "+strings.Join(problems, ", ")))
+				return
+			}
+		}
+		if ulid != "" && sess.Bucket != 0 {
+			left, err := app.finishDetail(sess, ulid, r.FormValue("name"))
+			if err != nil {
+				app.fail(w, r, sess, "/?pos="+pos, true, err)
+				return
+			}
+			if left {
+				// back in the inbox if nothing else was tagged
+				app.syncUntagged()
 			}
 		}
+		if ulid != "" {
+			sess.release(ulid)
+			app.captureTagSet(sess, ulid)
+			sess.Stats.Done++
+			sess.record("done", ulid, r.FormValue("name"))
+		}
 		http.Redirect(w, r, "/?pos="+pos, http.StatusSeeOther)
 	})
 
-	http.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 		app.mu.Lock()
+		if app.client != nil {
+			app.client.cache.clear()
+		}
 		app.syncUntagged()
 		app.mu.Unlock()
 		http.Redirect(w, r, "/?pos=1", http.StatusSeeOther)
 	})
 
-	http.HandleFunc("/api/apply-tagset", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" || app.isDemo() {
+	mux.HandleFunc("/api/apply-tagset", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 		app.mu.Lock()
 		defer app.mu.Unlock()
 
+		sess := app.requireUser(w, r)
+		if sess == nil {
+			return
+		}
+
 		ulid := r.FormValue("ulid")
 		docName := r.FormValue("name")
 		pos := r.FormValue("pos")
-		indexStr := r.FormValue("index")
-		index, err := strconv.Atoi(indexStr)
-		if err != nil || index < 0 || index >= len(app.recentSets) || ulid == "" {
-			http.Redirect(w, r, "/", http.StatusSeeOther)
-			return
+
+		// A config preset ("preset"), a suggested set ("suggestion") or a
+		// recent set ("index")
+		var set RecentTagSet
+		if suggestionStr := r.FormValue("suggestion"); suggestionStr != "" {
+			suggestions := app.suggestTagSets(ulid)
+			i, err := strconv.Atoi(suggestionStr)
+			if err != nil || i < 0 || i >= len(suggestions) || ulid == "" {
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			set = suggestions[i].RecentTagSet
+		} else if presetStr := r.FormValue("preset"); presetStr != "" {
+			preset, err := strconv.Atoi(presetStr)
+			if err != nil || preset < 0 || preset >= len(sess.Presets) || ulid == "" {
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			p := sess.Presets[preset]
+			set = RecentTagSet{Tags: p.Tags, Label: p.Name}
+		} else {
+			index, err := strconv.Atoi(r.FormValue("index"))
+			if err != nil || index < 0 || index >= len(sess.RecentSets) || ulid == "" {
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			set = sess.RecentSets[index]
 		}
 
-		set := app.recentSets[index]
+		ids := make([]int, len(set.Tags))
+		for i, tag := range set.Tags {
+			ids[i] = tag.ID
+		}
+		doc := app.queuedDoc(sess, ulid, docName)
+		added, err := app.docs.AddTags(ulid, ids)
+		var applied []string
 		for _, tag := range set.Tags {
-			if err := app.client.AddTag(ulid, tag.ID); err != nil {
-				log.Printf("apply-tagset: error adding tag %d to %s: %v", tag.ID, ulid, err)
+			if !slices.Contains(added, tag.ID) {
+				continue
 			}
+			applied = append(applied, tag.Name)
+			app.journalTag(sess, actionTag, ulid, docName, tag)
+		}
+		if len(applied) > 0 {
+			app.emitTagged(ulid, docName, sess.Name, applied...)
 		}
-		app.captureTagSet(ulid)
+		app.captureTagSet(sess, ulid)
+		sess.Stats.SetsApplied++
+		sess.record("apply "+set.Label, ulid, docName)
 		app.syncUntagged()
-		flash := set.Label + " ← " + docName
+		done, deleted, actionErr := app.runTagActions(r.Context(), sess, doc, added...)
+		var problems []string
+		if !deleted {
+			problems = app.holdIncomplete(r.Context(), sess, doc)
+		}
+		if len(problems) > 0 {
+			pos = "1"
+		}
+		flash := set.Label + " ← " + docName + done + stillNeeds(problems)
+		if err != nil {
+			// Adding tags is idempotent, so a preset can be applied again;
+			// recent and suggested sets are looked up by an index that the
+			// capture above has just moved.
+			op := fmt.Sprintf("%s ← %s (%d of %d tags failed)", set.Label, docName, len(ids)-len(added), len(ids))
+			app.fail(w, r, sess, "/?pos="+pos, r.FormValue("preset") != "", errs.E(errs.Upstream, op, err))
+			return
+		}
+		if actionErr != nil {
+			app.fail(w, r, sess, "/?pos="+pos+"&flash="+flash, false, errs.E(errs.Upstream, "tag actions on "+docName, actionErr))
+			return
+		}
 		http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
 	})
 
-	http.HandleFunc("/undo", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/undo", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
@@ -1183,78 +2280,114 @@ func serve(app *App) {
 		app.mu.Lock()
 		defer app.mu.Unlock()
 
+		sess := app.requireUser(w, r)
+		if sess == nil {
+			return
+		}
+
 		pos := r.FormValue("pos")
-		if app.lastAction == nil {
+		last := sess.popAction()
+		if last == nil {
 			http.Redirect(w, r, "/?pos="+pos, http.StatusSeeOther)
 			return
 		}
 
-		if app.isDemo() {
-			src := filepath.Join(app.lastAction.ToDir, app.lastAction.File)
-			dst := filepath.Join(app.lastAction.FromDir, app.lastAction.File)
-			if err := os.Rename(src, dst); err != nil {
-				log.Printf("error undoing %s: %v", app.lastAction.File, err)
+		if last.Archived {
+			if err := app.undoArchive(sess, last); err != nil {
+				sess.pushAction(last)
+				app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "undo archive of "+last.DocName, err))
+				return
 			}
-			flash := "undo \u2190 " + app.lastAction.File
-			app.lastAction = nil
-			http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+			sess.Stats.Undone++
+			sess.record("undo archive", last.DocULID, last.DocName)
+			http.Redirect(w, r, "/?pos="+pos+"&flash=undo \u2190 "+last.DocName, http.StatusSeeOther)
+		} else if last.Pending && app.cancelTag(last) {
+			// never sent to godocs
+			sess.record("undo "+last.TagName, last.DocULID, last.DocName)
+			http.Redirect(w, r, "/?pos="+pos+"&flash=undo \u2190 "+last.DocName, http.StatusSeeOther)
 		} else {
-			if err := app.client.RemoveTag(app.lastAction.DocULID, app.lastAction.TagID); err != nil {
-				log.Printf("error undoing tag on %s: %v", app.lastAction.DocULID, err)
+			if err := app.docs.RemoveTag(last.DocULID, last.TagID); err != nil {
+				// Keep the action so that undo can be tried again
+				sess.pushAction(last)
+				app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "undo "+last.TagName+" on "+last.DocName, err))
+				return
 			}
+			sess.Stats.Undone++
+			app.journalTag(sess, actionUntag, last.DocULID, last.DocName, TagSetEntry{ID: last.TagID, Name: last.TagName})
+			app.untagSource(last.DocULID)
 			app.syncUntagged()
-			flash := "undo \u2190 " + app.lastAction.DocName
-			app.lastAction = nil
+			sess.record("undo "+last.TagName, last.DocULID, last.DocName)
+			flash := "undo \u2190 " + last.DocName
 			http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
 		}
 	})
 
-	http.HandleFunc("/tagged", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/tagged", func(w http.ResponseWriter, r *http.Request) {
 		app.mu.Lock()
 		defer app.mu.Unlock()
 
-		data := TaggedPageData{Page: "tagged", IsDemo: app.isDemo()}
+		data := TaggedPageData{Page: "tagged"}
+		shortcuts := app.config().Shortcuts
+		if sess := app.currentUser(r); sess != nil {
+			data.User = sess.Name
+			shortcuts = sess.Shortcuts
+		}
 
-		if app.isDemo() {
-			for _, s := range app.config.Shortcuts {
-				dir := filepath.Join(app.config.TaggedDir, s.Name)
-				items := listFiles(dir)
-				if len(items) > 0 {
-					data.Groups = append(data.Groups, TaggedGroup{Name: s.Name, Items: items})
-					data.Total += len(items)
-				}
+		ctx, cancel := context.WithTimeout(r.Context(), pageFetchTimeout)
+		defer cancel()
+		for _, s := range shortcuts {
+			sr, err := app.docs.FetchTagged(ctx, s.TagID, 1, taggedPageLimit)
+			if err != nil {
+				data.Error = err.Error()
+				break
+			}
+			if sr.TotalCount == 0 {
+				continue
 			}
+			g := TaggedGroup{Name: s.Name, Count: sr.TotalCount}
+			for _, d := range sr.Documents {
+				g.Items = append(g.Items, d.Name)
+			}
+			data.Groups = append(data.Groups, g)
+			data.Total += sr.TotalCount
 		}
-		// In server mode, tagged view is not applicable (use godocs UI)
 
-		tmpl.ExecuteTemplate(w, "tagged.html", data)
+		app.templates().ExecuteTemplate(w, "tagged.html", data)
 	})
 
-	http.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+		status := collectStatus(app)
+
 		app.mu.Lock()
 		defer app.mu.Unlock()
 
 		data := AboutPageData{
 			Page:         "about",
-			Config:       app.config,
+			Config:       *app.config(),
 			ConfigSource: app.configFile,
-			IsDemo:       app.isDemo(),
-			GodocsURL:    app.config.GodocsServer,
+			GodocsURL:    app.config().GodocsServer,
+			PublicURL:    app.publicURL(r),
+			Status:       status,
+			Build:        buildInfo(),
+			Godocs:       app.godocsVersion,
+			Shortcuts:    app.config().Shortcuts,
+			Presets:      app.config().Presets,
 		}
-		if app.client != nil {
-			for _, t := range app.client.tags {
-				data.ServerTags = append(data.ServerTags, t)
-			}
-			sort.Slice(data.ServerTags, func(i, j int) bool {
-				return data.ServerTags[i].Name < data.ServerTags[j].Name
-			})
+		if sess := app.currentUser(r); sess != nil {
+			data.User = sess.Name
+			data.Shortcuts = sess.Shortcuts
+			data.Presets = sess.Presets
 		}
+		data.ServerTags = app.docs.KnownTags()
+		sort.Slice(data.ServerTags, func(i, j int) bool {
+			return data.ServerTags[i].Name < data.ServerTags[j].Name
+		})
 
-		tmpl.ExecuteTemplate(w, "about.html", data)
+		app.templates().ExecuteTemplate(w, "about.html", data)
 	})
 
-	http.HandleFunc("/api/toggle-tag", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" || app.isDemo() {
+	mux.HandleFunc("/api/toggle-tag", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
 			http.Error(w, "not allowed", 405)
 			return
 		}
@@ -1265,31 +2398,47 @@ func serve(app *App) {
 			ULID   string `json:"ulid"`
 			TagID  int    `json:"tag_id"`
 			Active bool   `json:"active"` // current state: true=remove, false=add
+			Tags   []int  `json:"tags"`   // the document's tags as shown (see conflict.go)
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "bad request", 400)
 			return
 		}
 
+		if err := app.checkDocTags(r.Context(), req.ULID, req.Tags); err != nil {
+			writeError(w, err)
+			return
+		}
 		var err error
 		if req.Active {
-			err = app.client.RemoveTag(req.ULID, req.TagID)
+			err = app.docs.RemoveTag(req.ULID, req.TagID)
 		} else {
-			err = app.client.AddTag(req.ULID, req.TagID)
+			err = app.docs.AddTag(req.ULID, req.TagID)
 		}
 
-		w.Header().Set("Content-Type", "application/json")
 		if err != nil {
-			log.Printf("toggle-tag error: %v", err)
-			w.WriteHeader(500)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			writeError(w, errs.E(errs.Upstream, "toggle tag", err))
 			return
 		}
-		json.NewEncoder(w).Encode(map[string]bool{"active": !req.Active})
+		w.Header().Set("Content-Type", "application/json")
+		tag, _ := app.docs.Tag(req.TagID)
+		entry := TagSetEntry{ID: tag.ID, Name: tag.Name}
+		sess := app.currentUser(r)
+		if req.Active {
+			app.journalTag(sess, actionUntag, req.ULID, "", entry)
+		} else {
+			app.journalTag(sess, actionTag, req.ULID, "", entry)
+			app.emitTagged(req.ULID, "", "", tag.Name)
+		}
+		var missing []string
+		if sess != nil {
+			missing = app.holdIncomplete(r.Context(), sess, app.queuedDoc(sess, req.ULID, ""))
+		}
+		json.NewEncoder(w).Encode(map[string]any{"active": !req.Active, "missing": missing})
 	})
 
-	http.HandleFunc("/api/create-tag", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" || app.isDemo() {
+	mux.HandleFunc("/api/create-tag", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
 			http.Error(w, "not allowed", 405)
 			return
 		}
@@ -1313,24 +2462,24 @@ func serve(app *App) {
 			return
 		}
 		if req.Color == "" {
-			req.Color = "#3498db"
+			req.Color = defaultTagColor
 		}
 
-		tag, err := app.client.CreateTag(req.Name, req.Color, req.Group)
+		tag, err := app.docs.CreateTag(req.Name, req.Color, req.Group)
 		if err != nil {
-			log.Printf("create-tag error: %v", err)
-			w.WriteHeader(500)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			writeError(w, errs.E(errs.Upstream, "create tag "+req.Name, err))
 			return
 		}
 
 		// Auto-apply to document if ulid provided
 		applied := false
 		if req.ULID != "" {
-			if err := app.client.AddTag(req.ULID, tag.ID); err != nil {
+			if err := app.docs.AddTag(req.ULID, tag.ID); err != nil {
 				log.Printf("auto-apply tag %d to %s failed: %v", tag.ID, req.ULID, err)
 			} else {
 				applied = true
+				app.emitTagged(req.ULID, "", "", tag.Name)
+				app.journalTag(app.currentUser(r), actionTag, req.ULID, "", TagSetEntry{ID: tag.ID, Name: tag.Name})
 			}
 		}
 
@@ -1345,72 +2494,85 @@ func serve(app *App) {
 	})
 
 	// Proxy thumbnail requests to avoid CORS issues
-	http.HandleFunc("/proxy/thumbnail/", func(w http.ResponseWriter, r *http.Request) {
-		if app.isDemo() {
-			http.NotFound(w, r)
-			return
-		}
+	mux.HandleFunc("/proxy/thumbnail/", func(w http.ResponseWriter, r *http.Request) {
 		ulid := strings.TrimPrefix(r.URL.Path, "/proxy/thumbnail/")
-		resp, err := app.client.httpClient.Get(app.config.GodocsServer + "/api/document/" + ulid + "/thumbnail")
+		body, contentType, err := app.docs.Thumbnail(r.Context(), ulid)
 		if err != nil {
+			log.Printf("proxy: thumbnail for %s: %v id=%s", ulid, err, requestID(r.Context()))
 			http.Error(w, "upstream error", 502)
 			return
 		}
-		defer resp.Body.Close()
-		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.Header().Set("Content-Type", contentType)
 		w.Header().Set("Cache-Control", "public, max-age=3600")
-		io.Copy(w, resp.Body)
+		if notModified(w, r, etagFor(body)) {
+			return
+		}
+		w.Write(body)
 	})
 
 	// Serve cached hi-res thumbnails
-	http.HandleFunc("/hires/thumbnail/", func(w http.ResponseWriter, r *http.Request) {
-		if app.isDemo() {
-			http.NotFound(w, r)
-			return
-		}
+	mux.HandleFunc("/hires/thumbnail/", func(w http.ResponseWriter, r *http.Request) {
 		ulid := strings.TrimPrefix(r.URL.Path, "/hires/thumbnail/")
 		path := app.hiresThumbPath(ulid)
-		if _, err := os.Stat(path); err != nil {
+		fi, err := os.Stat(path)
+		if err != nil {
 			http.NotFound(w, r)
 			return
 		}
-		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Type", app.config().Thumbnails.contentType())
 		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Header().Set("ETag", fileETag(fi))
 		http.ServeFile(w, r, path)
 	})
 
 	// Check if hi-res thumbnail is ready (for JS polling)
-	http.HandleFunc("/hires/thumbnail-ready/", func(w http.ResponseWriter, r *http.Request) {
-		if app.isDemo() {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]bool{"ready": false})
-			return
-		}
+	mux.HandleFunc("/hires/thumbnail-ready/", func(w http.ResponseWriter, r *http.Request) {
 		ulid := strings.TrimPrefix(r.URL.Path, "/hires/thumbnail-ready/")
 		ready := app.hiresThumbExists(ulid)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]bool{"ready": ready})
 	})
 
-	log.Printf("godocs-inbox serving on http://localhost%s", app.config.Addr)
-	if !app.isDemo() {
-		log.Printf("  godocs server: %s", app.config.GodocsServer)
-		log.Printf("  shortcuts: %d configured", len(app.config.Shortcuts))
-	}
-	log.Fatal(http.ListenAndServe(app.config.Addr, nil))
+	return logRequests(compressResponses(withBasePath(app.config().BasePath, app.limitRequests(csrfProtect(revalidateAPI(mux)))))), nil
 }
 
-func listFiles(dir string) []string {
-	entries, err := os.ReadDir(dir)
+// serve listens for the inbox: one app at base, or several profiles each
+// under its own base path.
+func serve(base string, apps []*App) {
+	var handler http.Handler
+	var err error
+	if len(apps) == 1 {
+		handler, err = apps[0].routes()
+	} else {
+		handler, err = profilesHandler(base, apps)
+	}
 	if err != nil {
-		return nil
+		log.Fatalf("Templates: %v", err)
 	}
-	var items []string
-	for _, e := range entries {
-		if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
-			items = append(items, e.Name())
+
+	cfg := apps[0].config()
+	scheme := "http"
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	log.Printf("godocs-inbox serving on %s://localhost%s%s/", scheme, cfg.Addr, base)
+	flushOnSignal(apps)
+	for _, app := range apps {
+		if app.config().Profile != "" {
+			log.Printf("  profile %s at %s/", app.config().Profile, app.config().BasePath)
+		}
+		if app.config().GodocsServer != "" {
+			log.Printf("  godocs server: %s", app.config().GodocsServer)
 		}
+		log.Printf("  shortcuts: %d configured", len(app.config().Shortcuts))
+	}
+	for _, app := range apps {
+		if app.config().Debug {
+			log.Printf("  debug endpoints (unauthenticated): %s/debug/pprof/ and %s/debug/state", app.config().BasePath, app.config().BasePath)
+		}
+	}
+	if cfg.TLSCert != "" {
+		log.Fatal(http.ListenAndServeTLS(cfg.Addr, cfg.TLSCert, cfg.TLSKey, handler))
 	}
-	sort.Strings(items)
-	return items
+	log.Fatal(http.ListenAndServe(cfg.Addr, handler))
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const layoutCookieName = "godocs_inbox_layout"
+
+// isMobile reports whether to render the touch triage layout. The choice made
+// at /m is remembered in a cookie; otherwise the User-Agent decides.
+func isMobile(r *http.Request) bool {
+	if c, err := r.Cookie(layoutCookieName); err == nil {
+		return c.Value == "mobile"
+	}
+	ua := r.UserAgent()
+	return strings.Contains(ua, "Mobi") || strings.Contains(ua, "Android")
+}
+
+// handleMobile switches to the touch layout (/m) or back to desktop (/m?off=1).
+func handleMobile(w http.ResponseWriter, r *http.Request) {
+	layout := "mobile"
+	if r.URL.Query().Get("off") != "" {
+		layout = "desktop"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     layoutCookieName,
+		Value:    layout,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
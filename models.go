@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+)
+
+// LLM tasks that can be given their own models.
+const (
+	taskDate      = "date"
+	taskClassify  = "classify"
+	taskFields    = "fields"
+	taskSummary   = "summary"
+	taskTranslate = "translate"
+	taskChat      = "chat"
+	taskTags      = "tags"
+)
+
+var llmTasks = []string{taskDate, taskClassify, taskFields, taskSummary, taskTranslate, taskChat, taskTags}
+
+// remoteModelPrefix marks a model served by the remote provider rather
+// than Ollama, e.g. "remote:gpt-4o-mini".
+const remoteModelPrefix = "remote:"
+
+// ModelsConfig picks the models each LLM task runs on. Each list is tried
+// in order until a model answers, so later entries are fallbacks for when
+// a model is not pulled or Ollama is down. Tasks without a list use
+// Default, and without that ollama_model.
+type ModelsConfig struct {
+	Default   []string          `yaml:"default,omitempty"`
+	Date      []string          `yaml:"date,omitempty"`
+	Classify  []string          `yaml:"classify,omitempty"`
+	Fields    []string          `yaml:"fields,omitempty"`
+	Summary   []string          `yaml:"summary,omitempty"`
+	Translate []string          `yaml:"translate,omitempty"`
+	Chat      []string          `yaml:"chat,omitempty"`
+	Tags      []string          `yaml:"tags,omitempty"`
+	Remote    RemoteModelConfig `yaml:"remote,omitempty"`
+}
+
+// RemoteModelConfig is an OpenAI-compatible provider for "remote:" models.
+type RemoteModelConfig struct {
+	URL    string `yaml:"url,omitempty"` // API base, e.g. https://api.openai.com/v1
+	APIKey string `yaml:"api_key,omitempty"`
+}
+
+func (c ModelsConfig) task(name string) []string {
+	var list []string
+	switch name {
+	case taskDate:
+		list = c.Date
+	case taskClassify:
+		list = c.Classify
+	case taskFields:
+		list = c.Fields
+	case taskSummary:
+		list = c.Summary
+	case taskTranslate:
+		list = c.Translate
+	case taskChat:
+		list = c.Chat
+	case taskTags:
+		list = c.Tags
+	}
+	if len(list) == 0 {
+		list = c.Default
+	}
+	return list
+}
+
+func (c ModelsConfig) configured() bool {
+	return len(c.Default)+len(c.Date)+len(c.Classify)+len(c.Fields)+len(c.Summary)+len(c.Translate)+len(c.Chat)+len(c.Tags) > 0
+}
+
+func (c ModelsConfig) validate() error {
+	lists := map[string][]string{"default": c.Default, taskDate: c.Date, taskClassify: c.Classify, taskFields: c.Fields, taskSummary: c.Summary, taskTranslate: c.Translate, taskChat: c.Chat, taskTags: c.Tags}
+	for task, list := range lists {
+		for _, name := range list {
+			remote, ok := strings.CutPrefix(name, remoteModelPrefix)
+			if name == "" || ok && remote == "" {
+				return fmt.Errorf("models: empty model name in %s", task)
+			}
+			if ok && c.Remote.URL == "" {
+				return fmt.Errorf("models: %s in %s needs models.remote.url", name, task)
+			}
+		}
+	}
+	return nil
+}
+
+// models returns the models to try for an LLM task, in order.
+func (app *App) models(task string) []llm.Model {
+	names := app.config().Models.task(task)
+	if len(names) == 0 {
+		names = []string{app.ollamaModel()}
+	}
+	models := make([]llm.Model, len(names))
+	for i, name := range names {
+		if remote, ok := strings.CutPrefix(name, remoteModelPrefix); ok {
+			r := app.config().Models.Remote
+			models[i] = llm.Model{Name: remote, URL: strings.TrimRight(r.URL, "/"), APIKey: r.APIKey, Remote: true}
+		} else {
+			models[i] = llm.Model{Name: name, URL: app.ollamaURL()}
+		}
+	}
+	return models
+}
+
+// withModels runs an LLM task on each of its models in turn until one
+// succeeds, logging which model produced the result. The error is the last
+// model's, or errLLMOffline if Ollama is down and no remote model is set.
+func withModels[T any](app *App, task, ulid string, call func(llm.Model) (T, error)) (T, error) {
+	var zero T
+	models, err := app.availableModels(task)
+	if err != nil {
+		return zero, err
+	}
+	for i, m := range models {
+		m.OnUsage = func(u llm.Usage) { app.recordLLMUsage(task, ulid, m.String(), u) }
+		var v T
+		if v, err = call(m); err == nil {
+			if i > 0 {
+				pipelineLog.Printf("llm: %s for %s by fallback %s", task, ulid, m)
+			} else {
+				pipelineLog.Printf("llm: %s for %s by %s", task, ulid, m)
+			}
+			return v, nil
+		}
+		pipelineLog.Printf("llm: %s for %s with %s failed: %v", task, ulid, m, err)
+	}
+	return zero, err
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/mqtt"
+)
+
+// MQTTConfig publishes the inbox's state to an MQTT broker for home
+// automation. Home Assistant finds the sensors through its discovery
+// messages; other tools can read the topics directly:
+//
+//	mqtt:
+//	  broker: tcp://homeassistant.local:1883   # ssl:// for TLS
+//	  username: inbox
+//	  password: secret
+//	  topic_prefix: godocs-inbox               # the default
+//	  discovery_prefix: homeassistant          # the default
+//	  interval_seconds: 60                     # the default
+//
+// Under the prefix, state is a retained JSON object of counts, status is
+// "online" or (the broker's will) "offline", and event carries every
+// webhook event as it happens.
+type MQTTConfig struct {
+	Broker          string `yaml:"broker,omitempty"`
+	Username        string `yaml:"username,omitempty"`
+	Password        string `yaml:"password,omitempty"`
+	TopicPrefix     string `yaml:"topic_prefix,omitempty"`
+	DiscoveryPrefix string `yaml:"discovery_prefix,omitempty"`
+	IntervalSeconds int    `yaml:"interval_seconds,omitempty"`
+}
+
+const (
+	defaultMQTTPrefix    = "godocs-inbox"
+	defaultMQTTDiscovery = "homeassistant"
+	defaultMQTTInterval  = time.Minute
+)
+
+func (c MQTTConfig) validate() error {
+	if c.Broker == "" {
+		return nil
+	}
+	if !strings.Contains(c.Broker, "://") {
+		return fmt.Errorf("mqtt: broker %q needs a scheme, such as tcp:// or ssl://", c.Broker)
+	}
+	if c.IntervalSeconds < 0 {
+		return fmt.Errorf("mqtt: interval_seconds must be positive")
+	}
+	return nil
+}
+
+func (c MQTTConfig) interval() time.Duration {
+	if c.IntervalSeconds == 0 {
+		return defaultMQTTInterval
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+// mqttTopic is the topic prefix, with the profile name appended so that
+// profiles publish side by side.
+func (app *App) mqttTopic() string {
+	prefix := app.config().MQTT.TopicPrefix
+	if prefix == "" {
+		prefix = defaultMQTTPrefix
+	}
+	if p := app.config().Profile; p != "" {
+		prefix += "/" + p
+	}
+	return prefix
+}
+
+// InboxState is the retained message on {prefix}/state.
+type InboxState struct {
+	Untagged   int `json:"untagged"`
+	Processing int `json:"processing"` // OCR and LLM jobs running
+	Failed     int `json:"failed"`
+	Snoozed    int `json:"snoozed"`
+}
+
+// inboxState counts the queue and background jobs. Callers must hold app.mu.
+func (app *App) inboxState() InboxState {
+	state := InboxState{Untagged: len(app.untagged), Snoozed: app.snoozedCount()}
+	app.processingMu.Lock()
+	state.Processing, state.Failed = len(app.docStage), len(app.failures)
+	app.processingMu.Unlock()
+	return state
+}
+
+// initMQTT makes the broker client, if one is configured. It connects on
+// first use.
+func (app *App) initMQTT() {
+	cfg := app.config().MQTT
+	if cfg.Broker == "" {
+		return
+	}
+	topic := app.mqttTopic()
+	app.broker = mqtt.New(mqtt.Options{
+		Broker:   cfg.Broker,
+		ClientID: strings.ReplaceAll(topic, "/", "-"),
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Will:     &mqtt.Message{Topic: topic + "/status", Payload: []byte("offline"), Retain: true},
+	})
+}
+
+// runMQTT publishes discovery and state at the configured interval until
+// ctx is done. It returns at once if there is no broker.
+func (app *App) runMQTT(ctx context.Context) {
+	if app.broker == nil {
+		return
+	}
+	log.Printf("mqtt: publishing to %s under %s", app.config().MQTT.Broker, app.mqttTopic())
+	t := time.NewTicker(app.config().MQTT.interval())
+	defer t.Stop()
+	for {
+		// discovery is republished in case the broker lost its retained messages
+		app.publishMQTT(app.discoveryMessages()...)
+		app.mu.Lock()
+		state := app.inboxState()
+		app.mu.Unlock()
+		app.publishState(state)
+		select {
+		case <-ctx.Done():
+			app.broker.Close()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// publishState sends state as the retained {prefix}/state message.
+func (app *App) publishState(state InboxState) {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	app.publishMQTT(mqtt.Message{Topic: app.mqttTopic() + "/state", Payload: body, Retain: true})
+}
+
+// publishEvent sends a webhook event to {prefix}/event.
+func (app *App) publishEvent(ev Event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	app.publishMQTT(mqtt.Message{Topic: app.mqttTopic() + "/event", Payload: body})
+}
+
+// publishMQTT sends messages, stopping at the first failure. Failures are
+// logged as pipeline errors, as for webhooks.
+func (app *App) publishMQTT(msgs ...mqtt.Message) {
+	if app.broker == nil {
+		return
+	}
+	for _, m := range msgs {
+		if err := app.broker.Publish(m); err != nil {
+			app.pipelineErrorf("mqtt", "", "%v", err)
+			return
+		}
+	}
+}
+
+// discoveryMessages announces the status topic and a Home Assistant sensor
+// for each count in InboxState.
+func (app *App) discoveryMessages() []mqtt.Message {
+	topic := app.mqttTopic()
+	disc := app.config().MQTT.DiscoveryPrefix
+	if disc == "" {
+		disc = defaultMQTTDiscovery
+	}
+	node := strings.ReplaceAll(topic, "/", "_")
+	name := "Godocs inbox"
+	if p := app.config().Profile; p != "" {
+		name += " (" + p + ")"
+	}
+	msgs := []mqtt.Message{{Topic: topic + "/status", Payload: []byte("online"), Retain: true}}
+	for _, s := range []struct{ key, name, icon, unit string }{
+		{"untagged", "Untagged documents", "mdi:inbox-full", "documents"},
+		{"processing", "Documents processing", "mdi:cog", "documents"},
+		{"failed", "Failed jobs", "mdi:alert-circle", "jobs"},
+		{"snoozed", "Snoozed documents", "mdi:sleep", "documents"},
+	} {
+		body, _ := json.Marshal(map[string]any{
+			"name":                s.name,
+			"unique_id":           node + "_" + s.key,
+			"state_topic":         topic + "/state",
+			"value_template":      "{{ value_json." + s.key + " }}",
+			"availability_topic":  topic + "/status",
+			"icon":                s.icon,
+			"state_class":         "measurement",
+			"unit_of_measurement": s.unit,
+			"device":              map[string]any{"identifiers": []string{node}, "name": name, "manufacturer": "godocs-inbox"},
+		})
+		msgs = append(msgs, mqtt.Message{Topic: disc + "/sensor/" + node + "/" + s.key + "/config", Payload: body, Retain: true})
+	}
+	return msgs
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+const (
+	noteKey     = "n" // reserved key to edit the current document's note
+	maxNoteSize = 2000
+)
+
+// godocs has no API for free-text annotations, so notes live in the local
+// state database keyed by ULID.
+
+// note returns the note on ulid, or "".
+func (app *App) note(ulid string) string {
+	if ulid == "" {
+		return ""
+	}
+	n, err := app.store.Note(ulid)
+	if err != nil {
+		log.Printf("state: %v", err)
+	}
+	return n
+}
+
+// moveNote moves the note on a document to the copy that replaces it.
+func (app *App) moveNote(from, to string) {
+	if note := app.note(from); note != "" {
+		if err := app.store.SetNote(to, note); err == nil {
+			app.store.SetNote(from, "")
+		}
+	}
+}
+
+// notesFor returns the notes on the given documents, keyed by ULID.
+func (app *App) notesFor(ulids []string) map[string]string {
+	notes := make(map[string]string)
+	for _, u := range ulids {
+		if n := app.note(u); n != "" {
+			notes[u] = n
+		}
+	}
+	return notes
+}
+
+// handleNote saves (or, when empty, clears) the note on a document.
+func (app *App) handleNote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, name, pos := r.FormValue("ulid"), r.FormValue("name"), r.FormValue("pos")
+	text := strings.TrimSpace(r.FormValue("note"))
+	if len(text) > maxNoteSize {
+		text = text[:maxNoteSize]
+	}
+	if ulid == "" {
+		http.Redirect(w, r, "/?pos="+pos, http.StatusSeeOther)
+		return
+	}
+	if err := app.store.SetNote(ulid, text); err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, false, errs.E(errs.Other, "note on "+name, err))
+		return
+	}
+	flash := "Note saved on " + name
+	if text == "" {
+		flash = "Note cleared on " + name
+		sess.record("clear note", ulid, name)
+	} else {
+		sess.record("note", ulid, name)
+	}
+	http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NotificationsConfig pushes inbox milestones and failures to a phone or
+// chat, so the inbox does not need watching. Each trigger is off when left
+// at zero, and any of the services may be set:
+//
+//	notifications:
+//	  backlog_threshold: 20   # when the untagged count rises past this
+//	  failure_attempts: 3     # when a document's OCR/LLM job has failed this often
+//	  inbox_zero: true
+//	  ntfy:
+//	    url: https://ntfy.sh/my-inbox
+//	    token: tk_...         # optional access token
+//	  pushover:
+//	    token: app-token
+//	    user: user-key
+//	  slack:
+//	    webhook_url: https://hooks.slack.com/services/...
+type NotificationsConfig struct {
+	BacklogThreshold int            `yaml:"backlog_threshold,omitempty"`
+	FailureAttempts  int            `yaml:"failure_attempts,omitempty"`
+	InboxZero        bool           `yaml:"inbox_zero,omitempty"`
+	Ntfy             NtfyConfig     `yaml:"ntfy,omitempty"`
+	Pushover         PushoverConfig `yaml:"pushover,omitempty"`
+	Slack            SlackConfig    `yaml:"slack,omitempty"`
+}
+
+type NtfyConfig struct {
+	URL   string `yaml:"url,omitempty"` // server and topic
+	Token string `yaml:"token,omitempty"`
+}
+
+type PushoverConfig struct {
+	Token string `yaml:"token,omitempty"` // application token
+	User  string `yaml:"user,omitempty"`  // user or group key
+}
+
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url,omitempty"` // incoming webhook
+}
+
+// pushoverURL is the Pushover messages API; a variable for tests.
+var pushoverURL = "https://api.pushover.net/1/messages.json"
+
+func (c NotificationsConfig) validate() error {
+	if c.BacklogThreshold < 0 || c.FailureAttempts < 0 {
+		return fmt.Errorf("notifications: backlog_threshold and failure_attempts must be positive")
+	}
+	if (c.Pushover.Token == "") != (c.Pushover.User == "") {
+		return fmt.Errorf("notifications: pushover needs both token and user")
+	}
+	return nil
+}
+
+// A notification is a short title and message, sent to every configured
+// service.
+type notification struct {
+	Title, Message string
+	Urgent         bool // failures: high priority where the service has one
+}
+
+// notify sends n in the background. Failures are logged as pipeline errors,
+// as for webhooks.
+func (app *App) notify(n notification) {
+	cfg := app.config().Notifications
+	if p := app.config().Profile; p != "" {
+		n.Title = "[" + p + "] " + n.Title
+	}
+	send := map[string]func(context.Context, notification) error{}
+	if cfg.Ntfy.URL != "" {
+		send["ntfy"] = cfg.Ntfy.send
+	}
+	if cfg.Pushover.Token != "" {
+		send["pushover"] = cfg.Pushover.send
+	}
+	if cfg.Slack.WebhookURL != "" {
+		send["slack"] = cfg.Slack.send
+	}
+	for name, f := range send {
+		go func() {
+			if err := f(context.Background(), n); err != nil {
+				app.pipelineErrorf("notify", "", "%s: %q: %v", name, n.Title, err)
+			}
+		}()
+	}
+}
+
+// notifyCount reports the untagged count changing from before to after:
+// rising past the backlog threshold, or reaching zero.
+func (app *App) notifyCount(before, after int) {
+	cfg := app.config().Notifications
+	if t := cfg.BacklogThreshold; t > 0 && before <= t && after > t {
+		app.notify(notification{Title: "Inbox backlog", Message: fmt.Sprintf("%d documents waiting to be tagged (over %d).", after, t)})
+	}
+	if cfg.InboxZero && before > 0 && after == 0 {
+		app.notify(notification{Title: "Inbox zero", Message: "Every document is tagged."})
+	}
+}
+
+// notifyFailure reports a job that has now failed attempts times, once, when
+// attempts reaches the configured count.
+func (app *App) notifyFailure(ulid, stage string, attempts int, err error) {
+	if n := app.config().Notifications.FailureAttempts; n == 0 || attempts != n {
+		return
+	}
+	app.notify(notification{
+		Title:   stage + " failing",
+		Message: fmt.Sprintf("%s of %s has failed %d times: %v", stage, ulid, attempts, err),
+		Urgent:  true,
+	})
+}
+
+func (c NtfyConfig) send(ctx context.Context, n notification) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, strings.NewReader(n.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", n.Title)
+	if n.Urgent {
+		req.Header.Set("Priority", "high")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return doNotify(req)
+}
+
+func (c PushoverConfig) send(ctx context.Context, n notification) error {
+	form := url.Values{"token": {c.Token}, "user": {c.User}, "title": {n.Title}, "message": {n.Message}}
+	if n.Urgent {
+		form.Set("priority", "1")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", pushoverURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doNotify(req)
+}
+
+func (c SlackConfig) send(ctx context.Context, n notification) error {
+	body, err := json.Marshal(map[string]string{"text": "*" + n.Title + "*\n" + n.Message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doNotify(req)
+}
+
+func doNotify(req *http.Request) error {
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// defaultOCRMinConfidence is the mean tesseract word confidence below which
+// OCR text is flagged as poor when ocr_min_confidence is unset.
+const defaultOCRMinConfidence = 60
+
+func (app *App) ocrMinConfidence() float64 {
+	if app.config().OCRMinConfidence == 0 {
+		return defaultOCRMinConfidence
+	}
+	return float64(app.config().OCRMinConfidence)
+}
+
+// recordOCRQuality stores the confidence of freshly OCR'd text. A new score
+// replaces the old one, so a document that has been rescanned or re-OCR'd
+// is reviewed afresh.
+func (app *App) recordOCRQuality(ulid string, res ocr.Result) {
+	q := store.OCRQuality{ULID: ulid, Confidence: res.Confidence, Words: res.Words, Time: time.Now()}
+	app.processingMu.Lock()
+	app.ocrQuality[ulid] = q
+	app.processingMu.Unlock()
+	if err := app.store.PutOCRQuality(q); err != nil {
+		log.Printf("state: %v", err)
+	}
+	if app.isPoorOCR(q) {
+		log.Printf("OCR: poor quality for %s (%.0f%% over %d words)", ulid, q.Confidence, q.Words)
+	}
+}
+
+func (app *App) isPoorOCR(q store.OCRQuality) bool {
+	return app.config().OCRMinConfidence >= 0 && q.Words > 0 && q.Confidence < app.ocrMinConfidence()
+}
+
+// poorOCR returns the OCR confidence of ulid, as a percentage, when it is
+// below the threshold, or 0.
+func (app *App) poorOCR(ulid string) int {
+	app.processingMu.Lock()
+	q, ok := app.ocrQuality[ulid]
+	app.processingMu.Unlock()
+	if !ok || !app.isPoorOCR(q) {
+		return 0
+	}
+	return max(int(q.Confidence+0.5), 1)
+}
+
+// poorOCRToReview returns the poorly OCR'd documents not yet reviewed.
+func (app *App) poorOCRToReview() []store.OCRQuality {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	var out []store.OCRQuality
+	for _, q := range app.ocrQuality {
+		if !q.Reviewed && app.isPoorOCR(q) {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// markOCRReviewed takes a document's poor OCR out of the review queue. It
+// reports whether there was a score to mark.
+func (app *App) markOCRReviewed(ulid string) bool {
+	app.processingMu.Lock()
+	q, ok := app.ocrQuality[ulid]
+	if ok {
+		q.Reviewed = true
+		app.ocrQuality[ulid] = q
+	}
+	app.processingMu.Unlock()
+	if !ok {
+		return false
+	}
+	if err := app.store.PutOCRQuality(q); err != nil {
+		log.Printf("state: %v", err)
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+//go:embed static
+var staticFS embed.FS
+
+// handleStatic serves assets under /static/, plus the PWA manifest and
+// service worker, which must live at the root to control every page.
+func (app *App) handleStatic(mux *http.ServeMux) {
+	sub := app.assetFS()
+	assets := http.StripPrefix("/static/", http.FileServer(http.FS(sub)))
+	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
+		if app.dev {
+			w.Header().Set("Cache-Control", "no-cache")
+		} else if etag := assetETag(sub, strings.TrimPrefix(r.URL.Path, "/static/")); etag != "" {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+			w.Header().Set("ETag", etag)
+		}
+		assets.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/manifest.webmanifest", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/manifest+json")
+		http.ServeFileFS(w, r, sub, "manifest.webmanifest")
+	})
+	mux.HandleFunc("/sw.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript")
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFileFS(w, r, sub, "sw.js")
+	})
+}
+
+// replayable lists the form actions the page may queue while offline.
+var replayable = []string{"/tag", "/api/apply-tagset", "/done", "/undo"}
+
+// QueuedAction is a form submission queued in the browser while offline.
+type QueuedAction struct {
+	Action   string            `json:"action"` // form path, one of replayable
+	Fields   map[string]string `json:"fields"`
+	QueuedAt time.Time         `json:"queued_at"`
+	SeenTags []int             `json:"seen_tags,omitempty"` // IDs of the tags on the document when queued (server mode)
+}
+
+// Replay outcomes.
+const (
+	replayOK       = "ok"
+	replayConflict = "conflict"
+	replayError    = "error"
+)
+
+type ReplayResult struct {
+	Action  string `json:"action"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// handleReplay applies queued offline actions in order. Each action is
+// checked for conflicts (the document was filed or retagged meanwhile) and
+// then dispatched to its normal handler with the caller's cookies.
+func (app *App) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "not allowed", 405)
+		return
+	}
+	var req struct {
+		Actions []QueuedAction `json:"actions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON"})
+		return
+	}
+
+	results := make([]ReplayResult, 0, len(req.Actions))
+	for _, a := range req.Actions {
+		a.Action = strings.TrimPrefix(a.Action, app.config().BasePath)
+		res := ReplayResult{Action: a.Action, Name: a.Fields["name"]}
+		if !slices.Contains(replayable, a.Action) {
+			res.Status, res.Message = replayError, "action cannot be replayed"
+		} else if msg := app.replayConflict(r.Context(), a); msg != "" {
+			res.Status, res.Message = replayConflict, msg
+		} else {
+			res.Status, res.Message = app.dispatchQueued(r, a)
+		}
+		results = append(results, res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+// replayConflict reports why a queued action no longer applies, or "".
+func (app *App) replayConflict(ctx context.Context, a QueuedAction) string {
+	if a.Action == "/undo" {
+		return ""
+	}
+	ulid := a.Fields["ulid"]
+	if ulid == "" {
+		return ""
+	}
+	err := app.checkDocTags(ctx, ulid, a.SeenTags)
+	switch {
+	case err == nil:
+		return ""
+	case errs.KindOf(err) == errs.Conflict:
+		return "document tags changed since queued"
+	default:
+		return "document unavailable: " + errs.Message(err)
+	}
+}
+
+// dispatchQueued runs a queued action through the normal form handler and
+// reads the outcome from the flash message on its redirect, or from the
+// error banner it set. A failure is reported in the replay results, so its
+// banner is taken down again. The queue has usually moved on since the
+// action was queued, so its document is found by ULID rather than by the
+// position it had then.
+func (app *App) dispatchQueued(r *http.Request, a QueuedAction) (status, message string) {
+	form := url.Values{}
+	for k, v := range a.Fields {
+		form.Set(k, v)
+	}
+	app.mu.Lock()
+	sess := app.currentUser(r)
+	var banner *ErrorBanner
+	if sess != nil {
+		banner = sess.Banner
+		if ulid := form.Get("ulid"); ulid != "" && form.Has("pos") {
+			i := slices.IndexFunc(app.userQueue(sess), func(d GodocsDocument) bool { return d.ULID == ulid })
+			if i < 0 && a.Action == "/tag" {
+				app.mu.Unlock()
+				return replayConflict, "document is no longer in the inbox"
+			}
+			form.Set("pos", strconv.Itoa(max(i+1, 1)))
+		}
+	}
+	app.mu.Unlock()
+	req, err := http.NewRequestWithContext(r.Context(), "POST", a.Action, strings.NewReader(form.Encode()))
+	if err != nil {
+		return replayError, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range r.Cookies() {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	app.mux.ServeHTTP(rec, req)
+	if sess != nil {
+		app.mu.Lock()
+		failed := sess.Banner
+		sess.Banner = banner
+		app.mu.Unlock()
+		if failed != banner {
+			return replayError, failed.Message
+		}
+	}
+
+	loc, _ := url.Parse(rec.Header().Get("Location"))
+	if loc == nil || rec.Code >= 400 {
+		return replayError, http.StatusText(rec.Code)
+	}
+	if loc.Path == "/users" {
+		return replayError, "no user selected"
+	}
+	flash := loc.Query().Get("flash")
+	switch {
+	case strings.HasPrefix(flash, "Error"):
+		return replayError, flash
+	case strings.HasPrefix(flash, "Queue changed"):
+		return replayConflict, "document is no longer at its place in the inbox"
+	case flash == "" && a.Action != "/done":
+		// tagging and undo say what they did; without a flash the
+		// action was turned away
+		return replayError, "not applied"
+	}
+	return replayOK, flash
+}
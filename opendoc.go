@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+const (
+	quickOpenKey = "/" // reserved key to open a document by ULID or search
+	maxQuickOpen = 10  // results listed by the quick-open box
+)
+
+// QuickOpenResult is a document offered by the quick-open box.
+type QuickOpenResult struct {
+	ULID     string `json:"ulid"`
+	Name     string `json:"name"`
+	Folder   string `json:"folder,omitempty"`
+	Untagged bool   `json:"untagged"`
+}
+
+// handleOpenDoc (/doc/{ulid}) shows a document for tagging now rather than
+// in queue order. A document already in the user's queue is shown at its
+// position; any other, such as one filtered out by folder, snoozed or
+// already tagged, is opened at the front of the queue until it is done.
+func (app *App) handleOpenDoc(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid := r.PathValue("ulid")
+	if i := slices.IndexFunc(app.userQueue(sess), func(d GodocsDocument) bool { return d.ULID == ulid }); i >= 0 {
+		http.Redirect(w, r, "/?pos="+strconv.Itoa(i+1), http.StatusSeeOther)
+		return
+	}
+	doc := GodocsDocument{ULID: ulid}
+	if i := slices.IndexFunc(app.untagged, func(d GodocsDocument) bool { return d.ULID == ulid }); i >= 0 {
+		doc = app.untagged[i]
+	} else {
+		status, err := app.docs.FetchDocStatus(r.Context(), ulid)
+		if err != nil {
+			app.fail(w, r, sess, "/", false, errs.E(errs.Upstream, "open "+ulid, err))
+			return
+		}
+		doc.Name, doc.DocumentType, doc.IngressTime = status.Name, status.DocumentType, status.IngressTime
+	}
+	sess.Opened = &doc
+	pos := slices.IndexFunc(app.userQueue(sess), func(d GodocsDocument) bool { return d.ULID == ulid }) + 1
+	http.Redirect(w, r, "/?pos="+strconv.Itoa(pos)+"&flash=Opened "+doc.Name, http.StatusSeeOther)
+}
+
+// handleQuickOpen (/api/quick-open?q=) lists documents for the quick-open
+// box: untagged documents whose name contains q, then godocs search results.
+func (app *App) handleQuickOpen(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	results := []QuickOpenResult{}
+	w.Header().Set("Content-Type", "application/json")
+	if q == "" {
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+
+	app.mu.Lock()
+	sess := app.currentUser(r)
+	untagged := make(map[string]bool, len(app.untagged))
+	for _, d := range app.untagged {
+		untagged[d.ULID] = true
+	}
+	for _, d := range app.userQueue(sess) {
+		if len(results) < maxQuickOpen && strings.Contains(strings.ToLower(d.Name), strings.ToLower(q)) {
+			results = append(results, QuickOpenResult{ULID: d.ULID, Name: d.Name, Folder: d.Folder, Untagged: true})
+		}
+	}
+	app.mu.Unlock()
+
+	if len(results) < maxQuickOpen {
+		docs, err := app.docs.SearchDocuments(r.Context(), SearchQuery{Term: q}, maxQuickOpen)
+		if err != nil && len(results) == 0 {
+			writeError(w, errs.E(errs.Upstream, "search "+q, err))
+			return
+		} else if err != nil {
+			log.Printf("quick-open: %v", err)
+		}
+		for _, d := range docs {
+			if len(results) < maxQuickOpen && !slices.ContainsFunc(results, func(r QuickOpenResult) bool { return r.ULID == d.ULID }) {
+				results = append(results, QuickOpenResult{ULID: d.ULID, Name: d.Name, Folder: d.Folder, Untagged: untagged[d.ULID]})
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(results)
+}
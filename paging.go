@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"time"
+)
+
+// Code that walks every document of a tag, or the whole untagged queue,
+// ranges over IterateDocuments or IterateUntagged rather than looping over
+// pages itself. The next page is fetched only when the caller reaches it,
+// at most one page per godocs_http.page_interval_ms so a backfill does not
+// crowd out the inbox's own requests, and cancelling ctx ends the walk.
+
+const (
+	iteratePageSize     = 100
+	defaultPageInterval = 100 * time.Millisecond
+)
+
+// IterateDocuments yields the documents carrying tagID. An error ends the
+// sequence, yielded with a zero document; so does ctx being done.
+func (c *GodocsClient) IterateDocuments(ctx context.Context, tagID int) iter.Seq2[GodocsDocument, error] {
+	return c.iterate(ctx, func(page int) (*GodocsSearchResponse, error) {
+		return c.FetchTagged(ctx, tagID, page, iteratePageSize)
+	})
+}
+
+// IterateUntagged yields the untagged documents, as IterateDocuments does.
+func (c *GodocsClient) IterateUntagged(ctx context.Context) iter.Seq2[GodocsDocument, error] {
+	return c.iterate(ctx, func(page int) (*GodocsSearchResponse, error) {
+		return c.fetchUntagged(ctx, page, iteratePageSize)
+	})
+}
+
+// iterate yields the documents of each page from fetch in turn, waiting
+// c.pageInterval between requests.
+func (c *GodocsClient) iterate(ctx context.Context, fetch func(page int) (*GodocsSearchResponse, error)) iter.Seq2[GodocsDocument, error] {
+	return func(yield func(GodocsDocument, error) bool) {
+		var last time.Time
+		for page := 1; ; page++ {
+			if wait := c.pageInterval - time.Since(last); page > 1 && wait > 0 {
+				select {
+				case <-ctx.Done():
+					yield(GodocsDocument{}, ctx.Err())
+					return
+				case <-time.After(wait):
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				yield(GodocsDocument{}, err)
+				return
+			}
+			last = time.Now()
+			sr, err := fetch(page)
+			if err != nil {
+				yield(GodocsDocument{}, err)
+				return
+			}
+			for _, doc := range sr.Documents {
+				if !yield(doc, nil) {
+					return
+				}
+			}
+			if len(sr.Documents) == 0 || (!sr.HasNext && page >= sr.TotalPages) {
+				return
+			}
+		}
+	}
+}
+
+// fetchUntagged is FetchUntagged bound to ctx.
+func (c *GodocsClient) fetchUntagged(ctx context.Context, page, pageSize int) (*GodocsSearchResponse, error) {
+	url := fmt.Sprintf("%s/api/documents/untagged?page=%d&pageSize=%d", c.baseURL, page, pageSize)
+	resp, err := c.getWithContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("fetching untagged: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetching untagged: status %d", resp.StatusCode)
+	}
+	var sr GodocsSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return nil, fmt.Errorf("decoding untagged: %w", err)
+	}
+	return &sr, nil
+}
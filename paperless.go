@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// Paperless-ngx's document exporter writes the originals plus a
+// manifest.json of Django fixtures. Correspondents and document types have
+// no godocs equivalent, so they become tags in their own tag groups.
+
+const (
+	defaultCorrespondentGroup = "correspondent"
+	paperlessTagColor         = "#a6cee3" // Paperless's default tag colour
+	paperlessManifest         = "manifest.json"
+)
+
+// Paperless fixture models.
+const (
+	paperlessModelTag           = "documents.tag"
+	paperlessModelCorrespondent = "documents.correspondent"
+	paperlessModelDocumentType  = "documents.documenttype"
+	paperlessModelDocument      = "documents.document"
+)
+
+// PaperlessConfig maps Paperless-ngx metadata onto godocs tag groups for
+// `paperless import` and `paperless export`.
+type PaperlessConfig struct {
+	CorrespondentGroup string `yaml:"correspondent_group,omitempty"` // default "correspondent"
+	DocumentTypeGroup  string `yaml:"document_type_group,omitempty"` // default the doctype group
+	TagGroup           string `yaml:"tag_group,omitempty"`           // group for Paperless tags (default none)
+}
+
+func (p PaperlessConfig) correspondentGroup() string {
+	if p.CorrespondentGroup != "" {
+		return p.CorrespondentGroup
+	}
+	return defaultCorrespondentGroup
+}
+
+func (p PaperlessConfig) documentTypeGroup() string {
+	if p.DocumentTypeGroup != "" {
+		return p.DocumentTypeGroup
+	}
+	return docTypeGroup
+}
+
+type paperlessRecord struct {
+	Model        string          `json:"model"`
+	PK           int             `json:"pk"`
+	Fields       json.RawMessage `json:"fields"`
+	ExportedFile string          `json:"__exported_file_name__,omitempty"`
+}
+
+// paperlessNamed is the fields of a tag, correspondent or document type.
+type paperlessNamed struct {
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"` // tags only
+}
+
+type paperlessDocument struct {
+	Title            string `json:"title"`
+	Content          string `json:"content"`
+	Created          string `json:"created"`
+	Added            string `json:"added,omitempty"`
+	MimeType         string `json:"mime_type"`
+	Checksum         string `json:"checksum"` // MD5 of the original
+	OriginalFilename string `json:"original_filename,omitempty"`
+	StorageType      string `json:"storage_type,omitempty"`
+	Correspondent    *int   `json:"correspondent"`
+	DocumentType     *int   `json:"document_type"`
+	Tags             []int  `json:"tags"`
+}
+
+// runPaperlessImport uploads the documents of a Paperless-ngx export to
+// godocs with their tags, correspondent, document type, date and text.
+// Documents whose contents are already in the state database's hashes
+// (imported before, or seen by `dupes scan`) are skipped, so an interrupted
+// import can be re-run.
+func runPaperlessImport(cfg Config, dir string, out io.Writer) error {
+	b, err := os.ReadFile(filepath.Join(dir, paperlessManifest))
+	if err != nil {
+		return fmt.Errorf("reading Paperless export: %w", err)
+	}
+	var records []paperlessRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		return fmt.Errorf("decoding %s: %w", paperlessManifest, err)
+	}
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	st, err := store.Open(cfg.statePath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	tags, err := client.FetchTags()
+	if err != nil {
+		return err
+	}
+	// An existing tag is reused when its name matches; Paperless tags have
+	// no group, so without tag_group they match a tag in any group.
+	created := 0
+	ensureTag := func(name, color, group string) (int, error) {
+		for _, t := range tags {
+			if strings.EqualFold(t.Name, name) && (group == "" || t.TagGroup == group) {
+				return t.ID, nil
+			}
+		}
+		if !strings.HasPrefix(color, "#") {
+			color = paperlessTagColor
+		}
+		t, err := client.CreateTag(name, color, group)
+		if err != nil {
+			return 0, fmt.Errorf("creating tag %s: %w", name, err)
+		}
+		tags = append(tags, *t)
+		created++
+		return t.ID, nil
+	}
+
+	// godocs tag ID for each Paperless tag, correspondent and document type
+	groups := map[string]string{
+		paperlessModelTag:           cfg.Paperless.TagGroup,
+		paperlessModelCorrespondent: cfg.Paperless.correspondentGroup(),
+		paperlessModelDocumentType:  cfg.Paperless.documentTypeGroup(),
+	}
+	tagIDs := make(map[string]map[int]int)
+	var docs []paperlessRecord
+	for _, rec := range records {
+		if rec.Model == paperlessModelDocument {
+			docs = append(docs, rec)
+			continue
+		}
+		group, ok := groups[rec.Model]
+		if !ok {
+			continue
+		}
+		var f paperlessNamed
+		if err := json.Unmarshal(rec.Fields, &f); err != nil {
+			return fmt.Errorf("%s %d: %w", rec.Model, rec.PK, err)
+		}
+		id, err := ensureTag(f.Name, f.Color, group)
+		if err != nil {
+			return err
+		}
+		if tagIDs[rec.Model] == nil {
+			tagIDs[rec.Model] = make(map[int]int)
+		}
+		tagIDs[rec.Model][rec.PK] = id
+	}
+
+	known := make(map[string]bool)
+	hashes, err := st.Hashes()
+	if err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		known[h.SHA256] = true
+	}
+
+	imported, skipped, failed := 0, 0, 0
+	for _, rec := range docs {
+		var d paperlessDocument
+		if err := json.Unmarshal(rec.Fields, &d); err != nil {
+			return fmt.Errorf("%s %d: %w", rec.Model, rec.PK, err)
+		}
+		name := d.OriginalFilename
+		if name == "" {
+			name = d.Title + filepath.Ext(rec.ExportedFile)
+		}
+		fail := func(err error) {
+			fmt.Fprintf(out, "  %s: %v\n", name, err)
+			failed++
+		}
+
+		path := filepath.Join(dir, rec.ExportedFile)
+		sum, err := fileSHA256(path)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if known[sum] {
+			skipped++
+			continue
+		}
+		opts := CreateOptions{Name: name, Text: d.Content}
+		if len(d.Created) >= 10 {
+			opts.Date = d.Created[:10]
+		}
+		var ids []int
+		if d.Correspondent != nil {
+			ids = append(ids, tagIDs[paperlessModelCorrespondent][*d.Correspondent])
+		}
+		if d.DocumentType != nil {
+			ids = append(ids, tagIDs[paperlessModelDocumentType][*d.DocumentType])
+		}
+		for _, pk := range d.Tags {
+			ids = append(ids, tagIDs[paperlessModelTag][pk])
+		}
+		opts.TagIDs = slices.DeleteFunc(ids, func(id int) bool { return id == 0 }) // metadata missing from the manifest
+
+		doc, err := client.CreateDocument(ctx, path, opts)
+		if doc == nil {
+			fail(err)
+			continue
+		}
+		known[sum] = true
+		if err := st.PutHash(store.DocHash{ULID: doc.ULID, Name: name, SHA256: sum}); err != nil {
+			return err
+		}
+		if err != nil {
+			fail(err)
+		}
+		imported++
+	}
+	fmt.Fprintf(out, "Imported %d documents (%d already present, %d errors), created %d tags\n", imported, skipped, failed, created)
+	return nil
+}
+
+// runPaperlessExport writes every godocs document, tagged and untagged, with
+// a Paperless-ngx manifest.json, so `document_importer` can load it. Tags in
+// the correspondent and document type groups become correspondents and
+// document types; a document keeps the first of each.
+func runPaperlessExport(cfg Config, dir string, out io.Writer) error {
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tags, err := client.FetchTags()
+	if err != nil {
+		return err
+	}
+
+	var records []paperlessRecord
+	addRecord := func(model string, pk int, fields any) {
+		b, _ := json.Marshal(fields)
+		records = append(records, paperlessRecord{Model: model, PK: pk, Fields: b})
+	}
+	models := make(map[int]string) // godocs tag ID → Paperless model
+	for _, t := range tags {
+		model := paperlessModelTag
+		switch t.TagGroup {
+		case cfg.Paperless.correspondentGroup():
+			model = paperlessModelCorrespondent
+		case cfg.Paperless.documentTypeGroup():
+			model = paperlessModelDocumentType
+		}
+		models[t.ID] = model
+		f := paperlessNamed{Name: t.Name}
+		if model == paperlessModelTag {
+			f.Color = t.Color
+		}
+		addRecord(model, t.ID, f)
+	}
+
+	// Documents come from walking each tag's document list, then the inbox
+	ctx := context.Background()
+	docTags := make(map[string][]int)
+	var order []GodocsDocument
+	for _, t := range tags {
+		for doc, err := range client.IterateDocuments(ctx, t.ID) {
+			if err != nil {
+				return fmt.Errorf("listing tag %s: %w", t.Name, err)
+			}
+			if _, seen := docTags[doc.ULID]; !seen {
+				order = append(order, doc)
+			}
+			docTags[doc.ULID] = append(docTags[doc.ULID], t.ID)
+		}
+	}
+	for doc, err := range client.IterateUntagged(ctx) {
+		if err != nil {
+			return fmt.Errorf("listing untagged: %w", err)
+		}
+		if _, seen := docTags[doc.ULID]; !seen {
+			docTags[doc.ULID] = nil
+			order = append(order, doc)
+		}
+	}
+
+	exported, failed := 0, 0
+	for i, doc := range order {
+		pk := i + 1
+		fileName := fmt.Sprintf("%07d%s", pk, doc.DocumentType)
+		sum, err := exportDocument(client, doc.ULID, doc.DocumentType, filepath.Join(dir, fileName))
+		if err != nil {
+			fmt.Fprintf(out, "  %s: %v\n", doc.Name, err)
+			failed++
+			continue
+		}
+
+		d := paperlessDocument{
+			Title:            strings.TrimSuffix(doc.Name, filepath.Ext(doc.Name)),
+			Created:          doc.IngressTime,
+			Added:            doc.IngressTime,
+			MimeType:         mimeType(doc.DocumentType),
+			Checksum:         sum,
+			OriginalFilename: doc.Name,
+			StorageType:      "unencrypted",
+			Tags:             []int{},
+		}
+		if status, err := client.FetchDocStatus(ctx, doc.ULID); err == nil && status.DocumentDate != "" {
+			d.Created = status.DocumentDate
+		}
+		if len(d.Created) == len("2006-01-02") {
+			d.Created += "T00:00:00Z"
+		}
+		if text, err := client.FetchDocText(ctx, doc.ULID); err == nil {
+			d.Content = text
+		}
+		for _, id := range docTags[doc.ULID] {
+			switch models[id] {
+			case paperlessModelCorrespondent:
+				if d.Correspondent == nil {
+					d.Correspondent = &id
+				}
+			case paperlessModelDocumentType:
+				if d.DocumentType == nil {
+					d.DocumentType = &id
+				}
+			default:
+				d.Tags = append(d.Tags, id)
+			}
+		}
+		b, _ := json.Marshal(d)
+		records = append(records, paperlessRecord{Model: paperlessModelDocument, PK: pk, Fields: b, ExportedFile: fileName})
+		exported++
+	}
+
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, paperlessManifest), b, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Exported %d documents and %d tags to %s (%d failed)\n", exported, len(tags), dir, failed)
+	return nil
+}
+
+// exportDocument downloads a document to path and returns its MD5, the
+// checksum Paperless verifies on import.
+func exportDocument(client DocumentStore, ulid, docType, path string) (string, error) {
+	tmpPath, err := client.DownloadDocument(ulid, "godocs-export-*"+docType, 0)
+	if err != nil {
+		return "", err
+	}
+	defer scratch.release(tmpPath)
+	src, err := os.Open(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.New()
+	_, err = io.Copy(io.MultiWriter(dst, sum), src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("writing %s: %w", path, err)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func mimeType(ext string) string {
+	t, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if t == "" {
+		return "application/octet-stream"
+	}
+	return t
+}
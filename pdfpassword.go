@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+)
+
+// Encrypted PDFs are opened with the pdf_passwords from config, then with a
+// password entered for that document on the inbox page. Entered passwords
+// are held in memory only, until OCR of the document succeeds.
+
+// pdfPasswords returns the passwords to try for ulid, the document's own first.
+func (app *App) pdfPasswords(ulid string) []string {
+	app.processingMu.Lock()
+	pw, ok := app.docPasswords[ulid]
+	app.processingMu.Unlock()
+	if !ok {
+		return app.config().PDFPasswords
+	}
+	return append([]string{pw}, app.config().PDFPasswords...)
+}
+
+func (app *App) forgetPDFPassword(ulid string) {
+	app.processingMu.Lock()
+	delete(app.docPasswords, ulid)
+	app.processingMu.Unlock()
+}
+
+// NeedsPassword reports whether the job failed on an encrypted PDF.
+func (f *JobFailure) NeedsPassword() bool {
+	return f.Stage == pipelineOCR && strings.Contains(f.Error, ocr.ErrPasswordRequired.Error())
+}
+
+// handlePDFPassword retries OCR of an encrypted PDF with a password entered
+// on the inbox page.
+func (app *App) handlePDFPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	sess := app.requireUser(w, r)
+	app.mu.Unlock()
+	if sess == nil {
+		return
+	}
+
+	ulid, name, pos := r.FormValue("ulid"), r.FormValue("name"), r.FormValue("pos")
+	pw := r.FormValue("password")
+	if ulid == "" || pw == "" {
+		http.Redirect(w, r, "/?pos="+pos+"&flash=No password given", http.StatusSeeOther)
+		return
+	}
+	app.processingMu.Lock()
+	app.docPasswords[ulid] = pw
+	app.processingMu.Unlock()
+
+	flash := "Nothing to retry"
+	if app.retryJob(ulid) != "" {
+		flash = "Trying password for " + name
+	}
+	http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+}
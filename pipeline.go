@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+)
+
+// Pipeline stages that can be toggled in config.
+const (
+	pipelineOCR          = "ocr"
+	pipelineDate         = "date_inference"
+	pipelineClassify     = "classify"
+	pipelineHiresThumbs  = "hires_thumbnails"
+	pipelineDuplicates   = "duplicates"
+	pipelineSuggestions  = "suggestions"
+	pipelineSummary      = "summary"
+	pipelineLanguage     = "language"
+	pipelineTagProposals = "tag_proposals"
+)
+
+var pipelineStages = []string{pipelineOCR, pipelineDate, pipelineClassify, pipelineHiresThumbs, pipelineDuplicates, pipelineSuggestions, pipelineSummary, pipelineLanguage, pipelineTagProposals}
+
+// Routes: how the OCR stage gets a document's text, by type.
+const (
+	routeOCR     = "ocr"      // tesseract, on the first page of a PDF
+	routePDFText = "pdf_text" // a PDF's text layer, OCR'd if it has none
+	routeText    = "text"     // read directly: plain text, HTML, Word and OpenDocument
+	routeMail    = "mail"     // an email's headers, body and attachments
+	routeManual  = "manual"   // no extraction; tagged for manual handling
+)
+
+var pipelineRoutes = []string{routeOCR, routePDFText, routeText, routeMail, routeManual}
+
+// defaultRoutes is the routing table for types pipeline.routes leaves out.
+// Types in neither go to routeManual.
+var defaultRoutes = map[string]string{
+	".pdf":  routePDFText,
+	".png":  routeOCR,
+	".jpg":  routeOCR,
+	".jpeg": routeOCR,
+	".tiff": routeOCR,
+	".bmp":  routeOCR,
+	".txt":  routeText,
+	".html": routeText,
+	".htm":  routeText,
+	".docx": routeText,
+	".odt":  routeText,
+	".eml":  routeMail,
+}
+
+const (
+	defaultManualTag = "needs manual handling"
+	manualTagColor   = "#e67e22"
+	// minPDFText is the shortest text layer taken as a PDF's text; less is
+	// a scan's stray marks, and the page is OCR'd
+	minPDFText = 20
+)
+
+// PipelineConfig enables or disables background processing stages. Stages
+// not listed are enabled. Types overrides stages per document type, keyed by
+// extension (".txt" or "txt"). Routes overrides defaultRoutes, and
+// ManualTag names the tag for types routed to routeManual:
+//
+//	pipeline:
+//	  date_inference: false
+//	  types:
+//	    .txt: {ocr: false}
+//	  routes:
+//	    .pdf: ocr
+//	    .xlsx: manual
+type PipelineConfig struct {
+	Stages    map[string]bool            `yaml:",inline"`
+	Types     map[string]map[string]bool `yaml:"types,omitempty"`
+	Routes    map[string]string          `yaml:"routes,omitempty"`
+	ManualTag string                     `yaml:"manual_tag,omitempty"` // default "needs manual handling"
+}
+
+// stageEnabled reports whether stage should run for a document of docType.
+func (p PipelineConfig) stageEnabled(stage, docType string) bool {
+	if docType != "" {
+		if on, ok := p.Types[normalizeDocType(docType)][stage]; ok {
+			return on
+		}
+	}
+	if on, ok := p.Stages[stage]; ok {
+		return on
+	}
+	return true
+}
+
+func normalizeDocType(t string) string {
+	t = strings.ToLower(t)
+	if t != "" && !strings.HasPrefix(t, ".") {
+		t = "." + t
+	}
+	return t
+}
+
+// validate checks stage names and normalises the type keys.
+func (p *PipelineConfig) validate() error {
+	check := func(stages map[string]bool, where string) error {
+		for s := range stages {
+			if !slices.Contains(pipelineStages, s) {
+				return fmt.Errorf("pipeline%s: unknown stage %q (known: %s)", where, s, strings.Join(pipelineStages, ", "))
+			}
+		}
+		return nil
+	}
+	if err := check(p.Stages, ""); err != nil {
+		return err
+	}
+	types := make(map[string]map[string]bool, len(p.Types))
+	for t, stages := range p.Types {
+		if err := check(stages, " type "+t); err != nil {
+			return err
+		}
+		types[normalizeDocType(t)] = stages
+	}
+	p.Types = types
+	routes := make(map[string]string, len(p.Routes))
+	for t, r := range p.Routes {
+		if !slices.Contains(pipelineRoutes, r) {
+			return fmt.Errorf("pipeline routes: %s has unknown route %q (known: %s)", t, r, strings.Join(pipelineRoutes, ", "))
+		}
+		routes[normalizeDocType(t)] = r
+	}
+	p.Routes = routes
+	return nil
+}
+
+// route returns how the OCR stage gets the text of a document of docType.
+func (p PipelineConfig) route(docType string) string {
+	t := normalizeDocType(docType)
+	if r, ok := p.Routes[t]; ok {
+		return r
+	}
+	if r, ok := defaultRoutes[t]; ok {
+		return r
+	}
+	return routeManual
+}
+
+func (p PipelineConfig) manualTag() string {
+	if p.ManualTag != "" {
+		return p.ManualTag
+	}
+	return defaultManualTag
+}
+
+// stageEnabled is PipelineConfig.stageEnabled, with the OCR stage off for
+// types whose route needs a tool the startup probe did not find.
+func (app *App) stageEnabled(stage, docType string) bool {
+	if stage == pipelineOCR && !app.canExtract(docType) {
+		return false
+	}
+	return app.config().Pipeline.stageEnabled(stage, docType)
+}
+
+// extractText gets the text of the downloaded document at path along its
+// type's route.
+func (app *App) extractText(ctx context.Context, ulid, path, docType string) (ocr.Result, error) {
+	passwords := app.pdfPasswords(ulid)
+	switch route := app.config().Pipeline.route(docType); route {
+	case routeOCR:
+		return ocr.OCR(ctx, path, docType, passwords...)
+	case routePDFText:
+		if !app.hasTool("pdftotext") {
+			return ocr.OCR(ctx, path, docType, passwords...)
+		}
+		res, err := ocr.PDFText(ctx, path, passwords...)
+		switch {
+		case errors.Is(err, ocr.ErrPasswordRequired):
+			return res, err
+		case err != nil:
+			log.Printf("OCR: reading the text layer of %s failed (%v); OCR'ing it", ulid, err)
+		case len(res.Text) >= minPDFText:
+			log.Printf("OCR: read the text layer of %s", ulid)
+			return res, nil
+		case !app.hasTool("tesseract", "pdftoppm"):
+			if err == nil && res.Text != "" {
+				return res, nil
+			}
+			return res, fmt.Errorf("%s has no text layer, and OCR needs tesseract and pdftoppm", ulid)
+		}
+		return ocr.OCR(ctx, path, docType, passwords...)
+	case routeText, routeMail:
+		return ocr.ReadText(ctx, path, docType, passwords...)
+	default:
+		return ocr.Result{}, fmt.Errorf("%s documents are routed to %s handling", docType, route)
+	}
+}
+
+// tagForManualHandling adds the manual handling tag to a document whose
+// type has no route to its text, creating the tag if needed. The document
+// leaves the inbox at the next sync.
+func (app *App) tagForManualHandling(ulid, docType string) {
+	app.mu.Lock()
+	tag, err := app.ensureManualTag()
+	app.mu.Unlock()
+	if err == nil {
+		err = app.docs.AddTag(ulid, tag.ID)
+	}
+	if err != nil {
+		app.pipelineErrorf("OCR", ulid, "tagging %s for manual handling failed: %v", ulid, err)
+		app.mu.Lock()
+		delete(app.manualHandling, ulid) // tried again when next shown
+		app.mu.Unlock()
+		return
+	}
+	log.Printf("OCR: no route to the text of %s documents; tagged %s %q", docType, ulid, tag.Name)
+}
+
+// ensureManualTag returns the manual handling tag, creating it on the
+// server if needed. Callers must hold app.mu.
+func (app *App) ensureManualTag() (*GodocsTag, error) {
+	name := app.config().Pipeline.manualTag()
+	for _, t := range app.docs.KnownTags() {
+		if strings.EqualFold(t.Name, name) {
+			return &t, nil
+		}
+	}
+	return app.docs.CreateTag(name, manualTagColor, "")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// errCancelled is recorded as the failure of a job cancelled from the
+// processing page, so it is not restarted until retried.
+var errCancelled = errors.New("cancelled")
+
+// docJob is a running OCR/LLM job for one document.
+type docJob struct {
+	Stage   string // stageOCR, stageLLM or stageRotate
+	DocType string
+	Started time.Time
+	cancel  context.CancelFunc
+}
+
+// beginJob registers a job for ulid and returns the context it runs under.
+// Callers must hold processingMu.
+func (app *App) beginJob(ulid, stage, docType string) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	app.docStage[ulid] = &docJob{Stage: stage, DocType: docType, Started: time.Now(), cancel: cancel}
+	pipelineLog.Printf("processing: %s started for %s", stage, ulid)
+	return ctx
+}
+
+func (app *App) endJob(ulid string) {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	if job := app.docStage[ulid]; job != nil {
+		job.cancel()
+		delete(app.docStage, ulid)
+		pipelineLog.Printf("processing: %s ended for %s after %s", job.Stage, ulid, time.Since(job.Started).Round(time.Millisecond))
+	}
+}
+
+func (app *App) setJobStage(ulid, stage string) {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	if job := app.docStage[ulid]; job != nil {
+		job.Stage = stage
+		pipelineLog.Printf("processing: %s for %s", stage, ulid)
+	}
+}
+
+// jobStage returns the stage of the running job for ulid, or "".
+func (app *App) jobStage(ulid string) string {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	if job := app.docStage[ulid]; job != nil {
+		return job.Stage
+	}
+	return ""
+}
+
+// cancelJob stops the running job for ulid at its next step. It reports
+// whether there was a job to cancel.
+func (app *App) cancelJob(ulid string) bool {
+	app.processingMu.Lock()
+	defer app.processingMu.Unlock()
+	job := app.docStage[ulid]
+	if job == nil {
+		return false
+	}
+	job.cancel()
+	pipelineLog.Printf("processing: cancelled %s for %s", job.Stage, ulid)
+	return true
+}
+
+// ProcessingRow is a running or failed background job on the processing page.
+type ProcessingRow struct {
+	ULID     string
+	Name     string
+	Stage    string
+	Running  bool
+	Elapsed  time.Duration // running jobs
+	Attempts int           // failed jobs
+	Error    string
+	Time     time.Time // when the job started or last failed
+}
+
+type ProcessingPageData struct {
+	Page    string
+	User    string
+	Rows    []ProcessingRow
+	Running int
+	AutoTag *AutoTagRun  // last auto-tagging sweep, if it is on
+	Ingest  []*IngestRun // last poll of each ingestion source
+	DryRun  []DryRunEntry
+	IsDry   bool // a dry run, changing nothing in godocs
+	Flash   string
+}
+
+// handleProcessing lists running and failed OCR/LLM jobs (GET) and cancels
+// or retries one (POST).
+func (app *App) handleProcessing(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		ulid := r.FormValue("ulid")
+		flash := "Nothing to do"
+		switch r.FormValue("action") {
+		case "cancel":
+			if app.cancelJob(ulid) {
+				flash = "Cancelling " + ulid
+			}
+		case "retry":
+			if stage := app.retryJob(ulid); stage != "" {
+				flash = "Retrying " + stage + " for " + ulid
+			}
+		}
+		http.Redirect(w, r, "/processing?flash="+flash, http.StatusSeeOther)
+		return
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	data := ProcessingPageData{Page: "processing", AutoTag: app.autoTagLast, Ingest: app.ingestRuns(), Flash: r.URL.Query().Get("flash")}
+	if sess := app.currentUser(r); sess != nil {
+		data.User = sess.Name
+	}
+	if dry := app.dryRun(); dry != nil {
+		data.IsDry, data.DryRun = true, dry.Would()
+	}
+	names := make(map[string]string, len(app.untagged))
+	for _, doc := range app.untagged {
+		names[doc.ULID] = doc.Name
+	}
+
+	now := time.Now()
+	app.processingMu.Lock()
+	for ulid, job := range app.docStage {
+		data.Rows = append(data.Rows, ProcessingRow{
+			ULID: ulid, Name: names[ulid], Stage: job.Stage, Running: true,
+			Elapsed: now.Sub(job.Started).Round(time.Second), Time: job.Started,
+		})
+	}
+	for ulid, f := range app.failures {
+		if app.docStage[ulid] != nil {
+			continue
+		}
+		data.Rows = append(data.Rows, ProcessingRow{
+			ULID: ulid, Name: names[ulid], Stage: f.Stage, Attempts: f.Attempts, Error: f.Error, Time: f.Time,
+		})
+	}
+	app.processingMu.Unlock()
+
+	// Running jobs first, longest-running first; then the latest failures
+	sort.Slice(data.Rows, func(i, j int) bool {
+		a, b := data.Rows[i], data.Rows[j]
+		if a.Running != b.Running {
+			return a.Running
+		}
+		if a.Running {
+			return a.Time.Before(b.Time)
+		}
+		return a.Time.After(b.Time)
+	})
+	for _, row := range data.Rows {
+		if row.Running {
+			data.Running++
+		}
+	}
+
+	app.templates().ExecuteTemplate(w, "processing.html", data)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ProfileConfig is one godocs server with its own tags and LLM settings, so
+// one inbox can triage several servers (e.g. home and work). Fields left
+// unset are taken from the top level of the config; the listener settings
+// (addr, base_path, TLS, limits) and webhooks are shared.
+//
+//	profiles:
+//	  - name: home
+//	    godocs_server: http://nas:8000
+//	    tags: [{key: b, tag_id: 3}]
+//	  - name: work
+//	    godocs_server: https://docs.example.com
+//	    tags: [{key: i, tag_id: 12}]
+//	    ollama_model: llama3.1:8b
+type ProfileConfig struct {
+	Name            string             `yaml:"name"`
+	GodocsServer    string             `yaml:"godocs_server,omitempty"`
+	GodocsTLS       GodocsTLSConfig    `yaml:"godocs_tls,omitempty"`
+	GodocsHTTP      GodocsHTTPConfig   `yaml:"godocs_http,omitempty"`
+	GodocsHookToken string             `yaml:"godocs_hook_token,omitempty"`
+	Shortcuts       []ShortcutConfig   `yaml:"tags,omitempty"`
+	Presets         []PresetConfig     `yaml:"presets,omitempty"`
+	Layers          []ShortcutLayer    `yaml:"layers,omitempty"`
+	RequiredGroups  []string           `yaml:"required_groups,omitempty"`
+	TagActions      []TagActionConfig  `yaml:"tag_actions,omitempty"`
+	AutoTag         AutoTagConfig      `yaml:"auto_tag,omitempty"`
+	QuickSort       []QuickSortBucket  `yaml:"quick_sort,omitempty"`
+	DailyGoal       int                `yaml:"daily_goal,omitempty"`
+	S3              S3Config           `yaml:"s3,omitempty"`
+	CloudDrives     []CloudDriveConfig `yaml:"cloud_drives,omitempty"`
+	Users           []UserConfig       `yaml:"users,omitempty"`
+	Expenses        ExpenseConfig      `yaml:"expenses,omitempty"`
+	OllamaURL       string             `yaml:"ollama_url,omitempty"`
+	OllamaModel     string             `yaml:"ollama_model,omitempty"`
+	Models          ModelsConfig       `yaml:"models,omitempty"`
+	Languages       LanguageConfig     `yaml:"languages,omitempty"`
+	EmbeddingModel  string             `yaml:"embedding_model,omitempty"`
+	DocTypes        []string           `yaml:"doc_types,omitempty"`
+}
+
+// ProfileLink is an entry in the nav bar's profile switcher.
+type ProfileLink struct {
+	Name    string
+	URL     string
+	Current bool
+}
+
+// validProfileName limits names to what is safe in a URL path and a
+// directory name.
+func validProfileName(name string) bool {
+	return name != "" && strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") == ""
+}
+
+// profileConfigs returns the config of each profile to serve: every
+// profile, or only the one named by -profile. Without profiles it is the
+// config itself.
+func (c Config) profileConfigs(only string) ([]Config, error) {
+	if len(c.Profiles) == 0 {
+		if only != "" {
+			return nil, fmt.Errorf("-profile %s: no profiles are configured in %s", only, configFileName)
+		}
+		return []Config{c}, nil
+	}
+	seen := make(map[string]bool)
+	var cfgs []Config
+	for _, p := range c.Profiles {
+		if !validProfileName(p.Name) {
+			return nil, fmt.Errorf("profiles: name %q must be letters, digits, - and _", p.Name)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("profiles: %s is configured twice", p.Name)
+		}
+		seen[p.Name] = true
+		if only == "" || p.Name == only {
+			cfgs = append(cfgs, c.forProfile(p))
+		}
+	}
+	if len(cfgs) == 0 {
+		return nil, fmt.Errorf("-profile %s: no such profile in %s", only, configFileName)
+	}
+	return cfgs, nil
+}
+
+// forProfile returns the config for profile p: the top-level config with
+// p's settings laid over it. Shortcuts, presets, layers and users are
+// copied, as their tag names are filled in from each profile's own server.
+func (c Config) forProfile(p ProfileConfig) Config {
+	c.Profile, c.Profiles = p.Name, nil
+	if p.GodocsServer != "" {
+		c.GodocsServer = p.GodocsServer
+	}
+	if p.GodocsTLS != (GodocsTLSConfig{}) {
+		c.GodocsTLS = p.GodocsTLS
+	}
+	if p.GodocsHTTP != (GodocsHTTPConfig{}) {
+		c.GodocsHTTP = p.GodocsHTTP
+	}
+	if p.GodocsHookToken != "" {
+		c.GodocsHookToken = p.GodocsHookToken
+	}
+	if len(p.Shortcuts) > 0 {
+		c.Shortcuts = p.Shortcuts
+	}
+	if len(p.Presets) > 0 {
+		c.Presets = p.Presets
+	}
+	if len(p.Layers) > 0 {
+		c.Layers = p.Layers
+	}
+	if len(p.RequiredGroups) > 0 {
+		c.RequiredGroups = p.RequiredGroups
+	}
+	if len(p.TagActions) > 0 {
+		c.TagActions = p.TagActions
+	}
+	if p.AutoTag.IntervalMinutes > 0 || len(p.AutoTag.Rules) > 0 {
+		c.AutoTag = p.AutoTag
+	}
+	if len(p.QuickSort) > 0 {
+		c.QuickSort = p.QuickSort
+	}
+	if p.DailyGoal > 0 {
+		c.DailyGoal = p.DailyGoal
+	}
+	// Not inherited: profiles sharing a bucket or folder would each upload
+	// its files
+	c.S3, c.CloudDrives = p.S3, p.CloudDrives
+	if len(p.Users) > 0 {
+		c.Users = p.Users
+	}
+	if len(p.Expenses.TagIDs) > 0 {
+		c.Expenses = p.Expenses
+	}
+	if p.OllamaURL != "" {
+		c.OllamaURL = p.OllamaURL
+	}
+	if p.OllamaModel != "" {
+		c.OllamaModel = p.OllamaModel
+	}
+	if p.Models.configured() || p.Models.Remote.URL != "" {
+		c.Models = p.Models
+	}
+	if len(p.Languages.TranslateTo) > 0 {
+		c.Languages = p.Languages
+	}
+	if p.EmbeddingModel != "" {
+		c.EmbeddingModel = p.EmbeddingModel
+	}
+	if len(p.DocTypes) > 0 {
+		c.DocTypes = p.DocTypes
+	}
+
+	c.Shortcuts = slices.Clone(c.Shortcuts)
+	c.Presets = slices.Clone(c.Presets)
+	c.Layers = slices.Clone(c.Layers)
+	for i := range c.Layers {
+		c.Layers[i].Shortcuts = slices.Clone(c.Layers[i].Shortcuts)
+	}
+	c.Users = slices.Clone(c.Users)
+	for i := range c.Users {
+		c.Users[i].Shortcuts = slices.Clone(c.Users[i].Shortcuts)
+		c.Users[i].Presets = slices.Clone(c.Users[i].Presets)
+	}
+	return c
+}
+
+// profileBasePath is where a profile is served when several are: under
+// /p/<name> below the configured base path.
+func profileBasePath(base, name string) string {
+	return base + "/p/" + name
+}
+
+// linkProfiles gives each app the profile switcher links.
+func linkProfiles(apps []*App) {
+	for _, app := range apps {
+		app.profiles = nil
+		for _, other := range apps {
+			app.profiles = append(app.profiles, ProfileLink{
+				Name:    other.config().Profile,
+				URL:     other.config().BasePath + "/",
+				Current: other == app,
+			})
+		}
+	}
+}
+
+// profilesHandler serves each app under its own base path, and redirects
+// the base path itself to the first profile.
+func profilesHandler(base string, apps []*App) (http.Handler, error) {
+	mux := http.NewServeMux()
+	for _, app := range apps {
+		h, err := app.routes()
+		if err != nil {
+			return nil, err
+		}
+		mux.Handle(app.config().BasePath+"/", h)
+		mux.Handle(app.config().BasePath, h)
+	}
+	mux.Handle(base+"/{$}", http.RedirectHandler(apps[0].config().BasePath+"/", http.StatusSeeOther))
+	if base != "" {
+		mux.Handle(base, http.RedirectHandler(apps[0].config().BasePath+"/", http.StatusSeeOther))
+	}
+	return mux, nil
+}
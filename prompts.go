@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+)
+
+// The LLM prompts are text/templates (see internal/llm/prompts.go) that can
+// be replaced per task, inline under prompts or as <task>.tmpl files in
+// prompt_dir, so they can be translated or tuned without a rebuild. Inline
+// prompts win over files. Templates can use {{.Text}}, {{.TagNames}},
+// {{.Groups}}, {{.Today}}, {{.DateOrder}}, and for classify {{.Types}} and translate
+// {{.Language}}:
+//
+//	prompts:
+//	  summary: |
+//	    Fasse das folgende Dokument in 2-3 kurzen Sätzen zusammen.
+//	    Antworte mit JSON der Form {"summary": "<Zusammenfassung>"}.
+//
+//	    Text:
+//	    {{.Text}}
+
+// loadPrompts parses the prompt templates from prompt_dir and prompts.
+func (c *Config) loadPrompts() error {
+	templates := make(map[string]string)
+	if c.PromptDir != "" {
+		files, err := filepath.Glob(filepath.Join(c.PromptDir, "*.tmpl"))
+		if err != nil {
+			return fmt.Errorf("prompt_dir: %w", err)
+		}
+		for _, f := range files {
+			b, err := os.ReadFile(f)
+			if err != nil {
+				return fmt.Errorf("prompt_dir: %w", err)
+			}
+			templates[strings.TrimSuffix(filepath.Base(f), ".tmpl")] = string(b)
+		}
+	}
+	maps.Copy(templates, c.Prompts)
+	p, err := llm.ParsePrompts(templates)
+	if err != nil {
+		return fmt.Errorf("prompts: %w", err)
+	}
+	c.prompts = p
+	return nil
+}
+
+// promptVars are the prompt template variables for a document's text.
+func (app *App) promptVars(text string) llm.PromptVars {
+	var names, groups []string
+	for _, t := range app.docs.KnownTags() {
+		names = append(names, t.Name)
+		if t.TagGroup != "" {
+			groups = append(groups, t.TagGroup)
+		}
+	}
+	slices.Sort(names)
+	slices.Sort(groups)
+	return llm.PromptVars{Text: text, TagNames: names, Groups: slices.Compact(groups), Today: app.now().Format("2006-01-02"), DateOrder: app.dateOrder()}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// Triage in two passes, as with a pile of post: a quick sort on /sort
+// drops each document into a bucket with one key, showing only its
+// thumbnail and name, and a detail pass (/?bucket=<tag_id>) then works
+// through one bucket in the inbox for full tagging. A bucket is a tag;
+// sorting adds it, so the document leaves the untagged queue, and done in
+// the detail pass removes it.
+//
+//	quick_sort:
+//	  - key: k
+//	    tag_id: 40   # keep
+//	  - key: a
+//	    tag_id: 41   # action
+//	  - key: t
+//	    tag_id: 42   # trash; a delete tag action empties it as it fills
+type QuickSortBucket struct {
+	Key   string `yaml:"key"`
+	TagID int    `yaml:"tag_id"`
+	Name  string `yaml:"-"` // the tag's name, set by validateQuickSort
+}
+
+// validateQuickSort checks that the bucket keys are single and distinct and
+// the tags exist, and names the buckets after their tags.
+func validateQuickSort(client DocumentStore, buckets []QuickSortBucket) error {
+	seen := map[string]bool{}
+	for i := range buckets {
+		b := &buckets[i]
+		if utf8.RuneCountInString(b.Key) != 1 {
+			return fmt.Errorf("quick_sort: key %q must be a single character", b.Key)
+		}
+		if seen[b.Key] {
+			return fmt.Errorf("quick_sort: key %q is used twice", b.Key)
+		}
+		seen[b.Key] = true
+		tag, ok := client.Tag(b.TagID)
+		if !ok {
+			return fmt.Errorf("quick_sort: tag_id %d not found on server", b.TagID)
+		}
+		b.Name = tag.Name
+	}
+	return nil
+}
+
+// bucket returns the quick sort bucket for a tag, or nil.
+func (app *App) bucket(tagID int) *QuickSortBucket {
+	buckets := app.config().QuickSort
+	i := slices.IndexFunc(buckets, func(b QuickSortBucket) bool { return b.TagID == tagID })
+	if i < 0 {
+		return nil
+	}
+	return &buckets[i]
+}
+
+// syncBuckets refreshes the documents in each bucket. It is part of
+// syncUntagged, so callers must hold app.mu.
+func (app *App) syncBuckets() {
+	for _, b := range app.config().QuickSort {
+		sr, err := app.docs.FetchTagged(context.Background(), b.TagID, 1, 10000)
+		if err != nil {
+			log.Printf("syncBuckets: %s: %v", b.Name, err)
+			continue
+		}
+		if app.buckets == nil {
+			app.buckets = make(map[int][]GodocsDocument)
+		}
+		app.buckets[b.TagID] = sr.Documents
+	}
+}
+
+// SortBucket is a bucket on the /sort page.
+type SortBucket struct {
+	QuickSortBucket
+	Count int // documents waiting for the detail pass
+}
+
+type SortPageData struct {
+	Page    string
+	User    string
+	Folder  string
+	Buckets []SortBucket
+	Docs    []QuickOpenResult // untagged queue, in order
+}
+
+// handleSort serves the quick sort page. The queue is sent with the page,
+// so the next document shows as soon as a key is pressed while the bucket
+// tag is added in the background through /api/sort.
+func (app *App) handleSort(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+	data := SortPageData{Page: "sort", User: sess.Name, Folder: sess.Folder}
+	for _, b := range app.config().QuickSort {
+		data.Buckets = append(data.Buckets, SortBucket{QuickSortBucket: b, Count: len(app.buckets[b.TagID])})
+	}
+	data.Docs = []QuickOpenResult{}
+	for _, d := range app.queue() {
+		if inFolder(sess, d) {
+			data.Docs = append(data.Docs, QuickOpenResult{ULID: d.ULID, Name: d.Name, Folder: d.Folder, Untagged: true})
+		}
+	}
+	app.templates().ExecuteTemplate(w, "sort.html", data)
+}
+
+// handleSortDoc (/api/sort) puts a document in the bucket for a key. The
+// document moves from the cached queue to the bucket here rather than by
+// a full sync, which would cost more than the sort itself.
+func (app *App) handleSortDoc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "not allowed", 405)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	var req struct {
+		ULID string `json:"ulid"`
+		Key  string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+	sess := app.currentUser(r)
+	if sess == nil {
+		writeError(w, errs.New(errs.Validation, "sort", "choose a user first"))
+		return
+	}
+	i := slices.IndexFunc(app.config().QuickSort, func(b QuickSortBucket) bool { return b.Key == req.Key })
+	j := slices.IndexFunc(app.untagged, func(d GodocsDocument) bool { return d.ULID == req.ULID })
+	if i < 0 || j < 0 {
+		writeError(w, errs.New(errs.Validation, "sort "+req.ULID, "no longer in the inbox, or no bucket for that key"))
+		return
+	}
+	b, doc := app.config().QuickSort[i], app.untagged[j]
+	if err := app.docs.AddTag(doc.ULID, b.TagID); err != nil {
+		writeError(w, errs.E(errs.Upstream, "sort "+doc.Name+" into "+b.Name, err))
+		return
+	}
+	sess.pushAction(&LastAction{DocULID: doc.ULID, DocName: doc.Name, TagID: b.TagID, TagName: b.Name})
+	sess.Stats.Tagged++
+	sess.record("sort "+b.Name, doc.ULID, doc.Name)
+	app.emitTagged(doc.ULID, doc.Name, sess.Name, b.Name)
+	app.journalTag(sess, actionTag, doc.ULID, doc.Name, TagSetEntry{ID: b.TagID, Name: b.Name})
+
+	before := len(app.untagged)
+	app.untagged = slices.Delete(slices.Clone(app.untagged), j, j+1)
+	if before > 0 && len(app.untagged) == 0 {
+		app.emit(Event{Type: eventInboxZero})
+	}
+	app.notifyCount(before, len(app.untagged))
+	done, deleted, err := app.runTagActions(r.Context(), sess, doc, b.TagID)
+	if !deleted {
+		if app.buckets == nil {
+			app.buckets = make(map[int][]GodocsDocument)
+		}
+		app.buckets[b.TagID] = append(app.buckets[b.TagID], doc)
+	}
+	if err != nil {
+		writeError(w, errs.E(errs.Upstream, "tag actions on "+doc.Name, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"bucket": b.Name, "count": len(app.buckets[b.TagID]), "done": done})
+}
+
+// finishDetail ends the detail pass on ulid by taking it out of sess's
+// bucket. It reports whether ulid was in the bucket. Callers must hold
+// app.mu.
+func (app *App) finishDetail(sess *UserSession, ulid, name string) (bool, error) {
+	b := app.bucket(sess.Bucket)
+	if b == nil || !slices.ContainsFunc(app.buckets[b.TagID], func(d GodocsDocument) bool { return d.ULID == ulid }) {
+		return false, nil
+	}
+	if err := app.docs.RemoveTag(ulid, b.TagID); err != nil {
+		return false, errs.E(errs.Upstream, "take "+name+" out of "+b.Name, err)
+	}
+	app.journalTag(sess, actionUntag, ulid, name, TagSetEntry{ID: b.TagID, Name: b.Name})
+	app.buckets[b.TagID] = slices.DeleteFunc(slices.Clone(app.buckets[b.TagID]), func(d GodocsDocument) bool { return d.ULID == ulid })
+	return true, nil
+}
+
+// bucketParam reads ?bucket= for the detail pass: a configured bucket's tag
+// ID, or 0 to go back to the inbox.
+func (app *App) bucketParam(v string) int {
+	id, _ := strconv.Atoi(v)
+	if app.bucket(id) == nil {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The config is reloaded without a restart on SIGHUP, or when the config
+// file changes (checked every configPollInterval). The new config is checked
+// as at startup, against the tags on godocs; if any of it is wrong the
+// running config is kept and the problems are logged and listed under
+// Recent Errors on the About page. Otherwise it replaces the running config
+// under app.mu: shortcuts, presets, layers and users (their sessions keep
+// their undo history), rules, tag actions, pipeline and LLM settings and
+// queue options take effect from the next request or document. Settings
+// that shape the running server — the godocs connection, listen address,
+// TLS, ingestion, MQTT, limits, thumbnails and log files — keep their old
+// values and are logged as needing a restart.
+
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads the config on SIGHUP or when its file changes.
+func (app *App) watchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	tick := time.NewTicker(configPollInterval)
+	defer tick.Stop()
+
+	last := configStamp(app.configFile)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("config: SIGHUP, reloading %s", app.configFile)
+		case <-tick.C:
+			stamp := configStamp(app.configFile)
+			if stamp == last {
+				continue
+			}
+			last = stamp
+			log.Printf("config: %s changed, reloading", app.configFile)
+		}
+		if err := app.reloadConfig(); err != nil {
+			app.pipelineErrorf("config", "", "reload failed, keeping the running config: %v", err)
+		}
+	}
+}
+
+// configStamp identifies a version of the config file by its modification
+// time and size, or is "" when it cannot be read.
+func configStamp(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", fi.ModTime().UnixNano(), fi.Size())
+}
+
+// reloadConfig reads and checks the config file and swaps it in, or returns
+// why it cannot and leaves the running config as it is.
+func (app *App) reloadConfig() error {
+	file, err := loadConfig(app.configFile)
+	if err != nil {
+		return err
+	}
+	cfgs, err := file.profileConfigs(app.config().Profile)
+	if err != nil {
+		return err
+	}
+	if len(cfgs) != 1 {
+		return errors.New("profiles were added; restart to serve them")
+	}
+	cfg := cfgs[0]
+
+	restart := keepServerSettings(*app.config(), &cfg)
+
+	tags, err := app.docs.FetchTags()
+	if err != nil {
+		return fmt.Errorf("connecting to godocs: %w", err)
+	}
+	if problems := checkConfig(&cfg, app.docs, tags, true); len(problems) > 0 {
+		return errors.Join(problems...)
+	}
+	warnConfigKeys(cfg)
+
+	app.mu.Lock()
+	app.conf.Store(&cfg)
+	app.applyUsers()
+	app.mu.Unlock()
+	log.Printf("config: reloaded %s", app.configFile)
+	if len(restart) > 0 {
+		log.Printf("config: restart to apply the changes to %s", strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+// keepServerSettings sets the settings of cfg that only take effect at
+// startup to those of the running config old. It returns the names of those
+// that the new config changes.
+func keepServerSettings(old Config, cfg *Config) (changed []string) {
+	// set at startup, or overridden by flags
+	cfg.Addr, cfg.BasePath, cfg.Debug, cfg.DryRun = old.Addr, old.BasePath, old.Debug, old.DryRun
+	cfg.localDir = old.localDir
+
+	keepSetting(&changed, "godocs_server", &cfg.GodocsServer, old.GodocsServer)
+	keepSetting(&changed, "godocs_tls", &cfg.GodocsTLS, old.GodocsTLS)
+	keepSetting(&changed, "godocs_http", &cfg.GodocsHTTP, old.GodocsHTTP)
+	keepSetting(&changed, "cache_ttl_seconds", &cfg.CacheTTLSeconds, old.CacheTTLSeconds)
+	keepSetting(&changed, "tls_cert", &cfg.TLSCert, old.TLSCert)
+	keepSetting(&changed, "tls_key", &cfg.TLSKey, old.TLSKey)
+	keepSetting(&changed, "tools", &cfg.ToolPaths, old.ToolPaths)
+	keepSetting(&changed, "mqtt", &cfg.MQTT, old.MQTT)
+	keepSetting(&changed, "s3", &cfg.S3, old.S3)
+	keepSetting(&changed, "cloud_drives", &cfg.CloudDrives, old.CloudDrives)
+	keepSetting(&changed, "limits", &cfg.Limits, old.Limits)
+	keepSetting(&changed, "thumbnails", &cfg.Thumbnails, old.Thumbnails)
+	keepSetting(&changed, "logs", &cfg.Logs, old.Logs)
+	// the auto-tagger's ticker is started once; its rules are reloaded
+	keepSetting(&changed, "auto_tag.interval_minutes", &cfg.AutoTag.IntervalMinutes, old.AutoTag.IntervalMinutes)
+	return changed
+}
+
+// keepSetting sets *v back to old, noting name if it differed.
+func keepSetting[T any](changed *[]string, name string, v *T, old T) {
+	if !reflect.DeepEqual(*v, old) {
+		*changed = append(*changed, name)
+		*v = old
+	}
+}
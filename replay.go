@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// -record captures every godocs API response to a fixture directory, and
+// -replay serves a fixture directory from a local mock godocs, so the inbox
+// runs offline against a recorded session. Each distinct request (method,
+// path and query, plus the body of writes) has one fixture file holding its
+// responses in the order they were recorded; replay serves them in that
+// order and then repeats the last.
+
+// fixture is the recorded exchange for one request key.
+type fixture struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Responses []fixtureResponse `json:"responses"`
+}
+
+type fixtureResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+	BodyBase64  string `json:"body_base64,omitempty"` // for binary bodies
+}
+
+func (r fixtureResponse) body() []byte {
+	if r.BodyBase64 != "" {
+		b, _ := base64.StdEncoding.DecodeString(r.BodyBase64)
+		return b
+	}
+	return []byte(r.Body)
+}
+
+// fixtureKey names the fixture file for a request. Writes are told apart by
+// their body, except multipart uploads, whose boundary changes every time.
+func fixtureKey(method, uri string, body []byte, contentType string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", method, uri)
+	if method != "GET" && !strings.HasPrefix(contentType, "multipart/") {
+		h.Write(body)
+	}
+	path, _, _ := strings.Cut(uri, "?")
+	slug := strings.Trim(strings.NewReplacer("/", "_", ".", "_").Replace(path), "_")
+	if len(slug) > 60 {
+		slug = slug[:60]
+	}
+	return fmt.Sprintf("%s_%s_%s.json", strings.ToLower(method), slug, hex.EncodeToString(h.Sum(nil))[:12])
+}
+
+// recordTransport passes requests on to godocs and appends each response to
+// its fixture in dir.
+type recordTransport struct {
+	next http.RoundTripper
+	dir  string
+	mu   *sync.Mutex
+}
+
+func (t recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r := fixtureResponse{Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type")}
+	if utf8.Valid(body) {
+		r.Body = string(body)
+	} else {
+		r.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	uri := req.URL.RequestURI()
+	key := fixtureKey(req.Method, uri, reqBody, req.Header.Get("Content-Type"))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := appendFixture(filepath.Join(t.dir, key), req.Method, uri, r); err != nil {
+		log.Printf("record: %s %s: %v", req.Method, uri, err)
+	}
+	return resp, nil
+}
+
+func appendFixture(path, method, uri string, r fixtureResponse) error {
+	f := fixture{Method: method, URL: uri}
+	if b, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &f); err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	f.Responses = append(f.Responses, r)
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// recordTo makes the client save every godocs response under dir.
+func (c *GodocsClient) recordTo(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	mu := &sync.Mutex{}
+	c.httpClient.Transport = recordTransport{next: c.httpClient.Transport, dir: dir, mu: mu}
+	c.transfers.Transport = recordTransport{next: c.transfers.Transport, dir: dir, mu: mu}
+	return nil
+}
+
+// replayServer serves the recorded responses in dir.
+type replayServer struct {
+	dir    string
+	mu     sync.Mutex
+	served map[string]int // fixture key → responses served
+}
+
+func (s *replayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	key := fixtureKey(r.Method, r.URL.RequestURI(), body, r.Header.Get("Content-Type"))
+	b, err := os.ReadFile(filepath.Join(s.dir, key))
+	var f fixture
+	if err == nil {
+		err = json.Unmarshal(b, &f)
+	}
+	if err != nil || len(f.Responses) == 0 {
+		log.Printf("replay: no fixture for %s %s", r.Method, r.URL.RequestURI())
+		http.Error(w, `{"error":"not recorded"}`, http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	i := min(s.served[key], len(f.Responses)-1)
+	s.served[key]++
+	s.mu.Unlock()
+	resp := f.Responses[i]
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.body())
+}
+
+// startReplay serves the fixtures in dir on a local port and returns its
+// URL, to be used as the godocs server.
+func startReplay(dir string) (string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("replay fixtures: %w", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	go http.Serve(ln, &replayServer{dir: dir, served: make(map[string]int)})
+	return "http://" + ln.Addr().String(), nil
+}
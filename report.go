@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// A document report lists the filed documents carrying every one of the
+// chosen tags (or any tag, with none chosen) whose date falls in a range,
+// for handing to an accountant or loading into a spreadsheet. It is served
+// as /export/documents.csv?tag=&from=&to= and /export/documents.json, and
+// written by `export documents`. Amounts are those already extracted for
+// the expense export; with extract=1 (-extract) the rest are extracted by
+// the LLM, as the expense export does.
+
+var documentsCSVHeader = []string{"date", "name", "ulid", "folder", "tags", "amount", "currency"}
+
+// ReportFilter selects the documents in a report. Dates are YYYY-MM-DD and
+// inclusive; either may be "" for no bound.
+type ReportFilter struct {
+	TagIDs   []int
+	From, To string
+	Extract  bool // extract amounts not yet cached
+}
+
+// ReportDocument is one document in a report.
+type ReportDocument struct {
+	Date     string   `json:"date"` // the document date, or the day it was added
+	Name     string   `json:"name"`
+	ULID     string   `json:"ulid"`
+	Folder   string   `json:"folder,omitempty"`
+	Tags     []string `json:"tags"`
+	Amount   string   `json:"amount,omitempty"`
+	Currency string   `json:"currency,omitempty"`
+}
+
+func (f ReportFilter) validate() error {
+	for _, d := range []string{f.From, f.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return fmt.Errorf("dates must be YYYY-MM-DD, not %q", d)
+		}
+	}
+	return nil
+}
+
+// documentReport walks the documents of the filter's first tag, or of every
+// tag, and keeps those matching the rest of it, oldest first.
+func (app *App) documentReport(ctx context.Context, f ReportFilter) ([]ReportDocument, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	walk := f.TagIDs
+	if len(walk) == 0 {
+		tags, err := app.docs.FetchTags()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			walk = append(walk, t.ID)
+		}
+	} else {
+		walk = walk[:1]
+	}
+
+	seen := make(map[string]bool)
+	out := []ReportDocument{}
+	for _, tagID := range walk {
+		for doc, err := range app.docs.IterateDocuments(ctx, tagID) {
+			if err != nil {
+				return nil, fmt.Errorf("listing tag %d: %w", tagID, err)
+			}
+			if seen[doc.ULID] {
+				continue
+			}
+			seen[doc.ULID] = true
+			rd, ok, err := app.reportDocument(ctx, doc, f)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				out = append(out, rd)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out, nil
+}
+
+// reportDocument fills in a document's date, tags and amount, reporting
+// false if it falls outside the filter.
+func (app *App) reportDocument(ctx context.Context, doc GodocsDocument, f ReportFilter) (ReportDocument, bool, error) {
+	rd := ReportDocument{Name: doc.Name, ULID: doc.ULID, Folder: doc.Folder, Tags: []string{}}
+	if len(doc.IngressTime) >= 10 {
+		rd.Date = doc.IngressTime[:10]
+	}
+	status, err := app.docs.FetchDocStatus(ctx, doc.ULID)
+	if err != nil {
+		return rd, false, err
+	}
+	if status.DocumentDate != "" {
+		rd.Date = status.DocumentDate
+	}
+	if (f.From != "" && rd.Date < f.From) || (f.To != "" && rd.Date > f.To) {
+		return rd, false, nil
+	}
+	tags, err := app.docs.FetchDocTags(ctx, doc.ULID)
+	if err != nil {
+		return rd, false, err
+	}
+	for _, id := range f.TagIDs {
+		if !slices.ContainsFunc(tags, func(t GodocsTag) bool { return t.ID == id }) {
+			return rd, false, nil
+		}
+	}
+	for _, t := range tags {
+		rd.Tags = append(rd.Tags, t.Name)
+	}
+
+	fields, err := app.store.Fields(doc.ULID)
+	if err != nil {
+		return rd, false, err
+	}
+	if fields == nil && f.Extract {
+		if fields, err = app.documentFields(ctx, doc.ULID); err != nil {
+			app.pipelineErrorf("fields", doc.ULID, "extracting fields for %s: %v", doc.Name, err)
+		}
+	}
+	if fields != nil {
+		rd.Amount, rd.Currency = fields.Amount, fields.Currency
+	}
+	return rd, true, nil
+}
+
+func writeDocumentReport(w io.Writer, format string, docs []ReportDocument) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(docs)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(documentsCSVHeader)
+	for _, d := range docs {
+		cw.Write([]string{d.Date, d.Name, d.ULID, d.Folder, strings.Join(d.Tags, "; "), d.Amount, d.Currency})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// handleExportDocuments serves /export/documents.csv and
+// /export/documents.json, with ?tag=ID (repeated for documents carrying
+// each), from=YYYY-MM-DD, to=YYYY-MM-DD and extract=1.
+func (app *App) handleExportDocuments(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+	q := r.URL.Query()
+	f := ReportFilter{From: q.Get("from"), To: q.Get("to"), Extract: q.Get("extract") == "1"}
+	for _, s := range q["tag"] {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "tag must be a tag ID", 400)
+			return
+		}
+		f.TagIDs = append(f.TagIDs, id)
+	}
+	if err := f.validate(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	docs, err := app.documentReport(r.Context(), f)
+	if err != nil {
+		err = errs.E(errs.Upstream, "document report", err)
+		http.Error(w, errs.Message(err)+"\n"+errs.Guidance(err), errs.Status(err))
+		return
+	}
+	name := "documents"
+	if f.From != "" || f.To != "" {
+		name += "-" + f.From + "-" + f.To
+	}
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	writeDocumentReport(w, format, docs)
+}
+
+// runExportDocuments implements `export documents [-tag ID]... [-from DATE]
+// [-to DATE] [-format csv|json] [-extract]`, writing to out.
+func runExportDocuments(cfg Config, args []string, out io.Writer) error {
+	var f ReportFilter
+	fs := flag.NewFlagSet("export documents", flag.ContinueOnError)
+	fs.Func("tag", "tag ID the documents must carry; repeat for several", func(s string) error {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("not a tag ID: %q", s)
+		}
+		f.TagIDs = append(f.TagIDs, id)
+		return nil
+	})
+	fs.StringVar(&f.From, "from", "", "first day, YYYY-MM-DD")
+	fs.StringVar(&f.To, "to", "", "last day, YYYY-MM-DD")
+	fs.BoolVar(&f.Extract, "extract", false, "extract amounts not yet cached with the LLM")
+	format := fs.String("format", "csv", "csv or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("format must be csv or json")
+	}
+	if err := f.validate(); err != nil {
+		return err
+	}
+
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	st, err := store.Open(cfg.statePath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	app := appFor(cfg)
+	app.docs, app.client, app.store = client, client, st
+	docs, err := app.documentReport(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	return writeDocumentReport(out, *format, docs)
+}
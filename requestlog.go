@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader carries the request ID on responses and on the godocs
+// calls made while serving the request. An ID set by a reverse proxy is kept.
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID of the request ctx belongs to, or "".
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// statusRecorder captures the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// logRequests assigns each request an ID and logs its method, path, status,
+// size and duration once it completes.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		accessLog.Printf("http: %s %s %d %dB %s id=%s", r.Method, r.URL.RequestURI(), rec.status, rec.bytes,
+			time.Since(start).Round(time.Millisecond), id)
+	})
+}
+
+// requestIDTransport forwards the originating request's ID to godocs, so
+// slow or failing upstream calls can be matched to the page that made them.
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := requestID(req.Context()); id != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(requestIDHeader, id)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// required_groups lists the tag groups every document needs exactly one tag
+// from, e.g. Year and Category. godocs drops a document from the untagged
+// list at its first tag, so a document tagged short of them is held at the
+// front of the user's queue, and done refuses to move on, until it has
+// them all.
+//
+//	required_groups: [Year, Category]
+
+// validateRequiredGroups checks that each required group has tags on the
+// server.
+func validateRequiredGroups(client DocumentStore, groups []string) error {
+	for _, g := range groups {
+		found := false
+		for _, t := range client.KnownTags() {
+			found = found || t.TagGroup == g
+		}
+		if !found {
+			return fmt.Errorf("required_groups: no tags in group %q", g)
+		}
+	}
+	return nil
+}
+
+// groupProblems says how tags fall short of the required groups, e.g.
+// "a tag from Year" or "one tag from Category, not 2", or nil if they
+// don't.
+func (app *App) groupProblems(tags []GodocsTag) []string {
+	var problems []string
+	for _, g := range app.config().RequiredGroups {
+		n := 0
+		for _, t := range tags {
+			if t.TagGroup == g {
+				n++
+			}
+		}
+		switch {
+		case n == 0:
+			problems = append(problems, "a tag from "+g)
+		case n > 1:
+			problems = append(problems, fmt.Sprintf("one tag from %s, not %d", g, n))
+		}
+	}
+	return problems
+}
+
+// holdIncomplete checks a document's tags after tagging it. If they fall
+// short of the required groups the document is held in sess's queue, and
+// the problems are returned; otherwise any hold on it is released. Callers
+// must hold app.mu.
+func (app *App) holdIncomplete(ctx context.Context, sess *UserSession, doc GodocsDocument) []string {
+	if len(app.config().RequiredGroups) == 0 {
+		return nil
+	}
+	tags, err := app.docs.FetchDocTags(ctx, doc.ULID)
+	if err != nil {
+		log.Printf("required groups: tags of %s: %v", doc.ULID, err)
+		return nil
+	}
+	problems := app.groupProblems(tags)
+	if len(problems) > 0 {
+		sess.Held = &doc
+	} else if sess.Held != nil && sess.Held.ULID == doc.ULID {
+		sess.Held = nil
+	}
+	return problems
+}
+
+// userQueue is the queue as sess sees it: the untagged queue, or in a
+// detail pass its bucket (see quicksort.go), in its chosen folder only (see
+// folders.go), with its held document and then the one it opened (see
+// opendoc.go), if any, first. Callers must hold app.mu.
+func (app *App) userQueue(sess *UserSession) []GodocsDocument {
+	queue := app.queue()
+	if sess != nil && app.bucket(sess.Bucket) != nil {
+		queue = slices.Clone(app.buckets[sess.Bucket])
+	}
+	queue = slices.DeleteFunc(queue, func(d GodocsDocument) bool { return !inFolder(sess, d) })
+	if sess == nil {
+		return queue
+	}
+	if sess.Oldest {
+		oldestFirst(queue)
+	}
+	var first []GodocsDocument
+	for _, d := range []*GodocsDocument{sess.Held, sess.Opened} {
+		if d != nil && (len(first) == 0 || first[0].ULID != d.ULID) {
+			first = append(first, *d)
+		}
+	}
+	queue = slices.DeleteFunc(queue, func(d GodocsDocument) bool {
+		return slices.ContainsFunc(first, func(f GodocsDocument) bool { return f.ULID == d.ULID })
+	})
+	return append(first, queue...)
+}
+
+// queuedDoc finds a document in sess's queue, or makes do with its ULID and
+// name.
+func (app *App) queuedDoc(sess *UserSession, ulid, name string) GodocsDocument {
+	for _, d := range app.userQueue(sess) {
+		if d.ULID == ulid {
+			return d
+		}
+	}
+	return GodocsDocument{ULID: ulid, Name: name}
+}
+
+// stillNeeds finishes a tagging flash for a document that was held.
+func stillNeeds(problems []string) string {
+	if len(problems) == 0 {
+		return ""
+	}
+	return " — still needs " + strings.Join(problems, ", ")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// ReviewItem is a document whose date was inferred by the LLM, or whose OCR
+// text scored poorly, and has not yet been audited.
+type ReviewItem struct {
+	ULID         string
+	Name         string
+	DocumentDate string
+	LLMDate      bool
+	PoorOCR      int // OCR confidence percent, when flagged
+	HasThumbnail bool
+	ViewURL      string
+	TextPreview  string
+	Note         string
+}
+
+type ReviewPageData struct {
+	Page   string
+	User   string
+	Items  []ReviewItem
+	Flash  string
+	Banner *ErrorBanner
+}
+
+// handleReview lists LLM-dated and poorly OCR'd documents (GET) and applies
+// accept/correct/clear decisions to dates, or marks poor OCR as seen (POST).
+// Either decision removes that reason for review.
+func (app *App) handleReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		app.reviewAction(w, r)
+		return
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	data := ReviewPageData{Page: "review", Flash: r.URL.Query().Get("flash")}
+	if sess := app.currentUser(r); sess != nil {
+		data.User = sess.Name
+		data.Banner = sess.Banner
+	}
+	reasons := make(map[string]*ReviewItem)
+	for ulid := range app.llmDates {
+		reasons[ulid] = &ReviewItem{ULID: ulid, Name: ulid, LLMDate: true}
+	}
+	for _, q := range app.poorOCRToReview() {
+		if reasons[q.ULID] == nil {
+			reasons[q.ULID] = &ReviewItem{ULID: q.ULID, Name: q.ULID}
+		}
+		reasons[q.ULID].PoorOCR = max(int(q.Confidence+0.5), 1)
+	}
+	for ulid, item := range reasons {
+		if status, err := app.docs.FetchDocStatus(r.Context(), ulid); err == nil {
+			item.Name = status.Name
+			item.DocumentDate = status.DocumentDate
+			item.HasThumbnail = status.HasThumbnail
+			item.ViewURL = app.docs.ViewURL(ulid)
+		}
+		if text, err := app.docs.FetchDocText(r.Context(), ulid); err == nil {
+			if len(text) > 600 {
+				text = text[:600] + "..."
+			}
+			item.TextPreview = text
+		}
+		item.Note = app.note(ulid)
+		data.Items = append(data.Items, *item)
+	}
+	sort.Slice(data.Items, func(i, j int) bool { return data.Items[i].Name < data.Items[j].Name })
+
+	app.templates().ExecuteTemplate(w, "review.html", data)
+}
+
+func (app *App) reviewAction(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.currentUser(r)
+
+	ulid := r.FormValue("ulid")
+	name := r.FormValue("name")
+	if r.FormValue("action") == "ocr-seen" {
+		flash := "Nothing to review"
+		if app.markOCRReviewed(ulid) {
+			flash = "kept OCR text ← " + name
+		}
+		http.Redirect(w, r, "/review?flash="+url.QueryEscape(flash), http.StatusSeeOther)
+		return
+	}
+	if !app.llmDates[ulid] {
+		http.Redirect(w, r, "/review", http.StatusSeeOther)
+		return
+	}
+
+	var flash string
+	switch r.FormValue("action") {
+	case "accept":
+		flash = "accepted " + r.FormValue("date") + " ← " + name
+	case "correct":
+		date, ok := app.parseDate(r.FormValue("date"))
+		if !ok {
+			app.fail(w, r, sess, "/review", false, errs.New(errs.Validation, "correct date on "+name, "cannot read the date "+r.FormValue("date")))
+			return
+		}
+		if err := app.docs.UpdateDocumentDate(ulid, date); err != nil {
+			app.fail(w, r, sess, "/review", true, errs.E(errs.Upstream, "correct date on "+name, err))
+			return
+		}
+		flash = "corrected " + app.formatDate(date) + " ← " + name
+	case "clear":
+		if err := app.docs.UpdateDocumentDate(ulid, ""); err != nil {
+			app.fail(w, r, sess, "/review", true, errs.E(errs.Upstream, "clear date on "+name, err))
+			return
+		}
+		flash = "cleared date ← " + name
+	default:
+		http.Redirect(w, r, "/review", http.StatusSeeOther)
+		return
+	}
+
+	delete(app.llmDates, ulid)
+	if err := app.store.DeleteLLMDate(ulid); err != nil {
+		log.Printf("state: %v", err)
+	}
+	http.Redirect(w, r, "/review?flash="+url.QueryEscape(flash), http.StatusSeeOther)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+	_ "golang.org/x/image/webp" // WebP thumbnails
+)
+
+// rotateKey is the chord prefix for rotating: "o u" turns a document the
+// right way up.
+const rotateKey = "o"
+
+// RotateOption is one rotation offered on the inbox page.
+type RotateOption struct {
+	Keys    string // chord, e.g. "o r"
+	Degrees int    // clockwise, submitted to /api/rotate
+	Label   string
+}
+
+var rotateOptions = []RotateOption{
+	{rotateKey + " r", 90, "rotate clockwise"},
+	{rotateKey + " l", 270, "rotate anticlockwise"},
+	{rotateKey + " u", 180, "turn upside down"},
+}
+
+// Scans that went through the feeder the wrong way round OCR to nonsense.
+// godocs has no API to replace or rotate a file, so, as for searchable PDFs,
+// a rotated copy is uploaded under the same name with the original's date,
+// tags and note, the cached hi-res thumbnail is turned to match rather than
+// rendered again, and the original is deleted. OCR then runs again on the
+// copy. PDFs are rotated with qpdf; PNG and JPEG images in Go.
+
+// rotateImage returns img turned clockwise by degrees (90, 180 or 270).
+func rotateImage(img image.Image, degrees int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	size := image.Rect(0, 0, h, w)
+	if degrees == 180 {
+		size = image.Rect(0, 0, w, h)
+	}
+	out := image.NewNRGBA(size)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y))
+			switch degrees {
+			case 90:
+				out.Set(h-1-y, x, c)
+			case 180:
+				out.Set(w-1-x, h-1-y, c)
+			case 270:
+				out.Set(y, w-1-x, c)
+			}
+		}
+	}
+	return out
+}
+
+// rotateImageFile rotates a PNG or JPEG file, keeping its format.
+func rotateImageFile(inPath, outPath string, degrees int) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	img, format, err := image.Decode(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("decoding image: %w", err)
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if format == "jpeg" {
+		err = jpeg.Encode(out, rotateImage(img, degrees), &jpeg.Options{Quality: 95})
+	} else {
+		err = png.Encode(out, rotateImage(img, degrees))
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// rotateFile writes a rotated copy of a document to outPath.
+func rotateFile(ctx context.Context, inPath, outPath, docType string, degrees int) error {
+	switch normalizeDocType(docType) {
+	case ".pdf":
+		return ocr.RotatePDF(ctx, inPath, outPath, degrees)
+	case ".png", ".jpg", ".jpeg":
+		return rotateImageFile(inPath, outPath, degrees)
+	}
+	return fmt.Errorf("%s documents cannot be rotated", docType)
+}
+
+// rotateThumb turns the cached hi-res thumbnail of ulid, if there is one.
+func (app *App) rotateThumb(ulid string, degrees int) error {
+	path := app.hiresThumbPath(ulid)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("decoding thumbnail: %w", err)
+	}
+	return writeThumbnail(rotateImage(img, degrees), path, app.config().Thumbnails)
+}
+
+// rotateDocument replaces a document in godocs with a copy rotated by
+// degrees, filed in the original's folder, and returns the copy's ULID.
+// Errors carry their kind.
+func (app *App) rotateDocument(ctx context.Context, ulid, folder string, degrees int) (string, error) {
+	status, err := app.docs.FetchDocStatus(ctx, ulid)
+	if err != nil {
+		return "", errs.E(errs.Upstream, "", err)
+	}
+	tmpPath, err := app.docs.DownloadDocument(ulid, "godocs-rotate-*"+status.DocumentType, app.maxDownloadBytes())
+	if err != nil {
+		return "", errs.E(errs.Upstream, "", err)
+	}
+	defer scratch.release(tmpPath)
+	out, err := scratch.create("godocs-rotated-*" + status.DocumentType)
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+	defer scratch.release(out.Name())
+	if err := rotateFile(ctx, tmpPath, out.Name(), status.DocumentType, degrees); err != nil {
+		return "", errs.E(errs.Pipeline, "", err)
+	}
+	tags, err := app.docs.FetchDocTags(ctx, ulid)
+	if err != nil {
+		return "", errs.E(errs.Upstream, "", err)
+	}
+
+	doc, err := app.docs.CreateDocument(ctx, out.Name(), CreateOptions{Name: status.Name, Folder: folder, Date: status.DocumentDate})
+	if err != nil {
+		if doc != nil {
+			// Keep the original, which is still filed and dated
+			app.docs.DeleteDocument(doc.ULID)
+		}
+		return "", errs.E(errs.Upstream, "", err)
+	}
+	if len(tags) > 0 {
+		ids := make([]int, len(tags))
+		for i, t := range tags {
+			ids[i] = t.ID
+		}
+		if _, err := app.docs.AddTags(doc.ULID, ids); err != nil {
+			// Keep the original, which still has every tag
+			app.docs.DeleteDocument(doc.ULID)
+			return "", errs.E(errs.Upstream, "", fmt.Errorf("copying tags: %w", err))
+		}
+	}
+	app.moveNote(ulid, doc.ULID)
+	if err := app.rotateThumb(ulid, degrees); err != nil {
+		log.Printf("rotate: thumbnail for %s: %v", ulid, err)
+	}
+	if err := os.Rename(app.hiresThumbPath(ulid), app.hiresThumbPath(doc.ULID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("rotate: thumbnail for %s: %v", doc.ULID, err)
+	}
+	if err := app.docs.DeleteDocument(ulid); err != nil {
+		// Both copies are left in godocs; duplicate detection will flag them
+		log.Printf("rotate: deleting original %s: %v", ulid, err)
+	}
+	app.deleteHash(ulid)
+	log.Printf("rotate: replaced %s with %s, rotated %d°", ulid, doc.ULID, degrees)
+	return doc.ULID, nil
+}
+
+// handleRotate (/api/rotate) rotates the current document and re-runs OCR
+// on it, then shows it again.
+func (app *App) handleRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, name, pos := r.FormValue("ulid"), r.FormValue("name"), r.FormValue("pos")
+	degrees, _ := strconv.Atoi(r.FormValue("degrees"))
+	if !slices.ContainsFunc(rotateOptions, func(o RotateOption) bool { return o.Degrees == degrees }) {
+		app.fail(w, r, sess, "/?pos="+pos, false, errs.New(errs.Validation, "rotate "+name, "rotate by 90, 180 or 270 degrees"))
+		return
+	}
+	var folder string
+	if i := slices.IndexFunc(app.untagged, func(d GodocsDocument) bool { return d.ULID == ulid }); i >= 0 {
+		folder = app.untagged[i].Folder
+	}
+	app.processingMu.Lock()
+	job := app.docStage[ulid]
+	var ctx context.Context
+	if job == nil {
+		ctx = app.beginJob(ulid, stageRotate, "")
+	}
+	app.processingMu.Unlock()
+	if job != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.New(errs.Validation, "rotate "+name, "wait for "+job.Stage+" to finish"))
+		return
+	}
+
+	// The download, rotation and upload can take a while; let other
+	// requests through meanwhile
+	app.mu.Unlock()
+	newULID, err := app.rotateDocument(ctx, ulid, folder, degrees)
+	app.endJob(ulid)
+	app.mu.Lock()
+	if err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, errs.Retryable(err), errs.E(errs.KindOf(err), "rotate "+name, err))
+		return
+	}
+	app.moveSourceTag(ulid, newULID)
+	sess.release(ulid)
+	sess.record("rotate "+strconv.Itoa(degrees), newULID, name)
+	app.syncUntagged()
+
+	status, err := app.docs.FetchDocStatus(r.Context(), newULID)
+	if err == nil && !status.HasText && app.stageEnabled(pipelineOCR, status.DocumentType) {
+		app.processingMu.Lock()
+		ctx := app.beginJob(newULID, stageOCR, status.DocumentType)
+		go processDocument(ctx, app, newULID, status.DocumentType)
+		app.processingMu.Unlock()
+	}
+
+	// The copy is new to godocs, so it would be at the back of the queue;
+	// open it instead, as /doc/{ulid} does
+	doc := GodocsDocument{ULID: newULID, Name: name}
+	if i := slices.IndexFunc(app.untagged, func(d GodocsDocument) bool { return d.ULID == newULID }); i >= 0 {
+		doc = app.untagged[i]
+	}
+	sess.Opened = &doc
+	at := slices.IndexFunc(app.userQueue(sess), func(d GodocsDocument) bool { return d.ULID == newULID }) + 1
+	flash := "Rotated " + name
+	if app.jobStage(newULID) == stageOCR {
+		flash += ", running OCR again"
+	}
+	http.Redirect(w, r, "/?pos="+strconv.Itoa(at)+"&flash="+flash, http.StatusSeeOther)
+}
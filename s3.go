@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/s3"
+)
+
+// S3Config polls an S3 bucket, or a MinIO or other S3-compatible store, for
+// new files, such as those a phone scanning app syncs, and uploads them to
+// godocs (see ingest.go):
+//
+//	s3:
+//	  endpoint: http://minio.local:9000
+//	  bucket: scans
+//	  prefix: phone/               # only keys under this
+//	  path_style: true             # MinIO; AWS uses bucket.host names
+//	  access_key_id: inbox         # or $AWS_ACCESS_KEY_ID
+//	  secret_access_key: secret    # or $AWS_SECRET_ACCESS_KEY
+//	  tag_id: 40                   # e.g. source:s3, added once triaged
+//	  interval_seconds: 300        # the default
+//	  delete: true                 # remove objects once uploaded
+//
+// A file is uploaded again if it is rewritten (its ETag changes).
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint,omitempty"`
+	Region          string `yaml:"region,omitempty"` // default us-east-1
+	Bucket          string `yaml:"bucket,omitempty"`
+	Prefix          string `yaml:"prefix,omitempty"`
+	PathStyle       bool   `yaml:"path_style,omitempty"`
+	AccessKeyID     string `yaml:"access_key_id,omitempty"`
+	SecretAccessKey string `yaml:"secret_access_key,omitempty"`
+	TagID           int    `yaml:"tag_id,omitempty"`
+	IntervalSeconds int    `yaml:"interval_seconds,omitempty"`
+	Delete          bool   `yaml:"delete,omitempty"`
+}
+
+const (
+	defaultS3Interval = 5 * time.Minute
+	s3Source          = "s3" // source recorded in the ingested table
+)
+
+func (c S3Config) interval() time.Duration {
+	if c.IntervalSeconds == 0 {
+		return defaultS3Interval
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+// options returns the client options, taking keys missing from the config
+// from the usual AWS environment variables.
+func (c S3Config) options() s3.Options {
+	opts := s3.Options{Endpoint: c.Endpoint, Region: c.Region, Bucket: c.Bucket, PathStyle: c.PathStyle,
+		AccessKey: c.AccessKeyID, SecretKey: c.SecretAccessKey}
+	if opts.AccessKey == "" {
+		opts.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if opts.SecretKey == "" {
+		opts.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	return opts
+}
+
+// validate checks the settings against the server's tags.
+func (c S3Config) validate(client DocumentStore) error {
+	if c.Bucket == "" && c.Endpoint == "" {
+		return nil
+	}
+	if _, err := s3.New(c.options()); err != nil {
+		return err
+	}
+	if c.IntervalSeconds < 0 {
+		return fmt.Errorf("s3: interval_seconds must be positive")
+	}
+	if c.TagID != 0 {
+		if _, ok := client.Tag(c.TagID); !ok {
+			return fmt.Errorf("s3: tag_id %d not found on server", c.TagID)
+		}
+	}
+	return nil
+}
+
+// initS3 makes the bucket client, if a bucket is configured.
+func (app *App) initS3() {
+	if app.config().S3.Bucket == "" {
+		return
+	}
+	c, err := s3.New(app.config().S3.options())
+	if err != nil {
+		log.Printf("s3: %v", err)
+		return
+	}
+	app.s3Bucket = c
+}
+
+// runS3Ingest polls the bucket at the configured interval until ctx is
+// done. It returns at once if there is no bucket.
+func (app *App) runS3Ingest(ctx context.Context) {
+	if app.s3Bucket == nil {
+		return
+	}
+	cfg := app.config().S3
+	log.Printf("s3: polling %s/%s every %v", cfg.Bucket, cfg.Prefix, cfg.interval())
+	app.pollSource(ctx, cfg.interval(), app.s3Sweep)
+}
+
+// s3Sweep uploads the objects under the prefix that are new or have
+// changed since they were last uploaded. The caller syncs the queue.
+func (app *App) s3Sweep(ctx context.Context) IngestRun {
+	cfg := app.config().S3
+	run := IngestRun{Source: "S3 " + cfg.Bucket + "/" + cfg.Prefix, Time: time.Now()}
+	objects, err := app.s3Bucket.List(ctx, cfg.Prefix)
+	if err != nil {
+		log.Printf("s3: %v", err)
+		run.Error = err.Error()
+		return run
+	}
+	seen, err := app.store.IngestedVersions(s3Source)
+	if err != nil {
+		log.Printf("state: %v", err)
+		run.Error = err.Error()
+		return run
+	}
+	for _, o := range objects {
+		key := cfg.Bucket + "/" + o.Key
+		if strings.HasSuffix(o.Key, "/") || o.Size == 0 || seen[key] == o.ETag {
+			continue
+		}
+		if o.Size > app.maxDownloadBytes() {
+			run.Skipped++
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		name := path.Base(o.Key)
+		if err := app.ingestS3Object(ctx, key, o, name); err != nil {
+			log.Printf("s3: %s: %v", o.Key, err)
+			run.Failed++
+			continue
+		}
+		run.Uploaded = append(run.Uploaded, name)
+	}
+	return run
+}
+
+// ingestS3Object uploads one object and, if configured, deletes it.
+func (app *App) ingestS3Object(ctx context.Context, key string, o s3.Object, name string) error {
+	body, err := app.s3Bucket.Get(ctx, o.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if _, err := app.ingestFile(s3Source, key, o.ETag, name, body, app.config().S3.TagID); err != nil {
+		return err
+	}
+	if app.config().S3.Delete {
+		if err := app.s3Bucket.Delete(ctx, o.Key); err != nil {
+			log.Printf("s3: deleting %s: %v", o.Key, err)
+		}
+	}
+	return nil
+}
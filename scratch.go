@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+)
+
+// Downloads, rotated and searchable copies, split pages and the OCR tools'
+// page images are written to a scratch directory under the cache dir rather
+// than the system temp dir, so that files a crash leaves behind can be found
+// and removed. Everything there is removed at startup, since nothing can be
+// using it yet. After that, every scratchSweepInterval, entries not in use
+// are removed once they are scratchStaleAge old, and the oldest go early
+// while the directory is over scratch_max_mb. Files made with
+// scratch.create and scratch.mkdir are in use until scratch.release;
+// the OCR tools' directories are not tracked, so they are spared until
+// scratchMinAge old.
+
+const (
+	defaultScratchMaxMB  = 2048
+	scratchSweepInterval = 15 * time.Minute
+	scratchStaleAge      = 6 * time.Hour
+	scratchMinAge        = 10 * time.Minute
+)
+
+// scratchSpace is the process's scratch directory. Profiles share it.
+type scratchSpace struct {
+	dir      string // "" for the system temp dir, before init and in tests
+	maxBytes int64
+	mu       sync.Mutex
+	inUse    map[string]bool // paths not to sweep
+}
+
+var scratch = &scratchSpace{inUse: make(map[string]bool)}
+
+// init makes the scratch directory under cacheDir, empties it and sends
+// the OCR tools' temporary files there.
+func (s *scratchSpace) init(cacheDir string, maxMB int) error {
+	if maxMB == 0 {
+		maxMB = defaultScratchMaxMB
+	}
+	dir := filepath.Join(cacheDir, "scratch")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.dir, s.maxBytes = dir, int64(maxMB)<<20
+	s.mu.Unlock()
+	ocr.TempDir = dir
+	if n, size := s.sweep(time.Now(), true); n > 0 {
+		log.Printf("scratch: removed %d files (%s) left by a previous run", n, formatBytes(size))
+	}
+	return nil
+}
+
+// create makes a temporary file, as os.CreateTemp does, and marks it in use.
+func (s *scratchSpace) create(pattern string) (*os.File, error) {
+	f, err := os.CreateTemp(s.dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	s.track(f.Name())
+	return f, nil
+}
+
+// mkdir makes a temporary directory, as os.MkdirTemp does, and marks it in
+// use.
+func (s *scratchSpace) mkdir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp(s.dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	s.track(dir)
+	return dir, nil
+}
+
+func (s *scratchSpace) track(path string) {
+	s.mu.Lock()
+	s.inUse[path] = true
+	s.mu.Unlock()
+}
+
+// release removes a file or directory made by create or mkdir.
+func (s *scratchSpace) release(path string) {
+	os.RemoveAll(path)
+	s.mu.Lock()
+	delete(s.inUse, path)
+	s.mu.Unlock()
+}
+
+// scratchEntry is a top-level entry in the scratch directory.
+type scratchEntry struct {
+	path    string
+	size    int64
+	modTime time.Time // newest in a directory
+}
+
+// sweep removes stale entries, or every entry not in use with all, then
+// the oldest of the rest while over the size limit. It returns how many
+// it removed and their size.
+func (s *scratchSpace) sweep(now time.Time, all bool) (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return 0, 0
+	}
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("scratch: %v", err)
+		return 0, 0
+	}
+	var entries []scratchEntry
+	var total int64
+	for _, de := range dirEntries {
+		path := filepath.Join(s.dir, de.Name())
+		e := scratchEntry{path: path}
+		filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				e.size += info.Size()
+				if info.ModTime().After(e.modTime) {
+					e.modTime = info.ModTime()
+				}
+			}
+			return nil
+		})
+		entries = append(entries, e)
+		total += e.size
+	}
+	slices.SortFunc(entries, func(a, b scratchEntry) int { return a.modTime.Compare(b.modTime) })
+
+	removed, freed := 0, int64(0)
+	for _, e := range entries {
+		age := now.Sub(e.modTime)
+		stale := all || age >= scratchStaleAge || (total > s.maxBytes && age >= scratchMinAge)
+		if s.inUse[e.path] || !stale {
+			continue
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			log.Printf("scratch: %v", err)
+			continue
+		}
+		removed++
+		freed += e.size
+		total -= e.size
+	}
+	if total > s.maxBytes {
+		log.Printf("scratch: %s in use, over the %s limit", formatBytes(total), formatBytes(s.maxBytes))
+	}
+	return removed, freed
+}
+
+// usage reports the scratch directory's entries, how many are in use, their
+// size and the limit, for the status page.
+func (s *scratchSpace) usage() (entries, inUse int, size, limit int64) {
+	s.mu.Lock()
+	dir, inUse, limit := s.dir, len(s.inUse), s.maxBytes
+	s.mu.Unlock()
+	if dir == "" {
+		return 0, inUse, 0, 0
+	}
+	des, _ := os.ReadDir(dir)
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return len(des), inUse, size, limit
+}
+
+// runSweeper sweeps the scratch directory until ctx is done.
+func (s *scratchSpace) runSweeper(ctx context.Context) {
+	t := time.NewTicker(scratchSweepInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if n, size := s.sweep(now, false); n > 0 {
+				log.Printf("scratch: removed %d stale files (%s)", n, formatBytes(size))
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// maxSearchResults bounds the /search page, which fetches each result's tags.
+const maxSearchResults = 25
+
+// SearchQuery filters a document search. Term is matched by godocs against
+// names and text; TagID, when set, keeps documents carrying that tag; From
+// and To (YYYY-MM-DD, inclusive) bound the ingress date.
+type SearchQuery struct {
+	Term     string
+	TagID    int
+	From, To string
+}
+
+// SearchDocuments returns up to limit documents matching q. godocs searches
+// by term and lists by tag, but not both at once and not by date, so a term
+// and a tag are intersected here and dates filtered after.
+func (c *GodocsClient) SearchDocuments(ctx context.Context, q SearchQuery, limit int) ([]GodocsDocument, error) {
+	var docs []GodocsDocument
+	if q.TagID != 0 {
+		sr, err := c.FetchTagged(ctx, q.TagID, 1, 10000)
+		if err != nil {
+			return nil, err
+		}
+		docs = sr.Documents
+	}
+	if q.Term != "" {
+		u := fmt.Sprintf("%s/api/search?term=%s&page=1&pageSize=%d", c.baseURL, url.QueryEscape(q.Term), 10000)
+		resp, err := c.getWithContext(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("searching documents: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("searching documents: status %d", resp.StatusCode)
+		}
+		var sr GodocsSearchResponse
+		if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+			return nil, fmt.Errorf("decoding search results: %w", err)
+		}
+		if q.TagID != 0 {
+			tagged := docs
+			sr.Documents = slices.DeleteFunc(sr.Documents, func(d GodocsDocument) bool {
+				return !slices.ContainsFunc(tagged, func(t GodocsDocument) bool { return t.ULID == d.ULID })
+			})
+		}
+		docs = sr.Documents
+	}
+	docs = slices.DeleteFunc(docs, func(d GodocsDocument) bool {
+		day := d.IngressTime[:min(len(d.IngressTime), 10)]
+		return q.From != "" && day < q.From || q.To != "" && day > q.To
+	})
+	return docs[:min(len(docs), limit)], nil
+}
+
+// SearchResult is a document on the /search page, with its tags and the
+// tag editor for them.
+type SearchResult struct {
+	GodocsDocument
+	Date     string // ingress date
+	ViewURL  string
+	Tags     []GodocsTag
+	Groups   []EditTagGroup
+	Untagged bool
+}
+
+type SearchPageData struct {
+	Page     string
+	User     string
+	Query    SearchQuery
+	Tags     []GodocsTag // for the tag filter, by group and name
+	Searched bool
+	Results  []SearchResult
+	More     bool // results were cut at maxSearchResults
+	Error    string
+	Guidance string
+}
+
+// handleSearch finds filed documents by text, tag and date range, so they
+// can be checked and retagged without leaving the inbox.
+func (app *App) handleSearch(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	q := r.URL.Query()
+	tagID, _ := strconv.Atoi(q.Get("tag"))
+	data := SearchPageData{
+		Page:  "search",
+		Query: SearchQuery{Term: strings.TrimSpace(q.Get("q")), TagID: tagID, From: q.Get("from"), To: q.Get("to")},
+	}
+	if sess := app.currentUser(r); sess != nil {
+		data.User = sess.Name
+	}
+	for _, t := range app.docs.KnownTags() {
+		data.Tags = append(data.Tags, t)
+	}
+	sort.Slice(data.Tags, func(i, j int) bool {
+		if data.Tags[i].TagGroup != data.Tags[j].TagGroup {
+			return data.Tags[i].TagGroup < data.Tags[j].TagGroup
+		}
+		return data.Tags[i].Name < data.Tags[j].Name
+	})
+
+	if data.Query.Term != "" || data.Query.TagID != 0 {
+		data.Searched = true
+		docs, err := app.docs.SearchDocuments(r.Context(), data.Query, maxSearchResults+1)
+		if err != nil {
+			err = errs.E(errs.Upstream, "search", err)
+			data.Error, data.Guidance = errs.Message(err), errs.Guidance(err)
+		}
+		if len(docs) > maxSearchResults {
+			docs, data.More = docs[:maxSearchResults], true
+		}
+		untagged := make(map[string]bool, len(app.untagged))
+		for _, d := range app.untagged {
+			untagged[d.ULID] = true
+		}
+		for _, d := range docs {
+			res := SearchResult{
+				GodocsDocument: d,
+				Date:           d.IngressTime[:min(len(d.IngressTime), 10)],
+				ViewURL:        app.docs.ViewURL(d.ULID),
+				Untagged:       untagged[d.ULID],
+			}
+			if tags, err := app.docs.FetchDocTags(r.Context(), d.ULID); err == nil {
+				res.Tags = tags
+			}
+			res.Groups = app.buildTagGroups(res.Tags)
+			data.Results = append(data.Results, res)
+		}
+	}
+	app.templates().ExecuteTemplate(w, "search.html", data)
+}
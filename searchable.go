@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+)
+
+const defaultSearchableMaxMB = 50
+
+// SearchablePDFConfig has OCR'd documents rewritten by ocrmypdf as PDF/A
+// with a text layer, replacing the original in godocs.
+type SearchablePDFConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Types   []string `yaml:"types,omitempty"`  // document types to convert (default [.pdf])
+	MaxMB   int      `yaml:"max_mb,omitempty"` // skip larger documents (default 50)
+}
+
+func (c SearchablePDFConfig) applies(docType string, size int64) bool {
+	if !c.Enabled {
+		return false
+	}
+	types := []string{".pdf"}
+	if len(c.Types) > 0 {
+		types = c.Types
+	}
+	if !slices.ContainsFunc(types, func(t string) bool { return normalizeDocType(t) == normalizeDocType(docType) }) {
+		return false
+	}
+	maxMB := c.MaxMB
+	if maxMB == 0 {
+		maxMB = defaultSearchableMaxMB
+	}
+	return size <= int64(maxMB)<<20
+}
+
+// replaceWithSearchablePDF converts a freshly OCR'd document with ocrmypdf
+// and swaps it into godocs. godocs has no API to replace a document's file,
+// so the searchable copy is uploaded as a new document with the same name,
+// text and date, the note moves across, and the original is deleted. It
+// returns the ULID the document now has, which is ulid if it was not
+// replaced.
+func replaceWithSearchablePDF(ctx context.Context, app *App, ulid, docPath, docType, text string) string {
+	info, err := os.Stat(docPath)
+	if err != nil || !app.config().SearchablePDF.applies(docType, info.Size()) || !app.hasTool("ocrmypdf") {
+		return ulid
+	}
+	status, err := app.docs.FetchDocStatus(ctx, ulid)
+	if err != nil {
+		app.pipelineErrorf("searchable-pdf", ulid, "status for %s: %v", ulid, err)
+		return ulid
+	}
+
+	out, err := scratch.create("godocs-searchable-*.pdf")
+	if err != nil {
+		return ulid
+	}
+	out.Close()
+	defer scratch.release(out.Name())
+	if err := ocr.MakeSearchablePDF(ctx, docPath, out.Name()); err != nil {
+		app.pipelineErrorf("searchable-pdf", ulid, "converting %s: %v", ulid, err)
+		return ulid
+	}
+
+	newULID, err := app.uploadReplacement(ctx, status, out.Name(), text)
+	if err != nil {
+		app.pipelineErrorf("searchable-pdf", ulid, "uploading %s: %v", ulid, err)
+		return ulid
+	}
+	app.moveNote(ulid, newULID)
+	if err := app.docs.DeleteDocument(ulid); err != nil {
+		// Both copies are left in godocs; duplicate detection will flag them
+		app.pipelineErrorf("searchable-pdf", ulid, "deleting original %s: %v", ulid, err)
+	}
+	app.deleteHash(ulid)
+	log.Printf("searchable-pdf: replaced %s with %s", ulid, newULID)
+
+	app.mu.Lock()
+	app.moveSourceTag(ulid, newULID)
+	app.syncUntagged()
+	app.mu.Unlock()
+	return newULID
+}
+
+// uploadReplacement uploads the searchable copy of a document and gives it
+// the original's text and date.
+func (app *App) uploadReplacement(ctx context.Context, orig *GodocsDocStatus, path, text string) (string, error) {
+	doc, err := app.docs.CreateDocument(ctx, path, CreateOptions{Name: orig.Name})
+	if err != nil {
+		return "", err
+	}
+	if err := app.docs.UploadDocumentText(doc.ULID, text); err != nil {
+		app.docs.DeleteDocument(doc.ULID)
+		return "", fmt.Errorf("setting text: %w", err)
+	}
+	if orig.DocumentDate != "" {
+		if err := app.docs.UpdateDocumentDate(doc.ULID, orig.DocumentDate); err != nil {
+			log.Printf("searchable-pdf: date for %s: %v", doc.ULID, err)
+		}
+	}
+	return doc.ULID, nil
+}
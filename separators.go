@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+)
+
+const (
+	defaultSeparatorPrefix = "GODOCS-SEP"
+	separatorDPI           = 100 // page render resolution for QR detection
+)
+
+// SeparatorConfig splits batch-scanned PDFs at separator sheets: pages with
+// a QR code whose payload starts with Prefix. A payload of "PREFIX:Tag" names
+// a tag (or tag ID) applied to the document that follows when ApplyTags is set.
+type SeparatorConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Prefix    string `yaml:"prefix,omitempty"` // default GODOCS-SEP
+	ApplyTags bool   `yaml:"apply_tags,omitempty"`
+}
+
+func (c SeparatorConfig) prefix() string {
+	if c.Prefix != "" {
+		return c.Prefix
+	}
+	return defaultSeparatorPrefix
+}
+
+// batchPart is a run of pages between separator sheets and the tag named on
+// the sheet before it.
+type batchPart struct {
+	first, last int
+	tag         string
+}
+
+// batchParts cuts pages 1..n at the separator pages found in codes. The
+// separator sheets themselves are dropped, as are empty runs.
+func batchParts(n int, codes map[int][]string, prefix string) ([]batchPart, bool) {
+	var parts []batchPart
+	cur := batchPart{first: 1}
+	found := false
+	for p := 1; p <= n; p++ {
+		payload, ok := separatorPayload(codes[p], prefix)
+		if !ok {
+			cur.last = p
+			continue
+		}
+		found = true
+		if cur.last >= cur.first {
+			parts = append(parts, cur)
+		}
+		cur = batchPart{first: p + 1, tag: payload}
+	}
+	if cur.last >= cur.first {
+		parts = append(parts, cur)
+	}
+	return parts, found
+}
+
+// separatorPayload returns the text after "prefix:" if one of a page's
+// codes marks it as a separator sheet.
+func separatorPayload(codes []string, prefix string) (string, bool) {
+	for _, c := range codes {
+		if rest, ok := strings.CutPrefix(c, prefix); ok {
+			return strings.TrimSpace(strings.TrimPrefix(rest, ":")), true
+		}
+	}
+	return "", false
+}
+
+// splitBatch looks for separator sheets in a newly scanned PDF and, if it
+// finds any, uploads each part as its own document, tags it from its
+// separator when configured, and deletes the original batch. It reports
+// whether the document was split, in which case the pipeline stops for it;
+// the parts are processed as new documents.
+func splitBatch(ctx context.Context, app *App, ulid, docPath, docType string) bool {
+	cfg := app.config().Separators
+	if !cfg.Enabled || normalizeDocType(docType) != ".pdf" {
+		return false
+	}
+	codes, pageCount, err := ocr.PageCodes(ctx, docPath, separatorDPI)
+	if err != nil {
+		app.pipelineErrorf("separators", ulid, "scanning %s: %v", ulid, err)
+		return false
+	}
+	parts, found := batchParts(pageCount, codes, cfg.prefix())
+	if !found {
+		return false
+	}
+	if len(parts) == 0 {
+		log.Printf("separators: %s has only separator sheets", ulid)
+		return false
+	}
+
+	status, err := app.docs.FetchDocStatus(ctx, ulid)
+	if err != nil {
+		app.pipelineErrorf("separators", ulid, "status for %s: %v", ulid, err)
+		return false
+	}
+	dir, err := scratch.mkdir("godocs-split-*")
+	if err != nil {
+		return false
+	}
+	defer scratch.release(dir)
+	ranges := make([][2]int, len(parts))
+	for i, p := range parts {
+		ranges[i] = [2]int{p.first, p.last}
+	}
+	files, err := ocr.SplitPDF(ctx, docPath, ranges, dir)
+	if err != nil {
+		app.pipelineErrorf("separators", ulid, "splitting %s: %v", ulid, err)
+		return false
+	}
+
+	var tags []GodocsTag
+	if cfg.ApplyTags {
+		if tags, err = app.docs.FetchTags(); err != nil {
+			log.Printf("separators: fetching tags: %v", err)
+		}
+	}
+	base := strings.TrimSuffix(status.Name, filepath.Ext(status.Name))
+	var uploaded []string
+	for i, path := range files {
+		name := fmt.Sprintf("%s-%d.pdf", base, i+1)
+		doc, err := app.docs.CreateDocument(ctx, path, CreateOptions{Name: name})
+		if err != nil {
+			// Keep the original whole rather than leave it half split
+			app.pipelineErrorf("separators", ulid, "uploading part %d of %s: %v", i+1, ulid, err)
+			for _, u := range uploaded {
+				app.docs.DeleteDocument(u)
+			}
+			return false
+		}
+		uploaded = append(uploaded, doc.ULID)
+		log.Printf("separators: %s pages %d-%d as %s", ulid, parts[i].first, parts[i].last, doc.ULID)
+		if t := parts[i].tag; t != "" && cfg.ApplyTags {
+			if id, ok := separatorTag(tags, t); ok {
+				if err := app.docs.AddTag(doc.ULID, id); err != nil {
+					log.Printf("separators: tagging %s: %v", doc.ULID, err)
+				}
+			} else {
+				log.Printf("separators: unknown tag %q on separator before %s", t, doc.ULID)
+			}
+		}
+	}
+	if err := app.docs.DeleteDocument(ulid); err != nil {
+		app.pipelineErrorf("separators", ulid, "deleting batch %s: %v", ulid, err)
+	}
+
+	app.mu.Lock()
+	app.syncUntagged()
+	app.mu.Unlock()
+	return true
+}
+
+// separatorTag resolves a separator payload to a tag ID, by ID or by name.
+func separatorTag(tags []GodocsTag, payload string) (int, bool) {
+	if id, err := strconv.Atoi(payload); err == nil {
+		return id, true
+	}
+	for _, t := range tags {
+		if strings.EqualFold(t.Name, payload) {
+			return t.ID, true
+		}
+	}
+	return 0, false
+}
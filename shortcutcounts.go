@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Each shortcut in the inbox's control bar shows how many documents carry
+// its tag, so filing can be seen to land where it should: a count that
+// jumps after a run of documents shows a wrong key was pressed for them.
+// Counts come through DocumentStore.TagCount, which a godocs server caches
+// for cache_ttl_seconds and drops when the inbox tags or untags a document.
+
+// shortcutCounts returns the formatted document count of each tag behind
+// sess's shortcuts and layers, by tag ID. Counts that fail are left out.
+func (app *App) shortcutCounts(ctx context.Context, sess *UserSession) map[int]string {
+	ids := make(map[int]bool)
+	for _, s := range sess.Shortcuts {
+		ids[s.TagID] = true
+	}
+	for _, l := range sess.Layers {
+		for _, s := range l.Shortcuts {
+			ids[s.TagID] = true
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pageFetchTimeout)
+	defer cancel()
+	var mu sync.Mutex
+	counts := make(map[int]string, len(ids))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(tagCountParallel)
+	for id := range ids {
+		g.Go(func() error {
+			if n, err := app.docs.TagCount(ctx, id); err == nil {
+				mu.Lock()
+				counts[id] = strconv.Itoa(n)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	return counts
+}
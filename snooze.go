@@ -0,0 +1,194 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// snoozeKey is the chord prefix for snoozing: "z w" snoozes for a week.
+const snoozeKey = "z"
+
+// SnoozeOption is one snooze duration offered on the inbox page.
+type SnoozeOption struct {
+	Keys  string // chord, e.g. "z w"
+	For   string // duration name submitted to /api/snooze
+	Label string
+}
+
+var snoozeOptions = []SnoozeOption{
+	{snoozeKey + " t", "tomorrow", "snooze until tomorrow"},
+	{snoozeKey + " w", "week", "snooze for 1 week"},
+	{snoozeKey + " m", "month", "snooze until next month"},
+}
+
+// snoozeUntil returns the wake time for a named duration: the start of
+// tomorrow, the same day next week, or the first of next month.
+func snoozeUntil(name string, now time.Time) (time.Time, bool) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch name {
+	case "tomorrow":
+		return day.AddDate(0, 0, 1), true
+	case "week":
+		return day.AddDate(0, 0, 7), true
+	case "month":
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// queue returns the untagged documents in triage order: snoozed documents
+// that are due come first, soonest wake time first, and those still
+// snoozed, or tagged but waiting out the commit delay, are left out.
+// Callers must hold app.mu.
+func (app *App) queue() []GodocsDocument {
+	now := time.Now()
+	app.snoozeMu.Lock()
+	defer app.snoozeMu.Unlock()
+	var due, rest []GodocsDocument
+	for _, doc := range app.untagged {
+		z, ok := app.snoozes[doc.ULID]
+		switch {
+		case app.pending[doc.ULID] != nil:
+			// tagged, waiting out commit_delay_seconds
+		case !ok:
+			rest = append(rest, doc)
+		case z.Until.After(now):
+			// still snoozed
+		default:
+			due = append(due, doc)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return app.snoozes[due[i].ULID].Until.Before(app.snoozes[due[j].ULID].Until)
+	})
+	return append(due, rest...)
+}
+
+// snoozedCount is the number of documents still snoozed, for the nav badge.
+func (app *App) snoozedCount() int {
+	now := time.Now()
+	app.snoozeMu.Lock()
+	defer app.snoozeMu.Unlock()
+	n := 0
+	for _, z := range app.snoozes {
+		if z.Until.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+func (app *App) putSnooze(z store.Snooze) error {
+	if err := app.store.PutSnooze(z); err != nil {
+		return err
+	}
+	app.snoozeMu.Lock()
+	app.snoozes[z.ULID] = z
+	app.snoozeMu.Unlock()
+	return nil
+}
+
+func (app *App) deleteSnooze(ulid string) {
+	if err := app.store.DeleteSnooze(ulid); err != nil {
+		log.Printf("state: %v", err)
+	}
+	app.snoozeMu.Lock()
+	delete(app.snoozes, ulid)
+	app.snoozeMu.Unlock()
+}
+
+// pruneSnoozes forgets snoozes on documents that have left the inbox.
+func (app *App) pruneSnoozes() {
+	inbox := make(map[string]bool, len(app.untagged))
+	for _, doc := range app.untagged {
+		inbox[doc.ULID] = true
+	}
+	app.snoozeMu.Lock()
+	var gone []string
+	for ulid := range app.snoozes {
+		if !inbox[ulid] {
+			gone = append(gone, ulid)
+		}
+	}
+	app.snoozeMu.Unlock()
+	for _, ulid := range gone {
+		app.deleteSnooze(ulid)
+	}
+}
+
+// handleSnooze takes a document out of the queue until the chosen wake time.
+func (app *App) handleSnooze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, name, pos := r.FormValue("ulid"), r.FormValue("name"), r.FormValue("pos")
+	until, ok := snoozeUntil(r.FormValue("for"), time.Now())
+	if ulid == "" || !ok {
+		http.Redirect(w, r, "/?pos="+pos+"&flash=Nothing to snooze", http.StatusSeeOther)
+		return
+	}
+	z := store.Snooze{ULID: ulid, Name: name, Until: until, User: sess.Name, Created: time.Now()}
+	if err := app.putSnooze(z); err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, false, errs.E(errs.Other, "snooze "+name, err))
+		return
+	}
+	if sess.Opened != nil && sess.Opened.ULID == ulid {
+		sess.Opened = nil
+	}
+	sess.record("snooze until "+until.Format("2 Jan"), ulid, name)
+	http.Redirect(w, r, "/?pos="+pos+"&flash=Snoozed "+name+" until "+until.Format("Mon 2 Jan"), http.StatusSeeOther)
+}
+
+type SnoozedPageData struct {
+	Page  string
+	User  string
+	Items []store.Snooze
+	Flash string
+}
+
+// handleSnoozed lists snoozed documents (GET) and wakes one early (POST).
+func (app *App) handleSnoozed(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if r.Method == "POST" {
+		if sess := app.requireUser(w, r); sess == nil {
+			return
+		}
+		ulid, name := r.FormValue("ulid"), r.FormValue("name")
+		if ulid != "" {
+			app.deleteSnooze(ulid)
+		}
+		http.Redirect(w, r, "/snoozed?flash=Woke "+name, http.StatusSeeOther)
+		return
+	}
+
+	data := SnoozedPageData{Page: "snoozed", Flash: r.URL.Query().Get("flash")}
+	if sess := app.currentUser(r); sess != nil {
+		data.User = sess.Name
+	}
+	now := time.Now()
+	app.snoozeMu.Lock()
+	for _, z := range app.snoozes {
+		if z.Until.After(now) {
+			data.Items = append(data.Items, z)
+		}
+	}
+	app.snoozeMu.Unlock()
+	sort.Slice(data.Items, func(i, j int) bool { return data.Items[i].Until.Before(data.Items[j].Until) })
+
+	app.templates().ExecuteTemplate(w, "snoozed.html", data)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+)
+
+// Startup checks everything before giving up, so a config can be fixed in
+// one pass rather than one error per run. Each profile's godocs server is
+// connected to and its config checked against the server's tags, the
+// external tools are probed, Ollama is tried and the cache directory is
+// written to, all at once. Every problem found is then reported together.
+// Ollama being down or a tool missing is only a warning: the inbox runs
+// without them, skipping what needs them.
+
+// startServerApps starts an App for each profile cfg selects, with the
+// tools probed, or fails with every problem found.
+func startServerApps(cfg Config, profile, record, replay string) ([]*App, error) {
+	var problems []error
+	if record != "" && replay != "" {
+		problems = append(problems, errors.New("-record and -replay cannot be used together"))
+	}
+	if cfg.ScratchMaxMB < 0 {
+		problems = append(problems, errors.New("scratch_max_mb must be positive"))
+	} else if err := scratch.init(appCacheDir(), cfg.ScratchMaxMB); err != nil {
+		problems = append(problems, fmt.Errorf("creating scratch directory: %w", err))
+	}
+	if err := setToolPaths(cfg.ToolPaths); err != nil {
+		problems = append(problems, err)
+	}
+	cfgs, err := cfg.profileConfigs(profile)
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	var ollamaURLs []string
+	for _, c := range cfgs {
+		if url := appFor(c).ollamaURL(); !slices.Contains(ollamaURLs, url) {
+			ollamaURLs = append(ollamaURLs, url)
+		}
+	}
+	var (
+		wg        sync.WaitGroup
+		tools     *ToolProbe
+		apps      = make([]*App, len(cfgs))
+		appErrs   = make([]error, len(cfgs))
+		ollamaErr = make([]error, len(ollamaURLs))
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tools = probeTools()
+	}()
+	for i, c := range cfgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			apps[i], appErrs[i] = newServerApp(c, record, replay)
+		}()
+	}
+	for i, url := range ollamaURLs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ollamaErr[i] = llm.ListModels(url)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range appErrs {
+		for _, e := range leafErrors(err) {
+			if cfgs[i].Profile != "" {
+				e = fmt.Errorf("profile %s: %w", cfgs[i].Profile, e)
+			}
+			problems = append(problems, e)
+		}
+	}
+	if len(problems) > 0 {
+		for _, app := range apps {
+			if app != nil {
+				app.store.Close()
+			}
+		}
+		return nil, startupError(problems)
+	}
+
+	tools.report()
+	for i, err := range ollamaErr {
+		if err != nil {
+			log.Printf("WARNING: Ollama at %s: %v (LLM stages skip local models until it is back)", ollamaURLs[i], err)
+		}
+	}
+	for _, app := range apps {
+		app.tools = tools
+		for _, d := range tools.disabled(*app.config()) {
+			if app.config().Profile != "" {
+				d = "profile " + app.config().Profile + ": " + d
+			}
+			log.Printf("WARNING: %s disabled", d)
+		}
+	}
+	return apps, nil
+}
+
+// leafErrors flattens errors joined with errors.Join.
+func leafErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var out []error
+	for _, e := range joined.Unwrap() {
+		out = append(out, leafErrors(e)...)
+	}
+	return out
+}
+
+// startupError lists problems one to a line.
+func startupError(problems []error) error {
+	var b strings.Builder
+	b.WriteString("startup checks failed:")
+	for _, p := range problems {
+		lines := strings.Split(p.Error(), "\n")
+		b.WriteString("\n  - " + lines[0])
+		for _, l := range lines[1:] {
+			b.WriteString("\n    " + l)
+		}
+	}
+	return errors.New(b.String())
+}
+
+// checkWritable checks a file can be made in dir, creating it if need be.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cache directory %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("cache directory %s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
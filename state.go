@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// Journal actions.
+const (
+	actionTag       = "tag"
+	actionUntag     = "untag"
+	actionDelete    = "delete"    // document deleted as a duplicate
+	actionArchive   = "archive"   // moved to archive_folder untagged (see archive.go)
+	actionUnarchive = "unarchive" // archive undone
+)
+
+// appCacheDir is the per-user cache directory for thumbnails and local state.
+func appCacheDir() string {
+	cacheDir, _ := os.UserCacheDir()
+	return filepath.Join(cacheDir, "godocs-inbox")
+}
+
+// cacheDir is where a config keeps its local state, document text and
+// thumbnails: appCacheDir, or a directory of its own for a profile.
+func (c Config) cacheDir() string {
+	if c.localDir != "" {
+		return c.localDir
+	}
+	if c.Profile == "" {
+		return appCacheDir()
+	}
+	return filepath.Join(appCacheDir(), "profiles", c.Profile)
+}
+
+// statePath is the server-mode state database location.
+func (c Config) statePath() string {
+	return filepath.Join(c.cacheDir(), "state.db")
+}
+
+// openState opens the state database, importing a JSON Lines action journal
+// left by earlier versions if one exists next to it.
+func openState(path, legacyJournal string) (*store.Store, error) {
+	st, err := store.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := importJournal(st, legacyJournal); err != nil {
+		log.Printf("state: importing %s: %v", legacyJournal, err)
+	}
+	return st, nil
+}
+
+// importJournal copies entries from an actions.jsonl journal into the store
+// and renames the file so it is only imported once.
+func importJournal(st *store.Store, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	n := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var a store.Action
+		if json.Unmarshal(sc.Bytes(), &a) != nil {
+			continue
+		}
+		if err := st.AddAction(a); err != nil {
+			f.Close()
+			return err
+		}
+		n++
+	}
+	f.Close()
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	log.Printf("state: imported %d journal entries from %s", n, path)
+	return os.Rename(path, path+".imported")
+}
+
+// loadState restores LLM-date flags, job failures, document hashes,
+// embeddings, snoozes, OCR quality scores and pending source tags saved by
+// a previous run.
+func (app *App) loadState() error {
+	ulids, err := app.store.LLMDates()
+	if err != nil {
+		return fmt.Errorf("loading LLM dates: %w", err)
+	}
+	for _, u := range ulids {
+		app.llmDates[u] = true
+	}
+	failures, err := app.store.Failures()
+	if err != nil {
+		return fmt.Errorf("loading failures: %w", err)
+	}
+	for _, f := range failures {
+		app.failures[f.ULID] = &JobFailure{Stage: f.Stage, DocType: f.DocType, Error: f.Error, Attempts: f.Attempts, Time: f.Time}
+	}
+	hashes, err := app.store.Hashes()
+	if err != nil {
+		return fmt.Errorf("loading hashes: %w", err)
+	}
+	for _, h := range hashes {
+		app.hashes[h.ULID] = h
+	}
+	embeddings, err := app.store.Embeddings(app.embeddingModel())
+	if err != nil {
+		return fmt.Errorf("loading embeddings: %w", err)
+	}
+	for _, e := range embeddings {
+		app.embeddings[e.ULID] = e
+	}
+	snoozes, err := app.store.Snoozes()
+	if err != nil {
+		return fmt.Errorf("loading snoozes: %w", err)
+	}
+	for _, z := range snoozes {
+		app.snoozes[z.ULID] = z
+	}
+	qualities, err := app.store.OCRQualities()
+	if err != nil {
+		return fmt.Errorf("loading OCR quality: %w", err)
+	}
+	for _, q := range qualities {
+		app.ocrQuality[q.ULID] = q
+	}
+	summaries, err := app.store.Summaries()
+	if err != nil {
+		return fmt.Errorf("loading summaries: %w", err)
+	}
+	for ulid, s := range summaries {
+		app.summaries[ulid] = s
+	}
+	proposed, err := app.store.TagsProposed()
+	if err != nil {
+		return fmt.Errorf("loading tag proposals: %w", err)
+	}
+	for _, ulid := range proposed {
+		app.tagsProposed[ulid] = true
+	}
+	languages, err := app.store.Languages()
+	if err != nil {
+		return fmt.Errorf("loading languages: %w", err)
+	}
+	for _, l := range languages {
+		app.languages[l.ULID] = l
+	}
+	candidates, err := app.store.DateCandidates()
+	if err != nil {
+		return fmt.Errorf("loading date candidates: %w", err)
+	}
+	for ulid, c := range candidates {
+		app.dateCandidates[ulid] = c
+	}
+	ingests, err := app.store.UntaggedIngests()
+	if err != nil {
+		return fmt.Errorf("loading ingested files: %w", err)
+	}
+	for _, i := range ingests {
+		app.sourceTags[i.ULID] = i.TagID
+	}
+	return nil
+}
+
+// sessionState is the persisted part of a UserSession.
+type sessionState struct {
+	RecentSets []RecentTagSet
+	UndoStack  []*LastAction
+	History    []HistoryEntry
+	Stats      UserStats
+	Folder     string
+	Bucket     int
+	Oldest     bool
+}
+
+const sessionStateKey = "session"
+
+// save persists the session's recent sets, undo stack, history, stats,
+// folder filter, detail pass bucket and queue order.
+func (s *UserSession) save() {
+	if s.store == nil {
+		return
+	}
+	st := sessionState{RecentSets: s.RecentSets, UndoStack: s.UndoStack, History: s.History, Stats: s.Stats, Folder: s.Folder, Bucket: s.Bucket, Oldest: s.Oldest}
+	if err := s.store.PutUserState(s.Name, sessionStateKey, st); err != nil {
+		log.Printf("state: saving session %q: %v", s.Name, err)
+	}
+}
+
+// load restores the session saved by a previous run, if any.
+func (s *UserSession) load() {
+	if s.store == nil {
+		return
+	}
+	var st sessionState
+	ok, err := s.store.UserState(s.Name, sessionStateKey, &st)
+	if err != nil {
+		log.Printf("state: loading session %q: %v", s.Name, err)
+		return
+	}
+	if ok {
+		s.RecentSets, s.UndoStack, s.History, s.Stats, s.Folder, s.Bucket, s.Oldest = st.RecentSets, st.UndoStack, st.History, st.Stats, st.Folder, st.Bucket, st.Oldest
+	}
+}
+
+// journalTag records tags applied to (or removed from) a document.
+func (app *App) journalTag(sess *UserSession, action, ulid, docName string, tags ...TagSetEntry) {
+	user := ""
+	if sess != nil {
+		user = sess.Name
+	}
+	for _, t := range tags {
+		a := store.Action{User: user, Action: action, ULID: ulid, DocName: docName, TagID: t.ID, TagName: t.Name}
+		if err := app.store.AddAction(a); err != nil {
+			log.Printf("journal: %v", err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Service worker for godocs-inbox: keeps visited pages and Bulma available
+// offline. Tag/undo actions taken offline are queued by the page itself
+// (localStorage) and replayed through /api/replay when back online.
+var CACHE = 'godocs-inbox-v2';
+var BASE = self.registration.scope; // inbox root, honouring base_path
+var BULMA = 'https://cdn.jsdelivr.net/npm/bulma@0.9.4/css/bulma.min.css';
+
+self.addEventListener('install', function(e) {
+    e.waitUntil(caches.open(CACHE).then(function(c) {
+        return c.addAll([BASE, BASE + 'static/icon.svg', BASE + 'manifest.webmanifest', BULMA]);
+    }).catch(function() {}));
+    self.skipWaiting();
+});
+
+self.addEventListener('activate', function(e) {
+    e.waitUntil(caches.keys().then(function(keys) {
+        return Promise.all(keys.filter(function(k) { return k !== CACHE; })
+            .map(function(k) { return caches.delete(k); }));
+    }).then(function() { return self.clients.claim(); }));
+});
+
+self.addEventListener('fetch', function(e) {
+    var req = e.request;
+    if (req.method !== 'GET') return;
+    var url = new URL(req.url);
+
+    // Bulma and static assets: cache first
+    if (req.url === BULMA || req.url.indexOf(BASE + 'static/') === 0) {
+        e.respondWith(caches.match(req).then(function(hit) {
+            return hit || fetch(req).then(function(resp) {
+                var copy = resp.clone();
+                caches.open(CACHE).then(function(c) { c.put(req, copy); });
+                return resp;
+            });
+        }));
+        return;
+    }
+    if (url.origin !== self.location.origin) return;
+
+    // Pages and thumbnails: network first, falling back to the last copy
+    e.respondWith(fetch(req).then(function(resp) {
+        if (resp.ok) {
+            var copy = resp.clone();
+            caches.open(CACHE).then(function(c) { c.put(req, copy); });
+        }
+        return resp;
+    }).catch(function() {
+        return caches.match(req).then(function(hit) {
+            return hit || (req.mode === 'navigate' ? caches.match(BASE) : Response.error());
+        });
+    }));
+});
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+const maxRecentErrors = 20
+
+// PipelineError is a background processing failure kept for the status page.
+type PipelineError struct {
+	Time    time.Time
+	Stage   string
+	ULID    string
+	Message string
+}
+
+// errorLog is a bounded, newest-first list of recent pipeline errors.
+type errorLog struct {
+	mu      sync.Mutex
+	entries []PipelineError
+}
+
+func (l *errorLog) add(e PipelineError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append([]PipelineError{e}, l.entries...)
+	if len(l.entries) > maxRecentErrors {
+		l.entries = l.entries[:maxRecentErrors]
+	}
+}
+
+func (l *errorLog) list() []PipelineError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.entries)
+}
+
+// pipelineErrorf logs a background failure with the given stage prefix
+// (e.g. "OCR") and records it for display on the status page.
+func (app *App) pipelineErrorf(stage, ulid, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	pipelineLog.Printf("%s: %s", stage, msg)
+	app.errors.add(PipelineError{Time: time.Now(), Stage: stage, ULID: ulid, Message: msg})
+}
+
+type ToolStatus struct {
+	Name    string
+	Path    string // the binary run, from tools or the name
+	Version string
+	Error   string
+}
+
+// TaskModels is an LLM task's fallback list, marking the Ollama models
+// that are pulled.
+type TaskModels struct {
+	Task   string
+	Models []ModelStatus
+}
+
+type ModelStatus struct {
+	Name   string
+	Pulled bool
+}
+
+type StatusReport struct {
+	GodocsOK      bool
+	GodocsLatency time.Duration
+	GodocsError   string
+
+	OllamaURL    string
+	OllamaModel  string
+	OllamaOK     bool
+	OllamaError  string
+	ModelPulled  bool
+	LoadedModels []string
+	TaskModels   []TaskModels // shown when models are configured per task
+
+	Tools             []ToolStatus
+	OCRLanguages      []string // tesseract's language packs
+	OCRLanguagesError string
+	ToolsDisabled     []string // features off for want of a tool
+
+	ThumbCacheFiles int
+	ThumbCacheBytes int64
+	ScratchFiles    int // top-level entries in the scratch dir
+	ScratchInUse    int
+	ScratchBytes    int64
+	ScratchMax      int64
+	ResponseCache   int // cached godocs responses
+	TextCache       int // cached document texts
+
+	QueueOCR     int
+	QueueLLM     int
+	FailedJobs   int
+	Untagged     int
+	UntaggedTime time.Time
+
+	RateLimit   int   // requests per minute per IP; 0 when disabled
+	RateLimited int64 // requests rejected with 429
+	Oversized   int64 // requests rejected with 413
+
+	RecentErrors []PipelineError
+	LLMUsage     []store.LLMUsage // by day and model, newest first
+}
+
+// collectStatus probes godocs, Ollama and the OCR tools concurrently and
+// snapshots the pipeline state. It takes app.mu itself, so callers must not hold it.
+func collectStatus(app *App) *StatusReport {
+	st := &StatusReport{
+		OllamaURL:   app.ollamaURL(),
+		OllamaModel: app.ollamaModel(),
+	}
+
+	var wg sync.WaitGroup
+	if app.client != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, err := app.docs.Ping()
+			st.GodocsLatency = latency.Round(time.Millisecond)
+			if err != nil {
+				st.GodocsError = err.Error()
+				return
+			}
+			st.GodocsOK = true
+		}()
+	}
+
+	var pulled []string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		models, err := llm.ListModels(st.OllamaURL)
+		if err != nil {
+			st.OllamaError = err.Error()
+			return
+		}
+		st.OllamaOK = true
+		pulled = models
+		st.ModelPulled = slices.Contains(models, st.OllamaModel)
+		st.LoadedModels, _ = llm.LoadedModels(st.OllamaURL)
+	}()
+
+	// The startup probe, as the pipeline goes by it; demo mode has none
+	tools := app.tools
+	if tools == nil {
+		tools = probeTools()
+	}
+	st.Tools, st.OCRLanguages, st.OCRLanguagesError = tools.Tools, tools.Languages, tools.LangError
+	st.ToolsDisabled = tools.disabled(*app.config())
+
+	if app.client != nil {
+		st.ResponseCache = app.client.cache.size()
+		st.TextCache = app.client.texts.size()
+	}
+
+	if app.thumbDir != "" {
+		filepath.WalkDir(app.thumbDir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				st.ThumbCacheFiles++
+				st.ThumbCacheBytes += info.Size()
+			}
+			return nil
+		})
+	}
+
+	st.ScratchFiles, st.ScratchInUse, st.ScratchBytes, st.ScratchMax = scratch.usage()
+
+	app.processingMu.Lock()
+	for _, job := range app.docStage {
+		switch job.Stage {
+		case stageOCR:
+			st.QueueOCR++
+		case stageLLM:
+			st.QueueLLM++
+		}
+	}
+	st.FailedJobs = len(app.failures)
+	app.processingMu.Unlock()
+
+	app.mu.Lock()
+	st.Untagged = len(app.untagged)
+	st.UntaggedTime = app.untaggedTime
+	app.mu.Unlock()
+
+	if app.limiter != nil {
+		st.RateLimit, _ = app.config().Limits.rate()
+		st.RateLimited = app.limiter.rejected.Load()
+	}
+	st.Oversized = app.oversized.Load()
+
+	st.RecentErrors = app.errors.list()
+	st.LLMUsage = app.recentLLMUsage()
+
+	wg.Wait()
+	if app.config().Models.configured() {
+		for _, task := range llmTasks {
+			tm := TaskModels{Task: task}
+			for _, m := range app.models(task) {
+				tm.Models = append(tm.Models, ModelStatus{Name: m.String(), Pulled: m.Remote || slices.Contains(pulled, m.Name)})
+			}
+			st.TaskModels = append(st.TaskModels, tm)
+		}
+	}
+	return st
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
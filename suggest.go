@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+const (
+	suggestKey            = "s" // reserved key to apply the top suggested tag set
+	suggestNeighbours     = 5   // tagged documents consulted per suggestion
+	maxSuggestions        = 3
+	defaultEmbeddingModel = "nomic-embed-text"
+)
+
+// TagSuggestion is a tag set carried by documents similar to the current
+// one. Score is the summed similarity of the neighbours that carry it.
+type TagSuggestion struct {
+	RecentTagSet
+	Score      float64
+	Neighbours int
+}
+
+func (app *App) embeddingModel() string {
+	if app.config().EmbeddingModel != "" {
+		return app.config().EmbeddingModel
+	}
+	return defaultEmbeddingModel
+}
+
+// startEmbedding computes the text embedding of an inbox document in the
+// background unless it has one already.
+func (app *App) startEmbedding(ulid, text string) {
+	if app.ollama.isOffline() {
+		// Embedded when next shown after Ollama is back
+		return
+	}
+	app.processingMu.Lock()
+	_, done := app.embeddings[ulid]
+	busy := app.embedding[ulid]
+	if !done && !busy {
+		app.embedding[ulid] = true
+	}
+	app.processingMu.Unlock()
+	if done || busy {
+		return
+	}
+
+	go func() {
+		defer func() {
+			app.processingMu.Lock()
+			delete(app.embedding, ulid)
+			app.processingMu.Unlock()
+		}()
+		vec, err := llm.Embed(app.ollamaURL(), app.embeddingModel(), text)
+		if err != nil {
+			app.pipelineErrorf("suggest", ulid, "embedding failed for %s: %v", ulid, err)
+			return
+		}
+		app.putEmbedding(store.Embedding{ULID: ulid, Model: app.embeddingModel(), Vector: vec})
+		log.Printf("suggest: embedded %s", ulid)
+	}()
+}
+
+func (app *App) putEmbedding(e store.Embedding) {
+	if err := app.store.PutEmbedding(e); err != nil {
+		log.Printf("state: %v", err)
+	}
+	app.processingMu.Lock()
+	app.embeddings[e.ULID] = e
+	app.processingMu.Unlock()
+}
+
+// learnTagSet records the tags a document was filed with, so it can inform
+// suggestions for similar documents.
+func (app *App) learnTagSet(ulid string, tags []GodocsTag) {
+	app.processingMu.Lock()
+	e, ok := app.embeddings[ulid]
+	app.processingMu.Unlock()
+	if !ok {
+		return
+	}
+	e.TagIDs = nil
+	for _, t := range tags {
+		e.TagIDs = append(e.TagIDs, t.ID)
+	}
+	slices.Sort(e.TagIDs)
+	app.putEmbedding(e)
+}
+
+// suggestTagSets returns the tag sets of the tagged documents nearest to
+// ulid, best first. Callers must hold app.mu.
+func (app *App) suggestTagSets(ulid string) []TagSuggestion {
+	app.processingMu.Lock()
+	target, ok := app.embeddings[ulid]
+	type neighbour struct {
+		tagIDs []int
+		sim    float64
+	}
+	var near []neighbour
+	if ok {
+		for _, e := range app.embeddings {
+			if e.ULID == ulid || len(e.TagIDs) == 0 {
+				continue
+			}
+			near = append(near, neighbour{e.TagIDs, llm.Cosine(target.Vector, e.Vector)})
+		}
+	}
+	app.processingMu.Unlock()
+
+	sort.Slice(near, func(i, j int) bool { return near[i].sim > near[j].sim })
+	near = near[:min(len(near), suggestNeighbours)]
+
+	bySet := make(map[string]*TagSuggestion)
+	var out []*TagSuggestion
+	for _, n := range near {
+		key := fmt.Sprint(n.tagIDs)
+		s := bySet[key]
+		if s == nil {
+			var names []string
+			s = &TagSuggestion{}
+			for _, id := range n.tagIDs {
+				t, ok := app.docs.Tag(id)
+				if !ok {
+					continue
+				}
+				s.Tags = append(s.Tags, TagSetEntry{ID: t.ID, Name: t.Name, Color: t.Color})
+				names = append(names, t.Name)
+			}
+			if len(s.Tags) == 0 {
+				continue
+			}
+			sort.Strings(names)
+			s.Label = strings.Join(names, ", ")
+			bySet[key] = s
+			out = append(out, s)
+		}
+		s.Score += n.sim
+		s.Neighbours++
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+
+	var suggestions []TagSuggestion
+	for _, s := range out[:min(len(out), maxSuggestions)] {
+		suggestions = append(suggestions, *s)
+	}
+	return suggestions
+}
+
+// runEmbeddingsScan embeds every tagged document not yet embedded and
+// refreshes the stored tag sets, seeding suggestions from the archive.
+func runEmbeddingsScan(cfg Config, out io.Writer) error {
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	st, err := store.Open(cfg.statePath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	app := appFor(cfg)
+	model := app.embeddingModel()
+
+	known := make(map[string]store.Embedding)
+	existing, err := st.Embeddings(model)
+	if err != nil {
+		return err
+	}
+	for _, e := range existing {
+		known[e.ULID] = e
+	}
+
+	// Tag sets come from walking each tag's document list
+	tags, err := client.FetchTags()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	docTags := make(map[string][]int)
+	var order []string
+	for _, t := range tags {
+		for doc, err := range client.IterateDocuments(ctx, t.ID) {
+			if err != nil {
+				return fmt.Errorf("listing tag %s: %w", t.Name, err)
+			}
+			if _, seen := docTags[doc.ULID]; !seen {
+				order = append(order, doc.ULID)
+			}
+			docTags[doc.ULID] = append(docTags[doc.ULID], t.ID)
+		}
+	}
+
+	embedded, updated, failed := 0, 0, 0
+	for _, ulid := range order {
+		ids := docTags[ulid]
+		slices.Sort(ids)
+		e, ok := known[ulid]
+		if ok {
+			if slices.Equal(e.TagIDs, ids) {
+				continue
+			}
+			updated++
+		} else {
+			text, err := client.FetchDocText(ctx, ulid)
+			if err == nil && text == "" {
+				continue
+			}
+			var vec []float32
+			if err == nil {
+				vec, err = llm.Embed(app.ollamaURL(), model, text)
+			}
+			if err != nil {
+				fmt.Fprintf(out, "  %s: %v\n", ulid, err)
+				failed++
+				continue
+			}
+			e = store.Embedding{ULID: ulid, Model: model, Vector: vec}
+			embedded++
+		}
+		e.TagIDs = ids
+		if err := st.PutEmbedding(e); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "Embedded %d documents, updated tags on %d (%d failed)\n", embedded, updated, failed)
+	return nil
+}
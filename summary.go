@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+)
+
+// summarizeDocument asks the LLM for a short summary of the document's text,
+// shown on the inbox page above the raw text, and keeps it in the state
+// database.
+func summarizeDocument(app *App, ulid, text string) {
+	summary, err := withModels(app, taskSummary, ulid, func(m llm.Model) (string, error) {
+		return llm.Summarize(m, app.config().prompts, app.promptVars(text))
+	})
+	if errors.Is(err, errLLMOffline) {
+		// Tried again when next shown
+		app.mu.Lock()
+		delete(app.summaries, ulid)
+		app.mu.Unlock()
+		return
+	}
+	if err != nil {
+		app.pipelineErrorf("summary", ulid, "summary failed for %s: %v", ulid, err)
+		app.recordFailure(ulid, pipelineSummary, "", err)
+		return
+	}
+	app.clearFailure(ulid, pipelineSummary)
+	log.Printf("summary: %s summarised (%d chars)", ulid, len(summary))
+
+	app.mu.Lock()
+	app.summaries[ulid] = summary
+	app.mu.Unlock()
+	if err := app.store.PutSummary(ulid, summary); err != nil {
+		log.Printf("state: %v", err)
+	}
+}
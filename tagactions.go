@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// TagActionConfig runs an action when a tag is applied from the inbox (by a
+// shortcut, a tag set or a confirmed document type). Each entry sets one of
+// Delete, Webhook or Folder:
+//
+//	tag_actions:
+//	  - tag_id: 40              # trash
+//	    delete: true
+//	  - tag_id: 41              # to-print
+//	    webhook: http://printer.local/hook
+//	    secret: s3cret          # optional, signs the body as for webhooks
+//	  - tag_id: 42              # shred
+//	    folder: /archive/shred
+type TagActionConfig struct {
+	TagID   int    `yaml:"tag_id"`
+	Delete  bool   `yaml:"delete,omitempty"`  // delete the document from godocs
+	Webhook string `yaml:"webhook,omitempty"` // POST the document.tagged event here
+	Secret  string `yaml:"secret,omitempty"`
+	Folder  string `yaml:"folder,omitempty"` // move the document to this godocs folder
+}
+
+func (a TagActionConfig) describe() string {
+	switch {
+	case a.Delete:
+		return "deleted"
+	case a.Webhook != "":
+		return "sent to " + a.Webhook
+	}
+	return "moved to " + a.Folder
+}
+
+// validateTagActions checks that each action names a known tag and does
+// exactly one thing.
+func validateTagActions(client DocumentStore, actions []TagActionConfig) error {
+	for _, a := range actions {
+		if _, ok := client.Tag(a.TagID); !ok {
+			return fmt.Errorf("tag_actions: tag_id %d not found on server", a.TagID)
+		}
+		n := 0
+		for _, set := range []bool{a.Delete, a.Webhook != "", a.Folder != ""} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("tag_actions: tag_id %d needs exactly one of delete, webhook or folder", a.TagID)
+		}
+	}
+	return nil
+}
+
+// runTagActions runs the actions configured for tags just applied to doc,
+// records them in sess's history, and returns what was done for the flash
+// and whether the document was deleted. A failed action does not stop the
+// others; the failures are returned joined. Deletion runs last. Callers
+// must hold app.mu.
+func (app *App) runTagActions(ctx context.Context, sess *UserSession, doc GodocsDocument, tagIDs ...int) (done string, deleted bool, err error) {
+	var todo []TagActionConfig
+	for _, a := range app.config().TagActions {
+		if slices.Contains(tagIDs, a.TagID) {
+			todo = append(todo, a)
+		}
+	}
+	slices.SortStableFunc(todo, func(a, b TagActionConfig) int {
+		if a.Delete == b.Delete {
+			return 0
+		} else if a.Delete {
+			return 1
+		}
+		return -1
+	})
+
+	var did []string
+	var failed []error
+	for _, a := range todo {
+		t, _ := app.docs.Tag(a.TagID)
+		tag := t.Name
+		var err error
+		switch {
+		case a.Delete:
+			err = app.docs.DeleteDocument(doc.ULID)
+			if err == nil {
+				app.deleteHash(doc.ULID)
+				if err := app.store.AddAction(store.Action{User: sess.Name, Action: actionDelete, ULID: doc.ULID, DocName: doc.Name}); err != nil {
+					log.Printf("journal: %v", err)
+				}
+				deleted = true
+				sess.release(doc.ULID)
+			}
+		case a.Webhook != "":
+			err = postWebhook(ctx, WebhookConfig{URL: a.Webhook, Secret: a.Secret}, app.taggedEvent(doc.ULID, doc.Name, sess.Name, tag))
+		default:
+			err = app.docs.MoveDocument(doc.ULID, a.Folder)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", tag, err))
+			continue
+		}
+		log.Printf("tag action: %s %s (%s)", doc.ULID, a.describe(), tag)
+		sess.record(tag+": "+a.describe(), doc.ULID, doc.Name)
+		did = append(did, a.describe())
+	}
+	if len(did) > 0 {
+		done = " — " + strings.Join(did, ", ")
+	}
+	return done, deleted, errors.Join(failed...)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// Duplicate tags ("Bank" and "bank") are merged from the Tags page or with
+// `tags merge <keep-id> <duplicate-id>`: each document carrying the
+// duplicate is given the surviving tag and loses the duplicate, a page at a
+// time, then the duplicate is deleted. A merge stopped part way can be run
+// again; the documents already moved no longer carry the duplicate.
+
+// mergePageSize is how many of the duplicate's documents are fetched at once.
+const mergePageSize = 100
+
+// TagMerge is a merge's progress, shown on the Tags page.
+type TagMerge struct {
+	Keep, Dup GodocsTag
+	Done      int // documents moved
+	Total     int // documents carrying the duplicate, as last counted
+	Finished  bool
+	Error     string
+}
+
+// tagRefs names the config settings that use a tag; the inbox would not
+// start with them once the tag is deleted.
+func tagRefs(cfg Config, id int) []string {
+	var refs []string
+	for _, s := range cfg.Shortcuts {
+		if s.TagID == id {
+			refs = append(refs, "tags (key "+s.Key+")")
+		}
+	}
+	for _, p := range cfg.Presets {
+		if slices.Contains(p.TagIDs, id) {
+			refs = append(refs, "presets ("+p.Name+")")
+		}
+	}
+	for _, l := range cfg.Layers {
+		for _, s := range l.Shortcuts {
+			if s.TagID == id {
+				refs = append(refs, "layers ("+l.Name+", key "+s.Key+")")
+			}
+		}
+	}
+	for _, u := range cfg.Users {
+		for _, s := range u.Shortcuts {
+			if s.TagID == id {
+				refs = append(refs, "users ("+u.Name+", key "+s.Key+")")
+			}
+		}
+		for _, p := range u.Presets {
+			if slices.Contains(p.TagIDs, id) {
+				refs = append(refs, "users ("+u.Name+", preset "+p.Name+")")
+			}
+		}
+	}
+	for _, b := range cfg.QuickSort {
+		if b.TagID == id {
+			refs = append(refs, "quick_sort (key "+b.Key+")")
+		}
+	}
+	for _, a := range cfg.TagActions {
+		if a.TagID == id {
+			refs = append(refs, "tag_actions")
+		}
+	}
+	for _, rule := range cfg.AutoTag.Rules {
+		if slices.Contains(rule.TagIDs, id) {
+			refs = append(refs, "auto_tag ("+rule.Match+")")
+		}
+	}
+	if slices.Contains(cfg.Expenses.TagIDs, id) {
+		refs = append(refs, "expenses")
+	}
+	if cfg.S3.TagID == id {
+		refs = append(refs, "s3")
+	}
+	for i, d := range cfg.CloudDrives {
+		if d.TagID == id {
+			refs = append(refs, fmt.Sprintf("cloud_drives (drive %d)", i+1))
+		}
+	}
+	return refs
+}
+
+// checkMerge returns the tags to merge, or why they cannot be. The tags
+// are refetched, not taken from the response cache.
+func checkMerge(client DocumentStore, cfg Config, keepID, dupID int) (keep, dup GodocsTag, err error) {
+	if c, ok := client.(*GodocsClient); ok {
+		c.invalidateTags()
+	}
+	if _, err := client.FetchTags(); err != nil {
+		return keep, dup, err
+	}
+	keep, ok := client.Tag(keepID)
+	if !ok {
+		return keep, dup, fmt.Errorf("tag %d not found on server", keepID)
+	}
+	dup, ok = client.Tag(dupID)
+	if !ok {
+		return keep, dup, fmt.Errorf("tag %d not found on server", dupID)
+	}
+	if keepID == dupID {
+		return keep, dup, fmt.Errorf("choose two different tags")
+	}
+	if refs := tagRefs(cfg, dupID); len(refs) > 0 {
+		return keep, dup, fmt.Errorf("%s is used in %s; change the config to tag %d first", dup.Name, strings.Join(refs, ", "), keepID)
+	}
+	return keep, dup, nil
+}
+
+// mergeTags moves every document from tag dup to tag keep, then deletes
+// dup. progress is called after each document.
+func mergeTags(ctx context.Context, client DocumentStore, keep, dup int, progress func(done, total int)) error {
+	moved := map[string]bool{}
+	for {
+		sr, err := client.FetchTagged(ctx, dup, 1, mergePageSize)
+		if err != nil {
+			return err
+		}
+		fresh := 0
+		for _, d := range sr.Documents {
+			if moved[d.ULID] {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := client.AddTag(d.ULID, keep); err != nil {
+				return fmt.Errorf("tagging %s: %w", d.Name, err)
+			}
+			if err := client.RemoveTag(d.ULID, dup); err != nil {
+				return fmt.Errorf("untagging %s: %w", d.Name, err)
+			}
+			moved[d.ULID] = true
+			fresh++
+			progress(len(moved), len(moved)+sr.TotalCount-fresh)
+		}
+		if len(sr.Documents) == 0 {
+			break
+		}
+		if fresh == 0 {
+			// godocs has not caught up with the removals yet
+			return fmt.Errorf("godocs still lists %d documents under the duplicate; run the merge again later", sr.TotalCount)
+		}
+	}
+	return client.DeleteTag(dup)
+}
+
+// handleTagMerge starts a merge in the background from the Tags page;
+// the page shows its progress.
+func (app *App) handleTagMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/tags/stats", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	if app.tagMerge != nil && !app.tagMerge.Finished {
+		app.fail(w, r, sess, "/tags/stats", false, errs.New(errs.Validation, "merge tags", "a merge is already running"))
+		return
+	}
+	keepID, _ := strconv.Atoi(r.FormValue("keep"))
+	dupID, _ := strconv.Atoi(r.FormValue("dup"))
+	keep, dup, err := checkMerge(app.docs, *app.config(), keepID, dupID)
+	if err != nil {
+		app.fail(w, r, sess, "/tags/stats", false, errs.E(errs.Validation, "merge tags", err))
+		return
+	}
+	m := &TagMerge{Keep: keep, Dup: dup}
+	app.tagMerge = m
+	user := sess.Name
+	go func() {
+		err := mergeTags(context.Background(), app.docs, keep.ID, dup.ID, func(done, total int) {
+			app.mu.Lock()
+			m.Done, m.Total = done, total
+			app.mu.Unlock()
+		})
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		m.Finished = true
+		if err != nil {
+			m.Error = err.Error()
+			log.Printf("tags: merging %s into %s for %s: %v", dup.Name, keep.Name, user, err)
+			return
+		}
+		log.Printf("tags: %s merged %s into %s (%d documents)", user, dup.Name, keep.Name, m.Done)
+		app.docs.FetchTags()
+	}()
+	http.Redirect(w, r, "/tags/stats?flash="+url.QueryEscape("Merging "+dup.Name+" into "+keep.Name), http.StatusSeeOther)
+}
+
+// runTagsMerge implements `tags merge <keep-id> <duplicate-id>`.
+func runTagsMerge(cfg Config, keepArg, dupArg string, out io.Writer) error {
+	keepID, err1 := strconv.Atoi(keepArg)
+	dupID, err2 := strconv.Atoi(dupArg)
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("tag IDs must be numbers")
+	}
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	keep, dup, err := checkMerge(client, cfg, keepID, dupID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Merging %s (id=%d) into %s (id=%d)\n", dup.Name, dup.ID, keep.Name, keep.ID)
+	moved := 0
+	err = mergeTags(context.Background(), client, keep.ID, dup.ID, func(done, total int) {
+		moved = done
+		if done%mergePageSize == 0 || done == total {
+			fmt.Fprintf(out, "  %d/%d documents\n", done, total)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("after %d documents: %w", moved, err)
+	}
+	fmt.Fprintf(out, "Moved %d documents and deleted %s\n", moved, dup.Name)
+	return nil
+}
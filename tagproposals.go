@@ -0,0 +1,264 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+// The tag_proposals pipeline stage asks the LLM, once per document, for
+// tags it should be filed under that the server does not have, such as its
+// correspondent. Rather than being created blindly, each becomes a
+// proposal (name, group and colour, the group's most common colour) on the
+// Tags → Proposals page, gathering the documents it is proposed for.
+// Approving one, with its name, group and colour as edited there, creates
+// the tag (or finds it, if it was created meanwhile) and applies it to
+// those documents. A rejected proposal is kept, so the same name is not
+// proposed again.
+
+const defaultTagColor = "#3498db"
+
+// proposeTags asks the LLM for new tags for a document and adds them to
+// the proposals.
+func proposeTags(app *App, ulid, text string) {
+	proposals, err := withModels(app, taskTags, ulid, func(m llm.Model) ([]llm.TagProposal, error) {
+		return llm.ProposeTags(m, app.config().prompts, app.promptVars(text))
+	})
+	if errors.Is(err, errLLMOffline) {
+		// Tried again when next shown
+		app.mu.Lock()
+		delete(app.tagsProposed, ulid)
+		app.mu.Unlock()
+		return
+	}
+	if err != nil {
+		app.pipelineErrorf("tags", ulid, "tag proposals failed for %s: %v", ulid, err)
+		app.recordFailure(ulid, pipelineTagProposals, "", err)
+		return
+	}
+	app.clearFailure(ulid, pipelineTagProposals)
+	if err := app.store.SetTagsProposed(ulid); err != nil {
+		log.Printf("state: %v", err)
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.tagsProposed[ulid] = true
+	if len(proposals) == 0 {
+		return
+	}
+	existing, err := app.store.TagProposals()
+	if err != nil {
+		log.Printf("state: %v", err)
+		return
+	}
+	doc := store.ProposalDoc{ULID: ulid, Name: app.untaggedName(ulid)}
+	for _, t := range proposals {
+		if _, ok := app.findTag(t.Name, ""); ok {
+			continue // created since the prompt was made
+		}
+		p := store.TagProposal{Name: t.Name, Group: t.Group, Color: app.groupColor(t.Group), Reason: t.Reason, Created: time.Now()}
+		if i := slices.IndexFunc(existing, func(e store.TagProposal) bool { return strings.EqualFold(e.Name, t.Name) }); i >= 0 {
+			p = existing[i]
+			if p.Rejected || slices.ContainsFunc(p.Docs, func(d store.ProposalDoc) bool { return d.ULID == ulid }) {
+				continue
+			}
+		}
+		p.Docs = append(p.Docs, doc)
+		if err := app.store.PutTagProposal(p); err != nil {
+			log.Printf("state: %v", err)
+			continue
+		}
+		log.Printf("tags: proposed %q (%s) for %s: %s", p.Name, groupLabel(p.Group), ulid, t.Reason)
+	}
+}
+
+// untaggedName returns the name of a document in the inbox, or its ULID.
+// Callers must hold app.mu.
+func (app *App) untaggedName(ulid string) string {
+	for _, d := range app.untagged {
+		if d.ULID == ulid {
+			return d.Name
+		}
+	}
+	return ulid
+}
+
+// findTag returns the server's tag named name, in any case, within group
+// if it is set.
+func (app *App) findTag(name, group string) (GodocsTag, bool) {
+	for _, t := range app.docs.KnownTags() {
+		if strings.EqualFold(t.Name, name) && (group == "" || t.TagGroup == group) {
+			return t, true
+		}
+	}
+	return GodocsTag{}, false
+}
+
+// groupColor is the colour most of group's tags have, so a new tag looks
+// like its neighbours.
+func (app *App) groupColor(group string) string {
+	counts := make(map[string]int)
+	for _, t := range app.docs.KnownTags() {
+		if group != "" && t.TagGroup == group && t.Color != "" {
+			counts[t.Color]++
+		}
+	}
+	colors := slices.Sorted(maps.Keys(counts))
+	if len(colors) == 0 {
+		return defaultTagColor
+	}
+	return slices.MaxFunc(colors, func(a, b string) int { return cmp.Compare(counts[a], counts[b]) })
+}
+
+// pendingTagProposals is the number of proposals to review, for the nav
+// badge.
+func (app *App) pendingTagProposals() int {
+	proposals, err := app.store.TagProposals()
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, p := range proposals {
+		if !p.Rejected {
+			n++
+		}
+	}
+	return n
+}
+
+type TagProposalsPageData struct {
+	Page      string
+	User      string
+	Proposals []store.TagProposal
+	Groups    []string
+	Flash     string
+	Banner    *ErrorBanner
+}
+
+// handleTagProposals lists the tag proposals (GET) and approves or rejects
+// one (POST).
+func (app *App) handleTagProposals(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if r.Method == "POST" {
+		sess := app.requireUser(w, r)
+		if sess == nil {
+			return
+		}
+		flash, err := app.decideTagProposal(sess, r)
+		if err != nil {
+			app.fail(w, r, sess, "/tags/proposals", true, err)
+			return
+		}
+		http.Redirect(w, r, "/tags/proposals?flash="+flash, http.StatusSeeOther)
+		return
+	}
+
+	data := TagProposalsPageData{Page: "proposals", Flash: r.URL.Query().Get("flash")}
+	if sess := app.currentUser(r); sess != nil {
+		data.User = sess.Name
+		data.Banner = sess.Banner
+	}
+	proposals, err := app.store.TagProposals()
+	if err != nil {
+		log.Printf("state: %v", err)
+	}
+	for _, p := range proposals {
+		if !p.Rejected {
+			data.Proposals = append(data.Proposals, p)
+		}
+	}
+	for _, t := range app.docs.KnownTags() {
+		if t.TagGroup != "" && !slices.Contains(data.Groups, t.TagGroup) {
+			data.Groups = append(data.Groups, t.TagGroup)
+		}
+	}
+	slices.Sort(data.Groups)
+	app.templates().ExecuteTemplate(w, "proposals.html", data)
+}
+
+// decideTagProposal approves or rejects the proposal named in r, returning
+// the flash message.
+func (app *App) decideTagProposal(sess *UserSession, r *http.Request) (string, error) {
+	proposals, err := app.store.TagProposals()
+	if err != nil {
+		return "", errs.E(errs.Other, "tag proposals", err)
+	}
+	i := slices.IndexFunc(proposals, func(p store.TagProposal) bool { return strings.EqualFold(p.Name, r.FormValue("proposal")) })
+	if i < 0 || proposals[i].Rejected {
+		return "No such proposal", nil
+	}
+	p := proposals[i]
+
+	if r.FormValue("do") == "reject" {
+		p.Rejected = true
+		if err := app.store.PutTagProposal(p); err != nil {
+			return "", errs.E(errs.Other, "reject "+p.Name, err)
+		}
+		log.Printf("tags: %s rejected the proposed tag %q", cmp.Or(sess.Name, "user"), p.Name)
+		return "Rejected " + p.Name, nil
+	}
+
+	name := cmp.Or(strings.Join(strings.Fields(r.FormValue("name")), " "), p.Name)
+	group, color := r.FormValue("group"), cmp.Or(r.FormValue("color"), p.Color)
+	tag, ok := app.findTag(name, group)
+	created := !ok
+	if created {
+		t, err := app.docs.CreateTag(name, color, group)
+		if err != nil {
+			return "", errs.E(errs.Upstream, "create tag "+name, err)
+		}
+		tag = *t
+	}
+	tagged := 0
+	var failed []store.ProposalDoc
+	for _, d := range p.Docs {
+		if err := app.docs.AddTag(d.ULID, tag.ID); err != nil {
+			log.Printf("tags: applying %s to %s: %v", tag.Name, d.ULID, err)
+			failed = append(failed, d)
+			continue
+		}
+		tagged++
+		app.emitTagged(d.ULID, d.Name, sess.Name, tag.Name)
+		app.journalTag(sess, actionTag, d.ULID, d.Name, TagSetEntry{ID: tag.ID, Name: tag.Name})
+		sess.record("tag "+tag.Name, d.ULID, d.Name)
+	}
+	if len(failed) > 0 {
+		// kept with the documents left, so approving it again retries them
+		p.Name, p.Group, p.Color, p.Docs = tag.Name, tag.TagGroup, tag.Color, failed
+		if !strings.EqualFold(p.Name, proposals[i].Name) {
+			if err := app.store.DeleteTagProposal(proposals[i].Name); err != nil {
+				log.Printf("state: %v", err)
+			}
+		}
+		if err := app.store.PutTagProposal(p); err != nil {
+			log.Printf("state: %v", err)
+		}
+	} else if err := app.store.DeleteTagProposal(p.Name); err != nil {
+		log.Printf("state: %v", err)
+	}
+	if tagged > 0 {
+		app.syncUntagged()
+	}
+
+	flash := fmt.Sprintf("Tagged %d documents with %s", tagged, tag.Name)
+	if created {
+		flash = fmt.Sprintf("Created %s and tagged %d documents", tag.Name, tagged)
+	}
+	if len(failed) > 0 {
+		flash += fmt.Sprintf(" (%d failed, kept for another try)", len(failed))
+	}
+	return flash, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/drummonds/godocs-inbox/internal/store"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	trendWeeks       = 12 // weeks of journal history in the usage trendline
+	tagCountParallel = 8  // concurrent godocs count requests
+)
+
+// TagUsage is one tag's document count and recent tagging activity.
+type TagUsage struct {
+	Tag        GodocsTag
+	Count      int // documents carrying the tag; -1 if the count failed
+	Weekly     []int
+	Trend      string // sparkline of Weekly, oldest first
+	LastUsed   time.Time
+	Overlaps   []string // other tags with near-identical names
+	CountError string
+}
+
+type TagStatsReport struct {
+	Tags        []TagUsage
+	Unused      []TagUsage
+	Overlapping [][]string
+	Generated   time.Time
+}
+
+type TagStatsPageData struct {
+	Page   string
+	User   string
+	Report *TagStatsReport
+	Error  string
+	Merge  *TagMerge // running or last tag merge
+	Flash  string
+	Banner *ErrorBanner
+}
+
+// buildTagStats fetches per-tag document counts from godocs and combines them
+// with the local action journal.
+func buildTagStats(ctx context.Context, client DocumentStore, st *store.Store) (*TagStatsReport, error) {
+	tags, err := client.FetchTags()
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]TagUsage, len(tags))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(tagCountParallel)
+	for i, t := range tags {
+		usage[i] = TagUsage{Tag: t, Weekly: make([]int, trendWeeks)}
+		g.Go(func() error {
+			sr, err := client.FetchTagged(ctx, t.ID, 1, 1)
+			if err != nil {
+				usage[i].Count = -1
+				usage[i].CountError = err.Error()
+				return nil
+			}
+			usage[i].Count = sr.TotalCount
+			return nil
+		})
+	}
+	g.Wait()
+
+	// Weekly tag actions from the journal, keyed by tag ID
+	entries, err := st.Actions(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	byID := make(map[int]*TagUsage)
+	for i := range usage {
+		byID[usage[i].Tag.ID] = &usage[i]
+	}
+	now := time.Now()
+	for _, e := range entries {
+		u := byID[e.TagID]
+		if u == nil || e.Action != actionTag {
+			continue
+		}
+		if e.Time.After(u.LastUsed) {
+			u.LastUsed = e.Time
+		}
+		week := int(now.Sub(e.Time).Hours() / (24 * 7))
+		if week >= 0 && week < trendWeeks {
+			u.Weekly[trendWeeks-1-week]++
+		}
+	}
+
+	// Group tags whose names normalise to the same key
+	groups := make(map[string][]string)
+	for _, u := range usage {
+		k := normalizeTagName(u.Tag.Name)
+		groups[k] = append(groups[k], u.Tag.Name)
+	}
+
+	report := &TagStatsReport{Generated: now}
+	for i := range usage {
+		u := &usage[i]
+		u.Trend = sparkline(u.Weekly)
+		for _, name := range groups[normalizeTagName(u.Tag.Name)] {
+			if name != u.Tag.Name {
+				u.Overlaps = append(u.Overlaps, name)
+			}
+		}
+		if u.Count == 0 {
+			report.Unused = append(report.Unused, *u)
+		}
+	}
+	for _, names := range groups {
+		if len(names) > 1 {
+			sort.Strings(names)
+			report.Overlapping = append(report.Overlapping, names)
+		}
+	}
+	sort.Slice(report.Overlapping, func(i, j int) bool { return report.Overlapping[i][0] < report.Overlapping[j][0] })
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Count != usage[j].Count {
+			return usage[i].Count > usage[j].Count
+		}
+		return usage[i].Tag.Name < usage[j].Tag.Name
+	})
+	report.Tags = usage
+	return report, nil
+}
+
+// normalizeTagName folds case, punctuation and a plural "s" so that
+// "Bank", "bank" and "banks" compare equal.
+func normalizeTagName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	s := b.String()
+	if len(s) > 3 {
+		s = strings.TrimSuffix(s, "s")
+	}
+	return s
+}
+
+func sparkline(values []int) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	peak := 0
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if peak == 0 {
+			b.WriteRune(bars[0])
+			continue
+		}
+		b.WriteRune(bars[v*(len(bars)-1)/peak])
+	}
+	return b.String()
+}
+
+func (app *App) handleTagStats(w http.ResponseWriter, r *http.Request) {
+	data := TagStatsPageData{Page: "tagstats", Flash: r.URL.Query().Get("flash")}
+	app.mu.Lock()
+	if sess := app.currentUser(r); sess != nil {
+		data.User = sess.Name
+		data.Banner = sess.Banner
+	}
+	if app.tagMerge != nil {
+		m := *app.tagMerge
+		data.Merge = &m
+	}
+	app.mu.Unlock()
+
+	report, err := buildTagStats(r.Context(), app.docs, app.store)
+	if err != nil {
+		data.Error = err.Error()
+	}
+	data.Report = report
+	app.templates().ExecuteTemplate(w, "tagstats.html", data)
+}
+
+// runTagsAudit implements the `tags audit` command.
+func runTagsAudit(cfg Config, out io.Writer) error {
+	client, err := newClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	st, err := store.Open(cfg.statePath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	report, err := buildTagStats(context.Background(), client, st)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tTAG\tGROUP\tDOCS\tLAST %d WEEKS\tLAST USED\n", trendWeeks)
+	for _, u := range report.Tags {
+		count := fmt.Sprint(u.Count)
+		if u.Count < 0 {
+			count = "?"
+		}
+		last := "-"
+		if !u.LastUsed.IsZero() {
+			last = u.LastUsed.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", u.Tag.ID, u.Tag.Name, u.Tag.TagGroup, count, u.Trend, last)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(out, "\nUnused tags (%d):\n", len(report.Unused))
+	for _, u := range report.Unused {
+		fmt.Fprintf(out, "  id=%d  %s\n", u.Tag.ID, u.Tag.Name)
+	}
+	fmt.Fprintf(out, "\nOverlapping names (%d):\n", len(report.Overlapping))
+	for _, names := range report.Overlapping {
+		fmt.Fprintf(out, "  %s\n", strings.Join(names, ", "))
+	}
+	return nil
+}
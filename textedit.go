@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// When OCR mangles something that matters, such as an amount or a date, the
+// text can be corrected by hand. The edit page shows the document's full
+// text beside its thumbnail; saving uploads the corrected text to godocs in
+// place of the OCR, takes any poor OCR score out of review, and can re-run
+// date inference on the new text.
+
+type TextPageData struct {
+	Page         string
+	User         string
+	ULID         string
+	Name         string
+	Pos          string
+	Text         string
+	HasThumbnail bool
+	ViewURL      string
+	PoorOCR      int
+	Banner       *ErrorBanner
+}
+
+// handleText shows a document's text for editing (GET) and saves the
+// correction (POST).
+func (app *App) handleText(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		app.saveText(w, r)
+		return
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, pos := r.FormValue("ulid"), r.FormValue("pos")
+	status, err := app.docs.FetchDocStatus(r.Context(), ulid)
+	if err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "text of "+ulid, err))
+		return
+	}
+	text, err := app.docs.FetchDocText(r.Context(), ulid)
+	if err != nil {
+		app.fail(w, r, sess, "/?pos="+pos, true, errs.E(errs.Upstream, "text of "+status.Name, err))
+		return
+	}
+	data := TextPageData{
+		Page:         "text",
+		User:         sess.Name,
+		ULID:         ulid,
+		Name:         status.Name,
+		Pos:          pos,
+		Text:         text,
+		HasThumbnail: status.HasThumbnail,
+		ViewURL:      app.docs.ViewURL(ulid),
+		PoorOCR:      app.poorOCR(ulid),
+		Banner:       sess.Banner,
+	}
+	app.templates().ExecuteTemplate(w, "text.html", data)
+}
+
+// saveText uploads corrected text for a document, optionally re-running
+// date inference on it.
+func (app *App) saveText(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	sess := app.requireUser(w, r)
+	if sess == nil {
+		return
+	}
+
+	ulid, name, pos := r.FormValue("ulid"), r.FormValue("name"), r.FormValue("pos")
+	text := strings.TrimSpace(strings.ReplaceAll(r.FormValue("text"), "\r\n", "\n"))
+	back := "/text?ulid=" + ulid + "&pos=" + pos
+	if ulid == "" {
+		http.Redirect(w, r, "/?pos="+pos, http.StatusSeeOther)
+		return
+	}
+	if text == "" {
+		app.fail(w, r, sess, back, false, errs.New(errs.Validation, "text of "+name, "the text is empty"))
+		return
+	}
+	if err := app.docs.UploadDocumentText(ulid, text); err != nil {
+		app.fail(w, r, sess, back, true, errs.E(errs.Upstream, "text of "+name, err))
+		return
+	}
+	app.markOCRReviewed(ulid)
+	app.recordOCRLines(ulid, nil) // no longer the text on the page
+	sess.record("edit text", ulid, name)
+	flash := "Text saved on " + name
+	if r.FormValue("redate") != "" {
+		go inferDocumentDate(app, ulid, text)
+		flash += ", re-inferring the date"
+	}
+	http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+}
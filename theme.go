@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var templateFuncs = template.FuncMap{
+	"add":   func(a, b int) int { return a + b },
+	"bytes": formatBytes,
+}
+
+// parseTemplates parses the embedded templates, then any *.html files in the
+// -templates override directory. An override file replaces the embedded
+// template of the same name, and its {{define}} blocks (e.g. "nav") replace
+// the embedded ones.
+func (app *App) parseTemplates() (*template.Template, error) {
+	base := app.config().BasePath
+	t, err := template.New("").Funcs(templateFuncs).Funcs(template.FuncMap{
+		"base":       func() string { return base },
+		"snoozed":    app.snoozedCount,
+		"proposals":  app.pendingTagProposals,
+		"overdue":    func() int { return int(app.overdue.Load()) },
+		"llm":        app.ollama.status,
+		"dryrun":     app.dryRun,
+		"profiles":   func() []ProfileLink { return app.profiles },
+		"date":       app.formatDate,
+		"localtime":  app.localTime,
+		"monthfirst": app.monthFirst,
+	}).ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if app.templatesDir == "" {
+		return t, nil
+	}
+	files, err := filepath.Glob(filepath.Join(app.templatesDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return t, nil
+	}
+	if t, err = t.ParseFiles(files...); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", app.templatesDir, err)
+	}
+	return t, nil
+}
+
+// templates returns the parsed templates. In -dev mode they are re-parsed on
+// every call so template edits show up on reload.
+func (app *App) templates() *template.Template {
+	if !app.dev {
+		return app.tmpl
+	}
+	t, err := app.parseTemplates()
+	if err != nil {
+		log.Printf("templates: %v", err)
+		return app.tmpl
+	}
+	return t
+}
+
+// assetFS is the static asset tree: the -static override directory layered
+// over the embedded assets.
+func (app *App) assetFS() fs.FS {
+	sub, _ := fs.Sub(staticFS, "static")
+	if app.staticDir == "" {
+		return sub
+	}
+	return overlayFS{upper: os.DirFS(app.staticDir), lower: sub}
+}
+
+// overlayFS serves files from upper when present, falling back to lower.
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if f, err := o.upper.Open(name); err == nil {
+		return f, nil
+	}
+	return o.lower.Open(name)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	thumbnails "github.com/drummonds/go-thumbnails"
+	"github.com/drummonds/godocs-inbox/internal/webp"
+)
+
+const (
+	defaultThumbWidth   = 600
+	defaultThumbQuality = 85 // JPEG quality
+	defaultThumbWorkers = 2  // pregeneration workers
+)
+
+// ThumbnailConfig sets how hi-res thumbnails are rendered. Cached thumbnails
+// are keyed by these settings, so changing them regenerates each thumbnail
+// the next time it is needed.
+type ThumbnailConfig struct {
+	Width   int    `yaml:"width,omitempty"`   // pixels (default 600)
+	Format  string `yaml:"format,omitempty"`  // png (default), jpeg or webp
+	Quality int    `yaml:"quality,omitempty"` // JPEG quality 1-100 (default 85)
+	Style   string `yaml:"style,omitempty"`   // uniform (default) or composite
+	Workers int    `yaml:"workers,omitempty"` // pregeneration workers (default 2; -1 disables)
+}
+
+func (c ThumbnailConfig) width() uint {
+	if c.Width > 0 {
+		return uint(c.Width)
+	}
+	return defaultThumbWidth
+}
+
+func (c ThumbnailConfig) format() string {
+	switch strings.ToLower(c.Format) {
+	case "jpeg", "jpg":
+		return "jpeg"
+	case "webp":
+		return "webp"
+	}
+	return "png"
+}
+
+func (c ThumbnailConfig) quality() int {
+	if c.Quality > 0 {
+		return c.Quality
+	}
+	return defaultThumbQuality
+}
+
+func (c ThumbnailConfig) style() thumbnails.Style {
+	if strings.EqualFold(c.Style, "composite") {
+		return thumbnails.StyleComposite
+	}
+	return thumbnails.StyleUniform
+}
+
+func (c ThumbnailConfig) workers() int {
+	if c.Workers == 0 {
+		return defaultThumbWorkers
+	}
+	return max(c.Workers, 0)
+}
+
+func (c ThumbnailConfig) contentType() string {
+	return "image/" + c.format()
+}
+
+// key identifies the settings in cached thumbnail file names.
+func (c ThumbnailConfig) key() string {
+	s := fmt.Sprintf("%d/%s/%d/%d", c.width(), c.format(), c.quality(), c.style())
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+func (c ThumbnailConfig) validate() error {
+	switch strings.ToLower(c.Format) {
+	case "", "png", "jpeg", "jpg", "webp":
+	default:
+		return fmt.Errorf("thumbnails: unknown format %q (png, jpeg or webp)", c.Format)
+	}
+	switch strings.ToLower(c.Style) {
+	case "", "uniform", "composite":
+	default:
+		return fmt.Errorf("thumbnails: unknown style %q (uniform or composite)", c.Style)
+	}
+	if c.Width < 0 || c.Width > 4000 {
+		return fmt.Errorf("thumbnails: width %d out of range (1-4000)", c.Width)
+	}
+	if c.Quality < 0 || c.Quality > 100 {
+		return fmt.Errorf("thumbnails: quality %d out of range (1-100)", c.Quality)
+	}
+	if c.Workers < -1 || c.Workers > 16 {
+		return fmt.Errorf("thumbnails: workers %d out of range (1-16, or -1 to disable)", c.Workers)
+	}
+	return nil
+}
+
+// hiresThumbPath is the cached thumbnail for ulid under the current settings.
+func (app *App) hiresThumbPath(ulid string) string {
+	c := app.config().Thumbnails
+	ext := ".png"
+	switch c.format() {
+	case "jpeg":
+		ext = ".jpg"
+	case "webp":
+		ext = ".webp"
+	}
+	return filepath.Join(app.thumbDir, ulid+"."+c.key()+ext)
+}
+
+func (app *App) hiresThumbExists(ulid string) bool {
+	_, err := os.Stat(app.hiresThumbPath(ulid))
+	return err == nil
+}
+
+func generateHiresThumb(app *App, ulid, docType string) {
+	if app.hiresThumbExists(ulid) {
+		return
+	}
+
+	tmpPath, err := app.docs.DownloadDocument(ulid, "godocs-thumb-*"+docType, app.maxDownloadBytes())
+	if err != nil {
+		app.pipelineErrorf("hires-thumb", ulid, "download failed for %s: %v", ulid, err)
+		return
+	}
+	defer scratch.release(tmpPath)
+
+	outPath := app.hiresThumbPath(ulid)
+	if err := saveThumbnail(tmpPath, outPath, app.config().Thumbnails); err != nil {
+		app.pipelineErrorf("hires-thumb", ulid, "generation failed for %s: %v", ulid, err)
+		return
+	}
+	removeStaleThumbs(app.thumbDir, ulid, outPath)
+	log.Printf("hires-thumb: generated %s", ulid)
+}
+
+// saveThumbnail renders a document's thumbnail to outPath. It is written to
+// a temp file first so a half-written thumbnail is never served.
+func saveThumbnail(docPath, outPath string, c ThumbnailConfig) error {
+	img, err := thumbnails.GenerateStyled(docPath, c.width(), c.style())
+	if err != nil {
+		return err
+	}
+	return writeThumbnail(img, outPath, c)
+}
+
+// writeThumbnail encodes img to outPath in the configured format.
+func writeThumbnail(img image.Image, outPath string, c ThumbnailConfig) error {
+	f, err := os.CreateTemp(filepath.Dir(outPath), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	switch c.format() {
+	case "jpeg":
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: c.quality()})
+	case "webp":
+		err = webp.Encode(f, img)
+	default:
+		err = png.Encode(f, img)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), outPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("encoding thumbnail: %w", err)
+	}
+	return nil
+}
+
+// removeStaleThumbs deletes thumbnails of ulid rendered with other settings.
+func removeStaleThumbs(dir, ulid, keep string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, ulid+".*"))
+	for _, m := range matches {
+		if m != keep {
+			os.Remove(m)
+		}
+	}
+}
+
+// thumbQueue pregenerates hi-res thumbnails for the inbox so documents are
+// sharp the first time they are shown. pending is refilled in queue order on
+// every sync, so workers always pick up the documents nearest the front.
+type thumbQueue struct {
+	mu      sync.Mutex
+	pending []GodocsDocument
+	busy    map[string]bool // ULIDs being generated
+	tried   map[string]bool // ULIDs pregeneration has attempted, so failures are not retried
+	workers int             // running workers
+}
+
+// pregenerateThumbs queues the inbox for thumbnail pregeneration and starts
+// workers up to the configured limit. Callers must hold app.mu.
+func (app *App) pregenerateThumbs() {
+	n := app.config().Thumbnails.workers()
+	if n == 0 {
+		return
+	}
+	var pending []GodocsDocument
+	for _, doc := range app.queue() {
+		if app.stageEnabled(pipelineHiresThumbs, doc.DocumentType) {
+			pending = append(pending, doc)
+		}
+	}
+
+	q := &app.thumbs
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = pending
+	for ; q.workers < n && len(q.pending) > 0; q.workers++ {
+		go app.thumbWorker()
+	}
+}
+
+func (app *App) thumbWorker() {
+	done := 0
+	for {
+		doc, ok := app.thumbs.next(app)
+		if !ok {
+			if done > 0 {
+				log.Printf("hires-thumb: pregenerated %d", done)
+			}
+			return
+		}
+		generateHiresThumb(app, doc.ULID, doc.DocumentType)
+		app.thumbs.finish(doc.ULID)
+		if app.hiresThumbExists(doc.ULID) {
+			done++
+		}
+	}
+}
+
+// next pops the first pending document that still needs a thumbnail and
+// marks it busy. When none is left the worker is counted out.
+func (q *thumbQueue) next(app *App) (GodocsDocument, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) > 0 {
+		doc := q.pending[0]
+		q.pending = q.pending[1:]
+		if q.busy[doc.ULID] || q.tried[doc.ULID] || app.hiresThumbExists(doc.ULID) {
+			continue
+		}
+		q.start(doc.ULID)
+		return doc, true
+	}
+	q.workers--
+	return GodocsDocument{}, false
+}
+
+// start marks ulid busy. Callers must hold q.mu.
+func (q *thumbQueue) start(ulid string) {
+	if q.busy == nil {
+		q.busy = make(map[string]bool)
+		q.tried = make(map[string]bool)
+	}
+	q.busy[ulid] = true
+	q.tried[ulid] = true
+}
+
+func (q *thumbQueue) finish(ulid string) {
+	q.mu.Lock()
+	delete(q.busy, ulid)
+	q.mu.Unlock()
+}
+
+// startHiresThumb generates the thumbnail for a document being shown now,
+// outside the worker pool, unless it exists or is already being generated.
+func (app *App) startHiresThumb(ulid, docType string) {
+	if app.hiresThumbExists(ulid) {
+		return
+	}
+	q := &app.thumbs
+	q.mu.Lock()
+	busy := q.busy[ulid]
+	if !busy {
+		q.start(ulid)
+	}
+	q.mu.Unlock()
+	if busy {
+		return
+	}
+	go func() {
+		defer q.finish(ulid)
+		generateHiresThumb(app, ulid, docType)
+	}()
+}
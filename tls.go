@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// GodocsTLSConfig customises TLS for the connection to godocs, e.g. for a
+// server behind a self-signed certificate:
+//
+//	godocs_tls:
+//	  ca_file: /etc/ssl/home-ca.pem
+//	  cert_file: client.pem   # optional client certificate
+//	  key_file: client-key.pem
+type GodocsTLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// tlsConfig builds the client TLS config, or nil when nothing is customised.
+func (c GodocsTLSConfig) tlsConfig() (*tls.Config, error) {
+	if c == (GodocsTLSConfig{}) {
+		return nil, nil
+	}
+	tc := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("godocs_tls: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("godocs_tls: no certificates found in %s", c.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("godocs_tls: cert_file and key_file must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("godocs_tls: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// newClientFromConfig creates the godocs client with the configured TLS
+// settings, timeouts, transports and cache lifetime.
+func newClientFromConfig(cfg Config) (*GodocsClient, error) {
+	client := NewGodocsClient(cfg.GodocsServer)
+	if cfg.CacheTTLSeconds > 0 {
+		client.cache.ttl = time.Duration(cfg.CacheTTLSeconds) * time.Second
+	}
+	if err := cfg.GodocsHTTP.validate(); err != nil {
+		return nil, err
+	}
+	tc, err := cfg.GodocsTLS.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	client.httpClient = &http.Client{
+		Timeout:   cfg.GodocsHTTP.timeout(),
+		Transport: requestIDTransport{cfg.GodocsHTTP.transport(tc, false)},
+	}
+	client.transfers = &http.Client{
+		Timeout:   cfg.GodocsHTTP.transferTimeout(),
+		Transport: requestIDTransport{cfg.GodocsHTTP.transport(tc, true)},
+	}
+	client.pageInterval = cfg.GodocsHTTP.pageInterval()
+	return client, nil
+}
+
+// validateServerTLS checks that tls_cert and tls_key are set together and
+// load, so a bad path fails at startup rather than on first connection.
+func (c Config) validateServerTLS() error {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tls_cert and tls_key must be set together")
+	}
+	if c.TLSCert != "" {
+		if _, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey); err != nil {
+			return fmt.Errorf("loading tls_cert/tls_key: %w", err)
+		}
+	}
+	return nil
+}
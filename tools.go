@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/llm"
+	"github.com/drummonds/godocs-inbox/internal/ocr"
+)
+
+// The external tools (tesseract, poppler's pdftoppm and pdftotext, ocrmypdf
+// and qpdf) are run by name from PATH unless `tools` gives a path.
+// They are probed once at startup for their versions, and tesseract for its
+// language packs. A feature that needs a missing tool is switched off with a
+// warning rather than failing for every document: documents that cannot be
+// OCR'd skip the OCR stage, and searchable PDFs are skipped. Separator
+// sheets need none: pages are rendered with go-pdfium's WebAssembly build
+// and read with internal/qr. The probe is shown on the About page and by `doctor`; a tool
+// installed later is used after a restart.
+
+// toolFeatures are the features that need external tools, and whether a
+// config uses them.
+var toolFeatures = []struct {
+	name  string
+	tools []string
+	used  func(Config) bool
+}{
+	{"OCR of images", []string{"tesseract"}, ocrUsed},
+	{"OCR of scanned PDFs", []string{"tesseract", "pdftoppm"}, ocrUsed},
+	{"reading PDF text layers", []string{"pdftotext"}, ocrUsed},
+	{"searchable PDFs", []string{"ocrmypdf"}, func(c Config) bool { return c.SearchablePDF.Enabled }},
+	{"rotating PDFs", []string{"qpdf"}, func(Config) bool { return true }},
+}
+
+func ocrUsed(c Config) bool {
+	return c.Pipeline.stageEnabled(pipelineOCR, "")
+}
+
+// ToolProbe is what the startup probe found.
+type ToolProbe struct {
+	Tools     []ToolStatus
+	Languages []string // tesseract's language packs
+	LangError string
+	Time      time.Time
+}
+
+// setToolPaths checks the tools config and points the OCR package at the
+// binaries.
+func setToolPaths(paths map[string]string) error {
+	for name := range paths {
+		if !slices.Contains(ocr.Tools, name) {
+			return fmt.Errorf("tools: unknown tool %q (known: %s)", name, strings.Join(ocr.Tools, ", "))
+		}
+	}
+	ocr.Paths = paths
+	return nil
+}
+
+// probeTools runs every tool for its version, concurrently.
+func probeTools() *ToolProbe {
+	p := &ToolProbe{Tools: make([]ToolStatus, len(ocr.Tools)), Time: time.Now()}
+	var wg sync.WaitGroup
+	for i, name := range ocr.Tools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ts := ToolStatus{Name: name, Path: ocr.Path(name)}
+			if v, err := ocr.ToolVersion(name); err != nil {
+				ts.Error = err.Error()
+			} else {
+				ts.Version = v
+			}
+			p.Tools[i] = ts
+		}()
+	}
+	wg.Wait()
+	if p.found("tesseract") {
+		langs, err := ocr.Languages()
+		if err != nil {
+			p.LangError = err.Error()
+		}
+		p.Languages = langs
+	}
+	return p
+}
+
+// found reports whether a tool was found. Without a probe, in demo mode
+// and tests, every tool is taken to be present.
+func (p *ToolProbe) found(name string) bool {
+	if p == nil {
+		return true
+	}
+	i := slices.IndexFunc(p.Tools, func(t ToolStatus) bool { return t.Name == name })
+	return i < 0 || p.Tools[i].Error == ""
+}
+
+// disabled describes the features cfg uses that are off for want of a
+// tool.
+func (p *ToolProbe) disabled(cfg Config) []string {
+	var out []string
+	for _, f := range toolFeatures {
+		if !f.used(cfg) {
+			continue
+		}
+		var missing []string
+		for _, t := range f.tools {
+			if !p.found(t) {
+				missing = append(missing, t)
+			}
+		}
+		if len(missing) > 0 {
+			out = append(out, fmt.Sprintf("%s: needs %s", f.name, strings.Join(missing, ", ")))
+		}
+	}
+	return out
+}
+
+// report logs the probe at startup.
+func (p *ToolProbe) report() {
+	var found, missing []string
+	for _, t := range p.Tools {
+		if t.Error == "" {
+			found = append(found, t.Name)
+		} else {
+			missing = append(missing, t.Name)
+		}
+	}
+	log.Printf("tools: found %s", strings.Join(found, ", "))
+	if len(missing) > 0 {
+		log.Printf("tools: missing %s", strings.Join(missing, ", "))
+	}
+	if len(p.Languages) > 0 {
+		log.Printf("tools: tesseract languages %s", strings.Join(p.Languages, ", "))
+	}
+}
+
+func (app *App) hasTool(names ...string) bool {
+	for _, name := range names {
+		if !app.tools.found(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// canExtract reports whether the tools are there to get the text of a
+// document of docType along its route.
+func (app *App) canExtract(docType string) bool {
+	switch app.config().Pipeline.route(docType) {
+	case routeOCR:
+		return app.hasTool("tesseract") && (normalizeDocType(docType) != ".pdf" || app.hasTool("pdftoppm"))
+	case routePDFText:
+		return app.hasTool("pdftotext") || app.hasTool("tesseract", "pdftoppm")
+	}
+	return true
+}
+
+// runDoctor implements `doctor`: it checks godocs, Ollama and the external
+// tools, and fails if godocs is unreachable or a feature in use is
+// disabled.
+func runDoctor(cfg Config, out io.Writer) error {
+	problems := 0
+	client, err := newClientFromConfig(cfg)
+	if err == nil {
+		var latency time.Duration
+		if latency, err = client.Ping(); err == nil {
+			fmt.Fprintf(out, "godocs     %s: ok (%v)\n", cfg.GodocsServer, latency.Round(time.Millisecond))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(out, "godocs     %s: %v\n", cfg.GodocsServer, err)
+		problems++
+	}
+	app := appFor(cfg)
+	if _, err := llm.ListModels(app.ollamaURL()); err != nil {
+		fmt.Fprintf(out, "ollama     %s: %v (LLM stages skip local models)\n", app.ollamaURL(), err)
+	} else {
+		fmt.Fprintf(out, "ollama     %s: ok\n", app.ollamaURL())
+	}
+
+	p := probeTools()
+	for _, t := range p.Tools {
+		if t.Error != "" {
+			fmt.Fprintf(out, "%-10s missing: %s\n", t.Name, t.Error)
+		} else {
+			fmt.Fprintf(out, "%-10s %s\n", t.Name, t.Version)
+		}
+	}
+	switch {
+	case p.LangError != "":
+		fmt.Fprintf(out, "tesseract languages: %s\n", p.LangError)
+	case len(p.Languages) > 0:
+		fmt.Fprintf(out, "tesseract languages: %s\n", strings.Join(p.Languages, ", "))
+	}
+	for _, d := range p.disabled(cfg) {
+		fmt.Fprintf(out, "disabled   %s\n", d)
+		problems++
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problems found", problems)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drummonds/godocs-inbox/internal/errs"
+)
+
+// uploadMemory is how much of a multipart upload is held in memory; the
+// rest is spooled to temp files.
+const uploadMemory = 8 << 20
+
+// handleUpload adds documents dropped on the inbox page to godocs. Processing
+// starts straight away, as for the new-document hook, and the first upload
+// is shown next. Uploads are capped by max_download_mb rather than the
+// request body limit (see limitRequests).
+func (app *App) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.mu.Lock()
+	sess := app.requireUser(w, r)
+	app.mu.Unlock()
+	if sess == nil {
+		return
+	}
+
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		app.fail(w, r, sess, "/", false, errs.E(errs.Validation, "upload", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	pos := r.FormValue("pos")
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		http.Redirect(w, r, "/?pos="+pos+"&flash=No file uploaded", http.StatusSeeOther)
+		return
+	}
+
+	var uploaded []*GodocsDocument
+	var failed []string
+	for _, fh := range files {
+		name := filepath.Base(fh.Filename)
+		f, err := fh.Open()
+		if err != nil {
+			failed = append(failed, name+": "+err.Error())
+			continue
+		}
+		doc, err := app.docs.UploadDocument(name, f)
+		f.Close()
+		if err != nil {
+			log.Printf("upload: %s: %v", name, err)
+			failed = append(failed, name+": "+err.Error())
+			continue
+		}
+		log.Printf("upload: %s as %s", name, doc.ULID)
+		uploaded = append(uploaded, doc)
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.syncUntagged()
+	for _, doc := range uploaded {
+		if status, err := app.docs.FetchDocStatus(r.Context(), doc.ULID); err == nil {
+			app.startProcessing(doc.ULID, status, "")
+		}
+		sess.record("upload", doc.ULID, doc.Name)
+	}
+
+	var names []string
+	for _, doc := range uploaded {
+		names = append(names, doc.Name)
+	}
+	var flash string
+	if len(names) > 0 {
+		flash = "Uploaded " + strings.Join(names, ", ")
+	}
+	if len(uploaded) > 0 {
+		for i, doc := range app.queue() {
+			if doc.ULID == uploaded[0].ULID {
+				pos = strconv.Itoa(i + 1)
+				break
+			}
+		}
+	}
+	if len(failed) > 0 {
+		// The files are not kept, so they must be dropped again to retry
+		app.fail(w, r, sess, "/?pos="+pos+"&flash="+flash, false, errs.New(errs.Upstream, "upload", strings.Join(failed, "; ")))
+		return
+	}
+	http.Redirect(w, r, "/?pos="+pos+"&flash="+flash, http.StatusSeeOther)
+}
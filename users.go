@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/drummonds/godocs-inbox/internal/keymap"
+	"github.com/drummonds/godocs-inbox/internal/store"
+)
+
+const (
+	userCookieName = "godocs_inbox_user"
+	maxUndoStack   = 20
+	maxHistory     = 50
+)
+
+// UserConfig is a named triage profile. Shortcuts and presets fall back to
+// the top-level config when not set.
+type UserConfig struct {
+	Name      string           `yaml:"name"`
+	Shortcuts []ShortcutConfig `yaml:"tags,omitempty"`
+	Presets   []PresetConfig   `yaml:"presets,omitempty"`
+}
+
+type HistoryEntry struct {
+	Time    time.Time
+	Action  string
+	ULID    string
+	DocName string
+}
+
+type UserStats struct {
+	Tagged      int
+	SetsApplied int
+	Done        int
+	Undone      int
+}
+
+// UserSession holds per-user triage state. The document queue is shared;
+// everything here is guarded by app.mu.
+type UserSession struct {
+	Name       string
+	Shortcuts  []ShortcutConfig
+	Presets    []PresetConfig
+	Keymap     *keymap.Keymap  // shortcut and preset keys, including chords
+	Layers     []ShortcutLayer // further shortcut sets, each with its own keymap
+	store      *store.Store    // where save() persists session state
+	RecentSets []RecentTagSet  // last N applied tag sets
+	UndoStack  []*LastAction   // newest last
+	History    []HistoryEntry  // newest first
+	Stats      UserStats
+	Banner     *ErrorBanner    // last failed action, until dismissed; not persisted
+	Held       *GodocsDocument // tagged short of required_groups; kept first in the queue
+	Folder     string          // godocs folder the queue is filtered to; "" for all
+	Oldest     bool            // queue ordered oldest first (see aging.go)
+	Opened     *GodocsDocument // opened by ULID or search; kept first in the queue until done
+	Bucket     int             // quick sort bucket tag in its detail pass; 0 for the inbox
+}
+
+// release lets ulid leave the front of the queue, where it was held or
+// opened.
+func (s *UserSession) release(ulid string) {
+	if s.Held != nil && s.Held.ULID == ulid {
+		s.Held = nil
+	}
+	if s.Opened != nil && s.Opened.ULID == ulid {
+		s.Opened = nil
+	}
+}
+
+func (s *UserSession) lastAction() *LastAction {
+	if len(s.UndoStack) == 0 {
+		return nil
+	}
+	return s.UndoStack[len(s.UndoStack)-1]
+}
+
+func (s *UserSession) pushAction(a *LastAction) {
+	s.UndoStack = append(s.UndoStack, a)
+	if len(s.UndoStack) > maxUndoStack {
+		s.UndoStack = s.UndoStack[len(s.UndoStack)-maxUndoStack:]
+	}
+}
+
+func (s *UserSession) popAction() *LastAction {
+	a := s.lastAction()
+	if a != nil {
+		s.UndoStack = s.UndoStack[:len(s.UndoStack)-1]
+	}
+	return a
+}
+
+func (s *UserSession) record(action, ulid, docName string) {
+	who := ""
+	if s.Name != "" {
+		who = s.Name + ": "
+	}
+	actionLog.Printf("action: %s%s %s (%s)", who, action, docName, ulid)
+	s.History = append([]HistoryEntry{{Time: time.Now(), Action: action, ULID: ulid, DocName: docName}}, s.History...)
+	if len(s.History) > maxHistory {
+		s.History = s.History[:maxHistory]
+	}
+	s.save()
+}
+
+// initUsers builds a session per configured user, or a single anonymous
+// session using the top-level shortcuts when no users are configured.
+func (app *App) initUsers() {
+	app.users = make(map[string]*UserSession)
+	app.applyUsers()
+}
+
+// applyUsers gives each configured user's session the keys of the config,
+// making sessions for new users and dropping those of users no longer
+// configured. Sessions that remain keep their state, so a config reload
+// loses no undo history. Callers must hold app.mu once serving.
+func (app *App) applyUsers() {
+	users := app.config().Users
+	if len(users) == 0 {
+		users = []UserConfig{{}} // the anonymous session
+	}
+	sessions := make(map[string]*UserSession, len(users))
+	app.userOrder = nil
+	for _, u := range users {
+		s := app.users[u.Name]
+		if s == nil {
+			s = &UserSession{Name: u.Name, store: app.store}
+			s.load()
+		}
+		s.Shortcuts, s.Presets = u.Shortcuts, u.Presets
+		if len(s.Shortcuts) == 0 {
+			s.Shortcuts = app.config().Shortcuts
+		}
+		if len(s.Presets) == 0 {
+			s.Presets = app.config().Presets
+		}
+		s.Keymap, _ = buildKeymap(s.Shortcuts, s.Presets)
+		s.Layers = sessionLayers(app.config().Layers, s.Presets)
+		sessions[u.Name] = s
+		if u.Name != "" {
+			app.userOrder = append(app.userOrder, u.Name)
+		}
+	}
+	app.users = sessions
+}
+
+func (app *App) multiUser() bool {
+	return len(app.userOrder) > 0
+}
+
+// currentUser returns the session selected by the request's cookie, or nil if
+// profiles are configured and none has been chosen. Callers must hold app.mu.
+func (app *App) currentUser(r *http.Request) *UserSession {
+	if !app.multiUser() {
+		return app.users[""]
+	}
+	c, err := r.Cookie(userCookieName)
+	if err != nil {
+		return nil
+	}
+	name, err := url.QueryUnescape(c.Value)
+	if err != nil {
+		return nil
+	}
+	return app.users[name]
+}
+
+type UsersPageData struct {
+	Page    string
+	User    string
+	Users   []string
+	Session *UserSession
+	Notes   map[string]string // ULID → note, for documents in the history
+}
+
+func (app *App) handleUsers(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if r.Method == "POST" {
+		name := r.FormValue("user")
+		if _, ok := app.users[name]; !ok || !app.multiUser() {
+			http.Redirect(w, r, "/users", http.StatusSeeOther)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     userCookieName,
+			Value:    url.QueryEscape(name),
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			Secure:   isSecure(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := UsersPageData{Page: "users", Users: app.userOrder}
+	if sess := app.currentUser(r); sess != nil {
+		data.User = sess.Name
+		data.Session = sess
+		var ulids []string
+		for _, h := range sess.History {
+			ulids = append(ulids, h.ULID)
+		}
+		data.Notes = app.notesFor(ulids)
+	}
+	app.templates().ExecuteTemplate(w, "users.html", data)
+}
+
+// requireUser redirects to the profile picker when no user is selected.
+func (app *App) requireUser(w http.ResponseWriter, r *http.Request) *UserSession {
+	sess := app.currentUser(r)
+	if sess == nil {
+		http.Redirect(w, r, "/users", http.StatusSeeOther)
+	}
+	return sess
+}
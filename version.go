@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is the release, set at build time with
+// -ldflags "-X main.version=v1.2.3". Without it, the module version is used
+// when built with go install, or "dev".
+var version = ""
+
+// godocsAPIVersion is the godocs API version this client was written
+// against. godocs reports its own at /api/version; a mismatch is warned
+// about at startup and on the About page, because a changed response
+// schema would otherwise decode silently to zero values.
+const godocsAPIVersion = 1
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified,omitempty"` // built from a tree with uncommitted changes
+	GoVersion  string `json:"go_version"`
+}
+
+// buildInfo reads the version and the VCS details go build embeds.
+func buildInfo() BuildInfo {
+	b := BuildInfo{Version: version, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if ok {
+		if b.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			b.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Commit = s.Value
+			case "vcs.time":
+				b.CommitTime = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	}
+	if b.Version == "" {
+		b.Version = "dev"
+	}
+	return b
+}
+
+// GodocsVersion is what the godocs server reports about itself.
+type GodocsVersion struct {
+	Version    string `json:"version,omitempty"`
+	APIVersion int    `json:"api_version,omitempty"` // 0 when not reported
+	Expected   int    `json:"expected_api_version"`
+	Warning    string `json:"warning,omitempty"` // set when the API versions differ
+	Error      string `json:"error,omitempty"`
+}
+
+// FetchVersion asks godocs for its version. A godocs older than
+// /api/version answers 404, which is reported as a warning rather than an
+// error.
+func (c *GodocsClient) FetchVersion() GodocsVersion {
+	v := GodocsVersion{Expected: godocsAPIVersion}
+	resp, err := c.httpClient.Get(c.baseURL + "/api/version")
+	if err != nil {
+		v.Error = fmt.Sprintf("fetching version: %v", err)
+		return v
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		v.Warning = fmt.Sprintf("godocs does not report its API version, so it predates the version %d this inbox was written for; some fields may be missing", godocsAPIVersion)
+		return v
+	case resp.StatusCode != http.StatusOK:
+		v.Error = fmt.Sprintf("fetching version: status %d", resp.StatusCode)
+		return v
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		v.Error = fmt.Sprintf("decoding version: %v", err)
+		return v
+	}
+	v.Expected = godocsAPIVersion
+	switch {
+	case v.APIVersion < godocsAPIVersion:
+		v.Warning = fmt.Sprintf("godocs %s has API version %d, older than the %d this inbox was written for; upgrade godocs, as some fields may be missing", v.Version, v.APIVersion, godocsAPIVersion)
+	case v.APIVersion > godocsAPIVersion:
+		v.Warning = fmt.Sprintf("godocs %s has API version %d, newer than the %d this inbox was written for; upgrade godocs-inbox, as changed fields may be misread", v.Version, v.APIVersion, godocsAPIVersion)
+	}
+	return v
+}
+
+// VersionResponse is the body of /api/version.
+type VersionResponse struct {
+	Build  BuildInfo      `json:"build"`
+	Godocs *GodocsVersion `json:"godocs,omitempty"` // nil when not a godocs server
+}
+
+// handleVersion (/api/version) reports the build and the godocs version
+// found at startup.
+func (app *App) handleVersion(w http.ResponseWriter, r *http.Request) {
+	resp := VersionResponse{Build: buildInfo(), Godocs: app.godocsVersion}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Event types delivered to webhooks.
+const (
+	eventOCRCompleted   = "ocr.completed"
+	eventDateInferred   = "date.inferred"
+	eventDocumentTagged = "document.tagged"
+	eventInboxZero      = "inbox.zero"
+)
+
+const signatureHeader = "X-Godocs-Inbox-Signature"
+
+// WebhookConfig is an outgoing webhook. Events filters which event types are
+// sent; empty means all. When Secret is set the body is signed with
+// HMAC-SHA256 in the X-Godocs-Inbox-Signature header as "sha256=<hex>".
+type WebhookConfig struct {
+	URL    string   `yaml:"url"`
+	Events []string `yaml:"events,omitempty"`
+	Secret string   `yaml:"secret,omitempty"`
+}
+
+func (wh WebhookConfig) wants(event string) bool {
+	return len(wh.Events) == 0 || slices.Contains(wh.Events, event)
+}
+
+// Event is a pipeline or triage event. Profile names the profile it came
+// from when several are configured.
+type Event struct {
+	Type    string         `json:"event"`
+	Time    time.Time      `json:"time"`
+	Profile string         `json:"profile,omitempty"`
+	ULID    string         `json:"ulid,omitempty"`
+	Name    string         `json:"name,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// emit delivers an event to every interested webhook in the background.
+func (app *App) emit(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	ev.Profile = app.config().Profile
+	for _, wh := range app.config().Webhooks {
+		if wh.wants(ev.Type) {
+			go app.sendWebhook(wh, ev)
+		}
+	}
+	if app.broker != nil {
+		go app.publishEvent(ev)
+	}
+}
+
+func (app *App) sendWebhook(wh WebhookConfig, ev Event) {
+	if err := postWebhook(context.Background(), wh, ev); err != nil {
+		app.pipelineErrorf("webhook", ev.ULID, "%s to %s: %v", ev.Type, wh.URL, err)
+	}
+}
+
+// postWebhook delivers one event and waits for the answer.
+func postWebhook(ctx context.Context, wh WebhookConfig, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wh.Secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+signPayload(wh.Secret, body))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// emitTagged reports that tags were applied to a document.
+func (app *App) emitTagged(ulid, name, user string, tags ...string) {
+	app.emit(app.taggedEvent(ulid, name, user, tags...))
+}
+
+func (app *App) taggedEvent(ulid, name, user string, tags ...string) Event {
+	data := map[string]any{"tags": tags}
+	if user != "" {
+		data["user"] = user
+	}
+	return Event{Type: eventDocumentTagged, Time: time.Now(), Profile: app.config().Profile, ULID: ulid, Name: name, Data: data}
+}
+
+// validateWebhooks checks webhook URLs and event names.
+func validateWebhooks(hooks []WebhookConfig) error {
+	known := []string{eventOCRCompleted, eventDateInferred, eventDocumentTagged, eventInboxZero}
+	for i, wh := range hooks {
+		if wh.URL == "" {
+			return fmt.Errorf("webhook %d has no url", i+1)
+		}
+		for _, e := range wh.Events {
+			if !slices.Contains(known, e) {
+				return fmt.Errorf("webhook %s: unknown event %q", wh.URL, e)
+			}
+		}
+	}
+	return nil
+}